@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/services"
+)
+
+// migrateCommand brings the schema up to date, or moves it to -to, e.g.
+// to roll back a migration before running an older release
+func migrateCommand(args []string) error {
+	fs, configFile := newFlagSet("migrate", "migrate [-to VERSION]")
+	to := fs.Int("to", -1, "migrate the schema to this version instead of the latest")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	db, err := database.GetConnection(cfg.Database.Name)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %s", err)
+	}
+	defer db.Close()
+
+	if *to < 0 {
+		*to = database.LatestSchemaVersion()
+	}
+	if err := database.MigrateTo(db, *to); err != nil {
+		return err
+	}
+	log.Printf("Database schema is at version %d", *to)
+	return nil
+}
+
+// seedCommand fills an empty database with a demo hunt
+func seedCommand(args []string) error {
+	fs, configFile := newFlagSet("seed", "seed")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	store, err := database.NewDatabaseStore(cfg.Database.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %s", err)
+	}
+	defer store.DB.Close()
+
+	us := services.NewUserService(services.User{}, store, newStorage(cfg))
+	if _, err := us.SeedDemo(context.Background()); err != nil {
+		return fmt.Errorf("failed to seed demo hunt: %s", err)
+	}
+	log.Printf("Demo teams log in with the password %q", services.DemoPassword)
+	return nil
+}
+
+// createAdminTokenCommand mints an admin API token. The /sudo panel has a
+// single password, ADMIN_PASS; tokens are the per-person admin accounts,
+// for the admin API, /metrics and scripts
+func createAdminTokenCommand(args []string) error {
+	fs, configFile := newFlagSet("create-admin-token", "create-admin-token -name NAME")
+	name := fs.String("name", "", "who or what the token is for")
+	fs.Parse(args)
+
+	if *name == "" {
+		fs.Usage()
+		return errors.New("create-admin-token needs -name")
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	store, err := database.NewDatabaseStore(cfg.Database.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %s", err)
+	}
+	defer store.DB.Close()
+
+	us := services.NewUserService(services.User{}, store, nil)
+	token, err := us.CreateAdminAPIToken(context.Background(), *name)
+	if err != nil {
+		return err
+	}
+
+	// The token can't be shown again, so it goes to stdout on its own for
+	// scripts to capture
+	log.Printf("Created admin API token %q; send it as Authorization: Bearer <token>", *name)
+	fmt.Println(token)
+	return nil
+}
+
+// resetHuntCommand wipes the hunt's progress so the questions can be
+// played again, backing the database up first
+func resetHuntCommand(args []string) error {
+	fs, configFile := newFlagSet("reset-hunt", "reset-hunt -yes [-teams] [-no-backup]")
+	yes := fs.Bool("yes", false, "confirm the reset")
+	deleteTeams := fs.Bool("teams", false, "delete the teams as well")
+	noBackup := fs.Bool("no-backup", false, "skip the backup taken before the reset")
+	fs.Parse(args)
+
+	if !*yes {
+		fs.Usage()
+		return errors.New("reset-hunt deletes every solve, attempt, hint unlock, notification and chat message; pass -yes to go ahead")
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	store, err := database.NewDatabaseStore(cfg.Database.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %s", err)
+	}
+	defer store.DB.Close()
+
+	ctx := context.Background()
+	us := services.NewUserService(services.User{}, store, newStorage(cfg))
+	us.Backups = backupConfig(cfg)
+
+	if !*noBackup {
+		if _, err := us.CreateBackup(ctx); err != nil {
+			return fmt.Errorf("failed to back up before the reset: %s", err)
+		}
+	}
+
+	deleted, err := us.ResetHunt(ctx, *deleteTeams)
+	if err != nil {
+		return err
+	}
+	if *deleteTeams {
+		log.Printf("Hunt reset, %d teams deleted", deleted)
+	} else {
+		log.Println("Hunt reset, every team is back to zero points")
+	}
+	log.Println("Restart running servers so they drop what they hold in memory")
+	return nil
+}
+
+// backupCommand backs the database up
+func backupCommand(args []string) error {
+	fs, configFile := newFlagSet("backup", "backup")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	db, err := database.GetConnection(cfg.Database.Name)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %s", err)
+	}
+	defer db.Close()
+
+	us := services.NewUserService(services.User{}, database.DatabaseStore{DB: db}, newStorage(cfg))
+	us.Backups = backupConfig(cfg)
+	_, err = us.CreateBackup(context.Background())
+	return err
+}
+
+// restoreCommand replaces the database with a backup; stop the server
+// first
+func restoreCommand(args []string) error {
+	fs, configFile := newFlagSet("restore", "restore BACKUP")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("restore needs a backup name or file")
+	}
+	from := fs.Arg(0)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if err := restore(from, cfg.Database.Name, newStorage(cfg), backupConfig(cfg)); err != nil {
+		return err
+	}
+	log.Printf("Database restored from %s", from)
+	return nil
+}
+
+// restore replaces the database with a backup, given by name as listed by
+// the admin API or as a path to a backup file
+func restore(from, dbName string, storage services.Storage, backups services.BackupConfig) error {
+	ctx := context.Background()
+	path := from
+	if _, err := os.Stat(from); err != nil {
+		us := services.NewUserService(services.User{}, database.DatabaseStore{}, storage)
+		us.Backups = backups
+		fetched, cleanup, err := us.FetchBackup(ctx, from)
+		if err != nil {
+			return fmt.Errorf("failed to find backup %s: %s", from, err)
+		}
+		defer cleanup()
+		path = fetched
+	}
+
+	return database.Restore(ctx, dbName, path)
+}
+
+// exportCommand writes the archive of a hunt, for keeping a record of the
+// event or looking at it offline
+func exportCommand(args []string) error {
+	fs, configFile := newFlagSet("export", "export [-hunt SLUG] [-o FILE]")
+	slug := fs.String("hunt", "main", "the slug of the hunt to export")
+	out := fs.String("o", "", "where to write the archive, hunt-SLUG.zip by default")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	store, err := database.NewDatabaseStore(cfg.Database.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %s", err)
+	}
+	defer store.DB.Close()
+
+	ctx := context.Background()
+	us := services.NewUserService(services.User{}, store, newStorage(cfg))
+	hunt, err := us.GetHuntBySlug(ctx, *slug)
+	if err != nil {
+		return fmt.Errorf("failed to find hunt %q: %s", *slug, err)
+	}
+	if *out == "" {
+		*out = "hunt-" + hunt.Slug + ".zip"
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := us.ExportHunt(ctx, hunt.ID, f); err != nil {
+		f.Close()
+		os.Remove(*out)
+		return fmt.Errorf("failed to export hunt: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("Hunt %q exported to %s", hunt.Slug, *out)
+	return nil
+}
+
+// importCommand rebuilds a hunt from an archive, e.g. to promote a hunt
+// from staging or recover one into a fresh database
+func importCommand(args []string) error {
+	fs, configFile := newFlagSet("import", "import [-full] [-hunt SLUG] ARCHIVE")
+	full := fs.Bool("full", false, "bring back the teams and their progress too, not just the questions")
+	slug := fs.String("hunt", "", "import into this hunt instead of the one archived")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("import needs an archive")
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	store, err := database.NewDatabaseStore(cfg.Database.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %s", err)
+	}
+	defer store.DB.Close()
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	us := services.NewUserService(services.User{}, store, newStorage(cfg))
+	summary, err := us.ImportHunt(context.Background(), f, info.Size(), services.ImportOptions{Full: *full, Slug: *slug})
+	if err != nil {
+		return fmt.Errorf("failed to import hunt: %s", err)
+	}
+	log.Printf("Hunt %q imported from %s", summary.Hunt.Slug, fs.Arg(0))
+	return nil
+}
+
+// purgeCommand applies the data retention policy now, or with -dry-run
+// reports what it would remove, printing the report as JSON
+func purgeCommand(args []string) error {
+	fs, configFile := newFlagSet("purge", "purge [-dry-run] [-hunt SLUG]")
+	dryRun := fs.Bool("dry-run", false, "report what would be removed without removing it")
+	slug := fs.String("hunt", "main", "the slug of the hunt to purge")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	store, err := database.NewDatabaseStore(cfg.Database.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %s", err)
+	}
+	defer store.DB.Close()
+
+	us := services.NewUserService(services.User{}, store, newStorage(cfg))
+	us.Hunt = services.HuntWindow{Start: cfg.Hunt.Start, End: cfg.Hunt.End, TeamDuration: cfg.Hunt.TeamDuration}
+	ctx := context.Background()
+	hunt, err := us.GetHuntBySlug(ctx, *slug)
+	if err != nil {
+		return fmt.Errorf("failed to find hunt %q: %s", *slug, err)
+	}
+	report, err := us.PurgeRetained(ctx, hunt.ID, *dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to purge: %s", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
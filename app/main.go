@@ -2,10 +2,16 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/sessions"
@@ -13,74 +19,44 @@ import (
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/namishh/holmes/config"
 	"github.com/namishh/holmes/database"
 	"github.com/namishh/holmes/handlers"
+	"github.com/namishh/holmes/i18n"
+	"github.com/namishh/holmes/public"
 	"github.com/namishh/holmes/services"
+	"golang.org/x/time/rate"
 )
 
-func initMinioClient() (*minio.Client, error) {
-	endpoint := os.Getenv("BUCKET_ENDPOINT")
-	accessKeyID := os.Getenv("BUCKET_ACCESSKEY")
-	secretAccessKey := os.Getenv("BUCKET_SECRETKEY")
-	bucketName := os.Getenv("BUCKET_NAME")
-	
-	// If MinIO is not configured, return nil (optional dependency)
-	if endpoint == "" {
-		log.Println("MinIO not configured (BUCKET_ENDPOINT not set) - file uploads will be disabled")
-		return nil, nil
-	}
-	
-	// Use SSL only if explicitly enabled, default to false for local development
-	useSSL := os.Getenv("BUCKET_USE_SSL") == "true"
-	minioClient, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
-		Secure: useSSL,
-	})
-	if err != nil {
-		log.Printf("Warning: Failed to initialize MinIO client: %v - file uploads will be disabled", err)
-		return nil, nil
-	}
+const (
+	// huntEndCheckInterval is how soon after the hunt's end time the final
+	// standings are saved and teams told
+	huntEndCheckInterval = 5 * time.Second
 
-	// Create bucket if it doesn't exist
-	ctx := context.Background()
-	exists, err := minioClient.BucketExists(ctx, bucketName)
-	if err != nil {
-		log.Printf("Warning: Failed to check if bucket exists: %v - file uploads will be disabled", err)
-		return nil, nil
-	}
-	
-	if !exists {
-		err = minioClient.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{})
-		if err != nil {
-			log.Printf("Warning: Failed to create bucket '%s': %v - file uploads will be disabled", bucketName, err)
-			return nil, nil
-		}
-		log.Printf("Successfully created MinIO bucket: %s", bucketName)
-		
-		// Set bucket policy to make it publicly readable
-		policy := fmt.Sprintf(`{
-			"Version": "2012-10-17",
-			"Statement": [{
-				"Effect": "Allow",
-				"Principal": {"AWS": ["*"]},
-				"Action": ["s3:GetObject"],
-				"Resource": ["arn:aws:s3:::%s/*"]
-			}]
-		}`, bucketName)
-		
-		err = minioClient.SetBucketPolicy(ctx, bucketName, policy)
-		if err != nil {
-			log.Printf("Warning: Failed to set public policy on bucket: %v", err)
-		} else {
-			log.Printf("Bucket '%s' is now publicly readable", bucketName)
-		}
-	}
+	// huntEndedTop is how many of the final standings the hunt.ended
+	// webhook carries
+	huntEndedTop = 10
+)
 
-	log.Printf("Successfully connected to MinIO bucket '%s' at %s (SSL: %v)", bucketName, endpoint, useSSL)
+// command is a subcommand of the holmes binary
+type command struct {
+	summary string
+	run     func(args []string) error
+}
 
-	return minioClient, nil
+// commands maps each subcommand to what it does; serve runs when none is
+// given. See commands.go for the ones besides serve
+var commands = map[string]command{
+	"serve":              {"run the server (the default)", serveCommand},
+	"migrate":            {"bring the database schema up to date, or move it to a version", migrateCommand},
+	"seed":               {"fill an empty database with a demo hunt", seedCommand},
+	"create-admin-token": {"create an admin API token", createAdminTokenCommand},
+	"reset-hunt":         {"wipe every team's progress, keeping questions", resetHuntCommand},
+	"backup":             {"back up the database", backupCommand},
+	"restore":            {"restore the database from a backup; stop the server first", restoreCommand},
+	"export":             {"write a hunt with its media and every team's progress to an archive", exportCommand},
+	"import":             {"rebuild a hunt from an archive", importCommand},
+	"purge":              {"apply the data retention policy, or with -dry-run report what it would remove", purgeCommand},
 }
 
 func main() {
@@ -91,25 +67,179 @@ func main() {
 		}
 	}
 
-	minioClient, err := initMinioClient()
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage()
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "holmes: unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// usage lists the subcommands
+func usage() {
+	names := make([]string, 0, len(commands))
+	width := 0
+	for name := range commands {
+		names = append(names, name)
+		width = max(width, len(name))
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: holmes [command] [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-*s  %s\n", width, name, commands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun holmes <command> -h for a command's flags")
+}
+
+// newFlagSet starts the flags of a subcommand with -config, which every
+// one of them takes
+func newFlagSet(name, usage string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: holmes %s\n\n", usage)
+		fs.PrintDefaults()
+	}
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "read settings from this YAML or TOML file; environment variables override it")
+	return fs, configFile
+}
+
+// loadConfig reads the settings and hands the ones kept in package state
+// to their packages
+func loadConfig(configFile string) (config.Config, error) {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return cfg, err
+	}
+	if err := cfg.ValidateDatabase(); err != nil {
+		return cfg, err
+	}
+	if configFile != "" {
+		log.Printf("Loaded settings from %s", configFile)
+	}
+
+	database.Configure(database.Config{
+		URL:               cfg.Database.URL,
+		QueryTimeout:      cfg.Database.QueryTimeout,
+		SQLiteBusyTimeout: cfg.Database.SQLiteBusyTimeout,
+		Pool: database.PoolConfig{
+			MaxOpenConns:    cfg.Database.MaxOpenConns,
+			MaxIdleConns:    cfg.Database.MaxIdleConns,
+			ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+			ConnMaxIdleTime: cfg.Database.ConnMaxIdleTime,
+		},
+	})
+	services.QuotaLimit = cfg.Quota.Limit
+	services.SlotDuration = cfg.Quota.Slot
+	handlers.StrictRateLimit = handlers.RateLimit(cfg.RateLimits.Strict)
+	handlers.ModerateRateLimit = handlers.RateLimit(cfg.RateLimits.Moderate)
+
+	return cfg, nil
+}
+
+// newStorage picks where uploads go: S3, MinIO or GCS when configured,
+// local disk otherwise
+func newStorage(cfg config.Config) services.Storage {
+	return services.NewStorage(services.StorageConfig{
+		Backend:   cfg.Storage.Backend, // "s3", "minio", "gcs", "local" or empty for auto
+		Endpoint:  cfg.Storage.Endpoint,
+		AccessKey: cfg.Storage.AccessKey,
+		SecretKey: cfg.Storage.SecretKey,
+		Bucket:    cfg.Storage.Bucket,
+		Region:    cfg.Storage.Region,
+		UseSSL:    cfg.Storage.UseSSL,
+		PublicURL: cfg.Storage.PublicURL, // e.g., a CDN in front of the bucket
+	})
+}
+
+// backupConfig says where database backups go: the backup directory or,
+// with the bucket target, the storage bucket
+func backupConfig(cfg config.Config) services.BackupConfig {
+	return services.BackupConfig{
+		Target: cfg.Backups.Target, // "local" (default) or "bucket"
+		Dir:    cfg.Backups.Dir,    // default "backups"
+		Keep:   cfg.Backups.Keep,   // default 7, -1 keeps everything
+	}
+}
+
+// serveCommand runs the server until SIGINT or SIGTERM. The flags from
+// before subcommands existed still work
+func serveCommand(args []string) error {
+	fs, configFile := newFlagSet("serve", "serve [flags]")
+	migrateTo := fs.Int("migrate-to", -1, "same as migrate -to")
+	backupNow := fs.Bool("backup", false, "same as the backup command")
+	restoreFrom := fs.String("restore", "", "same as the restore command")
+	seed := fs.Bool("seed", false, "same as the seed command")
+	fs.Parse(args)
+
+	legacy := []string{"-config", *configFile}
+	switch {
+	case *migrateTo >= 0:
+		return migrateCommand(append(legacy, "-to", fmt.Sprint(*migrateTo)))
+	case *backupNow:
+		return backupCommand(legacy)
+	case *restoreFrom != "":
+		return restoreCommand(append(legacy, *restoreFrom))
+	case *seed:
+		return seedCommand(legacy)
+	}
+
+	cfg, err := loadConfig(*configFile)
 	if err != nil {
-		log.Printf("Warning: MinIO initialization failed: %v", err)
-		// Continue anyway - MinIO is optional
+		return err
+	}
+	// Refuse to start without a usable secret and admin password
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	// Translations from LOCALES_DIR go over the bundled ones
+	if err := i18n.Load(cfg.I18n.Dir, cfg.I18n.DefaultLocale); err != nil {
+		return err
 	}
+	storage := newStorage(cfg)
+	backups := backupConfig(cfg)
 
 	e := echo.New()
-	SECRET_KEY := os.Getenv("SECRET")
-	DB_NAME := os.Getenv("DB_NAME")
+	SECRET_KEY := cfg.Secret
+	DB_NAME := cfg.Database.Name
 	e.HTTPErrorHandler = handlers.CustomHTTPErrorHandler
 
 	e.Use(middleware.Logger())
-	e.Use(middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(20)))
+	e.Use(handlers.PrometheusMiddleware())
+	e.Use(middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(rate.Limit(cfg.RateLimits.Global))))
+
+	// Timeouts (0 uses the defaults) and body sizes such as "2M"; event
+	// streams and admin uploads are exempt from the timeouts
+	serverConfig := handlers.ServerConfig{
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout, // default 10s
+		ReadTimeout:       cfg.Server.ReadTimeout,       // default 30s
+		WriteTimeout:      cfg.Server.WriteTimeout,      // default 60s
+		IdleTimeout:       cfg.Server.IdleTimeout,       // default 120s
+		BodyLimit:         cfg.Server.BodyLimit,         // default "2M"
+		UploadBodyLimit:   cfg.Server.UploadBodyLimit,   // default "1G"
+	}
+	e.Use(handlers.ServerLimitsMiddleware(serverConfig))
 	
 	// CORS protection
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{os.Getenv("ALLOWED_ORIGIN")}, // Set in .env
+		AllowOrigins: []string{cfg.Server.AllowedOrigin},
 		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
 		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
+		ExposeHeaders: []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", echo.HeaderRetryAfter},
 		AllowCredentials: true,
 	}))
 	
@@ -122,63 +252,442 @@ func main() {
 		ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:;",
 	}))
 	
+	// Gzip pages and JSON for slow connections; event streams and media
+	// are sent as they are
+	if cfg.Server.Compression.Enabled {
+		e.Use(handlers.CompressionMiddleware(handlers.CompressionConfig{
+			Level:     cfg.Server.Compression.Level,    // 1 (fastest) to 9 (smallest), default 6
+			MinLength: cfg.Server.Compression.MinBytes, // default 1024
+		}))
+	}
+
 	e.Use(session.Middleware(sessions.NewCookieStore([]byte(SECRET_KEY))))
+	e.Use(handlers.LocaleMiddleware())
 
-	e.Static("/static", "public")
+	// Assets are embedded in the binary; in development they are read from
+	// public/ so rebuilt CSS shows up straight away
+	staticDir := ""
+	if cfg.IsDev() {
+		staticDir = "public"
+	}
+	e.StaticFS("/static", public.FS(staticDir))
 
 	store, err := database.NewDatabaseStore(DB_NAME)
 	if err != nil {
 		e.Logger.Fatalf("failed to create store: %s", err)
 	}
 
-	// Initialize broadcaster for SSE (with optional Redis support)
-	redisAddr := os.Getenv("REDIS_ADDR")       // e.g., "localhost:6379"
-	redisPassword := os.Getenv("REDIS_PASSWORD") // leave empty if no password
-	redisDB := 0                                  // default DB
+	// Initialize broadcaster for SSE (with optional Redis or NATS fan-out)
+	bus := services.NewMessageBus(services.MessageBusConfig{
+		Broker:        cfg.Events.Broker,     // "redis", "nats", "none" or empty for auto
+		InstanceID:    cfg.Events.InstanceID, // stable per instance, required with redis
+		RedisAddr:     cfg.Redis.Addr,        // e.g., "localhost:6379"
+		RedisPassword: cfg.Redis.Password,    // leave empty if no password
+		RedisDB:       0,                     // default DB
+		NATSURL:       cfg.Events.NATSURL,    // e.g., "nats://localhost:4222"
+	})
 	
-	broadcaster := services.NewBroadcaster(redisAddr, redisPassword, redisDB)
+	broadcaster := services.NewBroadcaster(bus, services.BroadcasterOptions{
+		SlowClientPolicy: services.SlowClientPolicy(cfg.Events.SlowClientPolicy), // drop-oldest (default), disconnect or worker-pool
+		SendTimeout:      cfg.Events.SendTimeout,                                 // worker-pool only, default 100ms
+		Workers:          cfg.Events.Workers,                                     // worker-pool only, default 16
+	})
 	log.Println("Broadcaster initialized for real-time updates")
 
-	us := services.NewUserService(services.User{}, store, minioClient)
-	ah := handlers.NewAuthHandler(us, broadcaster)
+	us := services.NewUserService(services.User{}, store, storage)
+	us.Backups = backups
+
+	// Question locks expire after the lock TTL (default 10s); expired
+	// locks are ignored straight away and deleted by the cleanup job
+	us.LockTTL = cfg.Locks.TTL
+
+	us.Hunt = services.HuntWindow{Start: cfg.Hunt.Start, End: cfg.Hunt.End, TeamDuration: cfg.Hunt.TeamDuration}
+	if !us.Hunt.Start.IsZero() || !us.Hunt.End.IsZero() || us.Hunt.TeamDuration > 0 {
+		log.Printf("Hunt runs from %s", us.Hunt)
+	}
+
+	// Question text, media and hints are cached between admin edits; with
+	// several instances, point them all at the same Redis
+	us.Cache = services.NewQuestionCache(services.QuestionCacheConfig{
+		Backend:       cfg.QuestionCache.Backend, // "memory", "redis", "none" or empty for auto
+		TTL:           cfg.QuestionCache.TTL,     // default 5 minutes
+		RedisAddr:     cfg.Redis.Addr,
+		RedisPassword: cfg.Redis.Password,
+	})
+
+	// Per-file upload limits in MB (0 uses the defaults) and an optional
+	// malware scan of every upload
+	us.Uploads = services.UploadPolicy{
+		MaxImageSize: int64(cfg.Uploads.MaxImageMB) << 20,
+		MaxAudioSize: int64(cfg.Uploads.MaxAudioMB) << 20,
+		MaxVideoSize: int64(cfg.Uploads.MaxVideoMB) << 20,
+		MaxFileSize:  int64(cfg.Uploads.MaxFileMB) << 20,
+		Scanner: services.NewScanner(services.ScannerConfig{
+			ClamAVAddr: cfg.Uploads.ClamAVAddr, // e.g., "localhost:3310" or "/run/clamav/clamd.sock"
+			ICAPURL:    cfg.Uploads.ICAPURL,    // e.g., "icap://localhost:1344/avscan"
+		}),
+	}
+
+	// Web Push is enabled when a VAPID key pair is configured
+	webPush := services.NewWebPushSender(services.WebPushConfig{
+		PublicKey:  cfg.WebPush.PublicKey,
+		PrivateKey: cfg.WebPush.PrivateKey,
+		Subject:    cfg.WebPush.Subject,                // e.g., "mailto:admin@example.com"
+		TTL:        int(cfg.WebPush.TTL / time.Second), // seconds, default 3600
+	}, us)
+	if webPush != nil {
+		broadcaster.SetPusher(webPush)
+		log.Println("Web Push notifications enabled")
+	}
+
+	// Email is enabled when an SMTP host is configured
+	us.Mailer = services.NewMailer(services.MailConfig{
+		Host:     cfg.Mail.Host,
+		Port:     cfg.Mail.Port, // default 587, or 465 with implicit TLS
+		Username: cfg.Mail.Username,
+		Password: cfg.Mail.Password,
+		From:     cfg.Mail.From,    // e.g., "Holmes <hunt@example.com>"
+		TLS:      cfg.Mail.TLS,     // starttls (default), tls or none
+		BaseURL:  cfg.Mail.BaseURL, // e.g., "https://hunt.example.com"
+	})
+	if us.Mailer != nil {
+		log.Printf("Sending email through %s", cfg.Mail.Host)
+	}
+
+	// Teams can opt in to text messages when an SMS provider is configured
+	us.SMS, err = services.NewSMSSender(services.SMSConfig{
+		Provider:   cfg.SMS.Provider, // twilio or webhook
+		AccountSID: cfg.SMS.AccountSID,
+		AuthToken:  cfg.SMS.AuthToken,
+		From:       cfg.SMS.From, // a number or a Twilio messaging service
+		WebhookURL: cfg.SMS.WebhookURL,
+		Token:      cfg.SMS.WebhookToken,
+		BaseURL:    cfg.Mail.BaseURL, // links in texts, when set
+	})
+	if err != nil {
+		log.Printf("Text messages disabled: %v", err)
+	}
+	if us.SMS != nil {
+		log.Printf("Sending text messages through %s", cfg.SMS.Provider)
+	}
+
+	// Organiser alerts go to Slack when a webhook or bot token is configured
+	slack := services.NewSlackNotifier(services.SlackConfig{
+		WebhookURL: cfg.Slack.WebhookURL,
+		BotToken:   cfg.Slack.BotToken,
+		Channel:    cfg.Slack.Channel,                           // e.g., "#hunt-ops"
+		Alerts:     services.ParseSlackAlerts(cfg.Slack.Alerts), // default all
+		BaseURL:    cfg.Mail.BaseURL,                            // links to the panel, when set
+	})
+	if slack != nil {
+		broadcaster.AddListener(slack)
+		log.Printf("Sending %s alerts to Slack", strings.Join(services.ParseSlackAlerts(cfg.Slack.Alerts), ", "))
+	}
+
+	// Badges are awarded as solves are broadcast
+	broadcaster.AddListener(services.NewAchievementEngine(us, broadcaster))
+
+	ah := handlers.NewAuthHandler(us, broadcaster, webPush)
+
+	// Teams can link Telegram chats when a bot token is configured
+	tgCtx, tgCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ah.Telegram, err = services.NewTelegramBot(tgCtx, services.TelegramConfig{
+		Token:   cfg.Telegram.BotToken,
+		APIURL:  cfg.Telegram.APIURL,  // default https://api.telegram.org
+		Answers: cfg.Telegram.Answers, // answering from the chat is off by default
+		BaseURL: cfg.Mail.BaseURL,     // links in messages, when set
+	}, us)
+	tgCancel()
+	if err != nil {
+		log.Printf("Telegram bot disabled: %v", err)
+	}
+	if ah.Telegram != nil {
+		broadcaster.AddListener(ah.Telegram)
+		log.Printf("Telegram bot @%s enabled", ah.Telegram.Username())
+	}
+	ah.AdminPass = cfg.AdminPassword
+	ah.Server = serverConfig
+	handlers.RegisterMetrics(broadcaster, store.DB)
+
+	// Public stats for event websites, off unless the sections to expose
+	// are listed (teams, solves, first_bloods or all)
+	ah.PublicStats = handlers.NewPublicStats(handlers.PublicStatsConfig{
+		Sections:  handlers.ParseStatsSections(cfg.PublicStats.Sections),
+		TTL:       cfg.PublicStats.TTL,  // default 30s
+		RateLimit: cfg.PublicStats.Rate, // requests per second per IP, default 1
+	}, us)
 	
-	// Start periodic cleanup of stale question locks (every 1 minute)
-	// Locks older than 2 minutes are automatically removed
-	go func() {
-		ticker := time.NewTicker(1 * time.Minute)
-		defer ticker.Stop()
-		
-		// Run cleanup immediately on startup
-		if err := us.CleanupStaleLocks(); err != nil {
-			log.Printf("Error in initial lock cleanup: %v", err)
+	// SIGINT or SIGTERM shuts the server down gracefully, giving requests
+	// the shutdown timeout (default 30s) to finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownTimeout := cfg.Server.ShutdownTimeout
+
+	// every runs job each interval until shutdown, which waits for a run
+	// in progress to finish
+	var background sync.WaitGroup
+	every := func(interval time.Duration, job func()) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					job()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// Start periodic cleanup of stale question locks, every lock cleanup
+	// interval (default 1m). This is the only place expired locks are
+	// deleted
+	lockCleanupInterval := cfg.Locks.CleanupInterval
+	every(lockCleanupInterval, func() {
+		if err := us.CleanupStaleLocks(context.Background()); err != nil {
+			log.Printf("Error in periodic lock cleanup: %v", err)
+		}
+	})
+
+	// Run cleanup immediately on startup
+	if err := us.CleanupStaleLocks(context.Background()); err != nil {
+		log.Printf("Error in initial lock cleanup: %v", err)
+	}
+	
+	// Start new quota windows for teams that hit their limit as soon as
+	// the window expires, so they can be told they can play again, every
+	// quota reset interval (default 1m)
+	every(cfg.Quota.ResetInterval, func() {
+		teams, err := us.ResetExhaustedQuotaSlots(context.Background())
+		if err != nil {
+			log.Printf("Error in periodic quota reset: %v", err)
+			return
 		}
-		
-		// Then run periodically
-		for range ticker.C {
-			if err := us.CleanupStaleLocks(); err != nil {
-				log.Printf("Error in periodic lock cleanup: %v", err)
+		for _, teamID := range teams {
+			broadcaster.BroadcastToTeam(teamID, services.EventQuotaReset, map[string]interface{}{
+				"questions_solved": 0,
+				"limit":            services.QuotaLimit,
+				"slot_start":       time.Now(),
+			})
+		}
+	})
+	
+	// Once a hunt's end time passes, save its final standings and tell
+	// its players; answers are already refused from that moment. Only the
+	// first server to save them sends the event
+	finishedAt := make(map[int]time.Time)
+	every(huntEndCheckInterval, func() {
+		ctx := context.Background()
+		hunts, err := us.GetHunts(ctx)
+		if err != nil {
+			log.Printf("Error listing hunts: %v", err)
+			return
+		}
+		for _, hunt := range hunts {
+			window := us.GetHuntWindow(ctx, hunt.ID)
+			if !window.Ended(time.Now()) || window.End.Equal(finishedAt[hunt.ID]) {
+				continue
+			}
+			saved, err := us.SaveFinalResults(ctx, hunt.ID, window.End)
+			if err != nil {
+				log.Printf("Error saving final results of hunt %s: %v", hunt.Slug, err)
+				continue
+			}
+			finishedAt[hunt.ID] = window.End
+			if !saved {
+				continue
+			}
+
+			results, err := us.GetFinalResults(ctx, hunt.ID)
+			if err != nil {
+				log.Printf("Error fetching final results of hunt %s: %v", hunt.Slug, err)
+			}
+			if len(results) > huntEndedTop {
+				results = results[:huntEndedTop]
+			}
+			broadcaster.BroadcastToHunt(hunt.ID, services.EventHuntEnded, map[string]interface{}{
+				"ended_at": window.End,
+			})
+			// hunts keys the standings by slug, as receivers written
+			// while every hunt ended together expect
+			err = us.QueueWebhookEvent(ctx, services.WebhookHuntEnded, map[string]interface{}{
+				"hunt":      hunt.Slug,
+				"ended_at":  window.End,
+				"standings": results,
+				"hunts":     map[string][]services.HuntResult{hunt.Slug: results},
+			})
+			if err != nil {
+				log.Printf("Error queueing hunt ended webhook: %v", err)
 			}
 		}
+	})
+
+	// Look through recent solves and logins for signs of cheating and
+	// tell the admins watching about what turns up
+	analyzer := services.NewActivityAnalyzer(us)
+	every(services.ActivityScanInterval, func() {
+		for _, alert := range analyzer.Scan(context.Background()) {
+			broadcaster.BroadcastToAdmins(services.EventAlert, services.AlertEvent(alert))
+		}
+	})
+
+	// Tell the admins watching, and Slack, when a dependency starts or
+	// stops failing
+	health := services.NewHealthMonitor(
+		services.HealthCheck{Name: "database", Check: us.PingDB},
+		services.HealthCheck{Name: "storage", Check: us.PingStorage},
+		services.HealthCheck{Name: "question_cache", Check: us.PingCache},
+		services.HealthCheck{Name: "message_bus", Check: broadcaster.PingBus},
+	)
+	every(services.HealthCheckInterval, func() {
+		if failing, changed := health.Check(context.Background()); changed {
+			log.Printf("Health changed, %d checks failing: %v", len(failing), failing)
+			broadcaster.BroadcastToAdmins(services.EventHealth, services.HealthEvent(failing))
+		}
+	})
+
+	if slack != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			slack.Run(ctx)
+		}()
+	}
+
+	// Send Telegram notifications and answer the bot's commands
+	if ah.Telegram != nil {
+		background.Add(2)
+		go func() {
+			defer background.Done()
+			ah.Telegram.Run(ctx)
+		}()
+		go func() {
+			defer background.Done()
+			ah.RunTelegramBot(ctx)
+		}()
+	}
+
+	// Deliver queued webhook events, retrying failures with backoff
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		services.NewWebhookDispatcher(us).Run(ctx, 5*time.Second)
 	}()
+
+	// Send queued emails, retrying failures with backoff, and remind
+	// teams by email shortly before the hunt starts
+	if us.Mailer != nil {
+		every(5*time.Second, func() {
+			us.DeliverDueEmails(context.Background())
+		})
+		every(time.Minute, func() {
+			if _, err := us.SendHuntReminders(context.Background(), cfg.Mail.ReminderBefore); err != nil {
+				log.Printf("Error sending hunt reminders: %v", err)
+			}
+		})
+	}
+
+	// Send queued text messages, and text teams that opted in when the
+	// hunt opens and shortly before it ends
+	if us.SMS != nil {
+		every(5*time.Second, func() {
+			us.DeliverDueSMS(context.Background())
+		})
+		every(15*time.Second, func() {
+			if _, err := us.SendHuntOpenSMS(context.Background()); err != nil {
+				log.Printf("Error texting that the hunt opened: %v", err)
+			}
+			if _, err := us.SendFinalWarningSMS(context.Background(), cfg.SMS.FinalWarning); err != nil {
+				log.Printf("Error texting the final warning: %v", err)
+			}
+		})
+	}
+
+	// Remove stored media that no question references any more, and
+	// uploads that were never finished
+	every(time.Hour, func() {
+		deleted, err := us.CleanupOrphanedMedia(context.Background())
+		if err != nil {
+			log.Printf("Error in orphaned media cleanup: %v", err)
+			return
+		}
+		if deleted > 0 {
+			log.Printf("Deleted %d orphaned media objects", deleted)
+		}
+
+		stale, err := us.CleanupStaleUploads(context.Background())
+		if err != nil {
+			log.Printf("Error in stale upload cleanup: %v", err)
+		} else if stale > 0 {
+			log.Printf("Discarded %d abandoned uploads", stale)
+		}
+	})
+
+	// Anonymize or delete what the retention policy says once its days
+	// have passed since each hunt ended
+	every(time.Hour, func() {
+		if err := us.PurgeAllRetained(context.Background()); err != nil {
+			log.Printf("Error in retention purge: %v", err)
+		}
+	})
 	
+	// Back up the database every backup interval, off by default
+	if interval := cfg.Backups.Interval; interval > 0 {
+		every(interval, func() {
+			if _, err := us.CreateBackup(context.Background()); err != nil {
+				log.Printf("Error in scheduled backup: %v", err)
+			}
+		})
+		log.Printf("Backing up the database every %v", interval)
+	}
+
 	// Start periodic cleanup of admin rate limiter (every 30 minutes)
+	every(30*time.Minute, handlers.CleanupAdminRateLimiter)
+
+	handlers.SetupRoutes(e, ah)
+
+	// Start server
+	port := cfg.Server.Port
+	server := handlers.NewServer(":"+port, serverConfig)
+	// Runs once the listener is closed, so clients can't reconnect here
+	server.RegisterOnShutdown(broadcaster.Shutdown)
+
+	log.Printf("Starting server on :%s", port)
 	go func() {
-		ticker := time.NewTicker(30 * time.Minute)
-		defer ticker.Stop()
-		
-		// Run periodically
-		for range ticker.C {
-			handlers.CleanupAdminRateLimiter()
+		if err := e.StartServer(server); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
 		}
 	}()
 
-	handlers.SetupRoutes(e, ah)
+	<-ctx.Done()
+	stop()
+	log.Printf("Shutting down, waiting up to %s for requests to finish", shutdownTimeout)
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "4200"
+	// Stop accepting connections, end event streams and wait for
+	// in-flight requests such as answer submissions
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
 	}
-	log.Printf("Starting server on :%s", port)
-	e.Logger.Fatal(e.Start(":" + port))
+
+	// WebSockets are hijacked from the server, so Shutdown doesn't wait
+	// for them to close
+	for broadcaster.GetClientCount() > 0 && shutdownCtx.Err() == nil {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Let background jobs finish what they are doing
+	background.Wait()
+	broadcaster.Close()
+	if err := store.DB.Close(); err != nil {
+		log.Printf("Error closing database: %v", err)
+	}
+	log.Println("Server stopped")
+	return nil
 }
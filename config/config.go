@@ -0,0 +1,578 @@
+// Package config gathers the server's settings into one typed struct.
+// Settings come from an optional YAML or TOML file, and environment
+// variables override the file, so deployments configured only through the
+// environment keep working unchanged
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the server reads at startup. Zero values
+// leave the choice to the component using the setting, which applies its
+// own default
+type Config struct {
+	Environment   string `yaml:"environment" toml:"environment"` // "DEV" reads assets from disk
+	Secret        string `yaml:"secret" toml:"secret"`           // session cookie key
+	AdminPassword string `yaml:"admin_password" toml:"admin_password"`
+
+	Server        ServerConfig        `yaml:"server" toml:"server"`
+	Database      DatabaseConfig      `yaml:"database" toml:"database"`
+	Storage       StorageConfig       `yaml:"storage" toml:"storage"`
+	Backups       BackupConfig        `yaml:"backups" toml:"backups"`
+	Redis         RedisConfig         `yaml:"redis" toml:"redis"`
+	Events        EventsConfig        `yaml:"events" toml:"events"`
+	QuestionCache QuestionCacheConfig `yaml:"question_cache" toml:"question_cache"`
+	Locks         LockConfig          `yaml:"locks" toml:"locks"`
+	Quota         QuotaConfig         `yaml:"quota" toml:"quota"`
+	RateLimits    RateLimitConfig     `yaml:"rate_limits" toml:"rate_limits"`
+	Hunt          HuntConfig          `yaml:"hunt" toml:"hunt"`
+	Uploads       UploadConfig        `yaml:"uploads" toml:"uploads"`
+	WebPush       WebPushConfig       `yaml:"web_push" toml:"web_push"`
+	PublicStats   PublicStatsConfig   `yaml:"public_stats" toml:"public_stats"`
+	Mail          MailConfig          `yaml:"mail" toml:"mail"`
+	Slack         SlackConfig         `yaml:"slack" toml:"slack"`
+	Telegram      TelegramConfig      `yaml:"telegram" toml:"telegram"`
+	SMS           SMSConfig           `yaml:"sms" toml:"sms"`
+	I18n          I18nConfig          `yaml:"i18n" toml:"i18n"`
+}
+
+type ServerConfig struct {
+	Port              string        `yaml:"port" toml:"port"`
+	AllowedOrigin     string        `yaml:"allowed_origin" toml:"allowed_origin"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	BodyLimit         string        `yaml:"body_limit" toml:"body_limit"`               // e.g. "2M"
+	UploadBodyLimit   string        `yaml:"upload_body_limit" toml:"upload_body_limit"` // e.g. "1G"
+	Compression       Compression   `yaml:"compression" toml:"compression"`
+}
+
+type Compression struct {
+	Enabled  bool `yaml:"enabled" toml:"enabled"`
+	Level    int  `yaml:"level" toml:"level"`
+	MinBytes int  `yaml:"min_bytes" toml:"min_bytes"`
+}
+
+// DatabaseConfig selects the database. PostgreSQL is used when URL is
+// set, the SQLite file Name otherwise. Pool sizes and lifetimes of zero
+// take the driver's defaults; a negative value turns the setting off
+type DatabaseConfig struct {
+	Name              string        `yaml:"name" toml:"name"`
+	URL               string        `yaml:"url" toml:"url"`
+	QueryTimeout      time.Duration `yaml:"query_timeout" toml:"query_timeout"`
+	SQLiteBusyTimeout time.Duration `yaml:"sqlite_busy_timeout" toml:"sqlite_busy_timeout"`
+	MaxOpenConns      int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns      int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime   time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime   time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+}
+
+type StorageConfig struct {
+	Backend   string `yaml:"backend" toml:"backend"` // "s3", "minio", "gcs", "local" or empty for auto
+	Endpoint  string `yaml:"endpoint" toml:"endpoint"`
+	AccessKey string `yaml:"access_key" toml:"access_key"`
+	SecretKey string `yaml:"secret_key" toml:"secret_key"`
+	Bucket    string `yaml:"bucket" toml:"bucket"`
+	Region    string `yaml:"region" toml:"region"`
+	UseSSL    bool   `yaml:"use_ssl" toml:"use_ssl"`
+	PublicURL string `yaml:"public_url" toml:"public_url"`
+}
+
+type BackupConfig struct {
+	Target   string        `yaml:"target" toml:"target"` // "local" or "bucket"
+	Dir      string        `yaml:"dir" toml:"dir"`
+	Keep     int           `yaml:"keep" toml:"keep"`
+	Interval time.Duration `yaml:"interval" toml:"interval"` // zero turns scheduled backups off
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr" toml:"addr"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+type EventsConfig struct {
+	Broker string `yaml:"broker" toml:"broker"` // "redis", "nats", "none" or empty for auto
+
+	// InstanceID names this server's consumer group on the Redis stream,
+	// so it must stay the same across restarts and is required with Redis
+	InstanceID       string        `yaml:"instance_id" toml:"instance_id"`
+	NATSURL          string        `yaml:"nats_url" toml:"nats_url"`
+	SlowClientPolicy string        `yaml:"slow_client_policy" toml:"slow_client_policy"`
+	SendTimeout      time.Duration `yaml:"send_timeout" toml:"send_timeout"`
+	Workers          int           `yaml:"workers" toml:"workers"`
+}
+
+type QuestionCacheConfig struct {
+	Backend string        `yaml:"backend" toml:"backend"` // "memory", "redis", "none" or empty for auto
+	TTL     time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+type LockConfig struct {
+	TTL             time.Duration `yaml:"ttl" toml:"ttl"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" toml:"cleanup_interval"`
+}
+
+type QuotaConfig struct {
+	Limit int           `yaml:"limit" toml:"limit"` // questions per slot
+	Slot  time.Duration `yaml:"slot" toml:"slot"`
+
+	// ResetInterval is how often teams whose slot has run out are told
+	// they can play again
+	ResetInterval time.Duration `yaml:"reset_interval" toml:"reset_interval"`
+}
+
+// RateLimit allows Rate requests per second per client, in bursts of up
+// to Burst
+type RateLimit struct {
+	Rate  float64 `yaml:"rate" toml:"rate"`
+	Burst int     `yaml:"burst" toml:"burst"`
+}
+
+type RateLimitConfig struct {
+	Global   float64   `yaml:"global" toml:"global"` // requests per second per client, across the site
+	Strict   RateLimit `yaml:"strict" toml:"strict"`
+	Moderate RateLimit `yaml:"moderate" toml:"moderate"`
+}
+
+// HuntConfig is when the hunt runs; a zero time leaves that end open
+type HuntConfig struct {
+	Start time.Time `yaml:"start" toml:"start"`
+	End   time.Time `yaml:"end" toml:"end"`
+
+	// TeamDuration gives every team its own clock of this length, from its
+	// first login or an assigned start; zero runs everyone together
+	TeamDuration time.Duration `yaml:"team_duration" toml:"team_duration"`
+}
+
+type UploadConfig struct {
+	MaxImageMB int    `yaml:"max_image_mb" toml:"max_image_mb"`
+	MaxAudioMB int    `yaml:"max_audio_mb" toml:"max_audio_mb"`
+	MaxVideoMB int    `yaml:"max_video_mb" toml:"max_video_mb"`
+	MaxFileMB  int    `yaml:"max_file_mb" toml:"max_file_mb"`
+	ClamAVAddr string `yaml:"clamav_addr" toml:"clamav_addr"`
+	ICAPURL    string `yaml:"icap_url" toml:"icap_url"`
+}
+
+type WebPushConfig struct {
+	PublicKey  string        `yaml:"public_key" toml:"public_key"`
+	PrivateKey string        `yaml:"private_key" toml:"private_key"`
+	Subject    string        `yaml:"subject" toml:"subject"`
+	TTL        time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+type PublicStatsConfig struct {
+	Sections string        `yaml:"sections" toml:"sections"` // teams, solves, first_bloods or all
+	TTL      time.Duration `yaml:"ttl" toml:"ttl"`
+	Rate     float64       `yaml:"rate" toml:"rate"`
+}
+
+// MailConfig is the SMTP server emails go out through; email is off
+// without a host
+type MailConfig struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	From     string `yaml:"from" toml:"from"`
+	TLS      string `yaml:"tls" toml:"tls"`           // "starttls", "tls" or "none"
+	BaseURL  string `yaml:"base_url" toml:"base_url"` // where links in emails point
+
+	// ReminderBefore is how long before the hunt starts teams are emailed
+	// a reminder; zero sends none
+	ReminderBefore time.Duration `yaml:"reminder_before" toml:"reminder_before"`
+}
+
+// SlackConfig is where organiser alerts are posted; Slack is off without
+// a webhook URL or bot token
+type SlackConfig struct {
+	WebhookURL string `yaml:"webhook_url" toml:"webhook_url"`
+	BotToken   string `yaml:"bot_token" toml:"bot_token"`
+	Channel    string `yaml:"channel" toml:"channel"` // with a bot token, e.g. "#hunt-ops"
+	Alerts     string `yaml:"alerts" toml:"alerts"`   // suspicious, health, clarifications, lockouts or all
+}
+
+// TelegramConfig is the bot teams link their chats to; it is off without
+// a token
+type TelegramConfig struct {
+	BotToken string `yaml:"bot_token" toml:"bot_token"`
+	APIURL   string `yaml:"api_url" toml:"api_url"` // a self-hosted Bot API server
+	Answers  bool   `yaml:"answers" toml:"answers"` // let teams answer questions from the chat
+}
+
+// SMSConfig is the provider critical notifications are texted through;
+// text messages are off without one
+type SMSConfig struct {
+	Provider     string `yaml:"provider" toml:"provider"` // "twilio" or "webhook"
+	AccountSID   string `yaml:"account_sid" toml:"account_sid"`
+	AuthToken    string `yaml:"auth_token" toml:"auth_token"`
+	From         string `yaml:"from" toml:"from"` // a number, or a Twilio messaging service ("MG...")
+	WebhookURL   string `yaml:"webhook_url" toml:"webhook_url"`
+	WebhookToken string `yaml:"webhook_token" toml:"webhook_token"`
+
+	// FinalWarning is how long before the hunt ends teams are texted a
+	// warning; zero sends none
+	FinalWarning time.Duration `yaml:"final_warning" toml:"final_warning"`
+}
+
+// I18nConfig sets the languages teams see the hunt in
+type I18nConfig struct {
+	// DefaultLocale is the language of visitors who haven't picked one
+	// and whose browser asks for none there are translations for
+	DefaultLocale string `yaml:"default_locale" toml:"default_locale"`
+	// Dir holds <code>.json translation files read over the bundled ones
+	Dir string `yaml:"dir" toml:"dir"`
+}
+
+// Default returns the settings used when neither the file nor the
+// environment sets them
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:            "4200",
+			ShutdownTimeout: 30 * time.Second,
+			Compression:     Compression{Enabled: true},
+		},
+		Locks: LockConfig{
+			CleanupInterval: time.Minute,
+		},
+		Quota: QuotaConfig{
+			Limit:         10,
+			Slot:          10 * time.Hour,
+			ResetInterval: time.Minute,
+		},
+		RateLimits: RateLimitConfig{
+			Global:   20,
+			Strict:   RateLimit{Rate: 2, Burst: 5},
+			Moderate: RateLimit{Rate: 10, Burst: 20},
+		},
+		SMS: SMSConfig{
+			FinalWarning: time.Hour,
+		},
+	}
+}
+
+// Load reads the config file at path, if one is given, over the defaults
+// and then applies the environment. The file format follows its
+// extension: .yaml, .yml or .toml
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return Config{}, fmt.Errorf("failed to read config file %s: %s", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return Config{}, err
+	}
+
+	// Settings the server can't run without fall back to their defaults
+	def := Default()
+	if cfg.Server.Port == "" {
+		cfg.Server.Port = def.Server.Port
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		cfg.Server.ShutdownTimeout = def.Server.ShutdownTimeout
+	}
+	if cfg.Locks.CleanupInterval <= 0 {
+		cfg.Locks.CleanupInterval = def.Locks.CleanupInterval
+	}
+	if cfg.Quota.Limit <= 0 {
+		cfg.Quota.Limit = def.Quota.Limit
+	}
+	if cfg.Quota.Slot <= 0 {
+		cfg.Quota.Slot = def.Quota.Slot
+	}
+	if cfg.Quota.ResetInterval <= 0 {
+		cfg.Quota.ResetInterval = def.Quota.ResetInterval
+	}
+
+	// A hostname changes with every container, and a new consumer group
+	// would skip the events published while the old one was down
+	if cfg.UsesRedisEvents() && cfg.Events.InstanceID == "" {
+		return Config{}, errors.New("events.instance_id (INSTANCE_ID) must be set when events go through Redis, to a value that stays the same across restarts")
+	}
+
+	return cfg, nil
+}
+
+// UsesRedisEvents reports whether events are fanned out through Redis:
+// chosen as the broker, or picked because a Redis address is set
+func (cfg Config) UsesRedisEvents() bool {
+	return cfg.Events.Broker == "redis" || (cfg.Events.Broker == "" && cfg.Redis.Addr != "")
+}
+
+// readFile decodes a config file over cfg, rejecting keys it doesn't know
+// so a misspelt setting isn't silently ignored
+func (cfg *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown setting %s", undecoded[0])
+		}
+	default:
+		return errors.New("unsupported format, use .yaml, .yml or .toml")
+	}
+	return nil
+}
+
+// applyEnv overrides cfg with the environment variables that are set.
+// Durations keep the units the variables have always used
+func (cfg *Config) applyEnv() error {
+	env := envReader{}
+
+	env.string("ENVIRONMENT", &cfg.Environment)
+	env.string("SECRET", &cfg.Secret)
+	env.string("ADMIN_PASS", &cfg.AdminPassword)
+
+	s := &cfg.Server
+	env.string("PORT", &s.Port)
+	env.string("ALLOWED_ORIGIN", &s.AllowedOrigin)
+	env.duration("SERVER_READ_HEADER_TIMEOUT", time.Second, &s.ReadHeaderTimeout)
+	env.duration("SERVER_READ_TIMEOUT", time.Second, &s.ReadTimeout)
+	env.duration("SERVER_WRITE_TIMEOUT", time.Second, &s.WriteTimeout)
+	env.duration("SERVER_IDLE_TIMEOUT", time.Second, &s.IdleTimeout)
+	env.duration("SHUTDOWN_TIMEOUT", time.Second, &s.ShutdownTimeout)
+	env.string("BODY_LIMIT", &s.BodyLimit)
+	env.string("UPLOAD_BODY_LIMIT", &s.UploadBodyLimit)
+	if v := os.Getenv("COMPRESSION"); v != "" {
+		s.Compression.Enabled = v != "off"
+	}
+	env.int("COMPRESSION_LEVEL", &s.Compression.Level)
+	env.int("COMPRESSION_MIN_BYTES", &s.Compression.MinBytes)
+
+	db := &cfg.Database
+	env.string("DB_NAME", &db.Name)
+	env.string("DATABASE_URL", &db.URL)
+	env.duration("DB_QUERY_TIMEOUT_MS", time.Millisecond, &db.QueryTimeout)
+	env.duration("SQLITE_BUSY_TIMEOUT_MS", time.Millisecond, &db.SQLiteBusyTimeout)
+	if db.URL == "" {
+		env.int("SQLITE_MAX_OPEN_CONNS", &db.MaxOpenConns)
+	}
+	env.int("DB_MAX_OPEN_CONNS", &db.MaxOpenConns)
+	env.int("DB_MAX_IDLE_CONNS", &db.MaxIdleConns)
+	env.duration("DB_CONN_MAX_LIFETIME_SECONDS", time.Second, &db.ConnMaxLifetime)
+	env.duration("DB_CONN_MAX_IDLE_SECONDS", time.Second, &db.ConnMaxIdleTime)
+	// These variables have always used 0 for "none", "forever" or "don't wait"
+	env.zeroDurationMeansOff("SQLITE_BUSY_TIMEOUT_MS", &db.SQLiteBusyTimeout)
+	env.zeroMeansOff("DB_MAX_IDLE_CONNS", &db.MaxIdleConns)
+	env.zeroDurationMeansOff("DB_CONN_MAX_LIFETIME_SECONDS", &db.ConnMaxLifetime)
+	env.zeroDurationMeansOff("DB_CONN_MAX_IDLE_SECONDS", &db.ConnMaxIdleTime)
+
+	st := &cfg.Storage
+	env.string("STORAGE_BACKEND", &st.Backend)
+	env.string("BUCKET_ENDPOINT", &st.Endpoint)
+	env.string("BUCKET_ACCESSKEY", &st.AccessKey)
+	env.string("BUCKET_SECRETKEY", &st.SecretKey)
+	env.string("BUCKET_NAME", &st.Bucket)
+	env.string("BUCKET_REGION", &st.Region)
+	if v := os.Getenv("BUCKET_USE_SSL"); v != "" {
+		st.UseSSL = v == "true"
+	}
+	env.string("BUCKET_PUBLIC_URL", &st.PublicURL)
+
+	b := &cfg.Backups
+	env.string("BACKUP_TARGET", &b.Target)
+	env.string("BACKUP_DIR", &b.Dir)
+	env.int("BACKUP_KEEP", &b.Keep)
+	env.duration("BACKUP_INTERVAL_HOURS", time.Hour, &b.Interval)
+
+	env.string("REDIS_ADDR", &cfg.Redis.Addr)
+	env.string("REDIS_PASSWORD", &cfg.Redis.Password)
+
+	ev := &cfg.Events
+	env.string("MESSAGE_BROKER", &ev.Broker)
+	env.string("INSTANCE_ID", &ev.InstanceID)
+	env.string("NATS_URL", &ev.NATSURL)
+	env.string("SSE_SLOW_CLIENT_POLICY", &ev.SlowClientPolicy)
+	env.duration("SSE_SEND_TIMEOUT_MS", time.Millisecond, &ev.SendTimeout)
+	env.int("SSE_FANOUT_WORKERS", &ev.Workers)
+
+	env.string("QUESTION_CACHE", &cfg.QuestionCache.Backend)
+	env.duration("QUESTION_CACHE_TTL", time.Second, &cfg.QuestionCache.TTL)
+
+	env.duration("LOCK_TTL", time.Second, &cfg.Locks.TTL)
+	env.duration("LOCK_CLEANUP_INTERVAL", time.Second, &cfg.Locks.CleanupInterval)
+
+	env.int("QUOTA_LIMIT", &cfg.Quota.Limit)
+	env.duration("QUOTA_SLOT_HOURS", time.Hour, &cfg.Quota.Slot)
+	env.duration("QUOTA_RESET_INTERVAL", time.Second, &cfg.Quota.ResetInterval)
+
+	rl := &cfg.RateLimits
+	env.float("RATE_LIMIT", &rl.Global)
+	env.float("RATE_LIMIT_STRICT", &rl.Strict.Rate)
+	env.int("RATE_LIMIT_STRICT_BURST", &rl.Strict.Burst)
+	env.float("RATE_LIMIT_MODERATE", &rl.Moderate.Rate)
+	env.int("RATE_LIMIT_MODERATE_BURST", &rl.Moderate.Burst)
+
+	env.time("HUNT_START", &cfg.Hunt.Start)
+	env.time("HUNT_END", &cfg.Hunt.End)
+	env.duration("HUNT_TEAM_MINUTES", time.Minute, &cfg.Hunt.TeamDuration)
+
+	up := &cfg.Uploads
+	env.int("UPLOAD_MAX_IMAGE_MB", &up.MaxImageMB)
+	env.int("UPLOAD_MAX_AUDIO_MB", &up.MaxAudioMB)
+	env.int("UPLOAD_MAX_VIDEO_MB", &up.MaxVideoMB)
+	env.int("UPLOAD_MAX_FILE_MB", &up.MaxFileMB)
+	env.string("CLAMAV_ADDR", &up.ClamAVAddr)
+	env.string("ICAP_URL", &up.ICAPURL)
+
+	wp := &cfg.WebPush
+	env.string("VAPID_PUBLIC_KEY", &wp.PublicKey)
+	env.string("VAPID_PRIVATE_KEY", &wp.PrivateKey)
+	env.string("VAPID_SUBJECT", &wp.Subject)
+	env.duration("VAPID_TTL", time.Second, &wp.TTL)
+
+	ps := &cfg.PublicStats
+	env.string("PUBLIC_STATS", &ps.Sections)
+	env.duration("PUBLIC_STATS_TTL", time.Second, &ps.TTL)
+	env.float("PUBLIC_STATS_RATE", &ps.Rate)
+
+	m := &cfg.Mail
+	env.string("SMTP_HOST", &m.Host)
+	env.int("SMTP_PORT", &m.Port)
+	env.string("SMTP_USERNAME", &m.Username)
+	env.string("SMTP_PASSWORD", &m.Password)
+	env.string("SMTP_FROM", &m.From)
+	env.string("SMTP_TLS", &m.TLS)
+	env.string("MAIL_BASE_URL", &m.BaseURL)
+	env.duration("HUNT_REMINDER_MINUTES", time.Minute, &m.ReminderBefore)
+
+	sl := &cfg.Slack
+	env.string("SLACK_WEBHOOK_URL", &sl.WebhookURL)
+	env.string("SLACK_BOT_TOKEN", &sl.BotToken)
+	env.string("SLACK_CHANNEL", &sl.Channel)
+	env.string("SLACK_ALERTS", &sl.Alerts)
+
+	tg := &cfg.Telegram
+	env.string("TELEGRAM_BOT_TOKEN", &tg.BotToken)
+	env.string("TELEGRAM_API_URL", &tg.APIURL)
+	if v := os.Getenv("TELEGRAM_ANSWERS"); v != "" {
+		tg.Answers = v == "true"
+	}
+
+	sms := &cfg.SMS
+	env.string("SMS_PROVIDER", &sms.Provider)
+	env.string("TWILIO_ACCOUNT_SID", &sms.AccountSID)
+	env.string("TWILIO_AUTH_TOKEN", &sms.AuthToken)
+	env.string("SMS_FROM", &sms.From)
+	env.string("SMS_WEBHOOK_URL", &sms.WebhookURL)
+	env.string("SMS_WEBHOOK_TOKEN", &sms.WebhookToken)
+	env.duration("SMS_FINAL_WARNING_MINUTES", time.Minute, &sms.FinalWarning)
+
+	env.string("DEFAULT_LOCALE", &cfg.I18n.DefaultLocale)
+	env.string("LOCALES_DIR", &cfg.I18n.Dir)
+
+	return env.err
+}
+
+// envReader copies set environment variables into settings, keeping the
+// first malformed value it meets as its error
+type envReader struct {
+	err error
+}
+
+func (r *envReader) lookup(name string) (string, bool) {
+	v := strings.TrimSpace(os.Getenv(name))
+	return v, v != ""
+}
+
+func (r *envReader) invalid(name, value string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("invalid %s: %q", name, value)
+	}
+}
+
+func (r *envReader) string(name string, dst *string) {
+	if v, ok := r.lookup(name); ok {
+		*dst = v
+	}
+}
+
+func (r *envReader) int(name string, dst *int) {
+	if v, ok := r.lookup(name); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			r.invalid(name, v)
+			return
+		}
+		*dst = n
+	}
+}
+
+func (r *envReader) float(name string, dst *float64) {
+	if v, ok := r.lookup(name); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			r.invalid(name, v)
+			return
+		}
+		*dst = f
+	}
+}
+
+// duration reads a whole number of units
+func (r *envReader) duration(name string, unit time.Duration, dst *time.Duration) {
+	if v, ok := r.lookup(name); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			r.invalid(name, v)
+			return
+		}
+		*dst = time.Duration(n) * unit
+	}
+}
+
+// time reads an RFC 3339 timestamp such as 2025-03-01T18:00:00+05:30
+func (r *envReader) time(name string, dst *time.Time) {
+	if v, ok := r.lookup(name); ok {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			r.invalid(name, v)
+			return
+		}
+		*dst = t
+	}
+}
+
+func (r *envReader) zeroMeansOff(name string, dst *int) {
+	if v, _ := r.lookup(name); v == "0" {
+		*dst = -1
+	}
+}
+
+func (r *envReader) zeroDurationMeansOff(name string, dst *time.Duration) {
+	if v, _ := r.lookup(name); v == "0" {
+		*dst = -1
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import "testing"
+
+func TestLoadRequiresInstanceIDWithRedis(t *testing.T) {
+	cases := []struct {
+		name       string
+		broker     string
+		instanceID string
+		wantErr    bool
+	}{
+		{"redis picked by address", "", "", true},
+		{"redis chosen", "redis", "", true},
+		{"redis with instance id", "", "holmes-1", false},
+		{"standalone", "none", "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("REDIS_ADDR", "localhost:6379")
+			t.Setenv("MESSAGE_BROKER", tc.broker)
+			t.Setenv("INSTANCE_ID", tc.instanceID)
+
+			_, err := Load("")
+			if tc.wantErr && err == nil {
+				t.Fatal("Load succeeded without an instance ID")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+		})
+	}
+}
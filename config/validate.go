@@ -0,0 +1,177 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MinSecretLength is the shortest SECRET accepted outside DEV; 32
+// characters is what `openssl rand -hex 16` prints
+const MinSecretLength = 32
+
+// insecureSecrets are placeholder secrets from docs and examples, which
+// anyone could use to forge a session cookie
+var insecureSecrets = map[string]bool{
+	"secret":          true,
+	"your-secret-key": true,
+	"changeme":        true,
+	"change-me":       true,
+	"holmes":          true,
+	"password":        true,
+}
+
+// Problems lists what is wrong with the settings, described by the
+// environment variable that sets each one
+type Problems []string
+
+func (p Problems) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(p, "\n  - ")
+}
+
+// add records a problem
+func (p *Problems) add(format string, args ...interface{}) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+// err returns the problems as an error, or nil when there are none
+func (p Problems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+// IsDev reports whether the server runs in development mode
+func (cfg Config) IsDev() bool {
+	return cfg.Environment == "DEV"
+}
+
+// ValidateDatabase checks the settings every command needs
+func (cfg Config) ValidateDatabase() error {
+	var p Problems
+	cfg.checkDatabase(&p)
+	return p.err()
+}
+
+// Validate checks the settings the server needs before it starts, so a
+// missing or unsafe one stops it with a clear message instead of showing
+// up later as odd behaviour
+func (cfg Config) Validate() error {
+	var p Problems
+	cfg.checkDatabase(&p)
+
+	switch secret := cfg.Secret; {
+	case secret == "":
+		p.add("SECRET is not set; sessions would be signed with an empty key")
+	case cfg.IsDev():
+		// Any secret will do on a developer's machine
+	case insecureSecrets[strings.ToLower(secret)]:
+		p.add("SECRET is a placeholder value; generate one with `openssl rand -hex 32`")
+	case len(secret) < MinSecretLength:
+		p.add("SECRET is %d characters, it must be at least %d outside DEV; generate one with `openssl rand -hex 32`", len(secret), MinSecretLength)
+	}
+
+	if cfg.AdminPassword == "" {
+		p.add("ADMIN_PASS is not set; the admin panel can't be signed in to without one")
+	}
+
+	if port, err := strconv.Atoi(cfg.Server.Port); err != nil || port < 1 || port > 65535 {
+		p.add("PORT %q is not a port number", cfg.Server.Port)
+	}
+
+	rl := cfg.RateLimits
+	if rl.Global <= 0 {
+		p.add("RATE_LIMIT must be above zero")
+	}
+	if rl.Strict.Rate <= 0 || rl.Strict.Burst <= 0 {
+		p.add("RATE_LIMIT_STRICT and RATE_LIMIT_STRICT_BURST must be above zero")
+	}
+	if rl.Moderate.Rate <= 0 || rl.Moderate.Burst <= 0 {
+		p.add("RATE_LIMIT_MODERATE and RATE_LIMIT_MODERATE_BURST must be above zero")
+	}
+
+	if h := cfg.Hunt; !h.Start.IsZero() && !h.End.IsZero() && !h.End.After(h.Start) {
+		p.add("HUNT_END must be after HUNT_START")
+	}
+	if cfg.Hunt.TeamDuration < 0 {
+		p.add("HUNT_TEAM_MINUTES can't be negative")
+	}
+
+	if m := cfg.Mail; m.Host != "" {
+		if _, err := mail.ParseAddress(m.From); err != nil {
+			p.add("SMTP_FROM %q is not an email address; emails need a sender", m.From)
+		}
+		switch m.TLS {
+		case "", "starttls", "tls", "none":
+		default:
+			p.add("SMTP_TLS %q must be starttls, tls or none", m.TLS)
+		}
+		if m.Port < 0 || m.Port > 65535 {
+			p.add("SMTP_PORT %d is not a port number", m.Port)
+		}
+		if u, err := url.Parse(m.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.add("MAIL_BASE_URL %q must be the site's http(s) URL, for links in emails", m.BaseURL)
+		}
+	}
+
+	if sl := cfg.Slack; sl.WebhookURL != "" || sl.BotToken != "" {
+		if sl.WebhookURL != "" && sl.BotToken != "" {
+			p.add("set SLACK_WEBHOOK_URL or SLACK_BOT_TOKEN, not both")
+		}
+		if u, err := url.Parse(sl.WebhookURL); sl.WebhookURL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			p.add("SLACK_WEBHOOK_URL %q must be an http(s) URL", sl.WebhookURL)
+		}
+		if sl.BotToken != "" && sl.Channel == "" {
+			p.add("SLACK_CHANNEL is required with SLACK_BOT_TOKEN")
+		}
+		for _, a := range strings.Split(sl.Alerts, ",") {
+			switch strings.TrimSpace(a) {
+			case "", "all", "suspicious", "health", "clarifications", "lockouts":
+			default:
+				p.add("SLACK_ALERTS has unknown alert type %q; use suspicious, health, clarifications, lockouts or all", a)
+			}
+		}
+	}
+
+	if u, err := url.Parse(cfg.Telegram.APIURL); cfg.Telegram.APIURL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		p.add("TELEGRAM_API_URL %q must be an http(s) URL", cfg.Telegram.APIURL)
+	}
+
+	switch sms := cfg.SMS; sms.Provider {
+	case "":
+	case "twilio":
+		if sms.AccountSID == "" || sms.AuthToken == "" {
+			p.add("TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are required with SMS_PROVIDER=twilio")
+		}
+		if sms.From == "" {
+			p.add("SMS_FROM is required with SMS_PROVIDER=twilio; a number or a messaging service SID")
+		}
+	case "webhook":
+		if u, err := url.Parse(sms.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.add("SMS_WEBHOOK_URL %q must be an http(s) URL with SMS_PROVIDER=webhook", sms.WebhookURL)
+		}
+	default:
+		p.add("SMS_PROVIDER %q must be twilio or webhook", sms.Provider)
+	}
+	if cfg.SMS.FinalWarning < 0 {
+		p.add("SMS_FINAL_WARNING_MINUTES can't be negative")
+	}
+	if dir := cfg.I18n.Dir; dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			p.add("LOCALES_DIR %q is not a directory", dir)
+		}
+	}
+
+	return p.err()
+}
+
+// checkDatabase requires somewhere to keep the data
+func (cfg Config) checkDatabase(p *Problems) {
+	if cfg.Database.URL == "" && cfg.Database.Name == "" {
+		p.add("neither DATABASE_URL nor DB_NAME is set; SQLite would use a temporary database that is lost on exit")
+	}
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SnapshotExtension is the file extension of snapshots of the configured
+// database: a SQLite file, or a pg_dump archive for PostgreSQL
+func SnapshotExtension() string {
+	if currentDialect().postgres {
+		return ".dump"
+	}
+	return ".db"
+}
+
+// Snapshot writes a consistent copy of the live database to path, which
+// must not exist yet. SQLite is copied with VACUUM INTO, so the server
+// keeps running; PostgreSQL is dumped with pg_dump, which must be on PATH
+func Snapshot(ctx context.Context, DB *sql.DB, path string) error {
+	if currentDialect().postgres {
+		out, err := exec.CommandContext(ctx, "pg_dump", "--format=custom", "--no-owner",
+			"--file", path, "--dbname", settings.URL).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("pg_dump failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	if _, err := DB.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("failed to snapshot SQLite database: %s", err)
+	}
+	return nil
+}
+
+// Restore replaces the database with the snapshot at path. Stop the
+// server first: SQLite is restored by swapping the file underneath it,
+// and PostgreSQL tables are dropped and recreated by pg_restore. A SQLite
+// database being replaced is kept next to it with a .pre-restore suffix
+func Restore(ctx context.Context, dbName, path string) error {
+	if currentDialect().postgres {
+		out, err := exec.CommandContext(ctx, "pg_restore", "--clean", "--if-exists", "--no-owner",
+			"--single-transaction", "--dbname", settings.URL, path).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("pg_restore failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	if err := checkSQLiteSnapshot(ctx, path); err != nil {
+		return err
+	}
+
+	file := sqliteFile(dbName)
+	if file == "" {
+		return fmt.Errorf("DB_NAME is not set")
+	}
+
+	// Copy next to the database first so the swap is a rename
+	tmp := file + ".restoring"
+	if err := copyFile(path, tmp); err != nil {
+		return fmt.Errorf("failed to copy snapshot: %s", err)
+	}
+	if _, err := os.Stat(file); err == nil {
+		if err := os.Rename(file, file+".pre-restore"); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to keep current database: %s", err)
+		}
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("failed to replace database: %s", err)
+	}
+
+	// The old write-ahead log belongs to the replaced file and must not
+	// be replayed into the restored one
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(file + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %s", file+suffix, err)
+		}
+	}
+	return nil
+}
+
+// checkSQLiteSnapshot refuses files that aren't intact SQLite databases
+// before they replace the live one
+func checkSQLiteSnapshot(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, `PRAGMA quick_check`).Scan(&result); err != nil {
+		return fmt.Errorf("%s is not a SQLite database: %s", path, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%s is damaged: %s", path, result)
+	}
+	return nil
+}
+
+// sqliteFile is the path of the database file named by DB_NAME, which may
+// be a file: URI with connection parameters
+func sqliteFile(dbName string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(dbName, "file:"), "?")
+	return name
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
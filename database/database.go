@@ -1,10 +1,10 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
 	"strings"
 	"time"
 
@@ -29,33 +29,166 @@ type DBStats struct {
 	MaxLifetimeClosed  int64
 }
 
+// Config holds the database settings. PostgreSQL is used when URL is
+// set, SQLite otherwise; zero values take the defaults below
+type Config struct {
+	URL               string
+	QueryTimeout      time.Duration
+	SQLiteBusyTimeout time.Duration // negative to fail at once on a locked database
+	Pool              PoolConfig
+}
+
+// settings is what Configure installed
+var settings Config
+
+// Configure sets up the package before the first connection is opened
+func Configure(cfg Config) {
+	settings = cfg
+	QueryTimeout = DefaultQueryTimeout
+	if cfg.QueryTimeout > 0 {
+		QueryTimeout = cfg.QueryTimeout
+	}
+}
+
+// DefaultQueryTimeout bounds the database work of one service call
+const DefaultQueryTimeout = 10 * time.Second
+
+// QueryTimeout is the timeout applied by WithQueryTimeout
+var QueryTimeout = DefaultQueryTimeout
+
+// WithQueryTimeout derives the context a service call runs its queries
+// under: cancelled with the request that made the call, or after
+// QueryTimeout, whichever comes first
+func WithQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, QueryTimeout)
+}
+
+// SQLite connection defaults
+const (
+	DefaultSQLiteBusyTimeout  = 5 * time.Second
+	DefaultSQLiteMaxOpenConns = 1
+)
+
+// PoolConfig sizes the connection pool. In DefaultPoolConfig a zero
+// lifetime or idle time keeps connections for as long as the pool does;
+// in Config zero fields take the driver's default and negative ones turn
+// the setting off
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// DefaultPoolConfig returns the pool defaults for a driver. SQLite allows
+// one writer at a time, so more connections only queue up behind its file
+// lock; by default everything shares one connection that is never
+// recycled. PostgreSQL gets a pool small enough that a few instances stay
+// under the server's default of 100 connections
+func DefaultPoolConfig(postgres bool) PoolConfig {
+	if !postgres {
+		return PoolConfig{
+			MaxOpenConns: DefaultSQLiteMaxOpenConns,
+			MaxIdleConns: DefaultSQLiteMaxOpenConns,
+		}
+	}
+	return PoolConfig{
+		MaxOpenConns:    25,
+		MaxIdleConns:    10,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+	}
+}
+
+// withDefaults fills the fields of a configured pool that were left zero
+// from the driver's defaults
+func (cfg PoolConfig) withDefaults(postgres bool) PoolConfig {
+	def := DefaultPoolConfig(postgres)
+
+	if cfg.MaxOpenConns <= 0 {
+		cfg.MaxOpenConns = def.MaxOpenConns
+	}
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = def.MaxIdleConns
+		if !postgres {
+			// Idle SQLite connections cost nothing but their page cache
+			cfg.MaxIdleConns = cfg.MaxOpenConns
+		}
+	}
+	if cfg.MaxIdleConns < 0 {
+		cfg.MaxIdleConns = 0
+	}
+	if cfg.ConnMaxLifetime == 0 {
+		cfg.ConnMaxLifetime = def.ConnMaxLifetime
+	}
+	if cfg.ConnMaxLifetime < 0 {
+		cfg.ConnMaxLifetime = 0
+	}
+	if cfg.ConnMaxIdleTime == 0 {
+		cfg.ConnMaxIdleTime = def.ConnMaxIdleTime
+	}
+	if cfg.ConnMaxIdleTime < 0 {
+		cfg.ConnMaxIdleTime = 0
+	}
+
+	if cfg.MaxIdleConns > cfg.MaxOpenConns {
+		cfg.MaxIdleConns = cfg.MaxOpenConns
+	}
+	return cfg
+}
+
+// apply configures db's pool
+func (cfg PoolConfig) apply(db *sql.DB) {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// sqliteDSN adds the connection settings every SQLite connection needs:
+// WAL so reads don't block the writer, a busy timeout so a locked
+// database is waited on rather than reported, enforced foreign keys, and
+// transactions that take the write lock up front so two of them can't
+// deadlock upgrading from a read lock
+func sqliteDSN(dbName string) string {
+	busyTimeout := DefaultSQLiteBusyTimeout
+	if settings.SQLiteBusyTimeout > 0 {
+		busyTimeout = settings.SQLiteBusyTimeout
+	} else if settings.SQLiteBusyTimeout < 0 {
+		busyTimeout = 0
+	}
+
+	params := fmt.Sprintf("_journal_mode=WAL&_busy_timeout=%d&_foreign_keys=on&_synchronous=NORMAL&_txlock=immediate", busyTimeout.Milliseconds())
+	if strings.Contains(dbName, "?") {
+		return dbName + "&" + params
+	}
+	return dbName + "?" + params
+}
+
 func GetConnection(dbName string) (*sql.DB, error) {
 	var db *sql.DB
 	var err error
-	
-	// Check if DATABASE_URL is set (PostgreSQL)
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL != "" {
-		// Use PostgreSQL
-		db, err = sql.Open("postgres", databaseURL)
+
+	// Use PostgreSQL when a connection string is configured
+	if IsPostgres() {
+		db, err = sql.Open("postgres", settings.URL)
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to PostgreSQL: %s", err)
 		}
 		log.Println("Using PostgreSQL database")
 	} else {
 		// Use SQLite for local development
-		db, err = sql.Open("sqlite3", dbName)
+		db, err = sql.Open("sqlite3", sqliteDSN(dbName))
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to SQLite: %s", err)
 		}
 		log.Println("Using SQLite database")
 	}
 
-	// Configure connection pool for optimal performance
-	db.SetMaxOpenConns(50)           // Maximum number of open connections
-	db.SetMaxIdleConns(25)            // Maximum number of idle connections
-	db.SetConnMaxLifetime(5 * time.Minute) // Maximum lifetime of a connection
-	db.SetConnMaxIdleTime(2 * time.Minute) // Maximum idle time
+	pool := settings.Pool.withDefaults(IsPostgres())
+	pool.apply(db)
+	log.Printf("Connection pool: %d open, %d idle, lifetime %v, idle time %v",
+		pool.MaxOpenConns, pool.MaxIdleConns, pool.ConnMaxLifetime, pool.ConnMaxIdleTime)
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
@@ -67,20 +200,17 @@ func GetConnection(dbName string) (*sql.DB, error) {
 	return db, nil
 }
 
+// CreateMigrations brings the schema up to date; see migrate.go
 func CreateMigrations(DBName string, DB *sql.DB) error {
-	// Detect if using PostgreSQL or SQLite
-	isPostgres := os.Getenv("DATABASE_URL") != ""
-	
-	// Helper function to convert SQL syntax
-	autoIncrement := "INTEGER PRIMARY KEY AUTOINCREMENT"
-	if isPostgres {
-		autoIncrement = "SERIAL PRIMARY KEY"
-	}
-	
-	currentTimestamp := "CURRENT_TIMESTAMP"
-	if isPostgres {
-		currentTimestamp = "NOW()"
-	}
+	return Migrate(DB)
+}
+
+// baselineSchema is migration 1: the schema from before versioned
+// migrations. Its statements are idempotent so existing databases adopt
+// it without changes
+func baselineSchema(tx *sql.Tx, d dialect) error {
+	autoIncrement := d.autoIncrement
+	currentTimestamp := d.currentTimestamp
 
 	stmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS teams (
 		id %s,
@@ -93,7 +223,7 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
 		);
 	`, autoIncrement, currentTimestamp, currentTimestamp)
 
-	_, err := DB.Exec(stmt)
+	_, err := tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create teams table: %s", err)
 	}
@@ -106,7 +236,7 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
        	points INT
 	);`, autoIncrement)
 
-	_, err = DB.Exec(stmt)
+	_, err = tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create questions table: %s", err)
 	}
@@ -119,7 +249,7 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
        	FOREIGN KEY (parent_question_id) REFERENCES questions(id)
 	);`, autoIncrement)
 
-	_, err = DB.Exec(stmt)
+	_, err = tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create hints table: %s", err)
 	}
@@ -131,7 +261,7 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
      	FOREIGN KEY (parent_question_id) REFERENCES questions(id)
 	);`, autoIncrement)
 
-	_, err = DB.Exec(stmt)
+	_, err = tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create images table: %s", err)
 	}
@@ -143,7 +273,7 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
      	FOREIGN KEY(parent_question_id) REFERENCES questions(id)
 	);`, autoIncrement)
 
-	_, err = DB.Exec(stmt)
+	_, err = tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create audios table: %s", err)
 	}
@@ -155,7 +285,7 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
      	FOREIGN KEY(parent_question_id) REFERENCES questions(id)
 	);`, autoIncrement)
 
-	_, err = DB.Exec(stmt)
+	_, err = tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create videos table: %s", err)
 	}
@@ -169,7 +299,7 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
     FOREIGN KEY (question_id) REFERENCES questions(id)
     );`, currentTimestamp)
 
-	_, err = DB.Exec(stmt)
+	_, err = tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create team_completed_questions table: %s", err)
 	}
@@ -183,7 +313,7 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
     FOREIGN KEY (hint_id) REFERENCES hints(id)
     );`, currentTimestamp)
 
-	_, err = DB.Exec(stmt)
+	_, err = tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create team_hint_unlocked table: %s", err)
 	}
@@ -197,7 +327,7 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
     FOREIGN KEY (locked_by_team_id) REFERENCES teams(id)
     );`, currentTimestamp)
 
-	_, err = DB.Exec(stmt)
+	_, err = tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create question_locks table: %s", err)
 	}
@@ -214,7 +344,7 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
     FOREIGN KEY (question_id) REFERENCES questions(id)
     );`
 
-	_, err = DB.Exec(stmt)
+	_, err = tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create question_timers table: %s", err)
 	}
@@ -231,7 +361,7 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
     FOREIGN KEY (question_id) REFERENCES questions(id)
     );`, currentTimestamp)
 
-	_, err = DB.Exec(stmt)
+	_, err = tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create question_attempts table: %s", err)
 	}
@@ -244,11 +374,169 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
     FOREIGN KEY (team_id) REFERENCES teams(id)
     );`, currentTimestamp)
 
-	_, err = DB.Exec(stmt)
+	_, err = tx.Exec(stmt)
 	if err != nil {
 		return fmt.Errorf("Failed to create team_quota_slots table: %s", err)
 	}
 
+	// Table for the in-app notification center
+	// team_id 0 means the notification is for every team
+	stmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS notifications (
+    id %s,
+    team_id INTEGER NOT NULL DEFAULT 0,
+    type VARCHAR(50) NOT NULL,
+    title TEXT NOT NULL,
+    message TEXT,
+    link TEXT,
+    created_at TIMESTAMP DEFAULT %s
+    );`, autoIncrement, currentTimestamp)
+
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return fmt.Errorf("Failed to create notifications table: %s", err)
+	}
+
+	// Table to track which notifications a team has read
+	stmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS notification_reads (
+    team_id INTEGER,
+    notification_id INTEGER,
+    read_at TIMESTAMP DEFAULT %s,
+    PRIMARY KEY (team_id, notification_id),
+    FOREIGN KEY (team_id) REFERENCES teams(id),
+    FOREIGN KEY (notification_id) REFERENCES notifications(id)
+    );`, currentTimestamp)
+
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return fmt.Errorf("Failed to create notification_reads table: %s", err)
+	}
+
+	// Table for browser Web Push subscriptions, one row per device
+	stmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS push_subscriptions (
+    id %s,
+    team_id INTEGER NOT NULL,
+    endpoint TEXT NOT NULL UNIQUE,
+    p256dh TEXT NOT NULL,
+    auth TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT %s,
+    FOREIGN KEY (team_id) REFERENCES teams(id)
+    );`, autoIncrement, currentTimestamp)
+
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return fmt.Errorf("Failed to create push_subscriptions table: %s", err)
+	}
+
+	// Table for chat messages
+	// channel 0 is the global shoutbox, otherwise the team ID of a private team channel
+	stmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS chat_messages (
+    id %s,
+    team_id INTEGER NOT NULL,
+    channel INTEGER NOT NULL DEFAULT 0,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT %s,
+    FOREIGN KEY (team_id) REFERENCES teams(id)
+    );`, autoIncrement, currentTimestamp)
+
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return fmt.Errorf("Failed to create chat_messages table: %s", err)
+	}
+
+	// Table for teams muted in chat by an admin
+	stmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS chat_mutes (
+    team_id INTEGER PRIMARY KEY,
+    muted_at TIMESTAMP DEFAULT %s,
+    FOREIGN KEY (team_id) REFERENCES teams(id)
+    );`, currentTimestamp)
+
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return fmt.Errorf("Failed to create chat_mutes table: %s", err)
+	}
+
+	// Table for outgoing webhooks registered by admins
+	// events is a comma-separated list of event names, empty for all events
+	stmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS webhooks (
+    id %s,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT %s
+    );`, autoIncrement, currentTimestamp)
+
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return fmt.Errorf("Failed to create webhooks table: %s", err)
+	}
+
+	// Table for queued and attempted webhook deliveries
+	stmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id %s,
+    webhook_id INTEGER NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER DEFAULT 0,
+    status_code INTEGER DEFAULT 0,
+    last_error TEXT,
+    delivered INTEGER DEFAULT 0,
+    next_attempt_at TIMESTAMP DEFAULT %s,
+    created_at TIMESTAMP DEFAULT %s,
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id)
+    );`, autoIncrement, currentTimestamp, currentTimestamp)
+
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return fmt.Errorf("Failed to create webhook_deliveries table: %s", err)
+	}
+
+	// Table for bearer tokens used by the admin REST API
+	// Only a SHA-256 of each token is stored
+	stmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS admin_api_tokens (
+    id %s,
+    name TEXT NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT %s
+    );`, autoIncrement, currentTimestamp)
+
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return fmt.Errorf("Failed to create admin_api_tokens table: %s", err)
+	}
+
+	// Table for downloadable attachments (PDFs, archives, binaries); name is
+	// the original filename offered when downloading
+	stmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS files (
+    id %s,
+    path TEXT,
+    name TEXT NOT NULL,
+    parent_question_id INTEGER,
+    FOREIGN KEY(parent_question_id) REFERENCES questions(id)
+    );`, autoIncrement)
+
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return fmt.Errorf("Failed to create files table: %s", err)
+	}
+
+	// Table for resumable uploads in progress; chunks are appended to a
+	// partial file until received reaches size
+	stmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS chunked_uploads (
+    id VARCHAR(32) PRIMARY KEY,
+    question_id INTEGER NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    filename TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    received BIGINT DEFAULT 0,
+    created_at TIMESTAMP DEFAULT %s
+    );`, currentTimestamp)
+
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return fmt.Errorf("Failed to create chunked_uploads table: %s", err)
+	}
+
 	// Create indexes for performance optimization
 	indexes := []string{
 		`CREATE INDEX IF NOT EXISTS idx_question_locks_question_id ON question_locks(question_id);`,
@@ -256,20 +544,18 @@ func CreateMigrations(DBName string, DB *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_question_attempts_team_question ON question_attempts(team_id, question_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_team_completed_questions ON team_completed_questions(team_id, question_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_team_hint_unlocked ON team_hint_unlocked(team_id, hint_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_team ON notifications(team_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_push_subscriptions_team ON push_subscriptions(team_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_messages_channel ON chat_messages(channel, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(delivered, next_attempt_at);`,
 	}
 
 	for _, indexStmt := range indexes {
-		// For PostgreSQL, we need to handle existing indexes differently
-		if isPostgres {
-			indexStmt = strings.Replace(indexStmt, "CREATE INDEX IF NOT EXISTS", "CREATE INDEX IF NOT EXISTS", 1)
-		}
-		if _, err := DB.Exec(indexStmt); err != nil {
-			log.Printf("Warning: Failed to create index: %v", err)
+		if _, err := tx.Exec(indexStmt); err != nil {
+			return fmt.Errorf("Failed to create index: %s", err)
 		}
 	}
 
-	log.Println("Database indexes created successfully")
-
 	return nil
 }
 
@@ -1,17 +1,22 @@
 package database
 
 import (
-	"os"
 	"strconv"
 	"strings"
 )
 
+// IsPostgres reports whether the app runs on PostgreSQL (a database URL
+// is configured) rather than SQLite
+func IsPostgres() bool {
+	return settings.URL != ""
+}
+
 // ConvertPlaceholders converts ? placeholders to $1, $2, etc. for PostgreSQL
 // Also converts SQLite-specific syntax to PostgreSQL
 // Returns the original query for SQLite
 func ConvertPlaceholders(query string) string {
 	// If using SQLite (no DATABASE_URL), return as-is
-	if os.Getenv("DATABASE_URL") == "" {
+	if !IsPostgres() {
 		return query
 	}
 	
@@ -44,6 +49,24 @@ func ConvertPlaceholders(query string) string {
 			converted = strings.TrimSuffix(converted, ";")
 			converted += " ON CONFLICT (team_id, hint_id) DO NOTHING"
 		}
+	} else if strings.Contains(converted, "INSERT OR IGNORE INTO notification_reads") {
+		converted = strings.ReplaceAll(converted, "INSERT OR IGNORE INTO", "INSERT INTO")
+		if !strings.Contains(converted, "ON CONFLICT") {
+			converted = strings.TrimSuffix(converted, ";")
+			converted += " ON CONFLICT (team_id, notification_id) DO NOTHING"
+		}
+	} else if strings.Contains(converted, "INSERT OR IGNORE INTO chat_mutes") {
+		converted = strings.ReplaceAll(converted, "INSERT OR IGNORE INTO", "INSERT INTO")
+		if !strings.Contains(converted, "ON CONFLICT") {
+			converted = strings.TrimSuffix(converted, ";")
+			converted += " ON CONFLICT (team_id) DO NOTHING"
+		}
+	} else if strings.Contains(converted, "INSERT OR IGNORE INTO team_achievements") {
+		converted = strings.ReplaceAll(converted, "INSERT OR IGNORE INTO", "INSERT INTO")
+		if !strings.Contains(converted, "ON CONFLICT") {
+			converted = strings.TrimSuffix(converted, ";")
+			converted += " ON CONFLICT (team_id, achievement) DO NOTHING"
+		}
 	} else {
 		// General case: just replace INSERT OR IGNORE
 		converted = strings.ReplaceAll(converted, "INSERT OR IGNORE", "INSERT")
@@ -0,0 +1,1474 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// dialect holds the SQL that differs between SQLite and PostgreSQL
+type dialect struct {
+	postgres         bool
+	autoIncrement    string
+	currentTimestamp string
+}
+
+func currentDialect() dialect {
+	if IsPostgres() {
+		return dialect{postgres: true, autoIncrement: "SERIAL PRIMARY KEY", currentTimestamp: "NOW()"}
+	}
+	return dialect{autoIncrement: "INTEGER PRIMARY KEY AUTOINCREMENT", currentTimestamp: "CURRENT_TIMESTAMP"}
+}
+
+// Migration is one numbered schema change. Up and Down run in a
+// transaction, and Down must undo exactly what Up did
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx, d dialect) error
+	Down    func(tx *sql.Tx, d dialect) error
+}
+
+// migrations are applied in order; append new ones with the next version
+// and never edit one that has shipped
+var migrations = []Migration{
+	{1, "baseline schema", baselineSchema, dropBaselineSchema},
+	{2, "media position and caption", addMediaOrder, dropMediaOrder},
+	{3, "question status indexes", addStatusIndexes, dropStatusIndexes},
+	{4, "settings", createSettings, dropSettings},
+	{5, "hunt results", createHuntResults, dropHuntResults},
+	{6, "hunts", createHunts, dropHunts},
+	{7, "team start times", addTeamStart, dropTeamStart},
+	{8, "question solutions", addQuestionSolutions, dropQuestionSolutions},
+	{9, "writeups", createWriteups, dropWriteups},
+	{10, "dynamic flags", addDynamicFlags, dropDynamicFlags},
+	{11, "alerts", createAlerts, dropAlerts},
+	{12, "submissions", createSubmissions, dropSubmissions},
+	{13, "logins and alert subjects", createLogins, dropLogins},
+	{14, "answer cooldowns", addAnswerCooldowns, dropAnswerCooldowns},
+	{15, "team registrations", addTeamRegistrations, dropTeamRegistrations},
+	{16, "solve reviews", createSolveReviews, dropSolveReviews},
+	{17, "submission answers", addSubmissionAnswers, dropSubmissionAnswers},
+	{18, "team avatars", addTeamAvatars, dropTeamAvatars},
+	{19, "team achievements", createTeamAchievements, dropTeamAchievements},
+	{20, "streak bonuses", addStreakBonuses, dropStreakBonuses},
+	{21, "power-ups", createPowerUps, dropPowerUps},
+	{22, "question skips", createQuestionSkips, dropQuestionSkips},
+	{23, "spectators", createSpectators, dropSpectators},
+	{24, "question feedback", createQuestionFeedback, dropQuestionFeedback},
+	{25, "clarifications", createClarifications, dropClarifications},
+	{26, "emails", createEmails, dropEmails},
+	{27, "webhook formats", addWebhookFormat, dropWebhookFormat},
+	{28, "telegram chats", createTelegramChats, dropTelegramChats},
+	{29, "sms", createSMS, dropSMS},
+	{30, "email templates", createEmailTemplates, dropEmailTemplates},
+	{31, "announcements", createAnnouncements, dropAnnouncements},
+	{32, "pages", createPages, dropPages},
+	{33, "rules acceptances", createRulesAcceptances, dropRulesAcceptances},
+	{34, "checkpoints", createCheckpoints, dropCheckpoints},
+	{35, "geofences", createGeofences, dropGeofences},
+	{36, "photo submissions", createPhotoSubmissions, dropPhotoSubmissions},
+	{37, "solve points", addSolvePoints, dropSolvePoints},
+	{38, "question categories", addQuestionCategories, dropQuestionCategories},
+	{39, "team anonymization", addTeamAnonymizedAt, dropTeamAnonymizedAt},
+	{40, "hunt windows", addHuntWindows, dropHuntWindows},
+	{41, "hunt shoutboxes", addHuntShoutboxes, dropHuntShoutboxes},
+	{42, "pending solve reviews", holdPendingReviewPoints, payPendingReviewPoints},
+}
+
+// LatestSchemaVersion is the version a fully migrated database is at
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// ensureSchemaVersionTable creates the table recording applied migrations
+func ensureSchemaVersionTable(DB *sql.DB, d dialect) error {
+	stmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMP DEFAULT %s
+    );`, d.currentTimestamp)
+
+	if _, err := DB.Exec(stmt); err != nil {
+		return fmt.Errorf("Failed to create schema_version table: %s", err)
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest applied migration, 0 for an empty database
+func SchemaVersion(DB *sql.DB) (int, error) {
+	if err := ensureSchemaVersionTable(DB, currentDialect()); err != nil {
+		return 0, err
+	}
+	var version int
+	err := DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// Migrate applies every pending migration
+func Migrate(DB *sql.DB) error {
+	return MigrateTo(DB, LatestSchemaVersion())
+}
+
+// MigrateTo moves the schema up or down to target. Each migration commits
+// on its own, so a failure leaves the database at the last good version
+func MigrateTo(DB *sql.DB, target int) error {
+	if target < 0 || target > LatestSchemaVersion() {
+		return fmt.Errorf("unknown schema version %d, latest is %d", target, LatestSchemaVersion())
+	}
+
+	d := currentDialect()
+	current, err := SchemaVersion(DB)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+		log.Printf("Applying migration %d: %s", m.Version, m.Name)
+		if err := runMigration(DB, d, m.Up, ConvertPlaceholders(`INSERT INTO schema_version (version, name) VALUES (?, ?)`), m.Version, m.Name); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %s", m.Version, m.Name, err)
+		}
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version > current || m.Version <= target {
+			continue
+		}
+		log.Printf("Reverting migration %d: %s", m.Version, m.Name)
+		if err := runMigration(DB, d, m.Down, ConvertPlaceholders(`DELETE FROM schema_version WHERE version = ?`), m.Version); err != nil {
+			return fmt.Errorf("reverting migration %d (%s) failed: %s", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// runMigration runs one step and records it in schema_version atomically
+func runMigration(DB *sql.DB, d dialect, step func(*sql.Tx, dialect) error, record string, args ...interface{}) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := step(tx, d); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// columnExists reports whether table has column. It doesn't probe with a
+// failing query, as that would abort a PostgreSQL transaction
+func columnExists(tx *sql.Tx, d dialect, table, column string) (bool, error) {
+	query := `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+	if d.postgres {
+		query = `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2`
+	}
+	var n int
+	err := tx.QueryRow(query, table, column).Scan(&n)
+	return n > 0, err
+}
+
+// addColumnIfMissing adds a column to an existing table. SQLite has no
+// ADD COLUMN IF NOT EXISTS, so the column is looked up first
+func addColumnIfMissing(tx *sql.Tx, d dialect, table, column, definition string) error {
+	exists, err := columnExists(tx, d, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	stmt := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition)
+	if _, err := tx.Exec(stmt); err != nil {
+		return fmt.Errorf("Failed to add %s to %s table: %s", column, table, err)
+	}
+	return nil
+}
+
+// baselineTables lists the tables of migration 1, children before parents
+var baselineTables = []string{
+	"chunked_uploads", "files", "admin_api_tokens", "webhook_deliveries", "webhooks",
+	"chat_mutes", "chat_messages", "push_subscriptions", "notification_reads", "notifications",
+	"team_quota_slots", "question_attempts", "question_timers", "question_locks",
+	"team_hint_unlocked", "team_completed_questions", "videos", "audios", "images",
+	"hints", "questions", "teams",
+}
+
+func dropBaselineSchema(tx *sql.Tx, d dialect) error {
+	for _, table := range baselineTables {
+		if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, table)); err != nil {
+			return fmt.Errorf("Failed to drop %s table: %s", table, err)
+		}
+	}
+	return nil
+}
+
+// mediaTables are the tables holding a question's uploads
+var mediaTables = []string{"images", "videos", "audios", "files"}
+
+// addMediaOrder adds the sort order and caption of media rows
+func addMediaOrder(tx *sql.Tx, d dialect) error {
+	for _, table := range mediaTables {
+		if err := addColumnIfMissing(tx, d, table, "position", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(tx, d, table, "caption", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropMediaOrder(tx *sql.Tx, d dialect) error {
+	for _, table := range mediaTables {
+		for _, column := range []string{"position", "caption"} {
+			if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s DROP COLUMN %s`, table, column)); err != nil {
+				return fmt.Errorf("Failed to drop %s from %s table: %s", column, table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// statusIndexes serve the hunt page's question list: who solved each
+// question, and each question's media in display order
+var statusIndexes = []struct{ name, on string }{
+	{"idx_team_completed_questions_question", "team_completed_questions(question_id)"},
+	{"idx_images_question_position", "images(parent_question_id, position, id)"},
+	{"idx_videos_question_position", "videos(parent_question_id, position, id)"},
+	{"idx_audios_question_position", "audios(parent_question_id, position, id)"},
+	{"idx_files_question_position", "files(parent_question_id, position, id)"},
+}
+
+func addStatusIndexes(tx *sql.Tx, d dialect) error {
+	for _, idx := range statusIndexes {
+		if _, err := tx.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s`, idx.name, idx.on)); err != nil {
+			return fmt.Errorf("Failed to create index %s: %s", idx.name, err)
+		}
+	}
+	return nil
+}
+
+func dropStatusIndexes(tx *sql.Tx, d dialect) error {
+	for _, idx := range statusIndexes {
+		if _, err := tx.Exec(fmt.Sprintf(`DROP INDEX IF EXISTS %s`, idx.name)); err != nil {
+			return fmt.Errorf("Failed to drop index %s: %s", idx.name, err)
+		}
+	}
+	return nil
+}
+
+// createSettings adds the key/value table behind settings and feature
+// flags the admin panel can change while the hunt runs
+func createSettings(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS settings (
+		key VARCHAR(100) PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at TIMESTAMP DEFAULT %s
+	)`, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create settings table: %s", err)
+	}
+	return nil
+}
+
+func dropSettings(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS settings`); err != nil {
+		return fmt.Errorf("Failed to drop settings table: %s", err)
+	}
+	return nil
+}
+
+// createHuntResults adds the final standings saved when the hunt ends, one
+// set per end time
+func createHuntResults(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS hunt_results (
+		hunt_end TIMESTAMP NOT NULL,
+		place INTEGER NOT NULL,
+		team_name VARCHAR(255) NOT NULL,
+		points INTEGER NOT NULL,
+		questions_solved INTEGER NOT NULL,
+		total_time_seconds INTEGER NOT NULL,
+		total_penalty INTEGER NOT NULL,
+		net_score INTEGER NOT NULL,
+		created_at TIMESTAMP DEFAULT %s,
+		PRIMARY KEY (hunt_end, place)
+	)`, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create hunt_results table: %s", err)
+	}
+	return nil
+}
+
+func dropHuntResults(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS hunt_results`); err != nil {
+		return fmt.Errorf("Failed to drop hunt_results table: %s", err)
+	}
+	return nil
+}
+
+// DefaultHuntID is the hunt every team and question belonged to before
+// there could be several
+const DefaultHuntID = 1
+
+// huntIndexes serve the queries that list a hunt's teams and questions
+var huntIndexes = []struct{ name, on string }{
+	{"idx_teams_hunt", "teams(hunt_id)"},
+	{"idx_questions_hunt", "questions(hunt_id, points)"},
+}
+
+// huntResultsColumns are the columns of hunt_results besides hunt_id
+const huntResultsColumns = `hunt_end, place, team_name, points, questions_solved, total_time_seconds, total_penalty, net_score, created_at`
+
+// createHunts adds hunts, so several can run at once, and moves every team
+// and question into the first one. hunt_results is rebuilt to key its
+// standings by hunt
+func createHunts(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS hunts (
+		id %s,
+		slug VARCHAR(100) NOT NULL UNIQUE,
+		name VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT %s
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create hunts table: %s", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO hunts (id, slug, name) VALUES (1, 'main', 'Cryptic Hunt')`); err != nil {
+		return fmt.Errorf("Failed to create the first hunt: %s", err)
+	}
+	if d.postgres {
+		// The explicit ID doesn't move the sequence on
+		if _, err := tx.Exec(`SELECT setval(pg_get_serial_sequence('hunts', 'id'), 1)`); err != nil {
+			return fmt.Errorf("Failed to move hunts sequence: %s", err)
+		}
+	}
+
+	for _, table := range []string{"teams", "questions"} {
+		if err := addColumnIfMissing(tx, d, table, "hunt_id", fmt.Sprintf("INTEGER NOT NULL DEFAULT %d", DefaultHuntID)); err != nil {
+			return err
+		}
+	}
+	for _, idx := range huntIndexes {
+		if _, err := tx.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s`, idx.name, idx.on)); err != nil {
+			return fmt.Errorf("Failed to create index %s: %s", idx.name, err)
+		}
+	}
+
+	return rebuildHuntResults(tx, d, true)
+}
+
+func dropHunts(tx *sql.Tx, d dialect) error {
+	if err := rebuildHuntResults(tx, d, false); err != nil {
+		return err
+	}
+	for _, idx := range huntIndexes {
+		if _, err := tx.Exec(fmt.Sprintf(`DROP INDEX IF EXISTS %s`, idx.name)); err != nil {
+			return fmt.Errorf("Failed to drop index %s: %s", idx.name, err)
+		}
+	}
+	for _, table := range []string{"teams", "questions"} {
+		if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s DROP COLUMN hunt_id`, table)); err != nil {
+			return fmt.Errorf("Failed to drop hunt_id from %s table: %s", table, err)
+		}
+	}
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS hunts`); err != nil {
+		return fmt.Errorf("Failed to drop hunts table: %s", err)
+	}
+	return nil
+}
+
+// rebuildHuntResults recreates hunt_results with or without hunt_id in its
+// key, since neither database can change a primary key in place. Going
+// back keeps only the first hunt's standings
+func rebuildHuntResults(tx *sql.Tx, d dialect, withHunt bool) error {
+	huntColumn, key := "", "hunt_end, place"
+	copyRows := fmt.Sprintf(`INSERT INTO hunt_results_new (%[1]s) SELECT %[1]s FROM hunt_results WHERE hunt_id = %[2]d`,
+		huntResultsColumns, DefaultHuntID)
+	if withHunt {
+		huntColumn = fmt.Sprintf("hunt_id INTEGER NOT NULL DEFAULT %d,", DefaultHuntID)
+		key = "hunt_id, hunt_end, place"
+		copyRows = fmt.Sprintf(`INSERT INTO hunt_results_new (hunt_id, %[1]s) SELECT %[2]d, %[1]s FROM hunt_results`,
+			huntResultsColumns, DefaultHuntID)
+	}
+
+	steps := []struct{ what, stmt string }{
+		{"create new hunt_results table", fmt.Sprintf(`CREATE TABLE hunt_results_new (
+			%s
+			hunt_end TIMESTAMP NOT NULL,
+			place INTEGER NOT NULL,
+			team_name VARCHAR(255) NOT NULL,
+			points INTEGER NOT NULL,
+			questions_solved INTEGER NOT NULL,
+			total_time_seconds INTEGER NOT NULL,
+			total_penalty INTEGER NOT NULL,
+			net_score INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT %s,
+			PRIMARY KEY (%s)
+		)`, huntColumn, d.currentTimestamp, key)},
+		{"copy hunt results", copyRows},
+		{"drop old hunt_results table", `DROP TABLE hunt_results`},
+		{"rename hunt_results table", `ALTER TABLE hunt_results_new RENAME TO hunt_results`},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.stmt); err != nil {
+			return fmt.Errorf("Failed to %s: %s", step.what, err)
+		}
+	}
+	return nil
+}
+
+// addTeamStart records when each team's own clock started, for hunts where
+// teams play at different times
+func addTeamStart(tx *sql.Tx, d dialect) error {
+	return addColumnIfMissing(tx, d, "teams", "started_at", "TIMESTAMP")
+}
+
+func dropTeamStart(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`ALTER TABLE teams DROP COLUMN started_at`); err != nil {
+		return fmt.Errorf("Failed to drop started_at from teams table: %s", err)
+	}
+	return nil
+}
+
+// addQuestionSolutions adds the answer and write-up shown to teams once the
+// hunt is over, since the stored answer is only a hash
+func addQuestionSolutions(tx *sql.Tx, d dialect) error {
+	if err := addColumnIfMissing(tx, d, "questions", "solution", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(tx, d, "questions", "reveal_answer", "TEXT NOT NULL DEFAULT ''")
+}
+
+func dropQuestionSolutions(tx *sql.Tx, d dialect) error {
+	for _, column := range []string{"solution", "reveal_answer"} {
+		if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE questions DROP COLUMN %s`, column)); err != nil {
+			return fmt.Errorf("Failed to drop %s from questions table: %s", column, err)
+		}
+	}
+	return nil
+}
+
+// createWriteups adds the writeups teams submit after the hunt, one per
+// team and question, and their attachments
+func createWriteups(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS writeups (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		question_id INTEGER NOT NULL REFERENCES questions(id),
+		body TEXT NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		created_at TIMESTAMP DEFAULT %s,
+		updated_at TIMESTAMP DEFAULT %s,
+		UNIQUE (team_id, question_id)
+	)`, d.autoIncrement, d.currentTimestamp, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create writeups table: %s", err)
+	}
+	_, err = tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS writeup_files (
+		id %s,
+		writeup_id INTEGER NOT NULL REFERENCES writeups(id),
+		path VARCHAR(255) NOT NULL,
+		name VARCHAR(255) NOT NULL
+	)`, d.autoIncrement))
+	if err != nil {
+		return fmt.Errorf("Failed to create writeup_files table: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_writeups_question ON writeups(question_id, status)`); err != nil {
+		return fmt.Errorf("Failed to create index idx_writeups_question: %s", err)
+	}
+	return nil
+}
+
+func dropWriteups(tx *sql.Tx, d dialect) error {
+	for _, table := range []string{"writeup_files", "writeups"} {
+		if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, table)); err != nil {
+			return fmt.Errorf("Failed to drop %s table: %s", table, err)
+		}
+	}
+	return nil
+}
+
+// addDynamicFlags keeps the answer of questions whose flag differs per
+// team, and the token each team's flag is made from
+func addDynamicFlags(tx *sql.Tx, d dialect) error {
+	if err := addColumnIfMissing(tx, d, "questions", "flag_template", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS team_flags (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		question_id INTEGER NOT NULL REFERENCES questions(id),
+		token VARCHAR(64) NOT NULL,
+		created_at TIMESTAMP DEFAULT %s,
+		UNIQUE (team_id, question_id)
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create team_flags table: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_team_flags_token ON team_flags(question_id, token)`); err != nil {
+		return fmt.Errorf("Failed to create index idx_team_flags_token: %s", err)
+	}
+	return nil
+}
+
+func dropDynamicFlags(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS team_flags`); err != nil {
+		return fmt.Errorf("Failed to drop team_flags table: %s", err)
+	}
+	if _, err := tx.Exec(`ALTER TABLE questions DROP COLUMN flag_template`); err != nil {
+		return fmt.Errorf("Failed to drop flag_template from questions table: %s", err)
+	}
+	return nil
+}
+
+// createAlerts adds the alerts raised about teams that look to be
+// cheating, kept until an admin resolves them
+func createAlerts(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS alerts (
+		id %s,
+		hunt_id INTEGER NOT NULL,
+		kind VARCHAR(40) NOT NULL,
+		team_id INTEGER NOT NULL DEFAULT 0,
+		other_team_id INTEGER NOT NULL DEFAULT 0,
+		question_id INTEGER NOT NULL DEFAULT 0,
+		detail TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT %s,
+		resolved_at TIMESTAMP NULL
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create alerts table: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_alerts_hunt ON alerts(hunt_id, created_at)`); err != nil {
+		return fmt.Errorf("Failed to create index idx_alerts_hunt: %s", err)
+	}
+	return nil
+}
+
+func dropAlerts(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS alerts`); err != nil {
+		return fmt.Errorf("Failed to drop alerts table: %s", err)
+	}
+	return nil
+}
+
+// createSubmissions adds the log of every answer submitted, right or
+// wrong. Answers are kept as a hash of their normalized form
+func createSubmissions(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS submissions (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		question_id INTEGER NOT NULL REFERENCES questions(id),
+		answer_hash VARCHAR(64) NOT NULL,
+		correct BOOLEAN NOT NULL DEFAULT FALSE,
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT %s
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create submissions table: %s", err)
+	}
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_submissions_team ON submissions(team_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_submissions_answer ON submissions(question_id, answer_hash, created_at)`,
+	}
+	for _, stmt := range indexes {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("Failed to create submissions index: %s", err)
+		}
+	}
+	return nil
+}
+
+func dropSubmissions(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS submissions`); err != nil {
+		return fmt.Errorf("Failed to drop submissions table: %s", err)
+	}
+	return nil
+}
+
+// createLogins adds the log of team logins with the address each came
+// from, and the subject an alert is about when it is not a team or a
+// question, such as an IP shared by several teams
+func createLogins(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS logins (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT %s
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create logins table: %s", err)
+	}
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_logins_team ON logins(team_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_logins_ip ON logins(ip, created_at)`,
+	}
+	for _, stmt := range indexes {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("Failed to create logins index: %s", err)
+		}
+	}
+	return addColumnIfMissing(tx, d, "alerts", "subject", "VARCHAR(255) NOT NULL DEFAULT ''")
+}
+
+func dropLogins(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS logins`); err != nil {
+		return fmt.Errorf("Failed to drop logins table: %s", err)
+	}
+	if _, err := tx.Exec(`ALTER TABLE alerts DROP COLUMN subject`); err != nil {
+		return fmt.Errorf("Failed to drop subject from alerts table: %s", err)
+	}
+	return nil
+}
+
+// addAnswerCooldowns adds how long a team waits to answer a question
+// again after a wrong answer, 30 seconds for existing questions
+func addAnswerCooldowns(tx *sql.Tx, d dialect) error {
+	return addColumnIfMissing(tx, d, "questions", "cooldown_seconds", "INTEGER NOT NULL DEFAULT 30")
+}
+
+func dropAnswerCooldowns(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`ALTER TABLE questions DROP COLUMN cooldown_seconds`); err != nil {
+		return fmt.Errorf("Failed to drop cooldown_seconds from questions table: %s", err)
+	}
+	return nil
+}
+
+// addTeamRegistrations adds the address and browser fingerprint a team
+// registered from, which duplicate accounts are found by, and when an admin
+// suspended the team
+func addTeamRegistrations(tx *sql.Tx, d dialect) error {
+	columns := []struct{ name, definition string }{
+		{"registration_ip", "VARCHAR(64) NOT NULL DEFAULT ''"},
+		{"fingerprint", "VARCHAR(64) NOT NULL DEFAULT ''"},
+		{"suspended_at", "TIMESTAMP"},
+	}
+	for _, col := range columns {
+		if err := addColumnIfMissing(tx, d, "teams", col.name, col.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropTeamRegistrations(tx *sql.Tx, d dialect) error {
+	for _, col := range []string{"suspended_at", "fingerprint", "registration_ip"} {
+		if _, err := tx.Exec(`ALTER TABLE teams DROP COLUMN ` + col); err != nil {
+			return fmt.Errorf("Failed to drop %s from teams table: %s", col, err)
+		}
+	}
+	return nil
+}
+
+// createSolveReviews adds when an admin flagged a team for review, and the
+// queue of solves by flagged teams waiting for an admin
+func createSolveReviews(tx *sql.Tx, d dialect) error {
+	if err := addColumnIfMissing(tx, d, "teams", "flagged_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS solve_reviews (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		question_id INTEGER NOT NULL REFERENCES questions(id),
+		points INTEGER NOT NULL DEFAULT 0,
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		created_at TIMESTAMP DEFAULT %s,
+		reviewed_at TIMESTAMP
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create solve_reviews table: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_solve_reviews_status ON solve_reviews(status, created_at)`); err != nil {
+		return fmt.Errorf("Failed to create solve_reviews index: %s", err)
+	}
+	return nil
+}
+
+func dropSolveReviews(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS solve_reviews`); err != nil {
+		return fmt.Errorf("Failed to drop solve_reviews table: %s", err)
+	}
+	if _, err := tx.Exec(`ALTER TABLE teams DROP COLUMN flagged_at`); err != nil {
+		return fmt.Errorf("Failed to drop flagged_at from teams table: %s", err)
+	}
+	return nil
+}
+
+// addSubmissionAnswers keeps the text of wrong answers and the penalty each
+// cost, so a team can see what its members already tried
+func addSubmissionAnswers(tx *sql.Tx, d dialect) error {
+	columns := []struct{ name, definition string }{
+		{"answer", "TEXT NOT NULL DEFAULT ''"},
+		{"penalty", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, col := range columns {
+		if err := addColumnIfMissing(tx, d, "submissions", col.name, col.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropSubmissionAnswers(tx *sql.Tx, d dialect) error {
+	for _, col := range []string{"penalty", "answer"} {
+		if _, err := tx.Exec(`ALTER TABLE submissions DROP COLUMN ` + col); err != nil {
+			return fmt.Errorf("Failed to drop %s from submissions table: %s", col, err)
+		}
+	}
+	return nil
+}
+
+// addTeamAvatars records the storage key of each team's avatar, empty for
+// teams without one
+func addTeamAvatars(tx *sql.Tx, d dialect) error {
+	return addColumnIfMissing(tx, d, "teams", "avatar", "TEXT NOT NULL DEFAULT ''")
+}
+
+func dropTeamAvatars(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`ALTER TABLE teams DROP COLUMN avatar`); err != nil {
+		return fmt.Errorf("Failed to drop avatar from teams table: %s", err)
+	}
+	return nil
+}
+
+// createTeamAchievements records the badges teams earn while playing, each
+// at most once per team
+func createTeamAchievements(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS team_achievements (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		achievement VARCHAR(32) NOT NULL,
+		question_id INTEGER NOT NULL DEFAULT 0,
+		awarded_at TIMESTAMP DEFAULT %s,
+		UNIQUE(team_id, achievement)
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create team_achievements table: %s", err)
+	}
+	return nil
+}
+
+func dropTeamAchievements(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS team_achievements`); err != nil {
+		return fmt.Errorf("Failed to drop team_achievements table: %s", err)
+	}
+	return nil
+}
+
+// addStreakBonuses counts each team's correct answers in a row, and keeps
+// the bonus each solve earned for it
+func addStreakBonuses(tx *sql.Tx, d dialect) error {
+	if err := addColumnIfMissing(tx, d, "teams", "streak", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(tx, d, "team_completed_questions", "bonus", "INTEGER NOT NULL DEFAULT 0")
+}
+
+func dropStreakBonuses(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`ALTER TABLE team_completed_questions DROP COLUMN bonus`); err != nil {
+		return fmt.Errorf("Failed to drop bonus from team_completed_questions table: %s", err)
+	}
+	if _, err := tx.Exec(`ALTER TABLE teams DROP COLUMN streak`); err != nil {
+		return fmt.Errorf("Failed to drop streak from teams table: %s", err)
+	}
+	return nil
+}
+
+// createPowerUps adds the store's catalogue, the power-ups teams bought, and
+// the extra attempts and penalty shields they spent on questions
+func createPowerUps(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS powerups (
+		kind VARCHAR(32) PRIMARY KEY,
+		price INTEGER NOT NULL,
+		max_per_team INTEGER NOT NULL DEFAULT 0,
+		enabled BOOLEAN NOT NULL DEFAULT FALSE
+	)`)
+	if err != nil {
+		return fmt.Errorf("Failed to create powerups table: %s", err)
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS team_powerups (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		kind VARCHAR(32) NOT NULL,
+		price INTEGER NOT NULL DEFAULT 0,
+		bought_at TIMESTAMP DEFAULT %s,
+		used_at TIMESTAMP,
+		question_id INTEGER NOT NULL DEFAULT 0
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create team_powerups table: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_team_powerups_team ON team_powerups(team_id, kind)`); err != nil {
+		return fmt.Errorf("Failed to index team_powerups table: %s", err)
+	}
+
+	columns := []struct{ name, definition string }{
+		{"extra_attempts", "INTEGER NOT NULL DEFAULT 0"},
+		{"shields", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, col := range columns {
+		if err := addColumnIfMissing(tx, d, "question_attempts", col.name, col.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropPowerUps(tx *sql.Tx, d dialect) error {
+	for _, col := range []string{"shields", "extra_attempts"} {
+		if _, err := tx.Exec(`ALTER TABLE question_attempts DROP COLUMN ` + col); err != nil {
+			return fmt.Errorf("Failed to drop %s from question_attempts table: %s", col, err)
+		}
+	}
+	for _, table := range []string{"team_powerups", "powerups"} {
+		if _, err := tx.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+			return fmt.Errorf("Failed to drop %s table: %s", table, err)
+		}
+	}
+	return nil
+}
+
+// createQuestionSkips records the questions teams bypassed with a skip
+// token, each at most once per team
+func createQuestionSkips(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS team_skipped_questions (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		question_id INTEGER NOT NULL REFERENCES questions(id),
+		skipped_at TIMESTAMP DEFAULT %s,
+		UNIQUE(team_id, question_id)
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create team_skipped_questions table: %s", err)
+	}
+	return nil
+}
+
+func dropQuestionSkips(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS team_skipped_questions`); err != nil {
+		return fmt.Errorf("Failed to drop team_skipped_questions table: %s", err)
+	}
+	return nil
+}
+
+// createSpectators adds read-only accounts that watch a hunt without
+// playing it
+func createSpectators(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS spectators (
+		id %s,
+		name VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL UNIQUE,
+		password VARCHAR(255) NOT NULL,
+		hunt_id INTEGER NOT NULL DEFAULT %d,
+		created_at TIMESTAMP DEFAULT %s
+	)`, d.autoIncrement, DefaultHuntID, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create spectators table: %s", err)
+	}
+	return nil
+}
+
+func dropSpectators(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS spectators`); err != nil {
+		return fmt.Errorf("Failed to drop spectators table: %s", err)
+	}
+	return nil
+}
+
+// createQuestionFeedback stores how each team rated a question, once per
+// team and question; a team rating again replaces its rating
+func createQuestionFeedback(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS question_feedback (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		question_id INTEGER NOT NULL REFERENCES questions(id),
+		difficulty INTEGER NOT NULL,
+		fun INTEGER NOT NULL,
+		comment TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMP DEFAULT %s,
+		UNIQUE(team_id, question_id)
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create question_feedback table: %s", err)
+	}
+	return nil
+}
+
+func dropQuestionFeedback(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS question_feedback`); err != nil {
+		return fmt.Errorf("Failed to drop question_feedback table: %s", err)
+	}
+	return nil
+}
+
+// createClarifications stores the clarifications teams ask for on a
+// question and the admins' answers, shown to the asking team or to every
+// team once published
+func createClarifications(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS clarifications (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		question_id INTEGER NOT NULL REFERENCES questions(id),
+		body TEXT NOT NULL,
+		answer TEXT NOT NULL DEFAULT '',
+		public BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT %s,
+		answered_at TIMESTAMP NULL
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create clarifications table: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_clarifications_question ON clarifications(question_id)`); err != nil {
+		return fmt.Errorf("Failed to create index idx_clarifications_question: %s", err)
+	}
+	return nil
+}
+
+func dropClarifications(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS clarifications`); err != nil {
+		return fmt.Errorf("Failed to drop clarifications table: %s", err)
+	}
+	return nil
+}
+
+// createEmails adds the outbox the mailer sends from, the one-time tokens
+// emailed links carry, and when each team confirmed its address
+func createEmails(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS emails (
+		id %s,
+		recipient VARCHAR(255) NOT NULL,
+		template VARCHAR(50) NOT NULL,
+		subject TEXT NOT NULL,
+		body TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at TIMESTAMP DEFAULT %s,
+		sent_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT %s
+	)`, d.autoIncrement, d.currentTimestamp, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create emails table: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_emails_due ON emails(sent_at, next_attempt_at)`); err != nil {
+		return fmt.Errorf("Failed to create index idx_emails_due: %s", err)
+	}
+
+	// Only a SHA-256 of each token is stored, like admin API tokens
+	_, err = tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS email_tokens (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		purpose VARCHAR(20) NOT NULL,
+		token_hash VARCHAR(64) NOT NULL UNIQUE,
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT %s
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create email_tokens table: %s", err)
+	}
+
+	return addColumnIfMissing(tx, d, "teams", "email_verified_at", "TIMESTAMP NULL")
+}
+
+func dropEmails(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`ALTER TABLE teams DROP COLUMN email_verified_at`); err != nil {
+		return fmt.Errorf("Failed to drop email_verified_at from teams table: %s", err)
+	}
+	for _, table := range []string{"email_tokens", "emails"} {
+		if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, table)); err != nil {
+			return fmt.Errorf("Failed to drop %s table: %s", table, err)
+		}
+	}
+	return nil
+}
+
+// addWebhookFormat records how each webhook's payloads are rendered: the
+// signed JSON events, or chat messages for a Discord channel
+func addWebhookFormat(tx *sql.Tx, d dialect) error {
+	return addColumnIfMissing(tx, d, "webhooks", "format", "VARCHAR(20) NOT NULL DEFAULT 'json'")
+}
+
+func dropWebhookFormat(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`ALTER TABLE webhooks DROP COLUMN format`); err != nil {
+		return fmt.Errorf("Failed to drop format from webhooks table: %s", err)
+	}
+	return nil
+}
+
+// createTelegramChats adds the Telegram chats linked to each team, which
+// the bot notifies and takes answers from
+func createTelegramChats(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS telegram_chats (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		chat_id BIGINT NOT NULL UNIQUE,
+		username VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT %s
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create telegram_chats table: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_telegram_chats_team ON telegram_chats(team_id)`); err != nil {
+		return fmt.Errorf("Failed to create index idx_telegram_chats_team: %s", err)
+	}
+	return nil
+}
+
+func dropTelegramChats(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS telegram_chats`); err != nil {
+		return fmt.Errorf("Failed to drop telegram_chats table: %s", err)
+	}
+	return nil
+}
+
+// createSMS adds the phone numbers teams opted in to text messages with,
+// the code that confirms each, and the outbox messages are sent from
+func createSMS(tx *sql.Tx, d dialect) error {
+	// Only a SHA-256 of the confirmation code is stored
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS team_phones (
+		team_id INTEGER PRIMARY KEY REFERENCES teams(id),
+		phone VARCHAR(20) NOT NULL,
+		code_hash VARCHAR(64) NOT NULL DEFAULT '',
+		code_expires_at TIMESTAMP NULL,
+		code_attempts INTEGER NOT NULL DEFAULT 0,
+		verified_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT %s
+	)`, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create team_phones table: %s", err)
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS sms_messages (
+		id %s,
+		recipient VARCHAR(20) NOT NULL,
+		kind VARCHAR(50) NOT NULL,
+		body TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at TIMESTAMP DEFAULT %s,
+		sent_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT %s
+	)`, d.autoIncrement, d.currentTimestamp, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create sms_messages table: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_sms_messages_due ON sms_messages(sent_at, next_attempt_at)`); err != nil {
+		return fmt.Errorf("Failed to create index idx_sms_messages_due: %s", err)
+	}
+	return nil
+}
+
+func dropSMS(tx *sql.Tx, d dialect) error {
+	for _, table := range []string{"sms_messages", "team_phones"} {
+		if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, table)); err != nil {
+			return fmt.Errorf("Failed to drop %s table: %s", table, err)
+		}
+	}
+	return nil
+}
+
+// createEmailTemplates adds the email copy edited from the admin panel,
+// which replaces the built-in copy of the same template
+func createEmailTemplates(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS email_templates (
+		name VARCHAR(50) PRIMARY KEY,
+		subject TEXT NOT NULL,
+		body TEXT NOT NULL,
+		updated_at TIMESTAMP DEFAULT %s
+	)`, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create email_templates table: %s", err)
+	}
+	return nil
+}
+
+func dropEmailTemplates(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS email_templates`); err != nil {
+		return fmt.Errorf("Failed to drop email_templates table: %s", err)
+	}
+	return nil
+}
+
+// createAnnouncements adds the announcements listed on /announcements,
+// starting with the ones already sent to every team's inbox
+func createAnnouncements(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS announcements (
+		id %s,
+		title TEXT NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		link TEXT NOT NULL DEFAULT '',
+		pinned BOOLEAN NOT NULL DEFAULT FALSE,
+		public BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT %s
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create announcements table: %s", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO announcements (title, message, link, created_at)
+		SELECT title, COALESCE(message, ''), COALESCE(link, ''), created_at
+		FROM notifications
+		WHERE team_id = 0 AND type = 'announcement'
+		ORDER BY id`); err != nil {
+		return fmt.Errorf("Failed to copy announcements: %s", err)
+	}
+	return nil
+}
+
+func dropAnnouncements(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS announcements`); err != nil {
+		return fmt.Errorf("Failed to drop announcements table: %s", err)
+	}
+	return nil
+}
+
+// createPages adds the markdown pages admins write for the event, such as
+// its rules or FAQ, served at /p/<slug>
+func createPages(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS pages (
+		id %s,
+		slug VARCHAR(64) NOT NULL UNIQUE,
+		title VARCHAR(255) NOT NULL,
+		body TEXT NOT NULL DEFAULT '',
+		published BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT %s,
+		updated_at TIMESTAMP DEFAULT %s
+	)`, d.autoIncrement, d.currentTimestamp, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create pages table: %s", err)
+	}
+	return nil
+}
+
+func dropPages(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS pages`); err != nil {
+		return fmt.Errorf("Failed to drop pages table: %s", err)
+	}
+	return nil
+}
+
+// createRulesAcceptances records when each team accepted the rules, which
+// version of them and from where, for the organisers' records
+func createRulesAcceptances(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS rules_acceptances (
+		team_id INTEGER PRIMARY KEY REFERENCES teams(id),
+		rules_updated_at TIMESTAMP NOT NULL,
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		accepted_at TIMESTAMP DEFAULT %s
+	)`, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create rules_acceptances table: %s", err)
+	}
+	return nil
+}
+
+func dropRulesAcceptances(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS rules_acceptances`); err != nil {
+		return fmt.Errorf("Failed to drop rules_acceptances table: %s", err)
+	}
+	return nil
+}
+
+// createCheckpoints adds QR-code checkpoints: questions teams open or solve
+// by scanning a code at a physical location, signed with a secret of each
+// question's own, and the scans teams made
+func createCheckpoints(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS question_checkpoints (
+		question_id INTEGER PRIMARY KEY REFERENCES questions(id),
+		mode VARCHAR(16) NOT NULL,
+		per_team BOOLEAN NOT NULL DEFAULT FALSE,
+		secret VARCHAR(64) NOT NULL,
+		updated_at TIMESTAMP DEFAULT %s
+	)`, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create question_checkpoints table: %s", err)
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS checkpoint_scans (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		question_id INTEGER NOT NULL REFERENCES questions(id),
+		scanned_at TIMESTAMP DEFAULT %s,
+		UNIQUE(team_id, question_id)
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create checkpoint_scans table: %s", err)
+	}
+	return nil
+}
+
+func dropCheckpoints(tx *sql.Tx, d dialect) error {
+	for _, table := range []string{"checkpoint_scans", "question_checkpoints"} {
+		if _, err := tx.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+			return fmt.Errorf("Failed to drop %s table: %s", table, err)
+		}
+	}
+	return nil
+}
+
+// createGeofences adds the places teams must answer some questions from:
+// a point and a radius around it, with a secret signing the location
+// proofs teams get for being inside
+func createGeofences(tx *sql.Tx, d dialect) error {
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS question_geofences (
+		question_id INTEGER PRIMARY KEY REFERENCES questions(id),
+		latitude DOUBLE PRECISION NOT NULL,
+		longitude DOUBLE PRECISION NOT NULL,
+		radius_meters INTEGER NOT NULL,
+		secret VARCHAR(64) NOT NULL,
+		updated_at TIMESTAMP DEFAULT %s
+	)`, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create question_geofences table: %s", err)
+	}
+	return nil
+}
+
+func dropGeofences(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS question_geofences`); err != nil {
+		return fmt.Errorf("Failed to drop question_geofences table: %s", err)
+	}
+	return nil
+}
+
+// createPhotoSubmissions adds what a question is answered with, text for
+// existing questions, and the photos teams send for questions answered
+// with one, each waiting for an admin to grade it
+func createPhotoSubmissions(tx *sql.Tx, d dialect) error {
+	if err := addColumnIfMissing(tx, d, "questions", "answer_type", "VARCHAR(16) NOT NULL DEFAULT 'text'"); err != nil {
+		return err
+	}
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS photo_submissions (
+		id %s,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		question_id INTEGER NOT NULL REFERENCES questions(id),
+		path VARCHAR(255) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		points INTEGER NOT NULL DEFAULT 0,
+		note TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT %s,
+		reviewed_at TIMESTAMP
+	)`, d.autoIncrement, d.currentTimestamp))
+	if err != nil {
+		return fmt.Errorf("Failed to create photo_submissions table: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_photo_submissions_status ON photo_submissions(status, created_at)`); err != nil {
+		return fmt.Errorf("Failed to create index idx_photo_submissions_status: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_photo_submissions_team ON photo_submissions(team_id, question_id)`); err != nil {
+		return fmt.Errorf("Failed to create index idx_photo_submissions_team: %s", err)
+	}
+	return nil
+}
+
+func dropPhotoSubmissions(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS photo_submissions`); err != nil {
+		return fmt.Errorf("Failed to drop photo_submissions table: %s", err)
+	}
+	if _, err := tx.Exec(`ALTER TABLE questions DROP COLUMN answer_type`); err != nil {
+		return fmt.Errorf("Failed to drop answer_type from questions table: %s", err)
+	}
+	return nil
+}
+
+// addSolvePoints keeps the points each solve was worth to the team, which
+// partial credit can make less than the question's. Existing solves were
+// worth the whole question
+func addSolvePoints(tx *sql.Tx, d dialect) error {
+	if err := addColumnIfMissing(tx, d, "team_completed_questions", "points", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE team_completed_questions SET points = COALESCE((SELECT q.points FROM questions q WHERE q.id = team_completed_questions.question_id), 0)`); err != nil {
+		return fmt.Errorf("Failed to fill in points of team_completed_questions: %s", err)
+	}
+	return nil
+}
+
+func dropSolvePoints(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`ALTER TABLE team_completed_questions DROP COLUMN points`); err != nil {
+		return fmt.Errorf("Failed to drop points from team_completed_questions table: %s", err)
+	}
+	return nil
+}
+
+// addQuestionCategories files each question under a category, such as
+// crypto, whose weight multiplies its points. Existing questions have none
+func addQuestionCategories(tx *sql.Tx, d dialect) error {
+	return addColumnIfMissing(tx, d, "questions", "category", "VARCHAR(50) NOT NULL DEFAULT ''")
+}
+
+func dropQuestionCategories(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`ALTER TABLE questions DROP COLUMN category`); err != nil {
+		return fmt.Errorf("Failed to drop category from questions table: %s", err)
+	}
+	return nil
+}
+
+// addTeamAnonymizedAt records when the retention purge stripped a team of
+// what identifies its players
+func addTeamAnonymizedAt(tx *sql.Tx, d dialect) error {
+	return addColumnIfMissing(tx, d, "teams", "anonymized_at", "TIMESTAMP NULL")
+}
+
+func dropTeamAnonymizedAt(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`ALTER TABLE teams DROP COLUMN anonymized_at`); err != nil {
+		return fmt.Errorf("Failed to drop anonymized_at from teams table: %s", err)
+	}
+	return nil
+}
+
+// huntWindowColumns hold when each hunt runs, in place of the configured
+// window once window_set is on
+var huntWindowColumns = []struct{ name, definition string }{
+	{"window_set", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"starts_at", "TIMESTAMP NULL"},
+	{"ends_at", "TIMESTAMP NULL"},
+	{"team_duration_seconds", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// huntWindowSettings are the settings that held the one window every hunt
+// shared
+var huntWindowSettings = []string{"hunt_start", "hunt_end", "team_duration"}
+
+// addHuntWindows gives each hunt its own start, end and team clock. A
+// window set from the admin panel applied to every hunt, so each one keeps
+// a copy of it
+func addHuntWindows(tx *sql.Tx, d dialect) error {
+	for _, c := range huntWindowColumns {
+		if err := addColumnIfMissing(tx, d, "hunts", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
+	values := make(map[string]string)
+	for _, key := range huntWindowSettings {
+		var value string
+		err := tx.QueryRow(ConvertPlaceholders(`SELECT value FROM settings WHERE key = ?`), key).Scan(&value)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read setting %s: %s", key, err)
+		}
+		values[key] = value
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	// Values that didn't parse were ignored, leaving that side open
+	var start, end sql.NullTime
+	if t, err := time.Parse(time.RFC3339, values["hunt_start"]); err == nil {
+		start = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+	if t, err := time.Parse(time.RFC3339, values["hunt_end"]); err == nil {
+		end = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+	teamDuration, _ := time.ParseDuration(values["team_duration"])
+	if teamDuration < 0 {
+		teamDuration = 0
+	}
+	_, err := tx.Exec(ConvertPlaceholders(`UPDATE hunts SET window_set = TRUE, starts_at = ?, ends_at = ?, team_duration_seconds = ?`),
+		start, end, int64(teamDuration/time.Second))
+	if err != nil {
+		return fmt.Errorf("Failed to copy the hunt window to each hunt: %s", err)
+	}
+	for _, key := range huntWindowSettings {
+		if _, err := tx.Exec(ConvertPlaceholders(`DELETE FROM settings WHERE key = ?`), key); err != nil {
+			return fmt.Errorf("Failed to delete setting %s: %s", key, err)
+		}
+	}
+	return nil
+}
+
+// dropHuntWindows goes back to one window for every hunt, the first
+// hunt's
+func dropHuntWindows(tx *sql.Tx, d dialect) error {
+	var set bool
+	var start, end sql.NullTime
+	var teamSeconds int64
+	err := tx.QueryRow(ConvertPlaceholders(`SELECT window_set, starts_at, ends_at, team_duration_seconds FROM hunts WHERE id = ?`), DefaultHuntID).
+		Scan(&set, &start, &end, &teamSeconds)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("Failed to read the first hunt's window: %s", err)
+	}
+	if set {
+		format := func(t sql.NullTime) string {
+			if !t.Valid {
+				return ""
+			}
+			return t.Time.UTC().Format(time.RFC3339)
+		}
+		values := map[string]string{
+			"hunt_start":    format(start),
+			"hunt_end":      format(end),
+			"team_duration": (time.Duration(teamSeconds) * time.Second).String(),
+		}
+		for _, key := range huntWindowSettings {
+			if _, err := tx.Exec(ConvertPlaceholders(`INSERT INTO settings (key, value) VALUES (?, ?)`), key, values[key]); err != nil {
+				return fmt.Errorf("Failed to restore setting %s: %s", key, err)
+			}
+		}
+	}
+
+	for _, c := range huntWindowColumns {
+		if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE hunts DROP COLUMN %s`, c.name)); err != nil {
+			return fmt.Errorf("Failed to drop %s from hunts table: %s", c.name, err)
+		}
+	}
+	return nil
+}
+
+// addHuntShoutboxes gives each hunt its own shoutbox. Messages already
+// posted stay in the hunt of the team that posted them
+func addHuntShoutboxes(tx *sql.Tx, d dialect) error {
+	if err := addColumnIfMissing(tx, d, "chat_messages", "hunt_id", fmt.Sprintf("INTEGER NOT NULL DEFAULT %d", DefaultHuntID)); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE chat_messages SET hunt_id = COALESCE((SELECT t.hunt_id FROM teams t WHERE t.id = chat_messages.team_id), hunt_id)`)
+	if err != nil {
+		return fmt.Errorf("Failed to move chat messages into their hunts: %s", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_chat_messages_hunt ON chat_messages(hunt_id, channel, created_at)`); err != nil {
+		return fmt.Errorf("Failed to create index idx_chat_messages_hunt: %s", err)
+	}
+	return nil
+}
+
+func dropHuntShoutboxes(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`DROP INDEX IF EXISTS idx_chat_messages_hunt`); err != nil {
+		return fmt.Errorf("Failed to drop index idx_chat_messages_hunt: %s", err)
+	}
+	if _, err := tx.Exec(`ALTER TABLE chat_messages DROP COLUMN hunt_id`); err != nil {
+		return fmt.Errorf("Failed to drop hunt_id from chat_messages table: %s", err)
+	}
+	return nil
+}
+
+// pendingReviewPoints is what a team's solves waiting for review are worth
+const pendingReviewPoints = `(SELECT COALESCE(SUM(r.points), 0) FROM solve_reviews r
+		WHERE r.team_id = teams.id AND r.status = 'pending')`
+
+// holdPendingReviewPoints takes back the points of solves waiting for
+// review. They used to count right away, and are now paid on approval
+func holdPendingReviewPoints(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`UPDATE teams SET points = points - ` + pendingReviewPoints); err != nil {
+		return fmt.Errorf("Failed to hold the points of pending solve reviews: %s", err)
+	}
+	return nil
+}
+
+func payPendingReviewPoints(tx *sql.Tx, d dialect) error {
+	if _, err := tx.Exec(`UPDATE teams SET points = points + ` + pendingReviewPoints); err != nil {
+		return fmt.Errorf("Failed to pay the points of pending solve reviews: %s", err)
+	}
+	return nil
+}
@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,7 +14,6 @@ import (
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"github.com/namishh/holmes/database"
 	"github.com/namishh/holmes/services"
 	"github.com/namishh/holmes/views/pages/auth"
 	"github.com/namishh/holmes/views/pages/panel"
@@ -247,9 +246,15 @@ func (ah *AuthHandler) AdminHandler(c echo.Context) error {
 		}
 
 		// Check password FIRST before recording attempt
-		if c.FormValue("password") != os.Getenv("ADMIN_PASS") {
+		if ah.AdminPass == "" || c.FormValue("password") != ah.AdminPass {
 			// Wrong password - NOW record the failed attempt
-			adminRateLimiter.CheckAndRecordAttempt(clientIP, false)
+			if allowed, blockedFor := adminRateLimiter.CheckAndRecordAttempt(clientIP, false); !allowed {
+				ah.Broadcaster.BroadcastToAdmins(services.EventAdminLockout, map[string]interface{}{
+					"ip":       clientIP,
+					"attempts": adminRateLimiter.maxAttempts,
+					"until":    time.Now().Add(blockedFor),
+				})
+			}
 			
 			c.Set("ISERROR", true)
 			
@@ -331,17 +336,22 @@ func (ah *AuthHandler) AdminPageHandler(c echo.Context) error {
 	users := make([]services.User, 0)
 	questions := make([]services.Question, 0)
 
-	users, err := ah.UserServices.GetAllUsers()
+	hunt, err := ah.UserServices.GetHunt(c.Request().Context(), ah.adminHunt(c))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error fetching hunt")
+	}
+
+	users, err = ah.UserServices.GetAllUsers(c.Request().Context(), hunt.ID)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "Error fetching users")
 	}
 
-	questions, err = ah.UserServices.GetAllQuestions()
+	questions, err = ah.UserServices.GetAllQuestions(c.Request().Context(), hunt.ID)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "Error fetching questions")
 	}
 
-	adminLoginView := panel.PanelHome(fromProtected, users, questions)
+	adminLoginView := panel.PanelHome(fromProtected, hunt, users, questions)
 	c.Set("ISERROR", false)
 	return renderView(c, panel.PanelIndex(
 		"Admin Panel",
@@ -378,13 +388,33 @@ func (ah *AuthHandler) AdminQuestionHandler(c echo.Context) error {
 			errs["question"] = "Question cannot be empty"
 		}
 
+		values["answer_type"] = c.FormValue("answer_type")
+		answerType, err := parseAnswerType(values["answer_type"])
+		if err != nil {
+			c.Set("ISERROR", true)
+			errs["answer_type"] = "Pick a typed answer or a photo"
+		}
+
+		values["category"] = c.FormValue("category")
+		category, err := services.CheckCategory(values["category"])
+		if err != nil {
+			c.Set("ISERROR", true)
+			errs["category"] = fmt.Sprintf("The category is at most %d characters.", services.MaxCategoryLength)
+		}
+
 		answer := c.FormValue("answer")
 		values["answer"] = answer
-		if len(answer) == 0 {
+		// Photo questions are graded by an admin, so they need no answer
+		if len(answer) == 0 && answerType != services.AnswerPhoto {
 			c.Set("ISERROR", true)
 			errs["answer"] = "Answer cannot be empty"
 		}
 
+		revealAnswer := strings.TrimSpace(c.FormValue("reveal_answer"))
+		values["reveal_answer"] = revealAnswer
+		solution := strings.TrimSpace(c.FormValue("solution"))
+		values["solution"] = solution
+
 		points := c.FormValue("points")
 		values["points"] = points
 		i, err := strconv.Atoi(points)
@@ -393,6 +423,13 @@ func (ah *AuthHandler) AdminQuestionHandler(c echo.Context) error {
 			errs["points"] = "Points cannot be empty"
 		}
 
+		values["cooldown"] = c.FormValue("cooldown")
+		cooldown, err := parseCooldown(values["cooldown"], services.DefaultCooldown)
+		if err != nil {
+			c.Set("ISERROR", true)
+			errs["cooldown"] = err.Error()
+		}
+
 		if len(errs) > 0 {
 			questionView := panel.PanelQuestion(fromProtected, errs, values)
 			c.Set("ISERROR", false)
@@ -458,8 +495,21 @@ func (ah *AuthHandler) AdminQuestionHandler(c echo.Context) error {
 				adminLoginView,
 			))
 		}
-		log.Println(images, videos, audios)
-		err = ah.UserServices.CreateQuestion(services.Question{Question: question, Title: title, Points: i, Answer: answer}, images, videos, audios)
+		files, err := ah.UserServices.MakeArray("files", form, "FILE")
+		if err != nil {
+			c.Set("ISERROR", true)
+			errs["files"] = fmt.Sprintf("%v", err)
+			adminLoginView := panel.PanelQuestion(fromProtected, errs, values)
+			return renderView(c, panel.PanelQuestionIndex(
+				"Admin Panel",
+				"admin",
+				fromProtected,
+				c.Get("ISERROR").(bool),
+				adminLoginView,
+			))
+		}
+		log.Println(images, videos, audios, files)
+		id, err := ah.UserServices.CreateQuestion(c.Request().Context(), services.Question{Question: question, Title: title, Points: i, Answer: answer, RevealAnswer: revealAnswer, Solution: solution, Cooldown: cooldown, AnswerType: answerType, Category: category, HuntID: ah.adminHunt(c)}, images, videos, audios)
 		if err != nil {
 			c.Set("ISERROR", true)
 			errs["question"] = fmt.Sprintf("Failed to create question: %v", err)
@@ -472,10 +522,13 @@ func (ah *AuthHandler) AdminQuestionHandler(c echo.Context) error {
 				adminLoginView,
 			))
 		}
+		if err := ah.UserServices.CreateAttachments(c.Request().Context(), id, files, uploadedFilenames(form, "files")); err != nil {
+			return err
+		}
 		return c.Redirect(http.StatusSeeOther, "/su")
 	}
 
-	adminLoginView := panel.PanelQuestion(fromProtected, errs, map[string]string{})
+	adminLoginView := panel.PanelQuestion(fromProtected, errs, map[string]string{"cooldown": strconv.Itoa(services.DefaultCooldown)})
 	c.Set("ISERROR", false)
 	return renderView(c, panel.PanelQuestionIndex(
 		"Admin Panel",
@@ -486,6 +539,20 @@ func (ah *AuthHandler) AdminQuestionHandler(c echo.Context) error {
 	))
 }
 
+// parseCooldown reads the seconds a team waits after a wrong answer, fallback
+// when the field is left empty
+func parseCooldown(s string, fallback int) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > int(services.MaxCooldown/time.Second) {
+		return 0, fmt.Errorf("Cooldown must be between 0 and %d seconds.", int(services.MaxCooldown/time.Second))
+	}
+	return n, nil
+}
+
 func (ah *AuthHandler) AdminDeleteTeam(c echo.Context) error {
 	teamID := c.Param("id")
 	ti, err := strconv.Atoi(teamID)
@@ -499,7 +566,7 @@ func (ah *AuthHandler) AdminDeleteTeam(c echo.Context) error {
 
 	}
 
-	ah.UserServices.DeleteTeam(ti)
+	ah.UserServices.DeleteTeam(c.Request().Context(), ti)
 
 	return c.Redirect(http.StatusSeeOther, "/su")
 }
@@ -517,7 +584,7 @@ func (ah *AuthHandler) AdminDeleteQuestion(c echo.Context) error {
 
 	}
 
-	ah.UserServices.DeleteQuestion(ti)
+	ah.UserServices.DeleteQuestion(c.Request().Context(), ti)
 
 	return c.Redirect(http.StatusSeeOther, "/su")
 }
@@ -535,12 +602,12 @@ func (ah *AuthHandler) AdminDeleteHint(c echo.Context) error {
 
 	}
 
-	ah.UserServices.DeleteHint(ti)
+	ah.UserServices.DeleteHint(c.Request().Context(), ti)
 
 	return c.Redirect(http.StatusSeeOther, "/su/hints")
 }
 func (ah *AuthHandler) AdminHintsHandler(c echo.Context) error {
-	hints, err := ah.UserServices.GetHints()
+	hints, err := ah.UserServices.GetHints(c.Request().Context(), ah.adminHunt(c))
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "Error fetching hints")
 	}
@@ -583,7 +650,7 @@ func (ah *AuthHandler) AdminHintNewHandler(c echo.Context) error {
 			errs["level"] = "Invalid level"
 		}
 
-		_, err = ah.UserServices.GetQuestionById(l)
+		_, err = ah.UserServices.GetQuestionById(c.Request().Context(), l)
 		if err != nil {
 			c.Set("ISERROR", true)
 			errs["level"] = "Invalid level"
@@ -607,10 +674,14 @@ func (ah *AuthHandler) AdminHintNewHandler(c echo.Context) error {
 			))
 		}
 
-		err = ah.UserServices.CreateHint(services.Hint{Hint: title, ParentQuestionID: l, Worth: w})
+		_, err = ah.UserServices.CreateHint(c.Request().Context(), services.Hint{Hint: title, ParentQuestionID: l, Worth: w})
 		if err != nil {
 			c.Set("ISERROR", true)
 			errs["title"] = "Error creating hint"
+		} else {
+			ah.notify(c.Request().Context(), 0, services.NotificationHintReleased, "New hint released",
+				fmt.Sprintf("A hint worth %d points is now available for question %d.", w, l),
+				fmt.Sprintf("/hunt/question/%d", l))
 		}
 
 		return c.Redirect(http.StatusSeeOther, "/su/hints")
@@ -646,7 +717,7 @@ func (ah *AuthHandler) AdminEditQuestionHandler(c echo.Context) error {
 			))
 	}
 
-	question, err := ah.UserServices.GetQuestionById(t)
+	question, err := ah.UserServices.GetQuestionById(c.Request().Context(), t)
 
 	if err != nil {
 		return echo.NewHTTPError(
@@ -660,14 +731,24 @@ func (ah *AuthHandler) AdminEditQuestionHandler(c echo.Context) error {
 	inputs["title"] = question.Title
 	inputs["question"] = question.Question
 	inputs["points"] = strconv.Itoa(question.Points)
+	inputs["cooldown"] = strconv.Itoa(question.Cooldown)
+	inputs["reveal_answer"] = question.RevealAnswer
+	inputs["solution"] = question.Solution
+	inputs["flag_template"] = question.FlagTemplate
+	inputs["answer_type"] = question.AnswerType
+	inputs["category"] = question.Category
+
+	geofence, err := ah.UserServices.GetGeofence(c.Request().Context(), t)
+	if err != nil {
+		return err
+	}
+	geofenceInputs(inputs, geofence)
 
-	media["images"], err = ah.UserServices.GetMedia(database.ConvertPlaceholders("SELECT path FROM images where parent_question_id = ?"), t)
-	media["videos"], err = ah.UserServices.GetMedia(database.ConvertPlaceholders("SELECT path FROM videos where parent_question_id = ?"), t)
-	media["audios"], err = ah.UserServices.GetMedia(database.ConvertPlaceholders("SELECT path FROM audios where parent_question_id = ?"), t)
-
-	media["limages"], err = ah.UserServices.GetMedia(database.ConvertPlaceholders("SELECT id FROM images where parent_question_id = ?"), t)
-	media["lvideos"], err = ah.UserServices.GetMedia(database.ConvertPlaceholders("SELECT id FROM videos where parent_question_id = ?"), t)
-	media["laudios"], err = ah.UserServices.GetMedia(database.ConvertPlaceholders("SELECT id FROM audios where parent_question_id = ?"), t)
+	questionMedia, err := ah.UserServices.GetMediaForQuestions(c.Request().Context(), []int{t})
+	if err != nil {
+		return err
+	}
+	media = questionMedia[t]
 
 	if c.Request().Method == "POST" {
 
@@ -677,27 +758,81 @@ func (ah *AuthHandler) AdminEditQuestionHandler(c echo.Context) error {
 		}
 		images, err := ah.UserServices.MakeArray("images", form, "IMG")
 		if err != nil {
-			return err
+			if !isUploadRejected(err) {
+				return err
+			}
+			c.Set("ISERROR", true)
+			errs["images"] = err.Error()
 		}
 		videos, err := ah.UserServices.MakeArray("videos", form, "VID")
 		if err != nil {
-			return err
+			if !isUploadRejected(err) {
+				return err
+			}
+			c.Set("ISERROR", true)
+			errs["videos"] = err.Error()
 		}
 		audios, err := ah.UserServices.MakeArray("audios", form, "AUD")
 		if err != nil {
-			return err
+			if !isUploadRejected(err) {
+				return err
+			}
+			c.Set("ISERROR", true)
+			errs["audios"] = err.Error()
+		}
+		files, err := ah.UserServices.MakeArray("files", form, "FILE")
+		if err != nil {
+			if !isUploadRejected(err) {
+				return err
+			}
+			c.Set("ISERROR", true)
+			errs["files"] = err.Error()
+		}
+		// Positions and captions of the media already on the question
+		for _, table := range []string{"images", "videos", "audios", "files"} {
+			for _, id := range media["l"+table] {
+				n, _ := strconv.Atoi(id)
+				position, err := strconv.Atoi(c.FormValue(fmt.Sprintf("position_%s_%s", table, id)))
+				if err != nil {
+					c.Set("ISERROR", true)
+					errs["media"] = "Invalid position."
+					continue
+				}
+				caption := c.FormValue(fmt.Sprintf("caption_%s_%s", table, id))
+				if err := ah.UserServices.UpdateMediaDetails(c.Request().Context(), table, t, n, position, caption); err != nil {
+					c.Set("ISERROR", true)
+					errs["media"] = err.Error()
+				}
+			}
+		}
+
+		log.Println(images, videos, audios, files)
+		err = ah.UserServices.CreateMedia(c.Request().Context(), t, images, videos, audios)
+		if len(files) > 0 {
+			if err := ah.UserServices.CreateAttachments(c.Request().Context(), t, files, uploadedFilenames(form, "files")); err != nil {
+				return err
+			}
 		}
-		log.Println(images, videos, audios)
-		err = ah.UserServices.CreateMedia(t, images, videos, audios)
 
 		title := c.FormValue("title")
 		qn := c.FormValue("question")
 		points := c.FormValue("points")
 		answer := c.FormValue("answer")
+		revealAnswer := strings.TrimSpace(c.FormValue("reveal_answer"))
+		solution := strings.TrimSpace(c.FormValue("solution"))
+		inputs["reveal_answer"] = revealAnswer
+		inputs["solution"] = solution
 
+		flagTemplate := question.FlagTemplate
 		if answer == "" {
 			answer = question.Answer
 		} else {
+			flagTemplate = services.FlagTemplate(answer)
+			// A new answer replaces the revealed one unless that was
+			// edited too
+			if revealAnswer == "" || revealAnswer == question.RevealAnswer {
+				revealAnswer = answer
+			}
 			by, err := bcrypt.GenerateFromPassword([]byte(answer), bcrypt.DefaultCost)
 			if err != nil {
 				return err
@@ -716,6 +851,36 @@ func (ah *AuthHandler) AdminEditQuestionHandler(c echo.Context) error {
 			errs["points"] = "Invalid Points."
 		}
 
+		inputs["cooldown"] = c.FormValue("cooldown")
+		cooldown, err := parseCooldown(inputs["cooldown"], question.Cooldown)
+		if err != nil {
+			c.Set("ISERROR", true)
+			errs["cooldown"] = err.Error()
+		}
+
+		inputs["answer_type"] = c.FormValue("answer_type")
+		answerType, err := parseAnswerType(inputs["answer_type"])
+		if err != nil {
+			c.Set("ISERROR", true)
+			errs["answer_type"] = "Pick a typed answer or a photo"
+		}
+
+		inputs["category"] = c.FormValue("category")
+		category, err := services.CheckCategory(inputs["category"])
+		if err != nil {
+			c.Set("ISERROR", true)
+			errs["category"] = fmt.Sprintf("The category is at most %d characters.", services.MaxCategoryLength)
+		}
+
+		inputs["latitude"] = c.FormValue("latitude")
+		inputs["longitude"] = c.FormValue("longitude")
+		inputs["radius"] = c.FormValue("radius")
+		newGeofence, err := parseGeofence(inputs["latitude"], inputs["longitude"], inputs["radius"])
+		if err != nil {
+			c.Set("ISERROR", true)
+			errs["location"] = err.Error()
+		}
+
 		if len(errs) > 0 {
 			view := panel.PanelEditQuestion(fromProtected, errs, inputs, media)
 
@@ -730,7 +895,10 @@ func (ah *AuthHandler) AdminEditQuestionHandler(c echo.Context) error {
 			))
 		}
 
-		err = ah.UserServices.UpdateQuestion(t, title, qn, p, answer)
+		err = ah.UserServices.UpdateQuestion(c.Request().Context(), t, title, qn, p, answer, revealAnswer, solution, flagTemplate, cooldown, answerType, category)
+		if err := ah.saveGeofence(c.Request().Context(), t, geofence, newGeofence); err != nil {
+			return err
+		}
 		return c.Redirect(http.StatusSeeOther, "/su")
 	}
 
@@ -758,7 +926,7 @@ func (ah *AuthHandler) AdminDeleteImage(c echo.Context) error {
 				err,
 			))
 	}
-	ah.UserServices.DeleteMedia(n, "images")
+	ah.UserServices.DeleteMedia(c.Request().Context(), n, "images")
 	return c.Redirect(http.StatusSeeOther, "/su")
 }
 
@@ -773,7 +941,7 @@ func (ah *AuthHandler) AdminDeleteAudio(c echo.Context) error {
 				err,
 			))
 	}
-	ah.UserServices.DeleteMedia(n, "audios")
+	ah.UserServices.DeleteMedia(c.Request().Context(), n, "audios")
 	return c.Redirect(http.StatusSeeOther, "/su")
 }
 
@@ -788,7 +956,22 @@ func (ah *AuthHandler) AdminDeleteVideo(c echo.Context) error {
 				err,
 			))
 	}
-	ah.UserServices.DeleteMedia(n, "videos")
+	ah.UserServices.DeleteMedia(c.Request().Context(), n, "videos")
+	return c.Redirect(http.StatusSeeOther, "/su")
+}
+
+func (ah *AuthHandler) AdminDeleteFile(c echo.Context) error {
+	qid := c.Param("name")
+	n, err := strconv.Atoi(qid)
+	if err != nil {
+		return echo.NewHTTPError(
+			echo.ErrNotFound.Code,
+			fmt.Sprintf(
+				"something went wrong: %s",
+				err,
+			))
+	}
+	ah.UserServices.DeleteMedia(c.Request().Context(), n, "files")
 	return c.Redirect(http.StatusSeeOther, "/su")
 }
 
@@ -799,12 +982,21 @@ func (ah *AuthHandler) AdminSolvedQuestionsHandler(c echo.Context) error {
 		return errors.New("invalid type for key 'FROMPROTECTED'")
 	}
 
-	solvedQuestions, err := ah.UserServices.GetAllSolvedQuestions()
+	solvedQuestions, err := ah.UserServices.GetAllSolvedQuestions(c.Request().Context(), ah.adminHunt(c))
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching solved questions: %s", err))
 	}
 
-	view := panel.SolvedQuestions(fromProtected, solvedQuestions)
+	teams, err := ah.UserServices.GetAllUsers(c.Request().Context(), ah.adminHunt(c))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching teams: %s", err))
+	}
+	questions, err := ah.UserServices.GetAllQuestions(c.Request().Context(), ah.adminHunt(c))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching questions: %s", err))
+	}
+
+	view := panel.SolvedQuestions(fromProtected, solvedQuestions, teams, questions)
 	c.Set("ISERROR", false)
 
 	return renderView(c, panel.SolvedQuestionsIndex(
@@ -831,11 +1023,15 @@ func (ah *AuthHandler) AdminUnlockQuestionHandler(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Invalid team ID")
 	}
 
-	err = ah.UserServices.UnlockSolvedQuestion(questionID, teamID)
+	err = ah.UserServices.UnlockSolvedQuestion(c.Request().Context(), questionID, teamID)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error unlocking question: %s", err))
 	}
 
+	ah.notify(c.Request().Context(), teamID, services.NotificationQuestionUnlock, "Question reopened",
+		fmt.Sprintf("Question %d has been reopened for your team.", questionID),
+		fmt.Sprintf("/hunt/question/%d", questionID))
+
 	return c.Redirect(http.StatusSeeOther, "/su/solved-questions")
 }
 
@@ -848,11 +1044,15 @@ func (ah *AuthHandler) AdminUnlockAllQuestionHandler(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Invalid question ID")
 	}
 
-	err = ah.UserServices.UnlockAllSolvedQuestions(questionID)
+	err = ah.UserServices.UnlockAllSolvedQuestions(c.Request().Context(), questionID)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error unlocking question: %s", err))
 	}
 
+	ah.notify(c.Request().Context(), 0, services.NotificationQuestionUnlock, "Question reopened",
+		fmt.Sprintf("Question %d has been reopened for every team.", questionID),
+		fmt.Sprintf("/hunt/question/%d", questionID))
+
 	return c.Redirect(http.StatusSeeOther, "/su/solved-questions")
 }
 
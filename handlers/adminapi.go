@@ -0,0 +1,660 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Admin REST API for provisioning questions, hints and teams from scripts.
+// Requests authenticate with "Authorization: Bearer <token>", using a token
+// minted from /su/api-tokens
+
+// adminAPIQuestion is a question as managed by the admin API
+// Answer is write-only; it is hashed on the way in and never returned.
+// FlagTemplate is read-only and set from an answer holding the team token
+// placeholder. Cooldown defaults to services.DefaultCooldown on create and
+// is kept on replace when left out
+type adminAPIQuestion struct {
+	ID           int                 `json:"id"`
+	Title        string              `json:"title"`
+	Question     string              `json:"question,omitempty"`
+	Answer       string              `json:"answer,omitempty"`
+	RevealAnswer string              `json:"reveal_answer,omitempty"`
+	Solution     string              `json:"solution,omitempty"`
+	FlagTemplate string              `json:"flag_template,omitempty"`
+	Points       int                 `json:"points"`
+	Cooldown     *int                `json:"cooldown,omitempty"`
+	AnswerType   string              `json:"answer_type,omitempty"`
+	Category     *string             `json:"category,omitempty"`
+	HuntID       int                 `json:"hunt_id"`
+	Media        map[string][]string `json:"media,omitempty"`
+	Hints        []services.Hint     `json:"hints,omitempty"`
+}
+
+// adminAPIHint is a hint as managed by the admin API
+type adminAPIHint struct {
+	ID         int    `json:"id"`
+	Hint       string `json:"hint"`
+	Worth      int    `json:"worth"`
+	QuestionID int    `json:"question_id"`
+}
+
+// adminAPITeam is a team as managed by the admin API
+// Password is only accepted when creating a team
+type adminAPITeam struct {
+	ID       int    `json:"id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	Points   int    `json:"points"`
+	HuntID   int    `json:"hunt_id"`
+
+	// StartedAt is when the team's own clock started, when teams run on
+	// their own clocks
+	StartedAt *time.Time `json:"started_at,omitempty"`
+
+	// SuspendedAt is when the team was suspended, if it is
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+	// FlaggedAt is when the team was flagged for review, if it is
+	FlaggedAt *time.Time `json:"flagged_at,omitempty"`
+	// Avatar is the address of the team's avatar, if it has one
+	Avatar string `json:"avatar,omitempty"`
+}
+
+// adminAPIMiddleware authenticates admin API requests by bearer token
+func (ah *AuthHandler) adminAPIMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if !ok || token == "" {
+			return jsonError(c, http.StatusUnauthorized, "Missing bearer token", nil)
+		}
+
+		valid, err := ah.UserServices.CheckAdminAPIToken(c.Request().Context(), token)
+		if err != nil {
+			return jsonError(c, http.StatusInternalServerError, "Internal server error", nil)
+		}
+		if !valid {
+			return jsonError(c, http.StatusUnauthorized, "Invalid token", nil)
+		}
+
+		c.Set("ISADMIN", true)
+		return next(c)
+	}
+}
+
+// adminAPIID parses the :id path parameter
+func adminAPIID(c echo.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, newPlayError(http.StatusBadRequest, "Invalid ID")
+	}
+	return id, nil
+}
+
+// validateQuestion checks the fields shared by creating and replacing a question
+func validateQuestion(q adminAPIQuestion, requireAnswer bool) error {
+	if strings.TrimSpace(q.Title) == "" {
+		return newPlayError(http.StatusBadRequest, "Title cannot be empty")
+	}
+	if strings.TrimSpace(q.Question) == "" {
+		return newPlayError(http.StatusBadRequest, "Question cannot be empty")
+	}
+	if q.AnswerType != "" && !services.ValidAnswerType(q.AnswerType) {
+		return newPlayError(http.StatusBadRequest, "Answer type must be text or photo")
+	}
+	if q.Category != nil {
+		if _, err := services.CheckCategory(*q.Category); err != nil {
+			return newPlayError(http.StatusBadRequest, "%s", err.Error())
+		}
+	}
+	// Photo questions are graded by an admin, so they need no answer
+	if requireAnswer && q.Answer == "" && q.AnswerType != services.AnswerPhoto {
+		return newPlayError(http.StatusBadRequest, "Answer cannot be empty")
+	}
+	if q.Points <= 0 {
+		return newPlayError(http.StatusBadRequest, "Points must be positive")
+	}
+	if q.Cooldown != nil && (*q.Cooldown < 0 || *q.Cooldown > int(services.MaxCooldown/time.Second)) {
+		return newPlayError(http.StatusBadRequest, "Cooldown must be between 0 and %d seconds", int(services.MaxCooldown/time.Second))
+	}
+	return nil
+}
+
+// AdminAPIListQuestions lists every question of ?hunt_id=, the first hunt
+// by default
+func (ah *AuthHandler) AdminAPIListQuestions(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	questions, err := ah.UserServices.GetAllQuestions(c.Request().Context(), huntID)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	out := make([]adminAPIQuestion, 0, len(questions))
+	for _, q := range questions {
+		out = append(out, adminAPIQuestion{ID: q.ID, Title: q.Title, Points: q.Points, HuntID: q.HuntID})
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// AdminAPIGetQuestion returns a question with its media and hints
+func (ah *AuthHandler) AdminAPIGetQuestion(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	q, err := ah.adminAPIQuestion(c.Request().Context(), id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, q)
+}
+
+// adminAPIQuestion loads a question with its media and hints
+func (ah *AuthHandler) adminAPIQuestion(ctx context.Context, id int) (adminAPIQuestion, error) {
+	question, err := ah.UserServices.GetQuestionById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return adminAPIQuestion{}, newPlayError(http.StatusNotFound, "Question not found")
+	}
+	if err != nil {
+		return adminAPIQuestion{}, err
+	}
+
+	media, err := ah.UserServices.GetMediaByQuestionId(ctx, id)
+	if err != nil {
+		return adminAPIQuestion{}, err
+	}
+
+	hints, err := ah.UserServices.GetHintsByQuestionID(ctx, id)
+	if err != nil {
+		return adminAPIQuestion{}, err
+	}
+
+	return adminAPIQuestion{
+		ID:           question.ID,
+		Title:        question.Title,
+		Question:     question.Question,
+		RevealAnswer: question.RevealAnswer,
+		Solution:     question.Solution,
+		FlagTemplate: question.FlagTemplate,
+		Points:       question.Points,
+		Cooldown:     &question.Cooldown,
+		AnswerType:   question.AnswerType,
+		Category:     &question.Category,
+		HuntID:       question.HuntID,
+		Media:        media,
+		Hints:        hints,
+	}, nil
+}
+
+// AdminAPICreateQuestion creates a question
+func (ah *AuthHandler) AdminAPICreateQuestion(c echo.Context) error {
+	var req adminAPIQuestion
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+	if err := validateQuestion(req, true); err != nil {
+		return apiError(c, err)
+	}
+	huntID, err := ah.checkHunt(c.Request().Context(), req.HuntID)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	cooldown := services.DefaultCooldown
+	if req.Cooldown != nil {
+		cooldown = *req.Cooldown
+	}
+	var category string
+	if req.Category != nil {
+		category = *req.Category
+	}
+
+	id, err := ah.UserServices.CreateQuestion(c.Request().Context(), services.Question{
+		Title:        req.Title,
+		Question:     req.Question,
+		Answer:       req.Answer,
+		RevealAnswer: strings.TrimSpace(req.RevealAnswer),
+		Solution:     strings.TrimSpace(req.Solution),
+		Points:       req.Points,
+		Cooldown:     cooldown,
+		AnswerType:   req.AnswerType,
+		Category:     category,
+		HuntID:       huntID,
+	}, nil, nil, nil)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	q, err := ah.adminAPIQuestion(c.Request().Context(), id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, q)
+}
+
+// AdminAPIUpdateQuestion replaces a question's fields; the answer and the
+// revealed answer are kept when none is given
+func (ah *AuthHandler) AdminAPIUpdateQuestion(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	var req adminAPIQuestion
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+	if err := validateQuestion(req, false); err != nil {
+		return apiError(c, err)
+	}
+
+	existing, err := ah.UserServices.GetQuestionById(c.Request().Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apiError(c, newPlayError(http.StatusNotFound, "Question not found"))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	answer, revealAnswer, flagTemplate := existing.Answer, existing.RevealAnswer, existing.FlagTemplate
+	if req.Answer != "" {
+		by, err := bcrypt.GenerateFromPassword([]byte(req.Answer), bcrypt.DefaultCost)
+		if err != nil {
+			return apiError(c, err)
+		}
+		answer, revealAnswer, flagTemplate = string(by), req.Answer, services.FlagTemplate(req.Answer)
+	}
+	if r := strings.TrimSpace(req.RevealAnswer); r != "" {
+		revealAnswer = r
+	}
+	cooldown := existing.Cooldown
+	if req.Cooldown != nil {
+		cooldown = *req.Cooldown
+	}
+	answerType := existing.AnswerType
+	if req.AnswerType != "" {
+		answerType = req.AnswerType
+	}
+	category := existing.Category
+	if req.Category != nil {
+		category = services.NormalizeCategory(*req.Category)
+	}
+
+	if err := ah.UserServices.UpdateQuestion(c.Request().Context(), id, req.Title, req.Question, req.Points, answer, revealAnswer, strings.TrimSpace(req.Solution), flagTemplate, cooldown, answerType, category); err != nil {
+		return apiError(c, err)
+	}
+
+	q, err := ah.adminAPIQuestion(c.Request().Context(), id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, q)
+}
+
+// adminAPITeamFlag is a team's flag for a question with a per-team flag
+type adminAPITeamFlag struct {
+	services.TeamFlag
+	Flag string `json:"flag"`
+}
+
+// AdminAPIListTeamFlags lists the flag of every team that has opened a
+// question with a per-team flag; teams get theirs when they first open it
+func (ah *AuthHandler) AdminAPIListTeamFlags(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	question, err := ah.UserServices.GetQuestionById(c.Request().Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apiError(c, newPlayError(http.StatusNotFound, "Question not found"))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	flags, err := ah.UserServices.GetTeamFlags(c.Request().Context(), id)
+	if err != nil {
+		return apiError(c, err)
+	}
+	out := make([]adminAPITeamFlag, 0, len(flags))
+	for _, f := range flags {
+		out = append(out, adminAPITeamFlag{TeamFlag: f, Flag: services.ExpandTeamFlag(question.FlagTemplate, f.Token)})
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// AdminAPIDeleteQuestion deletes a question and everything attached to it
+func (ah *AuthHandler) AdminAPIDeleteQuestion(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if _, err := ah.UserServices.GetQuestionById(c.Request().Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apiError(c, newPlayError(http.StatusNotFound, "Question not found"))
+		}
+		return apiError(c, err)
+	}
+
+	if err := ah.UserServices.DeleteQuestion(c.Request().Context(), id); err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// adminAPIHintFromRequest binds and validates a hint
+func (ah *AuthHandler) adminAPIHintFromRequest(c echo.Context) (adminAPIHint, error) {
+	var req adminAPIHint
+	if err := c.Bind(&req); err != nil {
+		return req, newPlayError(http.StatusBadRequest, "Invalid request")
+	}
+	if strings.TrimSpace(req.Hint) == "" {
+		return req, newPlayError(http.StatusBadRequest, "Hint cannot be empty")
+	}
+	if req.Worth < 0 {
+		return req, newPlayError(http.StatusBadRequest, "Worth cannot be negative")
+	}
+	if _, err := ah.UserServices.GetQuestionById(c.Request().Context(), req.QuestionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return req, newPlayError(http.StatusBadRequest, "Question %d does not exist", req.QuestionID)
+		}
+		return req, err
+	}
+	return req, nil
+}
+
+// AdminAPIListHints lists the hints of ?hunt_id=, the first hunt by
+// default, or only those of ?question_id=
+func (ah *AuthHandler) AdminAPIListHints(c echo.Context) error {
+	var hints []services.Hint
+	var err error
+	if qid := c.QueryParam("question_id"); qid != "" {
+		id, convErr := strconv.Atoi(qid)
+		if convErr != nil {
+			return apiError(c, newPlayError(http.StatusBadRequest, "Invalid question_id"))
+		}
+		hints, err = ah.UserServices.GetHintsByQuestionID(c.Request().Context(), id)
+	} else {
+		var huntID int
+		if huntID, err = ah.adminAPIHunt(c); err == nil {
+			hints, err = ah.UserServices.GetHints(c.Request().Context(), huntID)
+		}
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	out := make([]adminAPIHint, 0, len(hints))
+	for _, h := range hints {
+		out = append(out, adminAPIHint{ID: h.ID, Hint: h.Hint, Worth: h.Worth, QuestionID: h.ParentQuestionID})
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// AdminAPICreateHint creates a hint and tells the teams about it, like the panel does
+func (ah *AuthHandler) AdminAPICreateHint(c echo.Context) error {
+	req, err := ah.adminAPIHintFromRequest(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	req.ID, err = ah.UserServices.CreateHint(c.Request().Context(), services.Hint{Hint: req.Hint, Worth: req.Worth, ParentQuestionID: req.QuestionID})
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	ah.notify(c.Request().Context(), 0, services.NotificationHintReleased, "New hint released",
+		fmt.Sprintf("A hint worth %d points is now available for question %d.", req.Worth, req.QuestionID),
+		fmt.Sprintf("/hunt/question/%d", req.QuestionID))
+
+	return c.JSON(http.StatusCreated, req)
+}
+
+// AdminAPIUpdateHint replaces a hint's fields
+func (ah *AuthHandler) AdminAPIUpdateHint(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if _, _, err := ah.UserServices.GetHintById(c.Request().Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apiError(c, newPlayError(http.StatusNotFound, "Hint not found"))
+		}
+		return apiError(c, err)
+	}
+
+	req, err := ah.adminAPIHintFromRequest(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	req.ID = id
+
+	if err := ah.UserServices.UpdateHint(c.Request().Context(), services.Hint{ID: id, Hint: req.Hint, Worth: req.Worth, ParentQuestionID: req.QuestionID}); err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, req)
+}
+
+// AdminAPIDeleteHint deletes a hint
+func (ah *AuthHandler) AdminAPIDeleteHint(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if _, _, err := ah.UserServices.GetHintById(c.Request().Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apiError(c, newPlayError(http.StatusNotFound, "Hint not found"))
+		}
+		return apiError(c, err)
+	}
+
+	if err := ah.UserServices.DeleteHint(c.Request().Context(), id); err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AdminAPIListTeams lists every team of ?hunt_id=, the first hunt by
+// default
+func (ah *AuthHandler) AdminAPIListTeams(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	users, err := ah.UserServices.GetAllUsers(c.Request().Context(), huntID)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	out := make([]adminAPITeam, 0, len(users))
+	for _, u := range users {
+		out = append(out, adminAPITeam{ID: u.ID, Email: u.Email, Username: u.Username, Points: u.Points, HuntID: u.HuntID, StartedAt: u.StartedAt, SuspendedAt: u.SuspendedAt, FlaggedAt: u.FlaggedAt, Avatar: u.Avatar})
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// AdminAPICreateTeam registers a team with the same rules as the sign-up form
+func (ah *AuthHandler) AdminAPICreateTeam(c echo.Context) error {
+	var req adminAPITeam
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+	req.Username = strings.TrimSpace(req.Username)
+
+	if errs := ah.validateRegistration(c.Request().Context(), req.Email, req.Username, req.Password); len(errs) > 0 {
+		return jsonError(c, http.StatusBadRequest, "Invalid team", errs)
+	}
+	huntID, err := ah.checkHunt(c.Request().Context(), req.HuntID)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = ah.UserServices.CreateUser(c.Request().Context(), services.User{Email: req.Email, Username: req.Username, Password: req.Password, HuntID: huntID})
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	user, err := ah.UserServices.CheckUsername(c.Request().Context(), req.Username)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	ah.emitWebhook(c.Request().Context(), services.WebhookTeamRegistered, map[string]interface{}{
+		"team_name": user.Username,
+	})
+
+	return c.JSON(http.StatusCreated, adminAPITeam{ID: user.ID, Email: user.Email, Username: user.Username, Points: user.Points, HuntID: user.HuntID})
+}
+
+// AdminAPIDeleteTeam deletes a team and all of its progress
+func (ah *AuthHandler) AdminAPIDeleteTeam(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if err := ah.UserServices.DeleteTeam(c.Request().Context(), id); err != nil {
+		if errors.Is(err, services.ErrTeamNotFound) {
+			return apiError(c, newPlayError(http.StatusNotFound, "Team not found"))
+		}
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AdminAPISetTeamStart assigns when a team's own clock starts; a null
+// start clears it so the clock starts at the team's next visit
+func (ah *AuthHandler) AdminAPISetTeamStart(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	var req struct {
+		Start *time.Time `json:"start"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	var at time.Time
+	if req.Start != nil {
+		at = *req.Start
+	}
+	if err := ah.UserServices.SetTeamStart(c.Request().Context(), id, at); err != nil {
+		if errors.Is(err, services.ErrTeamNotFound) {
+			return apiError(c, newPlayError(http.StatusNotFound, "Team not found"))
+		}
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"id": id, "started_at": req.Start})
+}
+
+// AdminAPITokensHandler lists admin API tokens and mints a new one on POST
+func (ah *AuthHandler) AdminAPITokensHandler(c echo.Context) error {
+	errs := make(map[string]string)
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	created := ""
+	if c.Request().Method == "POST" {
+		name := strings.TrimSpace(c.FormValue("name"))
+		if name == "" {
+			errs["name"] = "Give the token a name so you know what uses it."
+		} else {
+			token, err := ah.UserServices.CreateAdminAPIToken(c.Request().Context(), name)
+			if err != nil {
+				return adminError(c, http.StatusInternalServerError, "Error creating token", err)
+			}
+			created = token
+		}
+	}
+
+	tokens, err := ah.UserServices.GetAdminAPITokens(c.Request().Context())
+	if err != nil {
+		return adminError(c, http.StatusInternalServerError, "Error fetching tokens", err)
+	}
+
+	view := panel.APITokens(fromProtected, errs, tokens, created)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.APITokensIndex(
+		"API Tokens",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminDeleteAPIToken revokes an admin API token
+func (ah *AuthHandler) AdminDeleteAPIToken(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return adminError(c, http.StatusBadRequest, "Invalid token ID", nil)
+	}
+
+	if err := ah.UserServices.DeleteAdminAPIToken(c.Request().Context(), id); err != nil {
+		return adminError(c, http.StatusInternalServerError, "Error deleting token", err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/api-tokens")
+}
+
+// AdminAPIListBackups lists the stored database backups, newest first
+func (ah *AuthHandler) AdminAPIListBackups(c echo.Context) error {
+	backups, err := ah.UserServices.ListBackups(c.Request().Context())
+	if err != nil {
+		return apiError(c, err)
+	}
+	if backups == nil {
+		backups = []services.BackupInfo{}
+	}
+
+	return c.JSON(http.StatusOK, backups)
+}
+
+// AdminAPICreateBackup backs up the database now, e.g. before a risky
+// change mid-hunt
+func (ah *AuthHandler) AdminAPICreateBackup(c echo.Context) error {
+	backup, err := ah.UserServices.CreateBackup(c.Request().Context())
+	if errors.Is(err, services.ErrBackupRunning) {
+		return apiError(c, newPlayError(http.StatusConflict, "A backup is already running"))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, backup)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// alertError maps alert service errors to play errors
+func alertError(err error) error {
+	if errors.Is(err, services.ErrAlertNotFound) {
+		return newPlayError(http.StatusNotFound, "%s", err)
+	}
+	return err
+}
+
+// broadcastAlerts tells the admins watching about new alerts
+func (ah *AuthHandler) broadcastAlerts(alerts []services.Alert) {
+	for _, a := range alerts {
+		ah.Broadcaster.BroadcastToAdmins(services.EventAlert, services.AlertEvent(a))
+	}
+}
+
+// AdminAlertsHandler shows the open alerts of the hunt being managed, and
+// the resolved ones with ?resolved=1
+func (ah *AuthHandler) AdminAlertsHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	resolved := c.QueryParam("resolved") == "1"
+	alerts, err := ah.UserServices.GetAlerts(c.Request().Context(), ah.adminHunt(c), resolved)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching alerts: %s", err))
+	}
+
+	view := panel.Alerts(fromProtected, alerts, resolved)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.AlertsIndex(
+		"Alerts",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminResolveAlert marks an alert as dealt with
+func (ah *AuthHandler) AdminResolveAlert(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid alert ID")
+	}
+	if err := ah.UserServices.ResolveAlert(c.Request().Context(), id); err != nil {
+		return playErrorString(c, alertError(err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/alerts")
+}
+
+// AdminAPIListAlerts lists the open alerts of a hunt, and the resolved
+// ones with ?resolved=true
+func (ah *AuthHandler) AdminAPIListAlerts(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	resolved, _ := strconv.ParseBool(c.QueryParam("resolved"))
+	alerts, err := ah.UserServices.GetAlerts(c.Request().Context(), huntID, resolved)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, alerts)
+}
+
+// AdminAPIResolveAlert marks an alert as dealt with
+func (ah *AuthHandler) AdminAPIResolveAlert(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if err := ah.UserServices.ResolveAlert(c.Request().Context(), id); err != nil {
+		return apiError(c, alertError(err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/hunt"
+)
+
+// AnnouncementsHandler lists the announcements sent so far, pinned first.
+// Visitors who aren't signed in only see the public ones
+func (ah *AuthHandler) AnnouncementsHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	announcements, err := ah.UserServices.GetAnnouncements(c.Request().Context(), !fromProtected)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching announcements: %s", err))
+	}
+
+	username := ""
+	sess, _ := session.Get(auth_sessions_key, c)
+	if name, ok := sess.Values[user_name_key].(string); ok && fromProtected {
+		username = name
+	}
+
+	c.Set("ISERROR", false)
+	return renderView(c, hunt.AnnouncementsIndex(
+		"Announcements",
+		username,
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		hunt.Announcements(fromProtected, announcements),
+	))
+}
+
+// AdminUpdateAnnouncement pins, publishes or deletes an announcement from
+// the list under the announcement form
+func (ah *AuthHandler) AdminUpdateAnnouncement(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid announcement ID")
+	}
+
+	if c.FormValue("action") == "delete" {
+		err = ah.UserServices.DeleteAnnouncement(c.Request().Context(), id)
+	} else {
+		err = ah.UserServices.UpdateAnnouncement(c.Request().Context(), id,
+			c.FormValue("pinned") == "on", c.FormValue("public") == "on")
+	}
+	if errors.Is(err, services.ErrAnnouncementNotFound) {
+		return c.String(http.StatusNotFound, "Announcement not found")
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error updating announcement: %s", err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/announcements")
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -33,8 +34,10 @@ func (ah *AuthHandler) SSEHandler(c echo.Context) error {
 	// Create a unique client ID
 	clientID := uuid.New().String()
 	
-	// Register the client with the broadcaster
-	client := ah.Broadcaster.RegisterClient(clientID)
+	// Register the client with the broadcaster, subscribing it to its
+	// team's channel when the request is authenticated, or to the admin
+	// channel for admins
+	client := ah.Broadcaster.RegisterClient(clientID, eventChannel(c), ah.eventHunt(c))
 	defer ah.Broadcaster.UnregisterClient(client)
 
 	// Send initial connection event
@@ -54,7 +57,8 @@ func (ah *AuthHandler) SSEHandler(c echo.Context) error {
 	c.Response().Flush()
 
 	// Send current state immediately
-	locks, err := ah.UserServices.GetAllLockedQuestions()
+	huntID, _ := ah.requestHunt(c)
+	locks, err := ah.UserServices.GetAllLockedQuestions(c.Request().Context(), huntID)
 	if err == nil {
 		stateEvent := services.Event{
 			Type: services.EventQuestionLocked,
@@ -83,6 +87,10 @@ func (ah *AuthHandler) SSEHandler(c echo.Context) error {
 				return err
 			}
 			c.Response().Flush()
+			if event.Type == services.EventReconnect {
+				// The server is shutting down
+				return nil
+			}
 
 		case <-ticker.C:
 			// Send heartbeat to keep connection alive
@@ -99,6 +107,11 @@ func (ah *AuthHandler) SSEHandler(c echo.Context) error {
 			}
 			c.Response().Flush()
 
+		case <-client.Disconnect:
+			// Dropped by the broadcaster for falling behind; the browser
+			// reconnects and receives a fresh state snapshot
+			return nil
+
 		case <-c.Request().Context().Done():
 			// Client disconnected
 			return nil
@@ -106,38 +119,78 @@ func (ah *AuthHandler) SSEHandler(c echo.Context) error {
 	}
 }
 
+// eventChannel is the channel a client receives besides the global one:
+// the admin channel for admins, its team's channel for a team, none when
+// not signed in
+func eventChannel(c echo.Context) int {
+	if isAdminSession(c) || c.Get("ISADMIN") == true {
+		return services.AdminChannel
+	}
+	teamID, _ := c.Get(user_id_key).(int)
+	return teamID
+}
+
+// eventHunt is the hunt whose events a client receives: the one a
+// spectator watches, or the one the request plays in
+func (ah *AuthHandler) eventHunt(c echo.Context) int {
+	if huntID, ok := c.Get(spectator_hunt_key).(int); ok {
+		return huntID
+	}
+	huntID, err := ah.requestHunt(c)
+	if err != nil {
+		return services.DefaultHuntID
+	}
+	return huntID
+}
+
 // generateETag creates a hash for the given data
 func generateETag(data interface{}) string {
 	jsonData, _ := json.Marshal(data)
 	hash := sha256.Sum256(jsonData)
-	return hex.EncodeToString(hash[:])
+	return `"` + hex.EncodeToString(hash[:]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
 }
 
-// GetLockedQuestions returns JSON of all currently locked questions
+// writeJSONWithETag sends data as JSON tagged with a hash of it, or an
+// empty 304 when the client already holds that version, so polling
+// clients only download what changed
+func writeJSONWithETag(c echo.Context, data interface{}, cacheControl string) error {
+	etag := generateETag(data)
+	c.Response().Header().Set("ETag", etag)
+	c.Response().Header().Set("Cache-Control", cacheControl)
+
+	if etagMatches(c.Request().Header.Get("If-None-Match"), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.JSON(http.StatusOK, data)
+}
+
+// GetLockedQuestions returns JSON of all currently locked questions of the
+// team's hunt
 // Now includes ETag support for conditional GET requests
 func (ah *AuthHandler) GetLockedQuestionsAPI(c echo.Context) error {
-	locks, err := ah.UserServices.GetAllLockedQuestions()
+	huntID, err := ah.requestHunt(c)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to fetch locked questions",
-		})
+		return jsonError(c, http.StatusInternalServerError, "Failed to fetch locked questions", nil)
 	}
 
-	// Generate ETag for the current state
-	etag := generateETag(locks)
-	
-	// Check if client has the same ETag
-	clientETag := c.Request().Header.Get("If-None-Match")
-	if clientETag == etag {
-		return c.NoContent(http.StatusNotModified)
+	locks, err := ah.UserServices.GetAllLockedQuestions(c.Request().Context(), huntID)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Failed to fetch locked questions", nil)
 	}
-	
-	// Set caching headers
-	c.Response().Header().Set("ETag", etag)
-	c.Response().Header().Set("Cache-Control", "public, max-age=5") // 5 second cache
-	c.Response().Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
 
-	return c.JSON(http.StatusOK, locks)
+	// Each hunt has its own locks, so shared caches mustn't keep them
+	return writeJSONWithETag(c, locks, "private, max-age=5") // 5 second cache
 }
 
 // GetQuestionStatus returns JSON of a specific question's status (locked/unlocked)
@@ -146,16 +199,12 @@ func (ah *AuthHandler) GetQuestionStatusAPI(c echo.Context) error {
 	
 	var id int
 	if _, err := fmt.Sscanf(questionID, "%d", &id); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid question ID",
-		})
+		return jsonError(c, http.StatusBadRequest, "Invalid question ID", nil)
 	}
 
-	isLocked, lockInfo, err := ah.UserServices.IsQuestionLocked(id)
+	isLocked, lockInfo, err := ah.UserServices.IsQuestionLocked(c.Request().Context(), id)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to check question status",
-		})
+		return jsonError(c, http.StatusInternalServerError, "Failed to check question status", nil)
 	}
 
 	if isLocked {
@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// JSON API for headless clients, covering the same player flow as the
+// /hunt pages. Authentication uses the same session cookie, obtained from
+// POST /api/v1/login
+
+// apiTeam is the signed-in team as exposed by the API
+type apiTeam struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Points   int    `json:"points"`
+	Penalty  int    `json:"penalty"`
+}
+
+// apiQuestionSummary is a question in the hunt list, without its answer
+type apiQuestionSummary struct {
+	ID             int     `json:"id"`
+	Title          string  `json:"title"`
+	Points         int     `json:"points"`
+	Category       string  `json:"category,omitempty"`
+	Weight         float64 `json:"weight"`
+	Worth          int     `json:"worth"`
+	Solved         bool    `json:"solved"`
+	SolvedByAnyone bool    `json:"solved_by_anyone"`
+	Locked         bool    `json:"locked"`
+	LockedByMe     bool    `json:"locked_by_me"`
+	LockedByName   string  `json:"locked_by_name,omitempty"`
+	Skipped        bool    `json:"skipped"`
+	Checkpoint     string  `json:"checkpoint,omitempty"`
+	Scanned        bool    `json:"scanned,omitempty"`
+}
+
+// apiHint is a hint whose text is only included once the team owns it
+type apiHint struct {
+	ID       int    `json:"id"`
+	Worth    int    `json:"worth"`
+	Unlocked bool   `json:"unlocked"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// apiQuestion is an opened question with everything the question page shows
+type apiQuestion struct {
+	ID           int                        `json:"id"`
+	Title        string                     `json:"title"`
+	Question     string                     `json:"question"`
+	Points       int                        `json:"points"`
+	Category     string                     `json:"category,omitempty"`
+	Weight       float64                    `json:"weight"`
+	Worth        int                        `json:"worth"`
+	Solved       bool                       `json:"solved"`
+	Skipped      bool                       `json:"skipped"`
+	Media        map[string][]string        `json:"media"`
+	Hints        []apiHint                  `json:"hints"`
+	WrongAnswers int                        `json:"wrong_answers"`
+	AttemptsLeft int                        `json:"attempts_left"`
+	Shields      int                        `json:"shields"`
+	RetryAfter   int                        `json:"retry_after,omitempty"`
+	Penalty      int                        `json:"penalty"`
+	Answer       string                     `json:"answer,omitempty"`   // only once solutions are revealed
+	Solution     string                     `json:"solution,omitempty"` // only once solutions are revealed
+	Attempts     []apiAttempt               `json:"attempts"`
+	Geofenced    bool                       `json:"geofenced,omitempty"` // answers need a location proof
+	AnswerType   string                     `json:"answer_type"`
+	Photos       []services.PhotoSubmission `json:"photos,omitempty"` // the team's photos for a photo question
+}
+
+// apiAttempt is one of the team's answers to a question; only wrong
+// answers keep their text
+type apiAttempt struct {
+	Answer    string    `json:"answer,omitempty"`
+	Correct   bool      `json:"correct"`
+	Penalty   int       `json:"penalty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// apiQuota is the team's usage of the current quota window
+type apiQuota struct {
+	QuestionsSolved int       `json:"questions_solved"`
+	Limit           int       `json:"limit"`
+	SlotStart       time.Time `json:"slot_start"`
+	ResetsIn        int       `json:"resets_in_seconds"`
+	Enabled         bool      `json:"enabled"` // false while the quotas flag is off
+}
+
+// apiError answers with the JSON error envelope, using the status of a
+// playError; the text of server errors is logged rather than returned
+func apiError(c echo.Context, err error) error {
+	var pe *playError
+	if errors.As(err, &pe) && pe.Status < 500 {
+		return jsonError(c, pe.Status, pe.Message, nil)
+	}
+
+	status := http.StatusInternalServerError
+	if pe != nil {
+		status = pe.Status
+	}
+	logServerError(c, err)
+	return jsonError(c, status, "Internal server error", nil)
+}
+
+// APILogin signs a team in and sets the session cookie
+func (ah *AuthHandler) APILogin(c echo.Context) error {
+	var req struct {
+		Email    string `json:"email" form:"email"`
+		Password string `json:"password" form:"password"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid request", nil)
+	}
+
+	user, err := ah.UserServices.CheckEmail(c.Request().Context(), req.Email)
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		return jsonError(c, http.StatusUnauthorized, "Invalid email or password", nil)
+	}
+	if suspended, _ := ah.UserServices.IsTeamSuspended(c.Request().Context(), user.ID); suspended {
+		return apiError(c, errTeamSuspended)
+	}
+
+	startSession(c, user, c.Request().Header.Get("X-Timezone"))
+	ah.UserServices.RecordLogin(c.Request().Context(), user.ID, c.RealIP())
+	ah.UserServices.TeamWindow(c.Request().Context(), user.ID)
+
+	return c.JSON(http.StatusOK, apiTeam{
+		ID:       user.ID,
+		Username: user.Username,
+		Points:   user.Points,
+	})
+}
+
+// APILogout ends the session
+func (ah *AuthHandler) APILogout(c echo.Context) error {
+	endSession(c)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// teamProfile loads the team as exposed by the API
+func (ah *AuthHandler) teamProfile(ctx context.Context, teamID int, teamName string) (apiTeam, error) {
+	user, err := ah.UserServices.CheckUsername(ctx, teamName)
+	if err != nil {
+		return apiTeam{}, err
+	}
+
+	penalty, err := ah.UserServices.GetTotalPenalty(ctx, teamID)
+	if err != nil {
+		return apiTeam{}, err
+	}
+
+	return apiTeam{
+		ID:       teamID,
+		Username: user.Username,
+		Points:   user.Points,
+		Penalty:  penalty,
+	}, nil
+}
+
+// questionSummaries lists every question with the team's status on it
+func (ah *AuthHandler) questionSummaries(ctx context.Context, teamID int) ([]apiQuestionSummary, error) {
+	if err := ah.checkHuntOpen(ctx, teamID, false); err != nil {
+		return nil, err
+	}
+
+	huntID, err := ah.teamHunt(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	questions, err := ah.UserServices.GetAllQuestionsWithStatus(ctx, huntID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]apiQuestionSummary, 0, len(questions))
+	for _, q := range questions {
+		list = append(list, apiQuestionSummary{
+			ID:             q.ID,
+			Title:          q.Title,
+			Points:         q.Points,
+			Category:       q.Category,
+			Weight:         q.Weight,
+			Worth:          services.WeightedPoints(q.Points, q.Weight),
+			Solved:         q.Solved,
+			SolvedByAnyone: q.SolvedByAnyone,
+			Locked:         q.Locked,
+			LockedByMe:     q.LockedByMe,
+			LockedByName:   q.LockedByName,
+			Skipped:        q.Skipped,
+			Checkpoint:     q.Checkpoint,
+			Scanned:        q.Scanned,
+		})
+	}
+
+	return list, nil
+}
+
+// teamQuota loads the team's usage of the current quota window
+func (ah *AuthHandler) teamQuota(ctx context.Context, teamID int) (apiQuota, error) {
+	slot, err := ah.UserServices.GetQuotaSlot(ctx, teamID)
+	if err != nil {
+		return apiQuota{}, err
+	}
+
+	remaining, err := ah.UserServices.GetTimeUntilQuotaReset(ctx, teamID)
+	if err != nil {
+		return apiQuota{}, err
+	}
+
+	return apiQuota{
+		QuestionsSolved: slot.QuestionsSolvedInSlot,
+		Limit:           services.QuotaLimit,
+		SlotStart:       slot.CurrentSlotStart,
+		ResetsIn:        int(remaining.Seconds()),
+		Enabled:         ah.UserServices.FlagEnabled(ctx, services.FlagQuotas),
+	}, nil
+}
+
+// APIMe returns the signed-in team
+func (ah *AuthHandler) APIMe(c echo.Context) error {
+	team, err := ah.teamProfile(c.Request().Context(), c.Get(user_id_key).(int), c.Get(user_name_key).(string))
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, team)
+}
+
+// APIQuestions lists every question with the team's status on it
+func (ah *AuthHandler) APIQuestions(c echo.Context) error {
+	teamID := c.Get(user_id_key).(int)
+
+	list, err := ah.questionSummaries(c.Request().Context(), teamID)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	hasCompleted, err := ah.completedAll(c.Request().Context(), teamID)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	// Every team sees its own list, so only the browser may keep it
+	return writeJSONWithETag(c, map[string]interface{}{
+		"questions":        list,
+		"completed_all":    hasCompleted,
+		"skip_tokens_left": ah.skipTokensLeft(c.Request().Context(), teamID),
+	}, "private, no-cache")
+}
+
+// APIQuestion opens a question, locking it for the team like the question page does
+func (ah *AuthHandler) APIQuestion(c echo.Context) error {
+	lvl, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid question ID"))
+	}
+
+	teamID := c.Get(user_id_key).(int)
+	qs, err := ah.loadQuestion(c.Request().Context(), teamID, lvl)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if err := ah.openQuestion(c.Request().Context(), teamID, c.Get(user_name_key).(string), qs); err != nil {
+		return apiError(c, err)
+	}
+
+	return ah.writeAPIQuestion(c, teamID, qs)
+}
+
+// writeAPIQuestion renders an opened question, hiding the text of hints the team hasn't bought
+func (ah *AuthHandler) writeAPIQuestion(c echo.Context, teamID int, qs *questionState) error {
+	hints := make([]apiHint, 0, len(qs.Hints))
+	for _, h := range qs.Hints {
+		unlocked, err := ah.UserServices.HasTeamUnlockedHint(c.Request().Context(), teamID, h.ID)
+		if err != nil {
+			return apiError(c, err)
+		}
+		hint := apiHint{ID: h.ID, Worth: h.Worth, Unlocked: unlocked}
+		if unlocked {
+			hint.Hint = h.Hint
+		}
+		hints = append(hints, hint)
+	}
+
+	weight := ah.UserServices.GetCategoryWeights(c.Request().Context()).For(qs.Question.Category)
+	question := apiQuestion{
+		ID:         qs.Question.ID,
+		Title:      qs.Question.Title,
+		Question:   qs.Question.Question,
+		Points:     qs.Question.Points,
+		Category:   qs.Question.Category,
+		Weight:     weight,
+		Worth:      services.WeightedPoints(qs.Question.Points, weight),
+		Solved:     qs.Completed,
+		Skipped:    qs.Skipped,
+		Geofenced:  qs.Geofence != nil,
+		AnswerType: qs.Question.AnswerType,
+		Media:      qs.Media,
+		Hints:      hints,
+		Attempts:   make([]apiAttempt, 0),
+	}
+	if qs.Revealed {
+		question.Answer = qs.Question.RevealAnswer
+		question.Solution = qs.Question.Solution
+	}
+
+	if attempts, err := ah.UserServices.GetQuestionAttempts(c.Request().Context(), teamID, qs.Question.ID); err == nil && attempts != nil {
+		question.WrongAnswers = attempts.WrongAttempts
+		question.AttemptsLeft = services.AttemptsLeft(*attempts)
+		question.Shields = attempts.Shields
+		question.RetryAfter = services.CooldownSeconds(services.CooldownLeft(qs.Question, *attempts, time.Now()))
+		question.Penalty = attempts.TotalPenalty
+	}
+	if history, err := ah.UserServices.GetTeamSubmissions(c.Request().Context(), teamID, qs.Question.ID); err == nil {
+		for _, s := range history {
+			question.Attempts = append(question.Attempts, apiAttempt{Answer: s.Answer, Correct: s.Correct, Penalty: s.Penalty, CreatedAt: s.CreatedAt})
+		}
+	}
+	if qs.Question.AnswerType == services.AnswerPhoto {
+		photos, err := ah.UserServices.GetTeamPhotoSubmissions(c.Request().Context(), teamID, qs.Question.ID)
+		if err != nil {
+			return apiError(c, err)
+		}
+		question.Photos = photos
+	}
+
+	return c.JSON(http.StatusOK, question)
+}
+
+// APISubmitAnswer checks an answer to a question
+func (ah *AuthHandler) APISubmitAnswer(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "Admin cannot solve questions"))
+	}
+
+	lvl, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid question ID"))
+	}
+
+	var req struct {
+		Answer   string `json:"answer" form:"answer"`
+		Location string `json:"location" form:"location"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	teamID := c.Get(user_id_key).(int)
+	qs, err := ah.loadQuestion(c.Request().Context(), teamID, lvl)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	result, err := ah.submitAnswer(c.Request().Context(), teamID, c.Get(user_name_key).(string), qs, req.Answer, req.Location, c.RealIP())
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// APIUnlockHint buys a hint, charging its worth the first time
+func (ah *AuthHandler) APIUnlockHint(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid hint ID"))
+	}
+
+	hint, alreadyOwned, err := ah.buyHint(c.Request().Context(), c.Get(user_id_key).(int), c.Get(user_name_key).(string), id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"id":            id,
+		"hint":          hint,
+		"already_owned": alreadyOwned,
+	})
+}
+
+// APILeaderboard returns the ranked teams of the team's hunt
+func (ah *AuthHandler) APILeaderboard(c echo.Context) error {
+	huntID, err := ah.requestHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	teamName, _ := c.Get(user_name_key).(string)
+	users, err := ah.UserServices.GetTeamLeaderboard(c.Request().Context(), huntID, teamName)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if users == nil {
+		users = []services.LeaderBoardUser{}
+	}
+
+	return writeJSONWithETag(c, users, "private, no-cache")
+}
+
+// APIQuota returns the team's usage of the current quota window
+func (ah *AuthHandler) APIQuota(c echo.Context) error {
+	quota, err := ah.teamQuota(c.Request().Context(), c.Get(user_id_key).(int))
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, quota)
+}
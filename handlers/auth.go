@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"errors"
+	"io"
 	"log"
 	"net/http"
 	"net/mail"
@@ -30,91 +32,367 @@ const theme string = "gray"
 const accent string = "blue"
 
 type AuthService interface {
-	CreateUser(u services.User) error
-	CheckEmail(email string) (services.User, error)
-	CheckUsername(usr string) (services.User, error)
+	CreateUser(ctx context.Context, u services.User) error
+	CheckEmail(ctx context.Context, email string) (services.User, error)
+	CheckUsername(ctx context.Context, usr string) (services.User, error)
 
-	GetAllUsers() ([]services.User, error)
-	DeleteTeam(id int) error
+	GetAllUsers(ctx context.Context, huntID int) ([]services.User, error)
+	DeleteTeam(ctx context.Context, id int) error
 
-	GetAllQuestions() ([]services.Question, error)
-	DeleteQuestion(id int) error
+	GetAllQuestions(ctx context.Context, huntID int) ([]services.Question, error)
+	DeleteQuestion(ctx context.Context, id int) error
 	MakeArray(label string, form *multipart.Form, short string) (list []string, err error)
-	CreateQuestion(q services.Question, images []string, video []string, audio []string) error
-	CreateMedia(ID int, images []string, videos []string, audios []string) error
-	GetQuestionById(id int) (services.Question, error)
-	UpdateQuestion(id int, title string, question string, points int, answer string) error
-	GetAllQuestionsWithStatus(userID int) ([]services.QuestionWithStatus, error)
-	HasCompletedAllQuestions(userID int) (bool, error)
-	IsQuestionSolvedByTeam(teamID, questionID int) (bool, error)
-	GetMediaByQuestionId(id int) (map[string][]string, error)
-	MarkQuestionAsCompleted(userID, questionID int) error
-	AddPointsToTeam(teamID int, points int) error
-	UpdateTeamLastAnsweredQuestion(teamID int) error
-
-	GetHints() ([]services.Hint, error)
-	CreateHint(h services.Hint) error
-	DeleteHint(id int) error
-	GetHintsByQuestionID(questionID int) ([]services.Hint, error)
-	GetHintById(id int) (string, int, error)
-	HasTeamUnlockedHint(teamID int, hintID int) (bool, error)
-	UnlockHintForTeam(teamID int, hintID int, worth int) error
-	GetLeaderbaord() ([]services.LeaderBoardUser, error)
+	MaxUploadSize(slot string) int64
+	CreateQuestion(ctx context.Context, q services.Question, images []string, video []string, audio []string) (int, error)
+	CreateMedia(ctx context.Context, ID int, images []string, videos []string, audios []string) error
+	GetQuestionById(ctx context.Context, id int) (services.Question, error)
+	UpdateQuestion(ctx context.Context, id int, title string, question string, points int, answer string, revealAnswer string, solution string, flagTemplate string, cooldown int, answerType string, category string) error
+	GetAllQuestionsWithStatus(ctx context.Context, huntID, userID int) ([]services.QuestionWithStatus, error)
+	HasCompletedAllQuestions(ctx context.Context, huntID, userID int) (bool, error)
+	IsQuestionSolvedByTeam(ctx context.Context, teamID, questionID int) (bool, error)
+	GetMediaByQuestionId(ctx context.Context, id int) (map[string][]string, error)
+	GetMediaForQuestions(ctx context.Context, ids []int) (map[int]map[string][]string, error)
+	MarkQuestionAsCompleted(ctx context.Context, userID, questionID, points int) error
+	AddPointsToTeam(ctx context.Context, teamID int, points int) error
+	RecordSolve(ctx context.Context, teamID, questionID, points int) (services.Solve, error)
+	UpdateTeamLastAnsweredQuestion(ctx context.Context, teamID int) error
+
+	GetHints(ctx context.Context, huntID int) ([]services.Hint, error)
+	CreateHint(ctx context.Context, h services.Hint) (int, error)
+	UpdateHint(ctx context.Context, h services.Hint) error
+	DeleteHint(ctx context.Context, id int) error
+	GetHintsByQuestionID(ctx context.Context, questionID int) ([]services.Hint, error)
+	GetHintById(ctx context.Context, id int) (string, int, error)
+	GetHintHuntID(ctx context.Context, id int) (int, error)
+	HasTeamUnlockedHint(ctx context.Context, teamID int, hintID int) (bool, error)
+	UnlockHintForTeam(ctx context.Context, teamID int, hintID int, worth int) error
+	GetLeaderbaord(ctx context.Context, huntID int) ([]services.LeaderBoardUser, error)
+	SetTeamAvatar(ctx context.Context, teamID int, filename string, size int64, r io.ReadSeeker) error
+	RemoveTeamAvatar(ctx context.Context, teamID int) error
+	OpenAvatar(ctx context.Context, key string) (io.ReadSeekCloser, services.ObjectInfo, error)
+	GetTeamProfile(ctx context.Context, name, viewer string) (services.TeamProfile, error)
+	GetTeamLeaderboard(ctx context.Context, huntID int, teamName string) ([]services.LeaderBoardUser, error)
 
 	// Question locking methods
-	LockQuestion(questionID int, teamID int) error
-	UnlockQuestion(questionID int) error
-	IsQuestionLocked(questionID int) (bool, *services.QuestionLock, error)
-	IsQuestionSolvedByAnyone(questionID int) (bool, error)
-	GetAllLockedQuestions() ([]services.QuestionLock, error)
+	LockQuestion(ctx context.Context, questionID int, teamID int) error
+	UnlockQuestion(ctx context.Context, questionID int) error
+	IsQuestionLocked(ctx context.Context, questionID int) (bool, *services.QuestionLock, error)
+	IsQuestionSolvedByAnyone(ctx context.Context, questionID int) (bool, error)
+	GetAllLockedQuestions(ctx context.Context, huntID int) ([]services.QuestionLock, error)
 
 	// Timer methods
-	StartQuestionTimer(teamID int, questionID int) error
-	StopQuestionTimer(teamID int, questionID int) error
-	GetTotalSolveTime(teamID int) (int, error)
-	GetQuestionSolveTime(teamID int, questionID int) (int, error)
+	StartQuestionTimer(ctx context.Context, teamID int, questionID int) error
+	StopQuestionTimer(ctx context.Context, teamID int, questionID int) error
+	GetTotalSolveTime(ctx context.Context, teamID int) (int, error)
+	GetQuestionSolveTime(ctx context.Context, teamID int, questionID int) (int, error)
 
 	// Attempt and penalty methods
-	GetQuestionAttempts(teamID int, questionID int) (*services.QuestionAttempt, error)
-	RecordWrongAttempt(teamID int, questionID int, questionPoints int) (int, int, error)
-	IsQuestionExhausted(teamID int, questionID int) (bool, error)
-	GetTotalPenalty(teamID int) (int, error)
-	DeductPenaltyPoints(teamID int, penalty int) error
+	GetQuestionAttempts(ctx context.Context, teamID int, questionID int) (*services.QuestionAttempt, error)
+	RecordWrongAttempt(ctx context.Context, teamID int, questionID int, questionPoints int) (int, int, error)
+	IsQuestionExhausted(ctx context.Context, teamID int, questionID int) (bool, error)
+	GetTotalPenalty(ctx context.Context, teamID int) (int, error)
+	DeductPenaltyPoints(ctx context.Context, teamID int, penalty int) error
+
+	// Streak bonus methods
+	GetStreakBonus(ctx context.Context) services.StreakBonus
+	SetStreakBonus(ctx context.Context, b services.StreakBonus) error
+	GetCategoryWeights(ctx context.Context) services.CategoryWeights
+	SetCategoryWeights(ctx context.Context, w services.CategoryWeights) error
+	QuestionWorth(ctx context.Context, q services.Question) int
+	GetTeamStreak(ctx context.Context, teamID int) (int, error)
+
+	// Power-up store methods
+	GetPowerUps(ctx context.Context) ([]services.PowerUp, error)
+	SetPowerUp(ctx context.Context, p services.PowerUp) error
+	GetStore(ctx context.Context, teamID int) ([]services.StoreItem, []services.TeamPowerUp, error)
+	BuyPowerUp(ctx context.Context, teamID int, kind string) (services.PowerUp, error)
+	UsePowerUp(ctx context.Context, teamID int, kind string, questionID int) error
+
+	// Skip token methods
+	GetSkipTokens(ctx context.Context) int
+	SetSkipTokens(ctx context.Context, n int) error
+	SkipTokensLeft(ctx context.Context, teamID int) (int, error)
+	IsQuestionSkippedByTeam(ctx context.Context, teamID, questionID int) (bool, error)
+	SkipQuestion(ctx context.Context, teamID, questionID int) (int, error)
+
+	// Question feedback methods
+	CanRateQuestion(ctx context.Context, teamID, questionID int) (bool, error)
+	SubmitFeedback(ctx context.Context, teamID, questionID, difficulty, fun int, comment string) (services.QuestionFeedback, error)
+	GetTeamFeedback(ctx context.Context, teamID, questionID int) (*services.QuestionFeedback, error)
+	GetFeedbackReport(ctx context.Context, huntID int) ([]services.FeedbackReport, error)
+
+	// Email methods
+	MailEnabled() bool
+	GetRecentEmails(ctx context.Context, limit int) ([]services.Email, error)
+	SendTestEmail(ctx context.Context, to string) error
+	QueueAnnouncementEmails(ctx context.Context, title, message, link string) (int, error)
+	SendVerificationEmail(ctx context.Context, teamID int) error
+	VerifyEmail(ctx context.Context, token string) error
+	IsEmailVerified(ctx context.Context, teamID int) (bool, error)
+	GetEmailTemplates(ctx context.Context) ([]services.EmailTemplate, error)
+	SetEmailTemplate(ctx context.Context, name, subject, body string) error
+	ResetEmailTemplate(ctx context.Context, name string) error
+	SendEmailPreview(ctx context.Context, to, name, subject, body string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+
+	// Telegram methods
+	NewTelegramLinkCode(ctx context.Context, teamID int) (string, error)
+	LinkTelegramChat(ctx context.Context, code string, chatID int64, username string) (services.TelegramChat, error)
+	GetTelegramChat(ctx context.Context, chatID int64) (services.TelegramChat, error)
+	GetTelegramChats(ctx context.Context, teamID int) ([]services.TelegramChat, error)
+	UnlinkTelegramChat(ctx context.Context, chatID int64) error
+	UnlinkTeamTelegram(ctx context.Context, teamID int) error
+
+	// SMS methods
+	SMSEnabled() bool
+	GetRecentSMS(ctx context.Context, limit int) ([]services.SMS, error)
+	SendTestSMS(ctx context.Context, to string) error
+	QueueAnnouncementSMS(ctx context.Context, title, message, link string) (int, error)
+	GetTeamPhone(ctx context.Context, teamID int) (services.TeamPhone, error)
+	RequestPhoneCode(ctx context.Context, teamID int, phone string) error
+	ConfirmTeamPhone(ctx context.Context, teamID int, code string) error
+	RemoveTeamPhone(ctx context.Context, teamID int) error
+
+	// Clarification methods
+	AskClarification(ctx context.Context, teamID, questionID int, body string) (services.Clarification, error)
+	GetQuestionClarifications(ctx context.Context, teamID, questionID int) ([]services.Clarification, error)
+	GetClarifications(ctx context.Context, huntID int, answered bool) ([]services.Clarification, error)
+	AnswerClarification(ctx context.Context, id int, answer string, public bool) (services.Clarification, error)
+
+	// Spectator methods
+	CreateSpectator(ctx context.Context, name, email, password string, huntID int) (services.Spectator, error)
+	GetSpectator(ctx context.Context, id int) (services.Spectator, error)
+	GetSpectatorByEmail(ctx context.Context, email string) (services.Spectator, error)
+	GetSpectators(ctx context.Context, huntID int) ([]services.Spectator, error)
+	DeleteSpectator(ctx context.Context, id int) error
+	GetSpectatorQuestions(ctx context.Context, huntID int) ([]services.SpectatorQuestion, error)
 
 	// Quota management methods
-	GetQuotaSlot(teamID int) (*services.QuotaSlot, error)
-	CreateQuotaSlot(teamID int) (*services.QuotaSlot, error)
-	ResetQuotaSlot(teamID int) (*services.QuotaSlot, error)
-	IncrementQuotaCount(teamID int) error
-	CanSolveQuestion(teamID int) (bool, *services.QuotaSlot, error)
-	GetTimeUntilQuotaReset(teamID int) (time.Duration, error)
-	GetActualCompletedQuestionsCount(teamID int) (int, error)
+	GetQuotaSlot(ctx context.Context, teamID int) (*services.QuotaSlot, error)
+	CreateQuotaSlot(ctx context.Context, teamID int) (*services.QuotaSlot, error)
+	ResetQuotaSlot(ctx context.Context, teamID int) (*services.QuotaSlot, error)
+	IncrementQuotaCount(ctx context.Context, teamID int) error
+	CanSolveQuestion(ctx context.Context, teamID int) (bool, *services.QuotaSlot, error)
+	GetTimeUntilQuotaReset(ctx context.Context, teamID int) (time.Duration, error)
+	GetActualCompletedQuestionsCount(ctx context.Context, teamID int) (int, error)
 
 	// Admin methods
-	AdminUnlockQuestion(questionID int) error
-	GetSolvedQuestions() ([]services.QuestionWithSolvers, error)
-	GetAllSolvedQuestions() ([]services.SolvedQuestionInfo, error)
-	UnlockSolvedQuestion(questionID int, teamID int) error
-	UnlockAllSolvedQuestions(questionID int) error
-
-	GetMedia(query string, args ...interface{}) ([]string, error)
-	GetIdByPath(path string, table string) (int, error)
-	DeleteMedia(id int, table string) error
+	AdminUnlockQuestion(ctx context.Context, questionID int) error
+	GetSolvedQuestions(ctx context.Context, huntID int) ([]services.QuestionWithSolvers, error)
+	GetAllSolvedQuestions(ctx context.Context, huntID int) ([]services.SolvedQuestionInfo, error)
+	UnlockSolvedQuestion(ctx context.Context, questionID int, teamID int) error
+	UnlockAllSolvedQuestions(ctx context.Context, questionID int) error
+	RegradeSolve(ctx context.Context, teamID, questionID, points int) (int, error)
+	ExportTeamData(ctx context.Context, teamID int, internal bool) (services.TeamExport, error)
+	GetRetentionPolicy(ctx context.Context) services.RetentionPolicy
+	SetRetentionPolicy(ctx context.Context, p services.RetentionPolicy) error
+	PurgeRetained(ctx context.Context, huntID int, dryRun bool) (services.RetentionReport, error)
+
+	UpdateMediaDetails(ctx context.Context, table string, questionID, id, position int, caption string) error
+	GetIdByPath(ctx context.Context, path string, table string) (int, error)
+	DeleteMedia(ctx context.Context, id int, table string) error
+	CreateAttachments(ctx context.Context, questionID int, keys, names []string) error
+	GetAttachmentName(ctx context.Context, key string) (string, error)
+	MediaURL(key string) string
+	GetMediaQuestionIDs(ctx context.Context, key string) ([]int, error)
+	OpenMedia(key string) (io.ReadSeekCloser, services.ObjectInfo, error)
+	PresignMediaUpload(kind, filename string) (key string, url string, err error)
+	ConfirmMediaUpload(ctx context.Context, questionID int, kind, key, filename string) error
+	CreateChunkedUpload(ctx context.Context, questionID int, kind, filename string, size int64) (services.ChunkedUpload, error)
+	GetChunkedUpload(ctx context.Context, id string) (services.ChunkedUpload, error)
+	AppendChunk(ctx context.Context, id string, offset int64, r io.Reader) (services.ChunkedUpload, string, error)
+
+	// Notification methods
+	CreateNotification(ctx context.Context, n services.Notification) (services.Notification, error)
+	GetNotificationsForTeam(ctx context.Context, teamID int, limit int) ([]services.Notification, error)
+	GetUnreadNotificationCount(ctx context.Context, teamID int) (int, error)
+	MarkNotificationsRead(ctx context.Context, teamID int) error
+
+	// Announcement methods
+	CreateAnnouncement(ctx context.Context, a services.Announcement) (services.Announcement, error)
+	GetAnnouncements(ctx context.Context, publicOnly bool) ([]services.Announcement, error)
+	UpdateAnnouncement(ctx context.Context, id int, pinned, public bool) error
+	DeleteAnnouncement(ctx context.Context, id int) error
+
+	// Page methods
+	GetPages(ctx context.Context) ([]services.Page, error)
+	GetPage(ctx context.Context, id int) (services.Page, error)
+	RenderPage(ctx context.Context, slug string, drafts bool) (services.RenderedPage, error)
+	SavePage(ctx context.Context, p services.Page) (services.Page, error)
+	DeletePage(ctx context.Context, id int) error
+
+	// Rules methods
+	Rules(ctx context.Context) (services.RenderedPage, error)
+	RulesPending(ctx context.Context, teamID int) (bool, error)
+	AcceptRules(ctx context.Context, teamID int, ip string) error
+	GetRulesAcceptance(ctx context.Context, teamID int) (*services.RulesAcceptance, error)
+	GetRulesAcceptances(ctx context.Context, huntID int) ([]services.RulesAcceptance, error)
+
+	// Branding methods
+	GetBranding(ctx context.Context) services.Branding
+	SetBranding(ctx context.Context, b services.Branding) error
+	SetLogo(ctx context.Context, filename string, size int64, r io.ReadSeeker) error
+	RemoveLogo(ctx context.Context) error
+	OpenLogo(ctx context.Context, key string) (io.ReadSeekCloser, services.ObjectInfo, error)
+
+	// Checkpoint methods
+	SetCheckpoint(ctx context.Context, questionID int, mode string, perTeam bool) error
+	RotateCheckpoint(ctx context.Context, questionID int) error
+	GetCheckpoint(ctx context.Context, questionID int) (*services.Checkpoint, error)
+	GetCheckpoints(ctx context.Context, huntID int) ([]services.Checkpoint, error)
+	GetCheckpointScans(ctx context.Context, questionID int) ([]services.CheckpointScan, error)
+	CheckpointScanned(ctx context.Context, teamID, questionID int) (bool, error)
+	CheckCheckpoint(ctx context.Context, teamID int, token string) (services.Checkpoint, error)
+	ScanCheckpoint(ctx context.Context, teamID int, token string) (services.Checkpoint, error)
+
+	// Geofence methods
+	SetGeofence(ctx context.Context, questionID int, lat, lng float64, radius int) error
+	RemoveGeofence(ctx context.Context, questionID int) error
+	GetGeofence(ctx context.Context, questionID int) (*services.Geofence, error)
+	ProveLocation(teamID int, g services.Geofence, lat, lng, accuracy float64) (services.LocationProof, error)
+	CheckLocationProof(teamID int, g services.Geofence, proof string) error
+
+	// Web Push methods
+	SavePushSubscription(ctx context.Context, s services.PushSubscription) error
+	DeletePushSubscription(ctx context.Context, endpoint string) error
+
+	// Chat methods
+	PostChatMessage(ctx context.Context, teamID int, channel int, body string) (services.ChatMessage, error)
+	GetChatMessages(ctx context.Context, huntID, channel, limit int) ([]services.ChatMessage, error)
+	GetRecentChatMessages(ctx context.Context, huntID, limit int) ([]services.ChatMessage, error)
+	DeleteChatMessage(ctx context.Context, id int) (services.ChatMessage, error)
+	MuteTeam(ctx context.Context, teamID int) error
+	UnmuteTeam(ctx context.Context, teamID int) error
+	IsTeamMuted(ctx context.Context, teamID int) (bool, error)
+	GetMutedTeams(ctx context.Context) (map[int]bool, error)
+
+	// Webhook methods
+	CreateWebhook(ctx context.Context, w services.Webhook) error
+	GetWebhooks(ctx context.Context) ([]services.Webhook, error)
+	DeleteWebhook(ctx context.Context, id int) error
+	QueueWebhookEvent(ctx context.Context, event string, data map[string]interface{}) error
+	GetRecentWebhookDeliveries(ctx context.Context, limit int) ([]services.WebhookDelivery, error)
+	GetDiscordTemplates(ctx context.Context) ([]services.DiscordTemplate, error)
+	SetDiscordTemplate(ctx context.Context, event, text string) error
+
+	// Admin API token methods
+	CreateAdminAPIToken(ctx context.Context, name string) (string, error)
+	GetAdminAPITokens(ctx context.Context) ([]services.AdminAPIToken, error)
+	DeleteAdminAPIToken(ctx context.Context, id int) error
+	CheckAdminAPIToken(ctx context.Context, token string) (bool, error)
+
+	// Feature flag methods
+	FlagEnabled(ctx context.Context, key string) bool
+	GetFeatureFlags(ctx context.Context) ([]services.FeatureFlag, error)
+	SetFeatureFlag(ctx context.Context, key string, enabled bool) error
+
+	// Hunt window methods
+	GetHuntWindow(ctx context.Context, huntID int) services.HuntWindow
+	SetHuntWindow(ctx context.Context, huntID int, w services.HuntWindow) error
+	ResetHuntWindow(ctx context.Context, huntID int) error
+	GetEmailPolicy(ctx context.Context) services.EmailPolicy
+	SetEmailPolicy(ctx context.Context, p services.EmailPolicy) (services.EmailPolicy, error)
+	GetRegistrationLimit(ctx context.Context) services.RegistrationLimit
+	SetRegistrationLimit(ctx context.Context, l services.RegistrationLimit) error
+	RegistrationFull(ctx context.Context, huntID int) (bool, error)
+	TeamWindow(ctx context.Context, teamID int) services.HuntWindow
+	SolutionsRevealed(ctx context.Context, teamID int) bool
+	SetTeamStart(ctx context.Context, teamID int, at time.Time) error
+	GetFinalResults(ctx context.Context, huntID int) ([]services.HuntResult, error)
+
+	// Hunt methods
+	GetHunts(ctx context.Context) ([]services.Hunt, error)
+	GetHunt(ctx context.Context, id int) (services.Hunt, error)
+	GetHuntBySlug(ctx context.Context, slug string) (services.Hunt, error)
+	CreateHunt(ctx context.Context, slug, name string) (services.Hunt, error)
+	DeleteHunt(ctx context.Context, id int) error
+	CloneHunt(ctx context.Context, fromID int, slug, name string) (services.Hunt, error)
+	ExportHunt(ctx context.Context, huntID int, w io.Writer) error
+	ImportHunt(ctx context.Context, r io.ReaderAt, size int64, opts services.ImportOptions) (services.ImportSummary, error)
+	TeamHuntID(ctx context.Context, teamID int) (int, error)
+
+	// Per-team flag methods
+	TeamFlagToken(ctx context.Context, teamID int, q services.Question) (string, error)
+	CheckAnswer(ctx context.Context, teamID int, q services.Question, answer string) (bool, error)
+	GetTeamFlags(ctx context.Context, questionID int) ([]services.TeamFlag, error)
+
+	// Writeup methods
+	CheckWriteup(ctx context.Context, teamID, questionID, newFiles int) error
+	SubmitWriteup(ctx context.Context, teamID, questionID int, body string, keys, names []string) (services.Writeup, error)
+	RemoveWriteupFile(ctx context.Context, teamID, questionID, fileID int) error
+	GetWriteup(ctx context.Context, id int) (services.Writeup, error)
+	GetTeamWriteup(ctx context.Context, teamID, questionID int) (services.Writeup, error)
+	GetWriteups(ctx context.Context, huntID int, status string) ([]services.Writeup, error)
+	GalleryOpen(ctx context.Context, huntID int) bool
+	ModerateWriteup(ctx context.Context, id int, status string) error
+	DeleteWriteup(ctx context.Context, id int) error
+	GetWriteupFile(ctx context.Context, key string) (services.WriteupFile, services.Writeup, error)
+
+	// Photo submission methods
+	HasPendingPhoto(ctx context.Context, teamID, questionID int) (bool, error)
+	SubmitPhoto(ctx context.Context, teamID, questionID int, key, name, ip string) (services.PhotoSubmission, error)
+	GetPhotoSubmission(ctx context.Context, id int) (services.PhotoSubmission, error)
+	GetPhotoSubmissions(ctx context.Context, huntID int, status string) ([]services.PhotoSubmission, error)
+	GetTeamPhotoSubmissions(ctx context.Context, teamID, questionID int) ([]services.PhotoSubmission, error)
+	GradePhoto(ctx context.Context, id int, status string, points int, note string) (services.PhotoSubmission, error)
+	GetPhotoFile(ctx context.Context, key string) (services.PhotoSubmission, error)
+
+	// Submission log methods
+	RecordSubmission(ctx context.Context, teamID, questionID int, answer, ip string, correct bool, penalty int) error
+	GetTeamSubmissions(ctx context.Context, teamID, questionID int) ([]services.Submission, error)
+	GetSubmissions(ctx context.Context, huntID, teamID, questionID, limit int) ([]services.Submission, error)
+
+	// Alert methods
+	InspectWrongAnswer(ctx context.Context, teamID int, q services.Question, answer string) []services.Alert
+	RecordLogin(ctx context.Context, teamID int, ip string) error
+	GetAlerts(ctx context.Context, huntID int, resolved bool) ([]services.Alert, error)
+	ResolveAlert(ctx context.Context, id int) error
+
+	// Duplicate account methods
+	FindDuplicates(ctx context.Context, huntID int) ([]services.DuplicatePair, error)
+	SuspendTeam(ctx context.Context, teamID int) error
+	UnsuspendTeam(ctx context.Context, teamID int) error
+	IsTeamSuspended(ctx context.Context, teamID int) (bool, error)
+	MergeTeam(ctx context.Context, from, into int) error
+
+	// Review methods
+	FlagTeam(ctx context.Context, teamID int) error
+	ClearTeam(ctx context.Context, teamID int) ([]services.ApprovedSolve, error)
+	BanTeam(ctx context.Context, teamID int) error
+	GetSolveReviews(ctx context.Context, huntID int, status string) ([]services.SolveReview, error)
+	SettleSolveReview(ctx context.Context, id int, status string) (*services.ApprovedSolve, error)
+
+	// Backup methods
+	CreateBackup(ctx context.Context) (services.BackupInfo, error)
+	ListBackups(ctx context.Context) ([]services.BackupInfo, error)
+
+	// Stats methods
+	GetHuntStats(ctx context.Context, huntID int) (services.HuntStats, error)
 
 	// Health check methods
-	PingDB() error
+	PingDB(ctx context.Context) error
 	GetDBStats() database.DBStats
+	SchemaVersion(ctx context.Context) (int, error)
+	PingStorage(ctx context.Context) error
+	PingCache(ctx context.Context) error
 }
 
 type AuthHandler struct {
 	UserServices AuthService
 	Broadcaster  *services.Broadcaster
+	WebPush      *services.WebPushSender // nil when Web Push is not configured
+	Telegram     *services.TelegramBot   // nil when no Telegram bot is configured
+	PublicStats  *PublicStats            // nil when /api/stats is disabled
+	AdminPass    string                  // password for the /sudo login
+	Server       ServerConfig            // body limits of the upload routes
 }
 
-func NewAuthHandler(us AuthService, broadcaster *services.Broadcaster) *AuthHandler {
+func NewAuthHandler(us AuthService, broadcaster *services.Broadcaster, webPush *services.WebPushSender) *AuthHandler {
 	return &AuthHandler{
 		UserServices: us,
 		Broadcaster:  broadcaster,
+		WebPush:      webPush,
 	}
 }
 
@@ -148,6 +426,9 @@ func (ah *AuthHandler) authMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		sess, _ := session.Get(auth_sessions_key, c)
 		if auth, ok := sess.Values[auth_key].(bool); !ok || !auth {
 			c.Set("FROMPROTECTED", false)
+			if isAPIRequest(c) {
+				return jsonError(c, http.StatusUnauthorized, "Not signed in", nil)
+			}
 			// Redirect to login instead of showing error
 			return c.Redirect(http.StatusSeeOther, "/login")
 		}
@@ -171,6 +452,19 @@ func (ah *AuthHandler) authMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// apiAuthMiddleware is authMiddleware for JSON clients: it answers 401
+// instead of redirecting to the login page
+func (ah *AuthHandler) apiAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sess, _ := session.Get(auth_sessions_key, c)
+		if auth, ok := sess.Values[auth_key].(bool); !ok || !auth {
+			return jsonError(c, http.StatusUnauthorized, "Not signed in", nil)
+		}
+
+		return ah.authMiddleware(next)(c)
+	}
+}
+
 func valid(email string) bool {
 	_, err := mail.ParseAddress(email)
 	return err == nil
@@ -194,12 +488,31 @@ func (ah *AuthHandler) LoginHandler(c echo.Context) error {
 			tzone = c.Request().Header["X-Timezone"][0]
 		}
 
-		user, err := ah.UserServices.CheckEmail(c.FormValue("email"))
+		user, err := ah.UserServices.CheckEmail(c.Request().Context(), c.FormValue("email"))
 
 		log.Print(user)
 
 		if err != nil {
 			if strings.Contains(err.Error(), "no rows in result set") {
+				// Spectators sign in on the same page but never as a team
+				if spectator, err := ah.UserServices.GetSpectatorByEmail(c.Request().Context(), c.FormValue("email")); err == nil {
+					if bcrypt.CompareHashAndPassword([]byte(spectator.Password), []byte(c.FormValue("password"))) != nil {
+						c.Set("ISERROR", true)
+						errs["pass"] = "Incorrect Password"
+						view := auth.Login(fromProtected, errs)
+
+						return renderView(c, auth.LoginIndex(
+							"Login",
+							"",
+							fromProtected,
+							c.Get("ISERROR").(bool),
+							view,
+						))
+					}
+					startSpectatorSession(c, spectator, tzone)
+					return c.Redirect(http.StatusSeeOther, "/spectate")
+				}
+
 				c.Set("ISERROR", true)
 				errs["dne"] = "User with this email does not exist."
 				view := auth.Login(fromProtected, errs)
@@ -232,27 +545,24 @@ func (ah *AuthHandler) LoginHandler(c echo.Context) error {
 			))
 		}
 
-		// Log in the user
-		sess, _ := session.Get(auth_sessions_key, c)
-		sess.Options = &sessions.Options{
-			Path:     "/",
-			MaxAge:   60 * 60 * 24 * 7, // 1 week
-			HttpOnly: true,
-			Secure:   true, // Only send over HTTPS
-			SameSite: http.SameSiteStrictMode, // CSRF protection
-		}
-
-		// Set user as authenticated, their username,
-		// their ID and the client's time zone
+		if suspended, _ := ah.UserServices.IsTeamSuspended(c.Request().Context(), user.ID); suspended {
+			c.Set("ISERROR", true)
+			errs["pass"] = "This team is suspended"
+			view := auth.Login(fromProtected, errs)
 
-		sess.Values = map[interface{}]interface{}{
-			auth_key:      true,
-			user_type:     "ordinary",
-			user_id_key:   user.ID,
-			user_name_key: user.Username,
-			tzone_key:     tzone,
+			return renderView(c, auth.LoginIndex(
+				"Login",
+				"",
+				fromProtected,
+				c.Get("ISERROR").(bool),
+				view,
+			))
 		}
-		sess.Save(c.Request(), c.Response())
+
+		// Log in the user; teams on their own clocks start them here
+		startSession(c, user, tzone)
+		ah.UserServices.RecordLogin(c.Request().Context(), user.ID, c.RealIP())
+		ah.UserServices.TeamWindow(c.Request().Context(), user.ID)
 
 		return c.Redirect(http.StatusSeeOther, "/hunt")
 
@@ -270,6 +580,122 @@ func (ah *AuthHandler) LoginHandler(c echo.Context) error {
 	))
 }
 
+// startSession logs a team in by storing it in the session cookie
+func startSession(c echo.Context, user services.User, tzone string) {
+	sess, _ := session.Get(auth_sessions_key, c)
+	sess.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   60 * 60 * 24 * 7, // 1 week
+		HttpOnly: true,
+		Secure:   true, // Only send over HTTPS
+		SameSite: http.SameSiteStrictMode, // CSRF protection
+	}
+
+	// Set user as authenticated, their username,
+	// their ID and the client's time zone
+
+	sess.Values = map[interface{}]interface{}{
+		auth_key:      true,
+		user_type:     "ordinary",
+		user_id_key:   user.ID,
+		user_name_key: user.Username,
+		tzone_key:     tzone,
+	}
+	sess.Save(c.Request(), c.Response())
+}
+
+// endSession revokes the session's authentication
+func endSession(c echo.Context) {
+	sess, _ := session.Get(auth_sessions_key, c)
+	sess.Values = map[interface{}]interface{}{
+		auth_key:      false,
+		user_id_key:   "",
+		user_type:     "none",
+		user_name_key: "",
+		tzone_key:     "",
+	}
+	sess.Save(c.Request(), c.Response())
+}
+
+// validateRegistration checks a new team's details, returning the problems
+// keyed by field; an empty map means the team can be created
+func (ah *AuthHandler) validateRegistration(ctx context.Context, email, username, password string) map[string]string {
+	errs := make(map[string]string)
+
+	if !valid(email) {
+		errs["email"] = "Invalid email address"
+	}
+
+	_, err := ah.UserServices.CheckEmail(ctx, email)
+	if err == nil || username == "admin" {
+		errs["username"] = "Nuh uh, nice try being the admin"
+	}
+	if _, err := ah.UserServices.GetSpectatorByEmail(ctx, email); err == nil {
+		errs["email"] = "A spectator already signs in with this email"
+	}
+
+	// password valid: minimum 8 characters
+	if len(password) < 8 {
+		errs["password"] = "Password must be at least 8 characters"
+	}
+
+	// username valid: minimum 4 letters
+	if len(username) < 4 {
+		errs["username"] = "Username must be at least 4 characters"
+	}
+	
+	// username valid: only alphanumeric and underscore
+	for _, char := range username {
+		if !((char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '_') {
+			errs["username"] = "Username can only contain letters, numbers, and underscores"
+			break
+		}
+	}
+
+	_, err = ah.UserServices.CheckUsername(ctx, username)
+	log.Print(err)
+	if err == nil {
+		errs["username"] = "Account with this username already exists"
+	}
+
+	return errs
+}
+
+// renderRegistrationClosed turns teams away from the register page, with
+// the waitlist message the admin left for them
+func (ah *AuthHandler) renderRegistrationClosed(c echo.Context, fromProtected bool, reason string) error {
+	errs := map[string]string{
+		"closed":   reason,
+		"waitlist": ah.UserServices.GetRegistrationLimit(c.Request().Context()).Message,
+	}
+	c.Set("ISERROR", false)
+	return renderView(c, auth.RegisterIndex(
+		"Register",
+		"",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		auth.Register(fromProtected, errs, nil, ""),
+	))
+}
+
+// emailPolicyError tells a team which addresses may register
+func emailPolicyError(p services.EmailPolicy) string {
+	domains := make([]string, len(p.Domains))
+	for i, d := range p.Domains {
+		domains[i] = "@" + d
+	}
+	return "Registration is limited to " + strings.Join(domains, ", ") + " addresses"
+}
+
+// registrationFingerprint reads the browser fingerprint a team registers
+// with, from the header clients send or the field the form fills in
+func registrationFingerprint(c echo.Context) string {
+	if fp := c.Request().Header.Get(services.FingerprintHeader); fp != "" {
+		return fp
+	}
+	return c.FormValue("fingerprint")
+}
+
 func (ah *AuthHandler) RegisterHandler(c echo.Context) error {
 
 	errs := make(map[string]string)
@@ -279,52 +705,62 @@ func (ah *AuthHandler) RegisterHandler(c echo.Context) error {
 		return c.Redirect(http.StatusSeeOther, "/")
 	}
 
+	// Admins can still create teams from the admin API while it is closed
+	if !ah.UserServices.FlagEnabled(c.Request().Context(), services.FlagRegistrationOpen) {
+		return ah.renderRegistrationClosed(c, fromProtected, "Registration is closed")
+	}
+
+	// Teams pick their hunt on the form, or arrive with ?hunt=slug
+	hunts, err := ah.UserServices.GetHunts(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error fetching hunts")
+	}
+	selected := c.FormValue("hunt")
+
+	// With one hunt there is nothing to pick, so a full one turns teams
+	// away before they fill in the form
+	if len(hunts) == 1 {
+		full, err := ah.UserServices.RegistrationFull(c.Request().Context(), hunts[0].ID)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "Error checking registration")
+		}
+		if full {
+			return ah.renderRegistrationClosed(c, fromProtected, "Registration is full")
+		}
+	}
+
 	if c.Request().Method == "POST" {
 		email := c.FormValue("email")
 		password := c.FormValue("password")
 		username := strings.TrimSpace(c.FormValue("username"))
 
-		if !valid(email) {
-			errs["email"] = "Invalid email address"
-			c.Set("ISERROR", true)
-		}
-
-		_, err := ah.UserServices.CheckEmail(email)
-		if err == nil || username == "admin" {
-			errs["username"] = "Nuh uh, nice try being the admin"
-			c.Set("ISERROR", true)
-		}
-
-		// password valid: minimum 8 characters
-		if len(password) < 8 {
-			errs["password"] = "Password must be at least 8 characters"
-			c.Set("ISERROR", true)
+		errs = ah.validateRegistration(c.Request().Context(), email, username, password)
+		if policy := ah.UserServices.GetEmailPolicy(c.Request().Context()); errs["email"] == "" && !policy.Allows(email) {
+			errs["email"] = emailPolicyError(policy)
 		}
-
-		// username valid: minimum 4 letters
-		if len(username) < 4 {
-			errs["username"] = "Username must be at least 4 characters"
-			c.Set("ISERROR", true)
+		huntID := services.DefaultHuntID
+		if selected != "" {
+			hunt, err := ah.UserServices.GetHuntBySlug(c.Request().Context(), selected)
+			if err != nil {
+				errs["hunt"] = "Pick one of the hunts"
+			}
+			huntID = hunt.ID
 		}
-		
-		// username valid: only alphanumeric and underscore
-		for _, char := range username {
-			if !((char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '_') {
-				errs["username"] = "Username can only contain letters, numbers, and underscores"
-				c.Set("ISERROR", true)
-				break
+		if errs["hunt"] == "" {
+			full, err := ah.UserServices.RegistrationFull(c.Request().Context(), huntID)
+			if err != nil {
+				return c.String(http.StatusInternalServerError, "Error checking registration")
+			}
+			if full {
+				return ah.renderRegistrationClosed(c, fromProtected, "Registration is full")
 			}
 		}
-
-		_, err = ah.UserServices.CheckUsername(username)
-		log.Print(err)
-		if err == nil {
-			errs["username"] = "Account with this username already exists"
+		if len(errs) > 0 {
 			c.Set("ISERROR", true)
 		}
 
-		if errs["username"] != "" || errs["email"] != "" || errs["password"] != "" {
-			view := auth.Register(fromProtected, errs)
+		if errs["username"] != "" || errs["email"] != "" || errs["password"] != "" || errs["hunt"] != "" {
+			view := auth.Register(fromProtected, errs, hunts, selected)
 
 			c.Set("ISERROR", false)
 
@@ -338,12 +774,20 @@ func (ah *AuthHandler) RegisterHandler(c echo.Context) error {
 		}
 
 		user := services.User{
-			Email:    email,
-			Username: username,
-			Password: password,
+			Email:          email,
+			Username:       username,
+			Password:       password,
+			HuntID:         huntID,
+			RegistrationIP: c.RealIP(),
+			Fingerprint:    services.Fingerprint(registrationFingerprint(c)),
 		}
 
-		ah.UserServices.CreateUser(user)
+		if err := ah.UserServices.CreateUser(c.Request().Context(), user); err == nil {
+			ah.emitWebhook(c.Request().Context(), services.WebhookTeamRegistered, map[string]interface{}{
+				"team_name": username,
+			})
+			ah.sendVerificationEmail(c, email)
+		}
 
 		return c.Redirect(http.StatusSeeOther, "/login")
 	}
@@ -352,7 +796,7 @@ func (ah *AuthHandler) RegisterHandler(c echo.Context) error {
 		return errors.New("invalid type for key 'FROMPROTECTED'")
 	}
 
-	view := auth.Register(fromProtected, errs)
+	view := auth.Register(fromProtected, errs, hunts, selected)
 
 	c.Set("ISERROR", false)
 
@@ -366,21 +810,13 @@ func (ah *AuthHandler) RegisterHandler(c echo.Context) error {
 }
 
 func (ah *AuthHandler) LogoutHandler(c echo.Context) error {
-	sess, _ := session.Get(auth_sessions_key, c)
 	fromProtected, _ := c.Get("FROMPROTECTED").(bool)
 
 	if !fromProtected {
 		return c.Redirect(http.StatusSeeOther, "/")
 	}
 	// Revoke users authentication
-	sess.Values = map[interface{}]interface{}{
-		auth_key:      false,
-		user_id_key:   "",
-		user_type:     "none",
-		user_name_key: "",
-		tzone_key:     "",
-	}
-	sess.Save(c.Request(), c.Response())
+	endSession(c)
 
 	// fromProtected = false
 	c.Set("FROMPROTECTED", false)
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+// avatarError maps avatar errors to play errors
+func avatarError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrAvatarNotFound):
+		return newPlayError(http.StatusNotFound, "Avatar not found")
+	case errors.Is(err, services.ErrInvalidAvatar), errors.Is(err, services.ErrAvatarTooLarge):
+		return newPlayError(http.StatusBadRequest, "%s", err)
+	}
+	return teamActionError(err)
+}
+
+// saveAvatar stores the image uploaded in the avatar field as the team's
+// avatar
+func (ah *AuthHandler) saveAvatar(c echo.Context, teamID int) error {
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		return newPlayError(http.StatusBadRequest, "Choose an image to upload")
+	}
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return avatarError(ah.UserServices.SetTeamAvatar(c.Request().Context(), teamID, file.Filename, file.Size, src))
+}
+
+// AvatarHandler serves a team's avatar to anyone, as the leaderboard and
+// its public copy show them. Keys change with every upload, so avatars
+// are cached for long
+func (ah *AuthHandler) AvatarHandler(c echo.Context) error {
+	key := c.Param("key")
+	obj, info, err := ah.UserServices.OpenAvatar(c.Request().Context(), key)
+	if errors.Is(err, services.ErrAvatarNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "image/png")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(c.Response(), c.Request(), key, info.ModTime, obj)
+	return nil
+}
+
+// TeamAvatarHandler sets the team's avatar from its profile page
+func (ah *AuthHandler) TeamAvatarHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	teamName := c.Get(user_name_key).(string)
+	err := ah.saveAvatar(c, c.Get(user_id_key).(int))
+	if err == nil {
+		return c.Redirect(http.StatusSeeOther, "/team/"+url.PathEscape(teamName))
+	}
+	var pe *playError
+	if !errors.As(err, &pe) || pe.Status != http.StatusBadRequest {
+		return playErrorString(c, err)
+	}
+
+	// Show what was wrong with the image on the profile it was sent from
+	return ah.renderOwnProfile(c, map[string]string{"avatar": pe.Message})
+}
+
+// DeleteTeamAvatarHandler takes away the team's avatar
+func (ah *AuthHandler) DeleteTeamAvatarHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	if err := ah.UserServices.RemoveTeamAvatar(c.Request().Context(), c.Get(user_id_key).(int)); err != nil {
+		return playErrorString(c, avatarError(err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/team/"+url.PathEscape(c.Get(user_name_key).(string)))
+}
+
+// AdminDeleteAvatar takes away a team's avatar, e.g. an unsuitable one
+func (ah *AuthHandler) AdminDeleteAvatar(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid team ID")
+	}
+	if err := ah.UserServices.RemoveTeamAvatar(c.Request().Context(), id); err != nil {
+		return playErrorString(c, avatarError(err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su")
+}
+
+// APISetAvatar sets the caller's avatar from a multipart upload
+func (ah *AuthHandler) APISetAvatar(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	if err := ah.saveAvatar(c, c.Get(user_id_key).(int)); err != nil {
+		return apiError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// APIDeleteAvatar takes away the caller's avatar
+func (ah *AuthHandler) APIDeleteAvatar(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	if err := ah.UserServices.RemoveTeamAvatar(c.Request().Context(), c.Get(user_id_key).(int)); err != nil {
+		return apiError(c, avatarError(err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AdminAPIDeleteAvatar takes away a team's avatar
+func (ah *AuthHandler) AdminAPIDeleteAvatar(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if err := ah.UserServices.RemoveTeamAvatar(c.Request().Context(), id); err != nil {
+		return apiError(c, avatarError(err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
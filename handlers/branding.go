@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// brandingMiddleware puts the site's branding in the context of each
+// request, for the layouts to show
+func (ah *AuthHandler) brandingMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		r := c.Request()
+		b := ah.UserServices.GetBranding(r.Context())
+		c.SetRequest(r.WithContext(services.WithBranding(r.Context(), b)))
+		return next(c)
+	}
+}
+
+// LogoHandler serves the event's logo to anyone. Its key changes with
+// every upload, so it is cached for long
+func (ah *AuthHandler) LogoHandler(c echo.Context) error {
+	key := c.Param("key")
+	obj, info, err := ah.UserServices.OpenLogo(c.Request().Context(), key)
+	if errors.Is(err, services.ErrLogoNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	contentType := info.ContentType
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(c.Response(), c.Request(), key, info.ModTime, obj)
+	return nil
+}
+
+// AdminBrandingHandler shows and saves the event's name, tagline, colours
+// and footer links
+func (ah *AuthHandler) AdminBrandingHandler(c echo.Context) error {
+	errs := make(map[string]string)
+	ctx := c.Request().Context()
+	branding := ah.UserServices.GetBranding(ctx)
+
+	if c.Request().Method == "POST" {
+		branding.Name = c.FormValue("name")
+		branding.Tagline = c.FormValue("tagline")
+		branding.PrimaryColor = c.FormValue("primary_color")
+		branding.AccentColor = c.FormValue("accent_color")
+		branding.FooterLinks = services.ParseFooterLinks(c.FormValue("footer_links"))
+
+		err := ah.UserServices.SetBranding(ctx, branding)
+		switch {
+		case errors.Is(err, services.ErrInvalidBranding):
+			errs["branding"] = err.Error()
+		case err != nil:
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving branding: %s", err))
+		default:
+			return c.Redirect(http.StatusSeeOther, "/su/branding")
+		}
+	}
+
+	return ah.renderBranding(c, branding, errs)
+}
+
+// AdminLogoHandler stores the image uploaded in the logo field as the
+// event's logo
+func (ah *AuthHandler) AdminLogoHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	file, err := c.FormFile("logo")
+	if err != nil {
+		return ah.renderBranding(c, ah.UserServices.GetBranding(ctx), map[string]string{"logo": "Choose an image to upload"})
+	}
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	err = ah.UserServices.SetLogo(ctx, file.Filename, file.Size, src)
+	switch {
+	case errors.Is(err, services.ErrInvalidLogo), errors.Is(err, services.ErrLogoTooLarge):
+		return ah.renderBranding(c, ah.UserServices.GetBranding(ctx), map[string]string{"logo": err.Error()})
+	case err != nil:
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving logo: %s", err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/branding")
+}
+
+// AdminDeleteLogoHandler goes back to showing no logo
+func (ah *AuthHandler) AdminDeleteLogoHandler(c echo.Context) error {
+	if err := ah.UserServices.RemoveLogo(c.Request().Context()); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error removing logo: %s", err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/branding")
+}
+
+// renderBranding shows the branding page with the values being edited
+func (ah *AuthHandler) renderBranding(c echo.Context, branding services.Branding, errs map[string]string) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	view := panel.Branding(fromProtected, branding, errs)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.BrandingIndex(
+		"Branding",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+// calendarMaxAge is how long browsers and proxies may keep the feed
+const calendarMaxAge = 5 * time.Minute
+
+// CalendarHandler serves when the hunt runs as an iCalendar feed, for
+// teams to subscribe to from their calendar app; ?hunt= names the hunt
+// by its slug
+func (ah *AuthHandler) CalendarHandler(c echo.Context) error {
+	hunt, err := ah.publicHunt(c)
+	if errors.Is(err, services.ErrHuntNotFound) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching hunt: %s", err))
+	}
+
+	host := c.Request().Host
+	link := c.Scheme() + "://" + host + "/hunt"
+	ics := services.HuntCalendar(hunt, ah.UserServices.GetHuntWindow(c.Request().Context(), hunt.ID), host, link, time.Now())
+
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(calendarMaxAge.Seconds())))
+	c.Response().Header().Set(echo.HeaderContentDisposition, `inline; filename="`+hunt.Slug+`.ics"`)
+	return c.Blob(http.StatusOK, "text/calendar; charset=utf-8", []byte(ics))
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/hunt"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// chatHistorySize is how many messages a channel shows on load
+const chatHistorySize = 100
+
+// chatChannel resolves the "global" or "team" channel name for the current team
+func chatChannel(c echo.Context, name string) int {
+	if name == "team" {
+		return c.Get(user_id_key).(int)
+	}
+	return services.ChatGlobal
+}
+
+// broadcastChat sends a chat event to whoever can read the channel: the
+// hunt's teams for its shoutbox, or the team whose channel it is
+func (ah *AuthHandler) broadcastChat(huntID, channel int, eventType services.EventType, data map[string]interface{}) {
+	if channel == services.ChatGlobal {
+		ah.Broadcaster.BroadcastToHunt(huntID, eventType, data)
+	} else {
+		ah.Broadcaster.BroadcastToTeam(channel, eventType, data)
+	}
+}
+
+// ChatHandler shows the shoutbox of the team's hunt and the team's private
+// channel
+func (ah *AuthHandler) ChatHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	teamID := c.Get(user_id_key).(int)
+	huntID, err := ah.requestHunt(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error fetching chat")
+	}
+
+	global, err := ah.UserServices.GetChatMessages(c.Request().Context(), huntID, services.ChatGlobal, chatHistorySize)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error fetching chat")
+	}
+
+	team, err := ah.UserServices.GetChatMessages(c.Request().Context(), huntID, teamID, chatHistorySize)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error fetching chat")
+	}
+
+	muted, err := ah.UserServices.IsTeamMuted(c.Request().Context(), teamID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error fetching chat")
+	}
+
+	view := hunt.Chat(fromProtected, global, team, muted)
+	c.Set("ISERROR", false)
+	return renderView(c, hunt.ChatIndex(
+		"Chat",
+		c.Get(user_name_key).(string),
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// GetChatMessagesAPI returns the latest messages of the hunt's shoutbox or
+// the team channel
+func (ah *AuthHandler) GetChatMessagesAPI(c echo.Context) error {
+	channel := chatChannel(c, c.QueryParam("channel"))
+	huntID, err := ah.requestHunt(c)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Failed to fetch messages", nil)
+	}
+
+	messages, err := ah.UserServices.GetChatMessages(c.Request().Context(), huntID, channel, chatHistorySize)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Failed to fetch messages", nil)
+	}
+
+	if messages == nil {
+		messages = []services.ChatMessage{}
+	}
+
+	return c.JSON(http.StatusOK, messages)
+}
+
+// PostChatMessageAPI posts a message to the hunt's shoutbox or the team
+// channel
+func (ah *AuthHandler) PostChatMessageAPI(c echo.Context) error {
+	if isAdminSession(c) {
+		return jsonError(c, http.StatusForbidden, "Admins moderate chat from the admin panel", nil)
+	}
+
+	var req struct {
+		Channel string `json:"channel" form:"channel"`
+		Body    string `json:"body" form:"body"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid message", nil)
+	}
+
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		return jsonError(c, http.StatusBadRequest, "Message is empty", nil)
+	}
+	if utf8.RuneCountInString(body) > services.ChatMessageMaxLength {
+		return jsonError(c, http.StatusBadRequest, fmt.Sprintf("Messages are limited to %d characters", services.ChatMessageMaxLength), nil)
+	}
+
+	teamID := c.Get(user_id_key).(int)
+	muted, err := ah.UserServices.IsTeamMuted(c.Request().Context(), teamID)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Failed to post message", nil)
+	}
+	if muted {
+		return jsonError(c, http.StatusForbidden, "Your team has been muted", nil)
+	}
+
+	channel := chatChannel(c, req.Channel)
+	message, err := ah.UserServices.PostChatMessage(c.Request().Context(), teamID, channel, body)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Failed to post message", nil)
+	}
+
+	ah.broadcastChat(message.HuntID, channel, services.EventChatMessage, map[string]interface{}{
+		"message": message,
+	})
+
+	return c.JSON(http.StatusCreated, message)
+}
+
+// AdminChatHandler lists recent messages across all channels of the hunt
+// the panel is switched to, for moderation
+func (ah *AuthHandler) AdminChatHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	messages, err := ah.UserServices.GetRecentChatMessages(c.Request().Context(), ah.adminHunt(c), chatHistorySize)
+	if err != nil {
+		return adminError(c, http.StatusInternalServerError, "Error fetching chat", err)
+	}
+
+	users, err := ah.UserServices.GetAllUsers(c.Request().Context(), ah.adminHunt(c))
+	if err != nil {
+		return adminError(c, http.StatusInternalServerError, "Error fetching teams", err)
+	}
+
+	muted, err := ah.UserServices.GetMutedTeams(c.Request().Context())
+	if err != nil {
+		return adminError(c, http.StatusInternalServerError, "Error fetching muted teams", err)
+	}
+
+	view := panel.Chat(fromProtected, messages, users, muted)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.ChatIndex(
+		"Chat Moderation",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminDeleteChatMessage removes a message and takes it off connected screens
+func (ah *AuthHandler) AdminDeleteChatMessage(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return adminError(c, http.StatusBadRequest, "Invalid message ID", nil)
+	}
+
+	message, err := ah.UserServices.DeleteChatMessage(c.Request().Context(), id)
+	if err != nil && err != sql.ErrNoRows {
+		return adminError(c, http.StatusInternalServerError, "Error deleting message", err)
+	}
+
+	if err == nil {
+		ah.broadcastChat(message.HuntID, message.Channel, services.EventChatDelete, map[string]interface{}{
+			"id":      message.ID,
+			"channel": message.Channel,
+		})
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/chat")
+}
+
+// AdminMuteTeam stops a team from posting in chat
+func (ah *AuthHandler) AdminMuteTeam(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return adminError(c, http.StatusBadRequest, "Invalid team ID", nil)
+	}
+
+	if err := ah.UserServices.MuteTeam(c.Request().Context(), id); err != nil {
+		return adminError(c, http.StatusInternalServerError, "Error muting team", err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/chat")
+}
+
+// AdminUnmuteTeam lets a muted team post in chat again
+func (ah *AuthHandler) AdminUnmuteTeam(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return adminError(c, http.StatusBadRequest, "Invalid team ID", nil)
+	}
+
+	if err := ah.UserServices.UnmuteTeam(c.Request().Context(), id); err != nil {
+		return adminError(c, http.StatusInternalServerError, "Error unmuting team", err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/chat")
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/i18n"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// errCheckpointNotScanned is returned for opening a checkpoint the team
+// hasn't scanned, and errCheckpointAnswer for typing the answer to one
+// that is solved by scanning
+var (
+	errCheckpointNotScanned = newPlayError(http.StatusForbidden, "Find this question's QR code and scan it to open it")
+	errCheckpointAnswer     = newPlayError(http.StatusForbidden, "Scan this question's QR code at its checkpoint to solve it")
+)
+
+// checkpointError maps checkpoint errors to play errors
+func checkpointError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrCheckpointNotFound):
+		return newPlayError(http.StatusNotFound, "This code isn't a checkpoint of your hunt")
+	case errors.Is(err, services.ErrCheckpointOtherTeam):
+		return newPlayError(http.StatusForbidden, "This code belongs to another team")
+	}
+	return err
+}
+
+// checkpointURL is where a checkpoint's code leads
+func checkpointURL(c echo.Context, token string) string {
+	return c.Scheme() + "://" + c.Request().Host + services.CheckpointPath + token
+}
+
+// scanCheckpoint records that the team scanned a checkpoint's code. A
+// checkpoint that solves its question is solved as if the team answered
+// it, quota and locks permitting; result is nil for one that only opens
+// its question
+func (ah *AuthHandler) scanCheckpoint(ctx context.Context, teamID int, teamName, token, ip string) (services.Checkpoint, *answerResult, error) {
+	if err := ah.checkHuntOpen(ctx, teamID, true); err != nil {
+		return services.Checkpoint{}, nil, err
+	}
+
+	cp, err := ah.UserServices.ScanCheckpoint(ctx, teamID, token)
+	if err != nil {
+		return services.Checkpoint{}, nil, checkpointError(err)
+	}
+	if cp.Mode != services.CheckpointSolve {
+		return cp, nil, nil
+	}
+
+	qs, err := ah.loadQuestion(ctx, teamID, cp.QuestionID)
+	if err != nil {
+		return cp, nil, err
+	}
+	if qs.Completed {
+		return cp, &answerResult{Correct: true, Message: "Your team already reached this checkpoint."}, nil
+	}
+	if qs.Skipped {
+		return cp, nil, errQuestionSkipped
+	}
+	result, err := ah.awardSolve(ctx, teamID, teamName, qs.Question, "QR checkpoint", ip)
+	if err != nil {
+		return cp, nil, err
+	}
+	return cp, &result, nil
+}
+
+// CheckpointHandler is where a checkpoint's code leads. It shows which
+// question the code is for and, on POST, checks the team in: a checkpoint
+// that opens its question goes on to it and one that solves it says how
+// many points it earned
+func (ah *AuthHandler) CheckpointHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	ctx := c.Request().Context()
+	token := c.Param("token")
+
+	// Teams sign in first and then scan again, as the session only starts
+	// at the login page
+	if !fromProtected {
+		return ah.renderCheckpoint(c, "", pages.CheckpointState{
+			Message: i18n.T(ctx, "Sign in, then scan this code again."),
+			Failed:  true,
+		})
+	}
+	sess, _ := session.Get(auth_sessions_key, c)
+	teamID, _ := sess.Values[user_id_key].(int)
+	teamName, _ := sess.Values[user_name_key].(string)
+
+	if c.Request().Method != http.MethodPost {
+		cp, err := ah.UserServices.CheckCheckpoint(ctx, teamID, token)
+		if err != nil {
+			return ah.checkpointFailed(c, teamName, checkpointError(err))
+		}
+		return ah.renderCheckpoint(c, teamName, pages.CheckpointState{
+			Token:      token,
+			QuestionID: cp.QuestionID,
+			Title:      cp.QuestionTitle,
+			Mode:       cp.Mode,
+			CanScan:    true,
+		})
+	}
+
+	cp, result, err := ah.scanCheckpoint(ctx, teamID, teamName, token, c.RealIP())
+	if err != nil {
+		return ah.checkpointFailed(c, teamName, err)
+	}
+	if result == nil {
+		return c.Redirect(http.StatusSeeOther, "/hunt/question/"+strconv.Itoa(cp.QuestionID))
+	}
+	return ah.renderCheckpoint(c, teamName, pages.CheckpointState{
+		QuestionID: cp.QuestionID,
+		Title:      cp.QuestionTitle,
+		Mode:       cp.Mode,
+		Message:    i18n.T(ctx, result.Message),
+	})
+}
+
+// checkpointFailed shows why a code can't be scanned, or the error page
+// for server errors
+func (ah *AuthHandler) checkpointFailed(c echo.Context, teamName string, err error) error {
+	var pe *playError
+	if !errors.As(err, &pe) || pe.Status >= 500 {
+		return playErrorString(c, err)
+	}
+	c.Response().Status = pe.Status
+	return ah.renderCheckpoint(c, teamName, pages.CheckpointState{
+		Message: i18n.T(c.Request().Context(), pe.Message),
+		Failed:  true,
+	})
+}
+
+// renderCheckpoint shows the page a checkpoint's code leads to
+func (ah *AuthHandler) renderCheckpoint(c echo.Context, teamName string, state pages.CheckpointState) error {
+	state.SignedIn = teamName != ""
+	c.Set("ISERROR", false)
+	return renderView(c, pages.PageIndex(
+		"Checkpoint",
+		teamName,
+		state.SignedIn,
+		c.Get("ISERROR").(bool),
+		pages.Checkpoint(state),
+	))
+}
+
+// APIScanCheckpoint checks the team in at a checkpoint from the token its
+// code carries, the last part of the address it leads to
+func (ah *AuthHandler) APIScanCheckpoint(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.Bind(&req); err != nil || req.Token == "" {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	cp, result, err := ah.scanCheckpoint(c.Request().Context(), c.Get(user_id_key).(int), c.Get(user_name_key).(string), req.Token, c.RealIP())
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"question_id": cp.QuestionID,
+		"mode":        cp.Mode,
+		"result":      result,
+	})
+}
+
+// AdminCheckpointsHandler lists the questions of the hunt with their
+// checkpoints and, on POST, makes the question picked with id a checkpoint
+// or an ordinary question again
+func (ah *AuthHandler) AdminCheckpointsHandler(c echo.Context) error {
+	errs := make(map[string]string)
+	ctx := c.Request().Context()
+
+	if c.Request().Method == "POST" {
+		id, err := strconv.Atoi(c.FormValue("id"))
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Invalid question ID")
+		}
+		if q, err := ah.UserServices.GetQuestionById(ctx, id); err != nil || q.HuntID != ah.adminHunt(c) {
+			return c.String(http.StatusNotFound, "Question not found")
+		}
+		err = ah.UserServices.SetCheckpoint(ctx, id, c.FormValue("mode"), c.FormValue("per_team") == "on")
+		switch {
+		case errors.Is(err, services.ErrInvalidCheckpoint):
+			errs["checkpoint"] = err.Error()
+		case err != nil:
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving checkpoint: %s", err))
+		default:
+			return c.Redirect(http.StatusSeeOther, "/su/checkpoints")
+		}
+	}
+
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	huntID := ah.adminHunt(c)
+	questions, err := ah.UserServices.GetAllQuestions(ctx, huntID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching questions: %s", err))
+	}
+	checkpoints, err := ah.UserServices.GetCheckpoints(ctx, huntID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching checkpoints: %s", err))
+	}
+	byQuestion := make(map[int]services.Checkpoint, len(checkpoints))
+	for _, cp := range checkpoints {
+		byQuestion[cp.QuestionID] = cp
+	}
+
+	view := panel.Checkpoints(fromProtected, questions, byQuestion, errs)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.CheckpointsIndex(
+		"Checkpoints",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// adminCheckpoint returns the checkpoint of the question in the id
+// parameter, nil unless it is one of the hunt the panel is switched to
+func (ah *AuthHandler) adminCheckpoint(c echo.Context) (*services.Checkpoint, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, nil
+	}
+	cp, err := ah.UserServices.GetCheckpoint(c.Request().Context(), id)
+	if err != nil || cp == nil || cp.HuntID != ah.adminHunt(c) {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// AdminCheckpointQRHandler draws the code of a checkpoint as a PNG: the
+// code of the team in ?team=, or the one every team scans
+func (ah *AuthHandler) AdminCheckpointQRHandler(c echo.Context) error {
+	cp, err := ah.adminCheckpoint(c)
+	if err != nil {
+		return err
+	}
+	if cp == nil {
+		return c.String(http.StatusNotFound, "Checkpoint not found")
+	}
+	teamID, _ := strconv.Atoi(c.QueryParam("team"))
+
+	png, err := services.CheckpointQR(checkpointURL(c, services.CheckpointToken(*cp, teamID)))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error drawing code: %s", err))
+	}
+	// Codes change when they are renewed, so they aren't kept
+	c.Response().Header().Set("Cache-Control", "no-store")
+	if c.QueryParam("download") != "" {
+		name := fmt.Sprintf("checkpoint-%d", cp.QuestionID)
+		if teamID != 0 {
+			name += fmt.Sprintf("-team-%d", teamID)
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+name+`.png"`)
+	}
+	return c.Blob(http.StatusOK, "image/png", png)
+}
+
+// AdminCheckpointPrintHandler shows a checkpoint's codes to print and put
+// up at its location: the one every team scans, or one for each team,
+// with who scanned it
+func (ah *AuthHandler) AdminCheckpointPrintHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	cp, err := ah.adminCheckpoint(c)
+	if err != nil {
+		return err
+	}
+	if cp == nil {
+		return c.String(http.StatusNotFound, "Checkpoint not found")
+	}
+	ctx := c.Request().Context()
+
+	var teams []services.User
+	if cp.PerTeam {
+		if teams, err = ah.UserServices.GetAllUsers(ctx, cp.HuntID); err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching teams: %s", err))
+		}
+	}
+	scans, err := ah.UserServices.GetCheckpointScans(ctx, cp.QuestionID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching scans: %s", err))
+	}
+
+	view := panel.CheckpointPrint(*cp, checkpointURL(c, services.CheckpointToken(*cp, 0)), teams, scans)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.CheckpointsIndex(
+		"Checkpoint codes",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminRotateCheckpointHandler renews a checkpoint's codes, so the ones
+// printed before stop working
+func (ah *AuthHandler) AdminRotateCheckpointHandler(c echo.Context) error {
+	cp, err := ah.adminCheckpoint(c)
+	if err != nil {
+		return err
+	}
+	if cp == nil {
+		return c.String(http.StatusNotFound, "Checkpoint not found")
+	}
+	if err := ah.UserServices.RotateCheckpoint(c.Request().Context(), cp.QuestionID); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error renewing codes: %s", err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/checkpoints")
+}
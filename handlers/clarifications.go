@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// clarificationError turns a clarification service error into a playError
+func clarificationError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidClarification):
+		return newPlayError(http.StatusBadRequest, "Write something, at most %d characters", services.ClarificationMaxLength)
+	case errors.Is(err, services.ErrClarificationNotFound):
+		return newPlayError(http.StatusNotFound, "Clarification not found")
+	}
+	return err
+}
+
+// askClarification asks the admins about a question of the team's hunt
+// and tells the admins watching. Only teams still playing may ask
+func (ah *AuthHandler) askClarification(ctx context.Context, teamID, questionID int, body string) (services.Clarification, error) {
+	if err := ah.checkHuntOpen(ctx, teamID, true); err != nil {
+		return services.Clarification{}, err
+	}
+
+	question, err := ah.UserServices.GetQuestionById(ctx, questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return services.Clarification{}, newPlayError(http.StatusNotFound, "Question not found")
+	}
+	if err != nil {
+		return services.Clarification{}, newPlayError(http.StatusInternalServerError, "Error fetching question")
+	}
+	if ok, err := ah.inTeamHunt(ctx, teamID, question.HuntID); err != nil {
+		return services.Clarification{}, newPlayError(http.StatusInternalServerError, "Error fetching question")
+	} else if !ok {
+		return services.Clarification{}, newPlayError(http.StatusNotFound, "Question not found")
+	}
+
+	cl, err := ah.UserServices.AskClarification(ctx, teamID, questionID, body)
+	if err != nil {
+		return services.Clarification{}, clarificationError(err)
+	}
+
+	ah.Broadcaster.BroadcastToAdmins(services.EventClarification, map[string]interface{}{
+		"id":             cl.ID,
+		"hunt_id":        question.HuntID,
+		"team_id":        cl.TeamID,
+		"team_name":      cl.TeamName,
+		"question_id":    cl.QuestionID,
+		"question_title": cl.QuestionTitle,
+		"body":           cl.Body,
+	})
+	return cl, nil
+}
+
+// answerClarification answers a request and notifies the team that asked,
+// or every team when the answer is public
+func (ah *AuthHandler) answerClarification(ctx context.Context, id int, answer string, public bool) (services.Clarification, error) {
+	cl, err := ah.UserServices.AnswerClarification(ctx, id, answer, public)
+	if err != nil {
+		return services.Clarification{}, clarificationError(err)
+	}
+
+	teamID := cl.TeamID
+	if cl.Public {
+		teamID = 0
+	}
+	ah.notify(ctx, teamID, services.NotificationClarification, "Clarification on "+cl.QuestionTitle, cl.Answer,
+		"/hunt/question/"+strconv.Itoa(cl.QuestionID))
+	return cl, nil
+}
+
+// questionClarifications returns what the team may read about a question,
+// nothing for the admin session
+func (ah *AuthHandler) questionClarifications(c echo.Context, questionID int) []services.Clarification {
+	if isAdminSession(c) {
+		return nil
+	}
+	list, _ := ah.UserServices.GetQuestionClarifications(c.Request().Context(), c.Get(user_id_key).(int), questionID)
+	return list
+}
+
+// AskClarificationHandler asks for a clarification from a question's page
+// and goes back to it
+func (ah *AuthHandler) AskClarificationHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid question ID")
+	}
+
+	_, err = ah.askClarification(c.Request().Context(), c.Get(user_id_key).(int), questionID, c.FormValue("body"))
+	if err == errHuntNotStarted {
+		return c.Redirect(http.StatusSeeOther, "/hunt")
+	}
+	if err != nil {
+		return playErrorString(c, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/hunt/question/"+strconv.Itoa(questionID))
+}
+
+// APIListClarifications returns the team's own requests about a question
+// and every published answer on it
+func (ah *AuthHandler) APIListClarifications(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid question ID"))
+	}
+	question, err := ah.UserServices.GetQuestionById(c.Request().Context(), questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apiError(c, newPlayError(http.StatusNotFound, "Question not found"))
+	} else if err != nil {
+		return apiError(c, err)
+	}
+	teamID := c.Get(user_id_key).(int)
+	if ok, err := ah.inTeamHunt(c.Request().Context(), teamID, question.HuntID); err != nil {
+		return apiError(c, err)
+	} else if !ok {
+		return apiError(c, newPlayError(http.StatusNotFound, "Question not found"))
+	}
+
+	list, err := ah.UserServices.GetQuestionClarifications(c.Request().Context(), teamID, questionID)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// APIAskClarification asks the admins about a question
+func (ah *AuthHandler) APIAskClarification(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid question ID"))
+	}
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	cl, err := ah.askClarification(c.Request().Context(), c.Get(user_id_key).(int), questionID, req.Body)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusCreated, cl)
+}
+
+// AdminClarificationsHandler shows the unanswered clarifications of the
+// hunt being managed, and the answered ones with ?answered=1
+func (ah *AuthHandler) AdminClarificationsHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	answered := c.QueryParam("answered") == "1"
+	list, err := ah.UserServices.GetClarifications(c.Request().Context(), ah.adminHunt(c), answered)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching clarifications: %s", err))
+	}
+
+	view := panel.Clarifications(fromProtected, list, answered)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.ClarificationsIndex(
+		"Clarifications",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminAnswerClarification answers a clarification from the queue
+func (ah *AuthHandler) AdminAnswerClarification(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid clarification ID")
+	}
+
+	public := c.FormValue("public") == "on"
+	if _, err := ah.answerClarification(c.Request().Context(), id, c.FormValue("answer"), public); err != nil {
+		return playErrorString(c, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/clarifications")
+}
+
+// AdminAPIListClarifications lists the unanswered clarifications of a
+// hunt, and the answered ones with ?answered=true
+func (ah *AuthHandler) AdminAPIListClarifications(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	answered, _ := strconv.ParseBool(c.QueryParam("answered"))
+
+	list, err := ah.UserServices.GetClarifications(c.Request().Context(), huntID, answered)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// AdminAPIAnswerClarification answers a clarification, privately or to
+// every team
+func (ah *AuthHandler) AdminAPIAnswerClarification(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	var req struct {
+		Answer string `json:"answer"`
+		Public bool   `json:"public"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	cl, err := ah.answerClarification(c.Request().Context(), id, req.Answer, req.Public)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, cl)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// CompressionConfig configures response compression
+type CompressionConfig struct {
+	// Level is the gzip level from 1 (fastest) to 9 (smallest); anything
+	// else uses the default
+	Level int
+
+	// MinLength is the smallest response worth compressing, default 1024 bytes
+	MinLength int
+}
+
+// uncompressedRoutes stream or hold media that is already compressed.
+// Event streams must reach the client as soon as each event is written,
+// media is served with byte ranges that refer to the stored object, and
+// profiles are gzipped by pprof itself
+var uncompressedRoutes = map[string]bool{
+	"/api/events":                    true,
+	"/api/events-test":               true,
+	"/api/ws":                        true,
+	"/api/countdown":                 true,
+	"/spectate/events":               true,
+	"/api/admin/events":              true,
+	"/media/:key":                    true,
+	"/api/admin/debug/pprof/:name":   true,
+	"/api/admin/debug/pprof/profile": true,
+	"/su/debug/pprof/:name":          true,
+	"/su/debug/pprof/profile":        true,
+}
+
+// CompressionMiddleware gzips responses for clients that accept it
+func CompressionMiddleware(cfg CompressionConfig) echo.MiddlewareFunc {
+	if cfg.Level < 1 || cfg.Level > 9 {
+		cfg.Level = -1
+	}
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = 1024
+	}
+
+	return middleware.GzipWithConfig(middleware.GzipConfig{
+		Level:     cfg.Level,
+		MinLength: cfg.MinLength,
+		Skipper: func(c echo.Context) bool {
+			if uncompressedRoutes[c.Path()] {
+				return true
+			}
+			// Catch streams and upgrades on routes added later too
+			req := c.Request()
+			return strings.Contains(req.Header.Get(echo.HeaderAccept), "text/event-stream") ||
+				req.Header.Get("Upgrade") != ""
+		},
+	})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/i18n"
+	"github.com/namishh/holmes/services"
+)
+
+// countdownTick is how often the countdown stream sends the time left
+const countdownTick = time.Second
+
+// CountdownSSEHandler streams the time left until the hunt starts, once a
+// second, then sends hunt_started and closes. The start is read again on
+// every tick, so moving it in the admin panel shows up straight away
+func (ah *AuthHandler) CountdownSSEHandler(c echo.Context) error {
+	c.Response().Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	c.Response().Header().Set("Cache-Control", "no-cache, no-transform")
+	c.Response().Header().Set("Connection", "keep-alive")
+	c.Response().Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
+	c.Response().WriteHeader(http.StatusOK)
+	c.Response().Flush()
+
+	// Registered only to hear when the server shuts down
+	teamID, _ := c.Get(user_id_key).(int)
+	client := ah.Broadcaster.RegisterClient(uuid.New().String(), teamID, ah.eventHunt(c))
+	defer ah.Broadcaster.UnregisterClient(client)
+
+	send := func(event services.Event) error {
+		event.Timestamp = time.Now()
+		if _, err := c.Response().Write([]byte(services.FormatSSE(event))); err != nil {
+			return err
+		}
+		c.Response().Flush()
+		return nil
+	}
+
+	ticker := time.NewTicker(countdownTick)
+	defer ticker.Stop()
+
+	for {
+		window := ah.UserServices.TeamWindow(c.Request().Context(), teamID)
+		if window.Started(time.Now()) {
+			return send(services.Event{
+				Type: services.EventHuntStarted,
+				Data: map[string]interface{}{"redirect": "/hunt"},
+			})
+		}
+		err := send(services.Event{
+			Type: services.EventCountdownTick,
+			Data: map[string]interface{}{
+				"starts_at":    window.Start,
+				"seconds_left": int(math.Ceil(time.Until(window.Start).Seconds())),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case event := <-client.Channel:
+			if event.Type == services.EventReconnect {
+				// The server is shutting down
+				return send(event)
+			}
+		case <-client.Disconnect:
+			return nil
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
+
+// huntRules describes how the hunt is played with the current settings,
+// for the countdown page
+func (ah *AuthHandler) huntRules(ctx context.Context, window services.HuntWindow) []string {
+	rules := []string{i18n.T(ctx, "Each question allows 5 answers.")}
+	if ah.UserServices.FlagEnabled(ctx, services.FlagPenalties) {
+		rules = append(rules, i18n.T(ctx, "The first wrong answer to a question is a warning; the next ones cost 10%, 30%, 50% and 70% of its points."))
+	}
+	if ah.UserServices.FlagEnabled(ctx, services.FlagExclusiveSolve) {
+		rules = append(rules, i18n.T(ctx, "A question closes once any team solves it, and is held by a team while it works on it."))
+	}
+	if ah.UserServices.FlagEnabled(ctx, services.FlagQuotas) {
+		rules = append(rules, i18n.T(ctx, "You can solve up to %d questions every %s.", services.QuotaLimit, formatSlot(ctx, services.SlotDuration)))
+	}
+	rules = append(rules, i18n.T(ctx, "Hints cost points, taken from your score when you open them."))
+	if !window.End.IsZero() {
+		rules = append(rules, i18n.T(ctx, "Answers close at %s.", window.End.Format("Jan 2, 15:04 MST")))
+	}
+	return rules
+}
+
+// formatSlot writes a quota slot length in whole hours or minutes when it
+// is one, in the language of ctx
+func formatSlot(ctx context.Context, d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return i18n.T(ctx, "hour")
+	case d%time.Hour == 0:
+		return i18n.T(ctx, "%d hours", int(d.Hours()))
+	case d%time.Minute == 0:
+		return i18n.T(ctx, "%d minutes", int(d.Minutes()))
+	}
+	return d.String()
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+// creditResult is what a team's solve is worth after partial credit
+type creditResult struct {
+	TeamID         int `json:"team_id"`
+	QuestionID     int `json:"question_id"`
+	Points         int `json:"points"`
+	QuestionPoints int `json:"question_points"`
+	Percent        int `json:"percent"`
+}
+
+// creditError maps partial credit errors to play errors
+func creditError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredit):
+		return newPlayError(http.StatusBadRequest, "%s", err.Error())
+	case errors.Is(err, services.ErrTeamNotFound):
+		return newPlayError(http.StatusNotFound, "Team not found")
+	case errors.Is(err, services.ErrSolveNotFound):
+		return newPlayError(http.StatusNotFound, "%s", err.Error())
+	}
+	return err
+}
+
+// awardCredit gives a team share of of parts of a question's points,
+// multiplied by its category's weight like any solve. A team that hasn't
+// solved the question gets a solve worth that much; one that has gets its
+// solve regraded, up or down, and its score moved by the difference.
+// huntID limits the question to one hunt, 0 for any
+func (ah *AuthHandler) awardCredit(ctx context.Context, huntID, teamID, questionID, share, of int) (creditResult, error) {
+	if err := services.CheckCredit(share, of); err != nil {
+		return creditResult{}, creditError(err)
+	}
+	question, err := ah.UserServices.GetQuestionById(ctx, questionID)
+	if err != nil || (huntID != 0 && question.HuntID != huntID) {
+		return creditResult{}, newPlayError(http.StatusNotFound, "Question not found")
+	}
+	teamHunt, err := ah.UserServices.TeamHuntID(ctx, teamID)
+	if err != nil {
+		return creditResult{}, creditError(err)
+	}
+	if teamHunt != question.HuntID {
+		return creditResult{}, newPlayError(http.StatusBadRequest, "The team doesn't play this question's hunt")
+	}
+
+	credit := services.CreditPoints(question.Points, share, of)
+	weight := ah.UserServices.GetCategoryWeights(ctx).For(question.Category)
+	points := services.WeightedPoints(credit, weight)
+	result := creditResult{TeamID: teamID, QuestionID: questionID, Points: points, QuestionPoints: question.Points, Percent: services.CreditPercent(credit, question.Points)}
+	link := fmt.Sprintf("/hunt/question/%d", questionID)
+
+	solved, err := ah.UserServices.IsQuestionSolvedByTeam(ctx, teamID, questionID)
+	if err != nil {
+		return creditResult{}, err
+	}
+	if solved {
+		old, err := ah.UserServices.RegradeSolve(ctx, teamID, questionID, points)
+		if err != nil {
+			return creditResult{}, creditError(err)
+		}
+		if old != points {
+			ah.Broadcaster.Broadcast(services.EventLeaderboardUpdate, map[string]interface{}{
+				"message": "Leaderboard updated",
+			})
+			ah.notify(ctx, teamID, services.NotificationCredit, "Credit changed",
+				fmt.Sprintf("Your solve of %s is now worth %d points, %d%% credit", question.Title, points, result.Percent), link)
+		}
+		return result, nil
+	}
+
+	users, err := ah.UserServices.GetAllUsers(ctx, teamHunt)
+	if err != nil {
+		return creditResult{}, err
+	}
+	var teamName string
+	for _, u := range users {
+		if u.ID == teamID {
+			teamName = u.Username
+		}
+	}
+	question.Points = credit
+	if _, err := ah.awardSolve(ctx, teamID, teamName, question, fmt.Sprintf("partial credit %d/%d", share, of), ""); err != nil {
+		return creditResult{}, err
+	}
+	ah.notify(ctx, teamID, services.NotificationCredit, "Partial credit",
+		fmt.Sprintf("You earned %d points for %s, %d%% credit", points, question.Title, result.Percent), link)
+	return result, nil
+}
+
+// creditParts reads the credit asked for: parts done of parts when parts
+// is given, otherwise a percentage
+func creditParts(percent, done, parts string) (int, int) {
+	if parts != "" {
+		share, _ := strconv.Atoi(done)
+		of, _ := strconv.Atoi(parts)
+		return share, of
+	}
+	share, _ := strconv.Atoi(percent)
+	return share, 100
+}
+
+// AdminCreditHandler awards partial credit from the solved questions page
+func (ah *AuthHandler) AdminCreditHandler(c echo.Context) error {
+	teamID, err := strconv.Atoi(c.FormValue("team_id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid team ID")
+	}
+	questionID, err := strconv.Atoi(c.FormValue("question_id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid question ID")
+	}
+	share, of := creditParts(c.FormValue("percent"), c.FormValue("done"), c.FormValue("parts"))
+	if _, err := ah.awardCredit(c.Request().Context(), ah.adminHunt(c), teamID, questionID, share, of); err != nil {
+		return playErrorString(c, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/solved-questions")
+}
+
+// AdminAPICredit awards a team partial credit for a question, as a
+// percentage or as parts done of parts
+func (ah *AuthHandler) AdminAPICredit(c echo.Context) error {
+	teamID, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	var req struct {
+		QuestionID int  `json:"question_id"`
+		Percent    *int `json:"percent"`
+		Done       int  `json:"done"`
+		Parts      int  `json:"parts"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid request", nil)
+	}
+	share, of := req.Done, req.Parts
+	if req.Percent != nil {
+		share, of = *req.Percent, 100
+	}
+	result, err := ah.awardCredit(c.Request().Context(), 0, teamID, req.QuestionID, share, of)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// swaggerUIVersion pins the swagger-ui-dist release the docs page loads
+const swaggerUIVersion = "5.17.14"
+
+// OpenAPISpecHandler serves the OpenAPI description of the JSON endpoints
+func (ah *AuthHandler) OpenAPISpecHandler(c echo.Context) error {
+	return c.Blob(http.StatusOK, "application/yaml", openAPISpec)
+}
+
+// SwaggerUIHandler serves an interactive explorer for the OpenAPI spec
+func (ah *AuthHandler) SwaggerUIHandler(c echo.Context) error {
+	// Swagger UI is loaded from unpkg, which the site-wide policy doesn't allow
+	c.Response().Header().Set("Content-Security-Policy",
+		"default-src 'self'; script-src 'self' 'unsafe-inline' https://unpkg.com; style-src 'self' 'unsafe-inline' https://unpkg.com; img-src 'self' data: https:;")
+
+	return c.HTML(http.StatusOK, `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8"/>
+	<title>Holmes API</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@`+swaggerUIVersion+`/swagger-ui.css"/>
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@`+swaggerUIVersion+`/swagger-ui-bundle.js"></script>
+	<script>
+		window.ui = SwaggerUIBundle({ url: '/api/openapi.yaml', dom_id: '#swagger-ui' });
+	</script>
+</body>
+</html>`)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// teamActionError maps suspension and merge errors to play errors
+func teamActionError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrTeamNotFound):
+		return newPlayError(http.StatusNotFound, "Team not found")
+	case errors.Is(err, services.ErrMergeSelf), errors.Is(err, services.ErrMergeHunts):
+		return newPlayError(http.StatusBadRequest, "%s", err)
+	}
+	return err
+}
+
+// AdminDuplicatesHandler shows the teams of the hunt being managed that
+// look like the same people, and the suspended teams
+func (ah *AuthHandler) AdminDuplicatesHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	pairs, err := ah.UserServices.FindDuplicates(c.Request().Context(), ah.adminHunt(c))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error finding duplicates: %s", err))
+	}
+	teams, err := ah.UserServices.GetAllUsers(c.Request().Context(), ah.adminHunt(c))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching teams: %s", err))
+	}
+	suspended := make([]services.User, 0)
+	for _, t := range teams {
+		if t.SuspendedAt != nil {
+			suspended = append(suspended, t)
+		}
+	}
+
+	view := panel.Duplicates(fromProtected, pairs, suspended)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.DuplicatesIndex(
+		"Duplicates",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminSuspendTeam stops a team from logging in and playing
+func (ah *AuthHandler) AdminSuspendTeam(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid team ID")
+	}
+	if err := ah.UserServices.SuspendTeam(c.Request().Context(), id); err != nil {
+		return playErrorString(c, teamActionError(err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/duplicates")
+}
+
+// AdminUnsuspendTeam lets a suspended team back in
+func (ah *AuthHandler) AdminUnsuspendTeam(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid team ID")
+	}
+	if err := ah.UserServices.UnsuspendTeam(c.Request().Context(), id); err != nil {
+		return playErrorString(c, teamActionError(err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/duplicates")
+}
+
+// AdminMergeTeam folds the team :id into the team :into
+func (ah *AuthHandler) AdminMergeTeam(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid team ID")
+	}
+	into, err := strconv.Atoi(c.Param("into"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid team ID")
+	}
+	if err := ah.UserServices.MergeTeam(c.Request().Context(), id, into); err != nil {
+		return playErrorString(c, teamActionError(err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/duplicates")
+}
+
+// AdminAPIListDuplicates lists the pairs of teams of a hunt that look like
+// the same people
+func (ah *AuthHandler) AdminAPIListDuplicates(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	pairs, err := ah.UserServices.FindDuplicates(c.Request().Context(), huntID)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, pairs)
+}
+
+// AdminAPISuspendTeam stops a team from logging in and playing
+func (ah *AuthHandler) AdminAPISuspendTeam(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if err := ah.UserServices.SuspendTeam(c.Request().Context(), id); err != nil {
+		return apiError(c, teamActionError(err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AdminAPIUnsuspendTeam lets a suspended team back in
+func (ah *AuthHandler) AdminAPIUnsuspendTeam(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if err := ah.UserServices.UnsuspendTeam(c.Request().Context(), id); err != nil {
+		return apiError(c, teamActionError(err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AdminAPIMergeTeam folds a team into the one given as "into"
+func (ah *AuthHandler) AdminAPIMergeTeam(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	var req struct {
+		Into int `json:"into"`
+	}
+	if err := c.Bind(&req); err != nil || req.Into == 0 {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+	if err := ah.UserServices.MergeTeam(c.Request().Context(), id, req.Into); err != nil {
+		return apiError(c, teamActionError(err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/auth"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// emailPageSize is how many emails the admin API lists
+const emailPageSize = 100
+
+// sendVerificationEmail emails a new team the link that confirms its
+// address; without email set up there is nothing to confirm
+func (ah *AuthHandler) sendVerificationEmail(c echo.Context, email string) {
+	if !ah.UserServices.MailEnabled() {
+		return
+	}
+	team, err := ah.UserServices.CheckEmail(c.Request().Context(), email)
+	if err != nil {
+		log.Printf("Warning: Error fetching new team %s: %s", email, err)
+		return
+	}
+	if err := ah.UserServices.SendVerificationEmail(c.Request().Context(), team.ID); err != nil {
+		log.Printf("Warning: Error sending verification email to team %d: %s", team.ID, err)
+	}
+}
+
+// verificationNotice is what a team's own profile says about its
+// unconfirmed email, empty once confirmed or without email set up
+func (ah *AuthHandler) verificationNotice(c echo.Context, teamID int) string {
+	if !ah.UserServices.MailEnabled() {
+		return ""
+	}
+	verified, err := ah.UserServices.IsEmailVerified(c.Request().Context(), teamID)
+	if err != nil || verified {
+		return ""
+	}
+	return "Your team's email isn't confirmed yet. Follow the link we emailed you."
+}
+
+// renderAccountPage renders one of the password and verification pages
+func renderAccountPage(c echo.Context, title string, view templ.Component) error {
+	c.Set("ISERROR", false)
+	return renderView(c, auth.LoginIndex(
+		title,
+		"",
+		false,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// ForgotPasswordHandler emails a reset link to the address entered. The
+// page reads the same whether or not a team uses the address
+func (ah *AuthHandler) ForgotPasswordHandler(c echo.Context) error {
+	if fromProtected, _ := c.Get("FROMPROTECTED").(bool); fromProtected {
+		return c.Redirect(http.StatusSeeOther, "/")
+	}
+
+	errs := make(map[string]string)
+	sent := false
+	if c.Request().Method == "POST" {
+		email := strings.TrimSpace(c.FormValue("email"))
+		if !valid(email) {
+			errs["email"] = "Invalid email address"
+			return renderAccountPage(c, "Forgot Password", auth.ForgotPassword(false, errs, sent))
+		}
+
+		err := ah.UserServices.RequestPasswordReset(c.Request().Context(), email)
+		switch {
+		case errors.Is(err, services.ErrMailDisabled):
+			errs["email"] = "Passwords can't be reset by email here; ask the organisers"
+		case err != nil:
+			return c.String(http.StatusInternalServerError, "Error sending the reset link")
+		default:
+			sent = true
+		}
+	}
+
+	return renderAccountPage(c, "Forgot Password", auth.ForgotPassword(false, errs, sent))
+}
+
+// ResetPasswordHandler sets a new password with the token from a reset
+// link, then sends the team to log in with it
+func (ah *AuthHandler) ResetPasswordHandler(c echo.Context) error {
+	if fromProtected, _ := c.Get("FROMPROTECTED").(bool); fromProtected {
+		return c.Redirect(http.StatusSeeOther, "/")
+	}
+
+	errs := make(map[string]string)
+	token := c.FormValue("token")
+	if c.Request().Method == "POST" {
+		err := ah.UserServices.ResetPassword(c.Request().Context(), token, c.FormValue("password"))
+		switch {
+		case errors.Is(err, services.ErrPasswordTooShort):
+			errs["password"] = "Password must be at least 8 characters"
+		case errors.Is(err, services.ErrInvalidEmailToken):
+			errs["password"] = "This reset link is invalid or has expired; ask for a new one"
+		case err != nil:
+			return c.String(http.StatusInternalServerError, "Error resetting password")
+		default:
+			return c.Redirect(http.StatusSeeOther, "/login")
+		}
+	}
+
+	return renderAccountPage(c, "Reset Password", auth.ResetPassword(false, errs, token))
+}
+
+// VerifyEmailHandler confirms a team's address from the emailed link
+func (ah *AuthHandler) VerifyEmailHandler(c echo.Context) error {
+	errs := make(map[string]string)
+	err := ah.UserServices.VerifyEmail(c.Request().Context(), c.QueryParam("token"))
+	switch {
+	case errors.Is(err, services.ErrInvalidEmailToken):
+		errs["token"] = "This link is invalid or has expired"
+	case err != nil:
+		return c.String(http.StatusInternalServerError, "Error confirming email")
+	}
+
+	return renderAccountPage(c, "Confirm Email", auth.EmailVerified(false, errs))
+}
+
+// ResendVerificationHandler emails the team a new verification link
+func (ah *AuthHandler) ResendVerificationHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+
+	err := ah.UserServices.SendVerificationEmail(c.Request().Context(), c.Get(user_id_key).(int))
+	if errors.Is(err, services.ErrMailDisabled) {
+		return c.String(http.StatusServiceUnavailable, "Email is not set up on this server")
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error sending the verification email")
+	}
+	return c.Redirect(http.StatusSeeOther, "/team")
+}
+
+// adminAPIEmails is the state of the outbox
+type adminAPIEmails struct {
+	Enabled bool             `json:"enabled"`
+	Emails  []services.Email `json:"emails"`
+}
+
+// AdminAPIListEmails returns whether email is set up and the latest
+// emails with their delivery state
+func (ah *AuthHandler) AdminAPIListEmails(c echo.Context) error {
+	emails, err := ah.UserServices.GetRecentEmails(c.Request().Context(), emailPageSize)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, adminAPIEmails{Enabled: ah.UserServices.MailEnabled(), Emails: emails})
+}
+
+// AdminAPISendTestEmail queues a test email, to check the SMTP settings
+func (ah *AuthHandler) AdminAPISendTestEmail(c echo.Context) error {
+	var req struct {
+		To string `json:"to"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+	if !valid(req.To) {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid email address"))
+	}
+
+	err := ah.UserServices.SendTestEmail(c.Request().Context(), req.To)
+	if errors.Is(err, services.ErrMailDisabled) {
+		return apiError(c, newPlayError(http.StatusServiceUnavailable, "%s", err))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+// AdminEmailTemplatesHandler lists the email templates and, on POST,
+// saves, previews, emails a test of or resets one of them. Copy that
+// isn't saved stays in the form
+func (ah *AuthHandler) AdminEmailTemplatesHandler(c echo.Context) error {
+	errs := make(map[string]string)
+	notices := make(map[string]string)
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	var preview *services.Email
+	name := c.FormValue("name")
+	subject, body := c.FormValue("subject"), c.FormValue("body")
+	if c.Request().Method == "POST" {
+		ctx := c.Request().Context()
+		switch c.FormValue("action") {
+		case "preview":
+			s, b, err := services.PreviewEmail(name, subject, body)
+			if err != nil {
+				errs[name] = err.Error()
+			} else {
+				preview = &services.Email{Template: name, Subject: s, Body: b}
+			}
+
+		case "test":
+			to := strings.TrimSpace(c.FormValue("to"))
+			if !valid(to) {
+				errs[name] = "Invalid email address"
+				break
+			}
+			err := ah.UserServices.SendEmailPreview(ctx, to, name, subject, body)
+			switch {
+			case errors.Is(err, services.ErrInvalidEmailTemplate), errors.Is(err, services.ErrMailDisabled):
+				errs[name] = err.Error()
+			case err != nil:
+				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error sending test email: %s", err))
+			default:
+				notices[name] = "Test email queued for " + to
+			}
+
+		case "reset":
+			if err := ah.UserServices.ResetEmailTemplate(ctx, name); err != nil {
+				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error resetting email template: %s", err))
+			}
+			return c.Redirect(http.StatusSeeOther, "/su/emails")
+
+		default:
+			err := ah.UserServices.SetEmailTemplate(ctx, name, subject, body)
+			if errors.Is(err, services.ErrInvalidEmailTemplate) {
+				errs[name] = err.Error()
+				break
+			}
+			if err != nil {
+				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving email template: %s", err))
+			}
+			return c.Redirect(http.StatusSeeOther, "/su/emails")
+		}
+	}
+
+	templates, err := ah.UserServices.GetEmailTemplates(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching email templates: %s", err))
+	}
+	if c.Request().Method == "POST" {
+		for i := range templates {
+			if templates[i].Name == name {
+				templates[i].Subject, templates[i].Body = subject, body
+			}
+		}
+	}
+
+	view := panel.EmailTemplates(fromProtected, templates, errs, notices, preview, ah.UserServices.MailEnabled())
+	c.Set("ISERROR", false)
+	return renderView(c, panel.EmailTemplatesIndex(
+		"Emails",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"strings"
 
 	"github.com/namishh/holmes/views/errors"
 
@@ -10,13 +12,64 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// APIError is the body of every failed API response
+// Code is a stable, machine-readable name for the status (e.g. "not_found"),
+// Message is meant for people and Details optionally carries structured
+// context such as per-field validation errors
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// errorCode turns a status into its machine-readable code, e.g. 404 -> "not_found"
+func errorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
+
+// jsonError answers an API request with the error envelope
+func jsonError(c echo.Context, status int, message string, details interface{}) error {
+	return c.JSON(status, APIError{
+		Code:    errorCode(status),
+		Message: message,
+		Details: details,
+	})
+}
+
+// isAPIRequest reports whether a failure should be reported as JSON rather
+// than with an error page
+func isAPIRequest(c echo.Context) bool {
+	return strings.HasPrefix(c.Request().URL.Path, "/api/") || wantsJSON(c)
+}
+
 func CustomHTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
 	code := http.StatusInternalServerError
+	message := http.StatusText(code)
 	if he, ok := err.(*echo.HTTPError); ok {
 		code = he.Code
+		// Only client errors describe the request; server errors may carry
+		// internals such as SQL errors, so they get the generic text
+		if msg, ok := he.Message.(string); ok && code < 500 {
+			message = msg
+		} else {
+			message = http.StatusText(code)
+		}
 	}
 	c.Logger().Error(err)
 
+	if isAPIRequest(c) {
+		jsonError(c, code, message, nil)
+		return
+	}
+
 	var errorPage func(fp bool) templ.Component
 
 	switch code {
@@ -24,7 +77,7 @@ func CustomHTTPErrorHandler(err error, c echo.Context) {
 		errorPage = errors.Error401
 	case 404:
 		errorPage = errors.Error404
-	case 500:
+	default:
 		errorPage = errors.Error500
 	}
 
@@ -37,6 +90,8 @@ func CustomHTTPErrorHandler(err error, c echo.Context) {
 		fromProtected = fp
 	}
 
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTML)
+	c.Response().WriteHeader(code)
 	renderView(c, errors.ErrorIndex(
 		fmt.Sprintf("Error (%d)", code),
 		fromProtected,
@@ -45,11 +100,36 @@ func CustomHTTPErrorHandler(err error, c echo.Context) {
 }
 
 func RouteNotFoundHandler(c echo.Context) error {
+	if isAPIRequest(c) {
+		return jsonError(c, http.StatusNotFound, "Not found", nil)
+	}
+
 	// Hardcoded parameters
 
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTML)
+	c.Response().WriteHeader(http.StatusNotFound)
 	return renderView(c, errors.ErrorIndex(
 		fmt.Sprintf("Error (%d)", 404),
 		false,
 		errors.Error404(false),
 	))
 }
+
+// adminError answers a failed admin panel request with message alone. The
+// error, which may carry internals such as SQL errors, is only logged. API
+// clients get the JSON error envelope
+func adminError(c echo.Context, status int, message string, err error) error {
+	if err != nil {
+		logServerError(c, err)
+	}
+	if isAPIRequest(c) {
+		return jsonError(c, status, message, nil)
+	}
+	return c.String(status, message)
+}
+
+// logServerError records the cause of a 5xx before it is replaced by a
+// generic message in the response
+func logServerError(c echo.Context, err error) {
+	log.Printf("Error serving %s %s: %v", c.Request().Method, c.Request().URL.Path, err)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// sendTeamExport sends everything stored about a team as a JSON download.
+// Admins' notes about the team are only included when internal is set
+func (ah *AuthHandler) sendTeamExport(c echo.Context, teamID int, internal bool) error {
+	export, err := ah.UserServices.ExportTeamData(c.Request().Context(), teamID, internal)
+	if err != nil {
+		return teamActionError(err)
+	}
+
+	name := fmt.Sprintf("team-%d-data-%s.json", teamID, export.ExportedAt.Format("20060102T150405Z"))
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name))
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.JSONPretty(http.StatusOK, export, "  ")
+}
+
+// MyDataHandler downloads everything stored about the signed in team
+func (ah *AuthHandler) MyDataHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	if err := ah.sendTeamExport(c, c.Get(user_id_key).(int), false); err != nil {
+		return playErrorString(c, err)
+	}
+	return nil
+}
+
+// APIExportMyData returns everything stored about the caller's team
+func (ah *AuthHandler) APIExportMyData(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	if err := ah.sendTeamExport(c, c.Get(user_id_key).(int), false); err != nil {
+		return apiError(c, err)
+	}
+	return nil
+}
+
+// AdminExportTeamHandler downloads everything stored about a team,
+// including admins' notes about it, to answer a data request
+func (ah *AuthHandler) AdminExportTeamHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid team ID")
+	}
+	if err := ah.sendTeamExport(c, id, true); err != nil {
+		return playErrorString(c, err)
+	}
+	return nil
+}
+
+// AdminAPIExportTeam returns everything stored about a team, including
+// admins' notes about it
+func (ah *AuthHandler) AdminAPIExportTeam(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if err := ah.sendTeamExport(c, id, true); err != nil {
+		return apiError(c, err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// submitFeedback saves the team's rating of a question of its hunt
+func (ah *AuthHandler) submitFeedback(ctx context.Context, teamID, questionID, difficulty, fun int, comment string) (services.QuestionFeedback, error) {
+	if err := ah.checkHuntOpen(ctx, teamID, false); err != nil {
+		return services.QuestionFeedback{}, err
+	}
+
+	question, err := ah.UserServices.GetQuestionById(ctx, questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return services.QuestionFeedback{}, newPlayError(http.StatusNotFound, "Question not found")
+	}
+	if err != nil {
+		return services.QuestionFeedback{}, newPlayError(http.StatusInternalServerError, "Error fetching question")
+	}
+	if ok, err := ah.inTeamHunt(ctx, teamID, question.HuntID); err != nil {
+		return services.QuestionFeedback{}, newPlayError(http.StatusInternalServerError, "Error fetching question")
+	} else if !ok {
+		return services.QuestionFeedback{}, newPlayError(http.StatusNotFound, "Question not found")
+	}
+
+	f, err := ah.UserServices.SubmitFeedback(ctx, teamID, questionID, difficulty, fun, comment)
+	switch {
+	case errors.Is(err, services.ErrInvalidRating):
+		return services.QuestionFeedback{}, newPlayError(http.StatusBadRequest, "Ratings go from 1 to 5")
+	case errors.Is(err, services.ErrFeedbackTooLong):
+		return services.QuestionFeedback{}, newPlayError(http.StatusBadRequest, "Comments can be at most %d characters", services.FeedbackCommentMaxLength)
+	case errors.Is(err, services.ErrFeedbackNotAllowed):
+		return services.QuestionFeedback{}, newPlayError(http.StatusForbidden, "%s", err)
+	case err != nil:
+		return services.QuestionFeedback{}, newPlayError(http.StatusInternalServerError, "Error saving feedback: %s", err)
+	}
+	return f, nil
+}
+
+// questionFeedback reports whether the team may rate a question and the
+// rating it gave, if any. The admin session rates nothing
+func (ah *AuthHandler) questionFeedback(c echo.Context, questionID int) (bool, *services.QuestionFeedback) {
+	if isAdminSession(c) {
+		return false, nil
+	}
+	ctx := c.Request().Context()
+	teamID := c.Get(user_id_key).(int)
+
+	canRate, err := ah.UserServices.CanRateQuestion(ctx, teamID, questionID)
+	if err != nil || !canRate {
+		return false, nil
+	}
+	feedback, _ := ah.UserServices.GetTeamFeedback(ctx, teamID, questionID)
+	return true, feedback
+}
+
+// FeedbackHandler rates a question from its page and goes back to it
+func (ah *AuthHandler) FeedbackHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid question ID")
+	}
+	difficulty, _ := strconv.Atoi(c.FormValue("difficulty"))
+	fun, _ := strconv.Atoi(c.FormValue("fun"))
+
+	_, err = ah.submitFeedback(c.Request().Context(), c.Get(user_id_key).(int), questionID, difficulty, fun, c.FormValue("comment"))
+	if err == errHuntNotStarted {
+		return c.Redirect(http.StatusSeeOther, "/hunt")
+	}
+	if err != nil {
+		return playErrorString(c, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/hunt/question/"+strconv.Itoa(questionID))
+}
+
+// apiFeedback is the team's rating of a question, null before it rates it
+type apiFeedback struct {
+	CanRate  bool                       `json:"can_rate"`
+	Feedback *services.QuestionFeedback `json:"feedback"`
+}
+
+// APIGetFeedback returns whether the team may rate a question and how it
+// rated it
+func (ah *AuthHandler) APIGetFeedback(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid question ID"))
+	}
+	if _, err := ah.UserServices.GetQuestionById(c.Request().Context(), questionID); errors.Is(err, sql.ErrNoRows) {
+		return apiError(c, newPlayError(http.StatusNotFound, "Question not found"))
+	} else if err != nil {
+		return apiError(c, err)
+	}
+
+	canRate, feedback := ah.questionFeedback(c, questionID)
+	return c.JSON(http.StatusOK, apiFeedback{CanRate: canRate, Feedback: feedback})
+}
+
+// APISubmitFeedback rates a question, replacing the team's earlier rating
+func (ah *AuthHandler) APISubmitFeedback(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid question ID"))
+	}
+	var req struct {
+		Difficulty int    `json:"difficulty"`
+		Fun        int    `json:"fun"`
+		Comment    string `json:"comment"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	f, err := ah.submitFeedback(c.Request().Context(), c.Get(user_id_key).(int), questionID, req.Difficulty, req.Fun, req.Comment)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, apiFeedback{CanRate: true, Feedback: &f})
+}
+
+// AdminFeedbackHandler shows how teams rated the questions of the hunt the
+// panel is switched to
+func (ah *AuthHandler) AdminFeedbackHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	report, err := ah.UserServices.GetFeedbackReport(c.Request().Context(), ah.adminHunt(c))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching feedback: %s", err))
+	}
+
+	c.Set("ISERROR", false)
+	return renderView(c, panel.FeedbackIndex(
+		"Feedback",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		panel.Feedback(report),
+	))
+}
+
+// AdminAPIFeedbackReport returns the average ratings and comments of every
+// question of a hunt
+func (ah *AuthHandler) AdminAPIFeedbackReport(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	report, err := ah.UserServices.GetFeedbackReport(c.Request().Context(), huntID)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
@@ -1,18 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 	"github.com/namishh/holmes/services"
 	"github.com/namishh/holmes/views/pages"
 	"github.com/namishh/holmes/views/pages/hunt"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func (ah *AuthHandler) HomeHandler(c echo.Context) error {
@@ -44,38 +45,72 @@ func (ah *AuthHandler) HomeHandler(c echo.Context) error {
 }
 
 func (ah *AuthHandler) Hunt(c echo.Context) error {
+	if wantsJSON(c) {
+		return ah.APIQuestions(c)
+	}
+
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
 	teamID := c.Get(user_id_key).(int)
-	questions, err := ah.UserServices.GetAllQuestionsWithStatus(teamID)
-	if err != nil {
+	if pending, err := ah.UserServices.RulesPending(c.Request().Context(), teamID); err != nil {
 		return err
+	} else if pending {
+		return c.Redirect(http.StatusSeeOther, "/rules")
+	}
+
+	window := ah.UserServices.TeamWindow(c.Request().Context(), teamID)
+	if !window.Started(time.Now()) {
+		return ah.renderCountdown(c, fromProtected, window)
 	}
-	hasCompleted, err := ah.UserServices.HasCompletedAllQuestions(teamID)
+	huntOver := window.Ended(time.Now())
+
+	huntID, err := ah.requestHunt(c)
 	if err != nil {
 		return err
 	}
-	
-	// Get quota information
-	quotaSlot, err := ah.UserServices.GetQuotaSlot(teamID)
+	questions, err := ah.UserServices.GetAllQuestionsWithStatus(c.Request().Context(), huntID, teamID)
 	if err != nil {
 		return err
 	}
-	
-	// Get actual completed questions count
-	actualCount, err := ah.UserServices.GetActualCompletedQuestionsCount(teamID)
+	hasCompleted, err := ah.UserServices.HasCompletedAllQuestions(c.Request().Context(), huntID, teamID)
 	if err != nil {
 		return err
 	}
 	
-	// Update quota slot display with actual count
-	if quotaSlot != nil {
+	// Get quota information; the banner is hidden while quotas are off and
+	// once the hunt is over
+	var quotaSlot *services.QuotaSlot
+	if !huntOver && ah.UserServices.FlagEnabled(c.Request().Context(), services.FlagQuotas) {
+		quotaSlot, err = ah.UserServices.GetQuotaSlot(c.Request().Context(), teamID)
+		if err != nil {
+			return err
+		}
+
+		// Get actual completed questions count
+		actualCount, err := ah.UserServices.GetActualCompletedQuestionsCount(c.Request().Context(), teamID)
+		if err != nil {
+			return err
+		}
+
+		// Update quota slot display with actual count
 		quotaSlot.QuestionsSolvedInSlot = actualCount
 	}
 	
-	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
-	if !ok {
-		return errors.New("invalid type for key 'FROMPROTECTED'")
+	// The streak banner shows while bonuses are paid, confirming the bonus
+	// of the solve that sent the team here
+	bonus := ah.UserServices.GetStreakBonus(c.Request().Context())
+	streak := 0
+	if !huntOver && bonus.Points > 0 {
+		streak, err = ah.UserServices.GetTeamStreak(c.Request().Context(), teamID)
+		if err != nil {
+			return err
+		}
 	}
-	quizview := hunt.Hunt(fromProtected, questions, hasCompleted, quotaSlot)
+
+	quizview := hunt.Hunt(fromProtected, questions, hasCompleted, quotaSlot, huntOver, huntOver && ah.UserServices.SolutionsRevealed(c.Request().Context(), teamID), streak, bonus)
 	c.Set("ISERROR", false)
 	return renderView(c, hunt.HuntIndex(
 		"Hunt",
@@ -87,41 +122,36 @@ func (ah *AuthHandler) Hunt(c echo.Context) error {
 }
 
 func (ah *AuthHandler) UnlockHint(c echo.Context) error {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		return err
+	if wantsJSON(c) {
+		return ah.APIUnlockHint(c)
 	}
 
-	hastaken, err := ah.UserServices.HasTeamUnlockedHint(c.Get(user_id_key).(int), id)
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		return err
 	}
 
-	hint, worth, err := ah.UserServices.GetHintById(id)
-
-	user, _ := ah.UserServices.CheckUsername(c.Get(user_name_key).(string))
-
-	if !hastaken {
-		if user.Points < worth {
-			quizview := hunt.OutOfPoints()
-			c.Set("ISERROR", true)
-			fromProtected, _ := c.Get("FROMPROTECTED").(bool)
-			return renderView(c, hunt.OutOfPointsIndex(
-				"Hint",
-				c.Get(user_name_key).(string),
-				fromProtected,
-				c.Get("ISERROR").(bool),
-				quizview,
-			))
-		}
-		err := ah.UserServices.UnlockHintForTeam(c.Get(user_id_key).(int), id, worth)
-		if err != nil {
-			return err
-		}
+	hint, hastaken, err := ah.buyHint(c.Request().Context(), c.Get(user_id_key).(int), c.Get(user_name_key).(string), id)
+	if err == errHuntNotStarted {
+		return c.Redirect(http.StatusSeeOther, "/hunt")
+	}
+	if err == errHuntOver {
+		return ah.renderHuntOver(c)
+	}
+	if err == errNotEnoughPoints {
+		quizview := hunt.OutOfPoints()
+		c.Set("ISERROR", true)
+		fromProtected, _ := c.Get("FROMPROTECTED").(bool)
+		return renderView(c, hunt.OutOfPointsIndex(
+			"Hint",
+			c.Get(user_name_key).(string),
+			fromProtected,
+			c.Get("ISERROR").(bool),
+			quizview,
+		))
 	}
-
 	if err != nil {
-		return err
+		return playErrorString(c, err)
 	}
 
 	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
@@ -140,6 +170,13 @@ func (ah *AuthHandler) UnlockHint(c echo.Context) error {
 }
 
 func (ah *AuthHandler) Question(c echo.Context) error {
+	if wantsJSON(c) {
+		if c.Request().Method == "POST" {
+			return ah.APISubmitAnswer(c)
+		}
+		return ah.APIQuestion(c)
+	}
+
 	errs := make(map[string]string)
 	lvl, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -147,60 +184,17 @@ func (ah *AuthHandler) Question(c echo.Context) error {
 	}
 	
 	teamID := c.Get(user_id_key).(int)
-	
-	question, err := ah.UserServices.GetQuestionById(lvl)
-	if err != nil {
-		return c.String(http.StatusInternalServerError, "Error fetching question")
-	}
-	media, err := ah.UserServices.GetMediaByQuestionId(lvl)
-	if err != nil {
-		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching media: %s", err))
-	}
+	teamName := c.Get(user_name_key).(string)
 
-	hasCompleted, err := ah.UserServices.IsQuestionSolvedByTeam(teamID, lvl)
-	if err != nil {
-		return err
-	}
-
-	// Check quota - can the team solve more questions in this time slot?
-	canSolve, quotaSlot, err := ah.UserServices.CanSolveQuestion(teamID)
-	if err != nil {
-		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error checking quota: %s", err))
-	}
-	
-	if !canSolve && !hasCompleted {
-		timeRemaining, _ := ah.UserServices.GetTimeUntilQuotaReset(teamID)
-		hours := int(timeRemaining.Hours())
-		minutes := int(timeRemaining.Minutes()) % 60
-		return c.String(http.StatusForbidden, fmt.Sprintf("Question quota exhausted! You've solved %d/%d questions in this slot. New slot starts in %dh %dm", 
-			quotaSlot.QuestionsSolvedInSlot, 10, hours, minutes))
-	}
-
-	// Check if question has been solved by ANYONE
-	solvedByAnyone, err := ah.UserServices.IsQuestionSolvedByAnyone(lvl)
-	if err != nil {
-		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error checking if question is solved: %s", err))
+	qs, err := ah.loadQuestion(c.Request().Context(), teamID, lvl)
+	if err == errHuntNotStarted {
+		return c.Redirect(http.StatusSeeOther, "/hunt")
 	}
-
-	// If question is already solved by someone, it should not be lockable
-	if solvedByAnyone && !hasCompleted {
-		return c.String(http.StatusForbidden, "This question has already been solved by another team")
+	if err == errRulesPending {
+		return c.Redirect(http.StatusSeeOther, "/rules")
 	}
-
-	// Check if question is locked by another user
-	isLocked, lockInfo, err := ah.UserServices.IsQuestionLocked(lvl)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error checking lock status: %s", err))
-	}
-	
-	// If locked by another user, deny access
-	if isLocked && lockInfo.LockedByTeamID != teamID {
-		return c.String(http.StatusForbidden, fmt.Sprintf("Question is currently being solved by %s", lockInfo.LockedByName))
-	}
-
-	hints, err := ah.UserServices.GetHintsByQuestionID(lvl)
-	if err != nil {
-		return err
+		return playErrorString(c, err)
 	}
 
 	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
@@ -209,117 +203,36 @@ func (ah *AuthHandler) Question(c echo.Context) error {
 	}
 
 	if c.Request().Method == "POST" {
-		sess, _ := session.Get(auth_sessions_key, c)
-		if auth := sess.Values[user_type]; auth == "admin" {
+		if isAdminSession(c) {
 			return c.String(http.StatusForbidden, "Admin cannot solve questions")
 		}
 
-		if hasCompleted {
-			return c.String(http.StatusForbidden, "Question already solved")
-		}
-
-		// Check if question attempts are exhausted
-		exhausted, err := ah.UserServices.IsQuestionExhausted(teamID, lvl)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error checking attempts: %s", err))
-		}
-		if exhausted {
-			return c.String(http.StatusForbidden, "Maximum attempts (5) reached for this question")
+		result, err := ah.submitAnswer(c.Request().Context(), teamID, teamName, qs, c.FormValue("answer"), c.FormValue("location"), c.RealIP())
+		if err == errHuntOver {
+			return ah.renderHuntOver(c)
 		}
-
-		answer := c.FormValue("answer")
-		if bcrypt.CompareHashAndPassword([]byte(question.Answer), []byte(answer)) == nil {
-			// Correct Answer
-			// Stop the timer
-			err = ah.UserServices.StopQuestionTimer(teamID, lvl)
-			if err != nil {
-				log.Printf("Warning: Error stopping timer: %s", err)
-			}
-			
-			err = ah.UserServices.MarkQuestionAsCompleted(teamID, lvl)
-			if err != nil {
-				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error Validating: %s", err))
-			}
-			err = ah.UserServices.AddPointsToTeam(teamID, question.Points)
-			if err != nil {
-				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error adding Points: %s", err))
-			}
-			err = ah.UserServices.UpdateTeamLastAnsweredQuestion(teamID)
-			if err != nil {
-				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error updating time: %s", err))
-			}
-			
-			// Increment quota count
-			err = ah.UserServices.IncrementQuotaCount(teamID)
-			if err != nil {
-				log.Printf("Warning: Error incrementing quota count: %s", err)
-			}
-			
-			// Unlock the question after successful submission
-			err = ah.UserServices.UnlockQuestion(lvl)
-			if err != nil {
-				log.Printf("Warning: Error unlocking question: %s", err)
-			} else {
-				// Broadcast unlock and solve events
-				ah.Broadcaster.Broadcast(services.EventQuestionUnlocked, map[string]interface{}{
-					"question_id": lvl,
-				})
-				ah.Broadcaster.Broadcast(services.EventQuestionSolved, map[string]interface{}{
-					"question_id": lvl,
-					"team_id":     teamID,
-					"team_name":   c.Get(user_name_key).(string),
-					"points":      question.Points,
-				})
-				ah.Broadcaster.Broadcast(services.EventLeaderboardUpdate, map[string]interface{}{
-					"message": "Leaderboard updated",
-				})
-			}
-			
+		var pe *playError
+		if errors.As(err, &pe) && pe.Status == http.StatusTooManyRequests {
+			// Answering too soon keeps the team on the question, counting down
+			errs["answer"] = pe.Message
+		} else if err != nil {
+			return playErrorString(c, err)
+		} else if result.Correct {
 			return c.Redirect(http.StatusFound, "/hunt")
-		}
-
-		// Wrong Answer - Apply negative marking
-		penalty, attemptsLeft, err := ah.UserServices.RecordWrongAttempt(teamID, lvl, question.Points)
-		if err != nil {
-			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error recording attempt: %s", err))
-		}
-
-		// Deduct penalty points from team's score
-		if penalty > 0 {
-			err = ah.UserServices.DeductPenaltyPoints(teamID, penalty)
-			if err != nil {
-				log.Printf("Warning: Error deducting penalty: %s", err)
-			}
-		}
-
-		// Set error messages with penalty information
-		if penalty == 0 {
-			errs["answer"] = fmt.Sprintf("Incorrect Answer! This is your warning. You have %d attempts left.", attemptsLeft)
-		} else if attemptsLeft > 0 {
-			errs["answer"] = fmt.Sprintf("Incorrect Answer! -%d points penalty. You have %d attempts left.", penalty, attemptsLeft)
 		} else {
-			errs["answer"] = fmt.Sprintf("Incorrect Answer! -%d points penalty. No more attempts left!", penalty)
-			// Unlock the question as attempts are exhausted
-			err = ah.UserServices.UnlockQuestion(lvl)
-			if err != nil {
-				log.Printf("Warning: Error unlocking question: %s", err)
-			} else {
-				// Broadcast unlock event
-				ah.Broadcaster.Broadcast(services.EventQuestionUnlocked, map[string]interface{}{
-					"question_id": lvl,
-					"reason":      "max_attempts_reached",
-				})
-			}
+			errs["answer"] = result.Message
 		}
 
 		// Get updated attempt info to pass to template
-		attemptInfo, _ := ah.UserServices.GetQuestionAttempts(teamID, lvl)
+		canRate, feedback := ah.questionFeedback(c, lvl)
+		attemptInfo, _ := ah.UserServices.GetQuestionAttempts(c.Request().Context(), teamID, lvl)
+		history, _ := ah.UserServices.GetTeamSubmissions(c.Request().Context(), teamID, lvl)
 		
-		quizview := hunt.Question(fromProtected, question, hasCompleted, media, errs, hints, attemptInfo)
+		quizview := hunt.Question(fromProtected, qs.Question, qs.Completed, qs.Revealed, qs.Media, errs, qs.Hints, attemptInfo, history, ah.ownedPowerUps(c.Request().Context(), teamID), qs.Skipped, ah.skipTokensLeft(c.Request().Context(), teamID), canRate, feedback, ah.questionClarifications(c, lvl), qs.Checkpoint, qs.Geofence != nil, ah.teamPhotos(c.Request().Context(), teamID, qs.Question))
 		c.Set("ISERROR", false)
 		return renderView(c, hunt.QuestionIndex(
 			"Solve",
-			c.Get(user_name_key).(string),
+			teamName,
 			fromProtected,
 			c.Get("ISERROR").(bool),
 			quizview,
@@ -327,44 +240,20 @@ func (ah *AuthHandler) Question(c echo.Context) error {
 	}
 
 	// GET request - Check attempts, lock the question and start timer
-	// Check if question attempts are exhausted
-	exhausted, err := ah.UserServices.IsQuestionExhausted(teamID, lvl)
-	if err != nil {
-		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error checking attempts: %s", err))
-	}
-	if exhausted {
-		return c.String(http.StatusForbidden, "Maximum attempts (5) reached for this question")
-	}
-
-	if !hasCompleted && !isLocked {
-		// Lock the question for this user (atomic operation)
-		err = ah.UserServices.LockQuestion(lvl, teamID)
-		if err != nil {
-			log.Printf("Warning: Error locking question: %s", err)
-		} else {
-			// Broadcast lock event to all connected clients
-			ah.Broadcaster.Broadcast(services.EventQuestionLocked, map[string]interface{}{
-				"question_id": lvl,
-				"team_id":     teamID,
-				"team_name":   c.Get(user_name_key).(string),
-			})
-		}
-		
-		// Start the timer
-		err = ah.UserServices.StartQuestionTimer(teamID, lvl)
-		if err != nil {
-			log.Printf("Warning: Error starting timer: %s", err)
-		}
+	if err := ah.openQuestion(c.Request().Context(), teamID, teamName, qs); err != nil {
+		return playErrorString(c, err)
 	}
 
 	// Get attempt info to display to user
-	attemptInfo, _ := ah.UserServices.GetQuestionAttempts(teamID, lvl)
+	canRate, feedback := ah.questionFeedback(c, lvl)
+	attemptInfo, _ := ah.UserServices.GetQuestionAttempts(c.Request().Context(), teamID, lvl)
+	history, _ := ah.UserServices.GetTeamSubmissions(c.Request().Context(), teamID, lvl)
 
-	quizview := hunt.Question(fromProtected, question, hasCompleted, media, errs, hints, attemptInfo)
+	quizview := hunt.Question(fromProtected, qs.Question, qs.Completed, qs.Revealed, qs.Media, errs, qs.Hints, attemptInfo, history, ah.ownedPowerUps(c.Request().Context(), teamID), qs.Skipped, ah.skipTokensLeft(c.Request().Context(), teamID), canRate, feedback, ah.questionClarifications(c, lvl), qs.Checkpoint, qs.Geofence != nil, ah.teamPhotos(c.Request().Context(), teamID, qs.Question))
 	c.Set("ISERROR", false)
 	return renderView(c, hunt.QuestionIndex(
 		"Solve",
-		c.Get(user_name_key).(string),
+		teamName,
 		fromProtected,
 		c.Get("ISERROR").(bool),
 		quizview,
@@ -372,13 +261,20 @@ func (ah *AuthHandler) Question(c echo.Context) error {
 }
 
 func (ah *AuthHandler) Leaderboard(c echo.Context) error {
+	if wantsJSON(c) {
+		return ah.APILeaderboard(c)
+	}
 
 	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
 	if !ok {
 		return errors.New("invalid type for key 'FROMPROTECTED'")
 	}
 
-	users, err := ah.UserServices.GetLeaderbaord()
+	huntID, err := ah.requestHunt(c)
+	if err != nil {
+		return err
+	}
+	users, err := ah.UserServices.GetTeamLeaderboard(c.Request().Context(), huntID, c.Get(user_name_key).(string))
 
 	if err != nil {
 		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching Leaderboard: %s", err))
@@ -389,7 +285,7 @@ func (ah *AuthHandler) Leaderboard(c echo.Context) error {
 	if c.Get(user_name_key).(string) == "admin" {
 		user = services.User{ID: 0, Username: "Admin", Points: 0}
 	} else {
-		user, err = ah.UserServices.CheckUsername(c.Get(user_name_key).(string))
+		user, err = ah.UserServices.CheckUsername(c.Request().Context(), c.Get(user_name_key).(string))
 		if err != nil {
 			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching you: %s", err))
 		}
@@ -405,3 +301,98 @@ func (ah *AuthHandler) Leaderboard(c echo.Context) error {
 		quizview,
 	))
 }
+
+// renderCountdown shows the countdown to the start of the hunt, with the
+// rules and the team's details
+func (ah *AuthHandler) renderCountdown(c echo.Context, fromProtected bool, window services.HuntWindow) error {
+	teamName := c.Get(user_name_key).(string)
+	team := services.User{Username: teamName}
+	if !isAdminSession(c) {
+		user, err := ah.UserServices.CheckUsername(c.Request().Context(), teamName)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching you: %s", err))
+		}
+		team = user
+	}
+
+	c.Set("ISERROR", false)
+	return renderView(c, hunt.ClosedIndex(
+		"Starting Soon",
+		teamName,
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		hunt.Countdown(window.Start, team, ah.huntRules(c.Request().Context(), window)),
+	))
+}
+
+// renderHuntOver tells a team the hunt has ended instead of taking its
+// answer or hint purchase
+func (ah *AuthHandler) renderHuntOver(c echo.Context) error {
+	fromProtected, _ := c.Get("FROMPROTECTED").(bool)
+	c.Set("ISERROR", false)
+	return renderView(c, hunt.ClosedIndex(
+		"Hunt Over",
+		c.Get(user_name_key).(string),
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		hunt.HuntOver(ah.UserServices.TeamWindow(c.Request().Context(), c.Get(user_id_key).(int)).End),
+	))
+}
+
+// PublicLeaderboard shows the leaderboard to visitors who aren't signed
+// in, while the public leaderboard flag is on
+func (ah *AuthHandler) PublicLeaderboard(c echo.Context) error {
+	if !ah.UserServices.FlagEnabled(c.Request().Context(), services.FlagPublicLeaderboard) {
+		return echo.ErrNotFound
+	}
+
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	if fromProtected {
+		return c.Redirect(http.StatusSeeOther, "/hunt/leaderboard")
+	}
+
+	board, err := ah.publicHunt(c)
+	if errors.Is(err, services.ErrHuntNotFound) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching hunt: %s", err))
+	}
+
+	users, err := ah.UserServices.GetLeaderbaord(c.Request().Context(), board.ID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching Leaderboard: %s", err))
+	}
+
+	c.Set("ISERROR", false)
+	return renderView(c, hunt.LeaderboardIndex(
+		"Leaderboard",
+		"",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		hunt.Leaderboard(fromProtected, users, services.User{}),
+	))
+}
+
+// broadcastQuota pushes the team's current quota usage to its own clients
+func (ah *AuthHandler) broadcastQuota(ctx context.Context, teamID int) {
+	slot, err := ah.UserServices.GetQuotaSlot(ctx, teamID)
+	if err != nil {
+		log.Printf("Warning: Error fetching quota for broadcast: %s", err)
+		return
+	}
+	solved, err := ah.UserServices.GetActualCompletedQuestionsCount(ctx, teamID)
+	if err != nil {
+		log.Printf("Warning: Error fetching solved count for broadcast: %s", err)
+		return
+	}
+	ah.Broadcaster.BroadcastToTeam(teamID, services.EventQuotaUpdate, map[string]interface{}{
+		"questions_solved": solved,
+		"slot_solved":      slot.QuestionsSolvedInSlot,
+		"limit":            services.QuotaLimit,
+		"slot_start":       slot.CurrentSlotStart,
+	})
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+// errLocationRequired is returned for answers to a question that is only
+// answered at its place, sent without a proof of being there
+var errLocationRequired = newPlayError(http.StatusForbidden, "Share your location at this question's place to answer it")
+
+// geofenceError maps location errors to play errors
+func geofenceError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidLocation):
+		return newPlayError(http.StatusBadRequest, "Invalid location")
+	case errors.Is(err, services.ErrLocationImprecise):
+		return newPlayError(http.StatusForbidden, "Your location isn't precise enough, try again outdoors")
+	case errors.Is(err, services.ErrOutsideGeofence):
+		return newPlayError(http.StatusForbidden, "You aren't at this question's location")
+	}
+	return err
+}
+
+// APIQuestionLocation checks the location the team's device reported
+// against the place a question is answered at and, inside it, returns the
+// proof to send with the answer
+func (ah *AuthHandler) APIQuestionLocation(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "Admin cannot solve questions"))
+	}
+	lvl, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid question ID"))
+	}
+	var req struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		Accuracy  float64  `json:"accuracy"`
+	}
+	if err := c.Bind(&req); err != nil || req.Latitude == nil || req.Longitude == nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	teamID := c.Get(user_id_key).(int)
+	qs, err := ah.loadQuestion(c.Request().Context(), teamID, lvl)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if qs.Geofence == nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "This question can be answered from anywhere"))
+	}
+
+	proof, err := ah.UserServices.ProveLocation(teamID, *qs.Geofence, *req.Latitude, *req.Longitude, req.Accuracy)
+	if err != nil {
+		return apiError(c, geofenceError(err))
+	}
+	return c.JSON(http.StatusOK, proof)
+}
+
+// parseGeofence reads the place a question is answered at from the edit
+// form, nil when latitude and longitude are left empty
+func parseGeofence(latitude, longitude, radius string) (*services.Geofence, error) {
+	latitude, longitude, radius = strings.TrimSpace(latitude), strings.TrimSpace(longitude), strings.TrimSpace(radius)
+	if latitude == "" && longitude == "" {
+		return nil, nil
+	}
+	lat, err := strconv.ParseFloat(latitude, 64)
+	if err != nil {
+		return nil, errors.New("Latitude must be a number such as 51.523767.")
+	}
+	lng, err := strconv.ParseFloat(longitude, 64)
+	if err != nil {
+		return nil, errors.New("Longitude must be a number such as -0.158555.")
+	}
+	r := services.DefaultGeofenceRadius
+	if radius != "" {
+		if r, err = strconv.Atoi(radius); err != nil {
+			return nil, errors.New("The radius is a whole number of meters.")
+		}
+	}
+	if err := services.CheckGeofence(lat, lng, r); err != nil {
+		return nil, err
+	}
+	return &services.Geofence{Latitude: lat, Longitude: lng, RadiusMeters: r}, nil
+}
+
+// geofenceInputs fills the edit form's location fields
+func geofenceInputs(inputs map[string]string, g *services.Geofence) {
+	if g == nil {
+		return
+	}
+	inputs["latitude"] = strconv.FormatFloat(g.Latitude, 'f', -1, 64)
+	inputs["longitude"] = strconv.FormatFloat(g.Longitude, 'f', -1, 64)
+	inputs["radius"] = strconv.Itoa(g.RadiusMeters)
+}
+
+// saveGeofence saves where a question is answered from, or lets it be
+// answered anywhere when g is nil. An unchanged place is left alone, so
+// proofs teams hold keep counting
+func (ah *AuthHandler) saveGeofence(ctx context.Context, questionID int, old, g *services.Geofence) error {
+	switch {
+	case g == nil && old == nil:
+		return nil
+	case g == nil:
+		return ah.UserServices.RemoveGeofence(ctx, questionID)
+	case old != nil && old.Latitude == g.Latitude && old.Longitude == g.Longitude && old.RadiusMeters == g.RadiusMeters:
+		return nil
+	}
+	return ah.UserServices.SetGeofence(ctx, questionID, g.Latitude, g.Longitude, g.RadiusMeters)
+}
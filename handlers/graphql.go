@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/labstack/echo/v4"
+)
+
+// GraphQL view of the player data, so a dashboard can fetch its team,
+// questions, leaderboard and quota in one round trip. Resolvers reuse the
+// /api/v1 helpers and read-only data: opening a question (which locks it)
+// and submitting answers stay on /api/v1
+
+// gqlRequestKey carries the gqlRequest through the resolver context
+type gqlRequestKey struct{}
+
+// gqlRequest is who a GraphQL query runs for
+type gqlRequest struct {
+	ah       *AuthHandler
+	teamID   int
+	teamName string
+}
+
+func gqlRequestFrom(p graphql.ResolveParams) gqlRequest {
+	return p.Context.Value(gqlRequestKey{}).(gqlRequest)
+}
+
+var gqlTeamType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Team",
+	Fields: graphql.Fields{
+		"id":       &graphql.Field{Type: graphql.Int},
+		"username": &graphql.Field{Type: graphql.String},
+		"points":   &graphql.Field{Type: graphql.Int},
+		"penalty":  &graphql.Field{Type: graphql.Int},
+	},
+})
+
+var gqlQuestionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Question",
+	Fields: graphql.Fields{
+		"id":               &graphql.Field{Type: graphql.Int},
+		"title":            &graphql.Field{Type: graphql.String},
+		"points":           &graphql.Field{Type: graphql.Int},
+		"solved":           &graphql.Field{Type: graphql.Boolean},
+		"solved_by_anyone": &graphql.Field{Type: graphql.Boolean},
+		"locked":           &graphql.Field{Type: graphql.Boolean},
+		"locked_by_me":     &graphql.Field{Type: graphql.Boolean},
+		"locked_by_name":   &graphql.Field{Type: graphql.String},
+		"skipped":          &graphql.Field{Type: graphql.Boolean},
+	},
+})
+
+var gqlLeaderboardEntryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "LeaderboardEntry",
+	Fields: graphql.Fields{
+		"username":           &graphql.Field{Type: graphql.String},
+		"points":             &graphql.Field{Type: graphql.Int},
+		"questions_solved":   &graphql.Field{Type: graphql.Int},
+		"total_time_seconds": &graphql.Field{Type: graphql.Int},
+		"total_penalty":      &graphql.Field{Type: graphql.Int},
+		"net_score":          &graphql.Field{Type: graphql.Int},
+	},
+})
+
+var gqlQuotaType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Quota",
+	Fields: graphql.Fields{
+		"questions_solved":  &graphql.Field{Type: graphql.Int},
+		"limit":             &graphql.Field{Type: graphql.Int},
+		"slot_start":        &graphql.Field{Type: graphql.DateTime},
+		"resets_in_seconds": &graphql.Field{Type: graphql.Int},
+	},
+})
+
+var gqlQuestionLockType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "QuestionLock",
+	Fields: graphql.Fields{
+		"question_id":       &graphql.Field{Type: graphql.Int},
+		"locked_by_team_id": &graphql.Field{Type: graphql.Int},
+		"locked_by_name":    &graphql.Field{Type: graphql.String},
+		"locked_at":         &graphql.Field{Type: graphql.DateTime},
+	},
+})
+
+var gqlSchema = func() graphql.Schema {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": &graphql.Field{
+				Type: gqlTeamType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := gqlRequestFrom(p)
+					return r.ah.teamProfile(p.Context, r.teamID, r.teamName)
+				},
+			},
+			"questions": &graphql.Field{
+				Type: graphql.NewList(gqlQuestionType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := gqlRequestFrom(p)
+					return r.ah.questionSummaries(p.Context, r.teamID)
+				},
+			},
+			"completedAll": &graphql.Field{
+				Type: graphql.Boolean,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := gqlRequestFrom(p)
+					return r.ah.completedAll(p.Context, r.teamID)
+				},
+			},
+			"leaderboard": &graphql.Field{
+				Type: graphql.NewList(gqlLeaderboardEntryType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := gqlRequestFrom(p)
+					return r.ah.teamLeaderboard(p.Context, r.teamID, r.teamName)
+				},
+			},
+			"quota": &graphql.Field{
+				Type: gqlQuotaType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := gqlRequestFrom(p)
+					return r.ah.teamQuota(p.Context, r.teamID)
+				},
+			},
+			"lockedQuestions": &graphql.Field{
+				Type: graphql.NewList(gqlQuestionLockType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := gqlRequestFrom(p)
+					huntID, err := r.ah.teamHunt(p.Context, r.teamID)
+					if err != nil {
+						return nil, err
+					}
+					return r.ah.UserServices.GetAllLockedQuestions(p.Context, huntID)
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}()
+
+// gqlTimeout bounds how long a single GraphQL request may run
+const gqlTimeout = 10 * time.Second
+
+// GraphQLHandler executes a GraphQL query for the signed-in team
+// Accepts POST with a JSON body or GET with query parameters
+func (ah *AuthHandler) GraphQLHandler(c echo.Context) error {
+	var req struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+
+	if c.Request().Method == http.MethodGet {
+		req.Query = c.QueryParam("query")
+		req.OperationName = c.QueryParam("operationName")
+	} else if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid GraphQL request", nil)
+	}
+
+	if req.Query == "" {
+		return jsonError(c, http.StatusBadRequest, "Missing query", nil)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), gqlTimeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, gqlRequestKey{}, gqlRequest{
+		ah:       ah,
+		teamID:   c.Get(user_id_key).(int),
+		teamName: c.Get(user_name_key).(string),
+	})
+
+	result := graphql.Do(graphql.Params{
+		Schema:         gqlSchema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        ctx,
+	})
+
+	return c.JSON(http.StatusOK, result)
+}
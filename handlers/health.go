@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"runtime"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/services"
 )
 
 // HealthResponse represents the health check response
@@ -37,7 +42,7 @@ func (ah *AuthHandler) HealthCheckHandler(c echo.Context) error {
 	dbStatus := "healthy"
 	stats := ah.UserServices.GetDBStats()
 	
-	if err := ah.UserServices.PingDB(); err != nil {
+	if err := ah.UserServices.PingDB(c.Request().Context()); err != nil {
 		dbStatus = "unhealthy"
 	}
 
@@ -98,10 +103,79 @@ func (ah *AuthHandler) MetricsHandler(c echo.Context) error {
 			"num_gc":           m.NumGC,
 			"gc_pause_ns":      m.PauseNs[(m.NumGC+255)%256],
 		},
-		"sse": map[string]interface{}{
-			"connected_clients": ah.Broadcaster.GetClientCount(),
-		},
+		"sse": ah.Broadcaster.Stats(),
 	}
 
 	return c.JSON(http.StatusOK, metrics)
 }
+
+// ReadinessCheck is the outcome of checking one dependency
+type ReadinessCheck struct {
+	Status   string `json:"status"` // "ok", "error" or "disabled"
+	Required bool   `json:"required"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ReadinessResponse lists every dependency checked by /readyz
+type ReadinessResponse struct {
+	Status string                    `json:"status"` // "ready" or "not_ready"
+	Checks map[string]ReadinessCheck `json:"checks"`
+}
+
+// readinessTimeout bounds each readiness check, so a hung dependency
+// fails the probe rather than hanging it
+const readinessTimeout = 2 * time.Second
+
+// LivenessHandler reports that the process is serving requests. It checks
+// no dependencies, so an orchestrator only restarts an instance that has
+// stopped responding altogether
+func (ah *AuthHandler) LivenessHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ReadinessHandler reports whether the instance should receive traffic.
+// The database must be reachable and fully migrated; storage, the question
+// cache and the message bus are reported but don't fail the probe, since
+// the hunt keeps going without them
+func (ah *AuthHandler) ReadinessHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	response := ReadinessResponse{Status: "ready", Checks: make(map[string]ReadinessCheck)}
+
+	check := func(name string, required bool, fn func(ctx context.Context) error) {
+		ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+		defer cancel()
+
+		result := ReadinessCheck{Status: "ok", Required: required}
+		if err := fn(ctx); errors.Is(err, services.ErrNoBackend) {
+			result.Status = "disabled"
+		} else if err != nil {
+			result.Status = "error"
+			result.Error = err.Error()
+			if required {
+				response.Status = "not_ready"
+			}
+		}
+		response.Checks[name] = result
+	}
+
+	check("database", true, ah.UserServices.PingDB)
+	check("migrations", true, func(ctx context.Context) error {
+		version, err := ah.UserServices.SchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		// A newer instance may have migrated further during a rolling deploy
+		if latest := database.LatestSchemaVersion(); version < latest {
+			return fmt.Errorf("schema is at version %d, want %d", version, latest)
+		}
+		return nil
+	})
+	check("storage", false, ah.UserServices.PingStorage)
+	check("question_cache", false, ah.UserServices.PingCache)
+	check("message_bus", false, ah.Broadcaster.PingBus)
+
+	if response.Status != "ready" {
+		return c.JSON(http.StatusServiceUnavailable, response)
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// admin_hunt_key holds the hunt the admin panel is looking at
+const admin_hunt_key string = "admin_hunt_key"
+
+// teamHunt returns the hunt a team plays in. The admin session has no team
+// and sees the first hunt
+func (ah *AuthHandler) teamHunt(ctx context.Context, teamID int) (int, error) {
+	huntID, err := ah.UserServices.TeamHuntID(ctx, teamID)
+	if errors.Is(err, services.ErrTeamNotFound) {
+		return services.DefaultHuntID, nil
+	}
+	return huntID, err
+}
+
+// teamLeaderboard returns the leaderboard of the hunt a team plays in, as
+// the team sees it
+func (ah *AuthHandler) teamLeaderboard(ctx context.Context, teamID int, teamName string) ([]services.LeaderBoardUser, error) {
+	huntID, err := ah.teamHunt(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return ah.UserServices.GetTeamLeaderboard(ctx, huntID, teamName)
+}
+
+// completedAll reports whether a team solved every question of its hunt
+func (ah *AuthHandler) completedAll(ctx context.Context, teamID int) (bool, error) {
+	huntID, err := ah.teamHunt(ctx, teamID)
+	if err != nil {
+		return false, err
+	}
+	return ah.UserServices.HasCompletedAllQuestions(ctx, huntID, teamID)
+}
+
+// inTeamHunt reports whether something of huntID belongs to the team's
+// hunt. The admin session may look at every hunt
+func (ah *AuthHandler) inTeamHunt(ctx context.Context, teamID, huntID int) (bool, error) {
+	teamHunt, err := ah.UserServices.TeamHuntID(ctx, teamID)
+	if errors.Is(err, services.ErrTeamNotFound) {
+		return true, nil
+	}
+	return teamHunt == huntID, err
+}
+
+// requestHunt returns the hunt a request plays in: the team's own, or the
+// one the admin panel is switched to. Visitors see the first hunt
+func (ah *AuthHandler) requestHunt(c echo.Context) (int, error) {
+	if isAdminSession(c) {
+		return ah.adminHunt(c), nil
+	}
+	teamID, _ := c.Get(user_id_key).(int)
+	return ah.teamHunt(c.Request().Context(), teamID)
+}
+
+// adminHunt returns the hunt the admin panel is switched to
+func (ah *AuthHandler) adminHunt(c echo.Context) int {
+	sess, _ := session.Get(auth_sessions_key, c)
+	if huntID, ok := sess.Values[admin_hunt_key].(int); ok && huntID != 0 {
+		return huntID
+	}
+	return services.DefaultHuntID
+}
+
+// publicHunt returns the hunt named by the hunt query parameter, the
+// first hunt when there is none
+func (ah *AuthHandler) publicHunt(c echo.Context) (services.Hunt, error) {
+	slug := c.QueryParam("hunt")
+	if slug == "" {
+		return ah.UserServices.GetHunt(c.Request().Context(), services.DefaultHuntID)
+	}
+	return ah.UserServices.GetHuntBySlug(c.Request().Context(), slug)
+}
+
+// adminAPIHunt returns the hunt named by the hunt_id query parameter, the
+// first hunt when there is none
+func (ah *AuthHandler) adminAPIHunt(c echo.Context) (int, error) {
+	value := c.QueryParam("hunt_id")
+	if value == "" {
+		return services.DefaultHuntID, nil
+	}
+	huntID, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, newPlayError(http.StatusBadRequest, "Invalid hunt_id")
+	}
+	return ah.checkHunt(c.Request().Context(), huntID)
+}
+
+// checkHunt checks a hunt given in an admin API request exists, taking
+// zero as the first hunt
+func (ah *AuthHandler) checkHunt(ctx context.Context, huntID int) (int, error) {
+	if huntID == 0 {
+		return services.DefaultHuntID, nil
+	}
+	if _, err := ah.UserServices.GetHunt(ctx, huntID); errors.Is(err, services.ErrHuntNotFound) {
+		return 0, newPlayError(http.StatusNotFound, "Hunt not found")
+	} else if err != nil {
+		return 0, err
+	}
+	return huntID, nil
+}
+
+// AdminHuntsHandler lists the hunts and creates one on POST
+func (ah *AuthHandler) AdminHuntsHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	errs := make(map[string]string)
+	if c.Request().Method == "POST" {
+		var err error
+		if from, _ := strconv.Atoi(c.FormValue("from")); from != 0 {
+			_, err = ah.UserServices.CloneHunt(c.Request().Context(), from, c.FormValue("slug"), c.FormValue("name"))
+		} else {
+			_, err = ah.UserServices.CreateHunt(c.Request().Context(), c.FormValue("slug"), c.FormValue("name"))
+		}
+		switch {
+		case errors.Is(err, services.ErrHuntNotFound):
+			errs["slug"] = "The hunt to copy no longer exists"
+		case errors.Is(err, services.ErrInvalidHuntSlug), errors.Is(err, services.ErrHuntExists):
+			errs["slug"] = err.Error()
+		case err != nil:
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating hunt: %s", err))
+		default:
+			return c.Redirect(http.StatusSeeOther, "/su/hunts")
+		}
+	}
+
+	hunts, err := ah.UserServices.GetHunts(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching hunts: %s", err))
+	}
+
+	view := panel.Hunts(fromProtected, errs, hunts, ah.adminHunt(c))
+	c.Set("ISERROR", false)
+	return renderView(c, panel.HuntsIndex(
+		"Hunts",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminSwitchHuntHandler points the admin panel at another hunt
+func (ah *AuthHandler) AdminSwitchHuntHandler(c echo.Context) error {
+	huntID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid hunt ID")
+	}
+	if _, err := ah.UserServices.GetHunt(c.Request().Context(), huntID); errors.Is(err, services.ErrHuntNotFound) {
+		return c.String(http.StatusNotFound, "Hunt not found")
+	} else if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching hunt: %s", err))
+	}
+
+	sess, _ := session.Get(auth_sessions_key, c)
+	sess.Values[admin_hunt_key] = huntID
+	if err := sess.Save(c.Request(), c.Response()); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving session: %s", err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su")
+}
+
+// AdminDeleteHuntHandler removes a hunt with nothing left in it
+func (ah *AuthHandler) AdminDeleteHuntHandler(c echo.Context) error {
+	huntID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid hunt ID")
+	}
+
+	err = ah.UserServices.DeleteHunt(c.Request().Context(), huntID)
+	switch {
+	case errors.Is(err, services.ErrHuntNotFound):
+		return c.String(http.StatusNotFound, "Hunt not found")
+	case errors.Is(err, services.ErrHuntNotEmpty):
+		return c.String(http.StatusConflict, "Only an empty hunt other than the first can be deleted")
+	case err != nil:
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error deleting hunt: %s", err))
+	}
+
+	if ah.adminHunt(c) == huntID {
+		sess, _ := session.Get(auth_sessions_key, c)
+		delete(sess.Values, admin_hunt_key)
+		sess.Save(c.Request(), c.Response())
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/hunts")
+}
+
+// sendHuntArchive exports a hunt and sends the archive as a download. The
+// archive is built in a temporary file first, so a failed export is still
+// reported as an error rather than a truncated download
+func (ah *AuthHandler) sendHuntArchive(c echo.Context, huntID int) error {
+	hunt, err := ah.UserServices.GetHunt(c.Request().Context(), huntID)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "hunt-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := ah.UserServices.ExportHunt(c.Request().Context(), huntID, f); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("hunt-%s-%s.zip", hunt.Slug, time.Now().UTC().Format("20060102T150405Z"))
+	return c.Attachment(f.Name(), name)
+}
+
+// AdminExportHuntHandler downloads the archive of a hunt
+func (ah *AuthHandler) AdminExportHuntHandler(c echo.Context) error {
+	huntID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid hunt ID")
+	}
+
+	err = ah.sendHuntArchive(c, huntID)
+	if errors.Is(err, services.ErrHuntNotFound) {
+		return c.String(http.StatusNotFound, "Hunt not found")
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error exporting hunt: %s", err))
+	}
+	return nil
+}
+
+// importHuntArchive imports the archive read from r, spooling it to a
+// temporary file first since zip needs to seek
+func (ah *AuthHandler) importHuntArchive(c echo.Context, r io.Reader, opts services.ImportOptions) (services.ImportSummary, error) {
+	f, err := os.CreateTemp("", "hunt-import-*.zip")
+	if err != nil {
+		return services.ImportSummary{}, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	size, err := io.Copy(f, r)
+	if err != nil {
+		return services.ImportSummary{}, err
+	}
+	return ah.UserServices.ImportHunt(c.Request().Context(), f, size, opts)
+}
+
+// importError tells whether an import failed because of the archive or
+// the hunt it targets rather than the server
+func importError(err error) bool {
+	return errors.Is(err, services.ErrInvalidArchive) ||
+		errors.Is(err, services.ErrInvalidHuntSlug) ||
+		errors.Is(err, services.ErrHuntExists)
+}
+
+// AdminImportHuntHandler rebuilds a hunt from an uploaded archive
+func (ah *AuthHandler) AdminImportHuntHandler(c echo.Context) error {
+	file, err := c.FormFile("archive")
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Choose an archive to import")
+	}
+	src, err := file.Open()
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Error reading archive")
+	}
+	defer src.Close()
+
+	opts := services.ImportOptions{Full: c.FormValue("mode") == "full", Slug: c.FormValue("slug")}
+	summary, err := ah.importHuntArchive(c, src, opts)
+	if importError(err) {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Error importing hunt: %s", err))
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error importing hunt: %s", err))
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/su/hunts/switch/%d", summary.Hunt.ID))
+}
+
+// AdminAPIListHunts lists every hunt
+func (ah *AuthHandler) AdminAPIListHunts(c echo.Context) error {
+	hunts, err := ah.UserServices.GetHunts(c.Request().Context())
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, hunts)
+}
+
+// AdminAPICreateHunt creates a hunt
+func (ah *AuthHandler) AdminAPICreateHunt(c echo.Context) error {
+	var req services.Hunt
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	hunt, err := ah.UserServices.CreateHunt(c.Request().Context(), req.Slug, req.Name)
+	switch {
+	case errors.Is(err, services.ErrInvalidHuntSlug):
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", err))
+	case errors.Is(err, services.ErrHuntExists):
+		return apiError(c, newPlayError(http.StatusConflict, "%s", err))
+	case err != nil:
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusCreated, hunt)
+}
+
+// AdminAPICloneHunt starts a new hunt with copies of a hunt's questions,
+// hints and media, and no teams
+func (ah *AuthHandler) AdminAPICloneHunt(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	var req services.Hunt
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	hunt, err := ah.UserServices.CloneHunt(c.Request().Context(), id, req.Slug, req.Name)
+	switch {
+	case errors.Is(err, services.ErrHuntNotFound):
+		return apiError(c, newPlayError(http.StatusNotFound, "Hunt not found"))
+	case errors.Is(err, services.ErrInvalidHuntSlug):
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", err))
+	case errors.Is(err, services.ErrHuntExists):
+		return apiError(c, newPlayError(http.StatusConflict, "%s", err))
+	case err != nil:
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusCreated, hunt)
+}
+
+// AdminAPIDeleteHunt deletes a hunt with no teams or questions
+func (ah *AuthHandler) AdminAPIDeleteHunt(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = ah.UserServices.DeleteHunt(c.Request().Context(), id)
+	switch {
+	case errors.Is(err, services.ErrHuntNotFound):
+		return apiError(c, newPlayError(http.StatusNotFound, "Hunt not found"))
+	case errors.Is(err, services.ErrHuntNotEmpty):
+		return apiError(c, newPlayError(http.StatusConflict, "Only an empty hunt other than the first can be deleted"))
+	case err != nil:
+		return apiError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AdminAPIImportHunt rebuilds a hunt from the archive sent as the request
+// body; ?mode=full brings back the teams and their progress too, and
+// ?slug= imports into another hunt than the one archived
+func (ah *AuthHandler) AdminAPIImportHunt(c echo.Context) error {
+	opts := services.ImportOptions{Full: c.QueryParam("mode") == "full", Slug: c.QueryParam("slug")}
+	summary, err := ah.importHuntArchive(c, c.Request().Body, opts)
+	if errors.Is(err, services.ErrHuntExists) {
+		return apiError(c, newPlayError(http.StatusConflict, "A hunt with that slug already has teams or questions"))
+	}
+	if importError(err) {
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", err))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusCreated, summary)
+}
+
+// AdminAPIExportHunt downloads the archive of a hunt
+func (ah *AuthHandler) AdminAPIExportHunt(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = ah.sendHuntArchive(c, id)
+	if errors.Is(err, services.ErrHuntNotFound) {
+		return apiError(c, newPlayError(http.StatusNotFound, "Hunt not found"))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+	return nil
+}
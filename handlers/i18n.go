@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/i18n"
+)
+
+// locale_sessions_key is the cookie holding the language a visitor picked.
+// It is apart from the auth session, which logging in and out replaces
+const locale_sessions_key string = "locale_session_key"
+const locale_key string = "locale_key"
+
+// LocaleMiddleware puts the language of each request in its context, for
+// the views and errors to be written in: the one picked at /lang, else the
+// best the browser asks for, else the default. It must come after the
+// session middleware
+func LocaleMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			code := ""
+			if sess, err := session.Get(locale_sessions_key, c); err == nil {
+				code, _ = sess.Values[locale_key].(string)
+			}
+			if !i18n.Supported(code) {
+				code = i18n.Match(c.Request().Header.Get("Accept-Language"))
+			}
+
+			r := c.Request()
+			c.SetRequest(r.WithContext(i18n.WithLocale(r.Context(), code)))
+			return next(c)
+		}
+	}
+}
+
+// LanguageHandler remembers the language picked in the menu and goes back
+// to the page it was picked on
+func (ah *AuthHandler) LanguageHandler(c echo.Context) error {
+	code := c.Param("code")
+	if !i18n.Supported(code) {
+		return echo.ErrNotFound
+	}
+
+	sess, _ := session.Get(locale_sessions_key, c)
+	sess.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   60 * 60 * 24 * 365,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	sess.Values[locale_key] = code
+	sess.Save(c.Request(), c.Response())
+
+	// Only go back within this site
+	back := "/"
+	if u, err := url.Parse(c.Request().Referer()); err == nil && u.Host == c.Request().Host && u.Path != "" {
+		back = u.RequestURI()
+	}
+	return c.Redirect(http.StatusSeeOther, back)
+}
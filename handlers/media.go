@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+// mediaUploadRequest names the file a direct upload is for; Key is only
+// sent when confirming, along with Filename for files
+type mediaUploadRequest struct {
+	Kind     string `json:"kind"`
+	Filename string `json:"filename"`
+	Key      string `json:"key"`
+}
+
+// uploadedFilenames returns the original names of the files uploaded
+// under label, in the order MakeArray stores them
+func uploadedFilenames(form *multipart.Form, label string) []string {
+	names := make([]string, 0, len(form.File[label]))
+	for _, file := range form.File[label] {
+		names = append(names, file.Filename)
+	}
+	return names
+}
+
+// mediaQuestionID parses :id and checks the question exists
+func (ah *AuthHandler) mediaQuestionID(c echo.Context) (int, error) {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := ah.UserServices.GetQuestionById(c.Request().Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, newPlayError(http.StatusNotFound, "Question not found")
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// isUploadRejected reports whether err is a file refused by the upload
+// policy, which is shown to the admin rather than treated as a failure
+func isUploadRejected(err error) bool {
+	var rejected *services.UploadRejectedError
+	return errors.As(err, &rejected)
+}
+
+// mediaUploadError maps media service errors to API errors
+func mediaUploadError(err error) error {
+	var rejected *services.UploadRejectedError
+	switch {
+	case errors.As(err, &rejected):
+		return newPlayError(http.StatusUnprocessableEntity, "%s", rejected.Error())
+	case errors.Is(err, services.ErrUnknownMediaKind):
+		return newPlayError(http.StatusBadRequest, "Kind must be images, videos, audios or files")
+	case errors.Is(err, services.ErrInvalidMediaKey):
+		return newPlayError(http.StatusBadRequest, "Invalid media key")
+	case errors.Is(err, services.ErrMediaNotUploaded):
+		return newPlayError(http.StatusConflict, "Media has not been uploaded yet")
+	}
+	return err
+}
+
+// AdminPresignMediaHandler issues a presigned PUT URL so large media can
+// be uploaded straight to the bucket instead of through the app
+func (ah *AuthHandler) AdminPresignMediaHandler(c echo.Context) error {
+	id, err := ah.mediaQuestionID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	var req mediaUploadRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid request", nil)
+	}
+	if strings.TrimSpace(req.Filename) == "" {
+		return jsonError(c, http.StatusBadRequest, "Filename is required", nil)
+	}
+
+	key, url, err := ah.UserServices.PresignMediaUpload(req.Kind, req.Filename)
+	if errors.Is(err, services.ErrPresignUnsupported) {
+		return jsonError(c, http.StatusNotImplemented, "Direct uploads need an object storage backend", nil)
+	}
+	if err != nil {
+		return apiError(c, mediaUploadError(err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"question_id": id,
+		"kind":        req.Kind,
+		"key":         key,
+		"url":         url,
+		"method":      http.MethodPut,
+		"expires_in":  int(services.PresignExpiry.Seconds()),
+	})
+}
+
+// AdminConfirmMediaHandler records a direct upload against the question
+// once the object is in the bucket
+func (ah *AuthHandler) AdminConfirmMediaHandler(c echo.Context) error {
+	id, err := ah.mediaQuestionID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	var req mediaUploadRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid request", nil)
+	}
+
+	if err := ah.UserServices.ConfirmMediaUpload(c.Request().Context(), id, req.Kind, req.Key, req.Filename); err != nil {
+		return apiError(c, mediaUploadError(err))
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"question_id": id,
+		"kind":        req.Kind,
+		"key":         req.Key,
+		"url":         ah.UserServices.MediaURL(req.Key),
+	})
+}
+
+// MediaHandler streams question media to teams allowed to open the
+// question, and to admins. Range requests are honoured so audio and
+// video can seek
+func (ah *AuthHandler) MediaHandler(c echo.Context) error {
+	key := c.Param("key")
+	original := services.OriginalMediaKey(key)
+
+	questionIDs, err := ah.UserServices.GetMediaQuestionIDs(c.Request().Context(), original)
+	if errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Cloned hunts share media, so any of the questions using it will do
+	var qs *questionState
+	if !isAdminSession(c) {
+		teamID, _ := c.Get(user_id_key).(int)
+		for _, questionID := range questionIDs {
+			if qs, err = ah.loadQuestion(c.Request().Context(), teamID, questionID); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			var pe *playError
+			if errors.As(err, &pe) && pe.Status < 500 {
+				return echo.NewHTTPError(pe.Status, pe.Message)
+			}
+			return err
+		}
+	}
+
+	obj, info, err := ah.UserServices.OpenMedia(key)
+	if errors.Is(err, services.ErrObjectNotFound) && key != original {
+		// No resized copy, e.g. the format isn't resized; send the original
+		obj, info, err = ah.UserServices.OpenMedia(original)
+	}
+	if errors.Is(err, services.ErrObjectNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	// Text attachments of a question with per-team flags carry the team's
+	// token in place of the placeholder
+	var content io.ReadSeeker = obj
+	if qs != nil && qs.FlagToken != "" && strings.HasPrefix(original, "FILE-") && services.PersonalizesFile(info.ContentType, info.Size) {
+		data, err := io.ReadAll(obj)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader([]byte(services.ExpandTeamFlag(string(data), qs.FlagToken)))
+	}
+
+	header := c.Response().Header()
+	if strings.HasPrefix(original, "FILE-") {
+		// Attachments may be of any type, e.g. HTML, so they are always
+		// downloaded rather than rendered on this origin
+		name, err := ah.UserServices.GetAttachmentName(c.Request().Context(), original)
+		if err != nil || name == "" {
+			name = original
+		}
+		header.Set(echo.HeaderContentType, "application/octet-stream")
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": name})
+		if disposition == "" {
+			disposition = "attachment"
+		}
+		header.Set(echo.HeaderContentDisposition, disposition)
+		header.Set("X-Content-Type-Options", "nosniff")
+	} else if info.ContentType != "" {
+		header.Set(echo.HeaderContentType, info.ContentType)
+	}
+	// Access depends on the team, so shared caches must not keep a copy
+	header.Set("Cache-Control", "private, max-age=300")
+	http.ServeContent(c.Response(), c.Request(), key, info.ModTime, content)
+	return nil
+}
+
+// chunkedUploadResponse is an upload in progress as reported to the client
+type chunkedUploadResponse struct {
+	services.ChunkedUpload
+	ChunkSize int    `json:"chunk_size"`
+	Complete  bool   `json:"complete"`
+	Key       string `json:"key,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// chunkedUpload loads the :uid upload and checks it belongs to question :id
+func (ah *AuthHandler) chunkedUpload(c echo.Context) (services.ChunkedUpload, error) {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return services.ChunkedUpload{}, err
+	}
+	u, err := ah.UserServices.GetChunkedUpload(c.Request().Context(), c.Param("uid"))
+	if errors.Is(err, services.ErrUploadNotFound) || (err == nil && u.QuestionID != id) {
+		return services.ChunkedUpload{}, newPlayError(http.StatusNotFound, "Upload not found")
+	}
+	return u, err
+}
+
+// AdminCreateUploadHandler starts a resumable upload. The client then
+// sends the file in chunks of at most chunk_size bytes with PATCH
+func (ah *AuthHandler) AdminCreateUploadHandler(c echo.Context) error {
+	id, err := ah.mediaQuestionID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	var req struct {
+		Kind     string `json:"kind"`
+		Filename string `json:"filename"`
+		Size     int64  `json:"size"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid request", nil)
+	}
+	if strings.TrimSpace(req.Filename) == "" {
+		return jsonError(c, http.StatusBadRequest, "Filename is required", nil)
+	}
+
+	u, err := ah.UserServices.CreateChunkedUpload(c.Request().Context(), id, req.Kind, req.Filename, req.Size)
+	if err != nil {
+		return apiError(c, mediaUploadError(err))
+	}
+
+	return c.JSON(http.StatusCreated, chunkedUploadResponse{ChunkedUpload: u, ChunkSize: services.ChunkSize})
+}
+
+// AdminUploadStatusHandler reports how much of an upload has arrived, so
+// an interrupted client can resume from there
+func (ah *AuthHandler) AdminUploadStatusHandler(c echo.Context) error {
+	u, err := ah.chunkedUpload(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, chunkedUploadResponse{ChunkedUpload: u, ChunkSize: services.ChunkSize})
+}
+
+// AdminUploadChunkHandler appends the request body at the Upload-Offset
+// header's offset. The chunk holding the last byte completes the upload
+// and attaches the file to the question
+func (ah *AuthHandler) AdminUploadChunkHandler(c echo.Context) error {
+	u, err := ah.chunkedUpload(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	offset, err := strconv.ParseInt(c.Request().Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "Upload-Offset header is required", nil)
+	}
+
+	u, key, err := ah.UserServices.AppendChunk(c.Request().Context(), u.ID, offset, c.Request().Body)
+	switch {
+	case errors.Is(err, services.ErrUploadOffsetMismatch):
+		return jsonError(c, http.StatusConflict, "Chunk does not start at the received offset", map[string]int64{"received": u.Received})
+	case errors.Is(err, services.ErrChunkTooLarge):
+		return jsonError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Chunks may be at most %d bytes and must not pass the declared size", services.ChunkSize), nil)
+	case errors.Is(err, services.ErrUploadNotFound):
+		return jsonError(c, http.StatusNotFound, "Upload not found", nil)
+	case err != nil:
+		return apiError(c, mediaUploadError(err))
+	}
+
+	res := chunkedUploadResponse{ChunkedUpload: u, ChunkSize: services.ChunkSize, Complete: key != ""}
+	if key != "" {
+		res.Key = key
+		res.URL = ah.UserServices.MediaURL(key)
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// wantsJSON reports whether the client asked for JSON rather than HTML, so
+// page handlers can answer headless clients with the /api/v1 representation.
+// Browsers list text/html in Accept, so they keep getting pages
+func wantsJSON(c echo.Context) bool {
+	// The response depends on Accept, so caches must not mix the two
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+
+	json, html := false, false
+	for _, part := range strings.Split(c.Request().Header.Get(echo.HeaderAccept), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case echo.MIMEApplicationJSON:
+			json = true
+		case echo.MIMETextHTML:
+			html = true
+		}
+	}
+	return json && !html
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/hunt"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// notificationPageSize is how many notifications the inbox shows
+const notificationPageSize = 50
+
+// notify stores a notification and pushes it to the connected clients it
+// concerns; teamID 0 sends it to every team
+func (ah *AuthHandler) notify(ctx context.Context, teamID int, kind, title, message, link string) {
+	n, err := ah.UserServices.CreateNotification(ctx, services.Notification{
+		TeamID:  teamID,
+		Type:    kind,
+		Title:   title,
+		Message: message,
+		Link:    link,
+	})
+	if err != nil {
+		log.Printf("Warning: Error saving notification: %s", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"notification": n,
+	}
+	if teamID == 0 {
+		ah.Broadcaster.Broadcast(services.EventNotification, data)
+	} else {
+		ah.Broadcaster.BroadcastToTeam(teamID, services.EventNotification, data)
+	}
+}
+
+// NotificationsHandler shows the team's inbox and marks everything in it as read
+func (ah *AuthHandler) NotificationsHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	teamID := c.Get(user_id_key).(int)
+	notifications, err := ah.UserServices.GetNotificationsForTeam(c.Request().Context(), teamID, notificationPageSize)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error fetching notifications")
+	}
+
+	// The page shows which ones were unread, so only mark them after fetching
+	if err := ah.UserServices.MarkNotificationsRead(c.Request().Context(), teamID); err != nil {
+		log.Printf("Warning: Error marking notifications read: %s", err)
+	}
+
+	view := hunt.Notifications(fromProtected, notifications)
+	c.Set("ISERROR", false)
+	return renderView(c, hunt.NotificationsIndex(
+		"Notifications",
+		c.Get(user_name_key).(string),
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// GetNotificationsAPI returns the team's recent notifications and unread count
+func (ah *AuthHandler) GetNotificationsAPI(c echo.Context) error {
+	teamID := c.Get(user_id_key).(int)
+
+	notifications, err := ah.UserServices.GetNotificationsForTeam(c.Request().Context(), teamID, notificationPageSize)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Failed to fetch notifications", nil)
+	}
+
+	unread, err := ah.UserServices.GetUnreadNotificationCount(c.Request().Context(), teamID)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Failed to count notifications", nil)
+	}
+
+	if notifications == nil {
+		notifications = []services.Notification{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"notifications": notifications,
+		"unread":        unread,
+	})
+}
+
+// MarkNotificationsReadAPI marks all of the team's notifications as read
+func (ah *AuthHandler) MarkNotificationsReadAPI(c echo.Context) error {
+	teamID := c.Get(user_id_key).(int)
+
+	if err := ah.UserServices.MarkNotificationsRead(c.Request().Context(), teamID); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Failed to mark notifications read", nil)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"unread": 0,
+	})
+}
+
+// AdminAnnouncementsHandler sends an announcement to every team and lists
+// the ones sent before
+func (ah *AuthHandler) AdminAnnouncementsHandler(c echo.Context) error {
+	errs := make(map[string]string)
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	sent := false
+	emailed, texted := 0, 0
+	if c.Request().Method == "POST" {
+		title := strings.TrimSpace(c.FormValue("title"))
+		message := strings.TrimSpace(c.FormValue("message"))
+		link := strings.TrimSpace(c.FormValue("link"))
+
+		if len(title) == 0 {
+			errs["title"] = "An announcement needs a title."
+		}
+
+		if link != "" && !strings.HasPrefix(link, "/") && !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+			errs["link"] = "Link must be a path or an http(s) URL"
+		}
+
+		if len(errs) == 0 {
+			_, err := ah.UserServices.CreateAnnouncement(c.Request().Context(), services.Announcement{
+				Title:   title,
+				Message: message,
+				Link:    link,
+				Pinned:  c.FormValue("pinned") == "on",
+				Public:  c.FormValue("public") == "on",
+			})
+			if err != nil {
+				return adminError(c, http.StatusInternalServerError, "Error saving announcement", err)
+			}
+
+			ah.notify(c.Request().Context(), 0, services.NotificationAnnouncement, title, message, link)
+			sent = true
+			ah.emitWebhook(c.Request().Context(), services.WebhookAnnouncement, map[string]interface{}{
+				"title":   title,
+				"message": message,
+				"link":    link,
+			})
+
+			if c.FormValue("email") == "on" {
+				n, err := ah.UserServices.QueueAnnouncementEmails(c.Request().Context(), title, message, link)
+				emailed = n
+				if err != nil {
+					errs["email"] = fmt.Sprintf("Emailing the announcement stopped after %d teams: %s", n, err)
+				}
+			}
+
+			if c.FormValue("sms") == "on" {
+				n, err := ah.UserServices.QueueAnnouncementSMS(c.Request().Context(), title, message, link)
+				texted = n
+				if err != nil {
+					errs["sms"] = fmt.Sprintf("Texting the announcement stopped after %d teams: %s", n, err)
+				}
+			}
+		}
+	}
+
+	announcements, err := ah.UserServices.GetAnnouncements(c.Request().Context(), false)
+	if err != nil {
+		return adminError(c, http.StatusInternalServerError, "Error fetching announcements", err)
+	}
+
+	view := panel.Announcements(fromProtected, errs, sent, ah.UserServices.MailEnabled(), emailed,
+		ah.UserServices.SMSEnabled(), texted, announcements)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.AnnouncementsIndex(
+		"Announcements",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
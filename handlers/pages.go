@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// PageHandler shows a page the admins wrote. Admins also see drafts, so
+// they can check a page before publishing it
+func (ah *AuthHandler) PageHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	// The rules have their own page, where teams accept them
+	if c.Param("slug") == services.RulesPageSlug {
+		return c.Redirect(http.StatusFound, "/rules")
+	}
+
+	page, err := ah.UserServices.RenderPage(c.Request().Context(), c.Param("slug"), c.Get("ISADMIN") == true)
+	if errors.Is(err, services.ErrPageNotFound) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching page: %s", err))
+	}
+
+	username := ""
+	sess, _ := session.Get(auth_sessions_key, c)
+	if name, ok := sess.Values[user_name_key].(string); ok && fromProtected {
+		username = name
+	}
+
+	c.Set("ISERROR", false)
+	return renderView(c, pages.PageIndex(
+		page.Page.Title,
+		username,
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		pages.Page(page),
+	))
+}
+
+// AdminPagesHandler lists the pages and edits the one picked with ?id=,
+// or a new one without it
+func (ah *AuthHandler) AdminPagesHandler(c echo.Context) error {
+	errs := make(map[string]string)
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	ctx := c.Request().Context()
+
+	var editing services.Page
+	if id, err := strconv.Atoi(c.QueryParam("id")); err == nil {
+		editing, err = ah.UserServices.GetPage(ctx, id)
+		if errors.Is(err, services.ErrPageNotFound) {
+			return c.String(http.StatusNotFound, "Page not found")
+		}
+		if err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching page: %s", err))
+		}
+	}
+
+	if c.Request().Method == "POST" {
+		editing.Slug = c.FormValue("slug")
+		editing.Title = c.FormValue("title")
+		editing.Body = c.FormValue("body")
+		editing.Published = c.FormValue("published") == "on"
+
+		saved, err := ah.UserServices.SavePage(ctx, editing)
+		switch {
+		case errors.Is(err, services.ErrInvalidPage):
+			errs["page"] = err.Error()
+		case errors.Is(err, services.ErrPageNotFound):
+			return c.String(http.StatusNotFound, "Page not found")
+		case err != nil:
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving page: %s", err))
+		default:
+			return c.Redirect(http.StatusSeeOther, "/su/pages?id="+strconv.Itoa(saved.ID))
+		}
+	}
+
+	list, err := ah.UserServices.GetPages(ctx)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching pages: %s", err))
+	}
+
+	view := panel.Pages(fromProtected, list, editing, errs)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.PagesIndex(
+		"Pages",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminDeletePage deletes a page
+func (ah *AuthHandler) AdminDeletePage(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid page ID")
+	}
+
+	if err := ah.UserServices.DeletePage(c.Request().Context(), id); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error deleting page: %s", err))
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/pages")
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// errPhotoAnswer is returned for typed answers to a question answered with
+// a photo, errNotPhotoQuestion for photos sent to any other and errOnePhoto
+// for a photo form without exactly one file
+var (
+	errPhotoAnswer      = newPlayError(http.StatusBadRequest, "Send a photo to answer this question")
+	errNotPhotoQuestion = newPlayError(http.StatusBadRequest, "This question is answered by typing the answer")
+	errOnePhoto         = newPlayError(http.StatusBadRequest, "Attach one photo")
+)
+
+// photoError maps photo submission errors to play errors
+func photoError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrPhotoNotFound):
+		return newPlayError(http.StatusNotFound, "Photo not found")
+	case errors.Is(err, services.ErrPhotoPending):
+		return newPlayError(http.StatusConflict, "Your last photo for this question is still waiting to be reviewed")
+	case errors.Is(err, services.ErrPhotoGraded):
+		return newPlayError(http.StatusConflict, "This photo was already graded")
+	case errors.Is(err, services.ErrInvalidPhotoGrade), errors.Is(err, services.ErrInvalidPhotoStatus),
+		errors.Is(err, services.ErrInvalidPhotoPoints), errors.Is(err, services.ErrPhotoNoteTooLong):
+		return newPlayError(http.StatusBadRequest, "%s", err.Error())
+	}
+	return err
+}
+
+// parseAnswerType reads what a question is answered with from the question
+// forms, a typed answer when left out
+func parseAnswerType(value string) (string, error) {
+	if value == "" {
+		return services.AnswerText, nil
+	}
+	if !services.ValidAnswerType(value) {
+		return "", services.ErrInvalidAnswerType
+	}
+	return value, nil
+}
+
+// checkPhoto checks the team may send a photo as its answer to a question:
+// the question is answered with one, the team is still working on it, it
+// is at the question's place when it has one and no earlier photo is
+// waiting for review
+func (ah *AuthHandler) checkPhoto(ctx context.Context, teamID int, qs *questionState, location string) error {
+	if err := ah.checkHuntOpen(ctx, teamID, true); err != nil {
+		return err
+	}
+	if qs.Question.AnswerType != services.AnswerPhoto {
+		return errNotPhotoQuestion
+	}
+	if qs.Completed {
+		return newPlayError(http.StatusForbidden, "Question already solved")
+	}
+	if qs.Skipped {
+		return errQuestionSkipped
+	}
+	if qs.Checkpoint == services.CheckpointSolve {
+		return errCheckpointAnswer
+	}
+	if qs.Geofence != nil {
+		if err := ah.UserServices.CheckLocationProof(teamID, *qs.Geofence, location); err != nil {
+			return errLocationRequired
+		}
+	}
+	if pending, err := ah.UserServices.HasPendingPhoto(ctx, teamID, qs.Question.ID); err != nil {
+		return err
+	} else if pending {
+		return photoError(services.ErrPhotoPending)
+	}
+	return nil
+}
+
+// submitPhoto stores the one photo of a form as the team's answer to a
+// question and tells the admins it is waiting for them. Everything is
+// checked before the photo is stored; one refused after that, by a photo
+// sent at the same moment, is swept up with the orphaned media
+func (ah *AuthHandler) submitPhoto(ctx context.Context, teamID int, qs *questionState, form *multipart.Form, location, ip string) (services.PhotoSubmission, error) {
+	if err := ah.checkPhoto(ctx, teamID, qs, location); err != nil {
+		return services.PhotoSubmission{}, err
+	}
+	if form == nil || len(form.File["files"]) != 1 {
+		return services.PhotoSubmission{}, errOnePhoto
+	}
+
+	keys, err := ah.UserServices.MakeArray("files", form, services.PhotoFilePrefix)
+	if err != nil {
+		return services.PhotoSubmission{}, mediaUploadError(err)
+	}
+	photo, err := ah.UserServices.SubmitPhoto(ctx, teamID, qs.Question.ID, keys[0], uploadedFilenames(form, "files")[0], ip)
+	if err != nil {
+		return services.PhotoSubmission{}, photoError(err)
+	}
+
+	ah.Broadcaster.BroadcastToAdmins(services.EventPhotoSubmitted, map[string]interface{}{
+		"id":             photo.ID,
+		"hunt_id":        qs.Question.HuntID,
+		"team_id":        photo.TeamID,
+		"team_name":      photo.TeamName,
+		"question_id":    photo.QuestionID,
+		"question_title": photo.QuestionTitle,
+	})
+	return photo, nil
+}
+
+// teamPhotos returns the photos a team sent for a question answered with
+// one, nil for any other
+func (ah *AuthHandler) teamPhotos(ctx context.Context, teamID int, question services.Question) []services.PhotoSubmission {
+	if question.AnswerType != services.AnswerPhoto {
+		return nil
+	}
+	photos, err := ah.UserServices.GetTeamPhotoSubmissions(ctx, teamID, question.ID)
+	if err != nil {
+		return nil
+	}
+	return photos
+}
+
+// PhotoHandler takes a photo from the question page as the team's answer
+func (ah *AuthHandler) PhotoHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "Admin cannot solve questions")
+	}
+	lvl, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid question ID")
+	}
+
+	ctx := c.Request().Context()
+	teamID := c.Get(user_id_key).(int)
+	qs, err := ah.loadQuestion(ctx, teamID, lvl)
+	if err != nil {
+		return playErrorString(c, err)
+	}
+	form, _ := c.MultipartForm()
+	if _, err := ah.submitPhoto(ctx, teamID, qs, form, c.FormValue("location"), c.RealIP()); err != nil {
+		return playErrorString(c, err)
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/hunt/question/%d", lvl))
+}
+
+// APISubmitPhoto takes a photo, sent as the multipart field files, as the
+// team's answer to a question
+func (ah *AuthHandler) APISubmitPhoto(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "Admin cannot solve questions"))
+	}
+	lvl, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid question ID"))
+	}
+
+	ctx := c.Request().Context()
+	teamID := c.Get(user_id_key).(int)
+	qs, err := ah.loadQuestion(ctx, teamID, lvl)
+	if err != nil {
+		return apiError(c, err)
+	}
+	form, _ := c.MultipartForm()
+	photo, err := ah.submitPhoto(ctx, teamID, qs, form, c.FormValue("location"), c.RealIP())
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusCreated, photo)
+}
+
+// PhotoFileHandler serves a photo to admins and to the team that sent it
+func (ah *AuthHandler) PhotoFileHandler(c echo.Context) error {
+	key := c.Param("key")
+	photo, err := ah.UserServices.GetPhotoFile(c.Request().Context(), key)
+	if errors.Is(err, services.ErrPhotoNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !isAdminSession(c) {
+		sess, _ := session.Get(auth_sessions_key, c)
+		if teamID, _ := sess.Values[user_id_key].(int); teamID == 0 || teamID != photo.TeamID {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+	}
+	return ah.serveTeamUpload(c, key, photo.Name)
+}
+
+// gradePhoto approves a photo, awarding the team points for the question,
+// or rejects it, and tells the team either way
+func (ah *AuthHandler) gradePhoto(ctx context.Context, id int, status string, points int, note string) (services.PhotoSubmission, error) {
+	photo, err := ah.UserServices.GetPhotoSubmission(ctx, id)
+	if err != nil {
+		return services.PhotoSubmission{}, photoError(err)
+	}
+	question, err := ah.UserServices.GetQuestionById(ctx, photo.QuestionID)
+	if err != nil {
+		return services.PhotoSubmission{}, err
+	}
+	if status == services.PhotoApproved {
+		if solved, err := ah.UserServices.IsQuestionSolvedByTeam(ctx, photo.TeamID, photo.QuestionID); err != nil {
+			return services.PhotoSubmission{}, err
+		} else if solved {
+			return services.PhotoSubmission{}, newPlayError(http.StatusConflict, "%s already solved this question", photo.TeamName)
+		}
+	}
+
+	photo, err = ah.UserServices.GradePhoto(ctx, id, status, points, strings.TrimSpace(note))
+	if err != nil {
+		return services.PhotoSubmission{}, photoError(err)
+	}
+
+	link := fmt.Sprintf("/hunt/question/%d", photo.QuestionID)
+	if photo.Status == services.PhotoApproved {
+		question.Points = photo.Points
+		if _, err := ah.awardSolve(ctx, photo.TeamID, photo.TeamName, question, "photo "+photo.Name, photo.IP); err != nil {
+			return services.PhotoSubmission{}, err
+		}
+		message := fmt.Sprintf("Your photo for %s earned %d points", photo.QuestionTitle, photo.Points)
+		if photo.Note != "" {
+			message += ": " + photo.Note
+		}
+		ah.notify(ctx, photo.TeamID, services.NotificationPhoto, "Photo approved", message, link)
+		return photo, nil
+	}
+
+	message := fmt.Sprintf("Your photo for %s was not accepted; send another one", photo.QuestionTitle)
+	if photo.Note != "" {
+		message = fmt.Sprintf("Your photo for %s was not accepted: %s", photo.QuestionTitle, photo.Note)
+	}
+	ah.notify(ctx, photo.TeamID, services.NotificationPhoto, "Photo not accepted", message, link)
+	return photo, nil
+}
+
+// AdminPhotosHandler lists the photos sent for the admin's hunt, the ones
+// waiting for review unless another status is asked for
+func (ah *AuthHandler) AdminPhotosHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	status := services.PhotoPending
+	if values := c.QueryParams(); values.Has("status") {
+		status = values.Get("status")
+	}
+
+	photos, err := ah.UserServices.GetPhotoSubmissions(c.Request().Context(), ah.adminHunt(c), status)
+	if errors.Is(err, services.ErrInvalidPhotoStatus) {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching photos: %s", err))
+	}
+
+	view := panel.Photos(fromProtected, photos, status)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.PhotosIndex(
+		"Photo reviews",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminGradePhoto approves or rejects a photo from the review queue
+func (ah *AuthHandler) AdminGradePhoto(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid photo ID")
+	}
+	points, _ := strconv.Atoi(c.FormValue("points"))
+	if _, err := ah.gradePhoto(c.Request().Context(), id, c.FormValue("status"), points, c.FormValue("note")); err != nil {
+		return playErrorString(c, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/photos")
+}
+
+// AdminAPIListPhotos lists the photos sent for a hunt, optionally with
+// one status
+func (ah *AuthHandler) AdminAPIListPhotos(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	photos, err := ah.UserServices.GetPhotoSubmissions(c.Request().Context(), huntID, c.QueryParam("status"))
+	if err != nil {
+		return apiError(c, photoError(err))
+	}
+	return c.JSON(http.StatusOK, photos)
+}
+
+// AdminAPIGradePhoto approves or rejects a photo
+func (ah *AuthHandler) AdminAPIGradePhoto(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	var req struct {
+		Status string `json:"status"`
+		Points int    `json:"points"`
+		Note   string `json:"note"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid request", nil)
+	}
+	photo, err := ah.gradePhoto(c.Request().Context(), id, req.Status, req.Points, req.Note)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, photo)
+}
@@ -0,0 +1,551 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/i18n"
+	"github.com/namishh/holmes/services"
+)
+
+// The player flow shared by the HTML pages and the JSON API
+
+// playError is a failure the player is told about, with the status to report it with
+type playError struct {
+	Status  int
+	Message string
+}
+
+func (e *playError) Error() string {
+	return e.Message
+}
+
+func newPlayError(status int, format string, args ...interface{}) *playError {
+	return &playError{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// errNotEnoughPoints is returned when a team can't afford a hint
+var errNotEnoughPoints = newPlayError(http.StatusPaymentRequired, "Not enough points to unlock this hint")
+
+// errTeamSuspended is returned when an admin has suspended the team
+var errTeamSuspended = newPlayError(http.StatusForbidden, "Your team is suspended")
+
+// errHuntNotStarted and errHuntOver are returned outside the hunt window
+var (
+	errHuntNotStarted = newPlayError(http.StatusForbidden, "The hunt hasn't started yet")
+	errHuntOver       = newPlayError(http.StatusForbidden, "The hunt is over, answers are no longer accepted")
+)
+
+// errRulesPending is returned to teams that must still accept the rules
+var errRulesPending = newPlayError(http.StatusForbidden, "Accept the rules at /rules first")
+
+// checkHuntOpen returns errHuntNotStarted before the hunt starts and, for
+// anything that changes the score, errHuntOver once it has ended; teams can
+// still read the questions after the end. Teams on their own clocks are
+// checked against their own window, suspended teams get errTeamSuspended
+// for everything and teams yet to accept the rules get errRulesPending
+func (ah *AuthHandler) checkHuntOpen(ctx context.Context, teamID int, playing bool) error {
+	if suspended, err := ah.UserServices.IsTeamSuspended(ctx, teamID); err != nil {
+		return err
+	} else if suspended {
+		return errTeamSuspended
+	}
+	if pending, err := ah.UserServices.RulesPending(ctx, teamID); err != nil {
+		return err
+	} else if pending {
+		return errRulesPending
+	}
+
+	window := ah.UserServices.TeamWindow(ctx, teamID)
+	now := time.Now()
+	if !window.Started(now) {
+		return errHuntNotStarted
+	}
+	if playing && window.Ended(now) {
+		return errHuntOver
+	}
+	return nil
+}
+
+// playErrorString reports a playError as plain text in the team's
+// language; server errors and anything else go to the error handler, which
+// shows the error page without leaking their text
+func playErrorString(c echo.Context, err error) error {
+	var pe *playError
+	if errors.As(err, &pe) && pe.Status < 500 {
+		return c.String(pe.Status, i18n.T(c.Request().Context(), pe.Message))
+	}
+	if pe != nil {
+		logServerError(c, err)
+		return echo.NewHTTPError(pe.Status)
+	}
+	return err
+}
+
+// isAdminSession reports whether the request comes from the admin session
+func isAdminSession(c echo.Context) bool {
+	sess, _ := session.Get(auth_sessions_key, c)
+	return sess.Values[user_type] == "admin"
+}
+
+// questionState is what a team may see of a question it is allowed to open
+type questionState struct {
+	Question  services.Question
+	Media     map[string][]string
+	Hints     []services.Hint
+	Completed bool
+	Skipped   bool   // the team spent a skip token on it
+	Locked    bool   // someone holds the lock; only ever this team once loaded
+	Exclusive bool   // the question locks while a team works on it
+	Revealed  bool   // the hunt is over and its answers are out
+	FlagToken string // the team's token when the flag differs per team
+	// Checkpoint is "unlock" or "solve" when the question is opened or
+	// solved by scanning a QR code
+	Checkpoint string
+	// Geofence is the place answers must come from, nil for anywhere
+	Geofence *services.Geofence
+}
+
+// loadQuestion fetches a question and checks the team may work on it:
+// its quota isn't exhausted, nobody else solved it and nobody else holds it
+func (ah *AuthHandler) loadQuestion(ctx context.Context, teamID int, lvl int) (*questionState, error) {
+	if err := ah.checkHuntOpen(ctx, teamID, false); err != nil {
+		return nil, err
+	}
+
+	question, err := ah.UserServices.GetQuestionById(ctx, lvl)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, newPlayError(http.StatusNotFound, "Question not found")
+	}
+	if err != nil {
+		return nil, newPlayError(http.StatusInternalServerError, "Error fetching question")
+	}
+	// Questions of other hunts don't exist as far as the team can tell
+	if ok, err := ah.inTeamHunt(ctx, teamID, question.HuntID); err != nil {
+		return nil, newPlayError(http.StatusInternalServerError, "Error fetching question")
+	} else if !ok {
+		return nil, newPlayError(http.StatusNotFound, "Question not found")
+	}
+	media, err := ah.UserServices.GetMediaByQuestionId(ctx, lvl)
+	if err != nil {
+		return nil, newPlayError(http.StatusInternalServerError, "Error fetching media: %s", err)
+	}
+
+	hasCompleted, err := ah.UserServices.IsQuestionSolvedByTeam(ctx, teamID, lvl)
+	if err != nil {
+		return nil, err
+	}
+	skipped, err := ah.UserServices.IsQuestionSkippedByTeam(ctx, teamID, lvl)
+	if err != nil {
+		return nil, err
+	}
+
+	// Once the answers are out every question can be read, whatever the
+	// quota and locks say
+	revealed := ah.UserServices.SolutionsRevealed(ctx, teamID)
+
+	// Checkpoints that open with a scan stay closed until the team scans
+	// the code at the checkpoint
+	checkpoint, err := ah.UserServices.GetCheckpoint(ctx, lvl)
+	if err != nil {
+		return nil, err
+	}
+	mode := ""
+	if checkpoint != nil {
+		mode = checkpoint.Mode
+	}
+	if mode == services.CheckpointUnlock && !hasCompleted && !skipped && !revealed {
+		if scanned, err := ah.UserServices.CheckpointScanned(ctx, teamID, lvl); err != nil {
+			return nil, err
+		} else if !scanned {
+			return nil, errCheckpointNotScanned
+		}
+	}
+
+	geofence, err := ah.UserServices.GetGeofence(ctx, lvl)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check quota - can the team solve more questions in this time slot?
+	canSolve, quotaSlot, err := ah.UserServices.CanSolveQuestion(ctx, teamID)
+	if err != nil {
+		return nil, newPlayError(http.StatusInternalServerError, "Error checking quota: %s", err)
+	}
+
+	if !canSolve && !hasCompleted && !skipped && !revealed {
+		timeRemaining, _ := ah.UserServices.GetTimeUntilQuotaReset(ctx, teamID)
+		hours := int(timeRemaining.Hours())
+		minutes := int(timeRemaining.Minutes()) % 60
+		return nil, newPlayError(http.StatusForbidden, "Question quota exhausted! You've solved %d/%d questions in this slot. New slot starts in %dh %dm",
+			quotaSlot.QuestionsSolvedInSlot, services.QuotaLimit, hours, minutes)
+	}
+
+	// With exclusive solves off, every team can work on every question at
+	// once and nothing is locked
+	exclusive := ah.UserServices.FlagEnabled(ctx, services.FlagExclusiveSolve)
+	isLocked := false
+	if exclusive && !revealed {
+		// Check if question has been solved by ANYONE
+		solvedByAnyone, err := ah.UserServices.IsQuestionSolvedByAnyone(ctx, lvl)
+		if err != nil {
+			return nil, newPlayError(http.StatusInternalServerError, "Error checking if question is solved: %s", err)
+		}
+
+		// If question is already solved by someone, it should not be lockable
+		if solvedByAnyone && !hasCompleted {
+			return nil, newPlayError(http.StatusForbidden, "This question has already been solved by another team")
+		}
+
+		// Check if question is locked by another user
+		locked, lockInfo, err := ah.UserServices.IsQuestionLocked(ctx, lvl)
+		if err != nil {
+			return nil, newPlayError(http.StatusInternalServerError, "Error checking lock status: %s", err)
+		}
+
+		// If locked by another user, deny access
+		if locked && lockInfo.LockedByTeamID != teamID {
+			return nil, newPlayError(http.StatusForbidden, "Question is currently being solved by %s", lockInfo.LockedByName)
+		}
+		isLocked = locked
+	}
+
+	hints, err := ah.UserServices.GetHintsByQuestionID(ctx, lvl)
+	if err != nil {
+		return nil, err
+	}
+
+	// Questions with a per-team flag show each team its own token
+	token, err := ah.UserServices.TeamFlagToken(ctx, teamID, question)
+	if err != nil {
+		return nil, newPlayError(http.StatusInternalServerError, "Error fetching question")
+	}
+
+	return &questionState{
+		Question:   services.PersonalizeQuestion(question, token),
+		Media:      media,
+		Hints:      hints,
+		Completed:  hasCompleted,
+		Skipped:    skipped,
+		Locked:     isLocked,
+		Exclusive:  exclusive,
+		Revealed:   revealed,
+		FlagToken:  token,
+		Checkpoint: mode,
+		Geofence:   geofence,
+	}, nil
+}
+
+// openQuestion locks the question for the team and starts its timer
+func (ah *AuthHandler) openQuestion(ctx context.Context, teamID int, teamName string, qs *questionState) error {
+	lvl := qs.Question.ID
+	if qs.Revealed || qs.Skipped {
+		return nil
+	}
+
+	// Check if question attempts are exhausted
+	exhausted, err := ah.UserServices.IsQuestionExhausted(ctx, teamID, lvl)
+	if err != nil {
+		return newPlayError(http.StatusInternalServerError, "Error checking attempts: %s", err)
+	}
+	if exhausted {
+		return newPlayError(http.StatusForbidden, "No attempts left for this question")
+	}
+
+	// Once the hunt is over questions are only read, so nothing is locked
+	// or timed
+	if errors.Is(ah.checkHuntOpen(ctx, teamID, true), errHuntOver) {
+		return nil
+	}
+
+	if !qs.Completed && !qs.Locked {
+		// Lock the question for this user (atomic operation)
+		if qs.Exclusive {
+			err = ah.UserServices.LockQuestion(ctx, lvl, teamID)
+			if err != nil {
+				log.Printf("Warning: Error locking question: %s", err)
+			} else {
+				// Broadcast lock event to all connected clients
+				ah.Broadcaster.Broadcast(services.EventQuestionLocked, map[string]interface{}{
+					"question_id": lvl,
+					"team_id":     teamID,
+					"team_name":   teamName,
+				})
+			}
+		}
+
+		// Start the timer
+		err = ah.UserServices.StartQuestionTimer(ctx, teamID, lvl)
+		if err != nil {
+			log.Printf("Warning: Error starting timer: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// answerResult is the outcome of a submitted answer
+type answerResult struct {
+	Correct      bool   `json:"correct"`
+	Points       int    `json:"points,omitempty"`
+	Bonus        int    `json:"bonus,omitempty"`
+	Streak       int    `json:"streak,omitempty"`
+	Penalty      int    `json:"penalty"`
+	AttemptsLeft int    `json:"attempts_left"`
+	RetryAfter   int    `json:"retry_after,omitempty"`
+	Message      string `json:"message"`
+}
+
+// submitAnswer checks an answer, awarding points for a correct one and
+// applying negative marking for a wrong one. Questions answered at a place
+// take the team's proof of being there as location. Every checked answer
+// is logged with the address it came from
+func (ah *AuthHandler) submitAnswer(ctx context.Context, teamID int, teamName string, qs *questionState, answer, location, ip string) (answerResult, error) {
+	lvl := qs.Question.ID
+	question := qs.Question
+
+	if err := ah.checkHuntOpen(ctx, teamID, true); err != nil {
+		return answerResult{}, err
+	}
+
+	if qs.Completed {
+		return answerResult{}, newPlayError(http.StatusForbidden, "Question already solved")
+	}
+	if qs.Skipped {
+		return answerResult{}, errQuestionSkipped
+	}
+	if qs.Checkpoint == services.CheckpointSolve {
+		return answerResult{}, errCheckpointAnswer
+	}
+	if question.AnswerType == services.AnswerPhoto {
+		return answerResult{}, errPhotoAnswer
+	}
+	if qs.Geofence != nil {
+		if err := ah.UserServices.CheckLocationProof(teamID, *qs.Geofence, location); err != nil {
+			return answerResult{}, errLocationRequired
+		}
+	}
+
+	// Check if question attempts are exhausted
+	exhausted, err := ah.UserServices.IsQuestionExhausted(ctx, teamID, lvl)
+	if err != nil {
+		return answerResult{}, newPlayError(http.StatusInternalServerError, "Error checking attempts: %s", err)
+	}
+	if exhausted {
+		return answerResult{}, newPlayError(http.StatusForbidden, "No attempts left for this question")
+	}
+
+	// Make the team sit out the cooldown of its last wrong answer
+	attempts, err := ah.UserServices.GetQuestionAttempts(ctx, teamID, lvl)
+	if err != nil {
+		return answerResult{}, newPlayError(http.StatusInternalServerError, "Error checking attempts: %s", err)
+	}
+	if left := services.CooldownLeft(question, *attempts, time.Now()); left > 0 {
+		return answerResult{}, newPlayError(http.StatusTooManyRequests, "Wait %d seconds before answering again", services.CooldownSeconds(left))
+	}
+
+	correct, err := ah.UserServices.CheckAnswer(ctx, teamID, question, answer)
+	if err != nil {
+		return answerResult{}, newPlayError(http.StatusInternalServerError, "Error Validating: %s", err)
+	}
+	if correct {
+		return ah.awardSolve(ctx, teamID, teamName, question, answer, ip)
+	}
+
+	// Wrong Answer - Apply negative marking
+	penalty, attemptsLeft, err := ah.UserServices.RecordWrongAttempt(ctx, teamID, lvl, question.Points)
+	if err := ah.UserServices.RecordSubmission(ctx, teamID, lvl, answer, ip, false, penalty); err != nil {
+		log.Printf("Warning: Error logging submission: %s", err)
+	}
+	if err != nil {
+		return answerResult{}, newPlayError(http.StatusInternalServerError, "Error recording attempt: %s", err)
+	}
+	wrongAttemptsTotal.Inc()
+	ah.broadcastAlerts(ah.UserServices.InspectWrongAnswer(ctx, teamID, question, answer))
+
+	// Deduct penalty points from team's score
+	if penalty > 0 {
+		err = ah.UserServices.DeductPenaltyPoints(ctx, teamID, penalty)
+		if err != nil {
+			log.Printf("Warning: Error deducting penalty: %s", err)
+		}
+	}
+
+	// Let the rest of the team know how many attempts are left
+	ah.Broadcaster.BroadcastToTeam(teamID, services.EventAttemptsUpdate, map[string]interface{}{
+		"question_id":   lvl,
+		"attempts_left": attemptsLeft,
+		"penalty":       penalty,
+	})
+
+	result := answerResult{Penalty: penalty, AttemptsLeft: attemptsLeft}
+	if attemptsLeft > 0 {
+		result.RetryAfter = services.CooldownSeconds(services.CooldownFor(question, attempts.WrongAttempts+1))
+	}
+
+	// Set error messages with penalty information
+	if penalty == 0 && !ah.UserServices.FlagEnabled(ctx, services.FlagPenalties) {
+		if attemptsLeft > 0 {
+			result.Message = fmt.Sprintf("Incorrect Answer! You have %d attempts left.", attemptsLeft)
+		} else {
+			result.Message = "Incorrect Answer! No more attempts left!"
+		}
+	} else if penalty == 0 && attempts.Shields > 0 && attempts.WrongAttempts > 0 {
+		if attemptsLeft > 0 {
+			result.Message = fmt.Sprintf("Incorrect Answer! Your penalty shield waived the penalty. You have %d attempts left.", attemptsLeft)
+		} else {
+			result.Message = "Incorrect Answer! Your penalty shield waived the penalty. No more attempts left!"
+		}
+	} else if penalty == 0 {
+		result.Message = fmt.Sprintf("Incorrect Answer! This is your warning. You have %d attempts left.", attemptsLeft)
+	} else if attemptsLeft > 0 {
+		result.Message = fmt.Sprintf("Incorrect Answer! -%d points penalty. You have %d attempts left.", penalty, attemptsLeft)
+	} else {
+		result.Message = fmt.Sprintf("Incorrect Answer! -%d points penalty. No more attempts left!", penalty)
+	}
+
+	if attemptsLeft <= 0 {
+		// Unlock the question as attempts are exhausted
+		err = ah.UserServices.UnlockQuestion(ctx, lvl)
+		if err != nil {
+			log.Printf("Warning: Error unlocking question: %s", err)
+		} else {
+			// Broadcast unlock event
+			ah.Broadcaster.Broadcast(services.EventQuestionUnlocked, map[string]interface{}{
+				"question_id": lvl,
+				"reason":      "max_attempts_reached",
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// awardSolve records a solve of question by the team, logged as answer,
+// and tells everyone about it. The solve earns the question's points, or
+// whatever the caller set them to, multiplied by its category's weight.
+// A flagged team's solve is accepted as usual, but earns nothing and is
+// announced only once an admin approves it
+func (ah *AuthHandler) awardSolve(ctx context.Context, teamID int, teamName string, question services.Question, answer, ip string) (answerResult, error) {
+	lvl := question.ID
+	question.Points = ah.UserServices.QuestionWorth(ctx, question)
+	if err := ah.UserServices.RecordSubmission(ctx, teamID, lvl, answer, ip, true, 0); err != nil {
+		log.Printf("Warning: Error logging submission: %s", err)
+	}
+	solve, err := ah.UserServices.RecordSolve(ctx, teamID, lvl, question.Points)
+	if errors.Is(err, services.ErrAlreadySolved) {
+		return answerResult{}, newPlayError(http.StatusForbidden, "Question already solved")
+	}
+	if err != nil {
+		return answerResult{}, newPlayError(http.StatusInternalServerError, "Error Validating: %s", err)
+	}
+	ah.broadcastQuota(ctx, teamID)
+	solvesTotal.Inc()
+	result := answerResult{Correct: true, Points: question.Points, Bonus: solve.Bonus, Streak: solve.Streak, Message: "Correct Answer!"}
+	if solve.Bonus > 0 {
+		result.Message = fmt.Sprintf("Correct Answer! +%d streak bonus for %d in a row.", solve.Bonus, solve.Streak)
+	}
+
+	// The question's lock is released either way
+	ah.Broadcaster.Broadcast(services.EventQuestionUnlocked, map[string]interface{}{
+		"question_id": lvl,
+	})
+
+	if !solve.Pending {
+		ah.announceSolve(ctx, solve, teamName, question.Title)
+	}
+	return result, nil
+}
+
+// announceSolve tells everyone about a solve that counts, which sets off
+// its achievements and webhooks
+func (ah *AuthHandler) announceSolve(ctx context.Context, solve services.Solve, teamName, questionTitle string) {
+	ah.Broadcaster.Broadcast(services.EventQuestionSolved, map[string]interface{}{
+		"question_id": solve.QuestionID,
+		"team_id":     solve.TeamID,
+		"team_name":   teamName,
+		"points":      solve.Points,
+		"bonus":       solve.Bonus,
+		"solved_at":   solve.SolvedAt,
+	})
+	ah.Broadcaster.Broadcast(services.EventLeaderboardUpdate, map[string]interface{}{
+		"message": "Leaderboard updated",
+	})
+
+	payload := map[string]interface{}{
+		"question_id":    solve.QuestionID,
+		"question_title": questionTitle,
+		"team_id":        solve.TeamID,
+		"team_name":      teamName,
+		"points":         solve.Points,
+	}
+	ah.emitWebhook(ctx, services.WebhookQuestionSolved, payload)
+	if solve.FirstBlood {
+		ah.emitWebhook(ctx, services.WebhookFirstBlood, payload)
+	}
+}
+
+// announceApproved announces solves an admin approved. A team still under
+// review only hears of its own, so its badges are still awarded
+func (ah *AuthHandler) announceApproved(ctx context.Context, solves ...services.ApprovedSolve) {
+	for _, s := range solves {
+		if s.Hidden {
+			ah.Broadcaster.BroadcastToTeam(s.TeamID, services.EventQuestionSolved, map[string]interface{}{
+				"question_id": s.QuestionID,
+				"team_id":     s.TeamID,
+				"team_name":   s.TeamName,
+				"points":      s.Points,
+				"solved_at":   s.SolvedAt,
+			})
+			continue
+		}
+		ah.announceSolve(ctx, s.Solve, s.TeamName, s.QuestionTitle)
+	}
+}
+
+// buyHint unlocks a hint for the team, charging its worth the first time,
+// and returns its text and whether the team already owned it
+func (ah *AuthHandler) buyHint(ctx context.Context, teamID int, teamName string, hintID int) (string, bool, error) {
+	if err := ah.checkHuntOpen(ctx, teamID, true); err != nil {
+		return "", false, err
+	}
+
+	huntID, err := ah.UserServices.GetHintHuntID(ctx, hintID)
+	if err != nil {
+		return "", false, newPlayError(http.StatusNotFound, "Hint not found")
+	}
+	if ok, err := ah.inTeamHunt(ctx, teamID, huntID); err != nil {
+		return "", false, err
+	} else if !ok {
+		return "", false, newPlayError(http.StatusNotFound, "Hint not found")
+	}
+
+	hastaken, err := ah.UserServices.HasTeamUnlockedHint(ctx, teamID, hintID)
+	if err != nil {
+		return "", false, err
+	}
+
+	hint, worth, err := ah.UserServices.GetHintById(ctx, hintID)
+	if err != nil {
+		return "", false, newPlayError(http.StatusNotFound, "Hint not found")
+	}
+
+	if !hastaken {
+		user, _ := ah.UserServices.CheckUsername(ctx, teamName)
+		if user.Points < worth {
+			return "", false, errNotEnoughPoints
+		}
+		if err := ah.UserServices.UnlockHintForTeam(ctx, teamID, hintID, worth); err != nil {
+			return "", false, err
+		}
+	}
+
+	return hint, hastaken, nil
+}
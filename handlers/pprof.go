@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/labstack/echo/v4"
+)
+
+// pprofProfiles are the runtime profiles served by name
+var pprofProfiles = map[string]bool{
+	"allocs":       true,
+	"block":        true,
+	"goroutine":    true,
+	"heap":         true,
+	"mutex":        true,
+	"threadcreate": true,
+}
+
+// registerPprof serves net/http/pprof under g, which must be behind admin
+// auth. A CPU profile or trace can't run longer than the server's write
+// timeout, so ask for fewer seconds than that:
+//
+//	curl -H "Authorization: Bearer $TOKEN" -o cpu.pprof \
+//	    "https://hunt.example.com/api/admin/debug/pprof/profile?seconds=30"
+//	go tool pprof cpu.pprof
+func registerPprof(g *echo.Group) {
+	g.GET("/debug/pprof/", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	g.GET("/debug/pprof/cmdline", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	g.GET("/debug/pprof/profile", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	g.GET("/debug/pprof/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	g.POST("/debug/pprof/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	g.GET("/debug/pprof/trace", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+
+	// pprof.Index only serves profiles under /debug/pprof/ itself, so the
+	// named ones are routed here
+	g.GET("/debug/pprof/:name", func(c echo.Context) error {
+		name := c.Param("name")
+		if !pprofProfiles[name] {
+			return echo.ErrNotFound
+		}
+		pprof.Handler(name).ServeHTTP(c.Response(), c.Request())
+		return nil
+	})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/hunt"
+)
+
+var errProfileNotFound = newPlayError(http.StatusNotFound, "Team not found")
+
+// viewTeamProfile returns the profile of a team in the viewer's hunt, as the
+// viewer sees it
+func (ah *AuthHandler) viewTeamProfile(c echo.Context, name string, huntID int) (services.TeamProfile, error) {
+	viewer, _ := c.Get(user_name_key).(string)
+	profile, err := ah.UserServices.GetTeamProfile(c.Request().Context(), name, viewer)
+	if errors.Is(err, services.ErrTeamNotFound) {
+		return services.TeamProfile{}, errProfileNotFound
+	}
+	if err != nil {
+		return services.TeamProfile{}, err
+	}
+	if profile.HuntID != huntID {
+		return services.TeamProfile{}, errProfileNotFound
+	}
+	return profile, nil
+}
+
+// TeamProfileHandler shows a team of the viewer's hunt: its rank and score,
+// its solves in order, and the hints and penalties it took
+func (ah *AuthHandler) TeamProfileHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	huntID, err := ah.requestHunt(c)
+	if err != nil {
+		return err
+	}
+	profile, err := ah.viewTeamProfile(c, c.Param("name"), huntID)
+	if err != nil {
+		return playErrorString(c, err)
+	}
+
+	own := profile.Name == c.Get(user_name_key).(string)
+	errs := make(map[string]string)
+	telegramChats := -1
+	var phone *services.TeamPhone
+	if own && !isAdminSession(c) {
+		errs["verify"] = ah.verificationNotice(c, c.Get(user_id_key).(int))
+		telegramChats = ah.telegramChatCount(c, c.Get(user_id_key).(int))
+		phone = ah.teamPhone(c, c.Get(user_id_key).(int))
+	}
+
+	view := hunt.TeamProfile(fromProtected, profile, own, errs, telegramChats, phone)
+	c.Set("ISERROR", false)
+	return renderView(c, hunt.TeamProfileIndex(
+		profile.Name,
+		c.Get(user_name_key).(string),
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// renderOwnProfile shows the team its own profile again with what was
+// wrong with a form it sent from there
+func (ah *AuthHandler) renderOwnProfile(c echo.Context, errs map[string]string) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	huntID, err := ah.requestHunt(c)
+	if err != nil {
+		return err
+	}
+	teamName := c.Get(user_name_key).(string)
+	profile, err := ah.viewTeamProfile(c, teamName, huntID)
+	if err != nil {
+		return playErrorString(c, err)
+	}
+
+	teamID := c.Get(user_id_key).(int)
+	view := hunt.TeamProfile(fromProtected, profile, true, errs,
+		ah.telegramChatCount(c, teamID), ah.teamPhone(c, teamID))
+	c.Set("ISERROR", false)
+	return renderView(c, hunt.TeamProfileIndex(
+		profile.Name,
+		teamName,
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// MyTeamHandler sends a team to its own profile; the admin, who has no
+// team, goes to the leaderboard
+func (ah *AuthHandler) MyTeamHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.Redirect(http.StatusSeeOther, "/hunt/leaderboard")
+	}
+	return c.Redirect(http.StatusSeeOther, "/team/"+url.PathEscape(c.Get(user_name_key).(string)))
+}
+
+// APITeamProfile returns the profile of a team in the caller's hunt
+func (ah *AuthHandler) APITeamProfile(c echo.Context) error {
+	huntID, err := ah.teamHunt(c.Request().Context(), c.Get(user_id_key).(int))
+	if err != nil {
+		return apiError(c, err)
+	}
+	profile, err := ah.viewTeamProfile(c, c.Param("name"), huntID)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, profile)
+}
+
+// APIAchievements lists every badge teams can earn
+func (ah *AuthHandler) APIAchievements(c echo.Context) error {
+	return c.JSON(http.StatusOK, services.Achievements())
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"github.com/labstack/echo-contrib/echoprometheus"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var (
+	solvesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "holmes",
+		Name:      "solves_total",
+		Help:      "Questions solved by teams.",
+	})
+	wrongAttemptsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "holmes",
+		Name:      "wrong_attempts_total",
+		Help:      "Wrong answers submitted by teams.",
+	})
+)
+
+// PrometheusMiddleware records request counts, sizes and latency per route
+// under holmes_http_*. Scrapes of /metrics itself aren't counted
+func PrometheusMiddleware() echo.MiddlewareFunc {
+	return echoprometheus.NewMiddlewareWithConfig(echoprometheus.MiddlewareConfig{
+		Namespace: "holmes",
+		Subsystem: "http",
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/metrics"
+		},
+		// Unmatched paths and Host headers would otherwise each get
+		// their own series
+		DoNotUseRequestPathFor404: true,
+		LabelFuncs: map[string]echoprometheus.LabelValueFunc{
+			"host": func(c echo.Context, err error) string { return "" },
+		},
+	})
+}
+
+// RegisterMetrics registers the hunt's gauges and counters alongside the
+// Go runtime and process metrics Prometheus collects by default
+func RegisterMetrics(broadcaster *services.Broadcaster, db *sql.DB) {
+	prometheus.MustRegister(
+		solvesTotal,
+		wrongAttemptsTotal,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "holmes",
+			Name:      "sse_clients",
+			Help:      "Clients connected for real-time events.",
+		}, func() float64 {
+			return float64(broadcaster.GetClientCount())
+		}),
+		collectors.NewDBStatsCollector(db, "holmes"),
+	)
+}
+
+// PrometheusHandler serves the metrics in Prometheus format
+func PrometheusHandler() echo.HandlerFunc {
+	return echoprometheus.NewHandler()
+}
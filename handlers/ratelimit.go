@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -57,6 +59,9 @@ func (rl *RateLimiter) Cleanup(interval time.Duration) {
 }
 
 // RateLimitMiddleware creates an Echo middleware for rate limiting
+// Every response carries X-RateLimit-Limit (the burst), X-RateLimit-Remaining
+// and X-RateLimit-Reset (seconds until the bucket is full again); rejected
+// requests also get Retry-After
 func RateLimitMiddleware(requestsPerSecond float64, burst int) echo.MiddlewareFunc {
 	limiter := NewRateLimiter(requestsPerSecond, burst)
 	limiter.Cleanup(10 * time.Minute)
@@ -64,24 +69,67 @@ func RateLimitMiddleware(requestsPerSecond float64, burst int) echo.MiddlewareFu
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			ip := c.RealIP()
-			
-			if !limiter.getLimiter(ip).Allow() {
-				return c.JSON(http.StatusTooManyRequests, map[string]string{
-					"error": "Rate limit exceeded. Please slow down your requests.",
-				})
+			l := limiter.getLimiter(ip)
+			now := time.Now()
+
+			r := l.ReserveN(now, 1)
+			if delay := r.DelayFrom(now); !r.OK() || delay > 0 {
+				// Give the token back, the request isn't going to be served
+				r.CancelAt(now)
+				setRateLimitHeaders(c, l, now)
+				c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(ceilSeconds(delay)))
+				return jsonError(c, http.StatusTooManyRequests, "Rate limit exceeded. Please slow down your requests.", nil)
 			}
 
+			setRateLimitHeaders(c, l, now)
 			return next(c)
 		}
 	}
 }
 
+// setRateLimitHeaders describes the state of a client's bucket
+func setRateLimitHeaders(c echo.Context, l *rate.Limiter, now time.Time) {
+	tokens := l.TokensAt(now)
+	if tokens < 0 {
+		tokens = 0
+	}
+
+	reset := 0
+	if missing := float64(l.Burst()) - tokens; missing > 0 && l.Limit() > 0 {
+		reset = ceilSeconds(time.Duration(missing / float64(l.Limit()) * float64(time.Second)))
+	}
+
+	h := c.Response().Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(l.Burst()))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(int(math.Floor(tokens))))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(reset))
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// RateLimit allows Rate requests per second per client, in bursts of up
+// to Burst
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// The limits behind StrictRateLimitMiddleware and
+// ModerateRateLimitMiddleware; change them before SetupRoutes
+var (
+	StrictRateLimit   = RateLimit{Rate: 2, Burst: 5}
+	ModerateRateLimit = RateLimit{Rate: 10, Burst: 20}
+)
+
 // StrictRateLimitMiddleware is for more sensitive endpoints
 func StrictRateLimitMiddleware() echo.MiddlewareFunc {
-	return RateLimitMiddleware(2, 5) // 2 requests per second, burst of 5
+	return RateLimitMiddleware(StrictRateLimit.Rate, StrictRateLimit.Burst)
 }
 
 // ModerateRateLimitMiddleware is for general API endpoints
 func ModerateRateLimitMiddleware() echo.MiddlewareFunc {
-	return RateLimitMiddleware(10, 20) // 10 requests per second, burst of 20
+	return RateLimitMiddleware(ModerateRateLimit.Rate, ModerateRateLimit.Burst)
 }
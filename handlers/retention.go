@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// AdminRetentionHandler shows the data retention policy, saves it, and
+// previews or runs the purge
+func (ah *AuthHandler) AdminRetentionHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	errs := make(map[string]string)
+	var report *services.RetentionReport
+	if c.Request().Method == http.MethodPost {
+		switch c.FormValue("action") {
+		case "save":
+			policy := services.RetentionPolicy{Teams: c.FormValue("teams"), Logs: c.FormValue("logs") != ""}
+			days, err := strconv.Atoi(strings.TrimSpace(c.FormValue("days")))
+			if err != nil {
+				errs["policy"] = "Days must be a whole number"
+				break
+			}
+			policy.Days = days
+			err = ah.UserServices.SetRetentionPolicy(c.Request().Context(), policy)
+			if errors.Is(err, services.ErrInvalidRetention) {
+				errs["policy"] = fmt.Sprintf("Days are between 0 and %d", services.MaxRetentionDays)
+				break
+			}
+			if err != nil {
+				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving setting: %s", err))
+			}
+			return c.Redirect(http.StatusSeeOther, "/su/retention")
+		case "preview", "purge":
+			r, err := ah.UserServices.PurgeRetained(c.Request().Context(), ah.adminHunt(c), c.FormValue("action") == "preview")
+			if err != nil {
+				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error purging: %s", err))
+			}
+			report = &r
+		default:
+			return c.String(http.StatusBadRequest, "Invalid action")
+		}
+	}
+
+	view := panel.Retention(fromProtected, errs, ah.UserServices.GetRetentionPolicy(c.Request().Context()), report)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.RetentionIndex(
+		"Data Retention",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminAPIGetRetention returns what is purged after the hunt, and when
+func (ah *AuthHandler) AdminAPIGetRetention(c echo.Context) error {
+	return c.JSON(http.StatusOK, ah.UserServices.GetRetentionPolicy(c.Request().Context()))
+}
+
+// AdminAPISetRetention sets what is purged after the hunt, and when
+func (ah *AuthHandler) AdminAPISetRetention(c echo.Context) error {
+	var req services.RetentionPolicy
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	err := ah.UserServices.SetRetentionPolicy(c.Request().Context(), req)
+	if errors.Is(err, services.ErrInvalidRetention) {
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", err))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+	return ah.AdminAPIGetRetention(c)
+}
+
+// AdminAPIPurge runs the retention purge of a hunt now, or with
+// ?dry_run=true reports what it would remove
+func (ah *AuthHandler) AdminAPIPurge(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	dryRun, _ := strconv.ParseBool(c.QueryParam("dry_run"))
+	report, err := ah.UserServices.PurgeRetained(c.Request().Context(), huntID, dryRun)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
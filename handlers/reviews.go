@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// reviewError maps solve review errors to play errors
+func reviewError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrReviewNotFound):
+		return newPlayError(http.StatusNotFound, "Review not found")
+	case errors.Is(err, services.ErrInvalidReviewStatus):
+		return newPlayError(http.StatusBadRequest, "%s", err)
+	}
+	return teamActionError(err)
+}
+
+// AdminReviewsHandler lists the solves of flagged teams in the admin's hunt,
+// the pending ones unless another status is asked for, and the flagged
+// teams themselves
+func (ah *AuthHandler) AdminReviewsHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	status := services.ReviewPending
+	if values := c.QueryParams(); values.Has("status") {
+		status = values.Get("status")
+	}
+
+	reviews, err := ah.UserServices.GetSolveReviews(c.Request().Context(), ah.adminHunt(c), status)
+	if errors.Is(err, services.ErrInvalidReviewStatus) {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching reviews: %s", err))
+	}
+	teams, err := ah.UserServices.GetAllUsers(c.Request().Context(), ah.adminHunt(c))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching teams: %s", err))
+	}
+	flagged := make([]services.User, 0)
+	for _, t := range teams {
+		if t.FlaggedAt != nil {
+			flagged = append(flagged, t)
+		}
+	}
+
+	view := panel.Reviews(fromProtected, reviews, status, flagged)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.ReviewsIndex(
+		"Reviews",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminApproveSolve lets a flagged team's solve stand
+func (ah *AuthHandler) AdminApproveSolve(c echo.Context) error {
+	return ah.adminSettleSolve(c, services.ReviewApproved)
+}
+
+// AdminRejectSolve takes back a flagged team's solve
+func (ah *AuthHandler) AdminRejectSolve(c echo.Context) error {
+	return ah.adminSettleSolve(c, services.ReviewRejected)
+}
+
+func (ah *AuthHandler) adminSettleSolve(c echo.Context, status string) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid review ID")
+	}
+	ctx := c.Request().Context()
+	solve, err := ah.UserServices.SettleSolveReview(ctx, id, status)
+	if err != nil {
+		return playErrorString(c, reviewError(err))
+	}
+	if solve != nil {
+		ah.announceApproved(ctx, *solve)
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/reviews")
+}
+
+// AdminFlagTeam puts a team under review
+func (ah *AuthHandler) AdminFlagTeam(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid team ID")
+	}
+	if err := ah.UserServices.FlagTeam(c.Request().Context(), id); err != nil {
+		return playErrorString(c, reviewError(err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su")
+}
+
+// AdminClearTeam ends a team's review, letting its waiting solves stand
+func (ah *AuthHandler) AdminClearTeam(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid team ID")
+	}
+	ctx := c.Request().Context()
+	solves, err := ah.UserServices.ClearTeam(ctx, id)
+	if err != nil {
+		return playErrorString(c, reviewError(err))
+	}
+	ah.announceApproved(ctx, solves...)
+	return c.Redirect(http.StatusSeeOther, "/su/reviews")
+}
+
+// AdminBanTeam ends a team's review by suspending it and taking back its
+// waiting solves
+func (ah *AuthHandler) AdminBanTeam(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid team ID")
+	}
+	if err := ah.UserServices.BanTeam(c.Request().Context(), id); err != nil {
+		return playErrorString(c, reviewError(err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/reviews")
+}
+
+// AdminAPIListReviews lists the solve reviews of a hunt, optionally with one
+// status
+func (ah *AuthHandler) AdminAPIListReviews(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	reviews, err := ah.UserServices.GetSolveReviews(c.Request().Context(), huntID, c.QueryParam("status"))
+	if err != nil {
+		return apiError(c, reviewError(err))
+	}
+	return c.JSON(http.StatusOK, reviews)
+}
+
+// AdminAPISettleReview approves or rejects a waiting solve
+func (ah *AuthHandler) AdminAPISettleReview(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid request", nil)
+	}
+	ctx := c.Request().Context()
+	solve, err := ah.UserServices.SettleSolveReview(ctx, id, req.Status)
+	if err != nil {
+		return apiError(c, reviewError(err))
+	}
+	if solve != nil {
+		ah.announceApproved(ctx, *solve)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AdminAPIFlagTeam puts a team under review
+func (ah *AuthHandler) AdminAPIFlagTeam(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if err := ah.UserServices.FlagTeam(c.Request().Context(), id); err != nil {
+		return apiError(c, reviewError(err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AdminAPIClearTeam ends a team's review, letting its waiting solves stand
+func (ah *AuthHandler) AdminAPIClearTeam(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	ctx := c.Request().Context()
+	solves, err := ah.UserServices.ClearTeam(ctx, id)
+	if err != nil {
+		return apiError(c, reviewError(err))
+	}
+	ah.announceApproved(ctx, solves...)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AdminAPIBanTeam ends a team's review by suspending it and taking back its
+// waiting solves
+func (ah *AuthHandler) AdminAPIBanTeam(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if err := ah.UserServices.BanTeam(c.Request().Context(), id); err != nil {
+		return apiError(c, reviewError(err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
 )
 
 func SetupRoutes(e *echo.Echo, ah *AuthHandler) {
+	e.Use(ah.brandingMiddleware)
+
 	e.GET("/", ah.flagsMiddleware(ah.HomeHandler))
 
 	// AUTH ROUTES
@@ -14,38 +17,263 @@ func SetupRoutes(e *echo.Echo, ah *AuthHandler) {
 	e.GET("/login", ah.flagsMiddleware(ah.LoginHandler))
 	e.POST("/login", ah.flagsMiddleware(ah.LoginHandler))
 
+	// Password resets and email confirmation, from links teams are emailed
+	e.GET("/forgot-password", ah.flagsMiddleware(ah.ForgotPasswordHandler))
+	e.POST("/forgot-password", ah.flagsMiddleware(ah.ForgotPasswordHandler), StrictRateLimitMiddleware())
+	e.GET("/reset-password", ah.flagsMiddleware(ah.ResetPasswordHandler))
+	e.POST("/reset-password", ah.flagsMiddleware(ah.ResetPasswordHandler), StrictRateLimitMiddleware())
+	e.GET("/verify-email", ah.flagsMiddleware(ah.VerifyEmailHandler))
+
 	sugroup := e.Group("/sudo", csrfMiddleware())
 	sugroup.GET("", ah.flagsMiddleware(ah.AdminHandler))
 	sugroup.POST("", ah.flagsMiddleware(ah.AdminHandler))
 
 	e.GET("/logout", ah.flagsMiddleware(ah.LogoutHandler))
 
+	e.GET("/leaderboard", ah.flagsMiddleware(ah.PublicLeaderboard))
+
+	// Announcements, the public ones for visitors who aren't signed in
+	e.GET("/announcements", ah.flagsMiddleware(ah.AnnouncementsHandler))
+
+	// Pages the admins wrote, such as the rules or the FAQ
+	e.GET("/p/:slug", ah.flagsMiddleware(ah.PageHandler))
+	e.GET("/rules", ah.flagsMiddleware(ah.RulesHandler))
+	e.POST("/rules/accept", ah.AcceptRulesHandler, ah.authMiddleware)
+
+	// Where checkpoint QR codes lead; the page asks before checking in, so
+	// link previews don't count as scans
+	e.GET("/checkpoint/:token", ah.flagsMiddleware(ah.CheckpointHandler))
+	e.POST("/checkpoint/:token", ah.flagsMiddleware(ah.CheckpointHandler), StrictRateLimitMiddleware())
+
+	// When the hunt runs, for calendar apps to subscribe to
+	e.GET("/calendar.ics", ah.CalendarHandler)
+
+	// The language picked in the menu
+	e.GET("/lang/:code", ah.LanguageHandler)
+
+	// Writeups from after the hunt; attachments check access themselves
+	e.GET("/writeups", ah.flagsMiddleware(ah.WriteupGalleryHandler))
+	e.GET("/writeups/files/:key", ah.flagsMiddleware(ah.WriteupFileHandler))
+
+	// Photos sent as answers, only shown to admins and the team that sent
+	// them
+	e.GET("/photos/:key", ah.PhotoFileHandler)
+
 	protectedgroup := e.Group("/hunt", ah.authMiddleware)
 	protectedgroup.GET("", ah.Hunt)
 	protectedgroup.GET("/leaderboard", ah.Leaderboard)
 	protectedgroup.GET("/question/:id", ah.Question)
 	protectedgroup.GET("/openhint/:id", ah.UnlockHint)
 	protectedgroup.POST("/question/:id", ah.Question)
+	protectedgroup.POST("/question/:id/skip", ah.SkipQuestionHandler, StrictRateLimitMiddleware())
+	protectedgroup.POST("/question/:id/photo", ah.PhotoHandler, StrictRateLimitMiddleware(), ah.slotLimit("images", 1))
+	protectedgroup.POST("/question/:id/feedback", ah.FeedbackHandler, StrictRateLimitMiddleware())
+	protectedgroup.POST("/question/:id/clarify", ah.AskClarificationHandler, StrictRateLimitMiddleware())
+	protectedgroup.GET("/notifications", ah.NotificationsHandler)
+	protectedgroup.GET("/chat", ah.ChatHandler)
+	protectedgroup.GET("/question/:id/writeup", ah.WriteupHandler)
+	protectedgroup.POST("/question/:id/writeup", ah.WriteupHandler, ah.slotLimit("files", services.WriteupMaxFiles))
+	protectedgroup.GET("/question/:id/writeup/delfile/:fid", ah.DeleteWriteupFileHandler)
+	protectedgroup.GET("/store", ah.StoreHandler)
+	protectedgroup.POST("/store/use", ah.UsePowerUpHandler, StrictRateLimitMiddleware())
+	protectedgroup.POST("/store/:kind", ah.BuyPowerUpHandler, StrictRateLimitMiddleware())
+
+	// Read-only views for spectators, who are never signed in as a team
+	spectategroup := e.Group("/spectate", ah.spectatorMiddleware)
+	spectategroup.GET("", ah.SpectateHandler)
+	spectategroup.GET("/leaderboard", ah.SpectatorLeaderboardHandler)
+	spectategroup.GET("/events", ah.SSEHandler) // global events only
+
+	// Team profiles, for teams of the same hunt
+	e.GET("/team", ah.MyTeamHandler, ah.authMiddleware)
+	e.GET("/team/:name", ah.TeamProfileHandler, ah.authMiddleware)
+	e.POST("/team/avatar", ah.TeamAvatarHandler, ah.authMiddleware, StrictRateLimitMiddleware())
+	e.GET("/team/avatar/delete", ah.DeleteTeamAvatarHandler, ah.authMiddleware)
+	e.POST("/team/verify-email", ah.ResendVerificationHandler, ah.authMiddleware, StrictRateLimitMiddleware())
+	e.POST("/team/telegram", ah.TelegramLinkHandler, ah.authMiddleware, StrictRateLimitMiddleware())
+	e.POST("/team/telegram/unlink", ah.TelegramUnlinkHandler, ah.authMiddleware)
+	e.POST("/team/phone", ah.TeamPhoneHandler, ah.authMiddleware, StrictRateLimitMiddleware())
+	e.POST("/team/phone/confirm", ah.TeamPhoneConfirmHandler, ah.authMiddleware, StrictRateLimitMiddleware())
+	e.POST("/team/phone/remove", ah.TeamPhoneRemoveHandler, ah.authMiddleware)
+	e.GET("/team/data/export", ah.MyDataHandler, ah.authMiddleware, StrictRateLimitMiddleware())
+
+	// Team avatars, shown wherever the leaderboard is
+	e.GET("/avatars/:key", ah.AvatarHandler)
+	e.GET("/brand/logo/:key", ah.LogoHandler)
+
+	// Question media, only served to teams allowed to open the question
+	e.GET("/media/:key", ah.MediaHandler, ah.authMiddleware)
 
 	// API endpoints for real-time updates
+	// The JSON ones are also served under /api/v1, which new clients should use
 	apigroup := e.Group("/api", ah.authMiddleware)
-	apigroup.GET("/events", ah.SSEHandler) // SSE endpoint for real-time updates
+	apigroup.GET("/events", ah.SSEHandler)    // SSE endpoint for real-time updates
+	apigroup.GET("/ws", ah.WebSocketHandler) // WebSocket endpoint carrying the same events
+	apigroup.GET("/countdown", ah.CountdownSSEHandler) // SSE ticks until the hunt starts
 	apigroup.GET("/locked-questions", ah.GetLockedQuestionsAPI, ModerateRateLimitMiddleware())
+	apigroup.GET("/questions", ah.APIQuestions, ModerateRateLimitMiddleware())
+	apigroup.GET("/leaderboard", ah.APILeaderboard, ModerateRateLimitMiddleware())
 	apigroup.GET("/question-status/:id", ah.GetQuestionStatusAPI, ModerateRateLimitMiddleware())
+	apigroup.GET("/notifications", ah.GetNotificationsAPI, ModerateRateLimitMiddleware())
+	apigroup.POST("/notifications/read", ah.MarkNotificationsReadAPI)
+	apigroup.GET("/push/key", ah.GetPushKeyAPI)
+	apigroup.POST("/push/subscribe", ah.PushSubscribeAPI, ModerateRateLimitMiddleware())
+	apigroup.POST("/push/unsubscribe", ah.PushUnsubscribeAPI, ModerateRateLimitMiddleware())
+	apigroup.GET("/chat", ah.GetChatMessagesAPI, ModerateRateLimitMiddleware())
+	apigroup.POST("/chat", ah.PostChatMessageAPI, StrictRateLimitMiddleware())
+	
+	// JSON API for headless clients
+	e.POST("/api/v1/login", ah.APILogin, StrictRateLimitMiddleware())
+	v1 := e.Group("/api/v1", ah.apiAuthMiddleware)
+	v1.POST("/logout", ah.APILogout)
+	v1.GET("/me", ah.APIMe)
+	v1.GET("/me/export", ah.APIExportMyData, StrictRateLimitMiddleware())
+	v1.GET("/questions", ah.APIQuestions, ModerateRateLimitMiddleware())
+	v1.GET("/questions/:id", ah.APIQuestion, ModerateRateLimitMiddleware())
+	v1.POST("/questions/:id/answer", ah.APISubmitAnswer, StrictRateLimitMiddleware())
+	v1.POST("/hints/:id/unlock", ah.APIUnlockHint, StrictRateLimitMiddleware())
+	v1.GET("/store", ah.APIStore, ModerateRateLimitMiddleware())
+	v1.POST("/store/:kind", ah.APIBuyPowerUp, StrictRateLimitMiddleware())
+	v1.POST("/questions/:id/powerups/:kind", ah.APIUsePowerUp, StrictRateLimitMiddleware())
+	v1.POST("/questions/:id/skip", ah.APISkipQuestion, StrictRateLimitMiddleware())
+	v1.POST("/questions/:id/location", ah.APIQuestionLocation, StrictRateLimitMiddleware())
+	v1.POST("/questions/:id/photo", ah.APISubmitPhoto, StrictRateLimitMiddleware(), ah.slotLimit("images", 1))
+	v1.POST("/checkpoints/scan", ah.APIScanCheckpoint, StrictRateLimitMiddleware())
+	v1.GET("/questions/:id/feedback", ah.APIGetFeedback, ModerateRateLimitMiddleware())
+	v1.PUT("/questions/:id/feedback", ah.APISubmitFeedback, StrictRateLimitMiddleware())
+	v1.GET("/questions/:id/clarifications", ah.APIListClarifications, ModerateRateLimitMiddleware())
+	v1.POST("/questions/:id/clarifications", ah.APIAskClarification, StrictRateLimitMiddleware())
+	v1.GET("/leaderboard", ah.APILeaderboard, ModerateRateLimitMiddleware())
+	v1.GET("/teams/:name", ah.APITeamProfile, ModerateRateLimitMiddleware())
+	v1.GET("/achievements", ah.APIAchievements)
+	v1.PUT("/avatar", ah.APISetAvatar, StrictRateLimitMiddleware())
+	v1.DELETE("/avatar", ah.APIDeleteAvatar)
+	v1.GET("/quota", ah.APIQuota, ModerateRateLimitMiddleware())
+	v1.GET("/locked-questions", ah.GetLockedQuestionsAPI, ModerateRateLimitMiddleware())
+	v1.GET("/question-status/:id", ah.GetQuestionStatusAPI, ModerateRateLimitMiddleware())
+	v1.GET("/notifications", ah.GetNotificationsAPI, ModerateRateLimitMiddleware())
+	v1.POST("/notifications/read", ah.MarkNotificationsReadAPI)
+	v1.GET("/push/key", ah.GetPushKeyAPI)
+	v1.POST("/push/subscribe", ah.PushSubscribeAPI, ModerateRateLimitMiddleware())
+	v1.POST("/push/unsubscribe", ah.PushUnsubscribeAPI, ModerateRateLimitMiddleware())
+	v1.GET("/chat", ah.GetChatMessagesAPI, ModerateRateLimitMiddleware())
+	v1.POST("/chat", ah.PostChatMessageAPI, StrictRateLimitMiddleware())
+	v1.GET("/questions/:id/writeup", ah.APIWriteup, ModerateRateLimitMiddleware())
+	v1.PUT("/questions/:id/writeup", ah.APISaveWriteup, StrictRateLimitMiddleware(), ah.slotLimit("files", services.WriteupMaxFiles))
+
+	// Admin REST API for provisioning hunts from scripts
+	adminapi := e.Group("/api/admin", ah.adminAPIMiddleware)
+	adminapi.GET("/questions", ah.AdminAPIListQuestions)
+	adminapi.POST("/questions", ah.AdminAPICreateQuestion)
+	adminapi.GET("/questions/:id", ah.AdminAPIGetQuestion)
+	adminapi.PUT("/questions/:id", ah.AdminAPIUpdateQuestion)
+	adminapi.DELETE("/questions/:id", ah.AdminAPIDeleteQuestion)
+	adminapi.GET("/questions/:id/flags", ah.AdminAPIListTeamFlags)
+	adminapi.POST("/questions/:id/media/presign", ah.AdminPresignMediaHandler)
+	adminapi.POST("/questions/:id/media/confirm", ah.AdminConfirmMediaHandler)
+	adminapi.POST("/questions/:id/media/uploads", ah.AdminCreateUploadHandler)
+	adminapi.GET("/questions/:id/media/uploads/:uid", ah.AdminUploadStatusHandler)
+	adminapi.PATCH("/questions/:id/media/uploads/:uid", ah.AdminUploadChunkHandler, ah.uploadLimit())
+	adminapi.GET("/hints", ah.AdminAPIListHints)
+	adminapi.POST("/hints", ah.AdminAPICreateHint)
+	adminapi.PUT("/hints/:id", ah.AdminAPIUpdateHint)
+	adminapi.DELETE("/hints/:id", ah.AdminAPIDeleteHint)
+	adminapi.GET("/teams", ah.AdminAPIListTeams)
+	adminapi.POST("/teams", ah.AdminAPICreateTeam)
+	adminapi.DELETE("/teams/:id", ah.AdminAPIDeleteTeam)
+	adminapi.PUT("/teams/:id/start", ah.AdminAPISetTeamStart)
+	adminapi.GET("/backups", ah.AdminAPIListBackups)
+	adminapi.POST("/backups", ah.AdminAPICreateBackup)
+	adminapi.GET("/settings", ah.AdminAPIListSettings)
+	adminapi.PUT("/settings/:key", ah.AdminAPIUpdateSetting)
+	adminapi.GET("/hunt", ah.AdminAPIGetHuntWindow)
+	adminapi.PUT("/hunt", ah.AdminAPISetHuntWindow)
+	adminapi.DELETE("/hunt", ah.AdminAPIResetHuntWindow)
+	adminapi.GET("/registration", ah.AdminAPIGetRegistration)
+	adminapi.PUT("/registration", ah.AdminAPISetRegistration)
+	adminapi.GET("/streak-bonus", ah.AdminAPIGetStreakBonus)
+	adminapi.PUT("/streak-bonus", ah.AdminAPISetStreakBonus)
+	adminapi.GET("/category-weights", ah.AdminAPIGetCategoryWeights)
+	adminapi.PUT("/category-weights", ah.AdminAPISetCategoryWeights)
+	adminapi.GET("/powerups", ah.AdminAPIListPowerUps)
+	adminapi.PUT("/powerups/:kind", ah.AdminAPIUpdatePowerUp)
+	adminapi.GET("/skip-tokens", ah.AdminAPIGetSkipTokens)
+	adminapi.PUT("/skip-tokens", ah.AdminAPISetSkipTokens)
+	adminapi.GET("/feedback", ah.AdminAPIFeedbackReport)
+	adminapi.GET("/emails", ah.AdminAPIListEmails)
+	adminapi.POST("/emails/test", ah.AdminAPISendTestEmail)
+	adminapi.GET("/sms", ah.AdminAPIListSMS)
+	adminapi.POST("/sms/test", ah.AdminAPISendTestSMS)
+	adminapi.GET("/clarifications", ah.AdminAPIListClarifications)
+	adminapi.PUT("/clarifications/:id", ah.AdminAPIAnswerClarification)
+	adminapi.GET("/spectators", ah.AdminAPIListSpectators)
+	adminapi.POST("/spectators", ah.AdminAPICreateSpectator)
+	adminapi.DELETE("/spectators/:id", ah.AdminAPIDeleteSpectator)
+	adminapi.GET("/results", ah.AdminAPIFinalResults)
+	adminapi.GET("/hunts", ah.AdminAPIListHunts)
+	adminapi.POST("/hunts", ah.AdminAPICreateHunt)
+	adminapi.DELETE("/hunts/:id", ah.AdminAPIDeleteHunt)
+	adminapi.GET("/hunts/:id/export", ah.AdminAPIExportHunt, ah.uploadLimit())
+	adminapi.POST("/hunts/import", ah.AdminAPIImportHunt, ah.uploadLimit())
+	adminapi.POST("/hunts/:id/clone", ah.AdminAPICloneHunt)
+	adminapi.GET("/writeups", ah.AdminAPIListWriteups)
+	adminapi.PUT("/writeups/:id", ah.AdminAPIModerateWriteup)
+	adminapi.DELETE("/writeups/:id", ah.AdminAPIDeleteWriteup)
+	adminapi.GET("/photos", ah.AdminAPIListPhotos)
+	adminapi.PUT("/photos/:id", ah.AdminAPIGradePhoto)
+	adminapi.GET("/alerts", ah.AdminAPIListAlerts)
+	adminapi.GET("/events", ah.SSEHandler) // global events and new alerts
+	adminapi.GET("/submissions", ah.AdminAPIListSubmissions)
+	adminapi.POST("/alerts/:id/resolve", ah.AdminAPIResolveAlert)
+	adminapi.GET("/duplicates", ah.AdminAPIListDuplicates)
+	adminapi.POST("/teams/:id/suspend", ah.AdminAPISuspendTeam)
+	adminapi.DELETE("/teams/:id/suspend", ah.AdminAPIUnsuspendTeam)
+	adminapi.POST("/teams/:id/merge", ah.AdminAPIMergeTeam)
+	adminapi.GET("/reviews", ah.AdminAPIListReviews)
+	adminapi.PUT("/reviews/:id", ah.AdminAPISettleReview)
+	adminapi.POST("/teams/:id/flag", ah.AdminAPIFlagTeam)
+	adminapi.DELETE("/teams/:id/flag", ah.AdminAPIClearTeam)
+	adminapi.POST("/teams/:id/ban", ah.AdminAPIBanTeam)
+	adminapi.DELETE("/teams/:id/avatar", ah.AdminAPIDeleteAvatar)
+	adminapi.PUT("/teams/:id/credit", ah.AdminAPICredit)
+	adminapi.GET("/teams/:id/export", ah.AdminAPIExportTeam)
+	adminapi.GET("/retention", ah.AdminAPIGetRetention)
+	adminapi.PUT("/retention", ah.AdminAPISetRetention)
+	adminapi.POST("/retention/purge", ah.AdminAPIPurge)
+
+	// Runtime profiles for diagnosing leaks during an event
+	registerPprof(adminapi)
+
+	// GraphQL for dashboards that want several resources in one request
+	e.GET("/api/graphql", ah.GraphQLHandler, ah.apiAuthMiddleware, ModerateRateLimitMiddleware())
+	e.POST("/api/graphql", ah.GraphQLHandler, ah.apiAuthMiddleware, ModerateRateLimitMiddleware())
 	
 	// Public SSE endpoint for testing (no auth required)
 	e.GET("/api/events-test", ah.SSEHandler)
 	
+	// Public hunt stats for event websites (no auth required)
+	e.GET("/api/stats", ah.PublicStatsHandler, ah.publicStatsRateLimit())
+
+	// API documentation (no auth required)
+	e.GET("/api/openapi.yaml", ah.OpenAPISpecHandler)
+	e.GET("/api/docs", ah.SwaggerUIHandler)
+	
 	// Health check endpoints (no auth required for monitoring)
+	// /healthz is the liveness probe and /readyz the readiness probe
+	e.GET("/healthz", ah.LivenessHandler)
+	e.GET("/readyz", ah.ReadinessHandler)
 	e.GET("/api/health", ah.HealthCheckHandler)
 	e.GET("/api/metrics", ah.MetricsHandler, ah.adminMiddleware) // Protected endpoint
 
+	// Prometheus scrape target; scrapers authenticate with an admin API token
+	e.GET("/metrics", PrometheusHandler(), ah.adminAPIMiddleware)
+
 	admingroup := e.Group("/su", ah.adminMiddleware)
 	admingroup.GET("", ah.AdminPageHandler)
 	admingroup.GET("/deleteteam/:id", ah.AdminDeleteTeam)
 	admingroup.GET("/deletequestion/:id", ah.AdminDeleteQuestion)
 	admingroup.GET("/question", ah.AdminQuestionHandler)
-	admingroup.POST("/question", ah.AdminQuestionHandler)
+	admingroup.POST("/question", ah.AdminQuestionHandler, ah.uploadLimit())
 
 	admingroup.GET("/hints", ah.AdminHintsHandler)
 	admingroup.GET("/hints/new", ah.AdminHintNewHandler)
@@ -53,15 +281,97 @@ func SetupRoutes(e *echo.Echo, ah *AuthHandler) {
 
 	admingroup.GET("/hints/delete/:id", ah.AdminDeleteHint)
 	admingroup.GET("/editquestion/:id", ah.AdminEditQuestionHandler)
-	admingroup.POST("/editquestion/:id", ah.AdminEditQuestionHandler)
+	admingroup.POST("/editquestion/:id", ah.AdminEditQuestionHandler, ah.uploadLimit())
+	admingroup.POST("/editquestion/:id/presign", ah.AdminPresignMediaHandler)
+	admingroup.POST("/editquestion/:id/confirm", ah.AdminConfirmMediaHandler)
+	admingroup.POST("/editquestion/:id/uploads", ah.AdminCreateUploadHandler)
+	admingroup.GET("/editquestion/:id/uploads/:uid", ah.AdminUploadStatusHandler)
+	admingroup.PATCH("/editquestion/:id/uploads/:uid", ah.AdminUploadChunkHandler, ah.uploadLimit())
 
 	admingroup.GET("/editquestion/delimage/:name", ah.AdminDeleteImage)
 	admingroup.GET("/editquestion/delvideo/:name", ah.AdminDeleteVideo)
 	admingroup.GET("/editquestion/delaudio/:name", ah.AdminDeleteAudio)
+	admingroup.GET("/editquestion/delfile/:name", ah.AdminDeleteFile)
 
 	admingroup.GET("/solved-questions", ah.AdminSolvedQuestionsHandler)
 	admingroup.GET("/unlock-question/:qid/:tid", ah.AdminUnlockQuestionHandler)
 	admingroup.GET("/unlock-question-all/:qid", ah.AdminUnlockAllQuestionHandler)
+	admingroup.POST("/credit", ah.AdminCreditHandler)
+
+	admingroup.GET("/announcements", ah.AdminAnnouncementsHandler)
+	admingroup.POST("/announcements", ah.AdminAnnouncementsHandler)
+	admingroup.POST("/announcements/:id", ah.AdminUpdateAnnouncement)
+
+	admingroup.GET("/chat", ah.AdminChatHandler)
+	admingroup.GET("/chat/delete/:id", ah.AdminDeleteChatMessage)
+	admingroup.GET("/chat/mute/:id", ah.AdminMuteTeam)
+	admingroup.GET("/chat/unmute/:id", ah.AdminUnmuteTeam)
+	admingroup.GET("/webhooks", ah.AdminWebhooksHandler)
+	admingroup.POST("/webhooks", ah.AdminWebhooksHandler)
+	admingroup.GET("/webhooks/delete/:id", ah.AdminDeleteWebhook)
+	admingroup.GET("/emails", ah.AdminEmailTemplatesHandler)
+	admingroup.POST("/emails", ah.AdminEmailTemplatesHandler)
+	admingroup.GET("/pages", ah.AdminPagesHandler)
+	admingroup.POST("/pages", ah.AdminPagesHandler)
+	admingroup.GET("/pages/delete/:id", ah.AdminDeletePage)
+	admingroup.GET("/rules", ah.AdminRulesHandler)
+	admingroup.GET("/branding", ah.AdminBrandingHandler)
+	admingroup.POST("/branding", ah.AdminBrandingHandler)
+	admingroup.POST("/branding/logo", ah.AdminLogoHandler)
+	admingroup.GET("/branding/logo/delete", ah.AdminDeleteLogoHandler)
+	admingroup.GET("/checkpoints", ah.AdminCheckpointsHandler)
+	admingroup.POST("/checkpoints", ah.AdminCheckpointsHandler)
+	admingroup.GET("/checkpoints/:id/qr.png", ah.AdminCheckpointQRHandler)
+	admingroup.GET("/checkpoints/:id/print", ah.AdminCheckpointPrintHandler)
+	admingroup.GET("/checkpoints/:id/rotate", ah.AdminRotateCheckpointHandler)
+	admingroup.GET("/api-tokens", ah.AdminAPITokensHandler)
+	admingroup.POST("/api-tokens", ah.AdminAPITokensHandler)
+	admingroup.GET("/api-tokens/delete/:id", ah.AdminDeleteAPIToken)
+	admingroup.GET("/feedback", ah.AdminFeedbackHandler)
+	admingroup.GET("/clarifications", ah.AdminClarificationsHandler)
+	admingroup.POST("/clarifications/:id", ah.AdminAnswerClarification)
+	admingroup.GET("/spectators", ah.AdminSpectatorsHandler)
+	admingroup.POST("/spectators", ah.AdminSpectatorsHandler)
+	admingroup.GET("/spectators/delete/:id", ah.AdminDeleteSpectator)
+	admingroup.GET("/settings", ah.AdminSettingsHandler)
+	admingroup.POST("/settings", ah.AdminSettingsHandler)
+	admingroup.POST("/settings/hunt", ah.AdminHuntWindowHandler)
+	admingroup.POST("/settings/team-start/:id", ah.AdminTeamStartHandler)
+	admingroup.POST("/settings/registration", ah.AdminRegistrationHandler)
+	admingroup.POST("/settings/streak", ah.AdminStreakBonusHandler)
+	admingroup.POST("/settings/weights", ah.AdminCategoryWeightsHandler)
+	admingroup.POST("/settings/powerups/:kind", ah.AdminPowerUpHandler)
+	admingroup.POST("/settings/skips", ah.AdminSkipTokensHandler)
+	admingroup.GET("/hunts", ah.AdminHuntsHandler)
+	admingroup.POST("/hunts", ah.AdminHuntsHandler)
+	admingroup.GET("/hunts/switch/:id", ah.AdminSwitchHuntHandler)
+	admingroup.GET("/hunts/delete/:id", ah.AdminDeleteHuntHandler)
+	admingroup.GET("/hunts/export/:id", ah.AdminExportHuntHandler, ah.uploadLimit())
+	admingroup.POST("/hunts/import", ah.AdminImportHuntHandler, ah.uploadLimit())
+	admingroup.GET("/writeups", ah.AdminWriteupsHandler)
+	admingroup.GET("/writeups/approve/:id", ah.AdminApproveWriteup)
+	admingroup.GET("/writeups/reject/:id", ah.AdminRejectWriteup)
+	admingroup.GET("/writeups/delete/:id", ah.AdminDeleteWriteup)
+	admingroup.GET("/photos", ah.AdminPhotosHandler)
+	admingroup.POST("/photos/:id/grade", ah.AdminGradePhoto)
+	admingroup.GET("/alerts", ah.AdminAlertsHandler)
+	admingroup.GET("/submissions", ah.AdminSubmissionsHandler)
+	admingroup.GET("/alerts/resolve/:id", ah.AdminResolveAlert)
+	admingroup.GET("/duplicates", ah.AdminDuplicatesHandler)
+	admingroup.GET("/duplicates/suspend/:id", ah.AdminSuspendTeam)
+	admingroup.GET("/duplicates/unsuspend/:id", ah.AdminUnsuspendTeam)
+	admingroup.GET("/duplicates/merge/:id/:into", ah.AdminMergeTeam)
+	admingroup.GET("/reviews", ah.AdminReviewsHandler)
+	admingroup.GET("/reviews/approve/:id", ah.AdminApproveSolve)
+	admingroup.GET("/reviews/reject/:id", ah.AdminRejectSolve)
+	admingroup.GET("/teams/flag/:id", ah.AdminFlagTeam)
+	admingroup.GET("/teams/clear/:id", ah.AdminClearTeam)
+	admingroup.GET("/teams/ban/:id", ah.AdminBanTeam)
+	admingroup.GET("/teams/avatar/delete/:id", ah.AdminDeleteAvatar)
+	admingroup.GET("/teams/export/:id", ah.AdminExportTeamHandler)
+	admingroup.GET("/retention", ah.AdminRetentionHandler)
+	admingroup.POST("/retention", ah.AdminRetentionHandler)
+	registerPprof(admingroup)
 
 	e.GET("/*", RouteNotFoundHandler)
 }
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// RulesHandler shows the rules, and to a signed in team whether it
+// accepted them, with the form to accept them when it hasn't
+func (ah *AuthHandler) RulesHandler(c echo.Context) error {
+	return ah.renderRules(c, nil)
+}
+
+// renderRules shows the rules page with the errors of accepting them
+func (ah *AuthHandler) renderRules(c echo.Context, errs map[string]string) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	ctx := c.Request().Context()
+
+	isAdmin := isAdminSession(c)
+	rules, err := ah.UserServices.RenderPage(ctx, services.RulesPageSlug, isAdmin)
+	if errors.Is(err, services.ErrPageNotFound) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching the rules: %s", err))
+	}
+
+	username := ""
+	var team bool
+	var acceptance *services.RulesAcceptance
+	sess, _ := session.Get(auth_sessions_key, c)
+	if name, ok := sess.Values[user_name_key].(string); ok && fromProtected {
+		username = name
+	}
+	if teamID, ok := sess.Values[user_id_key].(int); ok && fromProtected && !isAdmin {
+		team = true
+		acceptance, err = ah.UserServices.GetRulesAcceptance(ctx, teamID)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching your acceptance: %s", err))
+		}
+	}
+
+	view := pages.Rules(rules, team, acceptance, ah.UserServices.FlagEnabled(ctx, services.FlagRulesAcceptance), errs)
+	c.Set("ISERROR", false)
+	return renderView(c, pages.PageIndex(
+		rules.Page.Title,
+		username,
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AcceptRulesHandler records that the team accepted the rules, then sends
+// it on to the hunt
+func (ah *AuthHandler) AcceptRulesHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	if c.FormValue("accept") != "on" {
+		return ah.renderRules(c, map[string]string{"accept": "Tick the box to accept the rules"})
+	}
+
+	err := ah.UserServices.AcceptRules(c.Request().Context(), c.Get(user_id_key).(int), c.RealIP())
+	if errors.Is(err, services.ErrNoRules) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error recording your acceptance")
+	}
+	return c.Redirect(http.StatusSeeOther, "/hunt")
+}
+
+// AdminRulesHandler shows which teams of the hunt being managed accepted
+// the rules, when, which version and from where
+func (ah *AuthHandler) AdminRulesHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	ctx := c.Request().Context()
+
+	var rules *services.Page
+	page, err := ah.UserServices.RenderPage(ctx, services.RulesPageSlug, true)
+	if err == nil {
+		rules = &page.Page
+	} else if !errors.Is(err, services.ErrPageNotFound) {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching the rules: %s", err))
+	}
+
+	list, err := ah.UserServices.GetRulesAcceptances(ctx, ah.adminHunt(c))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching acceptances: %s", err))
+	}
+
+	view := panel.Rules(fromProtected, rules, ah.UserServices.FlagEnabled(ctx, services.FlagRulesAcceptance), list)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.RulesIndex(
+		"Rules",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/bytes"
+)
+
+// ServerConfig bounds how long clients may take and how much they may send
+type ServerConfig struct {
+	// ReadHeaderTimeout is how long a client has to send its headers,
+	// default 10s. This is what stops slowloris clients
+	ReadHeaderTimeout time.Duration
+
+	// ReadTimeout is how long a client has to send its whole request,
+	// default 30s; routes with their own body limit are exempt
+	ReadTimeout time.Duration
+
+	// WriteTimeout is how long a response may take, default 60s; event
+	// streams, WebSockets and routes with their own body limit are exempt
+	WriteTimeout time.Duration
+
+	// IdleTimeout is how long a keep-alive connection waits for its next
+	// request, default 120s
+	IdleTimeout time.Duration
+
+	// BodyLimit caps request bodies, default "2M"
+	BodyLimit string
+
+	// UploadBodyLimit caps request bodies on admin upload routes, default "1G"
+	UploadBodyLimit string
+}
+
+// streamRoutes hold their connection open for as long as the client listens
+var streamRoutes = map[string]bool{
+	"/api/events":       true,
+	"/api/events-test":  true,
+	"/api/ws":           true,
+	"/api/countdown":    true,
+	"/spectate/events":  true,
+	"/api/admin/events": true,
+}
+
+// formOverhead is room for the fields and multipart framing around the
+// files of an upload form
+const formOverhead int64 = 1 << 20
+
+// requestBodyKey holds the request's *requestBody in the echo context
+const requestBodyKey = "request_body"
+
+func (cfg ServerConfig) withDefaults() ServerConfig {
+	if cfg.ReadHeaderTimeout <= 0 {
+		cfg.ReadHeaderTimeout = 10 * time.Second
+	}
+	if cfg.ReadTimeout <= 0 {
+		cfg.ReadTimeout = 30 * time.Second
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 60 * time.Second
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 120 * time.Second
+	}
+	if cfg.BodyLimit == "" {
+		cfg.BodyLimit = "2M"
+	}
+	if cfg.UploadBodyLimit == "" {
+		cfg.UploadBodyLimit = "1G"
+	}
+	return cfg
+}
+
+// NewServer creates the HTTP server with the configured timeouts
+func NewServer(addr string, cfg ServerConfig) *http.Server {
+	cfg = cfg.withDefaults()
+	return &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// parseBodyLimit reads a size such as "2M", panicking on a bad one like
+// echo's own body limit does
+func parseBodyLimit(limit string) int64 {
+	n, err := bytes.Parse(limit)
+	if err != nil {
+		panic(fmt.Errorf("invalid body limit %q: %w", limit, err))
+	}
+	return n
+}
+
+// requestBody caps how much of a request body handlers may read. It starts
+// at the server's default, which a route's BodyLimitMiddleware replaces
+// before anything is read
+type requestBody struct {
+	io.ReadCloser
+	size  int64 // Content-Length, -1 when unknown
+	limit int64
+	read  int64
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	if b.size > b.limit {
+		return 0, echo.ErrStatusRequestEntityTooLarge
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return n, echo.ErrStatusRequestEntityTooLarge
+	}
+	return n, err
+}
+
+// ServerLimitsMiddleware applies the default body limit and lifts the
+// write deadline on event streams. Routes that take more declare it with
+// BodyLimitMiddleware where they are registered
+func ServerLimitsMiddleware(cfg ServerConfig) echo.MiddlewareFunc {
+	cfg = cfg.withDefaults()
+	limit := parseBodyLimit(cfg.BodyLimit)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			body := &requestBody{ReadCloser: req.Body, size: req.ContentLength, limit: limit}
+			req.Body = body
+			c.Set(requestBodyKey, body)
+
+			if streamRoutes[c.Path()] {
+				rc := http.NewResponseController(c.Response())
+				if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+					log.Printf("Error lifting write deadline on %s: %v", c.Path(), err)
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// BodyLimitMiddleware lets a route take bodies of up to limit bytes in
+// place of the default. Large bodies take long to send and their routes
+// often send large responses, so the server's deadlines are lifted too
+func BodyLimitMiddleware(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().ContentLength > limit {
+				return echo.ErrStatusRequestEntityTooLarge
+			}
+			if body, ok := c.Get(requestBodyKey).(*requestBody); ok {
+				body.limit = limit
+			}
+
+			rc := http.NewResponseController(c.Response())
+			if err := rc.SetReadDeadline(time.Time{}); err != nil {
+				log.Printf("Error lifting read deadline on %s: %v", c.Path(), err)
+			}
+			if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+				log.Printf("Error lifting write deadline on %s: %v", c.Path(), err)
+			}
+			return next(c)
+		}
+	}
+}
+
+// uploadLimit is for the admin routes that take question media and hunt
+// archives, or send archives back
+func (ah *AuthHandler) uploadLimit() echo.MiddlewareFunc {
+	return BodyLimitMiddleware(parseBodyLimit(ah.Server.withDefaults().UploadBodyLimit))
+}
+
+// slotLimit is for the routes that take a form with up to files files
+// from an upload slot, sized by that slot's limit
+func (ah *AuthHandler) slotLimit(slot string, files int) echo.MiddlewareFunc {
+	return BodyLimitMiddleware(int64(files)*ah.UserServices.MaxUploadSize(slot) + formOverhead)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+// newLimitsServer serves routes that read their whole body behind the
+// server limits, with a default of 1KB
+func newLimitsServer(routes func(e *echo.Echo, read echo.HandlerFunc)) *echo.Echo {
+	e := echo.New()
+	e.Use(ServerLimitsMiddleware(ServerConfig{BodyLimit: "1K"}))
+	routes(e, func(c echo.Context) error {
+		if _, err := io.ReadAll(c.Request().Body); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	return e
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	e := newLimitsServer(func(e *echo.Echo, read echo.HandlerFunc) {
+		e.POST("/default", read)
+		e.POST("/upload", read, BodyLimitMiddleware(4<<10))
+	})
+
+	cases := []struct {
+		path string
+		size int
+		want int
+	}{
+		{"/default", 512, http.StatusOK},
+		{"/default", 2 << 10, http.StatusRequestEntityTooLarge},
+		{"/upload", 2 << 10, http.StatusOK},
+		{"/upload", 8 << 10, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range cases {
+		for _, chunked := range []bool{false, true} {
+			// A reader that isn't a strings.Reader leaves the length unknown,
+			// as with a chunked body
+			var body io.Reader = strings.NewReader(strings.Repeat("x", tc.size))
+			if chunked {
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, tc.path, body)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Errorf("%s with %d bytes (chunked %v): got %d, want %d", tc.path, tc.size, chunked, rec.Code, tc.want)
+			}
+		}
+	}
+}
+
+// uploadLimits is an AuthService that only knows the upload slot limits
+type uploadLimits struct {
+	AuthService
+}
+
+func (uploadLimits) MaxUploadSize(slot string) int64 {
+	return services.DefaultMaxImageSize
+}
+
+// A photo over the 2M default fits the image slot's limit on the photo
+// routes
+func TestPhotoOverDefaultBodyLimit(t *testing.T) {
+	ah := &AuthHandler{UserServices: uploadLimits{}}
+	e := echo.New()
+	e.Use(ServerLimitsMiddleware(ServerConfig{}))
+	e.POST("/photo", func(c echo.Context) error {
+		file, err := c.FormFile("files")
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, strconv.FormatInt(file.Size, 10))
+	}, ah.slotLimit("images", 1))
+
+	for _, tc := range []struct {
+		size int
+		want int
+	}{
+		{3 << 20, http.StatusOK},
+		{int(services.DefaultMaxImageSize + formOverhead), http.StatusRequestEntityTooLarge},
+	} {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("files", "photo.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(make([]byte, tc.size))
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/photo", &body)
+		req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != tc.want {
+			t.Fatalf("%d byte photo: got %d, want %d", tc.size, rec.Code, tc.want)
+		}
+		if tc.want == http.StatusOK && rec.Body.String() != strconv.Itoa(tc.size) {
+			t.Fatalf("%d byte photo arrived as %s bytes", tc.size, rec.Body.String())
+		}
+	}
+}
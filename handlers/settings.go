@@ -0,0 +1,531 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// AdminSettingsHandler shows the settings page and flips a feature flag on
+// POST
+func (ah *AuthHandler) AdminSettingsHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	if c.Request().Method == "POST" {
+		enabled, err := strconv.ParseBool(c.FormValue("enabled"))
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Invalid flag value")
+		}
+		err = ah.UserServices.SetFeatureFlag(c.Request().Context(), c.FormValue("key"), enabled)
+		if errors.Is(err, services.ErrUnknownFlag) {
+			return c.String(http.StatusBadRequest, "Unknown feature flag")
+		}
+		if err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving setting: %s", err))
+		}
+
+		return c.Redirect(http.StatusSeeOther, "/su/settings")
+	}
+
+	return ah.renderSettings(c, fromProtected, map[string]string{})
+}
+
+// AdminHuntWindowHandler sets when the hunt the panel is switched to runs,
+// or puts it back on the configured times
+func (ah *AuthHandler) AdminHuntWindowHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	if c.FormValue("reset") != "" {
+		if err := ah.UserServices.ResetHuntWindow(c.Request().Context(), ah.adminHunt(c)); err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving setting: %s", err))
+		}
+		return c.Redirect(http.StatusSeeOther, "/su/settings")
+	}
+
+	errs := make(map[string]string)
+	var window services.HuntWindow
+	for _, side := range []struct {
+		field string
+		t     *time.Time
+	}{{"start", &window.Start}, {"end", &window.End}} {
+		value := strings.TrimSpace(c.FormValue(side.field))
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errs["hunt"] = fmt.Sprintf("Invalid %s time %q", side.field, value)
+			continue
+		}
+		*side.t = t
+	}
+	if value := strings.TrimSpace(c.FormValue("team_minutes")); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes < 0 {
+			errs["hunt"] = fmt.Sprintf("Invalid minutes per team %q", value)
+		} else {
+			window.TeamDuration = time.Duration(minutes) * time.Minute
+		}
+	}
+
+	if len(errs) == 0 {
+		err := ah.UserServices.SetHuntWindow(c.Request().Context(), ah.adminHunt(c), window)
+		if errors.Is(err, services.ErrInvalidHuntWindow) {
+			errs["hunt"] = "The hunt must end after it starts"
+		} else if err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving setting: %s", err))
+		} else {
+			return c.Redirect(http.StatusSeeOther, "/su/settings")
+		}
+	}
+
+	return ah.renderSettings(c, fromProtected, errs)
+}
+
+// AdminTeamStartHandler assigns when a team's own clock starts, or clears
+// it so the clock starts at the team's next visit
+func (ah *AuthHandler) AdminTeamStartHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid team ID")
+	}
+
+	var at time.Time
+	if value := strings.TrimSpace(c.FormValue("start")); value != "" && c.FormValue("clear") == "" {
+		if at, err = time.Parse(time.RFC3339, value); err != nil {
+			return c.String(http.StatusBadRequest, fmt.Sprintf("Invalid start time %q", value))
+		}
+	}
+	err = ah.UserServices.SetTeamStart(c.Request().Context(), id, at)
+	if errors.Is(err, services.ErrTeamNotFound) {
+		return c.String(http.StatusNotFound, "Team not found")
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving setting: %s", err))
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/settings")
+}
+
+// renderSettings shows the settings page
+func (ah *AuthHandler) renderSettings(c echo.Context, fromProtected bool, errs map[string]string) error {
+	flags, err := ah.UserServices.GetFeatureFlags(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching settings: %s", err))
+	}
+
+	window := ah.UserServices.GetHuntWindow(c.Request().Context(), ah.adminHunt(c))
+	var teams []services.User
+	if window.TeamDuration > 0 {
+		teams, err = ah.UserServices.GetAllUsers(c.Request().Context(), ah.adminHunt(c))
+		if err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching teams: %s", err))
+		}
+	}
+
+	limit := ah.UserServices.GetRegistrationLimit(c.Request().Context())
+	policy := ah.UserServices.GetEmailPolicy(c.Request().Context())
+	bonus := ah.UserServices.GetStreakBonus(c.Request().Context())
+	powerUps, err := ah.UserServices.GetPowerUps(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching power-ups: %s", err))
+	}
+	questions, err := ah.UserServices.GetAllQuestions(c.Request().Context(), ah.adminHunt(c))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching questions: %s", err))
+	}
+	weights := ah.UserServices.GetCategoryWeights(c.Request().Context())
+	view := panel.Settings(fromProtected, errs, flags, window, teams, limit, policy, bonus, powerUps, ah.UserServices.GetSkipTokens(c.Request().Context()), weights, services.Categories(questions))
+	c.Set("ISERROR", false)
+	return renderView(c, panel.SettingsIndex(
+		"Settings",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminAPIListSettings returns every feature flag and whether it is on
+func (ah *AuthHandler) AdminAPIListSettings(c echo.Context) error {
+	flags, err := ah.UserServices.GetFeatureFlags(c.Request().Context())
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, flags)
+}
+
+// AdminAPIUpdateSetting turns a feature flag on or off and returns every
+// flag
+func (ah *AuthHandler) AdminAPIUpdateSetting(c echo.Context) error {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := c.Bind(&req); err != nil || req.Enabled == nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "enabled must be true or false"))
+	}
+
+	key := c.Param("key")
+	err := ah.UserServices.SetFeatureFlag(c.Request().Context(), key, *req.Enabled)
+	if errors.Is(err, services.ErrUnknownFlag) {
+		return apiError(c, newPlayError(http.StatusNotFound, "Unknown feature flag"))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return ah.AdminAPIListSettings(c)
+}
+
+// adminAPIHuntWindow is when the hunt runs; null leaves a side open
+type adminAPIHuntWindow struct {
+	Start   *time.Time `json:"start"`
+	End     *time.Time `json:"end"`
+	Started bool       `json:"started"`
+	Ended   bool       `json:"ended"`
+
+	// TeamMinutes gives every team its own clock of that many minutes;
+	// zero runs everyone on the window
+	TeamMinutes int `json:"team_minutes"`
+}
+
+// AdminAPIGetHuntWindow returns when ?hunt_id=, the first hunt by
+// default, runs
+func (ah *AuthHandler) AdminAPIGetHuntWindow(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	window := ah.UserServices.GetHuntWindow(c.Request().Context(), huntID)
+	res := adminAPIHuntWindow{
+		Started:     window.Started(time.Now()),
+		Ended:       window.Ended(time.Now()),
+		TeamMinutes: int(window.TeamDuration / time.Minute),
+	}
+	if !window.Start.IsZero() {
+		res.Start = &window.Start
+	}
+	if !window.End.IsZero() {
+		res.End = &window.End
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// AdminAPISetHuntWindow sets when ?hunt_id= runs, in place of the
+// configured times
+func (ah *AuthHandler) AdminAPISetHuntWindow(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	var req adminAPIHuntWindow
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	var window services.HuntWindow
+	if req.Start != nil {
+		window.Start = *req.Start
+	}
+	if req.End != nil {
+		window.End = *req.End
+	}
+	window.TeamDuration = time.Duration(req.TeamMinutes) * time.Minute
+	err = ah.UserServices.SetHuntWindow(c.Request().Context(), huntID, window)
+	if errors.Is(err, services.ErrInvalidHuntWindow) {
+		return apiError(c, newPlayError(http.StatusBadRequest, "The hunt must end after it starts"))
+	}
+	if errors.Is(err, services.ErrInvalidTeamDuration) {
+		return apiError(c, newPlayError(http.StatusBadRequest, "team_minutes can't be negative"))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return ah.AdminAPIGetHuntWindow(c)
+}
+
+// AdminAPIResetHuntWindow puts ?hunt_id= back on the configured hunt times
+func (ah *AuthHandler) AdminAPIResetHuntWindow(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if err := ah.UserServices.ResetHuntWindow(c.Request().Context(), huntID); err != nil {
+		return apiError(c, err)
+	}
+	return ah.AdminAPIGetHuntWindow(c)
+}
+
+// AdminAPIFinalResults returns the standings of ?hunt_id=, the first hunt
+// by default, saved when the hunt ended
+func (ah *AuthHandler) AdminAPIFinalResults(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	results, err := ah.UserServices.GetFinalResults(c.Request().Context(), huntID)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if results == nil {
+		results = []services.HuntResult{}
+	}
+	return c.JSON(http.StatusOK, results)
+}
+
+// AdminRegistrationHandler sets how many teams may register in each hunt,
+// what turned away teams are told, which email domains may register and
+// the addresses let in regardless
+func (ah *AuthHandler) AdminRegistrationHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	errs := make(map[string]string)
+	limit := services.RegistrationLimit{Message: c.FormValue("message")}
+	if value := strings.TrimSpace(c.FormValue("cap")); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			errs["registration"] = fmt.Sprintf("Invalid team cap %q", value)
+			return ah.renderSettings(c, fromProtected, errs)
+		}
+		limit.Cap = n
+	}
+
+	_, err := ah.UserServices.SetEmailPolicy(c.Request().Context(), services.EmailPolicy{
+		Domains:    services.ParseEmailList(c.FormValue("domains")),
+		Exceptions: services.ParseEmailList(c.FormValue("exceptions")),
+	})
+	switch {
+	case errors.Is(err, services.ErrInvalidEmailDomain):
+		errs["registration"] = "Domains look like college.edu"
+		return ah.renderSettings(c, fromProtected, errs)
+	case errors.Is(err, services.ErrInvalidEmailException):
+		errs["registration"] = "Exceptions must be full email addresses"
+		return ah.renderSettings(c, fromProtected, errs)
+	case err != nil:
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving setting: %s", err))
+	}
+	if err := ah.UserServices.SetRegistrationLimit(c.Request().Context(), limit); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving setting: %s", err))
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/settings")
+}
+
+// adminAPIRegistration is who may register: the team cap of each hunt with
+// the message turned away teams see, and the email domains let in
+type adminAPIRegistration struct {
+	services.RegistrationLimit
+	services.EmailPolicy
+}
+
+// AdminAPIGetRegistration returns who may register
+func (ah *AuthHandler) AdminAPIGetRegistration(c echo.Context) error {
+	return c.JSON(http.StatusOK, adminAPIRegistration{
+		RegistrationLimit: ah.UserServices.GetRegistrationLimit(c.Request().Context()),
+		EmailPolicy:       ah.UserServices.GetEmailPolicy(c.Request().Context()),
+	})
+}
+
+// AdminAPISetRegistration sets who may register; no cap and no domains let
+// anyone in
+func (ah *AuthHandler) AdminAPISetRegistration(c echo.Context) error {
+	var req adminAPIRegistration
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	// The cap is checked first, so a bad request changes nothing
+	if req.Cap < 0 {
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", services.ErrInvalidTeamCap))
+	}
+	policy, err := ah.UserServices.SetEmailPolicy(c.Request().Context(), req.EmailPolicy)
+	if errors.Is(err, services.ErrInvalidEmailDomain) || errors.Is(err, services.ErrInvalidEmailException) {
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", err))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+	if err := ah.UserServices.SetRegistrationLimit(c.Request().Context(), req.RegistrationLimit); err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, adminAPIRegistration{
+		RegistrationLimit: ah.UserServices.GetRegistrationLimit(c.Request().Context()),
+		EmailPolicy:       policy,
+	})
+}
+
+// AdminStreakBonusHandler sets what teams earn for correct answers in a
+// row
+func (ah *AuthHandler) AdminStreakBonusHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	errs := make(map[string]string)
+	var bonus services.StreakBonus
+	for _, field := range []struct {
+		name, label string
+		n           *int
+	}{{"length", "streak length", &bonus.Length}, {"points", "bonus", &bonus.Points}} {
+		value := strings.TrimSpace(c.FormValue(field.name))
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			errs["streak"] = fmt.Sprintf("Invalid %s %q", field.label, value)
+			return ah.renderSettings(c, fromProtected, errs)
+		}
+		*field.n = n
+	}
+	if bonus.Length == 0 {
+		bonus.Length = services.DefaultStreakLength
+	}
+
+	err := ah.UserServices.SetStreakBonus(c.Request().Context(), bonus)
+	if errors.Is(err, services.ErrInvalidStreakBonus) {
+		errs["streak"] = "The streak length must be at least 1 and the bonus can't be negative"
+		return ah.renderSettings(c, fromProtected, errs)
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving setting: %s", err))
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/settings")
+}
+
+// AdminPowerUpHandler sets the price, per-team limit and availability of a
+// power-up in the store
+func (ah *AuthHandler) AdminPowerUpHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	errs := make(map[string]string)
+	p := services.PowerUp{Kind: c.Param("kind"), Enabled: c.FormValue("enabled") != ""}
+	for _, field := range []struct {
+		name, label string
+		n           *int
+	}{{"price", "price", &p.Price}, {"max_per_team", "limit", &p.MaxPerTeam}} {
+		value := strings.TrimSpace(c.FormValue(field.name))
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			errs["powerups"] = fmt.Sprintf("Invalid %s %q", field.label, value)
+			return ah.renderSettings(c, fromProtected, errs)
+		}
+		*field.n = n
+	}
+
+	err := ah.UserServices.SetPowerUp(c.Request().Context(), p)
+	switch {
+	case errors.Is(err, services.ErrUnknownPowerUp):
+		return c.String(http.StatusNotFound, "Power-up not found")
+	case errors.Is(err, services.ErrInvalidPowerUp):
+		errs["powerups"] = "Prices and limits can't be negative"
+		return ah.renderSettings(c, fromProtected, errs)
+	case err != nil:
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving setting: %s", err))
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/settings")
+}
+
+// AdminCategoryWeightsHandler sets what the questions of each category are
+// worth, one "category = weight" per line
+func (ah *AuthHandler) AdminCategoryWeightsHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	errs := make(map[string]string)
+	weights, err := services.ParseCategoryWeights(c.FormValue("weights"))
+	if err == nil {
+		err = ah.UserServices.SetCategoryWeights(c.Request().Context(), weights)
+	}
+	switch {
+	case errors.Is(err, services.ErrInvalidWeightLine):
+		errs["weights"] = "Write one category per line, such as crypto = 1.5"
+		return ah.renderSettings(c, fromProtected, errs)
+	case errors.Is(err, services.ErrInvalidCategoryWeight):
+		errs["weights"] = fmt.Sprintf("Weights must be more than 0 and at most %d", services.MaxCategoryWeight)
+		return ah.renderSettings(c, fromProtected, errs)
+	case errors.Is(err, services.ErrCategoryTooLong):
+		errs["weights"] = fmt.Sprintf("Categories are at most %d characters", services.MaxCategoryLength)
+		return ah.renderSettings(c, fromProtected, errs)
+	case err != nil:
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving setting: %s", err))
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/settings")
+}
+
+// AdminAPIGetCategoryWeights returns the weight of each question category
+func (ah *AuthHandler) AdminAPIGetCategoryWeights(c echo.Context) error {
+	return c.JSON(http.StatusOK, ah.UserServices.GetCategoryWeights(c.Request().Context()))
+}
+
+// AdminAPISetCategoryWeights replaces the weight of every question
+// category; categories left out count once
+func (ah *AuthHandler) AdminAPISetCategoryWeights(c echo.Context) error {
+	var req services.CategoryWeights
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	err := ah.UserServices.SetCategoryWeights(c.Request().Context(), req)
+	if errors.Is(err, services.ErrInvalidCategoryWeight) || errors.Is(err, services.ErrCategoryTooLong) || errors.Is(err, services.ErrEmptyCategory) {
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", err))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+	return ah.AdminAPIGetCategoryWeights(c)
+}
+
+// AdminAPIGetStreakBonus returns what teams earn for correct answers in a
+// row
+func (ah *AuthHandler) AdminAPIGetStreakBonus(c echo.Context) error {
+	return c.JSON(http.StatusOK, ah.UserServices.GetStreakBonus(c.Request().Context()))
+}
+
+// AdminAPISetStreakBonus sets what teams earn for correct answers in a
+// row; zero points turns bonuses off
+func (ah *AuthHandler) AdminAPISetStreakBonus(c echo.Context) error {
+	var req services.StreakBonus
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	err := ah.UserServices.SetStreakBonus(c.Request().Context(), req)
+	if errors.Is(err, services.ErrInvalidStreakBonus) {
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", err))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+	return ah.AdminAPIGetStreakBonus(c)
+}
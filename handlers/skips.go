@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+// errQuestionSkipped is returned for anything but reading a question the
+// team skipped
+var errQuestionSkipped = newPlayError(http.StatusForbidden, "You skipped this question")
+
+// skipQuestion spends one of the team's skip tokens on a question of its
+// hunt, returning the tokens left. Quotas and other teams' locks don't
+// stand in the way, as the skip earns nothing
+func (ah *AuthHandler) skipQuestion(ctx context.Context, teamID int, questionID int) (int, error) {
+	if err := ah.checkHuntOpen(ctx, teamID, true); err != nil {
+		return 0, err
+	}
+
+	question, err := ah.UserServices.GetQuestionById(ctx, questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, newPlayError(http.StatusNotFound, "Question not found")
+	}
+	if err != nil {
+		return 0, newPlayError(http.StatusInternalServerError, "Error fetching question")
+	}
+	if ok, err := ah.inTeamHunt(ctx, teamID, question.HuntID); err != nil {
+		return 0, newPlayError(http.StatusInternalServerError, "Error fetching question")
+	} else if !ok {
+		return 0, newPlayError(http.StatusNotFound, "Question not found")
+	}
+
+	left, err := ah.UserServices.SkipQuestion(ctx, teamID, questionID)
+	switch {
+	case errors.Is(err, services.ErrNoSkipTokens):
+		return 0, newPlayError(http.StatusForbidden, "%s", err)
+	case errors.Is(err, services.ErrAlreadySkipped):
+		return 0, newPlayError(http.StatusConflict, "Question already skipped")
+	case errors.Is(err, services.ErrAlreadySolved):
+		return 0, newPlayError(http.StatusForbidden, "Question already solved")
+	case err != nil:
+		return 0, newPlayError(http.StatusInternalServerError, "Error skipping question: %s", err)
+	}
+
+	// The team's lock went with the skip
+	if ah.UserServices.FlagEnabled(ctx, services.FlagExclusiveSolve) {
+		ah.Broadcaster.Broadcast(services.EventQuestionUnlocked, map[string]interface{}{
+			"question_id": questionID,
+			"reason":      "skipped",
+		})
+	}
+	return left, nil
+}
+
+// skipTokensLeft returns how many more questions the team may skip
+func (ah *AuthHandler) skipTokensLeft(ctx context.Context, teamID int) int {
+	left, err := ah.UserServices.SkipTokensLeft(ctx, teamID)
+	if err != nil {
+		return 0
+	}
+	return left
+}
+
+// SkipQuestionHandler skips a question from its page and goes back to the
+// hunt
+func (ah *AuthHandler) SkipQuestionHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid question ID")
+	}
+	_, err = ah.skipQuestion(c.Request().Context(), c.Get(user_id_key).(int), questionID)
+	if err == errHuntNotStarted {
+		return c.Redirect(http.StatusSeeOther, "/hunt")
+	}
+	if err != nil {
+		return playErrorString(c, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/hunt")
+}
+
+// APISkipQuestion skips a question and returns the skip tokens left
+func (ah *AuthHandler) APISkipQuestion(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid question ID"))
+	}
+	left, err := ah.skipQuestion(c.Request().Context(), c.Get(user_id_key).(int), questionID)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]int{"skip_tokens_left": left})
+}
+
+// AdminSkipTokensHandler sets how many questions each team may skip
+func (ah *AuthHandler) AdminSkipTokensHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	errs := make(map[string]string)
+	value := strings.TrimSpace(c.FormValue("tokens"))
+	n := 0
+	if value != "" {
+		var err error
+		if n, err = strconv.Atoi(value); err != nil {
+			errs["skips"] = fmt.Sprintf("Invalid number of tokens %q", value)
+			return ah.renderSettings(c, fromProtected, errs)
+		}
+	}
+
+	err := ah.UserServices.SetSkipTokens(c.Request().Context(), n)
+	if errors.Is(err, services.ErrInvalidSkipTokens) {
+		errs["skips"] = "The number of skip tokens can't be negative"
+		return ah.renderSettings(c, fromProtected, errs)
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving setting: %s", err))
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/settings")
+}
+
+// adminAPISkipTokens is how many questions each team may skip
+type adminAPISkipTokens struct {
+	Tokens int `json:"tokens"`
+}
+
+// AdminAPIGetSkipTokens returns how many questions each team may skip
+func (ah *AuthHandler) AdminAPIGetSkipTokens(c echo.Context) error {
+	return c.JSON(http.StatusOK, adminAPISkipTokens{Tokens: ah.UserServices.GetSkipTokens(c.Request().Context())})
+}
+
+// AdminAPISetSkipTokens sets how many questions each team may skip; zero
+// turns skipping off
+func (ah *AuthHandler) AdminAPISetSkipTokens(c echo.Context) error {
+	var req adminAPISkipTokens
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	err := ah.UserServices.SetSkipTokens(c.Request().Context(), req.Tokens)
+	if errors.Is(err, services.ErrInvalidSkipTokens) {
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", err))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+	return ah.AdminAPIGetSkipTokens(c)
+}
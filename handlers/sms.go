@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+// smsPageSize is how many text messages the admin API lists
+const smsPageSize = 100
+
+// teamPhone is the team's number for its own profile, nil without text
+// messages set up
+func (ah *AuthHandler) teamPhone(c echo.Context, teamID int) *services.TeamPhone {
+	if !ah.UserServices.SMSEnabled() {
+		return nil
+	}
+	phone, err := ah.UserServices.GetTeamPhone(c.Request().Context(), teamID)
+	if err != nil && !errors.Is(err, services.ErrNoTeamPhone) {
+		return nil
+	}
+	return &phone
+}
+
+// TeamPhoneHandler sets the number the team is texted on and texts it a
+// code; nothing else is sent to it until the team enters the code
+func (ah *AuthHandler) TeamPhoneHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	if c.FormValue("consent") != "on" {
+		return ah.renderOwnProfile(c, map[string]string{"phone": "Tick the box to agree to text messages"})
+	}
+
+	err := ah.UserServices.RequestPhoneCode(c.Request().Context(), c.Get(user_id_key).(int), c.FormValue("phone"))
+	switch {
+	case errors.Is(err, services.ErrSMSDisabled):
+		return c.String(http.StatusServiceUnavailable, "Text messages are not set up on this server")
+	case errors.Is(err, services.ErrInvalidPhone):
+		return ah.renderOwnProfile(c, map[string]string{"phone": "Enter the number in international form, e.g. +44 7700 900123"})
+	case err != nil:
+		return c.String(http.StatusInternalServerError, "Error sending the confirmation code")
+	}
+	return c.Redirect(http.StatusSeeOther, "/team")
+}
+
+// TeamPhoneConfirmHandler confirms the team's number with the code texted
+// to it
+func (ah *AuthHandler) TeamPhoneConfirmHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+
+	err := ah.UserServices.ConfirmTeamPhone(c.Request().Context(), c.Get(user_id_key).(int), c.FormValue("code"))
+	switch {
+	case errors.Is(err, services.ErrInvalidPhoneCode), errors.Is(err, services.ErrNoTeamPhone):
+		return ah.renderOwnProfile(c, map[string]string{"phone": "That code is wrong or has expired; send a new one if you need to"})
+	case err != nil:
+		return c.String(http.StatusInternalServerError, "Error confirming the number")
+	}
+	return c.Redirect(http.StatusSeeOther, "/team")
+}
+
+// TeamPhoneRemoveHandler stops texting the team
+func (ah *AuthHandler) TeamPhoneRemoveHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+
+	if err := ah.UserServices.RemoveTeamPhone(c.Request().Context(), c.Get(user_id_key).(int)); err != nil {
+		return c.String(http.StatusInternalServerError, "Error removing the number")
+	}
+	return c.Redirect(http.StatusSeeOther, "/team")
+}
+
+// adminAPISMS is the state of the text message outbox
+type adminAPISMS struct {
+	Enabled  bool           `json:"enabled"`
+	Messages []services.SMS `json:"messages"`
+}
+
+// AdminAPIListSMS returns whether text messages are set up and the latest
+// ones with their delivery state
+func (ah *AuthHandler) AdminAPIListSMS(c echo.Context) error {
+	messages, err := ah.UserServices.GetRecentSMS(c.Request().Context(), smsPageSize)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, adminAPISMS{Enabled: ah.UserServices.SMSEnabled(), Messages: messages})
+}
+
+// AdminAPISendTestSMS queues a test text message, to check the provider
+// settings
+func (ah *AuthHandler) AdminAPISendTestSMS(c echo.Context) error {
+	var req struct {
+		To string `json:"to"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	err := ah.UserServices.SendTestSMS(c.Request().Context(), req.To)
+	switch {
+	case errors.Is(err, services.ErrInvalidPhone):
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", err))
+	case errors.Is(err, services.ErrSMSDisabled):
+		return apiError(c, newPlayError(http.StatusServiceUnavailable, "%s", err))
+	case err != nil:
+		return apiError(c, err)
+	}
+	return c.NoContent(http.StatusAccepted)
+}
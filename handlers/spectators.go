@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/hunt"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// spectator_id_key holds the spectator a session belongs to. Spectator
+// sessions are never authenticated as a team, so no team route lets them
+// lock, answer or use up a quota
+const spectator_id_key string = "spectator_id_key"
+
+// spectator_hunt_key holds the hunt a spectator watches in the context
+const spectator_hunt_key string = "spectator_hunt_key"
+
+// startSpectatorSession signs a spectator in by storing it in the session
+// cookie
+func startSpectatorSession(c echo.Context, s services.Spectator, tzone string) {
+	sess, _ := session.Get(auth_sessions_key, c)
+	sess.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   60 * 60 * 24 * 7, // 1 week
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+
+	sess.Values = map[interface{}]interface{}{
+		auth_key:         false,
+		user_type:        "spectator",
+		spectator_id_key: s.ID,
+		user_name_key:    s.Name,
+		tzone_key:        tzone,
+	}
+	sess.Save(c.Request(), c.Response())
+}
+
+// spectatorMiddleware lets spectators and the admin through. A spectator
+// is looked up on every request, so removing one signs it out
+func (ah *AuthHandler) spectatorMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if isAdminSession(c) {
+			c.Set("ISADMIN", true)
+			c.Set(user_name_key, "admin")
+			c.Set(spectator_hunt_key, ah.adminHunt(c))
+			return next(c)
+		}
+
+		sess, _ := session.Get(auth_sessions_key, c)
+		id, ok := sess.Values[spectator_id_key].(int)
+		if !ok || sess.Values[user_type] != "spectator" {
+			return c.Redirect(http.StatusSeeOther, "/login")
+		}
+
+		s, err := ah.UserServices.GetSpectator(c.Request().Context(), id)
+		if errors.Is(err, services.ErrSpectatorNotFound) {
+			endSession(c)
+			return c.Redirect(http.StatusSeeOther, "/login")
+		}
+		if err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching you: %s", err))
+		}
+
+		c.Set("ISADMIN", false)
+		c.Set(user_name_key, s.Name)
+		c.Set(spectator_hunt_key, s.HuntID)
+		return next(c)
+	}
+}
+
+// SpectateHandler shows a spectator the hunt window and the titles of the
+// questions with their solve counts
+func (ah *AuthHandler) SpectateHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	huntID := c.Get(spectator_hunt_key).(int)
+
+	h, err := ah.UserServices.GetHunt(ctx, huntID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching hunt: %s", err))
+	}
+	questions, err := ah.UserServices.GetSpectatorQuestions(ctx, huntID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching questions: %s", err))
+	}
+
+	return renderView(c, hunt.SpectateIndex(
+		"Spectating",
+		c.Get(user_name_key).(string),
+		hunt.Spectate(h, ah.UserServices.GetHuntWindow(ctx, huntID), questions),
+	))
+}
+
+// SpectatorLeaderboardHandler shows a spectator the live leaderboard
+func (ah *AuthHandler) SpectatorLeaderboardHandler(c echo.Context) error {
+	users, err := ah.UserServices.GetLeaderbaord(c.Request().Context(), c.Get(spectator_hunt_key).(int))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching Leaderboard: %s", err))
+	}
+
+	return renderView(c, hunt.SpectateIndex(
+		"Leaderboard",
+		c.Get(user_name_key).(string),
+		hunt.SpectatorLeaderboard(users),
+	))
+}
+
+// AdminSpectatorsHandler lists the spectators of the hunt the panel is
+// switched to and adds one on POST
+func (ah *AuthHandler) AdminSpectatorsHandler(c echo.Context) error {
+	errs := make(map[string]string)
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	huntID := ah.adminHunt(c)
+
+	if c.Request().Method == "POST" {
+		_, err := ah.UserServices.CreateSpectator(c.Request().Context(), c.FormValue("name"), c.FormValue("email"), c.FormValue("password"), huntID)
+		switch {
+		case errors.Is(err, services.ErrInvalidSpectator), errors.Is(err, services.ErrSpectatorExists):
+			errs["spectator"] = err.Error()
+		case err != nil:
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating spectator: %s", err))
+		default:
+			return c.Redirect(http.StatusSeeOther, "/su/spectators")
+		}
+	}
+
+	spectators, err := ah.UserServices.GetSpectators(c.Request().Context(), huntID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching spectators: %s", err))
+	}
+
+	view := panel.Spectators(fromProtected, errs, spectators)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.SpectatorsIndex(
+		"Spectators",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminDeleteSpectator removes a spectator
+func (ah *AuthHandler) AdminDeleteSpectator(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid spectator ID")
+	}
+
+	err = ah.UserServices.DeleteSpectator(c.Request().Context(), id)
+	if err != nil && !errors.Is(err, services.ErrSpectatorNotFound) {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error deleting spectator: %s", err))
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/spectators")
+}
+
+// adminAPISpectator is a new spectator; the hunt defaults to the first
+type adminAPISpectator struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	HuntID   int    `json:"hunt_id"`
+}
+
+// AdminAPIListSpectators lists the spectators of a hunt
+func (ah *AuthHandler) AdminAPIListSpectators(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	spectators, err := ah.UserServices.GetSpectators(c.Request().Context(), huntID)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, spectators)
+}
+
+// AdminAPICreateSpectator adds a spectator to a hunt
+func (ah *AuthHandler) AdminAPICreateSpectator(c echo.Context) error {
+	var req adminAPISpectator
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+	huntID, err := ah.checkHunt(c.Request().Context(), req.HuntID)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	s, err := ah.UserServices.CreateSpectator(c.Request().Context(), req.Name, req.Email, req.Password, huntID)
+	switch {
+	case errors.Is(err, services.ErrInvalidSpectator):
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", err))
+	case errors.Is(err, services.ErrSpectatorExists):
+		return apiError(c, newPlayError(http.StatusConflict, "%s", err))
+	case err != nil:
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusCreated, s)
+}
+
+// AdminAPIDeleteSpectator removes a spectator
+func (ah *AuthHandler) AdminAPIDeleteSpectator(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if err := ah.UserServices.DeleteSpectator(c.Request().Context(), id); err != nil {
+		if errors.Is(err, services.ErrSpectatorNotFound) {
+			return apiError(c, newPlayError(http.StatusNotFound, "Spectator not found"))
+		}
+		return apiError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+// Sections of the public stats that can be exposed
+const (
+	StatsTeams       = "teams"
+	StatsSolves      = "solves"
+	StatsFirstBloods = "first_bloods"
+)
+
+// PublicStatsConfig controls the unauthenticated /api/stats endpoint
+type PublicStatsConfig struct {
+	Sections  []string      // which of StatsTeams, StatsSolves and StatsFirstBloods to expose; empty disables the endpoint
+	TTL       time.Duration // how long computed stats are served from cache, default 30s
+	RateLimit float64       // requests per second per IP, default 1
+	Burst     int           // default 5
+}
+
+// ParseStatsSections reads a comma-separated list of sections, where "all"
+// stands for every section and anything unknown is ignored
+func ParseStatsSections(s string) []string {
+	var sections []string
+	for _, part := range strings.Split(s, ",") {
+		switch part = strings.TrimSpace(part); part {
+		case "all":
+			return []string{StatsTeams, StatsSolves, StatsFirstBloods}
+		case StatsTeams, StatsSolves, StatsFirstBloods:
+			sections = append(sections, part)
+		}
+	}
+	return sections
+}
+
+// PublicStats serves a cached snapshot of each hunt's stats
+type PublicStats struct {
+	cfg   PublicStatsConfig
+	store AuthService
+
+	mu     sync.Mutex
+	cached map[int]statsSnapshot
+}
+
+// statsSnapshot is one hunt's computed stats
+type statsSnapshot struct {
+	stats    map[string]interface{}
+	cachedAt time.Time
+}
+
+// NewPublicStats creates the stats cache; it returns nil when no section is
+// exposed, which makes /api/stats answer 404
+func NewPublicStats(cfg PublicStatsConfig, us AuthService) *PublicStats {
+	if len(cfg.Sections) == 0 {
+		return nil
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 30 * time.Second
+	}
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = 1
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 5
+	}
+
+	return &PublicStats{cfg: cfg, store: us, cached: make(map[int]statsSnapshot)}
+}
+
+// get returns a hunt's cached stats, recomputing them once the TTL has
+// passed
+func (ps *PublicStats) get(ctx context.Context, huntID int) (map[string]interface{}, time.Time, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if snap, ok := ps.cached[huntID]; ok && time.Since(snap.cachedAt) < ps.cfg.TTL {
+		return snap.stats, snap.cachedAt, nil
+	}
+
+	stats, err := ps.store.GetHuntStats(ctx, huntID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	out := map[string]interface{}{}
+	for _, section := range ps.cfg.Sections {
+		switch section {
+		case StatsTeams:
+			out["team_count"] = stats.TeamCount
+		case StatsSolves:
+			out["total_solves"] = stats.TotalSolves
+			out["questions"] = stats.Questions
+		case StatsFirstBloods:
+			out["first_bloods"] = stats.FirstBloods
+		}
+	}
+	out["generated_at"] = time.Now().UTC()
+
+	snap := statsSnapshot{stats: out, cachedAt: time.Now()}
+	ps.cached[huntID] = snap
+	return snap.stats, snap.cachedAt, nil
+}
+
+// publicStatsRateLimit limits /api/stats to the configured rate
+func (ah *AuthHandler) publicStatsRateLimit() echo.MiddlewareFunc {
+	if ah.PublicStats == nil {
+		return ModerateRateLimitMiddleware()
+	}
+	return RateLimitMiddleware(ah.PublicStats.cfg.RateLimit, ah.PublicStats.cfg.Burst)
+}
+
+// PublicStatsHandler serves the public stats of ?hunt=, the first hunt by
+// default, for event websites
+func (ah *AuthHandler) PublicStatsHandler(c echo.Context) error {
+	if ah.PublicStats == nil {
+		return jsonError(c, http.StatusNotFound, "Stats are not public", nil)
+	}
+
+	hunt, err := ah.publicHunt(c)
+	if errors.Is(err, services.ErrHuntNotFound) {
+		return jsonError(c, http.StatusNotFound, "Hunt not found", nil)
+	}
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Internal server error", nil)
+	}
+
+	stats, cachedAt, err := ah.PublicStats.get(c.Request().Context(), hunt.ID)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Internal server error", nil)
+	}
+
+	// Let browsers and CDNs cache for as long as we do, and allow event
+	// websites on other origins to fetch the stats directly
+	maxAge := ah.PublicStats.cfg.TTL - time.Since(cachedAt)
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	c.Response().Header().Set(echo.HeaderAccessControlAllowOrigin, "*")
+
+	return c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/hunt"
+)
+
+// storeError maps store errors to play errors
+func storeError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrUnknownPowerUp):
+		return newPlayError(http.StatusNotFound, "Power-up not found")
+	case errors.Is(err, services.ErrCantAffordPowerUp):
+		return newPlayError(http.StatusPaymentRequired, "Not enough points to buy this power-up")
+	case errors.Is(err, services.ErrPowerUpUnavailable), errors.Is(err, services.ErrPowerUpLimit):
+		return newPlayError(http.StatusForbidden, "%s", err)
+	case errors.Is(err, services.ErrNoPowerUp), errors.Is(err, services.ErrNoLockToExtend):
+		return newPlayError(http.StatusConflict, "%s", err)
+	case errors.Is(err, services.ErrAlreadySolved):
+		return newPlayError(http.StatusForbidden, "Question already solved")
+	}
+	return err
+}
+
+// buyPowerUp sells the team a power-up while the hunt is running
+func (ah *AuthHandler) buyPowerUp(ctx context.Context, teamID int, kind string) (services.PowerUp, error) {
+	if err := ah.checkHuntOpen(ctx, teamID, true); err != nil {
+		return services.PowerUp{}, err
+	}
+	p, err := ah.UserServices.BuyPowerUp(ctx, teamID, kind)
+	return p, storeError(err)
+}
+
+// usePowerUp spends one of the team's power-ups on a question it may work
+// on
+func (ah *AuthHandler) usePowerUp(ctx context.Context, teamID int, kind string, questionID int) error {
+	qs, err := ah.loadQuestion(ctx, teamID, questionID)
+	if err != nil {
+		return err
+	}
+	if qs.Skipped {
+		return errQuestionSkipped
+	}
+	if err := ah.checkHuntOpen(ctx, teamID, true); err != nil {
+		return err
+	}
+	return storeError(ah.UserServices.UsePowerUp(ctx, teamID, kind, questionID))
+}
+
+// ownedPowerUps returns the power-ups the team has left to use
+func (ah *AuthHandler) ownedPowerUps(ctx context.Context, teamID int) []services.StoreItem {
+	items, _, err := ah.UserServices.GetStore(ctx, teamID)
+	if err != nil {
+		return nil
+	}
+	owned := make([]services.StoreItem, 0, len(items))
+	for _, item := range items {
+		if item.Owned > 0 {
+			owned = append(owned, item)
+		}
+	}
+	return owned
+}
+
+// renderStore shows the store with what the team bought, and the questions
+// it can spend power-ups on
+func (ah *AuthHandler) renderStore(c echo.Context, errs map[string]string) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	teamID := c.Get(user_id_key).(int)
+	teamName := c.Get(user_name_key).(string)
+
+	items, bought, err := ah.UserServices.GetStore(c.Request().Context(), teamID)
+	if err != nil {
+		return err
+	}
+	huntID, err := ah.requestHunt(c)
+	if err != nil {
+		return err
+	}
+	questions, err := ah.UserServices.GetAllQuestionsWithStatus(c.Request().Context(), huntID, teamID)
+	if err != nil {
+		return err
+	}
+	user, err := ah.UserServices.CheckUsername(c.Request().Context(), teamName)
+	if err != nil {
+		return err
+	}
+
+	view := hunt.Store(fromProtected, items, bought, questions, user.Points, errs)
+	c.Set("ISERROR", false)
+	return renderView(c, hunt.StoreIndex(
+		"Store",
+		teamName,
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// StoreHandler shows the power-up store
+func (ah *AuthHandler) StoreHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	return ah.renderStore(c, make(map[string]string))
+}
+
+// BuyPowerUpHandler buys a power-up from the store page
+func (ah *AuthHandler) BuyPowerUpHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	_, err := ah.buyPowerUp(c.Request().Context(), c.Get(user_id_key).(int), c.Param("kind"))
+	if err == nil {
+		return c.Redirect(http.StatusSeeOther, "/hunt/store")
+	}
+	var pe *playError
+	if !errors.As(err, &pe) || pe.Status >= http.StatusInternalServerError {
+		return playErrorString(c, err)
+	}
+	return ah.renderStore(c, map[string]string{"store": pe.Message})
+}
+
+// UsePowerUpHandler spends a power-up on a question, from the store or the
+// question page, and goes to the question
+func (ah *AuthHandler) UsePowerUpHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	questionID, err := strconv.Atoi(c.FormValue("question"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Choose a question")
+	}
+	err = ah.usePowerUp(c.Request().Context(), c.Get(user_id_key).(int), c.FormValue("kind"), questionID)
+	if err == errHuntNotStarted {
+		return c.Redirect(http.StatusSeeOther, "/hunt")
+	}
+	if err != nil {
+		return playErrorString(c, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/hunt/question/"+strconv.Itoa(questionID))
+}
+
+// apiStore is the store as a team sees it
+type apiStore struct {
+	Points    int                    `json:"points"`
+	Items     []services.StoreItem   `json:"items"`
+	Purchases []services.TeamPowerUp `json:"purchases"`
+}
+
+// APIStore returns the power-ups on sale and what the caller bought
+func (ah *AuthHandler) APIStore(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	items, bought, err := ah.UserServices.GetStore(c.Request().Context(), c.Get(user_id_key).(int))
+	if err != nil {
+		return apiError(c, err)
+	}
+	user, err := ah.UserServices.CheckUsername(c.Request().Context(), c.Get(user_name_key).(string))
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, apiStore{Points: user.Points, Items: items, Purchases: bought})
+}
+
+// APIBuyPowerUp buys a power-up and returns the store
+func (ah *AuthHandler) APIBuyPowerUp(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	if _, err := ah.buyPowerUp(c.Request().Context(), c.Get(user_id_key).(int), c.Param("kind")); err != nil {
+		return apiError(c, err)
+	}
+	return ah.APIStore(c)
+}
+
+// APIUsePowerUp spends one of the caller's power-ups on a question
+func (ah *AuthHandler) APIUsePowerUp(c echo.Context) error {
+	if isAdminSession(c) {
+		return apiError(c, newPlayError(http.StatusForbidden, "The admin has no team"))
+	}
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid question ID"))
+	}
+	if err := ah.usePowerUp(c.Request().Context(), c.Get(user_id_key).(int), c.Param("kind"), questionID); err != nil {
+		return apiError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AdminAPIListPowerUps returns every power-up with its price and limit
+func (ah *AuthHandler) AdminAPIListPowerUps(c echo.Context) error {
+	items, err := ah.UserServices.GetPowerUps(c.Request().Context())
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, items)
+}
+
+// AdminAPIUpdatePowerUp sets the price, limit and availability of a
+// power-up and returns every power-up
+func (ah *AuthHandler) AdminAPIUpdatePowerUp(c echo.Context) error {
+	var req struct {
+		Price      int  `json:"price"`
+		MaxPerTeam int  `json:"max_per_team"`
+		Enabled    bool `json:"enabled"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, newPlayError(http.StatusBadRequest, "Invalid request"))
+	}
+
+	err := ah.UserServices.SetPowerUp(c.Request().Context(), services.PowerUp{
+		Kind:       c.Param("kind"),
+		Price:      req.Price,
+		MaxPerTeam: req.MaxPerTeam,
+		Enabled:    req.Enabled,
+	})
+	if errors.Is(err, services.ErrUnknownPowerUp) {
+		return apiError(c, newPlayError(http.StatusNotFound, "Power-up not found"))
+	}
+	if errors.Is(err, services.ErrInvalidPowerUp) {
+		return apiError(c, newPlayError(http.StatusBadRequest, "%s", err))
+	}
+	if err != nil {
+		return apiError(c, err)
+	}
+	return ah.AdminAPIListPowerUps(c)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// queryID reads an optional numeric query parameter, 0 when absent
+func queryID(c echo.Context, name string) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		return 0, newPlayError(http.StatusBadRequest, "Invalid %s", name)
+	}
+	return id, nil
+}
+
+// AdminSubmissionsHandler shows the latest answers submitted in the hunt
+// being managed, filtered by ?team_id= and ?question_id=. Rows matching
+// ?answer= are highlighted, for checking what a team says it submitted
+func (ah *AuthHandler) AdminSubmissionsHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	teamID, err := queryID(c, "team_id")
+	if err != nil {
+		return playErrorString(c, err)
+	}
+	questionID, err := queryID(c, "question_id")
+	if err != nil {
+		return playErrorString(c, err)
+	}
+
+	submissions, err := ah.UserServices.GetSubmissions(c.Request().Context(), ah.adminHunt(c), teamID, questionID, 0)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching submissions: %s", err))
+	}
+
+	answer := c.QueryParam("answer")
+	hash := ""
+	if answer != "" {
+		hash = services.AnswerHash(answer)
+	}
+
+	view := panel.Submissions(fromProtected, submissions, teamID, questionID, answer, hash)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.SubmissionsIndex(
+		"Submissions",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminAPIListSubmissions lists the latest answers submitted in a hunt,
+// newest first, optionally those of one team or question
+func (ah *AuthHandler) AdminAPIListSubmissions(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	teamID, err := queryID(c, "team_id")
+	if err != nil {
+		return apiError(c, err)
+	}
+	questionID, err := queryID(c, "question_id")
+	if err != nil {
+		return apiError(c, err)
+	}
+	limit, err := queryID(c, "limit")
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	submissions, err := ah.UserServices.GetSubmissions(c.Request().Context(), huntID, teamID, questionID, limit)
+	if err != nil {
+		return apiError(c, err)
+	}
+	return c.JSON(http.StatusOK, submissions)
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+// telegramPollRetry is how long the bot waits after failing to poll
+const telegramPollRetry = 5 * time.Second
+
+// telegramChatCount is how many Telegram chats a team linked, or -1
+// without a bot
+func (ah *AuthHandler) telegramChatCount(c echo.Context, teamID int) int {
+	if ah.Telegram == nil {
+		return -1
+	}
+	chats, err := ah.UserServices.GetTelegramChats(c.Request().Context(), teamID)
+	if err != nil {
+		return -1
+	}
+	return len(chats)
+}
+
+// TelegramLinkHandler makes a link code for the team and sends it to the
+// bot, where starting the chat links it
+func (ah *AuthHandler) TelegramLinkHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+	if ah.Telegram == nil {
+		return c.String(http.StatusServiceUnavailable, "Telegram is not set up on this server")
+	}
+
+	code, err := ah.UserServices.NewTelegramLinkCode(c.Request().Context(), c.Get(user_id_key).(int))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error making a Telegram link")
+	}
+	return c.Redirect(http.StatusSeeOther, ah.Telegram.LinkURL(code))
+}
+
+// TelegramUnlinkHandler unlinks every Telegram chat of the team
+func (ah *AuthHandler) TelegramUnlinkHandler(c echo.Context) error {
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "The admin has no team")
+	}
+
+	if err := ah.UserServices.UnlinkTeamTelegram(c.Request().Context(), c.Get(user_id_key).(int)); err != nil {
+		return c.String(http.StatusInternalServerError, "Error unlinking Telegram")
+	}
+	return c.Redirect(http.StatusSeeOther, "/team")
+}
+
+// RunTelegramBot answers the commands sent to the bot until ctx is done.
+// Telegram hands updates to one poller at a time, so with several
+// instances the others wait their turn
+func (ah *AuthHandler) RunTelegramBot(ctx context.Context) {
+	var offset int64
+	for ctx.Err() == nil {
+		updates, err := ah.Telegram.Updates(ctx, offset)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			wait := telegramPollRetry
+			if errors.Is(err, services.ErrTelegramConflict) {
+				wait = time.Minute
+			} else {
+				log.Printf("Error polling Telegram: %v", err)
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message == nil || u.Message.Text == "" {
+				continue
+			}
+			if reply := ah.telegramCommand(ctx, *u.Message); reply != "" {
+				ah.Telegram.Send(ctx, u.Message.Chat.ID, reply)
+			}
+		}
+	}
+}
+
+// telegramHelp lists the bot's commands
+func (ah *AuthHandler) telegramHelp() string {
+	help := "Link this chat from your team page to get announcements and quota resets here.\n\n" +
+		"/status - your team's score\n" +
+		"/stop - unlink this chat"
+	if ah.Telegram.Answers() {
+		help += "\n/questions - the questions you can answer\n" +
+			"/answer <question> <answer> - answer a question, e.g. /answer 3 moriarty"
+	}
+	return help
+}
+
+// telegramCommand runs a command sent to the bot and returns the reply
+func (ah *AuthHandler) telegramCommand(ctx context.Context, msg services.TelegramMessage) string {
+	command, args, _ := strings.Cut(strings.TrimSpace(msg.Text), " ")
+	// In groups commands are addressed as /command@bot
+	command, _, _ = strings.Cut(strings.ToLower(command), "@")
+	args = strings.TrimSpace(args)
+
+	switch command {
+	case "/start":
+		if args == "" {
+			return ah.telegramHelp()
+		}
+		username := ""
+		if msg.From != nil {
+			username = msg.From.Username
+		}
+		chat, err := ah.UserServices.LinkTelegramChat(ctx, args, msg.Chat.ID, username)
+		if errors.Is(err, services.ErrInvalidTelegramCode) {
+			return "This link has expired. Open a new one from your team page."
+		}
+		if err != nil {
+			return "Something went wrong linking this chat, try again."
+		}
+		return fmt.Sprintf("Linked to team %s.\n\n%s", chat.TeamName, ah.telegramHelp())
+
+	case "/help":
+		return ah.telegramHelp()
+	}
+
+	chat, err := ah.UserServices.GetTelegramChat(ctx, msg.Chat.ID)
+	if errors.Is(err, services.ErrTelegramNotLinked) {
+		return ah.telegramHelp()
+	}
+	if err != nil {
+		return "Something went wrong, try again."
+	}
+
+	switch command {
+	case "/stop":
+		if err := ah.UserServices.UnlinkTelegramChat(ctx, msg.Chat.ID); err != nil {
+			return "Something went wrong unlinking this chat, try again."
+		}
+		return "Unlinked. You won't hear from us here any more."
+
+	case "/status":
+		team, err := ah.teamProfile(ctx, chat.TeamID, chat.TeamName)
+		if err != nil {
+			return "Something went wrong, try again."
+		}
+		return fmt.Sprintf("Team %s: %d points, %d in penalties.", team.Username, team.Points, team.Penalty)
+
+	case "/questions":
+		if !ah.Telegram.Answers() {
+			return "Answering from Telegram is turned off."
+		}
+		return ah.telegramQuestions(ctx, chat.TeamID)
+
+	case "/answer":
+		if !ah.Telegram.Answers() {
+			return "Answering from Telegram is turned off."
+		}
+		id, answer, _ := strings.Cut(args, " ")
+		lvl, err := strconv.Atoi(id)
+		if err != nil || strings.TrimSpace(answer) == "" {
+			return "Send /answer <question> <answer>, e.g. /answer 3 moriarty"
+		}
+		return ah.telegramAnswer(ctx, chat, lvl, strings.TrimSpace(answer))
+	}
+
+	return ah.telegramHelp()
+}
+
+// telegramQuestions lists the team's questions with their IDs
+func (ah *AuthHandler) telegramQuestions(ctx context.Context, teamID int) string {
+	list, err := ah.questionSummaries(ctx, teamID)
+	if err != nil {
+		return playErrorMessage(err)
+	}
+	if len(list) == 0 {
+		return "No questions yet."
+	}
+
+	lines := make([]string, 0, len(list))
+	for _, q := range list {
+		line := fmt.Sprintf("%d. %s (%d points)", q.ID, q.Title, q.Points)
+		switch {
+		case q.Solved:
+			line += " - solved"
+		case q.Skipped:
+			line += " - skipped"
+		case q.Locked && !q.LockedByMe:
+			line += " - taken by " + q.LockedByName
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// telegramAnswer checks an answer sent from a chat, like the API does.
+// Submissions are logged as coming from "telegram"
+func (ah *AuthHandler) telegramAnswer(ctx context.Context, chat services.TelegramChat, lvl int, answer string) string {
+	qs, err := ah.loadQuestion(ctx, chat.TeamID, lvl)
+	if err != nil {
+		return playErrorMessage(err)
+	}
+	result, err := ah.submitAnswer(ctx, chat.TeamID, chat.TeamName, qs, answer, "", "telegram")
+	if err != nil {
+		return playErrorMessage(err)
+	}
+	return result.Message
+}
+
+// playErrorMessage is what a chat is told when a play action fails,
+// without internal details
+func playErrorMessage(err error) string {
+	var pe *playError
+	if errors.As(err, &pe) && pe.Status < http.StatusInternalServerError {
+		return pe.Message
+	}
+	return "Something went wrong, try again."
+}
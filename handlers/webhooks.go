@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// webhookDeliveryHistory is how many deliveries the admin page shows
+const webhookDeliveryHistory = 50
+
+// emitWebhook queues an event for the webhooks subscribed to it; the
+// dispatcher in main delivers it in the background
+func (ah *AuthHandler) emitWebhook(ctx context.Context, event string, data map[string]interface{}) {
+	if err := ah.UserServices.QueueWebhookEvent(ctx, event, data); err != nil {
+		log.Printf("Warning: Error queueing webhook event %s: %s", event, err)
+	}
+}
+
+// newWebhookSecret generates a signing secret for webhooks added without one
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// AdminWebhooksHandler lists webhooks and their recent deliveries, and
+// registers a new webhook or saves the Discord message templates on POST
+func (ah *AuthHandler) AdminWebhooksHandler(c echo.Context) error {
+	errs := make(map[string]string)
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	if c.Request().Method == "POST" && c.FormValue("form") == "discord" {
+		for _, event := range services.WebhookEvents {
+			err := ah.UserServices.SetDiscordTemplate(c.Request().Context(), event, c.FormValue(event))
+			if errors.Is(err, services.ErrInvalidDiscordTemplate) {
+				errs["discord"] = err.Error()
+				break
+			}
+			if err != nil {
+				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error saving Discord template: %s", err))
+			}
+		}
+		if len(errs) == 0 {
+			return c.Redirect(http.StatusSeeOther, "/su/webhooks")
+		}
+	} else if c.Request().Method == "POST" {
+		target := strings.TrimSpace(c.FormValue("url"))
+		secret := strings.TrimSpace(c.FormValue("secret"))
+		format := c.FormValue("format")
+
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs["url"] = "Webhook URL must be an http(s) URL"
+		}
+		if format != services.WebhookFormatJSON && format != services.WebhookFormatDiscord {
+			errs["format"] = "Choose how the webhook's messages are sent"
+		}
+
+		var events []string
+		for _, e := range c.Request().Form["events"] {
+			for _, known := range services.WebhookEvents {
+				if e == known {
+					events = append(events, e)
+				}
+			}
+		}
+
+		if len(errs) == 0 {
+			if secret == "" {
+				secret, err = newWebhookSecret()
+				if err != nil {
+					return c.String(http.StatusInternalServerError, fmt.Sprintf("Error generating secret: %s", err))
+				}
+			}
+
+			err = ah.UserServices.CreateWebhook(c.Request().Context(), services.Webhook{
+				URL:    target,
+				Secret: secret,
+				Events: events,
+				Format: format,
+			})
+			if err != nil {
+				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error creating webhook: %s", err))
+			}
+
+			return c.Redirect(http.StatusSeeOther, "/su/webhooks")
+		}
+	}
+
+	webhooks, err := ah.UserServices.GetWebhooks(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching webhooks: %s", err))
+	}
+
+	deliveries, err := ah.UserServices.GetRecentWebhookDeliveries(c.Request().Context(), webhookDeliveryHistory)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching webhook deliveries: %s", err))
+	}
+
+	templates, err := ah.UserServices.GetDiscordTemplates(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching Discord templates: %s", err))
+	}
+
+	view := panel.Webhooks(fromProtected, errs, webhooks, deliveries, templates)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.WebhooksIndex(
+		"Webhooks",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// AdminDeleteWebhook removes a webhook and its delivery history
+func (ah *AuthHandler) AdminDeleteWebhook(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	if err := ah.UserServices.DeleteWebhook(c.Request().Context(), id); err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error deleting webhook: %s", err))
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/su/webhooks")
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+// pushSubscriptionRequest mirrors the browser's PushSubscription.toJSON()
+type pushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// GetPushKeyAPI returns the VAPID public key browsers subscribe with
+func (ah *AuthHandler) GetPushKeyAPI(c echo.Context) error {
+	if ah.WebPush == nil {
+		return jsonError(c, http.StatusNotFound, "Web Push is not enabled", nil)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"public_key": ah.WebPush.PublicKey(),
+	})
+}
+
+// PushSubscribeAPI stores the calling browser's push subscription for the team
+func (ah *AuthHandler) PushSubscribeAPI(c echo.Context) error {
+	if ah.WebPush == nil {
+		return jsonError(c, http.StatusNotFound, "Web Push is not enabled", nil)
+	}
+
+	var req pushSubscriptionRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid subscription", nil)
+	}
+
+	if !strings.HasPrefix(req.Endpoint, "https://") || req.Keys.P256dh == "" || req.Keys.Auth == "" {
+		return jsonError(c, http.StatusBadRequest, "Invalid subscription", nil)
+	}
+
+	err := ah.UserServices.SavePushSubscription(c.Request().Context(), services.PushSubscription{
+		TeamID:   c.Get(user_id_key).(int),
+		Endpoint: req.Endpoint,
+		P256dh:   req.Keys.P256dh,
+		Auth:     req.Keys.Auth,
+	})
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Failed to save subscription", nil)
+	}
+
+	return c.JSON(http.StatusOK, map[string]bool{
+		"subscribed": true,
+	})
+}
+
+// PushUnsubscribeAPI forgets the calling browser's push subscription
+func (ah *AuthHandler) PushUnsubscribeAPI(c echo.Context) error {
+	var req pushSubscriptionRequest
+	if err := c.Bind(&req); err != nil || req.Endpoint == "" {
+		return jsonError(c, http.StatusBadRequest, "Invalid subscription", nil)
+	}
+
+	if err := ah.UserServices.DeletePushSubscription(c.Request().Context(), req.Endpoint); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "Failed to remove subscription", nil)
+	}
+
+	return c.JSON(http.StatusOK, map[string]bool{
+		"subscribed": false,
+	})
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+)
+
+const (
+	// Time allowed to write a single message to the client
+	wsWriteWait = 10 * time.Second
+
+	// Time allowed to read the next pong from the client
+	wsPongWait = 60 * time.Second
+
+	// Send pings with this period, must be less than wsPongWait
+	wsPingPeriod = 30 * time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// WebSocketHandler streams the same Broadcaster events as SSEHandler over a
+// WebSocket, for browsers and proxies that mishandle long-lived SSE
+func (ah *AuthHandler) WebSocketHandler(c echo.Context) error {
+	conn, err := wsUpgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// Upgrade has already written an HTTP error to the client
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return nil
+	}
+	defer conn.Close()
+
+	// Create a unique client ID
+	clientID := uuid.New().String()
+
+	// Register the client with the broadcaster, subscribing it to its
+	// team's channel when the request is authenticated, or to the admin
+	// channel for admins
+	client := ah.Broadcaster.RegisterClient(clientID, eventChannel(c), ah.eventHunt(c))
+	defer ah.Broadcaster.UnregisterClient(client)
+
+	// Send initial connection event
+	initialEvent := services.Event{
+		Type: "connected",
+		Data: map[string]interface{}{
+			"client_id": clientID,
+			"message":   "Connected to real-time updates",
+			"transport": "websocket",
+		},
+		Timestamp: time.Now(),
+	}
+	if err := writeWSEvent(conn, initialEvent); err != nil {
+		return nil
+	}
+
+	// Send current state immediately
+	huntID, _ := ah.requestHunt(c)
+	locks, err := ah.UserServices.GetAllLockedQuestions(c.Request().Context(), huntID)
+	if err == nil {
+		stateEvent := services.Event{
+			Type: services.EventQuestionLocked,
+			Data: map[string]interface{}{
+				"locks": locks,
+			},
+			Timestamp: time.Now(),
+		}
+		if err := writeWSEvent(conn, stateEvent); err != nil {
+			return nil
+		}
+	}
+
+	// The client never sends anything meaningful, but we still have to read
+	// so that pongs and close frames are processed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			conn.SetReadDeadline(time.Now().Add(wsPongWait))
+			return nil
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-client.Channel:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(wsWriteWait))
+				return nil
+			}
+			if err := writeWSEvent(conn, event); err != nil {
+				return nil
+			}
+			if event.Type == services.EventReconnect {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseServiceRestart, ""), time.Now().Add(wsWriteWait))
+				return nil
+			}
+
+		case <-ticker.C:
+			// Ping keeps intermediaries from timing out the connection
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return nil
+			}
+
+		case <-client.Disconnect:
+			// Dropped by the broadcaster for falling behind
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(wsWriteWait))
+			return nil
+
+		case <-closed:
+			// Client disconnected
+			return nil
+
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
+
+// writeWSEvent sends an event as a single JSON text frame
+func writeWSEvent(conn *websocket.Conn, event services.Event) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := conn.WriteJSON(event); err != nil {
+		if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			log.Printf("Error writing to WebSocket: %v", err)
+		}
+		return err
+	}
+	return nil
+}
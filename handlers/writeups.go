@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/namishh/holmes/services"
+	"github.com/namishh/holmes/views/pages/hunt"
+	"github.com/namishh/holmes/views/pages/panel"
+)
+
+// writeupError maps writeup service errors to play errors
+func writeupError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrWriteupNotFound):
+		return newPlayError(http.StatusNotFound, "Writeup not found")
+	case errors.Is(err, services.ErrWriteupsClosed), errors.Is(err, services.ErrWriteupNotSolved):
+		return newPlayError(http.StatusForbidden, "%s", err.Error())
+	case errors.Is(err, services.ErrWriteupEmpty), errors.Is(err, services.ErrWriteupTooLong),
+		errors.Is(err, services.ErrTooManyWriteupFiles), errors.Is(err, services.ErrInvalidWriteupStatus):
+		return newPlayError(http.StatusBadRequest, "%s", err.Error())
+	}
+	return err
+}
+
+// WriteupHandler shows and saves the team's writeup of a question once
+// its hunt is over
+func (ah *AuthHandler) WriteupHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	if isAdminSession(c) {
+		return c.String(http.StatusForbidden, "Admins review writeups from the admin panel")
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid question ID")
+	}
+	ctx := c.Request().Context()
+	teamID := c.Get(user_id_key).(int)
+
+	if err := ah.UserServices.CheckWriteup(ctx, teamID, id, 0); err != nil {
+		return playErrorString(c, writeupError(err))
+	}
+	question, err := ah.UserServices.GetQuestionById(ctx, id)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching question: %s", err))
+	}
+	writeup, err := ah.UserServices.GetTeamWriteup(ctx, teamID, id)
+	if err != nil && !errors.Is(err, services.ErrWriteupNotFound) {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching writeup: %s", err))
+	}
+
+	body := writeup.Body
+	errs := make(map[string]string)
+	if c.Request().Method == "POST" {
+		body = strings.TrimSpace(c.FormValue("body"))
+		var newFiles int
+		form, err := c.MultipartForm()
+		if err == nil {
+			newFiles = len(form.File["files"])
+		}
+
+		// Check everything before storing files so a refused writeup
+		// leaves nothing behind
+		if body == "" {
+			errs["body"] = services.ErrWriteupEmpty.Error()
+		} else if len([]rune(body)) > services.WriteupMaxLength {
+			errs["body"] = services.ErrWriteupTooLong.Error()
+		} else if err := ah.UserServices.CheckWriteup(ctx, teamID, id, newFiles); err != nil {
+			if !errors.Is(err, services.ErrTooManyWriteupFiles) {
+				return playErrorString(c, writeupError(err))
+			}
+			errs["files"] = err.Error()
+		}
+
+		var keys, names []string
+		if len(errs) == 0 && newFiles > 0 {
+			keys, err = ah.UserServices.MakeArray("files", form, services.WriteupFilePrefix)
+			if err != nil {
+				if !isUploadRejected(err) {
+					return c.String(http.StatusInternalServerError, fmt.Sprintf("Error storing files: %s", err))
+				}
+				errs["files"] = err.Error()
+			}
+			names = uploadedFilenames(form, "files")
+		}
+
+		if len(errs) == 0 {
+			if _, err := ah.UserServices.SubmitWriteup(ctx, teamID, id, body, keys, names); err != nil {
+				return playErrorString(c, writeupError(err))
+			}
+			return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/hunt/question/%d/writeup", id))
+		}
+	}
+
+	view := hunt.Writeup(fromProtected, question, writeup, body, errs)
+	c.Set("ISERROR", false)
+	return renderView(c, hunt.WriteupIndex(
+		"Writeup",
+		c.Get(user_name_key).(string),
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// DeleteWriteupFileHandler removes a file from the team's writeup
+func (ah *AuthHandler) DeleteWriteupFileHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid question ID")
+	}
+	fileID, err := strconv.Atoi(c.Param("fid"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid file ID")
+	}
+
+	teamID := c.Get(user_id_key).(int)
+	if err := ah.UserServices.RemoveWriteupFile(c.Request().Context(), teamID, id, fileID); err != nil {
+		return playErrorString(c, writeupError(err))
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/hunt/question/%d/writeup", id))
+}
+
+// APIWriteup returns the team's writeup of a question
+func (ah *AuthHandler) APIWriteup(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	teamID := c.Get(user_id_key).(int)
+	if err := ah.UserServices.CheckWriteup(c.Request().Context(), teamID, id, 0); err != nil {
+		return apiError(c, writeupError(err))
+	}
+	writeup, err := ah.UserServices.GetTeamWriteup(c.Request().Context(), teamID, id)
+	if err != nil {
+		return apiError(c, writeupError(err))
+	}
+	return c.JSON(http.StatusOK, writeup)
+}
+
+// APISaveWriteup writes or edits the team's writeup of a question. Files
+// are attached from the writeup page
+func (ah *AuthHandler) APISaveWriteup(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if isAdminSession(c) {
+		return jsonError(c, http.StatusForbidden, "Admins review writeups from the admin API", nil)
+	}
+
+	var req struct {
+		Body string `json:"body" form:"body"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid request", nil)
+	}
+
+	writeup, err := ah.UserServices.SubmitWriteup(c.Request().Context(), c.Get(user_id_key).(int), id, strings.TrimSpace(req.Body), nil, nil)
+	if err != nil {
+		return apiError(c, writeupError(err))
+	}
+	return c.JSON(http.StatusOK, writeup)
+}
+
+// WriteupGalleryHandler shows the approved writeups of a hunt to everyone
+// once the hunt is over
+func (ah *AuthHandler) WriteupGalleryHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+	ctx := c.Request().Context()
+
+	// Without a hunt named, signed in teams and admins see their own
+	var (
+		gallery services.Hunt
+		err     error
+	)
+	if c.QueryParam("hunt") == "" && fromProtected {
+		huntID := ah.adminHunt(c)
+		sess, _ := session.Get(auth_sessions_key, c)
+		if teamID, ok := sess.Values[user_id_key].(int); ok && !isAdminSession(c) {
+			huntID, err = ah.teamHunt(ctx, teamID)
+			if err != nil {
+				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching hunt: %s", err))
+			}
+		}
+		gallery, err = ah.UserServices.GetHunt(ctx, huntID)
+	} else {
+		gallery, err = ah.publicHunt(c)
+	}
+	if errors.Is(err, services.ErrHuntNotFound) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching hunt: %s", err))
+	}
+
+	open := ah.UserServices.GalleryOpen(ctx, gallery.ID)
+	var writeups []services.Writeup
+	if open {
+		writeups, err = ah.UserServices.GetWriteups(ctx, gallery.ID, services.WriteupApproved)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching writeups: %s", err))
+		}
+	}
+
+	username := ""
+	sess, _ := session.Get(auth_sessions_key, c)
+	if name, ok := sess.Values[user_name_key].(string); ok && fromProtected {
+		username = name
+	}
+
+	c.Set("ISERROR", false)
+	return renderView(c, hunt.WriteupIndex(
+		"Writeups",
+		username,
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		hunt.WriteupGallery(fromProtected, gallery, open, writeups),
+	))
+}
+
+// WriteupFileHandler serves a writeup attachment to admins, to the team
+// that wrote it and, once it is in the gallery, to everyone
+func (ah *AuthHandler) WriteupFileHandler(c echo.Context) error {
+	key := c.Param("key")
+	ctx := c.Request().Context()
+
+	file, writeup, err := ah.UserServices.GetWriteupFile(ctx, key)
+	if errors.Is(err, services.ErrWriteupNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	huntID, err := ah.teamHunt(ctx, writeup.TeamID)
+	if err != nil {
+		return err
+	}
+	public := writeup.Status == services.WriteupApproved && ah.UserServices.GalleryOpen(ctx, huntID)
+	if !public && !isAdminSession(c) {
+		sess, _ := session.Get(auth_sessions_key, c)
+		if teamID, _ := sess.Values[user_id_key].(int); teamID == 0 || teamID != writeup.TeamID {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+	}
+
+	return ah.serveTeamUpload(c, key, file.Name)
+}
+
+// serveTeamUpload serves a file a team uploaded, downloaded as name unless
+// it is an image
+func (ah *AuthHandler) serveTeamUpload(c echo.Context, key, name string) error {
+	obj, info, err := ah.UserServices.OpenMedia(key)
+	if errors.Is(err, services.ErrObjectNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	// Teams upload anything, so only images other than SVG are shown
+	// inline; the rest is downloaded rather than rendered on this origin
+	header := c.Response().Header()
+	if strings.HasPrefix(info.ContentType, "image/") && !strings.HasPrefix(info.ContentType, "image/svg") {
+		header.Set(echo.HeaderContentType, info.ContentType)
+	} else {
+		header.Set(echo.HeaderContentType, "application/octet-stream")
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": name})
+		if disposition == "" {
+			disposition = "attachment"
+		}
+		header.Set(echo.HeaderContentDisposition, disposition)
+	}
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "private, max-age=300")
+	http.ServeContent(c.Response(), c.Request(), key, info.ModTime, obj)
+	return nil
+}
+
+// AdminWriteupsHandler lists the writeups of the admin's hunt for review,
+// the pending ones unless another status is asked for
+func (ah *AuthHandler) AdminWriteupsHandler(c echo.Context) error {
+	fromProtected, ok := c.Get("FROMPROTECTED").(bool)
+	if !ok {
+		return errors.New("invalid type for key 'FROMPROTECTED'")
+	}
+
+	status := services.WriteupPending
+	if values := c.QueryParams(); values.Has("status") {
+		status = values.Get("status")
+	}
+
+	writeups, err := ah.UserServices.GetWriteups(c.Request().Context(), ah.adminHunt(c), status)
+	if errors.Is(err, services.ErrInvalidWriteupStatus) {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching writeups: %s", err))
+	}
+
+	view := panel.Writeups(fromProtected, writeups, status)
+	c.Set("ISERROR", false)
+	return renderView(c, panel.WriteupsIndex(
+		"Writeups",
+		"admin",
+		fromProtected,
+		c.Get("ISERROR").(bool),
+		view,
+	))
+}
+
+// moderateWriteup sets the status of a writeup and tells its team
+func (ah *AuthHandler) moderateWriteup(c echo.Context, id int, status string) error {
+	ctx := c.Request().Context()
+	if err := ah.UserServices.ModerateWriteup(ctx, id, status); err != nil {
+		return writeupError(err)
+	}
+
+	writeup, err := ah.UserServices.GetWriteup(ctx, id)
+	if err != nil {
+		return nil
+	}
+	link := fmt.Sprintf("/hunt/question/%d/writeup", writeup.QuestionID)
+	switch status {
+	case services.WriteupApproved:
+		ah.notify(ctx, writeup.TeamID, services.NotificationWriteup, "Writeup approved",
+			fmt.Sprintf("Your writeup of %s is in the gallery", writeup.QuestionTitle), link)
+	case services.WriteupRejected:
+		ah.notify(ctx, writeup.TeamID, services.NotificationWriteup, "Writeup not accepted",
+			fmt.Sprintf("Your writeup of %s was not accepted; edit it to send it again", writeup.QuestionTitle), link)
+	}
+	return nil
+}
+
+// AdminApproveWriteup puts a writeup in the gallery
+func (ah *AuthHandler) AdminApproveWriteup(c echo.Context) error {
+	return ah.adminSetWriteupStatus(c, services.WriteupApproved)
+}
+
+// AdminRejectWriteup keeps a writeup out of the gallery
+func (ah *AuthHandler) AdminRejectWriteup(c echo.Context) error {
+	return ah.adminSetWriteupStatus(c, services.WriteupRejected)
+}
+
+func (ah *AuthHandler) adminSetWriteupStatus(c echo.Context, status string) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid writeup ID")
+	}
+	if err := ah.moderateWriteup(c, id, status); err != nil {
+		return playErrorString(c, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/writeups")
+}
+
+// AdminDeleteWriteup deletes a writeup and its files
+func (ah *AuthHandler) AdminDeleteWriteup(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid writeup ID")
+	}
+	if err := ah.UserServices.DeleteWriteup(c.Request().Context(), id); err != nil {
+		return playErrorString(c, writeupError(err))
+	}
+	return c.Redirect(http.StatusSeeOther, "/su/writeups")
+}
+
+// AdminAPIListWriteups lists the writeups of a hunt, optionally with one
+// status
+func (ah *AuthHandler) AdminAPIListWriteups(c echo.Context) error {
+	huntID, err := ah.adminAPIHunt(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	writeups, err := ah.UserServices.GetWriteups(c.Request().Context(), huntID, c.QueryParam("status"))
+	if err != nil {
+		return apiError(c, writeupError(err))
+	}
+	return c.JSON(http.StatusOK, writeups)
+}
+
+// AdminAPIModerateWriteup sets the status of a writeup
+func (ah *AuthHandler) AdminAPIModerateWriteup(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "Invalid request", nil)
+	}
+	if err := ah.moderateWriteup(c, id, req.Status); err != nil {
+		return apiError(c, err)
+	}
+
+	writeup, err := ah.UserServices.GetWriteup(c.Request().Context(), id)
+	if err != nil {
+		return apiError(c, writeupError(err))
+	}
+	return c.JSON(http.StatusOK, writeup)
+}
+
+// AdminAPIDeleteWriteup deletes a writeup and its files
+func (ah *AuthHandler) AdminAPIDeleteWriteup(c echo.Context) error {
+	id, err := adminAPIID(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if err := ah.UserServices.DeleteWriteup(c.Request().Context(), id); err != nil {
+		return apiError(c, writeupError(err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,208 @@
+// Package i18n translates the text teams see. Messages are keyed by their
+// English text, so English needs no translation file and a message missing
+// from a language falls back to English. Translations ship in locales/ as
+// one JSON file per language and more can be loaded from a directory
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Source is the language messages are written in
+const Source = "en"
+
+//go:embed locales/*.json
+var bundled embed.FS
+
+// Locale is a language teams can pick
+type Locale struct {
+	Code string // e.g. "hi"
+	Name string // in the language itself, e.g. "हिन्दी"
+}
+
+// catalog is one language's translations, read from a file shaped
+// {"language": "हिन्दी", "messages": {"Home": "होम", ...}}
+type catalog struct {
+	Language string            `json:"language"`
+	Messages map[string]string `json:"messages"`
+}
+
+var (
+	mu            sync.RWMutex
+	catalogs      = map[string]catalog{Source: {Language: "English"}}
+	defaultLocale = Source
+)
+
+func init() {
+	if err := load(bundled, "locales"); err != nil {
+		panic(fmt.Sprintf("i18n: bundled translations: %v", err))
+	}
+}
+
+// Load reads the translations in dir, if given, over the bundled ones, so
+// a language can be added or a message reworded without a rebuild, and
+// makes defaultCode the language of teams whose browser asks for none we
+// have
+func Load(dir, defaultCode string) error {
+	if dir != "" {
+		if err := load(os.DirFS(dir), "."); err != nil {
+			return err
+		}
+	}
+	if defaultCode == "" {
+		return nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := catalogs[defaultCode]; !ok {
+		return fmt.Errorf("no translations for the default locale %q", defaultCode)
+	}
+	defaultLocale = defaultCode
+	return nil
+}
+
+// load merges every <code>.json in dir of fsys into the catalogs
+func load(fsys fs.FS, dir string) error {
+	names, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		var c catalog
+		if err := json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		code := strings.ToLower(strings.TrimSuffix(path.Base(name), ".json"))
+		merged := catalogs[code]
+		if c.Language != "" {
+			merged.Language = c.Language
+		}
+		if merged.Language == "" {
+			merged.Language = code
+		}
+		if merged.Messages == nil {
+			merged.Messages = make(map[string]string, len(c.Messages))
+		}
+		for k, v := range c.Messages {
+			merged.Messages[k] = v
+		}
+		catalogs[code] = merged
+	}
+	return nil
+}
+
+// Locales returns the languages teams can pick, English first
+func Locales() []Locale {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]Locale, 0, len(catalogs))
+	for code, c := range catalogs {
+		list = append(list, Locale{Code: code, Name: c.Language})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Code == Source || list[j].Code == Source {
+			return list[i].Code == Source
+		}
+		return list[i].Code < list[j].Code
+	})
+	return list
+}
+
+// Supported reports whether there are translations for code
+func Supported(code string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := catalogs[code]
+	return ok
+}
+
+// Default returns the language of teams who haven't picked one and whose
+// browser asks for none we have
+func Default() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultLocale
+}
+
+// Match picks the language to use from an Accept-Language header, such as
+// "hi-IN,hi;q=0.9,en;q=0.8": the one with the highest weight we have,
+// matching "hi-IN" to "hi" when there is no "hi-in", or the default
+func Match(acceptLanguage string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+
+		base, _, _ := strings.Cut(tag, "-")
+		for _, code := range []string{tag, base} {
+			if Supported(code) {
+				best, bestQ = code, q
+				break
+			}
+		}
+	}
+	if best == "" {
+		return Default()
+	}
+	return best
+}
+
+type localeKey struct{}
+
+// WithLocale returns a context whose text is in the language code
+func WithLocale(ctx context.Context, code string) context.Context {
+	return context.WithValue(ctx, localeKey{}, code)
+}
+
+// FromContext returns the language of a context, or the default
+func FromContext(ctx context.Context) string {
+	if code, ok := ctx.Value(localeKey{}).(string); ok {
+		return code
+	}
+	return Default()
+}
+
+// T translates msg into the language of ctx. With args, the translation is
+// a format for them, as with fmt.Sprintf
+func T(ctx context.Context, msg string, args ...any) string {
+	code := FromContext(ctx)
+	mu.RLock()
+	if t, ok := catalogs[code].Messages[msg]; ok && t != "" {
+		msg = t
+	}
+	mu.RUnlock()
+
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
@@ -0,0 +1,35 @@
+// Package public holds the static assets served under /static. They are
+// embedded so the server ships as a single binary; public/app.css has to be
+// built before the binary for the styles to be included
+package public
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path"
+)
+
+//go:embed *
+var files embed.FS
+
+// FS returns the assets. When dir is set they are read from disk instead,
+// so edits in development show up without a rebuild
+func FS(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	return assets{files}
+}
+
+// assets hides this package's source among the embedded files
+type assets struct {
+	embed.FS
+}
+
+func (a assets) Open(name string) (fs.File, error) {
+	if path.Ext(name) == ".go" {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return a.FS.Open(name)
+}
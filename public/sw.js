@@ -0,0 +1,22 @@
+// Service worker for Web Push notifications
+self.addEventListener('push', (event) => {
+	let payload = {};
+	try {
+		payload = event.data ? event.data.json() : {};
+	} catch (e) {
+		payload = { title: event.data.text() };
+	}
+
+	event.waitUntil(self.registration.showNotification(payload.title || 'Cryptic Hunt', {
+		body: payload.body || '',
+		icon: '/static/favicon.png',
+		tag: payload.tag || undefined,
+		data: { link: payload.link || '/hunt/notifications' },
+	}));
+});
+
+self.addEventListener('notificationclick', (event) => {
+	event.notification.close();
+	const link = event.notification.data && event.notification.data.link;
+	event.waitUntil(self.clients.openWindow(link || '/hunt'));
+});
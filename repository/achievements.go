@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TeamAchievement is a badge a team earned, with the solve that earned it
+type TeamAchievement struct {
+	TeamID      int
+	TeamName    string
+	Achievement string
+	QuestionID  int
+	AwardedAt   time.Time
+}
+
+// AwardAchievement records that a team earned a badge, reporting false if
+// it already had it
+func (q *Queries) AwardAchievement(ctx context.Context, teamID int, achievement string, questionID int, at time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `INSERT OR IGNORE INTO team_achievements (team_id, achievement, question_id, awarded_at) VALUES (?, ?, ?, ?)`,
+		teamID, achievement, questionID, at)
+	return n > 0, err
+}
+
+// ListTeamAchievements returns the badges a team earned, oldest first
+func (q *Queries) ListTeamAchievements(ctx context.Context, teamID int) ([]TeamAchievement, error) {
+	return collect(q, ctx, func(rows *sql.Rows, a *TeamAchievement) error {
+		return rows.Scan(&a.TeamID, &a.Achievement, &a.QuestionID, &a.AwardedAt)
+	}, `SELECT team_id, achievement, question_id, awarded_at
+		FROM team_achievements
+		WHERE team_id = ?
+		ORDER BY awarded_at ASC, id ASC`, teamID)
+}
+
+// ListHuntAchievements returns the badges every team of a hunt earned
+func (q *Queries) ListHuntAchievements(ctx context.Context, huntID int) ([]TeamAchievement, error) {
+	return collect(q, ctx, func(rows *sql.Rows, a *TeamAchievement) error {
+		return rows.Scan(&a.TeamID, &a.TeamName, &a.Achievement, &a.QuestionID, &a.AwardedAt)
+	}, `SELECT ta.team_id, t.name, ta.achievement, ta.question_id, ta.awarded_at
+		FROM team_achievements ta
+		JOIN teams t ON t.id = ta.team_id
+		WHERE t.hunt_id = ?
+		ORDER BY ta.awarded_at ASC, ta.id ASC`, huntID)
+}
+
+// GetFirstSolver returns the team that solved a question first, leaving
+// out solves waiting for review, or sql.ErrNoRows
+func (q *Queries) GetFirstSolver(ctx context.Context, questionID int) (int, error) {
+	var teamID int
+	err := q.queryRow(ctx, `SELECT tcq.team_id FROM team_completed_questions tcq
+		WHERE tcq.question_id = ? AND `+notPendingReview+`
+		ORDER BY tcq.completed_at ASC, tcq.team_id ASC
+		LIMIT 1`, questionID).Scan(&teamID)
+	return teamID, err
+}
+
+// ListRecentResults returns whether each of a team's last n answers was
+// correct, newest first
+func (q *Queries) ListRecentResults(ctx context.Context, teamID, n int) ([]bool, error) {
+	return collect(q, ctx, func(rows *sql.Rows, correct *bool) error {
+		return rows.Scan(correct)
+	}, `SELECT correct FROM submissions
+		WHERE team_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?`, teamID, n)
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Alert is something about a team that an admin should look at, such as
+// a flag that looks to be shared. TeamID is the team it is about and
+// OtherTeamID the team it involves, if any; either is 0 when not known.
+// Subject is what else it is about, such as an IP address
+type Alert struct {
+	ID            int        `json:"id"`
+	HuntID        int        `json:"hunt_id"`
+	Kind          string     `json:"kind"`
+	TeamID        int        `json:"team_id"`
+	TeamName      string     `json:"team_name"`
+	OtherTeamID   int        `json:"other_team_id"`
+	OtherTeamName string     `json:"other_team_name"`
+	QuestionID    int        `json:"question_id"`
+	QuestionTitle string     `json:"question_title"`
+	Subject       string     `json:"subject"`
+	Detail        string     `json:"detail"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
+}
+
+// CreateAlert inserts an alert and returns its ID
+func (q *Queries) CreateAlert(ctx context.Context, a Alert) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO alerts (hunt_id, kind, team_id, other_team_id, question_id, subject, detail, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		a.HuntID, a.Kind, a.TeamID, a.OtherTeamID, a.QuestionID, a.Subject, a.Detail, a.CreatedAt).Scan(&id)
+	return id, err
+}
+
+// HasOpenAlert reports whether an unresolved alert of a kind already
+// covers the hunt, teams, question and subject of a
+func (q *Queries) HasOpenAlert(ctx context.Context, a Alert) (bool, error) {
+	n, err := q.count(ctx, `SELECT COUNT(*) FROM alerts
+		WHERE hunt_id = ? AND kind = ? AND team_id = ? AND other_team_id = ? AND question_id = ? AND subject = ? AND resolved_at IS NULL`,
+		a.HuntID, a.Kind, a.TeamID, a.OtherTeamID, a.QuestionID, a.Subject)
+	return n > 0, err
+}
+
+// ListAlerts returns the alerts of a hunt, newest first, leaving out the
+// resolved ones unless resolved is set
+func (q *Queries) ListAlerts(ctx context.Context, huntID int, resolved bool) ([]Alert, error) {
+	where := `a.hunt_id = ?`
+	if !resolved {
+		where += ` AND a.resolved_at IS NULL`
+	}
+	return collect(q, ctx, func(rows *sql.Rows, a *Alert) error {
+		var resolvedAt sql.NullTime
+		err := rows.Scan(&a.ID, &a.HuntID, &a.Kind, &a.TeamID, &a.TeamName, &a.OtherTeamID, &a.OtherTeamName,
+			&a.QuestionID, &a.QuestionTitle, &a.Subject, &a.Detail, &a.CreatedAt, &resolvedAt)
+		a.ResolvedAt = timePtr(resolvedAt)
+		return err
+	}, `SELECT a.id, a.hunt_id, a.kind, a.team_id, COALESCE(t.name, ''), a.other_team_id, COALESCE(o.name, ''),
+			a.question_id, COALESCE(qn.title, ''), a.subject, a.detail, a.created_at, a.resolved_at
+		FROM alerts a
+		LEFT JOIN teams t ON t.id = a.team_id
+		LEFT JOIN teams o ON o.id = a.other_team_id
+		LEFT JOIN questions qn ON qn.id = a.question_id
+		WHERE `+where+`
+		ORDER BY a.created_at DESC, a.id DESC`, huntID)
+}
+
+// ResolveAlert marks an alert as dealt with, reporting whether it was open
+func (q *Queries) ResolveAlert(ctx context.Context, id int, at time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE alerts SET resolved_at = ? WHERE id = ? AND resolved_at IS NULL`, at, id)
+	return n > 0, err
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Announcement is a row of announcements. Pinned ones are listed first,
+// and public ones are shown to visitors who aren't signed in
+type Announcement struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	Link      string    `json:"link"`
+	Pinned    bool      `json:"pinned"`
+	Public    bool      `json:"public"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const announcementColumns = `id, title, message, link, pinned, public, created_at`
+
+func scanAnnouncement(rows *sql.Rows, a *Announcement) error {
+	return rows.Scan(&a.ID, &a.Title, &a.Message, &a.Link, &a.Pinned, &a.Public, &a.CreatedAt)
+}
+
+// CreateAnnouncement inserts an announcement and returns its ID
+func (q *Queries) CreateAnnouncement(ctx context.Context, a Announcement) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO announcements (title, message, link, pinned, public, created_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id`, a.Title, a.Message, a.Link, a.Pinned, a.Public, a.CreatedAt).Scan(&id)
+	return id, err
+}
+
+// ListAnnouncements returns the announcements, only the public ones with
+// publicOnly, pinned first and then newest first
+func (q *Queries) ListAnnouncements(ctx context.Context, publicOnly bool) ([]Announcement, error) {
+	query := `SELECT ` + announcementColumns + ` FROM announcements`
+	var args []interface{}
+	if publicOnly {
+		query += ` WHERE public = ?`
+		args = append(args, true)
+	}
+	query += ` ORDER BY pinned DESC, created_at DESC, id DESC`
+	return collect(q, ctx, scanAnnouncement, query, args...)
+}
+
+// SetAnnouncementFlags pins and publishes an announcement, reporting
+// whether it exists
+func (q *Queries) SetAnnouncementFlags(ctx context.Context, id int, pinned, public bool) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE announcements SET pinned = ?, public = ? WHERE id = ?`, pinned, public, id)
+	return n > 0, err
+}
+
+// DeleteAnnouncement deletes an announcement
+func (q *Queries) DeleteAnnouncement(ctx context.Context, id int) error {
+	_, err := q.exec(ctx, `DELETE FROM announcements WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AdminAPIToken is a bearer token for the admin REST API
+// Only the token's hash is stored
+type AdminAPIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAdminAPIToken inserts a token by its hash
+func (q *Queries) CreateAdminAPIToken(ctx context.Context, name, tokenHash string, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO admin_api_tokens (name, token_hash, created_at) VALUES (?, ?, ?)`, name, tokenHash, at)
+	return err
+}
+
+// ListAdminAPITokens returns every token, newest first
+func (q *Queries) ListAdminAPITokens(ctx context.Context) ([]AdminAPIToken, error) {
+	return collect(q, ctx, func(rows *sql.Rows, t *AdminAPIToken) error {
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &lastUsed, &t.CreatedAt); err != nil {
+			return err
+		}
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		return nil
+	}, `SELECT id, name, last_used_at, created_at FROM admin_api_tokens ORDER BY id DESC`)
+}
+
+// DeleteAdminAPIToken revokes a token
+func (q *Queries) DeleteAdminAPIToken(ctx context.Context, id int) error {
+	_, err := q.exec(ctx, `DELETE FROM admin_api_tokens WHERE id = ?`, id)
+	return err
+}
+
+// TouchAdminAPIToken records a use of the token with a hash, reporting
+// whether such a token exists
+func (q *Queries) TouchAdminAPIToken(ctx context.Context, tokenHash string, at time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE admin_api_tokens SET last_used_at = ? WHERE token_hash = ?`, at, tokenHash)
+	return n > 0, err
+}
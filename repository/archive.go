@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// The rows of a hunt written to its archive and read back when importing
+// one. Teams carry their password hashes so a full restore lets them log
+// in again
+
+// ArchiveTeam is a row of teams as archived
+type ArchiveTeam struct {
+	ID           int        `json:"id"`
+	Email        string     `json:"email"`
+	Password     string     `json:"password"`
+	Name         string     `json:"name"`
+	Points       int        `json:"points"`
+	LastAnswered *time.Time `json:"last_answered_question"`
+	StartedAt    *time.Time `json:"started_at"`
+	CreatedAt    *time.Time `json:"created_at"`
+}
+
+// ArchiveSolve is a row of team_completed_questions. Points is missing
+// from archives made before solves kept them
+type ArchiveSolve struct {
+	TeamID      int        `json:"team_id"`
+	QuestionID  int        `json:"question_id"`
+	Points      *int       `json:"points,omitempty"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// ArchiveHintUnlock is a row of team_hint_unlocked
+type ArchiveHintUnlock struct {
+	TeamID     int        `json:"team_id"`
+	HintID     int        `json:"hint_id"`
+	UnlockedAt *time.Time `json:"unlocked_at"`
+}
+
+// ArchiveTimer is a row of question_timers
+type ArchiveTimer struct {
+	TeamID           int        `json:"team_id"`
+	QuestionID       int        `json:"question_id"`
+	StartedAt        *time.Time `json:"started_at"`
+	CompletedAt      *time.Time `json:"completed_at"`
+	TimeTakenSeconds *int       `json:"time_taken_seconds"`
+}
+
+// timePtr turns a nullable time into nil or its value
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// ListArchiveQuestions returns every question of a hunt with its text,
+// answer hash and solution
+func (q *Queries) ListArchiveQuestions(ctx context.Context, huntID int) ([]Question, error) {
+	return collect(q, ctx, func(rows *sql.Rows, qn *Question) error {
+		return rows.Scan(&qn.ID, &qn.Question, &qn.Answer, &qn.Title, &qn.Points, &qn.HuntID, &qn.RevealAnswer, &qn.Solution, &qn.FlagTemplate, &qn.Cooldown, &qn.AnswerType, &qn.Category)
+	}, `SELECT id, question, answer, title, points, hunt_id, reveal_answer, solution, flag_template, cooldown_seconds, answer_type, category FROM questions WHERE hunt_id = ? ORDER BY id`, huntID)
+}
+
+// ListArchiveTeams returns every team of a hunt with its password hash
+func (q *Queries) ListArchiveTeams(ctx context.Context, huntID int) ([]ArchiveTeam, error) {
+	return collect(q, ctx, func(rows *sql.Rows, t *ArchiveTeam) error {
+		var last, started, created sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Email, &t.Password, &t.Name, &t.Points, &last, &started, &created); err != nil {
+			return err
+		}
+		t.LastAnswered, t.StartedAt, t.CreatedAt = timePtr(last), timePtr(started), timePtr(created)
+		return nil
+	}, `SELECT id, email, password, name, points, last_answered_question, started_at, created_at
+		FROM teams WHERE hunt_id = ? ORDER BY id`, huntID)
+}
+
+// ListArchiveSolves returns every solve by the teams of a hunt
+func (q *Queries) ListArchiveSolves(ctx context.Context, huntID int) ([]ArchiveSolve, error) {
+	return collect(q, ctx, func(rows *sql.Rows, s *ArchiveSolve) error {
+		var at sql.NullTime
+		var points int
+		if err := rows.Scan(&s.TeamID, &s.QuestionID, &points, &at); err != nil {
+			return err
+		}
+		s.Points, s.CompletedAt = &points, timePtr(at)
+		return nil
+	}, `SELECT tcq.team_id, tcq.question_id, tcq.points, tcq.completed_at
+		FROM team_completed_questions tcq
+		JOIN teams t ON t.id = tcq.team_id
+		WHERE t.hunt_id = ?
+		ORDER BY tcq.completed_at, tcq.team_id`, huntID)
+}
+
+// ListArchiveHintUnlocks returns every hint bought by the teams of a hunt
+func (q *Queries) ListArchiveHintUnlocks(ctx context.Context, huntID int) ([]ArchiveHintUnlock, error) {
+	return collect(q, ctx, func(rows *sql.Rows, u *ArchiveHintUnlock) error {
+		var at sql.NullTime
+		if err := rows.Scan(&u.TeamID, &u.HintID, &at); err != nil {
+			return err
+		}
+		u.UnlockedAt = timePtr(at)
+		return nil
+	}, `SELECT thu.team_id, thu.hint_id, thu.unlocked_at
+		FROM team_hint_unlocked thu
+		JOIN teams t ON t.id = thu.team_id
+		WHERE t.hunt_id = ?
+		ORDER BY thu.unlocked_at, thu.team_id`, huntID)
+}
+
+// ListArchiveTimers returns every question timer of the teams of a hunt
+func (q *Queries) ListArchiveTimers(ctx context.Context, huntID int) ([]ArchiveTimer, error) {
+	return collect(q, ctx, func(rows *sql.Rows, tm *ArchiveTimer) error {
+		var started, completed sql.NullTime
+		var seconds sql.NullInt64
+		if err := rows.Scan(&tm.TeamID, &tm.QuestionID, &started, &completed, &seconds); err != nil {
+			return err
+		}
+		tm.StartedAt, tm.CompletedAt = timePtr(started), timePtr(completed)
+		if seconds.Valid {
+			s := int(seconds.Int64)
+			tm.TimeTakenSeconds = &s
+		}
+		return nil
+	}, `SELECT qt.team_id, qt.question_id, qt.started_at, qt.completed_at, qt.time_taken_seconds
+		FROM question_timers qt
+		JOIN teams t ON t.id = qt.team_id
+		WHERE t.hunt_id = ?
+		ORDER BY qt.team_id, qt.question_id`, huntID)
+}
+
+// ListArchiveAttempts returns the wrong answers of every team of a hunt
+func (q *Queries) ListArchiveAttempts(ctx context.Context, huntID int) ([]QuestionAttempt, error) {
+	return collect(q, ctx, func(rows *sql.Rows, a *QuestionAttempt) error {
+		return rows.Scan(&a.TeamID, &a.QuestionID, &a.WrongAttempts, &a.TotalPenalty, &a.LastAttemptAt)
+	}, `SELECT qa.team_id, qa.question_id, qa.wrong_attempts, qa.total_penalty, qa.last_attempt_at
+		FROM question_attempts qa
+		JOIN teams t ON t.id = qa.team_id
+		WHERE t.hunt_id = ?
+		ORDER BY qa.team_id, qa.question_id`, huntID)
+}
+
+// ListArchiveTeamFlags returns the flag tokens of every team of a hunt
+func (q *Queries) ListArchiveTeamFlags(ctx context.Context, huntID int) ([]TeamFlag, error) {
+	return collect(q, ctx, func(rows *sql.Rows, f *TeamFlag) error {
+		return rows.Scan(&f.TeamID, &f.QuestionID, &f.Token, &f.CreatedAt)
+	}, `SELECT f.team_id, f.question_id, f.token, f.created_at
+		FROM team_flags f
+		JOIN teams t ON t.id = f.team_id
+		WHERE t.hunt_id = ?
+		ORDER BY f.team_id, f.question_id`, huntID)
+}
+
+// ListArchiveSubmissions returns every answer the teams of a hunt
+// submitted, oldest first
+func (q *Queries) ListArchiveSubmissions(ctx context.Context, huntID int) ([]Submission, error) {
+	return collect(q, ctx, func(rows *sql.Rows, s *Submission) error {
+		return rows.Scan(&s.ID, &s.TeamID, &s.QuestionID, &s.AnswerHash, &s.Answer, &s.Correct, &s.Penalty, &s.IP, &s.CreatedAt)
+	}, `SELECT s.id, s.team_id, s.question_id, s.answer_hash, s.answer, s.correct, s.penalty, s.ip, s.created_at
+		FROM submissions s
+		JOIN teams t ON t.id = s.team_id
+		WHERE t.hunt_id = ?
+		ORDER BY s.created_at, s.id`, huntID)
+}
+
+// ListAllResults returns every standing saved for a hunt, by hunt end and
+// place
+func (q *Queries) ListAllResults(ctx context.Context, huntID int) ([]HuntResult, error) {
+	return collect(q, ctx, func(rows *sql.Rows, r *HuntResult) error {
+		return rows.Scan(&r.HuntID, &r.HuntEnd, &r.Place, &r.TeamName, &r.Points, &r.QuestionsSolved, &r.TotalTimeSeconds, &r.TotalPenalty, &r.NetScore)
+	}, `SELECT hunt_id, hunt_end, place, team_name, points, questions_solved, total_time_seconds, total_penalty, net_score
+		FROM hunt_results WHERE hunt_id = ? ORDER BY hunt_end, place`, huntID)
+}
+
+// InsertArchiveTeam inserts an archived team into a hunt as it was and
+// returns its new ID
+func (q *Queries) InsertArchiveTeam(ctx context.Context, huntID int, t ArchiveTeam) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO teams (email, password, name, points, hunt_id, last_answered_question, started_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		t.Email, t.Password, t.Name, t.Points, huntID, t.LastAnswered, t.StartedAt, t.CreatedAt).Scan(&id)
+	return id, err
+}
+
+// InsertArchiveMedia inserts an archived row of a media table at its
+// position
+func (q *Queries) InsertArchiveMedia(ctx context.Context, table string, questionID, position int, path, name, caption string) error {
+	if err := checkMediaTable(table); err != nil {
+		return err
+	}
+	if table == "files" {
+		_, err := q.exec(ctx, `INSERT INTO files (path, name, parent_question_id, position, caption) VALUES (?, ?, ?, ?, ?)`,
+			path, name, questionID, position, caption)
+		return err
+	}
+	_, err := q.exec(ctx, fmt.Sprintf(`INSERT INTO %s (path, parent_question_id, position, caption) VALUES (?, ?, ?, ?)`, table),
+		path, questionID, position, caption)
+	return err
+}
+
+// InsertArchiveSolve inserts an archived solve, worth the whole question
+// when the archive doesn't say
+func (q *Queries) InsertArchiveSolve(ctx context.Context, s ArchiveSolve) error {
+	_, err := q.exec(ctx, `INSERT INTO team_completed_questions (team_id, question_id, points, completed_at)
+		VALUES (?, ?, COALESCE(?, (SELECT points FROM questions WHERE id = ?)), ?)`,
+		s.TeamID, s.QuestionID, s.Points, s.QuestionID, s.CompletedAt)
+	return err
+}
+
+// InsertArchiveHintUnlock inserts an archived hint purchase
+func (q *Queries) InsertArchiveHintUnlock(ctx context.Context, u ArchiveHintUnlock) error {
+	_, err := q.exec(ctx, `INSERT INTO team_hint_unlocked (team_id, hint_id, unlocked_at) VALUES (?, ?, ?)`,
+		u.TeamID, u.HintID, u.UnlockedAt)
+	return err
+}
+
+// InsertArchiveTimer inserts an archived question timer
+func (q *Queries) InsertArchiveTimer(ctx context.Context, tm ArchiveTimer) error {
+	_, err := q.exec(ctx, `INSERT INTO question_timers (team_id, question_id, started_at, completed_at, time_taken_seconds) VALUES (?, ?, ?, ?, ?)`,
+		tm.TeamID, tm.QuestionID, tm.StartedAt, tm.CompletedAt, tm.TimeTakenSeconds)
+	return err
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// QuestionAttempt is a team's wrong answers to a question and the penalty
+// they cost, with the extra attempts and penalty shields it spent on the
+// question
+type QuestionAttempt struct {
+	TeamID        int       `json:"team_id"`
+	QuestionID    int       `json:"question_id"`
+	WrongAttempts int       `json:"wrong_attempts"`
+	TotalPenalty  int       `json:"total_penalty"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+	ExtraAttempts int       `json:"extra_attempts"`
+	Shields       int       `json:"shields"`
+}
+
+// GetAttempt returns a team's attempts at a question, or sql.ErrNoRows
+// before the first wrong answer
+func (q *Queries) GetAttempt(ctx context.Context, teamID, questionID int) (QuestionAttempt, error) {
+	var a QuestionAttempt
+	err := q.queryRow(ctx, `SELECT team_id, question_id, wrong_attempts, total_penalty, last_attempt_at, extra_attempts, shields
+		FROM question_attempts WHERE team_id = ? AND question_id = ?`, teamID, questionID).
+		Scan(&a.TeamID, &a.QuestionID, &a.WrongAttempts, &a.TotalPenalty, &a.LastAttemptAt, &a.ExtraAttempts, &a.Shields)
+	return a, err
+}
+
+// SaveAttempt inserts or overwrites a team's attempts at a question,
+// leaving its extra attempts and shields alone
+func (q *Queries) SaveAttempt(ctx context.Context, a QuestionAttempt) error {
+	_, err := q.exec(ctx, `INSERT INTO question_attempts (team_id, question_id, wrong_attempts, total_penalty, last_attempt_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(team_id, question_id) DO UPDATE SET
+		wrong_attempts = ?,
+		total_penalty = ?,
+		last_attempt_at = ?`,
+		a.TeamID, a.QuestionID, a.WrongAttempts, a.TotalPenalty, a.LastAttemptAt,
+		a.WrongAttempts, a.TotalPenalty, a.LastAttemptAt)
+	return err
+}
+
+// AddExtraAttempt gives a team one more attempt at a question
+func (q *Queries) AddExtraAttempt(ctx context.Context, teamID, questionID int, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO question_attempts (team_id, question_id, wrong_attempts, total_penalty, last_attempt_at, extra_attempts)
+		VALUES (?, ?, 0, 0, ?, 1)
+		ON CONFLICT(team_id, question_id) DO UPDATE SET extra_attempts = question_attempts.extra_attempts + 1`,
+		teamID, questionID, at)
+	return err
+}
+
+// AddShield shields a team's next penalty on a question
+func (q *Queries) AddShield(ctx context.Context, teamID, questionID int, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO question_attempts (team_id, question_id, wrong_attempts, total_penalty, last_attempt_at, shields)
+		VALUES (?, ?, 0, 0, ?, 1)
+		ON CONFLICT(team_id, question_id) DO UPDATE SET shields = question_attempts.shields + 1`,
+		teamID, questionID, at)
+	return err
+}
+
+// UseShield spends one of a team's shields on a question, reporting false
+// when it has none left
+func (q *Queries) UseShield(ctx context.Context, teamID, questionID int) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE question_attempts SET shields = shields - 1
+		WHERE team_id = ? AND question_id = ? AND shields > 0`, teamID, questionID)
+	return n > 0, err
+}
+
+// SumPenalty adds up a team's penalties across all questions
+func (q *Queries) SumPenalty(ctx context.Context, teamID int) (int, error) {
+	return q.count(ctx, `SELECT COALESCE(SUM(total_penalty), 0) FROM question_attempts WHERE team_id = ?`, teamID)
+}
+
+// DeleteAttempt resets a team's attempts at a question
+func (q *Queries) DeleteAttempt(ctx context.Context, teamID, questionID int) error {
+	_, err := q.exec(ctx, `DELETE FROM question_attempts WHERE question_id = ? AND team_id = ?`, questionID, teamID)
+	return err
+}
+
+// DeleteUnsolvedAttempts resets the attempts at a question of every team
+// that hasn't solved it, returning how many went
+func (q *Queries) DeleteUnsolvedAttempts(ctx context.Context, questionID int) (int64, error) {
+	return q.execAffected(ctx, `DELETE FROM question_attempts
+		WHERE question_id = ?
+		AND team_id NOT IN (SELECT team_id FROM team_completed_questions WHERE question_id = ?)`, questionID, questionID)
+}
+
+// QuestionPenalty is what a team's wrong answers to a question cost
+type QuestionPenalty struct {
+	QuestionID    int       `json:"question_id"`
+	QuestionTitle string    `json:"question_title"`
+	WrongAttempts int       `json:"wrong_attempts"`
+	Penalty       int       `json:"penalty"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+}
+
+// ListTeamPenalties returns the questions a team lost points on, solved or
+// not, oldest wrong answer first
+func (q *Queries) ListTeamPenalties(ctx context.Context, teamID int) ([]QuestionPenalty, error) {
+	return collect(q, ctx, func(rows *sql.Rows, p *QuestionPenalty) error {
+		return rows.Scan(&p.QuestionID, &p.QuestionTitle, &p.WrongAttempts, &p.Penalty, &p.LastAttemptAt)
+	}, `SELECT q.id, q.title, qa.wrong_attempts, qa.total_penalty, qa.last_attempt_at
+		FROM question_attempts qa
+		JOIN questions q ON q.id = qa.question_id
+		WHERE qa.team_id = ? AND qa.total_penalty > 0
+		ORDER BY qa.last_attempt_at ASC, q.id ASC`, teamID)
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ChatMessage is a message in a hunt's shoutbox or a team's channel
+// Channel is 0 for the shoutbox or the ID of the team the channel belongs to
+type ChatMessage struct {
+	ID        int       `json:"id"`
+	HuntID    int       `json:"hunt_id"`
+	TeamID    int       `json:"team_id"`
+	TeamName  string    `json:"team_name"`
+	Channel   int       `json:"channel"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func scanChatMessage(rows *sql.Rows, m *ChatMessage) error {
+	return rows.Scan(&m.ID, &m.HuntID, &m.TeamID, &m.TeamName, &m.Channel, &m.Body, &m.CreatedAt)
+}
+
+// CreateChatMessage inserts a message and returns its ID
+func (q *Queries) CreateChatMessage(ctx context.Context, m ChatMessage) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO chat_messages (hunt_id, team_id, channel, body, created_at)
+		VALUES (?, ?, ?, ?, ?) RETURNING id`, m.HuntID, m.TeamID, m.Channel, m.Body, m.CreatedAt).Scan(&id)
+	return id, err
+}
+
+// ListChannelMessages returns the latest messages of a hunt's channel,
+// newest first
+func (q *Queries) ListChannelMessages(ctx context.Context, huntID, channel, limit int) ([]ChatMessage, error) {
+	return collect(q, ctx, scanChatMessage, `SELECT m.id, m.hunt_id, m.team_id, t.name, m.channel, m.body, m.created_at
+		FROM chat_messages m
+		JOIN teams t ON t.id = m.team_id
+		WHERE m.hunt_id = ? AND m.channel = ?
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ?`, huntID, channel, limit)
+}
+
+// ListRecentChatMessages returns the latest messages across all channels
+// of a hunt, newest first
+func (q *Queries) ListRecentChatMessages(ctx context.Context, huntID, limit int) ([]ChatMessage, error) {
+	return collect(q, ctx, scanChatMessage, `SELECT m.id, m.hunt_id, m.team_id, t.name, m.channel, m.body, m.created_at
+		FROM chat_messages m
+		JOIN teams t ON t.id = m.team_id
+		WHERE m.hunt_id = ?
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ?`, huntID, limit)
+}
+
+// GetChatMessage returns a message's ID, hunt, author and channel, or
+// sql.ErrNoRows
+func (q *Queries) GetChatMessage(ctx context.Context, id int) (ChatMessage, error) {
+	var m ChatMessage
+	err := q.queryRow(ctx, `SELECT id, hunt_id, team_id, channel FROM chat_messages WHERE id = ?`, id).Scan(&m.ID, &m.HuntID, &m.TeamID, &m.Channel)
+	return m, err
+}
+
+// DeleteChatMessage deletes a message
+func (q *Queries) DeleteChatMessage(ctx context.Context, id int) error {
+	_, err := q.exec(ctx, `DELETE FROM chat_messages WHERE id = ?`, id)
+	return err
+}
+
+// MuteTeam stops a team posting; muting twice is a no-op
+func (q *Queries) MuteTeam(ctx context.Context, teamID int, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT OR IGNORE INTO chat_mutes (team_id, muted_at) VALUES (?, ?)`, teamID, at)
+	return err
+}
+
+// UnmuteTeam lets a team post again
+func (q *Queries) UnmuteTeam(ctx context.Context, teamID int) error {
+	_, err := q.exec(ctx, `DELETE FROM chat_mutes WHERE team_id = ?`, teamID)
+	return err
+}
+
+// IsTeamMuted reports whether a team is muted
+func (q *Queries) IsTeamMuted(ctx context.Context, teamID int) (bool, error) {
+	n, err := q.count(ctx, `SELECT COUNT(*) FROM chat_mutes WHERE team_id = ?`, teamID)
+	return n > 0, err
+}
+
+// ListMutedTeams returns the IDs of all muted teams
+func (q *Queries) ListMutedTeams(ctx context.Context) ([]int, error) {
+	return collect(q, ctx, scanInt, `SELECT team_id FROM chat_mutes`)
+}
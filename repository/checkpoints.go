@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Checkpoint is a question opened or solved by scanning a QR code at a
+// physical location. Its codes are signed with Secret, and made for each
+// team when PerTeam is set
+type Checkpoint struct {
+	QuestionID    int       `json:"question_id"`
+	QuestionTitle string    `json:"question_title"`
+	HuntID        int       `json:"hunt_id"`
+	Points        int       `json:"points"`
+	Mode          string    `json:"mode"`
+	PerTeam       bool      `json:"per_team"`
+	Secret        string    `json:"-"`
+	Scans         int       `json:"scans"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// CheckpointScan is when a team scanned a checkpoint's code
+type CheckpointScan struct {
+	TeamID    int       `json:"team_id"`
+	TeamName  string    `json:"team_name"`
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+func scanCheckpoint(rows *sql.Rows, cp *Checkpoint) error {
+	var updated sql.NullTime
+	err := rows.Scan(&cp.QuestionID, &cp.QuestionTitle, &cp.HuntID, &cp.Points, &cp.Mode, &cp.PerTeam, &cp.Secret, &cp.Scans, &updated)
+	cp.UpdatedAt = updated.Time
+	return err
+}
+
+const checkpointColumns = `SELECT c.question_id, q.title, q.hunt_id, q.points, c.mode, c.per_team, c.secret,
+		(SELECT COUNT(*) FROM checkpoint_scans s WHERE s.question_id = c.question_id),
+		c.updated_at
+		FROM question_checkpoints c
+		JOIN questions q ON q.id = c.question_id`
+
+// SetCheckpoint makes a question a checkpoint or changes how it works; a
+// question that already is one keeps its secret, so printed codes still
+// work
+func (q *Queries) SetCheckpoint(ctx context.Context, questionID int, mode string, perTeam bool, secret string, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO question_checkpoints (question_id, mode, per_team, secret, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (question_id) DO UPDATE SET mode = excluded.mode, per_team = excluded.per_team, updated_at = excluded.updated_at`,
+		questionID, mode, perTeam, secret, at)
+	return err
+}
+
+// SetCheckpointSecret replaces the secret of a checkpoint, so codes made
+// before stop working, reporting whether it is one
+func (q *Queries) SetCheckpointSecret(ctx context.Context, questionID int, secret string, at time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE question_checkpoints SET secret = ?, updated_at = ? WHERE question_id = ?`, secret, at, questionID)
+	return n > 0, err
+}
+
+// DeleteCheckpoint turns a checkpoint back into an ordinary question,
+// forgetting who scanned it
+func (q *Queries) DeleteCheckpoint(ctx context.Context, questionID int) error {
+	if _, err := q.exec(ctx, `DELETE FROM checkpoint_scans WHERE question_id = ?`, questionID); err != nil {
+		return err
+	}
+	_, err := q.exec(ctx, `DELETE FROM question_checkpoints WHERE question_id = ?`, questionID)
+	return err
+}
+
+// GetCheckpoint returns the checkpoint of a question, or sql.ErrNoRows
+func (q *Queries) GetCheckpoint(ctx context.Context, questionID int) (Checkpoint, error) {
+	list, err := collect(q, ctx, scanCheckpoint, checkpointColumns+` WHERE c.question_id = ?`, questionID)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if len(list) == 0 {
+		return Checkpoint{}, sql.ErrNoRows
+	}
+	return list[0], nil
+}
+
+// ListCheckpoints returns the checkpoints of a hunt, cheapest question
+// first like the hunt page
+func (q *Queries) ListCheckpoints(ctx context.Context, huntID int) ([]Checkpoint, error) {
+	return collect(q, ctx, scanCheckpoint, checkpointColumns+` WHERE q.hunt_id = ? ORDER BY q.points, q.id`, huntID)
+}
+
+// RecordCheckpointScan records that a team scanned a checkpoint's code,
+// reporting false if it already had
+func (q *Queries) RecordCheckpointScan(ctx context.Context, teamID, questionID int, at time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `INSERT INTO checkpoint_scans (team_id, question_id, scanned_at) VALUES (?, ?, ?)
+		ON CONFLICT (team_id, question_id) DO NOTHING`, teamID, questionID, at)
+	return n > 0, err
+}
+
+// IsCheckpointScanned reports whether a team scanned a checkpoint's code
+func (q *Queries) IsCheckpointScanned(ctx context.Context, teamID, questionID int) (bool, error) {
+	n, err := q.count(ctx, `SELECT COUNT(*) FROM checkpoint_scans WHERE team_id = ? AND question_id = ?`, teamID, questionID)
+	return n > 0, err
+}
+
+// ListCheckpointScans returns the teams that scanned a checkpoint's code,
+// first scan first
+func (q *Queries) ListCheckpointScans(ctx context.Context, questionID int) ([]CheckpointScan, error) {
+	return collect(q, ctx, func(rows *sql.Rows, s *CheckpointScan) error {
+		return rows.Scan(&s.TeamID, &s.TeamName, &s.ScannedAt)
+	}, `SELECT s.team_id, COALESCE(t.name, ''), s.scanned_at
+		FROM checkpoint_scans s
+		LEFT JOIN teams t ON t.id = s.team_id
+		WHERE s.question_id = ?
+		ORDER BY s.scanned_at, s.id`, questionID)
+}
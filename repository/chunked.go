@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ChunkedUpload is a resumable upload in progress
+type ChunkedUpload struct {
+	ID         string    `json:"id"`
+	QuestionID int       `json:"question_id"`
+	Kind       string    `json:"kind"`
+	Filename   string    `json:"filename"`
+	Size       int64     `json:"size"`
+	Received   int64     `json:"received"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreateChunkedUpload inserts an upload with nothing received
+func (q *Queries) CreateChunkedUpload(ctx context.Context, u ChunkedUpload) error {
+	_, err := q.exec(ctx, `INSERT INTO chunked_uploads (id, question_id, kind, filename, size, received, created_at) VALUES (?, ?, ?, ?, ?, 0, ?)`,
+		u.ID, u.QuestionID, u.Kind, u.Filename, u.Size, u.CreatedAt)
+	return err
+}
+
+// GetChunkedUpload returns an upload, or sql.ErrNoRows
+func (q *Queries) GetChunkedUpload(ctx context.Context, id string) (ChunkedUpload, error) {
+	var u ChunkedUpload
+	err := q.queryRow(ctx, `SELECT id, question_id, kind, filename, size, received, created_at FROM chunked_uploads WHERE id = ?`, id).
+		Scan(&u.ID, &u.QuestionID, &u.Kind, &u.Filename, &u.Size, &u.Received, &u.CreatedAt)
+	return u, err
+}
+
+// SetChunkedUploadReceived records how many bytes of an upload arrived
+func (q *Queries) SetChunkedUploadReceived(ctx context.Context, id string, received int64) error {
+	_, err := q.exec(ctx, `UPDATE chunked_uploads SET received = ? WHERE id = ?`, received, id)
+	return err
+}
+
+// DeleteChunkedUpload deletes an upload
+func (q *Queries) DeleteChunkedUpload(ctx context.Context, id string) error {
+	_, err := q.exec(ctx, `DELETE FROM chunked_uploads WHERE id = ?`, id)
+	return err
+}
+
+// ListChunkedUploadsBefore returns the IDs of uploads started before cutoff
+func (q *Queries) ListChunkedUploadsBefore(ctx context.Context, cutoff time.Time) ([]string, error) {
+	return collect(q, ctx, func(rows *sql.Rows, id *string) error {
+		return rows.Scan(id)
+	}, `SELECT id FROM chunked_uploads WHERE created_at < ?`, cutoff)
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Clarification is a row of clarifications: something a team asked about
+// a question, with the admins' answer once there is one. A public answer
+// is shown to every team
+type Clarification struct {
+	ID            int        `json:"id"`
+	TeamID        int        `json:"team_id"`
+	TeamName      string     `json:"team_name"`
+	QuestionID    int        `json:"question_id"`
+	QuestionTitle string     `json:"question_title"`
+	Body          string     `json:"body"`
+	Answer        string     `json:"answer"`
+	Public        bool       `json:"public"`
+	CreatedAt     time.Time  `json:"created_at"`
+	AnsweredAt    *time.Time `json:"answered_at"`
+}
+
+const clarificationColumns = `c.id, c.team_id, COALESCE(t.name, ''), c.question_id, COALESCE(qn.title, ''),
+		c.body, c.answer, c.public, c.created_at, c.answered_at
+		FROM clarifications c
+		LEFT JOIN teams t ON t.id = c.team_id
+		LEFT JOIN questions qn ON qn.id = c.question_id`
+
+func scanClarification(rows *sql.Rows, c *Clarification) error {
+	var answeredAt sql.NullTime
+	err := rows.Scan(&c.ID, &c.TeamID, &c.TeamName, &c.QuestionID, &c.QuestionTitle,
+		&c.Body, &c.Answer, &c.Public, &c.CreatedAt, &answeredAt)
+	c.AnsweredAt = timePtr(answeredAt)
+	return err
+}
+
+// CreateClarification inserts a team's request and returns its ID
+func (q *Queries) CreateClarification(ctx context.Context, teamID, questionID int, body string, at time.Time) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO clarifications (team_id, question_id, body, created_at)
+		VALUES (?, ?, ?, ?) RETURNING id`, teamID, questionID, body, at).Scan(&id)
+	return id, err
+}
+
+// GetClarification returns a clarification, or sql.ErrNoRows
+func (q *Queries) GetClarification(ctx context.Context, id int) (Clarification, error) {
+	list, err := collect(q, ctx, scanClarification, `SELECT `+clarificationColumns+` WHERE c.id = ?`, id)
+	if err != nil {
+		return Clarification{}, err
+	}
+	if len(list) == 0 {
+		return Clarification{}, sql.ErrNoRows
+	}
+	return list[0], nil
+}
+
+// ListQuestionClarifications returns what a team may read about a
+// question: its own requests and every published answer, oldest first
+func (q *Queries) ListQuestionClarifications(ctx context.Context, teamID, questionID int) ([]Clarification, error) {
+	return collect(q, ctx, scanClarification, `SELECT `+clarificationColumns+`
+		WHERE c.question_id = ? AND (c.team_id = ? OR c.public = ?)
+		ORDER BY c.created_at ASC, c.id ASC`, questionID, teamID, true)
+}
+
+// ListClarifications returns the clarifications on the questions of a
+// hunt, the oldest unanswered first, leaving out the answered ones unless
+// answered is set
+func (q *Queries) ListClarifications(ctx context.Context, huntID int, answered bool) ([]Clarification, error) {
+	where := `qn.hunt_id = ?`
+	if !answered {
+		where += ` AND c.answered_at IS NULL`
+	}
+	return collect(q, ctx, scanClarification, `SELECT `+clarificationColumns+`
+		WHERE `+where+`
+		ORDER BY CASE WHEN c.answered_at IS NULL THEN 0 ELSE 1 END, c.created_at ASC, c.id ASC`, huntID)
+}
+
+// AnswerClarification stores the admins' answer, replacing an earlier
+// one, and reports whether the clarification exists
+func (q *Queries) AnswerClarification(ctx context.Context, id int, answer string, public bool, at time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE clarifications SET answer = ?, public = ?, answered_at = ? WHERE id = ?`, answer, public, at, id)
+	return n > 0, err
+}
@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/namishh/holmes/database"
+)
+
+// SolvedQuestion is one team's solve of a question. Points is what the
+// solve earned, less than QuestionPoints for partial credit
+type SolvedQuestion struct {
+	QuestionID     int    `json:"question_id"`
+	QuestionTitle  string `json:"question_title"`
+	Points         int    `json:"points"`
+	QuestionPoints int    `json:"question_points"`
+	SolvedByTeam   string `json:"solved_by_team"`
+	TeamID         int    `json:"team_id"`
+	SolvedAt       string `json:"solved_at"`
+}
+
+// TeamSolve is a question a team solved, with the points and streak bonus
+// it earned, how long it took and what its wrong answers cost
+type TeamSolve struct {
+	QuestionID       int        `json:"question_id"`
+	QuestionTitle    string     `json:"question_title"`
+	Points           int        `json:"points"`
+	QuestionPoints   int        `json:"question_points"`
+	Bonus            int        `json:"bonus"`
+	OpenedAt         *time.Time `json:"opened_at"`
+	SolvedAt         time.Time  `json:"solved_at"`
+	TimeTakenSeconds int        `json:"time_taken_seconds"`
+	WrongAttempts    int        `json:"wrong_attempts"`
+	Penalty          int        `json:"penalty"`
+}
+
+// QuestionSolvers is a solved question with its solvers' names, comma separated
+type QuestionSolvers struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Points   int    `json:"points"`
+	SolvedBy string `json:"solved_by"`
+}
+
+// QuestionSolveCount is how many teams solved a question
+type QuestionSolveCount struct {
+	QuestionID int    `json:"question_id"`
+	Title      string `json:"title"`
+	Points     int    `json:"points"`
+	Solves     int    `json:"solves"`
+}
+
+// FirstSolve is a solve made at the earliest time a question was solved
+type FirstSolve struct {
+	QuestionID int       `json:"question_id"`
+	Title      string    `json:"title"`
+	TeamName   string    `json:"team_name"`
+	SolvedAt   time.Time `json:"solved_at"`
+}
+
+// LeaderboardEntry is a team's standing
+type LeaderboardEntry struct {
+	Username         string `json:"username"`
+	Points           int    `json:"points"`
+	QuestionsSolved  int    `json:"questions_solved"`
+	TotalTimeSeconds int    `json:"total_time_seconds"`
+	TotalPenalty     int    `json:"total_penalty"`
+	NetScore         int    `json:"net_score"`
+
+	// ElapsedSeconds is how long after its own start the team last solved
+	// a question, when teams play on their own clocks
+	ElapsedSeconds int          `json:"elapsed_seconds,omitempty"`
+	LastAnswered   sql.NullTime `json:"-"`
+	StartedAt      sql.NullTime `json:"-"`
+
+	// Hidden is set for teams kept off the public leaderboard: those
+	// flagged for review or suspended
+	Hidden bool `json:"-"`
+
+	// Avatar is the address of the team's avatar, empty without one
+	Avatar string `json:"avatar,omitempty"`
+
+	// Achievements are the keys of the badges the team earned
+	Achievements []string `json:"achievements,omitempty"`
+}
+
+// MarkCompleted records a team's solve worth points, reporting false if it
+// was already recorded
+func (q *Queries) MarkCompleted(ctx context.Context, teamID, questionID, points int) (bool, error) {
+	n, err := q.execAffected(ctx, `INSERT OR IGNORE INTO team_completed_questions (team_id, question_id, points) VALUES (?, ?, ?)`, teamID, questionID, points)
+	return n > 0, err
+}
+
+// GetSolvePoints returns the points a team's solve earned, streak bonus
+// aside, or sql.ErrNoRows if the team hasn't solved the question
+func (q *Queries) GetSolvePoints(ctx context.Context, teamID, questionID int) (int, error) {
+	var points int
+	err := q.queryRow(ctx, `SELECT points FROM team_completed_questions WHERE team_id = ? AND question_id = ?`, teamID, questionID).Scan(&points)
+	return points, err
+}
+
+// SetSolvePoints changes the points a team's solve earned
+func (q *Queries) SetSolvePoints(ctx context.Context, teamID, questionID, points int) error {
+	_, err := q.exec(ctx, `UPDATE team_completed_questions SET points = ? WHERE team_id = ? AND question_id = ?`, points, teamID, questionID)
+	return err
+}
+
+// IsCompleted reports whether a team solved a question
+func (q *Queries) IsCompleted(ctx context.Context, teamID, questionID int) (bool, error) {
+	n, err := q.count(ctx, `SELECT COUNT(*) FROM team_completed_questions WHERE team_id = ? AND question_id = ?`, teamID, questionID)
+	return n > 0, err
+}
+
+// ListCompletedQuestionIDs returns the questions a team solved
+func (q *Queries) ListCompletedQuestionIDs(ctx context.Context, teamID int) ([]int, error) {
+	return collect(q, ctx, scanInt, `SELECT question_id FROM team_completed_questions WHERE team_id = ?`, teamID)
+}
+
+// CountTeamCompletions counts the questions a team solved
+func (q *Queries) CountTeamCompletions(ctx context.Context, teamID int) (int, error) {
+	return q.count(ctx, `SELECT COUNT(*) FROM team_completed_questions WHERE team_id = ?`, teamID)
+}
+
+// notPendingReview leaves out the solves of flagged teams still waiting
+// for review, which count for nothing until they are approved
+const notPendingReview = `NOT EXISTS (SELECT 1 FROM solve_reviews r
+			WHERE r.team_id = tcq.team_id AND r.question_id = tcq.question_id AND r.status = 'pending')`
+
+// CountQuestionSolves counts the teams that solved a question, leaving out
+// solves waiting for review
+func (q *Queries) CountQuestionSolves(ctx context.Context, questionID int) (int, error) {
+	return q.count(ctx, `SELECT COUNT(*) FROM team_completed_questions tcq
+		WHERE tcq.question_id = ? AND `+notPendingReview, questionID)
+}
+
+// DeleteCompletion removes a team's solve, returning how many rows went
+func (q *Queries) DeleteCompletion(ctx context.Context, teamID, questionID int) (int64, error) {
+	return q.execAffected(ctx, `DELETE FROM team_completed_questions WHERE question_id = ? AND team_id = ?`, questionID, teamID)
+}
+
+// ListSolves returns every solve in a hunt, newest first
+func (q *Queries) ListSolves(ctx context.Context, huntID int) ([]SolvedQuestion, error) {
+	return collect(q, ctx, func(rows *sql.Rows, sq *SolvedQuestion) error {
+		return rows.Scan(&sq.QuestionID, &sq.QuestionTitle, &sq.Points, &sq.QuestionPoints, &sq.SolvedByTeam, &sq.TeamID, &sq.SolvedAt)
+	}, `SELECT q.id, q.title, tcq.points, q.points, t.name, tcq.team_id, tcq.completed_at
+		FROM questions q
+		INNER JOIN team_completed_questions tcq ON q.id = tcq.question_id
+		INNER JOIN teams t ON tcq.team_id = t.id
+		WHERE q.hunt_id = ?
+		ORDER BY tcq.completed_at DESC`, huntID)
+}
+
+// ListTeamSolves returns the questions a team solved, oldest solve first
+func (q *Queries) ListTeamSolves(ctx context.Context, teamID int) ([]TeamSolve, error) {
+	return collect(q, ctx, func(rows *sql.Rows, s *TeamSolve) error {
+		var openedAt sql.NullTime
+		err := rows.Scan(&s.QuestionID, &s.QuestionTitle, &s.Points, &s.QuestionPoints, &s.Bonus, &openedAt, &s.SolvedAt, &s.TimeTakenSeconds, &s.WrongAttempts, &s.Penalty)
+		s.OpenedAt = timePtr(openedAt)
+		return err
+	}, `SELECT q.id, q.title, tcq.points, q.points, tcq.bonus, qt.started_at, tcq.completed_at,
+			COALESCE(qt.time_taken_seconds, 0), COALESCE(qa.wrong_attempts, 0), COALESCE(qa.total_penalty, 0)
+		FROM team_completed_questions tcq
+		JOIN questions q ON q.id = tcq.question_id
+		LEFT JOIN question_timers qt ON qt.team_id = tcq.team_id AND qt.question_id = tcq.question_id
+		LEFT JOIN question_attempts qa ON qa.team_id = tcq.team_id AND qa.question_id = tcq.question_id
+		WHERE tcq.team_id = ?
+		ORDER BY tcq.completed_at ASC, q.id ASC`, teamID)
+}
+
+// ListQuestionSolvers returns every solved question of a hunt with who
+// solved it, cheapest first
+func (q *Queries) ListQuestionSolvers(ctx context.Context, huntID int) ([]QuestionSolvers, error) {
+	concat := "GROUP_CONCAT(t.name, ', ')"
+	if database.IsPostgres() {
+		concat = "STRING_AGG(t.name, ', ')"
+	}
+	return collect(q, ctx, func(rows *sql.Rows, qs *QuestionSolvers) error {
+		return rows.Scan(&qs.ID, &qs.Title, &qs.Points, &qs.SolvedBy)
+	}, `SELECT q.id, q.title, q.points, `+concat+` as solvers
+		FROM questions q
+		INNER JOIN team_completed_questions tcq ON q.id = tcq.question_id
+		INNER JOIN teams t ON tcq.team_id = t.id
+		WHERE q.hunt_id = ?
+		GROUP BY q.id, q.title, q.points
+		ORDER BY q.points ASC`, huntID)
+}
+
+// CountSolvesPerQuestion returns the solve count of every question of a
+// hunt, cheapest first
+func (q *Queries) CountSolvesPerQuestion(ctx context.Context, huntID int) ([]QuestionSolveCount, error) {
+	return collect(q, ctx, func(rows *sql.Rows, c *QuestionSolveCount) error {
+		return rows.Scan(&c.QuestionID, &c.Title, &c.Points, &c.Solves)
+	}, `SELECT q.id, q.title, q.points, COUNT(tcq.team_id)
+		FROM questions q
+		LEFT JOIN team_completed_questions tcq ON tcq.question_id = q.id
+		WHERE q.hunt_id = ?
+		GROUP BY q.id, q.title, q.points
+		ORDER BY q.points ASC, q.id ASC`, huntID)
+}
+
+// ListFirstSolves returns the earliest solves of each question of a hunt,
+// oldest first. Solves tied on time are ordered by team ID. Teams flagged
+// for review or suspended are left out
+func (q *Queries) ListFirstSolves(ctx context.Context, huntID int) ([]FirstSolve, error) {
+	return collect(q, ctx, func(rows *sql.Rows, fs *FirstSolve) error {
+		return rows.Scan(&fs.QuestionID, &fs.Title, &fs.TeamName, &fs.SolvedAt)
+	}, `SELECT tcq.question_id, q.title, t.name, tcq.completed_at
+		FROM team_completed_questions tcq
+		JOIN questions q ON q.id = tcq.question_id
+		JOIN teams t ON t.id = tcq.team_id
+		WHERE tcq.completed_at = (
+			SELECT MIN(first.completed_at) FROM team_completed_questions first
+			JOIN teams ft ON ft.id = first.team_id
+			WHERE first.question_id = tcq.question_id AND ft.flagged_at IS NULL AND ft.suspended_at IS NULL
+		) AND q.hunt_id = ? AND t.flagged_at IS NULL AND t.suspended_at IS NULL
+		ORDER BY tcq.completed_at ASC, tcq.team_id ASC`, huntID)
+}
+
+// Leaderboard returns the standing of every team in a hunt, ranked by points less
+// penalties, then questions solved, then total solve time, then who got
+// there first. NetScore is left to the caller
+func (q *Queries) Leaderboard(ctx context.Context, huntID int) ([]LeaderboardEntry, error) {
+	return collect(q, ctx, func(rows *sql.Rows, e *LeaderboardEntry) error {
+		return rows.Scan(&e.Username, &e.Points, &e.QuestionsSolved, &e.TotalTimeSeconds, &e.TotalPenalty, &e.LastAnswered, &e.StartedAt, &e.Hidden, &e.Avatar)
+	}, `SELECT
+			t.name,
+			t.points,
+			COUNT(CASE WHEN tcq.question_id IS NOT NULL THEN 1 END) as questions_solved,
+			COALESCE(SUM(DISTINCT qt.time_taken_seconds), 0) as total_time,
+			COALESCE(SUM(DISTINCT qa.total_penalty), 0) as total_penalty,
+			t.last_answered_question,
+			t.started_at,
+			t.flagged_at IS NOT NULL OR t.suspended_at IS NOT NULL as hidden,
+			t.avatar
+		FROM teams t
+		LEFT JOIN team_completed_questions tcq ON t.id = tcq.team_id
+		LEFT JOIN question_timers qt ON t.id = qt.team_id AND qt.question_id = tcq.question_id AND qt.completed_at IS NOT NULL
+		LEFT JOIN question_attempts qa ON t.id = qa.team_id
+		WHERE t.hunt_id = ?
+		GROUP BY t.id, t.name, t.points, t.last_answered_question, t.started_at, t.flagged_at, t.suspended_at, t.avatar
+		ORDER BY (t.points - COALESCE(SUM(DISTINCT qa.total_penalty), 0)) DESC, questions_solved DESC, total_time ASC, t.last_answered_question ASC`, huntID)
+}
+
+// TimedSolve is a solve with when the team opened the question, nil if
+// its timer was never started
+type TimedSolve struct {
+	TeamID     int
+	HuntID     int
+	QuestionID int
+	Points     int
+	SolvedAt   time.Time
+	StartedAt  *time.Time
+}
+
+// ListSolvesSince returns the solves recorded after a time, oldest first
+func (q *Queries) ListSolvesSince(ctx context.Context, since time.Time) ([]TimedSolve, error) {
+	return collect(q, ctx, func(rows *sql.Rows, s *TimedSolve) error {
+		var startedAt, stoppedAt sql.NullTime
+		err := rows.Scan(&s.TeamID, &s.HuntID, &s.QuestionID, &s.Points, &s.SolvedAt, &startedAt, &stoppedAt)
+		s.StartedAt = timePtr(startedAt)
+		// The timer has the exact time; the solve may only have the second
+		if stoppedAt.Valid {
+			s.SolvedAt = stoppedAt.Time
+		}
+		return err
+	}, `SELECT c.team_id, t.hunt_id, c.question_id, qn.points, c.completed_at, tm.started_at, tm.completed_at
+		FROM team_completed_questions c
+		JOIN teams t ON t.id = c.team_id
+		JOIN questions qn ON qn.id = c.question_id
+		LEFT JOIN question_timers tm ON tm.team_id = c.team_id AND tm.question_id = c.question_id
+		WHERE c.completed_at > ?
+		ORDER BY c.completed_at`, since)
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Email is a rendered message in the outbox, kept after it is sent
+type Email struct {
+	ID            int        `json:"id"`
+	Recipient     string     `json:"recipient"`
+	Template      string     `json:"template"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"-"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// EmailTemplate is email copy edited from the admin panel
+type EmailTemplate struct {
+	Name      string
+	Subject   string
+	Body      string
+	UpdatedAt time.Time
+}
+
+// TeamContact is where a team is emailed
+type TeamContact struct {
+	ID    int
+	Name  string
+	Email string
+}
+
+// CreateEmail queues a message, due at once
+func (q *Queries) CreateEmail(ctx context.Context, recipient, template, subject, body string, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO emails (recipient, template, subject, body, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, recipient, template, subject, body, at, at)
+	return err
+}
+
+const emailColumns = `id, recipient, template, subject, body, attempts, last_error, next_attempt_at, sent_at, created_at`
+
+func scanEmail(rows *sql.Rows, e *Email) error {
+	var sent sql.NullTime
+	err := rows.Scan(&e.ID, &e.Recipient, &e.Template, &e.Subject, &e.Body, &e.Attempts, &e.LastError,
+		&e.NextAttemptAt, &sent, &e.CreatedAt)
+	e.SentAt = timePtr(sent)
+	return err
+}
+
+// ListDueEmails returns unsent messages with fewer than maxAttempts
+// attempts whose next attempt is due by now, oldest due first
+func (q *Queries) ListDueEmails(ctx context.Context, maxAttempts int, now time.Time, limit int) ([]Email, error) {
+	return collect(q, ctx, scanEmail, `SELECT `+emailColumns+`
+		FROM emails
+		WHERE sent_at IS NULL AND attempts < ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?`, maxAttempts, now, limit)
+}
+
+// ListRecentEmails returns the latest messages, newest first
+func (q *Queries) ListRecentEmails(ctx context.Context, limit int) ([]Email, error) {
+	return collect(q, ctx, scanEmail, `SELECT `+emailColumns+`
+		FROM emails
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?`, limit)
+}
+
+// RecordEmailAttempt counts an attempt at sending a message, marking it
+// sent or storing why it failed and when to try again
+func (q *Queries) RecordEmailAttempt(ctx context.Context, id int, lastError string, sentAt *time.Time, nextAttempt time.Time) error {
+	_, err := q.exec(ctx, `UPDATE emails
+		SET attempts = attempts + 1, last_error = ?, sent_at = ?, next_attempt_at = ?
+		WHERE id = ?`, lastError, sentAt, nextAttempt, id)
+	return err
+}
+
+// ListEmailTemplates returns every edited template
+func (q *Queries) ListEmailTemplates(ctx context.Context) ([]EmailTemplate, error) {
+	return collect(q, ctx, func(rows *sql.Rows, t *EmailTemplate) error {
+		return rows.Scan(&t.Name, &t.Subject, &t.Body, &t.UpdatedAt)
+	}, `SELECT name, subject, body, updated_at FROM email_templates ORDER BY name`)
+}
+
+// GetEmailTemplate returns an edited template, or sql.ErrNoRows
+func (q *Queries) GetEmailTemplate(ctx context.Context, name string) (EmailTemplate, error) {
+	var t EmailTemplate
+	err := q.queryRow(ctx, `SELECT name, subject, body, updated_at FROM email_templates WHERE name = ?`, name).
+		Scan(&t.Name, &t.Subject, &t.Body, &t.UpdatedAt)
+	return t, err
+}
+
+// SetEmailTemplate stores a template's copy, replacing earlier edits
+func (q *Queries) SetEmailTemplate(ctx context.Context, name, subject, body string, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO email_templates (name, subject, body, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET subject = excluded.subject, body = excluded.body, updated_at = excluded.updated_at`,
+		name, subject, body, at)
+	return err
+}
+
+// DeleteEmailTemplate removes a template's edits, so its built-in copy
+// applies again
+func (q *Queries) DeleteEmailTemplate(ctx context.Context, name string) error {
+	_, err := q.exec(ctx, `DELETE FROM email_templates WHERE name = ?`, name)
+	return err
+}
+
+// ListTeamContacts returns the name and email of every team of a hunt, or
+// of every team when huntID is 0
+func (q *Queries) ListTeamContacts(ctx context.Context, huntID int) ([]TeamContact, error) {
+	return collect(q, ctx, func(rows *sql.Rows, t *TeamContact) error {
+		return rows.Scan(&t.ID, &t.Name, &t.Email)
+	}, `SELECT id, name, email FROM teams WHERE ? = 0 OR hunt_id = ? ORDER BY id`, huntID, huntID)
+}
+
+// CreateEmailToken stores the hash of a token a team is emailed, for one
+// purpose and until it expires
+func (q *Queries) CreateEmailToken(ctx context.Context, teamID int, purpose, tokenHash string, expiresAt, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO email_tokens (team_id, purpose, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)`, teamID, purpose, tokenHash, expiresAt, at)
+	return err
+}
+
+// UseEmailToken marks an unexpired, unused token as used and returns the
+// team it was made for, or sql.ErrNoRows. A token is only ever used once
+func (q *Queries) UseEmailToken(ctx context.Context, purpose, tokenHash string, now time.Time) (int, error) {
+	var id, teamID int
+	err := q.queryRow(ctx, `SELECT id, team_id FROM email_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?`, tokenHash, purpose, now).
+		Scan(&id, &teamID)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := q.execAffected(ctx, `UPDATE email_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`, now, id)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, sql.ErrNoRows
+	}
+	return teamID, nil
+}
+
+// ExpireEmailTokens uses up a team's outstanding tokens for a purpose, so
+// only the newest link works
+func (q *Queries) ExpireEmailTokens(ctx context.Context, teamID int, purpose string, now time.Time) error {
+	_, err := q.exec(ctx, `UPDATE email_tokens SET used_at = ? WHERE team_id = ? AND purpose = ? AND used_at IS NULL`,
+		now, teamID, purpose)
+	return err
+}
+
+// SetTeamEmailVerified records when a team first confirmed its address
+func (q *Queries) SetTeamEmailVerified(ctx context.Context, teamID int, at time.Time) error {
+	_, err := q.exec(ctx, `UPDATE teams SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL`, at, teamID)
+	return err
+}
+
+// IsTeamEmailVerified reports whether a team confirmed its address
+func (q *Queries) IsTeamEmailVerified(ctx context.Context, teamID int) (bool, error) {
+	n, err := q.count(ctx, `SELECT COUNT(*) FROM teams WHERE id = ? AND email_verified_at IS NOT NULL`, teamID)
+	return n > 0, err
+}
+
+// SetTeamPassword replaces a team's password hash
+func (q *Queries) SetTeamPassword(ctx context.Context, teamID int, passwordHash string) error {
+	_, err := q.exec(ctx, `UPDATE teams SET password = ? WHERE id = ?`, passwordHash, teamID)
+	return err
+}
+
+// GetTeamContact returns where a team is emailed, or sql.ErrNoRows
+func (q *Queries) GetTeamContact(ctx context.Context, id int) (TeamContact, error) {
+	var t TeamContact
+	err := q.queryRow(ctx, `SELECT id, name, email FROM teams WHERE id = ?`, id).Scan(&t.ID, &t.Name, &t.Email)
+	return t, err
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// TeamRecord is a row stored about a team, as column to value
+type TeamRecord map[string]interface{}
+
+// teamRecords selects everything stored about a team, table by table; a
+// table added to teamDependents belongs here too. Internal tables hold
+// admins' notes about the team and are only exported for admins
+var teamRecords = []struct {
+	table    string
+	query    string
+	internal bool
+}{
+	{table: "teams", query: `SELECT * FROM teams WHERE id = ?`},
+	{table: "team_completed_questions", query: `SELECT * FROM team_completed_questions WHERE team_id = ?`},
+	{table: "question_locks", query: `SELECT * FROM question_locks WHERE locked_by_team_id = ?`},
+	{table: "question_timers", query: `SELECT * FROM question_timers WHERE team_id = ?`},
+	{table: "question_attempts", query: `SELECT * FROM question_attempts WHERE team_id = ?`},
+	{table: "submissions", query: `SELECT * FROM submissions WHERE team_id = ? ORDER BY created_at, id`},
+	{table: "team_hint_unlocked", query: `SELECT * FROM team_hint_unlocked WHERE team_id = ?`},
+	{table: "team_quota_slots", query: `SELECT * FROM team_quota_slots WHERE team_id = ?`},
+	{table: "team_skipped_questions", query: `SELECT * FROM team_skipped_questions WHERE team_id = ?`},
+	{table: "team_powerups", query: `SELECT * FROM team_powerups WHERE team_id = ?`},
+	{table: "team_achievements", query: `SELECT * FROM team_achievements WHERE team_id = ?`},
+	{table: "team_flags", query: `SELECT * FROM team_flags WHERE team_id = ?`},
+	{table: "solve_reviews", query: `SELECT * FROM solve_reviews WHERE team_id = ?`, internal: true},
+	{table: "photo_submissions", query: `SELECT * FROM photo_submissions WHERE team_id = ? ORDER BY created_at, id`},
+	{table: "checkpoint_scans", query: `SELECT * FROM checkpoint_scans WHERE team_id = ?`},
+	{table: "writeups", query: `SELECT * FROM writeups WHERE team_id = ?`},
+	{table: "writeup_files", query: `SELECT * FROM writeup_files WHERE writeup_id IN (SELECT id FROM writeups WHERE team_id = ?)`},
+	{table: "question_feedback", query: `SELECT * FROM question_feedback WHERE team_id = ?`},
+	{table: "clarifications", query: `SELECT * FROM clarifications WHERE team_id = ?`},
+	// The team's messages and everything in its private channel
+	{table: "chat_messages", query: `SELECT * FROM chat_messages WHERE team_id = ? OR channel = ? ORDER BY created_at, id`},
+	{table: "chat_mutes", query: `SELECT * FROM chat_mutes WHERE team_id = ?`},
+	{table: "notifications", query: `SELECT * FROM notifications WHERE team_id = ? ORDER BY created_at, id`},
+	{table: "notification_reads", query: `SELECT * FROM notification_reads WHERE team_id = ?`},
+	{table: "push_subscriptions", query: `SELECT * FROM push_subscriptions WHERE team_id = ?`},
+	{table: "telegram_chats", query: `SELECT * FROM telegram_chats WHERE team_id = ?`},
+	{table: "team_phones", query: `SELECT * FROM team_phones WHERE team_id = ?`},
+	{table: "email_tokens", query: `SELECT * FROM email_tokens WHERE team_id = ?`},
+	{table: "rules_acceptances", query: `SELECT * FROM rules_acceptances WHERE team_id = ?`},
+	{table: "logins", query: `SELECT * FROM logins WHERE team_id = ? ORDER BY created_at, id`},
+	// Mail and texts are kept by address, not by team
+	{table: "emails", query: `SELECT * FROM emails WHERE recipient = (SELECT email FROM teams WHERE id = ?) ORDER BY created_at, id`},
+	{table: "sms_messages", query: `SELECT * FROM sms_messages WHERE recipient = (SELECT phone FROM team_phones WHERE team_id = ?) ORDER BY created_at, id`},
+	{table: "hunt_results", query: `SELECT * FROM hunt_results WHERE team_name = (SELECT name FROM teams WHERE id = ?)`},
+	{table: "alerts", query: `SELECT * FROM alerts WHERE team_id = ? OR other_team_id = ? ORDER BY created_at, id`, internal: true},
+}
+
+// withheldColumns hold password and code hashes and push keys. They say
+// nothing about the team but would help someone act as it, so they are
+// never exported
+var withheldColumns = map[string]bool{
+	"password":   true,
+	"token_hash": true,
+	"code_hash":  true,
+	"p256dh":     true,
+	"auth":       true,
+}
+
+// internalColumns are admins' marks on a team: whether it is flagged for
+// review or suspended, and the fingerprint used to spot duplicate teams.
+// Like internal tables they are only exported for admins, so an export
+// doesn't tip a team off
+var internalColumns = map[string]bool{
+	"flagged_at":   true,
+	"suspended_at": true,
+	"fingerprint":  true,
+}
+
+// ExportTeam returns every row stored about a team by table, with
+// withheld columns left out. Internal tables and columns are only
+// included when internal is set
+func (q *Queries) ExportTeam(ctx context.Context, teamID int, internal bool) (map[string][]TeamRecord, error) {
+	records := make(map[string][]TeamRecord, len(teamRecords))
+	for _, t := range teamRecords {
+		if t.internal && !internal {
+			continue
+		}
+		rows, err := q.exportRows(ctx, internal, t.query, repeatArg(teamID, t.query)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %v", t.table, err)
+		}
+		records[t.table] = rows
+	}
+	return records, nil
+}
+
+// exportRows reads rows of any shape as column to value, leaving out
+// internal columns unless internal is set. Text stored as bytes is
+// returned as a string so it encodes as text
+func (q *Queries) exportRows(ctx context.Context, internal bool, query string, args ...interface{}) ([]TeamRecord, error) {
+	rows, err := q.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]TeamRecord, 0)
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		record := make(TeamRecord, len(columns))
+		for i, column := range columns {
+			if withheldColumns[column] || (internalColumns[column] && !internal) {
+				continue
+			}
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			record[column] = values[i]
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// ListTeamFiles returns the storage keys of the files a team uploaded:
+// its avatar, photos and writeup files
+func (q *Queries) ListTeamFiles(ctx context.Context, teamID int) ([]string, error) {
+	return collect(q, ctx, func(rows *sql.Rows, key *string) error {
+		return rows.Scan(key)
+	}, `SELECT avatar FROM teams WHERE id = ? AND avatar != ''
+		UNION SELECT path FROM photo_submissions WHERE team_id = ?
+		UNION SELECT f.path FROM writeup_files f JOIN writeups w ON w.id = f.writeup_id WHERE w.team_id = ?
+		ORDER BY 1`, teamID, teamID, teamID)
+}
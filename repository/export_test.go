@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// A team's own export must not show that it was flagged for review
+func TestExportTeamHidesFlag(t *testing.T) {
+	q := newTestQueries(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	teamID, err := q.InsertArchiveTeam(ctx, 1, ArchiveTeam{Email: "team@example.com", Password: "password", Name: "Team", CreatedAt: &now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	questionID, err := q.CreateQuestion(ctx, Question{Question: "Question", Answer: "answer", Title: "Question", Points: 10, HuntID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.SetTeamFlagged(ctx, teamID, sql.NullTime{Time: now, Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CreateSolveReview(ctx, SolveReview{TeamID: teamID, QuestionID: questionID, Points: 10, Status: "pending", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, internal := range []bool{false, true} {
+		records, err := q.ExportTeam(ctx, teamID, internal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records["teams"]) != 1 {
+			t.Fatalf("export has %d team rows, want 1", len(records["teams"]))
+		}
+
+		team := records["teams"][0]
+		for _, column := range []string{"flagged_at", "suspended_at", "fingerprint"} {
+			if _, ok := team[column]; ok != internal {
+				t.Errorf("internal %v: teams.%s exported %v", internal, column, ok)
+			}
+		}
+		if _, ok := records["solve_reviews"]; ok != internal {
+			t.Errorf("internal %v: solve_reviews exported %v", internal, ok)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// QuestionFeedback is a row of question_feedback: how a team rated a
+// question, each from 1 to 5
+type QuestionFeedback struct {
+	TeamID     int       `json:"-"`
+	TeamName   string    `json:"team_name,omitempty"`
+	QuestionID int       `json:"question_id"`
+	Difficulty int       `json:"difficulty"`
+	Fun        int       `json:"fun"`
+	Comment    string    `json:"comment"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// FeedbackSummary is the average rating of a question over every team
+// that rated it
+type FeedbackSummary struct {
+	QuestionID int     `json:"question_id"`
+	Title      string  `json:"title"`
+	Ratings    int     `json:"ratings"`
+	Difficulty float64 `json:"difficulty"`
+	Fun        float64 `json:"fun"`
+}
+
+// SaveFeedback inserts a team's rating of a question or replaces the one
+// it gave before
+func (q *Queries) SaveFeedback(ctx context.Context, f QuestionFeedback) error {
+	_, err := q.exec(ctx, `INSERT INTO question_feedback (team_id, question_id, difficulty, fun, comment, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(team_id, question_id) DO UPDATE SET
+		difficulty = ?,
+		fun = ?,
+		comment = ?,
+		updated_at = ?`,
+		f.TeamID, f.QuestionID, f.Difficulty, f.Fun, f.Comment, f.UpdatedAt,
+		f.Difficulty, f.Fun, f.Comment, f.UpdatedAt)
+	return err
+}
+
+// GetFeedback returns a team's rating of a question, or sql.ErrNoRows
+func (q *Queries) GetFeedback(ctx context.Context, teamID, questionID int) (QuestionFeedback, error) {
+	var f QuestionFeedback
+	err := q.queryRow(ctx, `SELECT team_id, question_id, difficulty, fun, comment, updated_at
+		FROM question_feedback WHERE team_id = ? AND question_id = ?`, teamID, questionID).
+		Scan(&f.TeamID, &f.QuestionID, &f.Difficulty, &f.Fun, &f.Comment, &f.UpdatedAt)
+	return f, err
+}
+
+// ListFeedbackSummaries returns the average ratings of every question of
+// a hunt, zero for questions nobody rated yet
+func (q *Queries) ListFeedbackSummaries(ctx context.Context, huntID int) ([]FeedbackSummary, error) {
+	return collect(q, ctx, func(rows *sql.Rows, s *FeedbackSummary) error {
+		return rows.Scan(&s.QuestionID, &s.Title, &s.Ratings, &s.Difficulty, &s.Fun)
+	}, `SELECT q.id, q.title, COUNT(f.id), COALESCE(AVG(f.difficulty), 0), COALESCE(AVG(f.fun), 0)
+		FROM questions q
+		LEFT JOIN question_feedback f ON f.question_id = q.id
+		WHERE q.hunt_id = ?
+		GROUP BY q.id, q.title, q.points
+		ORDER BY q.points ASC, q.id ASC`, huntID)
+}
+
+// ListFeedbackComments returns the ratings with a comment on the questions
+// of a hunt, newest first
+func (q *Queries) ListFeedbackComments(ctx context.Context, huntID int) ([]QuestionFeedback, error) {
+	return collect(q, ctx, func(rows *sql.Rows, f *QuestionFeedback) error {
+		return rows.Scan(&f.TeamID, &f.TeamName, &f.QuestionID, &f.Difficulty, &f.Fun, &f.Comment, &f.UpdatedAt)
+	}, `SELECT f.team_id, t.name, f.question_id, f.difficulty, f.fun, f.comment, f.updated_at
+		FROM question_feedback f
+		JOIN teams t ON t.id = f.team_id
+		JOIN questions q ON q.id = f.question_id
+		WHERE q.hunt_id = ? AND f.comment != ''
+		ORDER BY f.updated_at DESC`, huntID)
+}
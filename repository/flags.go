@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TeamFlag is the token a team's flag for a question is made from
+type TeamFlag struct {
+	TeamID     int       `json:"team_id"`
+	QuestionID int       `json:"question_id"`
+	Token      string    `json:"token"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TeamFlagWithName is a team's token for a question with the team's name
+type TeamFlagWithName struct {
+	TeamFlag
+	TeamName string `json:"team_name"`
+}
+
+// CreateTeamFlag stores a team's token for a question unless it already
+// has one
+func (q *Queries) CreateTeamFlag(ctx context.Context, f TeamFlag) error {
+	_, err := q.exec(ctx, `INSERT INTO team_flags (team_id, question_id, token, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (team_id, question_id) DO NOTHING`, f.TeamID, f.QuestionID, f.Token, f.CreatedAt)
+	return err
+}
+
+// GetTeamFlag returns a team's token for a question, or sql.ErrNoRows
+func (q *Queries) GetTeamFlag(ctx context.Context, teamID, questionID int) (string, error) {
+	var token string
+	err := q.queryRow(ctx, `SELECT token FROM team_flags WHERE team_id = ? AND question_id = ?`, teamID, questionID).Scan(&token)
+	return token, err
+}
+
+// ListQuestionTeamFlags returns the token of every team that has one for
+// a question, by team name
+func (q *Queries) ListQuestionTeamFlags(ctx context.Context, questionID int) ([]TeamFlagWithName, error) {
+	return collect(q, ctx, func(rows *sql.Rows, f *TeamFlagWithName) error {
+		return rows.Scan(&f.TeamID, &f.TeamName, &f.QuestionID, &f.Token, &f.CreatedAt)
+	}, `SELECT f.team_id, t.name, f.question_id, f.token, f.created_at
+		FROM team_flags f
+		JOIN teams t ON t.id = f.team_id
+		WHERE f.question_id = ?
+		ORDER BY t.name`, questionID)
+}
+
+// FindTeamFlag returns the team holding a token for a question, or
+// sql.ErrNoRows
+func (q *Queries) FindTeamFlag(ctx context.Context, questionID int, token string) (int, error) {
+	return q.count(ctx, `SELECT team_id FROM team_flags WHERE question_id = ? AND token = ?`, questionID, token)
+}
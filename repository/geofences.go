@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// Geofence is the place a team must be at to answer a question: within
+// RadiusMeters of a point. Location proofs for it are signed with Secret
+type Geofence struct {
+	QuestionID   int       `json:"question_id"`
+	Latitude     float64   `json:"latitude"`
+	Longitude    float64   `json:"longitude"`
+	RadiusMeters int       `json:"radius_meters"`
+	Secret       string    `json:"-"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// SetGeofence sets where a question is answered from. The secret is
+// replaced too, so proofs of being at the old place stop counting
+func (q *Queries) SetGeofence(ctx context.Context, g Geofence) error {
+	_, err := q.exec(ctx, `INSERT INTO question_geofences (question_id, latitude, longitude, radius_meters, secret, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (question_id) DO UPDATE SET latitude = excluded.latitude, longitude = excluded.longitude,
+			radius_meters = excluded.radius_meters, secret = excluded.secret, updated_at = excluded.updated_at`,
+		g.QuestionID, g.Latitude, g.Longitude, g.RadiusMeters, g.Secret, g.UpdatedAt)
+	return err
+}
+
+// DeleteGeofence lets a question be answered from anywhere again
+func (q *Queries) DeleteGeofence(ctx context.Context, questionID int) error {
+	_, err := q.exec(ctx, `DELETE FROM question_geofences WHERE question_id = ?`, questionID)
+	return err
+}
+
+// GetGeofence returns where a question is answered from, or sql.ErrNoRows
+func (q *Queries) GetGeofence(ctx context.Context, questionID int) (Geofence, error) {
+	var g Geofence
+	err := q.queryRow(ctx, `SELECT question_id, latitude, longitude, radius_meters, secret, updated_at
+		FROM question_geofences WHERE question_id = ?`, questionID).
+		Scan(&g.QuestionID, &g.Latitude, &g.Longitude, &g.RadiusMeters, &g.Secret, &g.UpdatedAt)
+	return g, err
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Hint is a row of hints
+type Hint struct {
+	ID               int    `json:"id"`
+	Hint             string `json:"hint"`
+	Worth            int    `json:"worth"`
+	ParentQuestionID int    `json:"parent_question_id"`
+}
+
+// UnlockedHint is a hint a team bought
+type UnlockedHint struct {
+	HintID        int        `json:"hint_id"`
+	QuestionID    int        `json:"question_id"`
+	QuestionTitle string     `json:"question_title"`
+	Worth         int        `json:"worth"`
+	UnlockedAt    *time.Time `json:"unlocked_at"`
+}
+
+func scanHint(rows *sql.Rows, h *Hint) error {
+	return rows.Scan(&h.ID, &h.Hint, &h.Worth, &h.ParentQuestionID)
+}
+
+// CreateHint inserts a hint and returns its ID
+func (q *Queries) CreateHint(ctx context.Context, h Hint) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO hints (hint, worth, parent_question_id) VALUES (?, ?, ?) RETURNING id`,
+		h.Hint, h.Worth, h.ParentQuestionID).Scan(&id)
+	return id, err
+}
+
+// GetHint returns a hint, or sql.ErrNoRows
+func (q *Queries) GetHint(ctx context.Context, id int) (Hint, error) {
+	var h Hint
+	err := q.queryRow(ctx, `SELECT id, hint, worth, parent_question_id FROM hints WHERE id = ?`, id).
+		Scan(&h.ID, &h.Hint, &h.Worth, &h.ParentQuestionID)
+	return h, err
+}
+
+// GetHintHuntID returns the hunt of a hint's question, or sql.ErrNoRows
+func (q *Queries) GetHintHuntID(ctx context.Context, id int) (int, error) {
+	return q.count(ctx, `SELECT q.hunt_id FROM hints h JOIN questions q ON q.id = h.parent_question_id WHERE h.id = ?`, id)
+}
+
+// ListHints returns every hint of a hunt, grouped by question
+func (q *Queries) ListHints(ctx context.Context, huntID int) ([]Hint, error) {
+	return collect(q, ctx, scanHint, `SELECT h.id, h.hint, h.worth, h.parent_question_id FROM hints h
+		JOIN questions q ON q.id = h.parent_question_id
+		WHERE q.hunt_id = ?
+		ORDER BY h.parent_question_id, h.id`, huntID)
+}
+
+// ListQuestionHints returns a question's hints
+func (q *Queries) ListQuestionHints(ctx context.Context, questionID int) ([]Hint, error) {
+	return collect(q, ctx, scanHint, `SELECT id, hint, worth, parent_question_id FROM hints WHERE parent_question_id = ? ORDER BY id`, questionID)
+}
+
+// UpdateHint overwrites a hint's text, worth and question
+func (q *Queries) UpdateHint(ctx context.Context, h Hint) error {
+	_, err := q.exec(ctx, `UPDATE hints SET hint = ?, worth = ?, parent_question_id = ? WHERE id = ?`,
+		h.Hint, h.Worth, h.ParentQuestionID, h.ID)
+	return err
+}
+
+// DeleteHint deletes a hint's unlocks, then the hint
+func (q *Queries) DeleteHint(ctx context.Context, id int) error {
+	if _, err := q.exec(ctx, `DELETE FROM team_hint_unlocked WHERE hint_id = ?`, id); err != nil {
+		return err
+	}
+	_, err := q.exec(ctx, `DELETE FROM hints WHERE id = ?`, id)
+	return err
+}
+
+// UnlockHint records that a team unlocked a hint; unlocking twice is a no-op
+func (q *Queries) UnlockHint(ctx context.Context, teamID, hintID int) error {
+	_, err := q.exec(ctx, `INSERT OR IGNORE INTO team_hint_unlocked (team_id, hint_id) VALUES (?, ?)`, teamID, hintID)
+	return err
+}
+
+// HasUnlockedHint reports whether a team unlocked a hint
+func (q *Queries) HasUnlockedHint(ctx context.Context, teamID, hintID int) (bool, error) {
+	var exists bool
+	err := q.queryRow(ctx, `SELECT EXISTS(SELECT 1 FROM team_hint_unlocked WHERE team_id = ? AND hint_id = ?)`, teamID, hintID).Scan(&exists)
+	return exists, err
+}
+
+// ListTeamHints returns the hints a team bought, oldest first
+func (q *Queries) ListTeamHints(ctx context.Context, teamID int) ([]UnlockedHint, error) {
+	return collect(q, ctx, func(rows *sql.Rows, h *UnlockedHint) error {
+		var unlockedAt sql.NullTime
+		err := rows.Scan(&h.HintID, &h.QuestionID, &h.QuestionTitle, &h.Worth, &unlockedAt)
+		h.UnlockedAt = timePtr(unlockedAt)
+		return err
+	}, `SELECT h.id, q.id, q.title, h.worth, thu.unlocked_at
+		FROM team_hint_unlocked thu
+		JOIN hints h ON h.id = thu.hint_id
+		JOIN questions q ON q.id = h.parent_question_id
+		WHERE thu.team_id = ?
+		ORDER BY thu.unlocked_at ASC, h.id ASC`, teamID)
+}
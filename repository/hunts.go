@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/namishh/holmes/database"
+)
+
+// DefaultHuntID is the first hunt, which teams and questions join unless
+// told otherwise
+const DefaultHuntID = database.DefaultHuntID
+
+// Hunt is a row of hunts. Each has its own teams and questions, and so its
+// own leaderboard
+type Hunt struct {
+	ID        int       `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func scanHunt(rows *sql.Rows, h *Hunt) error {
+	return rows.Scan(&h.ID, &h.Slug, &h.Name, &h.CreatedAt)
+}
+
+// CreateHunt inserts a hunt and returns its ID
+func (q *Queries) CreateHunt(ctx context.Context, slug, name string) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO hunts (slug, name) VALUES (?, ?) RETURNING id`, slug, name).Scan(&id)
+	return id, err
+}
+
+// GetHunt returns a hunt, or sql.ErrNoRows
+func (q *Queries) GetHunt(ctx context.Context, id int) (Hunt, error) {
+	var h Hunt
+	err := q.queryRow(ctx, `SELECT id, slug, name, created_at FROM hunts WHERE id = ?`, id).
+		Scan(&h.ID, &h.Slug, &h.Name, &h.CreatedAt)
+	return h, err
+}
+
+// GetHuntBySlug returns the hunt with a slug, or sql.ErrNoRows
+func (q *Queries) GetHuntBySlug(ctx context.Context, slug string) (Hunt, error) {
+	var h Hunt
+	err := q.queryRow(ctx, `SELECT id, slug, name, created_at FROM hunts WHERE slug = ?`, slug).
+		Scan(&h.ID, &h.Slug, &h.Name, &h.CreatedAt)
+	return h, err
+}
+
+// ListHunts returns every hunt, oldest first
+func (q *Queries) ListHunts(ctx context.Context) ([]Hunt, error) {
+	return collect(q, ctx, scanHunt, `SELECT id, slug, name, created_at FROM hunts ORDER BY id`)
+}
+
+// RenameHunt changes the display name of a hunt
+func (q *Queries) RenameHunt(ctx context.Context, id int, name string) error {
+	_, err := q.exec(ctx, `UPDATE hunts SET name = ? WHERE id = ?`, name, id)
+	return err
+}
+
+// GetTeamHuntID returns the hunt a team plays in, or sql.ErrNoRows
+func (q *Queries) GetTeamHuntID(ctx context.Context, teamID int) (int, error) {
+	return q.count(ctx, `SELECT hunt_id FROM teams WHERE id = ?`, teamID)
+}
+
+// DeleteHunt deletes a hunt that has no teams or questions, reporting
+// whether it did
+func (q *Queries) DeleteHunt(ctx context.Context, id int) (bool, error) {
+	n, err := q.execAffected(ctx, `DELETE FROM hunts WHERE id = ?
+		AND NOT EXISTS (SELECT 1 FROM teams WHERE hunt_id = ?)
+		AND NOT EXISTS (SELECT 1 FROM questions WHERE hunt_id = ?)`, id, id, id)
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := q.exec(ctx, `DELETE FROM alerts WHERE hunt_id = ?`, id); err != nil {
+		return true, err
+	}
+	_, err = q.exec(ctx, `DELETE FROM spectators WHERE hunt_id = ?`, id)
+	return true, err
+}
+
+// HuntWindow is when a hunt runs as set from the admin panel. Set is false
+// while the hunt runs on the configured window; otherwise a start or end
+// that isn't Valid leaves that side open
+type HuntWindow struct {
+	HuntID       int
+	Set          bool
+	Start        sql.NullTime
+	End          sql.NullTime
+	TeamDuration time.Duration
+}
+
+// ListHuntWindows returns the window of every hunt
+func (q *Queries) ListHuntWindows(ctx context.Context) ([]HuntWindow, error) {
+	return collect(q, ctx, func(rows *sql.Rows, w *HuntWindow) error {
+		var teamSeconds int64
+		err := rows.Scan(&w.HuntID, &w.Set, &w.Start, &w.End, &teamSeconds)
+		w.TeamDuration = time.Duration(teamSeconds) * time.Second
+		return err
+	}, `SELECT id, window_set, starts_at, ends_at, team_duration_seconds FROM hunts ORDER BY id`)
+}
+
+// SetHuntWindow sets when a hunt runs, in place of the configured window
+func (q *Queries) SetHuntWindow(ctx context.Context, w HuntWindow) error {
+	_, err := q.exec(ctx, `UPDATE hunts SET window_set = TRUE, starts_at = ?, ends_at = ?, team_duration_seconds = ? WHERE id = ?`,
+		w.Start, w.End, int64(w.TeamDuration/time.Second), w.HuntID)
+	return err
+}
+
+// ResetHuntWindow puts a hunt back on the configured window
+func (q *Queries) ResetHuntWindow(ctx context.Context, huntID int) error {
+	_, err := q.exec(ctx, `UPDATE hunts SET window_set = FALSE, starts_at = NULL, ends_at = NULL, team_duration_seconds = 0 WHERE id = ?`, huntID)
+	return err
+}
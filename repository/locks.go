@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// QuestionLock is a question held open by one team
+type QuestionLock struct {
+	QuestionID     int       `json:"question_id"`
+	LockedByTeamID int       `json:"locked_by_team_id"`
+	LockedByName   string    `json:"locked_by_name"`
+	LockedAt       time.Time `json:"locked_at"`
+}
+
+// CreateLock locks a question for a team unless it holds a lock taken at or
+// after cutoff, reporting whether the lock was taken. A lock older than
+// cutoff is taken over in place. The check and the write are one
+// statement, so two teams can't both get the lock
+func (q *Queries) CreateLock(ctx context.Context, questionID, teamID int, at, cutoff time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `INSERT INTO question_locks (question_id, locked_by_team_id, locked_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (question_id) DO UPDATE
+		SET locked_by_team_id = excluded.locked_by_team_id, locked_at = excluded.locked_at
+		WHERE question_locks.locked_at < ?`,
+		questionID, teamID, at, cutoff)
+	return n > 0, err
+}
+
+// GetLock returns the lock on a question with its holder's name, or
+// sql.ErrNoRows when there is none taken at or after cutoff
+func (q *Queries) GetLock(ctx context.Context, questionID int, cutoff time.Time) (QuestionLock, error) {
+	var l QuestionLock
+	err := q.queryRow(ctx, `SELECT ql.question_id, ql.locked_by_team_id, t.name, ql.locked_at
+		FROM question_locks ql
+		JOIN teams t ON ql.locked_by_team_id = t.id
+		WHERE ql.question_id = ? AND ql.locked_at >= ?`, questionID, cutoff).
+		Scan(&l.QuestionID, &l.LockedByTeamID, &l.LockedByName, &l.LockedAt)
+	return l, err
+}
+
+// ListLocks returns every lock on a hunt's questions taken at or after
+// cutoff with its holder's name
+func (q *Queries) ListLocks(ctx context.Context, huntID int, cutoff time.Time) ([]QuestionLock, error) {
+	return collect(q, ctx, func(rows *sql.Rows, l *QuestionLock) error {
+		return rows.Scan(&l.QuestionID, &l.LockedByTeamID, &l.LockedByName, &l.LockedAt)
+	}, `SELECT ql.question_id, ql.locked_by_team_id, t.name, ql.locked_at
+		FROM question_locks ql
+		JOIN teams t ON ql.locked_by_team_id = t.id
+		JOIN questions q ON ql.question_id = q.id
+		WHERE q.hunt_id = ? AND ql.locked_at >= ?`, huntID, cutoff)
+}
+
+// ExtendLock moves the time a team's lock on a question was taken to at,
+// reporting false when the team holds no lock taken at or after cutoff
+func (q *Queries) ExtendLock(ctx context.Context, questionID, teamID int, at, cutoff time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE question_locks SET locked_at = ?
+		WHERE question_id = ? AND locked_by_team_id = ? AND locked_at >= ?`, at, questionID, teamID, cutoff)
+	return n > 0, err
+}
+
+// DeleteLock releases a question, returning how many locks went
+func (q *Queries) DeleteLock(ctx context.Context, questionID int) (int64, error) {
+	return q.execAffected(ctx, `DELETE FROM question_locks WHERE question_id = ?`, questionID)
+}
+
+// DeleteTeamLock releases a question if teamID holds it
+func (q *Queries) DeleteTeamLock(ctx context.Context, questionID, teamID int) error {
+	_, err := q.exec(ctx, `DELETE FROM question_locks WHERE question_id = ? AND locked_by_team_id = ?`, questionID, teamID)
+	return err
+}
+
+// DeleteLocksBefore releases every question locked before cutoff,
+// returning how many were released
+func (q *Queries) DeleteLocksBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	return q.execAffected(ctx, `DELETE FROM question_locks WHERE locked_at < ?`, cutoff)
+}
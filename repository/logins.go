@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SharedLogin is a team that logged in from an IP other teams of its hunt
+// also logged in from
+type SharedLogin struct {
+	IP       string
+	HuntID   int
+	TeamID   int
+	TeamName string
+}
+
+// CreateLogin logs a team logging in from an IP
+func (q *Queries) CreateLogin(ctx context.Context, teamID int, ip string, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO logins (team_id, ip, created_at) VALUES (?, ?, ?)`, teamID, ip, at)
+	return err
+}
+
+// ListSharedLogins returns the teams that logged in since a time from an
+// IP at least minTeams teams of one hunt logged in from, by IP and team
+func (q *Queries) ListSharedLogins(ctx context.Context, since time.Time, minTeams int) ([]SharedLogin, error) {
+	return collect(q, ctx, func(rows *sql.Rows, l *SharedLogin) error {
+		return rows.Scan(&l.IP, &l.HuntID, &l.TeamID, &l.TeamName)
+	}, `SELECT l.ip, t.hunt_id, l.team_id, t.name
+		FROM logins l
+		JOIN teams t ON t.id = l.team_id
+		WHERE l.created_at >= ? AND l.ip <> ''
+			AND (l.ip, t.hunt_id) IN (
+				SELECT sl.ip, st.hunt_id FROM logins sl
+				JOIN teams st ON st.id = sl.team_id
+				WHERE sl.created_at >= ?
+				GROUP BY sl.ip, st.hunt_id
+				HAVING COUNT(DISTINCT sl.team_id) >= ?)
+		GROUP BY l.ip, t.hunt_id, l.team_id, t.name
+		ORDER BY l.ip, t.hunt_id, l.team_id`, since, since, minTeams)
+}
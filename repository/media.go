@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MediaTables are the tables holding a question's media
+var MediaTables = []string{"images", "videos", "audios", "files"}
+
+// ErrUnknownMediaTable is returned for a table other than MediaTables;
+// table names can't be bound as parameters, so they are checked instead
+var ErrUnknownMediaTable = errors.New("unknown media table")
+
+// Media is a row of one of MediaTables. Path is the storage key; Name is
+// the download name of files and empty for other media
+type Media struct {
+	ID         int
+	QuestionID int
+	Path       string
+	Name       string
+	Caption    string
+}
+
+func checkMediaTable(table string) error {
+	for _, t := range MediaTables {
+		if t == table {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %q", ErrUnknownMediaTable, table)
+}
+
+// AddMedia appends stored media to the end of a question's images,
+// videos or audios
+func (q *Queries) AddMedia(ctx context.Context, table string, questionID int, path string) error {
+	if err := checkMediaTable(table); err != nil {
+		return err
+	}
+	_, err := q.exec(ctx, fmt.Sprintf(`INSERT INTO %[1]s (path, parent_question_id, position)
+		VALUES (?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM %[1]s WHERE parent_question_id = ?))`, table),
+		path, questionID, questionID)
+	return err
+}
+
+// AddFile appends a stored file to the end of a question's files
+func (q *Queries) AddFile(ctx context.Context, questionID int, path, name string) error {
+	_, err := q.exec(ctx, `INSERT INTO files (path, name, parent_question_id, position)
+		VALUES (?, ?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM files WHERE parent_question_id = ?))`,
+		path, name, questionID, questionID)
+	return err
+}
+
+// ListMedia returns a question's rows of a media table in display order
+func (q *Queries) ListMedia(ctx context.Context, table string, questionID int) ([]Media, error) {
+	return q.ListMediaForQuestions(ctx, table, []int{questionID})
+}
+
+// ListMediaForQuestions returns the rows of a media table belonging to
+// any of questionIDs, grouped by question. Within a question rows are in
+// the order the admin arranged them; rows sharing a position keep upload
+// order
+func (q *Queries) ListMediaForQuestions(ctx context.Context, table string, questionIDs []int) ([]Media, error) {
+	if err := checkMediaTable(table); err != nil {
+		return nil, err
+	}
+	if len(questionIDs) == 0 {
+		return nil, nil
+	}
+	name := "''"
+	if table == "files" {
+		name = "name"
+	}
+	args := make([]interface{}, len(questionIDs))
+	for i, id := range questionIDs {
+		args[i] = id
+	}
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(questionIDs)), ", ")
+	return collect(q, ctx, func(rows *sql.Rows, m *Media) error {
+		return rows.Scan(&m.ID, &m.QuestionID, &m.Path, &m.Name, &m.Caption)
+	}, fmt.Sprintf(`SELECT id, parent_question_id, path, %s, caption FROM %s WHERE parent_question_id IN (%s) ORDER BY parent_question_id, position, id`, name, table, in), args...)
+}
+
+// ListMediaPaths returns the key of every row of a media table
+func (q *Queries) ListMediaPaths(ctx context.Context, table string) ([]string, error) {
+	if err := checkMediaTable(table); err != nil {
+		return nil, err
+	}
+	return collect(q, ctx, func(rows *sql.Rows, path *string) error {
+		return rows.Scan(path)
+	}, fmt.Sprintf(`SELECT path FROM %s`, table))
+}
+
+// GetMedia returns a media row, without the name of files, or sql.ErrNoRows
+func (q *Queries) GetMedia(ctx context.Context, table string, id int) (Media, error) {
+	if err := checkMediaTable(table); err != nil {
+		return Media{}, err
+	}
+	m := Media{ID: id}
+	err := q.queryRow(ctx, fmt.Sprintf(`SELECT parent_question_id, path, caption FROM %s WHERE id = ?`, table), id).
+		Scan(&m.QuestionID, &m.Path, &m.Caption)
+	return m, err
+}
+
+// GetMediaByPath returns the media row stored under a key, or sql.ErrNoRows
+func (q *Queries) GetMediaByPath(ctx context.Context, table, path string) (Media, error) {
+	if err := checkMediaTable(table); err != nil {
+		return Media{}, err
+	}
+	m := Media{Path: path}
+	err := q.queryRow(ctx, fmt.Sprintf(`SELECT id, parent_question_id FROM %s WHERE path = ?`, table), path).
+		Scan(&m.ID, &m.QuestionID)
+	return m, err
+}
+
+// ListMediaQuestionIDs returns every question with a row of a media table
+// stored under path; cloned hunts share their media objects
+func (q *Queries) ListMediaQuestionIDs(ctx context.Context, table, path string) ([]int, error) {
+	if err := checkMediaTable(table); err != nil {
+		return nil, err
+	}
+	return collect(q, ctx, scanInt, fmt.Sprintf(`SELECT DISTINCT parent_question_id FROM %s WHERE path = ? ORDER BY parent_question_id`, table), path)
+}
+
+// GetFileName returns the download name of the file stored under a key,
+// or sql.ErrNoRows
+func (q *Queries) GetFileName(ctx context.Context, path string) (string, error) {
+	var name string
+	err := q.queryRow(ctx, `SELECT name FROM files WHERE path = ?`, path).Scan(&name)
+	return name, err
+}
+
+// UpdateMedia sets the position and caption of one of a question's media rows
+func (q *Queries) UpdateMedia(ctx context.Context, table string, questionID, id, position int, caption string) error {
+	if err := checkMediaTable(table); err != nil {
+		return err
+	}
+	_, err := q.exec(ctx, fmt.Sprintf(`UPDATE %s SET position = ?, caption = ? WHERE id = ? AND parent_question_id = ?`, table),
+		position, caption, id, questionID)
+	return err
+}
+
+// DeleteMedia deletes a media row
+func (q *Queries) DeleteMedia(ctx context.Context, table string, id int) error {
+	if err := checkMediaTable(table); err != nil {
+		return err
+	}
+	_, err := q.exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, table), id)
+	return err
+}
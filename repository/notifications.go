@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Notification is an entry in a team's inbox
+// TeamID 0 means the notification was sent to every team
+type Notification struct {
+	ID        int       `json:"id"`
+	TeamID    int       `json:"team_id"`
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	Link      string    `json:"link"`
+	CreatedAt time.Time `json:"created_at"`
+	Read      bool      `json:"read"`
+}
+
+// CreateNotification inserts a notification and returns its ID
+func (q *Queries) CreateNotification(ctx context.Context, n Notification) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO notifications (team_id, type, title, message, link, created_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id`, n.TeamID, n.Type, n.Title, n.Message, n.Link, n.CreatedAt).Scan(&id)
+	return id, err
+}
+
+// ListTeamNotifications returns the team's own and global notifications
+// with whether the team read them, newest first
+func (q *Queries) ListTeamNotifications(ctx context.Context, teamID, limit int) ([]Notification, error) {
+	return collect(q, ctx, func(rows *sql.Rows, n *Notification) error {
+		var read int
+		err := rows.Scan(&n.ID, &n.TeamID, &n.Type, &n.Title, &n.Message, &n.Link, &n.CreatedAt, &read)
+		n.Read = read == 1
+		return err
+	}, `SELECT n.id, n.team_id, n.type, n.title, COALESCE(n.message, ''), COALESCE(n.link, ''), n.created_at,
+		CASE WHEN nr.notification_id IS NOT NULL THEN 1 ELSE 0 END as is_read
+		FROM notifications n
+		LEFT JOIN notification_reads nr ON nr.notification_id = n.id AND nr.team_id = ?
+		WHERE n.team_id = ? OR n.team_id = 0
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT ?`, teamID, teamID, limit)
+}
+
+// CountUnreadNotifications counts notifications the team hasn't read
+func (q *Queries) CountUnreadNotifications(ctx context.Context, teamID int) (int, error) {
+	return q.count(ctx, `SELECT COUNT(*) FROM notifications n
+		WHERE (n.team_id = ? OR n.team_id = 0)
+		AND NOT EXISTS (
+			SELECT 1 FROM notification_reads nr WHERE nr.notification_id = n.id AND nr.team_id = ?
+		)`, teamID, teamID)
+}
+
+// MarkNotificationsRead marks every notification visible to the team as read
+func (q *Queries) MarkNotificationsRead(ctx context.Context, teamID int) error {
+	_, err := q.exec(ctx, `INSERT OR IGNORE INTO notification_reads (team_id, notification_id)
+		SELECT ?, n.id FROM notifications n
+		WHERE (n.team_id = ? OR n.team_id = 0)`, teamID, teamID)
+	return err
+}
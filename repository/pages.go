@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Page is a row of pages: markdown the admins wrote, served at /p/<slug>
+// once published
+type Page struct {
+	ID        int       `json:"id"`
+	Slug      string    `json:"slug"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Published bool      `json:"published"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const pageColumns = `id, slug, title, body, published, created_at, updated_at`
+
+func scanPage(rows *sql.Rows, p *Page) error {
+	return rows.Scan(&p.ID, &p.Slug, &p.Title, &p.Body, &p.Published, &p.CreatedAt, &p.UpdatedAt)
+}
+
+// getPage returns the page a query selects, or sql.ErrNoRows
+func (q *Queries) getPage(ctx context.Context, where string, arg interface{}) (Page, error) {
+	list, err := collect(q, ctx, scanPage, `SELECT `+pageColumns+` FROM pages WHERE `+where, arg)
+	if err != nil {
+		return Page{}, err
+	}
+	if len(list) == 0 {
+		return Page{}, sql.ErrNoRows
+	}
+	return list[0], nil
+}
+
+// GetPage returns a page, or sql.ErrNoRows
+func (q *Queries) GetPage(ctx context.Context, id int) (Page, error) {
+	return q.getPage(ctx, `id = ?`, id)
+}
+
+// GetPageBySlug returns the page at a slug, or sql.ErrNoRows
+func (q *Queries) GetPageBySlug(ctx context.Context, slug string) (Page, error) {
+	return q.getPage(ctx, `slug = ?`, slug)
+}
+
+// ListPages returns every page, by slug
+func (q *Queries) ListPages(ctx context.Context) ([]Page, error) {
+	return collect(q, ctx, scanPage, `SELECT `+pageColumns+` FROM pages ORDER BY slug`)
+}
+
+// CreatePage inserts a page and returns its ID
+func (q *Queries) CreatePage(ctx context.Context, p Page) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO pages (slug, title, body, published, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id`, p.Slug, p.Title, p.Body, p.Published, p.CreatedAt, p.UpdatedAt).Scan(&id)
+	return id, err
+}
+
+// UpdatePage saves a page, reporting whether it exists
+func (q *Queries) UpdatePage(ctx context.Context, p Page) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE pages SET slug = ?, title = ?, body = ?, published = ?, updated_at = ?
+		WHERE id = ?`, p.Slug, p.Title, p.Body, p.Published, p.UpdatedAt, p.ID)
+	return n > 0, err
+}
+
+// DeletePage deletes a page
+func (q *Queries) DeletePage(ctx context.Context, id int) error {
+	_, err := q.exec(ctx, `DELETE FROM pages WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PhotoSubmission is a photo a team sent as the answer to a question.
+// Status is pending until an admin approves it, awarding Points, or
+// rejects it, with Note telling the team why
+type PhotoSubmission struct {
+	ID             int        `json:"id"`
+	TeamID         int        `json:"team_id"`
+	TeamName       string     `json:"team_name"`
+	QuestionID     int        `json:"question_id"`
+	QuestionTitle  string     `json:"question_title"`
+	QuestionPoints int        `json:"question_points"`
+	Path           string     `json:"path"`
+	Name           string     `json:"name"`
+	IP             string     `json:"-"`
+	Status         string     `json:"status"`
+	Points         int        `json:"points"`
+	Note           string     `json:"note"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReviewedAt     *time.Time `json:"reviewed_at,omitempty"`
+}
+
+const photoColumns = `p.id, p.team_id, t.name, p.question_id, q.title, q.points, p.path, p.name, p.ip, p.status, p.points, p.note, p.created_at, p.reviewed_at
+	FROM photo_submissions p
+	JOIN teams t ON t.id = p.team_id
+	JOIN questions q ON q.id = p.question_id`
+
+func scanPhotoSubmission(rows *sql.Rows, p *PhotoSubmission) error {
+	var reviewed sql.NullTime
+	if err := rows.Scan(&p.ID, &p.TeamID, &p.TeamName, &p.QuestionID, &p.QuestionTitle, &p.QuestionPoints, &p.Path, &p.Name, &p.IP, &p.Status, &p.Points, &p.Note, &p.CreatedAt, &reviewed); err != nil {
+		return err
+	}
+	p.ReviewedAt = timePtr(reviewed)
+	return nil
+}
+
+// CreatePhotoSubmission inserts a photo waiting for review and returns its
+// ID
+func (q *Queries) CreatePhotoSubmission(ctx context.Context, p PhotoSubmission) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO photo_submissions (team_id, question_id, path, name, ip, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		p.TeamID, p.QuestionID, p.Path, p.Name, p.IP, p.Status, p.CreatedAt).Scan(&id)
+	return id, err
+}
+
+// GetPhotoSubmission returns a photo submission, or sql.ErrNoRows
+func (q *Queries) GetPhotoSubmission(ctx context.Context, id int) (PhotoSubmission, error) {
+	return q.getPhotoSubmission(ctx, `WHERE p.id = ?`, id)
+}
+
+// GetPhotoSubmissionByPath returns the submission of the photo stored under
+// path, or sql.ErrNoRows
+func (q *Queries) GetPhotoSubmissionByPath(ctx context.Context, path string) (PhotoSubmission, error) {
+	return q.getPhotoSubmission(ctx, `WHERE p.path = ?`, path)
+}
+
+func (q *Queries) getPhotoSubmission(ctx context.Context, where string, arg interface{}) (PhotoSubmission, error) {
+	photos, err := collect(q, ctx, scanPhotoSubmission, `SELECT `+photoColumns+` `+where, arg)
+	if err != nil {
+		return PhotoSubmission{}, err
+	}
+	if len(photos) == 0 {
+		return PhotoSubmission{}, sql.ErrNoRows
+	}
+	return photos[0], nil
+}
+
+// ListPhotoSubmissions returns the photos sent for a hunt's questions with
+// a status, or with any status when it is empty, oldest first
+func (q *Queries) ListPhotoSubmissions(ctx context.Context, huntID int, status string) ([]PhotoSubmission, error) {
+	where, args := `q.hunt_id = ?`, []interface{}{huntID}
+	if status != "" {
+		where, args = where+` AND p.status = ?`, append(args, status)
+	}
+	return collect(q, ctx, scanPhotoSubmission, `SELECT `+photoColumns+`
+		WHERE `+where+`
+		ORDER BY p.created_at, p.id`, args...)
+}
+
+// ListTeamPhotoSubmissions returns the photos a team sent for a question,
+// newest first
+func (q *Queries) ListTeamPhotoSubmissions(ctx context.Context, teamID, questionID int) ([]PhotoSubmission, error) {
+	return collect(q, ctx, scanPhotoSubmission, `SELECT `+photoColumns+`
+		WHERE p.team_id = ? AND p.question_id = ?
+		ORDER BY p.created_at DESC, p.id DESC`, teamID, questionID)
+}
+
+// CountPendingPhotos counts the photos a team sent for a question that
+// are still waiting for review
+func (q *Queries) CountPendingPhotos(ctx context.Context, teamID, questionID int) (int, error) {
+	return q.count(ctx, `SELECT COUNT(*) FROM photo_submissions WHERE team_id = ? AND question_id = ? AND status = 'pending'`, teamID, questionID)
+}
+
+// GradePhotoSubmission approves or rejects a pending photo, reporting
+// whether it was still pending so it is only ever graded once
+func (q *Queries) GradePhotoSubmission(ctx context.Context, id int, status string, points int, note string, at time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE photo_submissions SET status = ?, points = ?, note = ?, reviewed_at = ? WHERE id = ? AND status = 'pending'`,
+		status, points, note, at, id)
+	return n > 0, err
+}
+
+// ListPhotoPaths returns the key of every stored photo submission
+func (q *Queries) ListPhotoPaths(ctx context.Context) ([]string, error) {
+	return collect(q, ctx, func(rows *sql.Rows, path *string) error {
+		return rows.Scan(path)
+	}, `SELECT path FROM photo_submissions`)
+}
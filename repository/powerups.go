@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PowerUpConfig is what an admin set for a power-up in the store
+type PowerUpConfig struct {
+	Kind       string
+	Price      int
+	MaxPerTeam int
+	Enabled    bool
+}
+
+// TeamPowerUp is a power-up a team bought, with the question it was used
+// on once it is used
+type TeamPowerUp struct {
+	ID         int        `json:"id"`
+	TeamID     int        `json:"team_id"`
+	Kind       string     `json:"kind"`
+	Price      int        `json:"price"`
+	BoughtAt   time.Time  `json:"bought_at"`
+	UsedAt     *time.Time `json:"used_at"`
+	QuestionID int        `json:"question_id,omitempty"`
+}
+
+// ListPowerUpConfigs returns every power-up an admin configured
+func (q *Queries) ListPowerUpConfigs(ctx context.Context) ([]PowerUpConfig, error) {
+	return collect(q, ctx, func(rows *sql.Rows, c *PowerUpConfig) error {
+		return rows.Scan(&c.Kind, &c.Price, &c.MaxPerTeam, &c.Enabled)
+	}, `SELECT kind, price, max_per_team, enabled FROM powerups`)
+}
+
+// SavePowerUpConfig inserts or overwrites the configuration of a power-up
+func (q *Queries) SavePowerUpConfig(ctx context.Context, c PowerUpConfig) error {
+	_, err := q.exec(ctx, `INSERT INTO powerups (kind, price, max_per_team, enabled) VALUES (?, ?, ?, ?)
+		ON CONFLICT (kind) DO UPDATE SET price = excluded.price, max_per_team = excluded.max_per_team, enabled = excluded.enabled`,
+		c.Kind, c.Price, c.MaxPerTeam, c.Enabled)
+	return err
+}
+
+// CountTeamPowerUps counts the power-ups of a kind a team ever bought
+func (q *Queries) CountTeamPowerUps(ctx context.Context, teamID int, kind string) (int, error) {
+	return q.count(ctx, `SELECT COUNT(*) FROM team_powerups WHERE team_id = ? AND kind = ?`, teamID, kind)
+}
+
+// CreateTeamPowerUp records a power-up a team bought
+func (q *Queries) CreateTeamPowerUp(ctx context.Context, teamID int, kind string, price int, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO team_powerups (team_id, kind, price, bought_at) VALUES (?, ?, ?, ?)`,
+		teamID, kind, price, at)
+	return err
+}
+
+// ListTeamPowerUps returns every power-up a team bought, newest first
+func (q *Queries) ListTeamPowerUps(ctx context.Context, teamID int) ([]TeamPowerUp, error) {
+	return collect(q, ctx, func(rows *sql.Rows, p *TeamPowerUp) error {
+		var usedAt sql.NullTime
+		err := rows.Scan(&p.ID, &p.TeamID, &p.Kind, &p.Price, &p.BoughtAt, &usedAt, &p.QuestionID)
+		p.UsedAt = timePtr(usedAt)
+		return err
+	}, `SELECT id, team_id, kind, price, bought_at, used_at, question_id
+		FROM team_powerups
+		WHERE team_id = ?
+		ORDER BY bought_at DESC, id DESC`, teamID)
+}
+
+// UseTeamPowerUp spends a team's oldest unused power-up of a kind on a
+// question, reporting false when it has none
+func (q *Queries) UseTeamPowerUp(ctx context.Context, teamID int, kind string, questionID int, at time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE team_powerups SET used_at = ?, question_id = ?
+		WHERE id = (
+			SELECT id FROM team_powerups
+			WHERE team_id = ? AND kind = ? AND used_at IS NULL
+			ORDER BY id ASC LIMIT 1
+		) AND used_at IS NULL`, at, questionID, teamID, kind)
+	return n > 0, err
+}
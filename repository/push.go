@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PushSubscription is a browser's Web Push endpoint for a team
+type PushSubscription struct {
+	ID        int       `json:"id"`
+	TeamID    int       `json:"team_id"`
+	Endpoint  string    `json:"endpoint"`
+	P256dh    string    `json:"p256dh"`
+	Auth      string    `json:"auth"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func scanPushSubscription(rows *sql.Rows, s *PushSubscription) error {
+	return rows.Scan(&s.ID, &s.TeamID, &s.Endpoint, &s.P256dh, &s.Auth, &s.CreatedAt)
+}
+
+// CreatePushSubscription inserts a subscription
+func (q *Queries) CreatePushSubscription(ctx context.Context, s PushSubscription) error {
+	_, err := q.exec(ctx, `INSERT INTO push_subscriptions (team_id, endpoint, p256dh, auth, created_at)
+		VALUES (?, ?, ?, ?, ?)`, s.TeamID, s.Endpoint, s.P256dh, s.Auth, s.CreatedAt)
+	return err
+}
+
+// DeletePushSubscription deletes the subscription of an endpoint
+func (q *Queries) DeletePushSubscription(ctx context.Context, endpoint string) error {
+	_, err := q.exec(ctx, `DELETE FROM push_subscriptions WHERE endpoint = ?`, endpoint)
+	return err
+}
+
+// ListPushSubscriptions returns every subscription
+func (q *Queries) ListPushSubscriptions(ctx context.Context) ([]PushSubscription, error) {
+	return collect(q, ctx, scanPushSubscription, `SELECT id, team_id, endpoint, p256dh, auth, created_at FROM push_subscriptions`)
+}
+
+// ListTeamPushSubscriptions returns a team's subscriptions
+func (q *Queries) ListTeamPushSubscriptions(ctx context.Context, teamID int) ([]PushSubscription, error) {
+	return collect(q, ctx, scanPushSubscription, `SELECT id, team_id, endpoint, p256dh, auth, created_at FROM push_subscriptions WHERE team_id = ?`, teamID)
+}
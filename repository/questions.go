@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Question is a row of questions. Answer is the bcrypt hash; RevealAnswer
+// and Solution are shown to teams once the hunt is over. FlagTemplate is
+// the answer of a question whose flag differs per team, empty otherwise.
+// Cooldown is the seconds a team waits after its first wrong answer.
+// AnswerType is "text" for a typed answer or "photo" for one an admin
+// grades. Category is lowercase, empty for none
+type Question struct {
+	ID           int    `json:"id"`
+	Question     string `json:"question"`
+	Answer       string `json:"answer"`
+	Title        string `json:"title"`
+	Points       int    `json:"points"`
+	HuntID       int    `json:"hunt_id"`
+	RevealAnswer string `json:"reveal_answer"`
+	Solution     string `json:"solution"`
+	FlagTemplate string `json:"flag_template"`
+	Cooldown     int    `json:"cooldown"`
+	AnswerType   string `json:"answer_type"`
+	Category     string `json:"category"`
+}
+
+// QuestionWithStatus is a question as one team sees it in the hunt
+type QuestionWithStatus struct {
+	ID             int    `json:"id"`
+	Question       string `json:"question"`
+	Answer         string `json:"answer"`
+	Title          string `json:"title"`
+	Points         int    `json:"points"`
+	Category       string `json:"category,omitempty"`
+	Solved         bool   `json:"solved"`
+	Locked         bool   `json:"locked"`
+	LockedByTeamID int    `json:"locked_by_team_id"`
+	LockedByName   string `json:"locked_by_name"`
+	LockedByMe     bool   `json:"locked_by_me"`
+	SolvedByAnyone bool   `json:"solved_by_anyone"`
+	Skipped        bool   `json:"skipped"`              // bypassed with a skip token
+	Thumbnail      string `json:"thumbnail,omitempty"`  // small copy of the first image, if any
+	Checkpoint     string `json:"checkpoint,omitempty"` // "unlock" or "solve" for a QR-code checkpoint
+	Scanned        bool   `json:"scanned,omitempty"`    // the team scanned its checkpoint code
+
+	// Weight multiplies Points when the question is solved, from the
+	// weight of its category
+	Weight float64 `json:"weight"`
+}
+
+// CreateQuestion inserts a question into its hunt and returns its ID
+func (q *Queries) CreateQuestion(ctx context.Context, qn Question) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO questions (question, answer, title, points, hunt_id, reveal_answer, solution, flag_template, cooldown_seconds, answer_type, category) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		qn.Question, qn.Answer, qn.Title, qn.Points, qn.HuntID, qn.RevealAnswer, qn.Solution, qn.FlagTemplate, qn.Cooldown, qn.AnswerType, qn.Category).Scan(&id)
+	return id, err
+}
+
+// GetQuestion returns a question, or sql.ErrNoRows
+func (q *Queries) GetQuestion(ctx context.Context, id int) (Question, error) {
+	var qn Question
+	err := q.queryRow(ctx, `SELECT id, question, answer, title, points, hunt_id, reveal_answer, solution, flag_template, cooldown_seconds, answer_type, category FROM questions WHERE id = ?`, id).
+		Scan(&qn.ID, &qn.Question, &qn.Answer, &qn.Title, &qn.Points, &qn.HuntID, &qn.RevealAnswer, &qn.Solution, &qn.FlagTemplate, &qn.Cooldown, &qn.AnswerType, &qn.Category)
+	return qn, err
+}
+
+// ListQuestions returns the ID, title, points and category of every
+// question of a hunt, cheapest first
+func (q *Queries) ListQuestions(ctx context.Context, huntID int) ([]Question, error) {
+	return collect(q, ctx, func(rows *sql.Rows, qn *Question) error {
+		qn.HuntID = huntID
+		return rows.Scan(&qn.ID, &qn.Title, &qn.Points, &qn.Category)
+	}, `SELECT id, title, points, category FROM questions WHERE hunt_id = ? ORDER BY points ASC`, huntID)
+}
+
+// CountQuestions counts the questions in a hunt
+func (q *Queries) CountQuestions(ctx context.Context, huntID int) (int, error) {
+	return q.count(ctx, `SELECT COUNT(*) FROM questions WHERE hunt_id = ?`, huntID)
+}
+
+// UpdateQuestion overwrites a question's title, text, points, answer,
+// solution, flag template, cooldown, answer type and category
+func (q *Queries) UpdateQuestion(ctx context.Context, qn Question) error {
+	_, err := q.exec(ctx, `UPDATE questions SET title = ?, question = ?, points = ?, answer = ?, reveal_answer = ?, solution = ?, flag_template = ?, cooldown_seconds = ?, answer_type = ?, category = ? WHERE id = ?`,
+		qn.Title, qn.Question, qn.Points, qn.Answer, qn.RevealAnswer, qn.Solution, qn.FlagTemplate, qn.Cooldown, qn.AnswerType, qn.Category, qn.ID)
+	return err
+}
+
+// listQuestionsWithStatusQuery answers each status column with a lookup
+// per question, which the question status indexes keep cheap
+const listQuestionsWithStatusQuery = `SELECT q.id, q.question, q.answer, q.title, q.points, q.category,
+		CASE WHEN EXISTS (SELECT 1 FROM team_completed_questions c WHERE c.team_id = ? AND c.question_id = q.id) THEN 1 ELSE 0 END as solved,
+		CASE WHEN ql.question_id IS NOT NULL THEN 1 ELSE 0 END as locked,
+		COALESCE(ql.locked_by_team_id, 0) as locked_by_team_id,
+		COALESCE(t.name, '') as locked_by_name,
+		CASE WHEN ql.locked_by_team_id = ? THEN 1 ELSE 0 END as locked_by_me,
+		CASE WHEN EXISTS (SELECT 1 FROM team_completed_questions c WHERE c.question_id = q.id) THEN 1 ELSE 0 END as solved_by_anyone,
+		CASE WHEN EXISTS (SELECT 1 FROM team_skipped_questions s WHERE s.team_id = ? AND s.question_id = q.id) THEN 1 ELSE 0 END as skipped,
+		COALESCE((SELECT i.path FROM images i WHERE i.parent_question_id = q.id ORDER BY i.position, i.id LIMIT 1), '') as thumbnail,
+		COALESCE(qc.mode, '') as checkpoint,
+		CASE WHEN EXISTS (SELECT 1 FROM checkpoint_scans cs WHERE cs.team_id = ? AND cs.question_id = q.id) THEN 1 ELSE 0 END as scanned
+		FROM questions q
+		LEFT JOIN question_locks ql ON q.id = ql.question_id AND ql.locked_at >= ?
+		LEFT JOIN teams t ON ql.locked_by_team_id = t.id
+		LEFT JOIN question_checkpoints qc ON qc.question_id = q.id
+		WHERE q.hunt_id = ?
+		ORDER BY q.points ASC`
+
+// ListQuestionsWithStatus returns every question of a hunt with whether
+// teamID solved it, who holds its lock and whether anyone solved it,
+// cheapest first. Locks taken before lockCutoff are ignored. Thumbnail is
+// the key of the first image
+func (q *Queries) ListQuestionsWithStatus(ctx context.Context, huntID, teamID int, lockCutoff time.Time) ([]QuestionWithStatus, error) {
+	return collect(q, ctx, func(rows *sql.Rows, qs *QuestionWithStatus) error {
+		var solved, locked, lockedByMe, solvedByAnyone, skipped, scanned int
+		err := rows.Scan(&qs.ID, &qs.Question, &qs.Answer, &qs.Title, &qs.Points, &qs.Category, &solved, &locked,
+			&qs.LockedByTeamID, &qs.LockedByName, &lockedByMe, &solvedByAnyone, &skipped, &qs.Thumbnail,
+			&qs.Checkpoint, &scanned)
+		qs.Solved = solved == 1
+		qs.Locked = locked == 1
+		qs.LockedByMe = lockedByMe == 1
+		qs.SolvedByAnyone = solvedByAnyone == 1
+		qs.Skipped = skipped == 1
+		qs.Scanned = scanned == 1
+		return err
+	}, listQuestionsWithStatusQuery, teamID, teamID, teamID, teamID, lockCutoff, huntID)
+}
+
+// questionDependents are the rows referencing a question, in the order
+// they must go
+var questionDependents = []struct {
+	what  string
+	query string
+}{
+	{"completed questions", `DELETE FROM team_completed_questions WHERE question_id = ?`},
+	{"skipped questions", `DELETE FROM team_skipped_questions WHERE question_id = ?`},
+	{"question feedback", `DELETE FROM question_feedback WHERE question_id = ?`},
+	{"clarifications", `DELETE FROM clarifications WHERE question_id = ?`},
+	{"question locks", `DELETE FROM question_locks WHERE question_id = ?`},
+	{"question timers", `DELETE FROM question_timers WHERE question_id = ?`},
+	{"question attempts", `DELETE FROM question_attempts WHERE question_id = ?`},
+	{"hint unlocks", `DELETE FROM team_hint_unlocked WHERE hint_id IN (SELECT id FROM hints WHERE parent_question_id = ?)`},
+	{"images", `DELETE FROM images WHERE parent_question_id = ?`},
+	{"audios", `DELETE FROM audios WHERE parent_question_id = ?`},
+	{"videos", `DELETE FROM videos WHERE parent_question_id = ?`},
+	{"files", `DELETE FROM files WHERE parent_question_id = ?`},
+	{"hints", `DELETE FROM hints WHERE parent_question_id = ?`},
+	{"writeup files", `DELETE FROM writeup_files WHERE writeup_id IN (SELECT id FROM writeups WHERE question_id = ?)`},
+	{"writeups", `DELETE FROM writeups WHERE question_id = ?`},
+	{"team flags", `DELETE FROM team_flags WHERE question_id = ?`},
+	{"submissions", `DELETE FROM submissions WHERE question_id = ?`},
+	{"alerts", `DELETE FROM alerts WHERE question_id = ?`},
+	{"solve reviews", `DELETE FROM solve_reviews WHERE question_id = ?`},
+	{"checkpoint scans", `DELETE FROM checkpoint_scans WHERE question_id = ?`},
+	{"checkpoint", `DELETE FROM question_checkpoints WHERE question_id = ?`},
+	{"geofence", `DELETE FROM question_geofences WHERE question_id = ?`},
+	{"photo submissions", `DELETE FROM photo_submissions WHERE question_id = ?`},
+}
+
+// DeleteQuestion deletes a question and every row referencing it,
+// reporting whether the question existed. Stored media objects are left
+// to the caller. Run it in a transaction so a failure part way leaves the
+// question whole
+func (q *Queries) DeleteQuestion(ctx context.Context, id int) (bool, error) {
+	for _, dep := range questionDependents {
+		if _, err := q.exec(ctx, dep.query, repeatArg(id, dep.query)...); err != nil {
+			return false, fmt.Errorf("failed to delete %s: %v", dep.what, err)
+		}
+	}
+
+	n, err := q.execAffected(ctx, `DELETE FROM questions WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete question: %v", err)
+	}
+	return n > 0, nil
+}
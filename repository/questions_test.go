@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/namishh/holmes/database"
+)
+
+// The scale of a large hunt: every team loads the question list on each
+// visit to the hunt page
+const (
+	benchQuestions = 100
+	benchTeams     = 500
+)
+
+// seedStatusBench creates an in-memory database through the migrations and
+// fills its first hunt with benchQuestions questions and benchTeams teams.
+// Each team has solved a third of the questions and skipped a few, every
+// question has an image, and some are locked or are checkpoints
+func seedStatusBench(b *testing.B) *Queries {
+	b.Helper()
+	db, err := sql.Open("sqlite3", "file::memory:?_foreign_keys=on")
+	if err != nil {
+		b.Fatal(err)
+	}
+	// Every connection to :memory: opens a database of its own
+	db.SetMaxOpenConns(1)
+	b.Cleanup(func() { db.Close() })
+	if err := database.Migrate(db); err != nil {
+		b.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tx.Rollback()
+	repo := New(db).WithTx(tx)
+
+	now := time.Now()
+	questions := make([]int, benchQuestions)
+	for i := range questions {
+		id, err := repo.CreateQuestion(ctx, Question{Question: "Question", Answer: "answer", Title: fmt.Sprintf("Question %d", i), Points: 10 * (i + 1), HuntID: 1})
+		if err != nil {
+			b.Fatal(err)
+		}
+		questions[i] = id
+		if err := repo.InsertArchiveMedia(ctx, "images", id, 0, fmt.Sprintf("question-%d.png", i), "", ""); err != nil {
+			b.Fatal(err)
+		}
+		if i%10 == 0 {
+			if err := repo.SetCheckpoint(ctx, id, "unlock", false, "secret", now); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	for i := 0; i < benchTeams; i++ {
+		team := ArchiveTeam{Email: fmt.Sprintf("team-%d@example.com", i), Password: "password", Name: fmt.Sprintf("Team %d", i), CreatedAt: &now}
+		id, err := repo.InsertArchiveTeam(ctx, 1, team)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for j, question := range questions {
+			switch (i + j) % 3 {
+			case 0:
+				err = repo.InsertArchiveSolve(ctx, ArchiveSolve{TeamID: id, QuestionID: question, CompletedAt: &now})
+			case 1:
+				if j%7 == 0 {
+					_, err = repo.SkipQuestion(ctx, id, question)
+				}
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		if i < benchQuestions/5 {
+			if _, err := repo.CreateLock(ctx, questions[i], id, now, now); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := repo.RecordCheckpointScan(ctx, id, questions[i-i%10], now); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	return New(db)
+}
+
+// BenchmarkListQuestionsWithStatus times the hunt page's question list for
+// one team. The joins case runs the query as it was before the solved
+// columns became EXISTS lookups, against the same data, for comparison:
+//
+//	go test ./repository -run '^$' -bench ListQuestionsWithStatus
+func BenchmarkListQuestionsWithStatus(b *testing.B) {
+	repo := seedStatusBench(b)
+	ctx := context.Background()
+	cutoff := time.Now().Add(-time.Hour)
+
+	b.Run("exists", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			qs, err := repo.ListQuestionsWithStatus(ctx, 1, 1+i%benchTeams, cutoff)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(qs) != benchQuestions {
+				b.Fatalf("got %d questions, want %d", len(qs), benchQuestions)
+			}
+		}
+	})
+
+	joins := strings.NewReplacer(
+		`CASE WHEN EXISTS (SELECT 1 FROM team_completed_questions c WHERE c.team_id = ? AND c.question_id = q.id) THEN 1 ELSE 0 END as solved`,
+		`CASE WHEN tcq_mine.team_id IS NOT NULL THEN 1 ELSE 0 END as solved`,
+		`CASE WHEN EXISTS (SELECT 1 FROM team_completed_questions c WHERE c.question_id = q.id) THEN 1 ELSE 0 END as solved_by_anyone`,
+		`CASE WHEN tcq_any.question_id IS NOT NULL THEN 1 ELSE 0 END as solved_by_anyone`,
+		`FROM questions q`,
+		`FROM questions q
+		LEFT JOIN team_completed_questions tcq_mine ON q.id = tcq_mine.question_id AND tcq_mine.team_id = ?
+		LEFT JOIN (SELECT DISTINCT question_id FROM team_completed_questions) tcq_any ON q.id = tcq_any.question_id`,
+	).Replace(listQuestionsWithStatusQuery)
+
+	// Both forms must agree before their times mean anything
+	want, err := repo.ListQuestionsWithStatus(ctx, 1, 1, cutoff)
+	if err != nil {
+		b.Fatal(err)
+	}
+	got, err := collect(repo, ctx, func(rows *sql.Rows, qs *QuestionWithStatus) error {
+		var solved, locked, lockedByMe, solvedByAnyone, skipped, scanned int
+		err := rows.Scan(&qs.ID, &qs.Question, &qs.Answer, &qs.Title, &qs.Points, &qs.Category, &solved, &locked,
+			&qs.LockedByTeamID, &qs.LockedByName, &lockedByMe, &solvedByAnyone, &skipped, &qs.Thumbnail,
+			&qs.Checkpoint, &scanned)
+		qs.Solved = solved == 1
+		qs.SolvedByAnyone = solvedByAnyone == 1
+		return err
+	}, joins, 1, 1, 1, 1, cutoff, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if len(got) != len(want) {
+		b.Fatalf("joins returned %d questions, exists %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].Solved != want[i].Solved || got[i].SolvedByAnyone != want[i].SolvedByAnyone {
+			b.Fatalf("question %d: joins says solved %t and by anyone %t, exists %t and %t",
+				want[i].ID, got[i].Solved, got[i].SolvedByAnyone, want[i].Solved, want[i].SolvedByAnyone)
+		}
+	}
+
+	b.Run("joins", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			team := 1 + i%benchTeams
+			rows, err := repo.query(ctx, joins, team, team, team, team, cutoff, 1)
+			if err != nil {
+				b.Fatal(err)
+			}
+			n := 0
+			for rows.Next() {
+				n++
+			}
+			rows.Close()
+			if n != benchQuestions {
+				b.Fatalf("got %d questions, want %d", n, benchQuestions)
+			}
+		}
+	})
+}
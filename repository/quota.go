@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// QuotaSlot is a team's current quota window
+type QuotaSlot struct {
+	TeamID                int       `json:"team_id"`
+	CurrentSlotStart      time.Time `json:"current_slot_start"`
+	QuestionsSolvedInSlot int       `json:"questions_solved_in_slot"`
+}
+
+// GetQuotaSlot returns a team's quota window, or sql.ErrNoRows before its first
+func (q *Queries) GetQuotaSlot(ctx context.Context, teamID int) (QuotaSlot, error) {
+	var s QuotaSlot
+	err := q.queryRow(ctx, `SELECT team_id, current_slot_start, questions_solved_in_slot FROM team_quota_slots WHERE team_id = ?`, teamID).
+		Scan(&s.TeamID, &s.CurrentSlotStart, &s.QuestionsSolvedInSlot)
+	return s, err
+}
+
+// CreateQuotaSlot opens a team's first quota window
+func (q *Queries) CreateQuotaSlot(ctx context.Context, teamID int, start time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO team_quota_slots (team_id, current_slot_start, questions_solved_in_slot) VALUES (?, ?, 0)`, teamID, start)
+	return err
+}
+
+// ResetQuotaSlot starts a new, empty quota window for a team
+func (q *Queries) ResetQuotaSlot(ctx context.Context, teamID int, start time.Time) error {
+	_, err := q.exec(ctx, `UPDATE team_quota_slots SET current_slot_start = ?, questions_solved_in_slot = 0 WHERE team_id = ?`, start, teamID)
+	return err
+}
+
+// IncrementQuota counts a solve against a team's current window
+func (q *Queries) IncrementQuota(ctx context.Context, teamID int) error {
+	_, err := q.exec(ctx, `UPDATE team_quota_slots SET questions_solved_in_slot = questions_solved_in_slot + 1 WHERE team_id = ?`, teamID)
+	return err
+}
+
+// ListExhaustedQuotaTeams returns the teams that solved at least limit
+// questions in a window started at or before cutoff
+func (q *Queries) ListExhaustedQuotaTeams(ctx context.Context, limit int, cutoff time.Time) ([]int, error) {
+	return collect(q, ctx, scanInt, `SELECT team_id FROM team_quota_slots
+		WHERE questions_solved_in_slot >= ? AND current_slot_start <= ?`, limit, cutoff)
+}
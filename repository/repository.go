@@ -0,0 +1,106 @@
+// Package repository holds the queries behind the services, one file per
+// table. Queries are written once with ? placeholders and rebound for
+// PostgreSQL here, so services call typed methods instead of building SQL
+// and scanning rows themselves. Nothing in this package logs; errors are
+// returned for the caller to report
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/namishh/holmes/database"
+)
+
+// DBTX is what Queries runs against: a *sql.DB or a *sql.Tx
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Queries runs the typed queries of every table
+type Queries struct {
+	db DBTX
+}
+
+// New returns Queries running against db
+func New(db DBTX) *Queries {
+	return &Queries{db: db}
+}
+
+// WithTx returns Queries running inside tx, so several of them commit or
+// roll back together
+func (q *Queries) WithTx(tx *sql.Tx) *Queries {
+	return &Queries{db: tx}
+}
+
+func (q *Queries) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return q.db.ExecContext(ctx, database.ConvertPlaceholders(query), args...)
+}
+
+func (q *Queries) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return q.db.QueryContext(ctx, database.ConvertPlaceholders(query), args...)
+}
+
+func (q *Queries) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return q.db.QueryRowContext(ctx, database.ConvertPlaceholders(query), args...)
+}
+
+// execAffected runs a statement and returns how many rows it changed
+func (q *Queries) execAffected(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	result, err := q.exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// count runs a query selecting a single integer
+func (q *Queries) count(ctx context.Context, query string, args ...interface{}) (int, error) {
+	var n int
+	err := q.queryRow(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+// collect runs a query and scans each row with scan
+func collect[T any](q *Queries, ctx context.Context, scan func(*sql.Rows, *T) error, query string, args ...interface{}) ([]T, error) {
+	rows, err := q.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		var item T
+		if err := scan(rows, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// scanInt scans a row holding a single integer
+func scanInt(rows *sql.Rows, n *int) error {
+	return rows.Scan(n)
+}
+
+// repeatArg passes v for every placeholder in query
+func repeatArg(v interface{}, query string) []interface{} {
+	args := make([]interface{}, strings.Count(query, "?"))
+	for i := range args {
+		args[i] = v
+	}
+	return args
+}
+
+// GetSchemaVersion returns the highest applied migration. Unlike
+// database.SchemaVersion it never creates the schema_version table
+func (q *Queries) GetSchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := q.queryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
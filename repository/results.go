@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// HuntResult is a team's final standing, saved when its hunt ended
+type HuntResult struct {
+	HuntID           int       `json:"hunt_id"`
+	Place            int       `json:"place"`
+	TeamName         string    `json:"team_name"`
+	Points           int       `json:"points"`
+	QuestionsSolved  int       `json:"questions_solved"`
+	TotalTimeSeconds int       `json:"total_time_seconds"`
+	TotalPenalty     int       `json:"total_penalty"`
+	NetScore         int       `json:"net_score"`
+	HuntEnd          time.Time `json:"hunt_end"`
+}
+
+// CountResults returns how many standings of a hunt are saved for a hunt end
+func (q *Queries) CountResults(ctx context.Context, huntID int, huntEnd time.Time) (int, error) {
+	return q.count(ctx, `SELECT COUNT(*) FROM hunt_results WHERE hunt_id = ? AND hunt_end = ?`, huntID, huntEnd)
+}
+
+// SaveResult saves a team's final standing
+func (q *Queries) SaveResult(ctx context.Context, r HuntResult) error {
+	_, err := q.exec(ctx, `INSERT INTO hunt_results
+		(hunt_id, hunt_end, place, team_name, points, questions_solved, total_time_seconds, total_penalty, net_score)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.HuntID, r.HuntEnd, r.Place, r.TeamName, r.Points, r.QuestionsSolved, r.TotalTimeSeconds, r.TotalPenalty, r.NetScore)
+	return err
+}
+
+// LatestResults returns the standings of a hunt saved at its most recent
+// end, best first
+func (q *Queries) LatestResults(ctx context.Context, huntID int) ([]HuntResult, error) {
+	return collect(q, ctx, func(rows *sql.Rows, r *HuntResult) error {
+		return rows.Scan(&r.HuntID, &r.HuntEnd, &r.Place, &r.TeamName, &r.Points, &r.QuestionsSolved, &r.TotalTimeSeconds, &r.TotalPenalty, &r.NetScore)
+	}, `SELECT hunt_id, hunt_end, place, team_name, points, questions_solved, total_time_seconds, total_penalty, net_score
+		FROM hunt_results
+		WHERE hunt_id = ? AND hunt_end = (SELECT MAX(hunt_end) FROM hunt_results WHERE hunt_id = ?)
+		ORDER BY place`, huntID, huntID)
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ListTeamsToPurge returns the teams of a hunt registered before it ended.
+// With anonymized false, teams that were already anonymized are left out
+func (q *Queries) ListTeamsToPurge(ctx context.Context, huntID int, ended time.Time, anonymized bool) ([]int, error) {
+	query := `SELECT id FROM teams WHERE hunt_id = ? AND created_at < ?`
+	if !anonymized {
+		query += ` AND anonymized_at IS NULL`
+	}
+	return collect(q, ctx, scanInt, query+` ORDER BY id`, huntID, ended)
+}
+
+// teamContacts deletes what reaches a team's players outside the hunt and
+// the mail and texts sent to them, which are kept by address
+var teamContacts = []struct {
+	what  string
+	query string
+}{
+	{"emails", `DELETE FROM emails WHERE recipient = (SELECT email FROM teams WHERE id = ?)`},
+	{"text messages", `DELETE FROM sms_messages WHERE recipient IN (SELECT phone FROM team_phones WHERE team_id = ?)`},
+	{"push subscriptions", `DELETE FROM push_subscriptions WHERE team_id = ?`},
+	{"telegram chats", `DELETE FROM telegram_chats WHERE team_id = ?`},
+	{"team phones", `DELETE FROM team_phones WHERE team_id = ?`},
+	{"email tokens", `DELETE FROM email_tokens WHERE team_id = ?`},
+	{"logins", `DELETE FROM logins WHERE team_id = ?`},
+}
+
+// DeleteTeamContacts deletes a team's contact details, the mail and texts
+// sent to it and the addresses it signed in from
+func (q *Queries) DeleteTeamContacts(ctx context.Context, id int) error {
+	for _, c := range teamContacts {
+		if _, err := q.exec(ctx, c.query, repeatArg(id, c.query)...); err != nil {
+			return fmt.Errorf("failed to delete %s: %v", c.what, err)
+		}
+	}
+	return nil
+}
+
+// AnonymizeTeam strips a team of what identifies its players: its contact
+// details, the addresses it played from, its avatar and its password, so
+// it can't be signed in to again. Its name, solves and standings stay
+func (q *Queries) AnonymizeTeam(ctx context.Context, id int, at time.Time) error {
+	if err := q.DeleteTeamContacts(ctx, id); err != nil {
+		return err
+	}
+	if _, err := q.exec(ctx, `UPDATE submissions SET ip = '' WHERE team_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to clear submission addresses: %v", err)
+	}
+	if _, err := q.exec(ctx, `UPDATE photo_submissions SET ip = '' WHERE team_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to clear photo addresses: %v", err)
+	}
+	_, err := q.exec(ctx, `UPDATE teams SET email = ?, password = '', registration_ip = '', fingerprint = '', avatar = '', email_verified_at = NULL, anonymized_at = ? WHERE id = ?`,
+		fmt.Sprintf("anonymized-%d@invalid", id), at, id)
+	if err != nil {
+		return fmt.Errorf("failed to anonymize team: %v", err)
+	}
+	return nil
+}
+
+// DeleteSubmissionsBefore deletes the answers a hunt's teams sent before
+// cutoff, returning how many were deleted
+func (q *Queries) DeleteSubmissionsBefore(ctx context.Context, huntID int, cutoff time.Time) (int64, error) {
+	return q.execAffected(ctx, `DELETE FROM submissions WHERE created_at < ? AND team_id IN (SELECT id FROM teams WHERE hunt_id = ?)`, cutoff, huntID)
+}
+
+// DeleteLoginsBefore deletes the sign-ins of a hunt's teams recorded
+// before cutoff, returning how many were deleted
+func (q *Queries) DeleteLoginsBefore(ctx context.Context, huntID int, cutoff time.Time) (int64, error) {
+	return q.execAffected(ctx, `DELETE FROM logins WHERE created_at < ? AND team_id IN (SELECT id FROM teams WHERE hunt_id = ?)`, cutoff, huntID)
+}
+
+// DeleteSentMessagesBefore deletes the emails and texts sent to a hunt's
+// teams before cutoff, returning how many were deleted. Unsent ones are
+// left to the outboxes
+func (q *Queries) DeleteSentMessagesBefore(ctx context.Context, huntID int, cutoff time.Time) (int64, error) {
+	emails, err := q.execAffected(ctx, `DELETE FROM emails WHERE sent_at IS NOT NULL AND created_at < ?
+		AND recipient IN (SELECT email FROM teams WHERE hunt_id = ?)`, cutoff, huntID)
+	if err != nil {
+		return 0, err
+	}
+	texts, err := q.execAffected(ctx, `DELETE FROM sms_messages WHERE sent_at IS NOT NULL AND created_at < ?
+		AND recipient IN (SELECT p.phone FROM team_phones p JOIN teams t ON t.id = p.team_id WHERE t.hunt_id = ?)`, cutoff, huntID)
+	return emails + texts, err
+}
+
+// DeleteStaleEmailTokens deletes the emailed links that were used or have
+// expired by now, returning how many were deleted
+func (q *Queries) DeleteStaleEmailTokens(ctx context.Context, now time.Time) (int64, error) {
+	return q.execAffected(ctx, `DELETE FROM email_tokens WHERE used_at IS NOT NULL OR expires_at < ?`, now)
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SolveReview is a solve by a team flagged for review, waiting for an
+// admin to let it stand or take it back. Points are what it earns once
+// approved. Status is pending, approved or rejected
+type SolveReview struct {
+	ID            int        `json:"id"`
+	TeamID        int        `json:"team_id"`
+	TeamName      string     `json:"team_name"`
+	QuestionID    int        `json:"question_id"`
+	QuestionTitle string     `json:"question_title"`
+	Points        int        `json:"points"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+}
+
+// CreateSolveReview queues a solve for review
+func (q *Queries) CreateSolveReview(ctx context.Context, r SolveReview) error {
+	_, err := q.exec(ctx, `INSERT INTO solve_reviews (team_id, question_id, points, status, created_at) VALUES (?, ?, ?, ?, ?)`,
+		r.TeamID, r.QuestionID, r.Points, r.Status, r.CreatedAt)
+	return err
+}
+
+const solveReviewColumns = `SELECT r.id, r.team_id, t.name, r.question_id, qn.title, r.points, r.status, r.created_at, r.reviewed_at
+		FROM solve_reviews r
+		JOIN teams t ON t.id = r.team_id
+		JOIN questions qn ON qn.id = r.question_id`
+
+func scanSolveReview(rows interface{ Scan(...interface{}) error }, r *SolveReview) error {
+	var reviewedAt sql.NullTime
+	err := rows.Scan(&r.ID, &r.TeamID, &r.TeamName, &r.QuestionID, &r.QuestionTitle, &r.Points, &r.Status, &r.CreatedAt, &reviewedAt)
+	r.ReviewedAt = timePtr(reviewedAt)
+	return err
+}
+
+// ListSolveReviews returns the reviews of a hunt with a status, or all of
+// them when status is empty, oldest first
+func (q *Queries) ListSolveReviews(ctx context.Context, huntID int, status string) ([]SolveReview, error) {
+	return collect(q, ctx, func(rows *sql.Rows, r *SolveReview) error {
+		return scanSolveReview(rows, r)
+	}, solveReviewColumns+`
+		WHERE qn.hunt_id = ? AND (? = '' OR r.status = ?)
+		ORDER BY r.created_at, r.id`, huntID, status, status)
+}
+
+// ListTeamSolveReviews returns a team's reviews with a status, oldest first
+func (q *Queries) ListTeamSolveReviews(ctx context.Context, teamID int, status string) ([]SolveReview, error) {
+	return collect(q, ctx, func(rows *sql.Rows, r *SolveReview) error {
+		return scanSolveReview(rows, r)
+	}, solveReviewColumns+`
+		WHERE r.team_id = ? AND r.status = ?
+		ORDER BY r.created_at, r.id`, teamID, status)
+}
+
+// GetSolveReview returns a review, or sql.ErrNoRows
+func (q *Queries) GetSolveReview(ctx context.Context, id int) (SolveReview, error) {
+	var r SolveReview
+	err := scanSolveReview(q.queryRow(ctx, solveReviewColumns+` WHERE r.id = ?`, id), &r)
+	return r, err
+}
+
+// CloseSolveReview settles a pending review, reporting false when it is
+// missing or was already settled
+func (q *Queries) CloseSolveReview(ctx context.Context, id int, status string, at time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE solve_reviews SET status = ?, reviewed_at = ? WHERE id = ? AND status = 'pending'`, status, at, id)
+	return n > 0, err
+}
+
+// AdjustPendingReviewPoints changes by delta the points a team's pending
+// review of a solve would award, after the solve is regraded, reporting
+// false when the solve isn't waiting for review
+func (q *Queries) AdjustPendingReviewPoints(ctx context.Context, teamID, questionID, delta int) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE solve_reviews SET points = points + ? WHERE team_id = ? AND question_id = ? AND status = 'pending'`, delta, teamID, questionID)
+	return n > 0, err
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// RulesAcceptance is when a team accepted the rules, the version of them
+// it accepted, known by when they were last edited, and where from.
+// AcceptedAt is nil for a team that hasn't accepted them
+type RulesAcceptance struct {
+	TeamID         int        `json:"team_id"`
+	TeamName       string     `json:"team_name"`
+	RulesUpdatedAt *time.Time `json:"rules_updated_at"`
+	IP             string     `json:"ip"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+}
+
+func scanRulesAcceptance(rows *sql.Rows, a *RulesAcceptance) error {
+	var updated, accepted sql.NullTime
+	err := rows.Scan(&a.TeamID, &a.TeamName, &updated, &a.IP, &accepted)
+	a.RulesUpdatedAt = timePtr(updated)
+	a.AcceptedAt = timePtr(accepted)
+	return err
+}
+
+// AcceptRules records that a team accepted the rules; a team that already
+// did keeps its first acceptance
+func (q *Queries) AcceptRules(ctx context.Context, teamID int, rulesUpdatedAt time.Time, ip string, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO rules_acceptances (team_id, rules_updated_at, ip, accepted_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(team_id) DO NOTHING`, teamID, rulesUpdatedAt, ip, at)
+	return err
+}
+
+// CountRulesPending is 1 when the team exists and hasn't accepted the
+// rules, and 0 otherwise
+func (q *Queries) CountRulesPending(ctx context.Context, teamID int) (int, error) {
+	return q.count(ctx, `SELECT COUNT(*) FROM teams t
+		WHERE t.id = ? AND NOT EXISTS (SELECT 1 FROM rules_acceptances a WHERE a.team_id = t.id)`, teamID)
+}
+
+// GetRulesAcceptance returns a team's acceptance, or sql.ErrNoRows
+func (q *Queries) GetRulesAcceptance(ctx context.Context, teamID int) (RulesAcceptance, error) {
+	list, err := collect(q, ctx, scanRulesAcceptance, `SELECT a.team_id, COALESCE(t.name, ''), a.rules_updated_at, a.ip, a.accepted_at
+		FROM rules_acceptances a
+		LEFT JOIN teams t ON t.id = a.team_id
+		WHERE a.team_id = ?`, teamID)
+	if err != nil {
+		return RulesAcceptance{}, err
+	}
+	if len(list) == 0 {
+		return RulesAcceptance{}, sql.ErrNoRows
+	}
+	return list[0], nil
+}
+
+// ListRulesAcceptances returns every team of a hunt with its acceptance,
+// the teams that accepted first in the order they did
+func (q *Queries) ListRulesAcceptances(ctx context.Context, huntID int) ([]RulesAcceptance, error) {
+	return collect(q, ctx, scanRulesAcceptance, `SELECT t.id, t.name, a.rules_updated_at, COALESCE(a.ip, ''), a.accepted_at
+		FROM teams t
+		LEFT JOIN rules_acceptances a ON a.team_id = t.id
+		WHERE t.hunt_id = ?
+		ORDER BY CASE WHEN a.accepted_at IS NULL THEN 1 ELSE 0 END, a.accepted_at, t.name`, huntID)
+}
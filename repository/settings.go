@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ListSettings returns every stored setting by key
+func (q *Queries) ListSettings(ctx context.Context) (map[string]string, error) {
+	type setting struct{ key, value string }
+	rows, err := collect(q, ctx, func(rows *sql.Rows, s *setting) error {
+		return rows.Scan(&s.key, &s.value)
+	}, `SELECT key, value FROM settings`)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]string, len(rows))
+	for _, s := range rows {
+		settings[s.key] = s.value
+	}
+	return settings, nil
+}
+
+// SetSetting stores a setting, replacing its previous value
+func (q *Queries) SetSetting(ctx context.Context, key, value string, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`, key, value, at)
+	return err
+}
+
+// DeleteSetting removes a setting, so its default applies again
+func (q *Queries) DeleteSetting(ctx context.Context, key string) error {
+	_, err := q.exec(ctx, `DELETE FROM settings WHERE key = ?`, key)
+	return err
+}
@@ -0,0 +1,23 @@
+package repository
+
+import "context"
+
+// SkipQuestion records that a team bypassed a question, reporting false if
+// it already had
+func (q *Queries) SkipQuestion(ctx context.Context, teamID, questionID int) (bool, error) {
+	n, err := q.execAffected(ctx, `INSERT INTO team_skipped_questions (team_id, question_id) VALUES (?, ?)
+		ON CONFLICT (team_id, question_id) DO NOTHING`, teamID, questionID)
+	return n > 0, err
+}
+
+// IsSkipped reports whether a team bypassed a question
+func (q *Queries) IsSkipped(ctx context.Context, teamID, questionID int) (bool, error) {
+	n, err := q.count(ctx, `SELECT COUNT(*) FROM team_skipped_questions WHERE team_id = ? AND question_id = ?`, teamID, questionID)
+	return n > 0, err
+}
+
+// CountTeamSkips counts the questions a team bypassed, which is how many
+// of its skip tokens are spent
+func (q *Queries) CountTeamSkips(ctx context.Context, teamID int) (int, error) {
+	return q.count(ctx, `SELECT COUNT(*) FROM team_skipped_questions WHERE team_id = ?`, teamID)
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSkipQuestionTwice(t *testing.T) {
+	q := newTestQueries(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	teamID, err := q.InsertArchiveTeam(ctx, 1, ArchiveTeam{Email: "team@example.com", Password: "password", Name: "Team", CreatedAt: &now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	questionID, err := q.CreateQuestion(ctx, Question{Question: "Question", Answer: "answer", Title: "Question", Points: 10, HuntID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []bool{true, false} {
+		skipped, err := q.SkipQuestion(ctx, teamID, questionID)
+		if err != nil {
+			t.Fatalf("skip %d: %v", i+1, err)
+		}
+		if skipped != want {
+			t.Fatalf("skip %d reported %v, want %v", i+1, skipped, want)
+		}
+	}
+
+	n, err := q.CountTeamSkips(ctx, teamID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("team has %d skips, want 1", n)
+	}
+}
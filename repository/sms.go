@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TeamPhone is the number a team gets text messages on, once confirmed
+type TeamPhone struct {
+	TeamID        int
+	TeamName      string
+	Phone         string
+	CodeHash      string
+	CodeExpiresAt *time.Time
+	CodeAttempts  int
+	VerifiedAt    *time.Time
+	CreatedAt     time.Time
+}
+
+// SMS is a text message in the outbox, kept after it is sent
+type SMS struct {
+	ID            int        `json:"id"`
+	Recipient     string     `json:"recipient"`
+	Kind          string     `json:"kind"`
+	Body          string     `json:"-"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// SetTeamPhone replaces a team's number with an unconfirmed one and the
+// hash of the code that confirms it
+func (q *Queries) SetTeamPhone(ctx context.Context, teamID int, phone, codeHash string, expiresAt, at time.Time) error {
+	if _, err := q.exec(ctx, `DELETE FROM team_phones WHERE team_id = ?`, teamID); err != nil {
+		return err
+	}
+	_, err := q.exec(ctx, `INSERT INTO team_phones (team_id, phone, code_hash, code_expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)`, teamID, phone, codeHash, expiresAt, at)
+	return err
+}
+
+// GetTeamPhone returns a team's number, or sql.ErrNoRows
+func (q *Queries) GetTeamPhone(ctx context.Context, teamID int) (TeamPhone, error) {
+	var p TeamPhone
+	var expires, verified sql.NullTime
+	err := q.queryRow(ctx, `SELECT p.team_id, COALESCE(t.name, ''), p.phone, p.code_hash, p.code_expires_at,
+			p.code_attempts, p.verified_at, p.created_at
+		FROM team_phones p
+		LEFT JOIN teams t ON t.id = p.team_id
+		WHERE p.team_id = ?`, teamID).
+		Scan(&p.TeamID, &p.TeamName, &p.Phone, &p.CodeHash, &expires, &p.CodeAttempts, &verified, &p.CreatedAt)
+	p.CodeExpiresAt = timePtr(expires)
+	p.VerifiedAt = timePtr(verified)
+	return p, err
+}
+
+// CountPhoneCodeAttempt counts a wrong guess at a team's confirmation code
+func (q *Queries) CountPhoneCodeAttempt(ctx context.Context, teamID int) error {
+	_, err := q.exec(ctx, `UPDATE team_phones SET code_attempts = code_attempts + 1 WHERE team_id = ?`, teamID)
+	return err
+}
+
+// VerifyTeamPhone confirms a team's number and forgets its code
+func (q *Queries) VerifyTeamPhone(ctx context.Context, teamID int, at time.Time) error {
+	_, err := q.exec(ctx, `UPDATE team_phones SET verified_at = ?, code_hash = '', code_expires_at = NULL
+		WHERE team_id = ?`, at, teamID)
+	return err
+}
+
+// DeleteTeamPhone removes a team's number
+func (q *Queries) DeleteTeamPhone(ctx context.Context, teamID int) error {
+	_, err := q.exec(ctx, `DELETE FROM team_phones WHERE team_id = ?`, teamID)
+	return err
+}
+
+// ListVerifiedPhones returns every confirmed number of a hunt's teams with
+// its team, or of every team when huntID is 0
+func (q *Queries) ListVerifiedPhones(ctx context.Context, huntID int) ([]TeamPhone, error) {
+	return collect(q, ctx, func(rows *sql.Rows, p *TeamPhone) error {
+		var verified sql.NullTime
+		err := rows.Scan(&p.TeamID, &p.TeamName, &p.Phone, &verified, &p.CreatedAt)
+		p.VerifiedAt = timePtr(verified)
+		return err
+	}, `SELECT p.team_id, t.name, p.phone, p.verified_at, p.created_at
+		FROM team_phones p
+		JOIN teams t ON t.id = p.team_id
+		WHERE p.verified_at IS NOT NULL AND (? = 0 OR t.hunt_id = ?)
+		ORDER BY p.team_id`, huntID, huntID)
+}
+
+// CreateSMS queues a text message, due at once
+func (q *Queries) CreateSMS(ctx context.Context, recipient, kind, body string, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO sms_messages (recipient, kind, body, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?)`, recipient, kind, body, at, at)
+	return err
+}
+
+const smsColumns = `id, recipient, kind, body, attempts, last_error, next_attempt_at, sent_at, created_at`
+
+func scanSMS(rows *sql.Rows, m *SMS) error {
+	var sent sql.NullTime
+	err := rows.Scan(&m.ID, &m.Recipient, &m.Kind, &m.Body, &m.Attempts, &m.LastError,
+		&m.NextAttemptAt, &sent, &m.CreatedAt)
+	m.SentAt = timePtr(sent)
+	return err
+}
+
+// ListDueSMS returns unsent messages with fewer than maxAttempts attempts
+// whose next attempt is due by now, oldest due first
+func (q *Queries) ListDueSMS(ctx context.Context, maxAttempts int, now time.Time, limit int) ([]SMS, error) {
+	return collect(q, ctx, scanSMS, `SELECT `+smsColumns+`
+		FROM sms_messages
+		WHERE sent_at IS NULL AND attempts < ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?`, maxAttempts, now, limit)
+}
+
+// ListRecentSMS returns the latest messages, newest first
+func (q *Queries) ListRecentSMS(ctx context.Context, limit int) ([]SMS, error) {
+	return collect(q, ctx, scanSMS, `SELECT `+smsColumns+`
+		FROM sms_messages
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?`, limit)
+}
+
+// RecordSMSAttempt counts an attempt at sending a message, marking it
+// sent or storing why it failed and when to try again
+func (q *Queries) RecordSMSAttempt(ctx context.Context, id int, lastError string, sentAt *time.Time, nextAttempt time.Time) error {
+	_, err := q.exec(ctx, `UPDATE sms_messages
+		SET attempts = attempts + 1, last_error = ?, sent_at = ?, next_attempt_at = ?
+		WHERE id = ?`, lastError, sentAt, nextAttempt, id)
+	return err
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Spectator is a row of spectators: a read-only account for someone
+// watching a hunt. Password is the bcrypt hash
+type Spectator struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Password  string    `json:"-"`
+	HuntID    int       `json:"hunt_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SpectatorQuestion is a question as spectators see it: no body or answer
+type SpectatorQuestion struct {
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	Points int    `json:"points"`
+	Solves int    `json:"solves"`
+}
+
+// CreateSpectator inserts a spectator of a hunt
+func (q *Queries) CreateSpectator(ctx context.Context, name, email, passwordHash string, huntID int, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO spectators (name, email, password, hunt_id, created_at) VALUES (?, ?, ?, ?, ?)`,
+		name, email, passwordHash, huntID, at)
+	return err
+}
+
+// GetSpectator returns the spectator with an ID, or sql.ErrNoRows
+func (q *Queries) GetSpectator(ctx context.Context, id int) (Spectator, error) {
+	var s Spectator
+	err := q.queryRow(ctx, `SELECT id, name, email, password, hunt_id, created_at FROM spectators WHERE id = ?`, id).
+		Scan(&s.ID, &s.Name, &s.Email, &s.Password, &s.HuntID, &s.CreatedAt)
+	return s, err
+}
+
+// GetSpectatorByEmail returns the spectator with an email, or sql.ErrNoRows
+func (q *Queries) GetSpectatorByEmail(ctx context.Context, email string) (Spectator, error) {
+	var s Spectator
+	err := q.queryRow(ctx, `SELECT id, name, email, password, hunt_id, created_at FROM spectators WHERE email = ?`, email).
+		Scan(&s.ID, &s.Name, &s.Email, &s.Password, &s.HuntID, &s.CreatedAt)
+	return s, err
+}
+
+// ListSpectators returns the spectators of a hunt, newest first
+func (q *Queries) ListSpectators(ctx context.Context, huntID int) ([]Spectator, error) {
+	return collect(q, ctx, func(rows *sql.Rows, s *Spectator) error {
+		return rows.Scan(&s.ID, &s.Name, &s.Email, &s.HuntID, &s.CreatedAt)
+	}, `SELECT id, name, email, hunt_id, created_at FROM spectators WHERE hunt_id = ? ORDER BY id DESC`, huntID)
+}
+
+// DeleteSpectator removes a spectator, reporting whether one existed
+func (q *Queries) DeleteSpectator(ctx context.Context, id int) (bool, error) {
+	n, err := q.execAffected(ctx, `DELETE FROM spectators WHERE id = ?`, id)
+	return n > 0, err
+}
+
+// ListSpectatorQuestions returns the titles and points of a hunt's
+// questions with how many teams solved each
+func (q *Queries) ListSpectatorQuestions(ctx context.Context, huntID int) ([]SpectatorQuestion, error) {
+	return collect(q, ctx, func(rows *sql.Rows, s *SpectatorQuestion) error {
+		return rows.Scan(&s.ID, &s.Title, &s.Points, &s.Solves)
+	}, `SELECT q.id, q.title, q.points,
+		(SELECT COUNT(*) FROM team_completed_questions c WHERE c.question_id = q.id)
+		FROM questions q WHERE q.hunt_id = ? ORDER BY q.points ASC`, huntID)
+}
@@ -0,0 +1,31 @@
+package repository
+
+import "context"
+
+// IncrementStreak counts a correct answer towards a team's streak,
+// returning the streak it makes
+func (q *Queries) IncrementStreak(ctx context.Context, teamID int) (int, error) {
+	if _, err := q.exec(ctx, `UPDATE teams SET streak = streak + 1 WHERE id = ?`, teamID); err != nil {
+		return 0, err
+	}
+	return q.GetTeamStreak(ctx, teamID)
+}
+
+// ResetStreak ends a team's streak
+func (q *Queries) ResetStreak(ctx context.Context, teamID int) error {
+	_, err := q.exec(ctx, `UPDATE teams SET streak = 0 WHERE id = ?`, teamID)
+	return err
+}
+
+// GetTeamStreak returns how many answers in a row a team got right
+func (q *Queries) GetTeamStreak(ctx context.Context, teamID int) (int, error) {
+	var streak int
+	err := q.queryRow(ctx, `SELECT streak FROM teams WHERE id = ?`, teamID).Scan(&streak)
+	return streak, err
+}
+
+// SetSolveBonus records the streak bonus a team's solve earned
+func (q *Queries) SetSolveBonus(ctx context.Context, teamID, questionID, bonus int) error {
+	_, err := q.exec(ctx, `UPDATE team_completed_questions SET bonus = ? WHERE team_id = ? AND question_id = ?`, bonus, teamID, questionID)
+	return err
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Submission is one answer a team submitted. Answers are logged under
+// AnswerHash, a hash of their normalized form; only a wrong one keeps its
+// text in Answer, so the flag is never stored
+type Submission struct {
+	ID            int       `json:"id"`
+	TeamID        int       `json:"team_id"`
+	TeamName      string    `json:"team_name,omitempty"`
+	QuestionID    int       `json:"question_id"`
+	QuestionTitle string    `json:"question_title,omitempty"`
+	AnswerHash    string    `json:"answer_hash"`
+	Answer        string    `json:"answer,omitempty"`
+	Correct       bool      `json:"correct"`
+	Penalty       int       `json:"penalty"`
+	IP            string    `json:"ip"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// CreateSubmission logs a submitted answer
+func (q *Queries) CreateSubmission(ctx context.Context, s Submission) error {
+	_, err := q.exec(ctx, `INSERT INTO submissions (team_id, question_id, answer_hash, answer, correct, penalty, ip, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, s.TeamID, s.QuestionID, s.AnswerHash, s.Answer, s.Correct, s.Penalty, s.IP, s.CreatedAt)
+	return err
+}
+
+// ListSubmissions returns the latest submissions in a hunt, newest first,
+// only those of one team or question when teamID or questionID is set
+func (q *Queries) ListSubmissions(ctx context.Context, huntID, teamID, questionID, limit int) ([]Submission, error) {
+	where := `t.hunt_id = ?`
+	args := []interface{}{huntID}
+	if teamID != 0 {
+		where += ` AND s.team_id = ?`
+		args = append(args, teamID)
+	}
+	if questionID != 0 {
+		where += ` AND s.question_id = ?`
+		args = append(args, questionID)
+	}
+	args = append(args, limit)
+	return collect(q, ctx, func(rows *sql.Rows, s *Submission) error {
+		return rows.Scan(&s.ID, &s.TeamID, &s.TeamName, &s.QuestionID, &s.QuestionTitle, &s.AnswerHash, &s.Answer, &s.Correct, &s.Penalty, &s.IP, &s.CreatedAt)
+	}, `SELECT s.id, s.team_id, t.name, s.question_id, COALESCE(qn.title, ''), s.answer_hash, s.answer, s.correct, s.penalty, s.ip, s.created_at
+		FROM submissions s
+		JOIN teams t ON t.id = s.team_id
+		LEFT JOIN questions qn ON qn.id = s.question_id
+		WHERE `+where+`
+		ORDER BY s.created_at DESC, s.id DESC
+		LIMIT ?`, args...)
+}
+
+// ListTeamSubmissions returns a team's answers to a question, newest first
+func (q *Queries) ListTeamSubmissions(ctx context.Context, teamID, questionID int) ([]Submission, error) {
+	return collect(q, ctx, func(rows *sql.Rows, s *Submission) error {
+		return rows.Scan(&s.ID, &s.TeamID, &s.QuestionID, &s.AnswerHash, &s.Answer, &s.Correct, &s.Penalty, &s.IP, &s.CreatedAt)
+	}, `SELECT id, team_id, question_id, answer_hash, answer, correct, penalty, ip, created_at
+		FROM submissions
+		WHERE team_id = ? AND question_id = ?
+		ORDER BY created_at DESC, id DESC`, teamID, questionID)
+}
+
+// ListWrongAnswerTeams returns the teams that submitted a wrong answer
+// with a hash to a question since a time, earliest first
+func (q *Queries) ListWrongAnswerTeams(ctx context.Context, questionID int, answerHash string, since time.Time) ([]int, error) {
+	return collect(q, ctx, func(rows *sql.Rows, id *int) error {
+		return rows.Scan(id)
+	}, `SELECT team_id FROM submissions
+		WHERE question_id = ? AND answer_hash = ? AND correct = ? AND created_at >= ?
+		GROUP BY team_id
+		ORDER BY MIN(created_at)`, questionID, answerHash, false, since)
+}
@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Team is a row of teams. Password is the bcrypt hash
+type Team struct {
+	ID       int
+	Email    string
+	Password string
+	Name     string
+	Points   int
+	HuntID   int
+
+	// StartedAt is when the team's own clock started, if it has
+	StartedAt sql.NullTime
+
+	// SuspendedAt is when an admin suspended the team, if one has
+	SuspendedAt sql.NullTime
+
+	// FlaggedAt is when an admin flagged the team for review, if one has
+	FlaggedAt sql.NullTime
+
+	// Avatar is the storage key of the team's avatar, empty without one
+	Avatar string
+}
+
+// CreateTeam inserts a team with no points into a hunt, along with the
+// address and browser fingerprint it registered from, empty when unknown
+func (q *Queries) CreateTeam(ctx context.Context, email, passwordHash, name string, huntID int, ip, fingerprint string) error {
+	_, err := q.exec(ctx, `INSERT INTO teams (email, password, name, points, hunt_id, registration_ip, fingerprint) VALUES (?, ?, ?, 0, ?, ?, ?)`,
+		email, passwordHash, name, huntID, ip, fingerprint)
+	return err
+}
+
+// GetTeamByName returns the team with a name, or sql.ErrNoRows
+func (q *Queries) GetTeamByName(ctx context.Context, name string) (Team, error) {
+	var t Team
+	err := q.queryRow(ctx, `SELECT id, email, password, name, points, hunt_id, avatar FROM teams WHERE name = ?`, name).
+		Scan(&t.ID, &t.Email, &t.Password, &t.Name, &t.Points, &t.HuntID, &t.Avatar)
+	return t, err
+}
+
+// GetTeamByEmail returns the team with an email, or sql.ErrNoRows
+func (q *Queries) GetTeamByEmail(ctx context.Context, email string) (Team, error) {
+	var t Team
+	err := q.queryRow(ctx, `SELECT id, email, password, name, points, hunt_id FROM teams WHERE email = ?`, email).
+		Scan(&t.ID, &t.Email, &t.Password, &t.Name, &t.Points, &t.HuntID)
+	return t, err
+}
+
+// GetTeamName returns a team's name, or sql.ErrNoRows
+func (q *Queries) GetTeamName(ctx context.Context, id int) (string, error) {
+	var name string
+	err := q.queryRow(ctx, `SELECT name FROM teams WHERE id = ?`, id).Scan(&name)
+	return name, err
+}
+
+// ListTeams returns every team of a hunt without its password hash
+func (q *Queries) ListTeams(ctx context.Context, huntID int) ([]Team, error) {
+	return collect(q, ctx, func(rows *sql.Rows, t *Team) error {
+		return rows.Scan(&t.ID, &t.Email, &t.Name, &t.Points, &t.HuntID, &t.StartedAt, &t.SuspendedAt, &t.FlaggedAt, &t.Avatar)
+	}, `SELECT id, email, name, points, hunt_id, started_at, suspended_at, flagged_at, avatar FROM teams WHERE hunt_id = ? ORDER BY id`, huntID)
+}
+
+// GetTeamAvatar returns the storage key of a team's avatar, or sql.ErrNoRows
+func (q *Queries) GetTeamAvatar(ctx context.Context, id int) (string, error) {
+	var key string
+	err := q.queryRow(ctx, `SELECT avatar FROM teams WHERE id = ?`, id).Scan(&key)
+	return key, err
+}
+
+// SetTeamAvatar sets the storage key of a team's avatar, reporting whether
+// the team exists
+func (q *Queries) SetTeamAvatar(ctx context.Context, id int, key string) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE teams SET avatar = ? WHERE id = ?`, key, id)
+	return n > 0, err
+}
+
+// AvatarInUse reports whether a team's avatar is stored under key
+func (q *Queries) AvatarInUse(ctx context.Context, key string) (bool, error) {
+	n, err := q.count(ctx, `SELECT COUNT(*) FROM teams WHERE avatar = ?`, key)
+	return n > 0, err
+}
+
+// ListAvatars returns the storage keys of every team's avatar
+func (q *Queries) ListAvatars(ctx context.Context) ([]string, error) {
+	return collect(q, ctx, func(rows *sql.Rows, key *string) error {
+		return rows.Scan(key)
+	}, `SELECT avatar FROM teams WHERE avatar != ''`)
+}
+
+// Registration is how a team signed up, for spotting duplicate accounts
+type Registration struct {
+	TeamID      int          `json:"team_id"`
+	TeamName    string       `json:"team_name"`
+	Email       string       `json:"email"`
+	IP          string       `json:"ip"`
+	Fingerprint string       `json:"fingerprint"`
+	CreatedAt   time.Time    `json:"created_at"`
+	SuspendedAt sql.NullTime `json:"-"`
+}
+
+// ListRegistrations returns how every team of a hunt signed up, oldest first
+func (q *Queries) ListRegistrations(ctx context.Context, huntID int) ([]Registration, error) {
+	return collect(q, ctx, func(rows *sql.Rows, r *Registration) error {
+		return rows.Scan(&r.TeamID, &r.TeamName, &r.Email, &r.IP, &r.Fingerprint, &r.CreatedAt, &r.SuspendedAt)
+	}, `SELECT id, name, email, registration_ip, fingerprint, created_at, suspended_at FROM teams WHERE hunt_id = ? ORDER BY id`, huntID)
+}
+
+// GetTeamSuspended returns when a team was suspended, or sql.ErrNoRows when
+// there is no such team
+func (q *Queries) GetTeamSuspended(ctx context.Context, id int) (sql.NullTime, error) {
+	var at sql.NullTime
+	err := q.queryRow(ctx, `SELECT suspended_at FROM teams WHERE id = ?`, id).Scan(&at)
+	return at, err
+}
+
+// SetTeamSuspended suspends a team from at, or lifts its suspension,
+// reporting whether the team exists
+func (q *Queries) SetTeamSuspended(ctx context.Context, id int, at sql.NullTime) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE teams SET suspended_at = ? WHERE id = ?`, at, id)
+	return n > 0, err
+}
+
+// GetTeamFlagged returns when a team was flagged for review, or
+// sql.ErrNoRows when there is no such team
+func (q *Queries) GetTeamFlagged(ctx context.Context, id int) (sql.NullTime, error) {
+	var at sql.NullTime
+	err := q.queryRow(ctx, `SELECT flagged_at FROM teams WHERE id = ?`, id).Scan(&at)
+	return at, err
+}
+
+// SetTeamFlagged flags a team for review from at, or clears it, reporting
+// whether the team exists
+func (q *Queries) SetTeamFlagged(ctx context.Context, id int, at sql.NullTime) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE teams SET flagged_at = ? WHERE id = ?`, at, id)
+	return n > 0, err
+}
+
+// MoveTeamHistory hands a team's submission and login history to another
+// team, so it outlives the team when it is merged away
+func (q *Queries) MoveTeamHistory(ctx context.Context, from, into int) error {
+	for _, table := range []string{"submissions", "logins"} {
+		if _, err := q.exec(ctx, `UPDATE `+table+` SET team_id = ? WHERE team_id = ?`, into, from); err != nil {
+			return fmt.Errorf("failed to move %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// CountTeams counts the teams registered in a hunt
+func (q *Queries) CountTeams(ctx context.Context, huntID int) (int, error) {
+	return q.count(ctx, `SELECT COUNT(*) FROM teams WHERE hunt_id = ?`, huntID)
+}
+
+// GetTeamStart returns when a team's own clock started, or sql.ErrNoRows
+// when there is no such team
+func (q *Queries) GetTeamStart(ctx context.Context, id int) (sql.NullTime, error) {
+	var at sql.NullTime
+	err := q.queryRow(ctx, `SELECT started_at FROM teams WHERE id = ?`, id).Scan(&at)
+	return at, err
+}
+
+// StartTeamClock starts a team's clock at at unless it already started,
+// reporting whether it did
+func (q *Queries) StartTeamClock(ctx context.Context, id int, at time.Time) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE teams SET started_at = ? WHERE id = ? AND started_at IS NULL`, at, id)
+	return n > 0, err
+}
+
+// SetTeamStart sets when a team's clock starts, or clears it so it starts
+// again at the team's next visit, reporting whether the team exists
+func (q *Queries) SetTeamStart(ctx context.Context, id int, at sql.NullTime) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE teams SET started_at = ? WHERE id = ?`, at, id)
+	return n > 0, err
+}
+
+// AddTeamPoints changes a team's points by delta, which may be negative
+func (q *Queries) AddTeamPoints(ctx context.Context, id, delta int) error {
+	_, err := q.exec(ctx, `UPDATE teams SET points = points + ? WHERE id = ?`, delta, id)
+	return err
+}
+
+// SpendTeamPoints takes points from a team that has at least that many,
+// reporting false when it hasn't
+func (q *Queries) SpendTeamPoints(ctx context.Context, id, points int) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE teams SET points = points - ? WHERE id = ? AND points >= ?`, points, id, points)
+	return n > 0, err
+}
+
+// SetTeamLastAnswered records when a team last answered correctly, which
+// breaks leaderboard ties
+func (q *Queries) SetTeamLastAnswered(ctx context.Context, id int, at time.Time) error {
+	_, err := q.exec(ctx, `UPDATE teams SET last_answered_question = ? WHERE id = ?`, at, id)
+	return err
+}
+
+// AddSolvePoints adds a solve's points and its time in one statement
+func (q *Queries) AddSolvePoints(ctx context.Context, id, points int, at time.Time) error {
+	_, err := q.exec(ctx, `UPDATE teams SET points = points + ?, last_answered_question = ? WHERE id = ?`, points, at, id)
+	return err
+}
+
+// teamDependents are the rows referencing a team, in the order they must go
+var teamDependents = []struct {
+	what  string
+	query string
+}{
+	{"completed questions", `DELETE FROM team_completed_questions WHERE team_id = ?`},
+	{"question locks", `DELETE FROM question_locks WHERE locked_by_team_id = ?`},
+	{"question timers", `DELETE FROM question_timers WHERE team_id = ?`},
+	{"question attempts", `DELETE FROM question_attempts WHERE team_id = ?`},
+	{"hint unlocks", `DELETE FROM team_hint_unlocked WHERE team_id = ?`},
+	{"quota slots", `DELETE FROM team_quota_slots WHERE team_id = ?`},
+	// Read markers of the team, and of its own notifications by anyone
+	{"notification reads", `DELETE FROM notification_reads WHERE team_id = ? OR notification_id IN (SELECT id FROM notifications WHERE team_id = ?)`},
+	{"notifications", `DELETE FROM notifications WHERE team_id = ?`},
+	{"push subscriptions", `DELETE FROM push_subscriptions WHERE team_id = ?`},
+	// The team's messages and everything in its private channel
+	{"chat messages", `DELETE FROM chat_messages WHERE team_id = ? OR channel = ?`},
+	{"chat mute", `DELETE FROM chat_mutes WHERE team_id = ?`},
+	{"writeup files", `DELETE FROM writeup_files WHERE writeup_id IN (SELECT id FROM writeups WHERE team_id = ?)`},
+	{"writeups", `DELETE FROM writeups WHERE team_id = ?`},
+	{"team flags", `DELETE FROM team_flags WHERE team_id = ?`},
+	{"submissions", `DELETE FROM submissions WHERE team_id = ?`},
+	{"logins", `DELETE FROM logins WHERE team_id = ?`},
+	{"alerts", `DELETE FROM alerts WHERE team_id = ? OR other_team_id = ?`},
+	{"solve reviews", `DELETE FROM solve_reviews WHERE team_id = ?`},
+	{"achievements", `DELETE FROM team_achievements WHERE team_id = ?`},
+	{"power-ups", `DELETE FROM team_powerups WHERE team_id = ?`},
+	{"skipped questions", `DELETE FROM team_skipped_questions WHERE team_id = ?`},
+	{"question feedback", `DELETE FROM question_feedback WHERE team_id = ?`},
+	{"clarifications", `DELETE FROM clarifications WHERE team_id = ?`},
+	{"email tokens", `DELETE FROM email_tokens WHERE team_id = ?`},
+	{"telegram chats", `DELETE FROM telegram_chats WHERE team_id = ?`},
+	{"team phones", `DELETE FROM team_phones WHERE team_id = ?`},
+	{"rules acceptances", `DELETE FROM rules_acceptances WHERE team_id = ?`},
+	{"checkpoint scans", `DELETE FROM checkpoint_scans WHERE team_id = ?`},
+	{"photo submissions", `DELETE FROM photo_submissions WHERE team_id = ?`},
+}
+
+// DeleteTeam deletes a team and every row referencing it, reporting
+// whether the team existed. Run it in a transaction so a failure part way
+// leaves the team whole
+func (q *Queries) DeleteTeam(ctx context.Context, id int) (bool, error) {
+	for _, dep := range teamDependents {
+		if _, err := q.exec(ctx, dep.query, repeatArg(id, dep.query)...); err != nil {
+			return false, fmt.Errorf("failed to delete %s: %v", dep.what, err)
+		}
+	}
+
+	n, err := q.execAffected(ctx, `DELETE FROM teams WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete team: %v", err)
+	}
+	return n > 0, nil
+}
+
+// huntProgress is what teams build up while playing, in the order it
+// must go
+var huntProgress = []struct {
+	what  string
+	query string
+}{
+	{"completed questions", `DELETE FROM team_completed_questions`},
+	{"question locks", `DELETE FROM question_locks`},
+	{"question timers", `DELETE FROM question_timers`},
+	{"question attempts", `DELETE FROM question_attempts`},
+	{"hint unlocks", `DELETE FROM team_hint_unlocked`},
+	{"quota slots", `DELETE FROM team_quota_slots`},
+	{"notification reads", `DELETE FROM notification_reads`},
+	{"notifications", `DELETE FROM notifications`},
+	{"chat messages", `DELETE FROM chat_messages`},
+	{"chat mutes", `DELETE FROM chat_mutes`},
+	{"writeup files", `DELETE FROM writeup_files`},
+	{"writeups", `DELETE FROM writeups`},
+	{"team flags", `DELETE FROM team_flags`},
+	{"submissions", `DELETE FROM submissions`},
+	{"alerts", `DELETE FROM alerts`},
+	{"solve reviews", `DELETE FROM solve_reviews`},
+	{"achievements", `DELETE FROM team_achievements`},
+	{"power-ups", `DELETE FROM team_powerups`},
+	{"skipped questions", `DELETE FROM team_skipped_questions`},
+	{"question feedback", `DELETE FROM question_feedback`},
+	{"clarifications", `DELETE FROM clarifications`},
+	{"checkpoint scans", `DELETE FROM checkpoint_scans`},
+	{"photo submissions", `DELETE FROM photo_submissions`},
+	{"final results", `DELETE FROM hunt_results`},
+}
+
+// ResetProgress deletes every team's progress and sets their points back
+// to zero as of at. Run it in a transaction so a failure part way leaves
+// the hunt as it was
+func (q *Queries) ResetProgress(ctx context.Context, at time.Time) error {
+	for _, p := range huntProgress {
+		if _, err := q.exec(ctx, p.query); err != nil {
+			return fmt.Errorf("failed to delete %s: %v", p.what, err)
+		}
+	}
+
+	if _, err := q.exec(ctx, `UPDATE teams SET points = 0, streak = 0, last_answered_question = ?, started_at = NULL`, at); err != nil {
+		return fmt.Errorf("failed to reset points: %v", err)
+	}
+	return nil
+}
+
+// DeleteAllTeams deletes every team once ResetProgress has removed their
+// progress, returning how many there were
+func (q *Queries) DeleteAllTeams(ctx context.Context) (int64, error) {
+	if _, err := q.exec(ctx, `DELETE FROM push_subscriptions`); err != nil {
+		return 0, fmt.Errorf("failed to delete push subscriptions: %v", err)
+	}
+
+	n, err := q.execAffected(ctx, `DELETE FROM teams`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete teams: %v", err)
+	}
+	return n, nil
+}
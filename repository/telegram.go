@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TelegramChat is a Telegram chat linked to a team
+type TelegramChat struct {
+	ID        int
+	TeamID    int
+	TeamName  string
+	ChatID    int64
+	Username  string
+	CreatedAt time.Time
+}
+
+const telegramChatColumns = `c.id, c.team_id, COALESCE(t.name, ''), c.chat_id, c.username, c.created_at`
+
+func scanTelegramChat(rows *sql.Rows, c *TelegramChat) error {
+	return rows.Scan(&c.ID, &c.TeamID, &c.TeamName, &c.ChatID, &c.Username, &c.CreatedAt)
+}
+
+// LinkTelegramChat links a chat to a team, moving it off any team it was
+// linked to before
+func (q *Queries) LinkTelegramChat(ctx context.Context, teamID int, chatID int64, username string, at time.Time) error {
+	if _, err := q.exec(ctx, `DELETE FROM telegram_chats WHERE chat_id = ?`, chatID); err != nil {
+		return err
+	}
+	_, err := q.exec(ctx, `INSERT INTO telegram_chats (team_id, chat_id, username, created_at) VALUES (?, ?, ?, ?)`,
+		teamID, chatID, username, at)
+	return err
+}
+
+// GetTelegramChat returns a linked chat with its team, or sql.ErrNoRows
+func (q *Queries) GetTelegramChat(ctx context.Context, chatID int64) (TelegramChat, error) {
+	var c TelegramChat
+	err := q.queryRow(ctx, `SELECT `+telegramChatColumns+`
+		FROM telegram_chats c
+		LEFT JOIN teams t ON t.id = c.team_id
+		WHERE c.chat_id = ?`, chatID).
+		Scan(&c.ID, &c.TeamID, &c.TeamName, &c.ChatID, &c.Username, &c.CreatedAt)
+	return c, err
+}
+
+// ListTelegramChats returns the chats linked to a team, or to any team
+// when teamID is 0
+func (q *Queries) ListTelegramChats(ctx context.Context, teamID int) ([]TelegramChat, error) {
+	if teamID != 0 {
+		return collect(q, ctx, scanTelegramChat, `SELECT `+telegramChatColumns+`
+			FROM telegram_chats c
+			LEFT JOIN teams t ON t.id = c.team_id
+			WHERE c.team_id = ?
+			ORDER BY c.id`, teamID)
+	}
+	return collect(q, ctx, scanTelegramChat, `SELECT `+telegramChatColumns+`
+		FROM telegram_chats c
+		LEFT JOIN teams t ON t.id = c.team_id
+		ORDER BY c.id`)
+}
+
+// UnlinkTelegramChat unlinks one chat
+func (q *Queries) UnlinkTelegramChat(ctx context.Context, chatID int64) error {
+	_, err := q.exec(ctx, `DELETE FROM telegram_chats WHERE chat_id = ?`, chatID)
+	return err
+}
+
+// UnlinkTeamTelegramChats unlinks every chat of a team
+func (q *Queries) UnlinkTeamTelegramChats(ctx context.Context, teamID int) error {
+	_, err := q.exec(ctx, `DELETE FROM telegram_chats WHERE team_id = ?`, teamID)
+	return err
+}
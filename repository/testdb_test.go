@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/namishh/holmes/database"
+)
+
+// newTestQueries runs a test's queries in a transaction that is rolled
+// back when it ends. The database is an in-memory SQLite one, or the
+// PostgreSQL one in HOLMES_TEST_DATABASE_URL when that is set, so the
+// dialect rewrites are exercised too
+func newTestQueries(t *testing.T) *Queries {
+	t.Helper()
+
+	var (
+		db  *sql.DB
+		err error
+	)
+	if url := os.Getenv("HOLMES_TEST_DATABASE_URL"); url != "" {
+		database.Configure(database.Config{URL: url})
+		t.Cleanup(func() { database.Configure(database.Config{}) })
+		db, err = sql.Open("postgres", url)
+	} else {
+		db, err = sql.Open("sqlite3", "file::memory:?_foreign_keys=on")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !database.IsPostgres() {
+		// Every connection to :memory: opens a database of its own
+		db.SetMaxOpenConns(1)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return New(db).WithTx(tx)
+}
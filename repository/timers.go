@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// TimerExists reports whether a team has opened a question
+func (q *Queries) TimerExists(ctx context.Context, teamID, questionID int) (bool, error) {
+	n, err := q.count(ctx, `SELECT COUNT(*) FROM question_timers WHERE team_id = ? AND question_id = ?`, teamID, questionID)
+	return n > 0, err
+}
+
+// CreateTimer starts a team's timer on a question
+func (q *Queries) CreateTimer(ctx context.Context, teamID, questionID int, startedAt time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO question_timers (team_id, question_id, started_at) VALUES (?, ?, ?)`, teamID, questionID, startedAt)
+	return err
+}
+
+// GetTimerStart returns when a team opened a question, or sql.ErrNoRows
+func (q *Queries) GetTimerStart(ctx context.Context, teamID, questionID int) (time.Time, error) {
+	var startedAt time.Time
+	err := q.queryRow(ctx, `SELECT started_at FROM question_timers WHERE team_id = ? AND question_id = ?`, teamID, questionID).Scan(&startedAt)
+	return startedAt, err
+}
+
+// SetTimerStart moves when a team opened a question
+func (q *Queries) SetTimerStart(ctx context.Context, teamID, questionID int, startedAt time.Time) error {
+	_, err := q.exec(ctx, `UPDATE question_timers SET started_at = ? WHERE team_id = ? AND question_id = ?`, startedAt, teamID, questionID)
+	return err
+}
+
+// CompleteTimer stops a team's timer on a question
+func (q *Queries) CompleteTimer(ctx context.Context, teamID, questionID int, completedAt time.Time, seconds int) error {
+	_, err := q.exec(ctx, `UPDATE question_timers SET completed_at = ?, time_taken_seconds = ? WHERE team_id = ? AND question_id = ?`,
+		completedAt, seconds, teamID, questionID)
+	return err
+}
+
+// SumSolveTime adds up the seconds a team took over its solved questions
+func (q *Queries) SumSolveTime(ctx context.Context, teamID int) (int, error) {
+	return q.count(ctx, `SELECT COALESCE(SUM(time_taken_seconds), 0) FROM question_timers WHERE team_id = ? AND completed_at IS NOT NULL`, teamID)
+}
+
+// GetSolveTime returns the seconds a team took to solve a question, or
+// sql.ErrNoRows if it hasn't
+func (q *Queries) GetSolveTime(ctx context.Context, teamID, questionID int) (int, error) {
+	return q.count(ctx, `SELECT COALESCE(time_taken_seconds, 0) FROM question_timers WHERE team_id = ? AND question_id = ? AND completed_at IS NOT NULL`, teamID, questionID)
+}
+
+// DeleteTimer resets a team's timer on a question
+func (q *Queries) DeleteTimer(ctx context.Context, teamID, questionID int) error {
+	_, err := q.exec(ctx, `DELETE FROM question_timers WHERE question_id = ? AND team_id = ?`, questionID, teamID)
+	return err
+}
+
+// DeleteUnsolvedTimers resets the timers on a question of every team that
+// hasn't solved it, returning how many went
+func (q *Queries) DeleteUnsolvedTimers(ctx context.Context, questionID int) (int64, error) {
+	return q.execAffected(ctx, `DELETE FROM question_timers
+		WHERE question_id = ?
+		AND team_id NOT IN (SELECT team_id FROM team_completed_questions WHERE question_id = ?)`, questionID, questionID)
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Webhook is a row of webhooks. Events are stored comma separated; none
+// means every event
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Format    string    `json:"format"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event queued for one webhook, with the webhook's
+// URL and secret
+type WebhookDelivery struct {
+	ID            int       `json:"id"`
+	WebhookID     int       `json:"webhook_id"`
+	URL           string    `json:"url"`
+	Secret        string    `json:"-"`
+	Event         string    `json:"event"`
+	Payload       string    `json:"payload"`
+	Attempts      int       `json:"attempts"`
+	StatusCode    int       `json:"status_code"`
+	LastError     string    `json:"last_error"`
+	Delivered     bool      `json:"delivered"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// CreateWebhook inserts a webhook
+func (q *Queries) CreateWebhook(ctx context.Context, w Webhook) error {
+	_, err := q.exec(ctx, `INSERT INTO webhooks (url, secret, events, format, created_at) VALUES (?, ?, ?, ?, ?)`,
+		w.URL, w.Secret, strings.Join(w.Events, ","), w.Format, w.CreatedAt)
+	return err
+}
+
+// ListWebhooks returns every webhook
+func (q *Queries) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	return collect(q, ctx, func(rows *sql.Rows, w *Webhook) error {
+		var events string
+		if err := rows.Scan(&w.ID, &w.URL, &w.Secret, &events, &w.Format, &w.CreatedAt); err != nil {
+			return err
+		}
+		if events != "" {
+			w.Events = strings.Split(events, ",")
+		}
+		return nil
+	}, `SELECT id, url, secret, events, format, created_at FROM webhooks ORDER BY id`)
+}
+
+// DeleteWebhook deletes a webhook's deliveries, then the webhook
+func (q *Queries) DeleteWebhook(ctx context.Context, id int) error {
+	if _, err := q.exec(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+		return err
+	}
+	_, err := q.exec(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+	return err
+}
+
+// CreateWebhookDelivery queues a payload for a webhook, due at once
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, webhookID int, event, payload string, at time.Time) error {
+	_, err := q.exec(ctx, `INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?)`, webhookID, event, payload, at, at)
+	return err
+}
+
+const webhookDeliveryColumns = `d.id, d.webhook_id, w.url, w.secret, d.event, d.payload, d.attempts,
+	d.status_code, COALESCE(d.last_error, ''), d.delivered, d.next_attempt_at, d.created_at`
+
+func scanWebhookDelivery(rows *sql.Rows, d *WebhookDelivery) error {
+	var delivered int
+	err := rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.Event, &d.Payload, &d.Attempts,
+		&d.StatusCode, &d.LastError, &delivered, &d.NextAttemptAt, &d.CreatedAt)
+	d.Delivered = delivered == 1
+	return err
+}
+
+// ListDueWebhookDeliveries returns undelivered deliveries with fewer than
+// maxAttempts attempts whose next attempt is due by now, oldest due first
+func (q *Queries) ListDueWebhookDeliveries(ctx context.Context, maxAttempts int, now time.Time, limit int) ([]WebhookDelivery, error) {
+	return collect(q, ctx, scanWebhookDelivery, `SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.delivered = 0 AND d.attempts < ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?`, maxAttempts, now, limit)
+}
+
+// ListRecentWebhookDeliveries returns the latest deliveries, newest first
+func (q *Queries) ListRecentWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	return collect(q, ctx, scanWebhookDelivery, `SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		ORDER BY d.created_at DESC, d.id DESC
+		LIMIT ?`, limit)
+}
+
+// RecordWebhookAttempt counts an attempt at a delivery and stores its outcome
+func (q *Queries) RecordWebhookAttempt(ctx context.Context, id, statusCode int, lastError string, delivered bool, nextAttempt time.Time) error {
+	d := 0
+	if delivered {
+		d = 1
+	}
+	_, err := q.exec(ctx, `UPDATE webhook_deliveries
+		SET attempts = attempts + 1, status_code = ?, last_error = ?, delivered = ?, next_attempt_at = ?
+		WHERE id = ?`, statusCode, lastError, d, nextAttempt, id)
+	return err
+}
+
+// DeferWebhookDelivery puts a delivery off until nextAttempt without
+// counting an attempt, for a receiver that asked to be sent less
+func (q *Queries) DeferWebhookDelivery(ctx context.Context, id, statusCode int, lastError string, nextAttempt time.Time) error {
+	_, err := q.exec(ctx, `UPDATE webhook_deliveries
+		SET status_code = ?, last_error = ?, next_attempt_at = ?
+		WHERE id = ?`, statusCode, lastError, nextAttempt, id)
+	return err
+}
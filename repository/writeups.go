@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Writeup is a team's account of how it solved a question, written after
+// the hunt. Status is pending until an admin approves or rejects it
+type Writeup struct {
+	ID            int           `json:"id"`
+	TeamID        int           `json:"team_id"`
+	TeamName      string        `json:"team_name"`
+	QuestionID    int           `json:"question_id"`
+	QuestionTitle string        `json:"question_title"`
+	Body          string        `json:"body"`
+	Status        string        `json:"status"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+	Files         []WriteupFile `json:"files"`
+}
+
+// WriteupFile is a file attached to a writeup
+type WriteupFile struct {
+	ID        int    `json:"id"`
+	WriteupID int    `json:"writeup_id"`
+	Path      string `json:"path"`
+	Name      string `json:"name"`
+}
+
+const writeupColumns = `w.id, w.team_id, t.name, w.question_id, q.title, w.body, w.status, w.created_at, w.updated_at
+	FROM writeups w
+	JOIN teams t ON t.id = w.team_id
+	JOIN questions q ON q.id = w.question_id`
+
+func scanWriteup(rows *sql.Rows, w *Writeup) error {
+	return rows.Scan(&w.ID, &w.TeamID, &w.TeamName, &w.QuestionID, &w.QuestionTitle, &w.Body, &w.Status, &w.CreatedAt, &w.UpdatedAt)
+}
+
+// CreateWriteup inserts a writeup and returns its ID
+func (q *Queries) CreateWriteup(ctx context.Context, w Writeup) (int, error) {
+	var id int
+	err := q.queryRow(ctx, `INSERT INTO writeups (team_id, question_id, body, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id`,
+		w.TeamID, w.QuestionID, w.Body, w.Status, w.CreatedAt, w.UpdatedAt).Scan(&id)
+	return id, err
+}
+
+// UpdateWriteup replaces the body and status of a writeup
+func (q *Queries) UpdateWriteup(ctx context.Context, id int, body, status string, at time.Time) error {
+	_, err := q.exec(ctx, `UPDATE writeups SET body = ?, status = ?, updated_at = ? WHERE id = ?`, body, status, at, id)
+	return err
+}
+
+// GetWriteup returns a writeup without its files, or sql.ErrNoRows
+func (q *Queries) GetWriteup(ctx context.Context, id int) (Writeup, error) {
+	var w Writeup
+	err := q.queryRow(ctx, `SELECT `+writeupColumns+` WHERE w.id = ?`, id).
+		Scan(&w.ID, &w.TeamID, &w.TeamName, &w.QuestionID, &w.QuestionTitle, &w.Body, &w.Status, &w.CreatedAt, &w.UpdatedAt)
+	return w, err
+}
+
+// GetTeamWriteup returns a team's writeup of a question without its
+// files, or sql.ErrNoRows
+func (q *Queries) GetTeamWriteup(ctx context.Context, teamID, questionID int) (Writeup, error) {
+	var w Writeup
+	err := q.queryRow(ctx, `SELECT `+writeupColumns+` WHERE w.team_id = ? AND w.question_id = ?`, teamID, questionID).
+		Scan(&w.ID, &w.TeamID, &w.TeamName, &w.QuestionID, &w.QuestionTitle, &w.Body, &w.Status, &w.CreatedAt, &w.UpdatedAt)
+	return w, err
+}
+
+// ListWriteups returns the writeups of a hunt's questions with a status,
+// or with any status when it is empty, by question and then oldest first
+func (q *Queries) ListWriteups(ctx context.Context, huntID int, status string) ([]Writeup, error) {
+	where, args := `q.hunt_id = ?`, []interface{}{huntID}
+	if status != "" {
+		where, args = where+` AND w.status = ?`, append(args, status)
+	}
+	return collect(q, ctx, scanWriteup, `SELECT `+writeupColumns+`
+		WHERE `+where+`
+		ORDER BY q.points, q.id, w.created_at, w.id`, args...)
+}
+
+// SetWriteupStatus sets the status of a writeup, reporting whether it
+// exists
+func (q *Queries) SetWriteupStatus(ctx context.Context, id int, status string) (bool, error) {
+	n, err := q.execAffected(ctx, `UPDATE writeups SET status = ? WHERE id = ?`, status, id)
+	return n > 0, err
+}
+
+// DeleteWriteup deletes a writeup and its files, reporting whether it
+// existed. Run it in a transaction so the files don't outlive it
+func (q *Queries) DeleteWriteup(ctx context.Context, id int) (bool, error) {
+	if _, err := q.exec(ctx, `DELETE FROM writeup_files WHERE writeup_id = ?`, id); err != nil {
+		return false, err
+	}
+	n, err := q.execAffected(ctx, `DELETE FROM writeups WHERE id = ?`, id)
+	return n > 0, err
+}
+
+// AddWriteupFile attaches a stored file to a writeup
+func (q *Queries) AddWriteupFile(ctx context.Context, writeupID int, path, name string) error {
+	_, err := q.exec(ctx, `INSERT INTO writeup_files (writeup_id, path, name) VALUES (?, ?, ?)`, writeupID, path, name)
+	return err
+}
+
+// DeleteWriteupFile removes a file from a writeup, reporting whether it
+// was attached to it
+func (q *Queries) DeleteWriteupFile(ctx context.Context, writeupID, id int) (bool, error) {
+	n, err := q.execAffected(ctx, `DELETE FROM writeup_files WHERE id = ? AND writeup_id = ?`, id, writeupID)
+	return n > 0, err
+}
+
+// ListWriteupFiles returns the files of a writeup in the order they were
+// attached
+func (q *Queries) ListWriteupFiles(ctx context.Context, writeupID int) ([]WriteupFile, error) {
+	return collect(q, ctx, func(rows *sql.Rows, f *WriteupFile) error {
+		return rows.Scan(&f.ID, &f.WriteupID, &f.Path, &f.Name)
+	}, `SELECT id, writeup_id, path, name FROM writeup_files WHERE writeup_id = ? ORDER BY id`, writeupID)
+}
+
+// ListHuntWriteupFiles returns the files of every writeup of a hunt's
+// questions
+func (q *Queries) ListHuntWriteupFiles(ctx context.Context, huntID int) ([]WriteupFile, error) {
+	return collect(q, ctx, func(rows *sql.Rows, f *WriteupFile) error {
+		return rows.Scan(&f.ID, &f.WriteupID, &f.Path, &f.Name)
+	}, `SELECT f.id, f.writeup_id, f.path, f.name
+		FROM writeup_files f
+		JOIN writeups w ON w.id = f.writeup_id
+		JOIN questions q ON q.id = w.question_id
+		WHERE q.hunt_id = ?
+		ORDER BY f.id`, huntID)
+}
+
+// GetWriteupFileByPath returns the file stored under path, or
+// sql.ErrNoRows
+func (q *Queries) GetWriteupFileByPath(ctx context.Context, path string) (WriteupFile, error) {
+	var f WriteupFile
+	err := q.queryRow(ctx, `SELECT id, writeup_id, path, name FROM writeup_files WHERE path = ?`, path).
+		Scan(&f.ID, &f.WriteupID, &f.Path, &f.Name)
+	return f, err
+}
+
+// ListWriteupPaths returns the key of every writeup file
+func (q *Queries) ListWriteupPaths(ctx context.Context) ([]string, error) {
+	return collect(q, ctx, func(rows *sql.Rows, path *string) error {
+		return rows.Scan(path)
+	}, `SELECT path FROM writeup_files`)
+}
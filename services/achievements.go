@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+)
+
+// Achievement is a badge teams earn for a feat while solving
+type Achievement struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+}
+
+// Achievement keys
+const (
+	AchievementFirstBlood = "first_blood"
+	AchievementStreak     = "streak"
+	AchievementNightOwl   = "night_owl"
+	AchievementNoHints    = "no_hints"
+)
+
+const (
+	// StreakLength is how many answers in a row must be right for the
+	// streak badge
+	StreakLength = 5
+
+	// NightOwlStart and NightOwlEnd bound the hours, in server time, a
+	// solve earns the night owl badge in
+	NightOwlStart = 0
+	NightOwlEnd   = 5
+)
+
+// achievements lists every badge in the order they are shown
+var achievements = []Achievement{
+	{Key: AchievementFirstBlood, Name: "First Blood", Description: "First team to solve a question", Icon: "🩸"},
+	{Key: AchievementStreak, Name: "On a Roll", Description: "Five correct answers in a row without a wrong one", Icon: "🔥"},
+	{Key: AchievementNightOwl, Name: "Night Owl", Description: "Solved a question between midnight and 5am", Icon: "🦉"},
+	{Key: AchievementNoHints, Name: "No Hints Needed", Description: "Solved a question that has hints without buying any", Icon: "🧠"},
+}
+
+// Achievements returns every badge teams can earn
+func Achievements() []Achievement {
+	return achievements
+}
+
+// LookupAchievement returns the badge with a key
+func LookupAchievement(key string) (Achievement, bool) {
+	for _, a := range achievements {
+		if a.Key == key {
+			return a, true
+		}
+	}
+	return Achievement{}, false
+}
+
+// EarnedAchievement is a badge a team earned, with the question that
+// earned it
+type EarnedAchievement struct {
+	Achievement
+	QuestionID int       `json:"question_id,omitempty"`
+	AwardedAt  time.Time `json:"awarded_at"`
+}
+
+// EvaluateAchievements awards a team the badges its solve of a question at
+// a time earned, returning the ones it didn't have yet. Solves of teams
+// under review are only evaluated once they are approved
+func (us *UserService) EvaluateAchievements(ctx context.Context, teamID, questionID int, at time.Time) ([]Achievement, error) {
+	if !us.FlagEnabled(ctx, FlagAchievements) {
+		return nil, nil
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	var earned []string
+	first, err := us.Repo.GetFirstSolver(ctx, questionID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error fetching first solver of question %d: %v", questionID, err)
+		return nil, err
+	}
+	if first == teamID {
+		earned = append(earned, AchievementFirstBlood)
+	}
+
+	results, err := us.Repo.ListRecentResults(ctx, teamID, StreakLength)
+	if err != nil {
+		log.Printf("Error listing answers of team %d: %v", teamID, err)
+		return nil, err
+	}
+	streak := len(results) == StreakLength
+	for _, correct := range results {
+		streak = streak && correct
+	}
+	if streak {
+		earned = append(earned, AchievementStreak)
+	}
+
+	if hour := at.Local().Hour(); hour >= NightOwlStart && hour < NightOwlEnd {
+		earned = append(earned, AchievementNightOwl)
+	}
+
+	hints, err := us.Repo.ListQuestionHints(ctx, questionID)
+	if err != nil {
+		log.Printf("Error listing hints of question %d: %v", questionID, err)
+		return nil, err
+	}
+	noHints := len(hints) > 0
+	for _, h := range hints {
+		unlocked, err := us.Repo.HasUnlockedHint(ctx, teamID, h.ID)
+		if err != nil {
+			log.Printf("Error checking hint %d of team %d: %v", h.ID, teamID, err)
+			return nil, err
+		}
+		noHints = noHints && !unlocked
+	}
+	if noHints {
+		earned = append(earned, AchievementNoHints)
+	}
+
+	awarded := make([]Achievement, 0, len(earned))
+	for _, key := range earned {
+		isNew, err := us.Repo.AwardAchievement(ctx, teamID, key, questionID, at)
+		if err != nil {
+			log.Printf("Error awarding %s to team %d: %v", key, teamID, err)
+			return awarded, err
+		}
+		if isNew {
+			a, _ := LookupAchievement(key)
+			awarded = append(awarded, a)
+		}
+	}
+	return awarded, nil
+}
+
+// GetTeamAchievements returns the badges a team earned, oldest first
+func (us *UserService) GetTeamAchievements(ctx context.Context, teamID int) ([]EarnedAchievement, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := us.Repo.ListTeamAchievements(ctx, teamID)
+	if err != nil {
+		log.Printf("Error listing achievements of team %d: %v", teamID, err)
+		return nil, err
+	}
+	earned := make([]EarnedAchievement, 0, len(rows))
+	for _, r := range rows {
+		if a, ok := LookupAchievement(r.Achievement); ok {
+			earned = append(earned, EarnedAchievement{Achievement: a, QuestionID: r.QuestionID, AwardedAt: r.AwardedAt})
+		}
+	}
+	return earned, nil
+}
+
+// huntAchievements returns the keys of the badges each team of a hunt
+// earned, by team name
+func (us *UserService) huntAchievements(ctx context.Context, huntID int) (map[string][]string, error) {
+	rows, err := us.Repo.ListHuntAchievements(ctx, huntID)
+	if err != nil {
+		log.Printf("Error listing achievements of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+	byTeam := make(map[string][]string)
+	for _, r := range rows {
+		byTeam[r.TeamName] = append(byTeam[r.TeamName], r.Achievement)
+	}
+	return byTeam, nil
+}
+
+// AchievementEngine awards badges as solves are published, and tells the
+// team about each one it earns
+type AchievementEngine struct {
+	us          *UserService
+	broadcaster *Broadcaster
+}
+
+// NewAchievementEngine evaluates solves published through broadcaster
+func NewAchievementEngine(us *UserService, broadcaster *Broadcaster) *AchievementEngine {
+	return &AchievementEngine{us: us, broadcaster: broadcaster}
+}
+
+// Handle evaluates the solves among published events
+func (e *AchievementEngine) Handle(event Event) {
+	if event.Type != EventQuestionSolved {
+		return
+	}
+	teamID, _ := event.Data["team_id"].(int)
+	questionID, _ := event.Data["question_id"].(int)
+	if teamID == 0 || questionID == 0 {
+		return
+	}
+
+	// An approved solve is announced well after it was made
+	at := event.Timestamp
+	if solvedAt, ok := event.Data["solved_at"].(time.Time); ok {
+		at = solvedAt
+	}
+
+	awarded, err := e.us.EvaluateAchievements(context.Background(), teamID, questionID, at)
+	if err != nil {
+		return
+	}
+	for _, a := range awarded {
+		log.Printf("Team %d earned %s", teamID, a.Key)
+		e.broadcaster.BroadcastToTeam(teamID, EventAchievement, map[string]interface{}{
+			"achievement": a,
+		})
+	}
+}
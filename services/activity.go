@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+const (
+	// ActivityScanInterval is how often the analyzer looks at new activity
+	ActivityScanInterval = time.Minute
+	// FastSolvePoints is the worth from which a question solved within
+	// FastSolveTime of being opened is suspicious
+	FastSolvePoints = 500
+	// FastSolveTime is the solve time under which a big question is
+	// suspicious
+	FastSolveTime = 30 * time.Second
+	// SharedIPTeams is how many teams of a hunt logging in from one address
+	// within SharedIPWindow are suspicious
+	SharedIPTeams = 3
+	// SharedIPWindow is how far back logins are compared
+	SharedIPWindow = time.Hour
+)
+
+// RecordLogin logs a team logging in from an IP
+func (us *UserService) RecordLogin(ctx context.Context, teamID int, ip string) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.CreateLogin(ctx, teamID, ip, time.Now()); err != nil {
+		log.Printf("Error logging login of team %d: %v", teamID, err)
+		return err
+	}
+	return nil
+}
+
+// ActivityAnalyzer looks through recent activity for anomalies: big
+// questions solved moments after being opened, questions solved without
+// being opened, and several teams logging in from one address
+type ActivityAnalyzer struct {
+	us *UserService
+
+	// last is when the previous scan started; solves after it are new
+	last time.Time
+}
+
+// NewActivityAnalyzer creates an analyzer; call Scan every
+// ActivityScanInterval
+func NewActivityAnalyzer(us *UserService) *ActivityAnalyzer {
+	return &ActivityAnalyzer{us: us, last: time.Now().Add(-ActivityScanInterval)}
+}
+
+// Scan looks at the activity since the previous scan, raises alerts for
+// what looks wrong and returns the new ones
+func (a *ActivityAnalyzer) Scan(ctx context.Context) []Alert {
+	now := time.Now()
+	var alerts []Alert
+	alerts = append(alerts, a.solveAlerts(ctx, a.last)...)
+	alerts = append(alerts, a.sharedIPAlerts(ctx, now.Add(-SharedIPWindow))...)
+	a.last = now
+	return a.us.raiseAlerts(ctx, alerts)
+}
+
+// solveAlerts checks the solves since a time
+func (a *ActivityAnalyzer) solveAlerts(ctx context.Context, since time.Time) []Alert {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	// Solve times may be stored to the second, so look a second further
+	// back to miss none; an alert already open is not raised again
+	solves, err := a.us.Repo.ListSolvesSince(ctx, since.UTC().Add(-time.Second).Truncate(time.Second))
+	if err != nil {
+		log.Printf("Error listing recent solves: %v", err)
+		return nil
+	}
+
+	var alerts []Alert
+	for _, s := range solves {
+		alert := Alert{HuntID: s.HuntID, TeamID: s.TeamID, QuestionID: s.QuestionID}
+		switch {
+		case s.StartedAt == nil:
+			alert.Kind = AlertImpossibleSolve
+			alert.Detail = "Solved the question without opening it"
+		case s.StartedAt.Sub(s.SolvedAt) > time.Second:
+			alert.Kind = AlertImpossibleSolve
+			alert.Detail = "Solved the question before opening it"
+		case s.Points >= FastSolvePoints && s.SolvedAt.Sub(*s.StartedAt) < FastSolveTime:
+			alert.Kind = AlertFastSolve
+			alert.Detail = fmt.Sprintf("Solved a %d-point question %d seconds after opening it",
+				s.Points, int(s.SolvedAt.Sub(*s.StartedAt).Seconds()))
+		default:
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// sharedIPAlerts checks the logins since a time for addresses used by
+// several teams
+func (a *ActivityAnalyzer) sharedIPAlerts(ctx context.Context, since time.Time) []Alert {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	logins, err := a.us.Repo.ListSharedLogins(ctx, since, SharedIPTeams)
+	if err != nil {
+		log.Printf("Error listing shared logins: %v", err)
+		return nil
+	}
+
+	var alerts []Alert
+	var names []string
+	for i, l := range logins {
+		names = append(names, l.TeamName)
+		if i+1 < len(logins) && sameAddress(logins[i+1], l) {
+			continue
+		}
+		alerts = append(alerts, Alert{
+			HuntID:  l.HuntID,
+			Kind:    AlertSharedIP,
+			Subject: l.IP,
+			Detail: fmt.Sprintf("%d teams logged in from %s within %d minutes: %s",
+				len(names), l.IP, int(SharedIPWindow.Minutes()), strings.Join(names, ", ")),
+		})
+		names = nil
+	}
+	return alerts
+}
+
+// sameAddress reports whether two logins are from one address in one hunt
+func sameAddress(a, b repository.SharedLogin) bool {
+	return a.IP == b.IP && a.HuntID == b.HuntID
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Alert is something about a team that an admin should look at
+type Alert = repository.Alert
+
+// Alert kinds
+const (
+	// AlertFlagShared is a team submitting the flag made for another team
+	AlertFlagShared = "flag_shared"
+	// AlertSameWrongAnswer is teams giving the same unusual wrong answer
+	// within minutes of each other
+	AlertSameWrongAnswer = "same_wrong_answer"
+	// AlertFastSolve is a big question solved moments after it was opened
+	AlertFastSolve = "fast_solve"
+	// AlertImpossibleSolve is a question solved without being opened first
+	AlertImpossibleSolve = "impossible_solve"
+	// AlertSharedIP is several teams logging in from one address
+	AlertSharedIP = "shared_ip"
+)
+
+var ErrAlertNotFound = errors.New("alert not found")
+
+// RaiseAlert records an alert unless an open one already covers the same
+// teams, question and subject, reporting whether it did. The alert is
+// returned with its ID
+func (us *UserService) RaiseAlert(ctx context.Context, a Alert) (Alert, bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	open, err := us.Repo.HasOpenAlert(ctx, a)
+	if err != nil {
+		log.Printf("Error checking alerts: %v", err)
+		return a, false, err
+	}
+	if open {
+		return a, false, nil
+	}
+
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	if a.ID, err = us.Repo.CreateAlert(ctx, a); err != nil {
+		log.Printf("Error raising %s alert: %v", a.Kind, err)
+		return a, false, err
+	}
+	log.Printf("Alert %s: team %d, other team %d, question %d: %s", a.Kind, a.TeamID, a.OtherTeamID, a.QuestionID, a.Detail)
+	return a, true, nil
+}
+
+// raiseAlerts raises each alert, returning the ones that were new
+func (us *UserService) raiseAlerts(ctx context.Context, alerts []Alert) []Alert {
+	var raised []Alert
+	for _, a := range alerts {
+		if a, ok, err := us.RaiseAlert(ctx, a); err == nil && ok {
+			raised = append(raised, a)
+		}
+	}
+	return raised
+}
+
+// AlertEvent is the data of the event telling admins about a new alert
+func AlertEvent(a Alert) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              a.ID,
+		"hunt_id":         a.HuntID,
+		"kind":            a.Kind,
+		"team_id":         a.TeamID,
+		"team_name":       a.TeamName,
+		"other_team_id":   a.OtherTeamID,
+		"other_team_name": a.OtherTeamName,
+		"question_id":     a.QuestionID,
+		"question_title":  a.QuestionTitle,
+		"subject":         a.Subject,
+		"detail":          a.Detail,
+	}
+}
+
+// GetAlerts returns the open alerts of a hunt, newest first, and the
+// resolved ones too when resolved is set
+func (us *UserService) GetAlerts(ctx context.Context, huntID int, resolved bool) ([]Alert, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	alerts, err := us.Repo.ListAlerts(ctx, huntID, resolved)
+	if err != nil {
+		log.Printf("Error listing alerts of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+	if alerts == nil {
+		alerts = make([]Alert, 0)
+	}
+	return alerts, nil
+}
+
+// ResolveAlert marks an open alert as dealt with
+func (us *UserService) ResolveAlert(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	resolved, err := us.Repo.ResolveAlert(ctx, id, time.Now())
+	if err != nil {
+		log.Printf("Error resolving alert %d: %v", id, err)
+		return err
+	}
+	if !resolved {
+		return ErrAlertNotFound
+	}
+	return nil
+}
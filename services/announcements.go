@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Announcement is an announcement kept on /announcements after it is sent
+type Announcement = repository.Announcement
+
+// ErrAnnouncementNotFound is returned for an announcement that doesn't exist
+var ErrAnnouncementNotFound = errors.New("announcement not found")
+
+// CreateAnnouncement stores an announcement and returns it with its ID set
+func (us *UserService) CreateAnnouncement(ctx context.Context, a Announcement) (Announcement, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	a.CreatedAt = time.Now()
+	id, err := us.Repo.CreateAnnouncement(ctx, a)
+	if err != nil {
+		log.Printf("Error creating announcement: %v", err)
+		return Announcement{}, err
+	}
+
+	a.ID = id
+	return a, nil
+}
+
+// GetAnnouncements returns the announcements, pinned first and then newest
+// first; publicOnly leaves out the ones only teams may read
+func (us *UserService) GetAnnouncements(ctx context.Context, publicOnly bool) ([]Announcement, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	announcements, err := us.Repo.ListAnnouncements(ctx, publicOnly)
+	if err != nil {
+		log.Printf("Error getting announcements: %v", err)
+		return nil, err
+	}
+
+	return announcements, nil
+}
+
+// UpdateAnnouncement pins or unpins an announcement and shows it to
+// visitors or only to teams
+func (us *UserService) UpdateAnnouncement(ctx context.Context, id int, pinned, public bool) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ok, err := us.Repo.SetAnnouncementFlags(ctx, id, pinned, public)
+	if err != nil {
+		log.Printf("Error updating announcement %d: %v", id, err)
+		return err
+	}
+	if !ok {
+		return ErrAnnouncementNotFound
+	}
+	return nil
+}
+
+// DeleteAnnouncement takes an announcement off /announcements; the copy
+// in each team's inbox stays
+func (us *UserService) DeleteAnnouncement(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeleteAnnouncement(ctx, id); err != nil {
+		log.Printf("Error deleting announcement %d: %v", id, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// adminAPITokenPrefix makes admin API tokens easy to spot in configs and logs
+const adminAPITokenPrefix = "holmes_"
+
+// AdminAPIToken is a bearer token for the admin REST API
+// The token itself is only shown once, when it is created
+type AdminAPIToken = repository.AdminAPIToken
+
+func hashAdminAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAdminAPIToken mints a new token and returns it in plain text
+func (us *UserService) CreateAdminAPIToken(ctx context.Context, name string) (string, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Error generating admin API token: %v", err)
+		return "", err
+	}
+	token := adminAPITokenPrefix + hex.EncodeToString(b)
+
+	if err := us.Repo.CreateAdminAPIToken(ctx, name, hashAdminAPIToken(token), time.Now()); err != nil {
+		log.Printf("Error creating admin API token: %v", err)
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GetAdminAPITokens lists every admin API token, newest first
+func (us *UserService) GetAdminAPITokens(ctx context.Context) ([]AdminAPIToken, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tokens, err := us.Repo.ListAdminAPITokens(ctx)
+	if err != nil {
+		log.Printf("Error getting admin API tokens: %v", err)
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// DeleteAdminAPIToken revokes a token
+func (us *UserService) DeleteAdminAPIToken(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeleteAdminAPIToken(ctx, id); err != nil {
+		log.Printf("Error deleting admin API token %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// CheckAdminAPIToken reports whether a token is valid, recording its use
+func (us *UserService) CheckAdminAPIToken(ctx context.Context, token string) (bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ok, err := us.Repo.TouchAdminAPIToken(ctx, hashAdminAPIToken(token), time.Now())
+	if err != nil {
+		log.Printf("Error checking admin API token: %v", err)
+		return false, err
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,604 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// ArchiveFormat is the version of the hunt archive layout, bumped when a
+// file changes shape
+const ArchiveFormat = 1
+
+// ArchiveManifest is manifest.json, which says what a hunt archive holds.
+// Missing lists media keys that were recorded but no longer stored
+type ArchiveManifest struct {
+	Format        int       `json:"format"`
+	SchemaVersion int       `json:"schema_version"`
+	ExportedAt    time.Time `json:"exported_at"`
+	Hunt          Hunt      `json:"hunt"`
+	Missing       []string  `json:"missing_media,omitempty"`
+}
+
+// ArchiveMedia is a media row of a question; its object is stored in the
+// archive under media/ and its key
+type ArchiveMedia struct {
+	Table      string `json:"table"`
+	ID         int    `json:"id"`
+	QuestionID int    `json:"question_id"`
+	Position   int    `json:"position"`
+	Path       string `json:"path"`
+	Name       string `json:"name,omitempty"`
+	Caption    string `json:"caption,omitempty"`
+}
+
+// huntArchive is everything a hunt archive holds besides the media objects
+type huntArchive struct {
+	Manifest    ArchiveManifest
+	Questions   []repository.Question
+	Hints       []Hint
+	Media       []ArchiveMedia
+	Teams       []repository.ArchiveTeam
+	Solves      []repository.ArchiveSolve
+	HintUnlocks []repository.ArchiveHintUnlock
+	Timers      []repository.ArchiveTimer
+	Attempts    []repository.QuestionAttempt
+	TeamFlags   []repository.TeamFlag
+	Submissions []repository.Submission
+	Results     []repository.HuntResult
+}
+
+// ExportHunt writes a zip archive of a hunt to w: its questions with their
+// answer hashes, hints, media and the stored media objects, and its teams
+// with every solve, timer, wrong attempt, submission, flag token, hint
+// purchase and saved standing. Point changes are not kept separately; they
+// follow from the solves, attempts and hint purchases. Media objects that
+// are missing from storage are listed in the manifest instead of failing
+// the export
+func (us *UserService) ExportHunt(ctx context.Context, huntID int, w io.Writer) error {
+	archive, err := us.loadHuntArchive(ctx, huntID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	seen := make(map[string]bool)
+	for _, m := range archive.Media {
+		if seen[m.Path] {
+			continue
+		}
+		seen[m.Path] = true
+		if err := us.archiveObject(ctx, zw, m.Path); errors.Is(err, ErrObjectNotFound) {
+			archive.Manifest.Missing = append(archive.Manifest.Missing, m.Path)
+		} else if err != nil {
+			log.Printf("Error archiving media %s of hunt %d: %v", m.Path, huntID, err)
+			return err
+		}
+	}
+
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"manifest.json", archive.Manifest},
+		{"questions.json", orEmpty(archive.Questions)},
+		{"hints.json", orEmpty(archive.Hints)},
+		{"media.json", orEmpty(archive.Media)},
+		{"teams.json", orEmpty(archive.Teams)},
+		{"solves.json", orEmpty(archive.Solves)},
+		{"hint_unlocks.json", orEmpty(archive.HintUnlocks)},
+		{"timers.json", orEmpty(archive.Timers)},
+		{"attempts.json", orEmpty(archive.Attempts)},
+		{"team_flags.json", orEmpty(archive.TeamFlags)},
+		{"submissions.json", orEmpty(archive.Submissions)},
+		{"results.json", orEmpty(archive.Results)},
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: archive.Manifest.ExportedAt})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.v); err != nil {
+			log.Printf("Error archiving %s of hunt %d: %v", f.name, huntID, err)
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("Exported hunt %d: %d questions, %d teams, %d solves", huntID, len(archive.Questions), len(archive.Teams), len(archive.Solves))
+	return nil
+}
+
+// orEmpty makes an empty list encode as [] rather than null
+func orEmpty[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// loadHuntArchive reads every row of a hunt that goes in its archive
+func (us *UserService) loadHuntArchive(ctx context.Context, huntID int) (huntArchive, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	var a huntArchive
+	hunt, err := us.Repo.GetHunt(ctx, huntID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, ErrHuntNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching hunt %d: %v", huntID, err)
+		return a, err
+	}
+	version, err := us.Repo.GetSchemaVersion(ctx)
+	if err != nil {
+		log.Printf("Error fetching schema version: %v", err)
+		return a, err
+	}
+	a.Manifest = ArchiveManifest{Format: ArchiveFormat, SchemaVersion: version, ExportedAt: time.Now().UTC(), Hunt: hunt}
+
+	if a.Questions, err = us.Repo.ListArchiveQuestions(ctx, huntID); err != nil {
+		log.Printf("Error fetching questions of hunt %d: %v", huntID, err)
+		return a, err
+	}
+	if a.Hints, err = us.Repo.ListHints(ctx, huntID); err != nil {
+		log.Printf("Error fetching hints of hunt %d: %v", huntID, err)
+		return a, err
+	}
+
+	questionIDs := make([]int, len(a.Questions))
+	for i, q := range a.Questions {
+		questionIDs[i] = q.ID
+	}
+	for _, table := range repository.MediaTables {
+		media, err := us.Repo.ListMediaForQuestions(ctx, table, questionIDs)
+		if err != nil {
+			log.Printf("Error fetching %s of hunt %d: %v", table, huntID, err)
+			return a, err
+		}
+		position, last := 0, 0
+		for _, m := range media {
+			if m.QuestionID != last {
+				position, last = 0, m.QuestionID
+			}
+			position++
+			a.Media = append(a.Media, ArchiveMedia{Table: table, ID: m.ID, QuestionID: m.QuestionID, Position: position, Path: m.Path, Name: m.Name, Caption: m.Caption})
+		}
+	}
+
+	if a.Teams, err = us.Repo.ListArchiveTeams(ctx, huntID); err != nil {
+		log.Printf("Error fetching teams of hunt %d: %v", huntID, err)
+		return a, err
+	}
+	if a.Solves, err = us.Repo.ListArchiveSolves(ctx, huntID); err != nil {
+		log.Printf("Error fetching solves of hunt %d: %v", huntID, err)
+		return a, err
+	}
+	if a.HintUnlocks, err = us.Repo.ListArchiveHintUnlocks(ctx, huntID); err != nil {
+		log.Printf("Error fetching hint unlocks of hunt %d: %v", huntID, err)
+		return a, err
+	}
+	if a.Timers, err = us.Repo.ListArchiveTimers(ctx, huntID); err != nil {
+		log.Printf("Error fetching timers of hunt %d: %v", huntID, err)
+		return a, err
+	}
+	if a.Attempts, err = us.Repo.ListArchiveAttempts(ctx, huntID); err != nil {
+		log.Printf("Error fetching attempts of hunt %d: %v", huntID, err)
+		return a, err
+	}
+	if a.TeamFlags, err = us.Repo.ListArchiveTeamFlags(ctx, huntID); err != nil {
+		log.Printf("Error fetching team flags of hunt %d: %v", huntID, err)
+		return a, err
+	}
+	if a.Submissions, err = us.Repo.ListArchiveSubmissions(ctx, huntID); err != nil {
+		log.Printf("Error fetching submissions of hunt %d: %v", huntID, err)
+		return a, err
+	}
+	if a.Results, err = us.Repo.ListAllResults(ctx, huntID); err != nil {
+		log.Printf("Error fetching results of hunt %d: %v", huntID, err)
+		return a, err
+	}
+	return a, nil
+}
+
+// archiveObject copies a stored media object into the archive under media/
+func (us *UserService) archiveObject(ctx context.Context, zw *zip.Writer, key string) error {
+	if us.Storage == nil {
+		return ErrObjectNotFound
+	}
+	obj, info, err := us.Storage.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	// Media is mostly already compressed, so it is stored as is
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: path.Join("media", key), Method: zip.Store, Modified: info.ModTime})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fw, obj); err != nil {
+		return fmt.Errorf("failed to archive %s: %v", key, err)
+	}
+	return nil
+}
+
+// ErrInvalidArchive is returned when importing something that isn't a
+// hunt archive this version can read
+var ErrInvalidArchive = errors.New("not a valid hunt archive")
+
+// ImportOptions says how to import a hunt archive. Full brings back the
+// teams and all of their progress as well as the questions; otherwise
+// only the questions, hints and media are imported. Slug imports into
+// another hunt than the one archived
+type ImportOptions struct {
+	Full bool
+	Slug string
+}
+
+// ImportSummary counts what ImportHunt brought in
+type ImportSummary struct {
+	Hunt      Hunt `json:"hunt"`
+	Questions int  `json:"questions"`
+	Hints     int  `json:"hints"`
+	Media     int  `json:"media"`
+	Teams     int  `json:"teams"`
+	Solves    int  `json:"solves"`
+}
+
+// ImportHunt rebuilds a hunt from an archive written by ExportHunt. The
+// hunt is created, or filled in if a hunt with its slug exists but is
+// still empty, as the first hunt of a fresh database is. Media objects are
+// stored unless storage already holds them. Questions, hints and teams get
+// new IDs; everything else is rewired to them. Nothing is imported unless
+// all of it is
+func (us *UserService) ImportHunt(ctx context.Context, r io.ReaderAt, size int64, opts ImportOptions) (ImportSummary, error) {
+	var summary ImportSummary
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return summary, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	archive, objects, err := readHuntArchive(zr)
+	if err != nil {
+		return summary, err
+	}
+
+	slug := archive.Manifest.Hunt.Slug
+	if opts.Slug != "" {
+		slug = strings.ToLower(strings.TrimSpace(opts.Slug))
+	}
+	if !huntSlugPattern.MatchString(slug) {
+		return summary, ErrInvalidHuntSlug
+	}
+	name := archive.Manifest.Hunt.Name
+	if name == "" {
+		name = slug
+	}
+
+	existing, err := us.GetHuntBySlug(ctx, slug)
+	if err != nil && !errors.Is(err, ErrHuntNotFound) {
+		return summary, err
+	}
+	if err == nil {
+		teams, questions, err := us.huntSize(ctx, existing.ID)
+		if err != nil {
+			return summary, err
+		}
+		if teams+questions > 0 {
+			return summary, ErrHuntExists
+		}
+	}
+	if opts.Full {
+		for _, t := range archive.Teams {
+			if _, err := us.CheckUsername(ctx, t.Name); err == nil {
+				return summary, fmt.Errorf("%w: a team named %q already exists", ErrInvalidArchive, t.Name)
+			}
+		}
+	}
+
+	// Objects go in first; a failed import leaves at worst some unused
+	// objects behind, which the orphan sweep removes
+	for _, m := range archive.Media {
+		if filepath.Base(m.Path) != m.Path || !strings.HasPrefix(m.Path, mediaPrefixes[m.Table]+"-") {
+			return summary, fmt.Errorf("%w: media key %q", ErrInvalidArchive, m.Path)
+		}
+		f, ok := objects[m.Path]
+		if !ok {
+			continue
+		}
+		if exists, err := us.Storage.Exists(ctx, m.Path); err != nil {
+			return summary, err
+		} else if exists {
+			continue
+		}
+		if err := us.restoreObject(ctx, f, m.Path); err != nil {
+			log.Printf("Error restoring media %s: %v", m.Path, err)
+			return summary, err
+		}
+		if m.Table == "images" {
+			if err := us.GenerateImageVariants(m.Path); err != nil {
+				log.Printf("Warning: Failed to resize %s: %v", m.Path, err)
+			}
+		}
+	}
+
+	dbctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := us.UserStore.DB.BeginTx(dbctx, nil)
+	if err != nil {
+		log.Printf("Error starting import of hunt %s: %v", slug, err)
+		return summary, err
+	}
+	defer tx.Rollback()
+	repo := us.Repo.WithTx(tx)
+
+	huntID := existing.ID
+	if huntID == 0 {
+		huntID, err = repo.CreateHunt(dbctx, slug, name)
+	} else {
+		err = repo.RenameHunt(dbctx, huntID, name)
+	}
+	if err != nil {
+		log.Printf("Error creating hunt %s: %v", slug, err)
+		return summary, err
+	}
+
+	if err := importHuntRows(dbctx, repo, huntID, archive, opts.Full, &summary); err != nil {
+		log.Printf("Error importing hunt %s: %v", slug, err)
+		return summary, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing import of hunt %s: %v", slug, err)
+		return summary, err
+	}
+
+	if summary.Hunt, err = us.GetHunt(ctx, huntID); err != nil {
+		return summary, err
+	}
+	log.Printf("Imported hunt %s: %d questions, %d hints, %d media, %d teams, %d solves",
+		slug, summary.Questions, summary.Hints, summary.Media, summary.Teams, summary.Solves)
+	return summary, nil
+}
+
+// huntSize counts the teams and questions of a hunt
+func (us *UserService) huntSize(ctx context.Context, huntID int) (int, int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	teams, err := us.Repo.CountTeams(ctx, huntID)
+	if err != nil {
+		return 0, 0, err
+	}
+	questions, err := us.Repo.CountQuestions(ctx, huntID)
+	return teams, questions, err
+}
+
+// readHuntArchive decodes the JSON files of an archive and indexes its
+// media objects by key
+func readHuntArchive(zr *zip.Reader) (huntArchive, map[string]*zip.File, error) {
+	var a huntArchive
+	files := make(map[string]*zip.File)
+	objects := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		if key, ok := strings.CutPrefix(f.Name, "media/"); ok {
+			objects[key] = f
+		} else {
+			files[f.Name] = f
+		}
+	}
+
+	decode := func(name string, v interface{}, required bool) error {
+		f, ok := files[name]
+		if !ok {
+			if required {
+				return fmt.Errorf("%w: %s is missing", ErrInvalidArchive, name)
+			}
+			return nil
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		defer rc.Close()
+		if err := json.NewDecoder(rc).Decode(v); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, name, err)
+		}
+		return nil
+	}
+
+	if err := decode("manifest.json", &a.Manifest, true); err != nil {
+		return a, nil, err
+	}
+	if a.Manifest.Format < 1 || a.Manifest.Format > ArchiveFormat {
+		return a, nil, fmt.Errorf("%w: format %d", ErrInvalidArchive, a.Manifest.Format)
+	}
+	for _, f := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"questions.json", &a.Questions},
+		{"hints.json", &a.Hints},
+		{"media.json", &a.Media},
+		{"teams.json", &a.Teams},
+		{"solves.json", &a.Solves},
+		{"hint_unlocks.json", &a.HintUnlocks},
+		{"timers.json", &a.Timers},
+		{"attempts.json", &a.Attempts},
+		{"team_flags.json", &a.TeamFlags},
+		{"submissions.json", &a.Submissions},
+		{"results.json", &a.Results},
+	} {
+		if err := decode(f.name, f.v, f.name == "questions.json"); err != nil {
+			return a, nil, err
+		}
+	}
+	return a, objects, nil
+}
+
+// importHuntRows inserts the rows of an archive into a hunt, mapping the
+// archived IDs of questions, hints and teams to the new ones
+func importHuntRows(ctx context.Context, repo *repository.Queries, huntID int, a huntArchive, full bool, summary *ImportSummary) error {
+	questionIDs := make(map[int]int, len(a.Questions))
+	for _, q := range a.Questions {
+		old := q.ID
+		q.HuntID = huntID
+		// Archives from before photo questions say nothing of the answer
+		// type
+		if q.AnswerType == "" {
+			q.AnswerType = AnswerText
+		}
+		id, err := repo.CreateQuestion(ctx, q)
+		if err != nil {
+			return err
+		}
+		questionIDs[old] = id
+		summary.Questions++
+	}
+
+	hintIDs := make(map[int]int, len(a.Hints))
+	for _, h := range a.Hints {
+		old := h.ID
+		var ok bool
+		if h.ParentQuestionID, ok = questionIDs[h.ParentQuestionID]; !ok {
+			return fmt.Errorf("%w: hint %d of an unknown question", ErrInvalidArchive, old)
+		}
+		id, err := repo.CreateHint(ctx, h)
+		if err != nil {
+			return err
+		}
+		hintIDs[old] = id
+		summary.Hints++
+	}
+
+	for _, m := range a.Media {
+		questionID, ok := questionIDs[m.QuestionID]
+		if !ok {
+			return fmt.Errorf("%w: media %s of an unknown question", ErrInvalidArchive, m.Path)
+		}
+		if err := repo.InsertArchiveMedia(ctx, m.Table, questionID, m.Position, m.Path, m.Name, m.Caption); err != nil {
+			return err
+		}
+		summary.Media++
+	}
+
+	if !full {
+		return nil
+	}
+
+	teamIDs := make(map[int]int, len(a.Teams))
+	for _, t := range a.Teams {
+		if t.CreatedAt == nil {
+			now := time.Now()
+			t.CreatedAt = &now
+		}
+		id, err := repo.InsertArchiveTeam(ctx, huntID, t)
+		if err != nil {
+			return err
+		}
+		teamIDs[t.ID] = id
+		summary.Teams++
+	}
+
+	// ids maps a team's and a question's or hint's archived IDs to the new
+	// ones
+	ids := func(what string, teamID, otherID int, others map[int]int) (int, int, error) {
+		team, ok := teamIDs[teamID]
+		other, ok2 := others[otherID]
+		if !ok || !ok2 {
+			return 0, 0, fmt.Errorf("%w: %s of team %d refers to something missing", ErrInvalidArchive, what, teamID)
+		}
+		return team, other, nil
+	}
+
+	var err error
+	for _, s := range a.Solves {
+		if s.TeamID, s.QuestionID, err = ids("solve", s.TeamID, s.QuestionID, questionIDs); err != nil {
+			return err
+		}
+		if err := repo.InsertArchiveSolve(ctx, s); err != nil {
+			return err
+		}
+		summary.Solves++
+	}
+	for _, u := range a.HintUnlocks {
+		if u.TeamID, u.HintID, err = ids("hint unlock", u.TeamID, u.HintID, hintIDs); err != nil {
+			return err
+		}
+		if err := repo.InsertArchiveHintUnlock(ctx, u); err != nil {
+			return err
+		}
+	}
+	for _, tm := range a.Timers {
+		if tm.TeamID, tm.QuestionID, err = ids("timer", tm.TeamID, tm.QuestionID, questionIDs); err != nil {
+			return err
+		}
+		if err := repo.InsertArchiveTimer(ctx, tm); err != nil {
+			return err
+		}
+	}
+	for _, at := range a.Attempts {
+		if at.TeamID, at.QuestionID, err = ids("attempt", at.TeamID, at.QuestionID, questionIDs); err != nil {
+			return err
+		}
+		if err := repo.SaveAttempt(ctx, at); err != nil {
+			return err
+		}
+	}
+	for _, f := range a.TeamFlags {
+		if f.TeamID, f.QuestionID, err = ids("flag", f.TeamID, f.QuestionID, questionIDs); err != nil {
+			return err
+		}
+		if err := repo.CreateTeamFlag(ctx, f); err != nil {
+			return err
+		}
+	}
+	for _, sub := range a.Submissions {
+		if sub.TeamID, sub.QuestionID, err = ids("submission", sub.TeamID, sub.QuestionID, questionIDs); err != nil {
+			return err
+		}
+		if err := repo.CreateSubmission(ctx, sub); err != nil {
+			return err
+		}
+	}
+	for _, r := range a.Results {
+		r.HuntID = huntID
+		if err := repo.SaveResult(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreObject stores a media object from an archive under key
+func (us *UserService) restoreObject(ctx context.Context, f *zip.File, key string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer rc.Close()
+
+	contentType := mime.TypeByExtension(filepath.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return us.Storage.Put(ctx, key, rc, int64(f.UncompressedSize64), contentType)
+}
@@ -1,36 +1,33 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"time"
 
 	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
 )
 
-type QuestionAttempt struct {
-	TeamID        int       `json:"team_id"`
-	QuestionID    int       `json:"question_id"`
-	WrongAttempts int       `json:"wrong_attempts"`
-	TotalPenalty  int       `json:"total_penalty"`
-	LastAttemptAt time.Time `json:"last_attempt_at"`
+type QuestionAttempt = repository.QuestionAttempt
+
+// MaxAttempts is how many wrong answers a team may give a question, not
+// counting the extra attempts it bought
+const MaxAttempts = 5
+
+// AttemptsLeft returns how many more wrong answers a team may give a
+// question
+func AttemptsLeft(a QuestionAttempt) int {
+	return max(MaxAttempts+a.ExtraAttempts-a.WrongAttempts, 0)
 }
 
 // GetQuestionAttempts retrieves attempt info for a team on a specific question
-func (us *UserService) GetQuestionAttempts(teamID int, questionID int) (*QuestionAttempt, error) {
-	query := database.ConvertPlaceholders(`SELECT team_id, question_id, wrong_attempts, total_penalty, last_attempt_at 
-			  FROM question_attempts 
-			  WHERE team_id = ? AND question_id = ?`)
-	
-	var attempt QuestionAttempt
-	err := us.UserStore.DB.QueryRow(query, teamID, questionID).Scan(
-		&attempt.TeamID,
-		&attempt.QuestionID,
-		&attempt.WrongAttempts,
-		&attempt.TotalPenalty,
-		&attempt.LastAttemptAt,
-	)
-	
+func (us *UserService) GetQuestionAttempts(ctx context.Context, teamID int, questionID int) (*QuestionAttempt, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	attempt, err := us.Repo.GetAttempt(ctx, teamID, questionID)
 	if err == sql.ErrNoRows {
 		// No attempts yet, return default
 		return &QuestionAttempt{
@@ -41,20 +38,23 @@ func (us *UserService) GetQuestionAttempts(teamID int, questionID int) (*Questio
 			LastAttemptAt: time.Now(),
 		}, nil
 	}
-	
+
 	if err != nil {
 		log.Printf("Error getting attempts for team %d, question %d: %v", teamID, questionID, err)
 		return nil, err
 	}
-	
+
 	return &attempt, nil
 }
 
 // RecordWrongAttempt records a wrong attempt and calculates penalty based on question points
 // Returns: (penalty amount, attempts left, error)
-func (us *UserService) RecordWrongAttempt(teamID int, questionID int, questionPoints int) (int, int, error) {
+func (us *UserService) RecordWrongAttempt(ctx context.Context, teamID int, questionID int, questionPoints int) (int, int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
 	// Get current attempts
-	attempt, err := us.GetQuestionAttempts(teamID, questionID)
+	attempt, err := us.GetQuestionAttempts(ctx, teamID, questionID)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -64,7 +64,7 @@ func (us *UserService) RecordWrongAttempt(teamID int, questionID int, questionPo
 	// 2nd wrong: 10% of question points
 	// 3rd wrong: 30% of question points
 	// 4th wrong: 50% of question points
-	// 5th wrong: 70% of question points
+	// 5th wrong: 70% of question points, as is every extra attempt
 	var penalty int
 	switch attempt.WrongAttempts {
 	case 0:
@@ -75,34 +75,50 @@ func (us *UserService) RecordWrongAttempt(teamID int, questionID int, questionPo
 		penalty = (questionPoints * 30) / 100 // 30%
 	case 3:
 		penalty = (questionPoints * 50) / 100 // 50%
-	case 4:
-		penalty = (questionPoints * 70) / 100 // 70%
 	default:
+		// 5th wrong, and any on extra attempts after it
+		penalty = (questionPoints * 70) / 100 // 70%
+	}
+	if !us.FlagEnabled(ctx, FlagPenalties) {
 		penalty = 0
 	}
+
+	// A penalty shield the team spent on the question waives the penalty
+	if penalty > 0 && attempt.Shields > 0 {
+		shielded, err := us.Repo.UseShield(ctx, teamID, questionID)
+		if err != nil {
+			log.Printf("Error using shield of team %d on question %d: %v", teamID, questionID, err)
+			return 0, 0, err
+		}
+		if shielded {
+			log.Printf("Shield waived penalty %d of team %d on question %d", penalty, teamID, questionID)
+			penalty = 0
+		}
+	}
 	
 	newAttempts := attempt.WrongAttempts + 1
 	newTotalPenalty := attempt.TotalPenalty + penalty
-	attemptsLeft := 5 - newAttempts
+	attemptsLeft := MaxAttempts + attempt.ExtraAttempts - newAttempts
 	
 	// Insert or update the attempt record
-	query := database.ConvertPlaceholders(`INSERT INTO question_attempts (team_id, question_id, wrong_attempts, total_penalty, last_attempt_at)
-			  VALUES (?, ?, ?, ?, ?)
-			  ON CONFLICT(team_id, question_id) DO UPDATE SET
-			  wrong_attempts = ?,
-			  total_penalty = ?,
-			  last_attempt_at = ?`)
-	
-	now := time.Now()
-	_, err = us.UserStore.DB.Exec(query, 
-		teamID, questionID, newAttempts, newTotalPenalty, now,
-		newAttempts, newTotalPenalty, now)
-	
+	err = us.Repo.SaveAttempt(ctx, QuestionAttempt{
+		TeamID:        teamID,
+		QuestionID:    questionID,
+		WrongAttempts: newAttempts,
+		TotalPenalty:  newTotalPenalty,
+		LastAttemptAt: time.Now(),
+	})
 	if err != nil {
 		log.Printf("Error recording wrong attempt for team %d, question %d: %v", teamID, questionID, err)
 		return 0, 0, err
 	}
-	
+
+	// A wrong answer ends the team's streak
+	if err := us.Repo.ResetStreak(ctx, teamID); err != nil {
+		log.Printf("Error ending streak of team %d: %v", teamID, err)
+		return 0, 0, err
+	}
+
 	log.Printf("Recorded wrong attempt for team %d, question %d: attempts=%d, penalty=%d, total_penalty=%d", 
 		teamID, questionID, newAttempts, penalty, newTotalPenalty)
 	
@@ -110,45 +126,43 @@ func (us *UserService) RecordWrongAttempt(teamID int, questionID int, questionPo
 }
 
 // IsQuestionExhausted checks if a team has exhausted all attempts for a question
-func (us *UserService) IsQuestionExhausted(teamID int, questionID int) (bool, error) {
-	attempt, err := us.GetQuestionAttempts(teamID, questionID)
+func (us *UserService) IsQuestionExhausted(ctx context.Context, teamID int, questionID int) (bool, error) {
+	attempt, err := us.GetQuestionAttempts(ctx, teamID, questionID)
 	if err != nil {
 		return false, err
 	}
 	
-	return attempt.WrongAttempts >= 5, nil
+	return AttemptsLeft(*attempt) == 0, nil
 }
 
 // GetTotalPenalty gets the total penalty for a team across all questions
-func (us *UserService) GetTotalPenalty(teamID int) (int, error) {
-	query := database.ConvertPlaceholders(`SELECT COALESCE(SUM(total_penalty), 0) 
-			  FROM question_attempts 
-			  WHERE team_id = ?`)
-	
-	var totalPenalty int
-	err := us.UserStore.DB.QueryRow(query, teamID).Scan(&totalPenalty)
+func (us *UserService) GetTotalPenalty(ctx context.Context, teamID int) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	totalPenalty, err := us.Repo.SumPenalty(ctx, teamID)
 	if err != nil {
 		log.Printf("Error getting total penalty for team %d: %v", teamID, err)
 		return 0, err
 	}
-	
+
 	return totalPenalty, nil
 }
 
 // DeductPenaltyPoints deducts penalty points from team's score
-func (us *UserService) DeductPenaltyPoints(teamID int, penalty int) error {
+func (us *UserService) DeductPenaltyPoints(ctx context.Context, teamID int, penalty int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
 	if penalty <= 0 {
 		return nil
 	}
-	
-	query := database.ConvertPlaceholders(`UPDATE teams SET points = points - ? WHERE id = ?`)
-	
-	_, err := us.UserStore.DB.Exec(query, penalty, teamID)
-	if err != nil {
+
+	if err := us.Repo.AddTeamPoints(ctx, teamID, -penalty); err != nil {
 		log.Printf("Error deducting penalty %d from team %d: %v", penalty, teamID, err)
 		return err
 	}
-	
+
 	log.Printf("Deducted %d penalty points from team %d", penalty, teamID)
 	return nil
 }
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/png"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/namishh/holmes/database"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// AvatarPrefix starts the storage key of team avatars
+	AvatarPrefix = "AVT"
+	// AvatarSize is the width and height avatars are stored at
+	AvatarSize = 128
+	// MaxAvatarUploadSize caps the file a team uploads as its avatar
+	MaxAvatarUploadSize int64 = 1 << 20
+	// AvatarPath is where avatars are served from
+	AvatarPath = "/avatars/"
+)
+
+// maxAvatarPixels bounds the images decoded as avatars
+const maxAvatarPixels = 4096 * 4096
+
+var (
+	ErrAvatarNotFound = errors.New("avatar not found")
+	ErrInvalidAvatar  = errors.New("avatars must be a JPEG, PNG or GIF image")
+	ErrAvatarTooLarge = fmt.Errorf("avatars must be smaller than %d MB and %dx%d pixels", MaxAvatarUploadSize>>20, 4096, 4096)
+)
+
+// AvatarURL returns the address an avatar stored under key is served
+// from, empty for no avatar
+func AvatarURL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return AvatarPath + key
+}
+
+// resizeAvatar crops an image to its centre square and scales it to
+// AvatarSize, encoded as PNG
+func resizeAvatar(r io.Reader) (*bytes.Buffer, error) {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, ErrInvalidAvatar
+	}
+
+	bounds := src.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(bounds.Min).
+		Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+
+	dst := image.NewRGBA(image.Rect(0, 0, AvatarSize, AvatarSize))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, fmt.Errorf("failed to encode avatar: %v", err)
+	}
+	return &buf, nil
+}
+
+// SetTeamAvatar stores an uploaded image, cropped square and resized, as a
+// team's avatar in place of any it had
+func (us *UserService) SetTeamAvatar(ctx context.Context, teamID int, filename string, size int64, r io.ReadSeeker) error {
+	if size > MaxAvatarUploadSize {
+		return ErrAvatarTooLarge
+	}
+	if _, err := us.Uploads.ValidateUpload("images", filename, size, r); err != nil {
+		var rejected *UploadRejectedError
+		if errors.As(err, &rejected) {
+			return ErrInvalidAvatar
+		}
+		return err
+	}
+
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil || (format != "jpeg" && format != "png" && format != "gif") {
+		return ErrInvalidAvatar
+	}
+	if cfg.Width*cfg.Height > maxAvatarPixels {
+		return ErrAvatarTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	buf, err := resizeAvatar(r)
+	if err != nil {
+		return err
+	}
+
+	key := NewMediaKey(AvatarPrefix, "avatar.png")
+	if err := us.Storage.Put(context.Background(), key, buf, int64(buf.Len()), "image/png"); err != nil {
+		return fmt.Errorf("failed to store avatar: %v", err)
+	}
+
+	old, err := us.replaceAvatar(ctx, teamID, key)
+	if err != nil {
+		us.deleteAvatar(key)
+		return err
+	}
+	us.deleteAvatar(old)
+	log.Printf("Team %d set its avatar to %s", teamID, key)
+	return nil
+}
+
+// RemoveTeamAvatar takes away a team's avatar
+func (us *UserService) RemoveTeamAvatar(ctx context.Context, teamID int) error {
+	old, err := us.replaceAvatar(ctx, teamID, "")
+	if err != nil {
+		return err
+	}
+	us.deleteAvatar(old)
+	return nil
+}
+
+// replaceAvatar records key as a team's avatar, returning the key it had
+func (us *UserService) replaceAvatar(ctx context.Context, teamID int, key string) (string, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	old, err := us.Repo.GetTeamAvatar(ctx, teamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrTeamNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching avatar of team %d: %v", teamID, err)
+		return "", err
+	}
+	if _, err := us.Repo.SetTeamAvatar(ctx, teamID, key); err != nil {
+		log.Printf("Error setting avatar of team %d: %v", teamID, err)
+		return "", err
+	}
+	return old, nil
+}
+
+// deleteAvatar removes a stored avatar; failures are only logged, and
+// CleanupOrphanedMedia picks up what's left
+func (us *UserService) deleteAvatar(key string) {
+	if key == "" {
+		return
+	}
+	if err := us.Storage.Delete(context.Background(), key); err != nil {
+		log.Printf("Warning: Error deleting avatar %s: %v", key, err)
+	}
+}
+
+// OpenAvatar opens the avatar stored under key if a team still uses it,
+// or returns ErrAvatarNotFound
+func (us *UserService) OpenAvatar(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	if !strings.HasPrefix(key, AvatarPrefix+"-") {
+		return nil, ObjectInfo{}, ErrAvatarNotFound
+	}
+
+	dbCtx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	used, err := us.Repo.AvatarInUse(dbCtx, key)
+	if err != nil {
+		log.Printf("Error looking up avatar %s: %v", key, err)
+		return nil, ObjectInfo{}, err
+	}
+	if !used {
+		return nil, ObjectInfo{}, ErrAvatarNotFound
+	}
+
+	obj, info, err := us.Storage.Open(ctx, key)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, ObjectInfo{}, ErrAvatarNotFound
+	}
+	return obj, info, err
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/namishh/holmes/database"
+)
+
+// Backups are named BACKUP-<UTC time><ext>, so they sort by age and are
+// never mistaken for media by the orphan cleanup
+const (
+	BackupPrefix     = "BACKUP"
+	backupTimeFormat = "20060102T150405Z"
+)
+
+// Backup defaults; BACKUP_DIR and BACKUP_KEEP override them
+const (
+	DefaultBackupDir  = "backups"
+	DefaultBackupKeep = 7
+)
+
+var (
+	ErrBackupRunning  = errors.New("a backup is already running")
+	ErrBackupNotFound = errors.New("backup not found")
+)
+
+// BackupConfig says where database backups go
+type BackupConfig struct {
+	// Target is "local" (default) to write to Dir, or "bucket" to upload
+	// to the configured media storage
+	Target string
+	Dir    string
+
+	// Keep is how many backups are kept; older ones are deleted after
+	// each new backup. Negative keeps everything
+	Keep int
+}
+
+// BackupInfo describes one stored backup
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Target    string    `json:"target"`
+}
+
+// backupMu stops a scheduled backup and an admin-triggered one from
+// running at the same time
+var backupMu sync.Mutex
+
+func (c BackupConfig) toBucket() bool {
+	return c.Target == "bucket"
+}
+
+func (c BackupConfig) dir() string {
+	if c.Dir == "" {
+		return DefaultBackupDir
+	}
+	return c.Dir
+}
+
+func (c BackupConfig) target() string {
+	if c.toBucket() {
+		return "bucket"
+	}
+	return "local"
+}
+
+// CreateBackup snapshots the database and stores it at the configured
+// target, then prunes old backups. It isn't bound by the query timeout,
+// as a large database takes a while to copy
+func (us *UserService) CreateBackup(ctx context.Context) (BackupInfo, error) {
+	if !backupMu.TryLock() {
+		return BackupInfo{}, ErrBackupRunning
+	}
+	defer backupMu.Unlock()
+
+	cfg := us.Backups
+	created := time.Now().UTC()
+	name := BackupPrefix + "-" + created.Format(backupTimeFormat) + database.SnapshotExtension()
+
+	dir := cfg.dir()
+	if cfg.toBucket() {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := database.Snapshot(ctx, us.UserStore.DB, path); err != nil {
+		os.Remove(path)
+		log.Printf("Error creating backup %s: %v", name, err)
+		return BackupInfo{}, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	info := BackupInfo{Name: name, Size: stat.Size(), CreatedAt: created, Target: cfg.target()}
+
+	if cfg.toBucket() {
+		defer os.Remove(path)
+		f, err := os.Open(path)
+		if err != nil {
+			return BackupInfo{}, err
+		}
+		defer f.Close()
+		if err := us.Storage.Put(ctx, name, f, stat.Size(), "application/octet-stream"); err != nil {
+			log.Printf("Error uploading backup %s: %v", name, err)
+			return BackupInfo{}, fmt.Errorf("failed to upload backup: %v", err)
+		}
+	} else if err := os.Chmod(path, 0600); err != nil {
+		return BackupInfo{}, err
+	}
+
+	log.Printf("Created %s backup %s (%d bytes)", info.Target, name, info.Size)
+
+	if err := us.pruneBackups(ctx); err != nil {
+		log.Printf("Warning: Error pruning old backups: %v", err)
+	}
+	return info, nil
+}
+
+// ListBackups returns the stored backups, newest first
+func (us *UserService) ListBackups(ctx context.Context) ([]BackupInfo, error) {
+	cfg := us.Backups
+	var backups []BackupInfo
+
+	if cfg.toBucket() {
+		objects, err := us.Storage.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups: %v", err)
+		}
+		for _, obj := range objects {
+			if created, ok := parseBackupName(obj.Key); ok {
+				backups = append(backups, BackupInfo{Name: obj.Key, Size: obj.Size, CreatedAt: created, Target: "bucket"})
+			}
+		}
+	} else {
+		entries, err := os.ReadDir(cfg.dir())
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to list backups: %v", err)
+		}
+		for _, entry := range entries {
+			created, ok := parseBackupName(entry.Name())
+			if !ok || entry.IsDir() {
+				continue
+			}
+			stat, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			backups = append(backups, BackupInfo{Name: entry.Name(), Size: stat.Size(), CreatedAt: created, Target: "local"})
+		}
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// FetchBackup returns a local file holding the named backup, downloading
+// it first when backups go to the bucket. cleanup removes the download
+func (us *UserService) FetchBackup(ctx context.Context, name string) (path string, cleanup func(), err error) {
+	if _, ok := parseBackupName(name); !ok {
+		return "", nil, ErrBackupNotFound
+	}
+
+	if !us.Backups.toBucket() {
+		path = filepath.Join(us.Backups.dir(), name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return "", nil, ErrBackupNotFound
+		}
+		return path, func() {}, nil
+	}
+
+	obj, _, err := us.Storage.Open(ctx, name)
+	if errors.Is(err, ErrObjectNotFound) {
+		return "", nil, ErrBackupNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer obj.Close()
+
+	f, err := os.CreateTemp("", name+"-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.Remove(f.Name()) }
+	if _, err := io.Copy(f, obj); err != nil {
+		f.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("failed to download backup: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return f.Name(), cleanup, nil
+}
+
+// pruneBackups deletes all but the newest Keep backups
+func (us *UserService) pruneBackups(ctx context.Context) error {
+	keep := us.Backups.Keep
+	if keep == 0 {
+		keep = DefaultBackupKeep
+	}
+	if keep < 0 {
+		return nil
+	}
+
+	backups, err := us.ListBackups(ctx)
+	if err != nil || len(backups) <= keep {
+		return err
+	}
+
+	for _, b := range backups[keep:] {
+		if us.Backups.toBucket() {
+			err = us.Storage.Delete(ctx, b.Name)
+		} else {
+			err = os.Remove(filepath.Join(us.Backups.dir(), b.Name))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete backup %s: %v", b.Name, err)
+		}
+		log.Printf("Deleted old backup %s", b.Name)
+	}
+	return nil
+}
+
+// parseBackupName returns when a backup was taken, or false if name
+// isn't a backup
+func parseBackupName(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, BackupPrefix+"-")
+	if !ok || filepath.Base(name) != name {
+		return time.Time{}, false
+	}
+	stamp = strings.TrimSuffix(strings.TrimSuffix(stamp, ".db"), ".dump")
+	created, err := time.Parse(backupTimeFormat, stamp)
+	return created, err == nil
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Settings that brand the site for the organisation running the hunt
+const (
+	SettingBrandName        = "brand_name"
+	SettingBrandTagline     = "brand_tagline"
+	SettingBrandLogo        = "brand_logo"
+	SettingBrandPrimary     = "brand_primary_color"
+	SettingBrandAccent      = "brand_accent_color"
+	SettingBrandFooterLinks = "brand_footer_links"
+)
+
+const (
+	// DefaultBrandName is the event name until an admin sets one
+	DefaultBrandName = "Holmes"
+	// LogoPrefix starts the storage key of the uploaded logo
+	LogoPrefix = "LOGO"
+	// MaxLogoUploadSize caps the logo an admin uploads
+	MaxLogoUploadSize int64 = 1 << 20
+	// LogoPath is where the logo is served from
+	LogoPath = "/brand/logo/"
+	// MaxFooterLinks bounds the links in the footer
+	MaxFooterLinks = 10
+)
+
+var brandColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+var (
+	ErrInvalidBranding = errors.New("invalid branding")
+	ErrLogoNotFound    = errors.New("logo not found")
+	ErrInvalidLogo     = errors.New("the logo must be a PNG, JPEG or GIF image")
+	ErrLogoTooLarge    = fmt.Errorf("the logo must be smaller than %d MB and %dx%d pixels", MaxLogoUploadSize>>20, 4096, 4096)
+)
+
+// logoExtensions maps the image formats a logo may be in to the extension
+// it is stored with
+var logoExtensions = map[string]string{"png": ".png", "jpeg": ".jpg", "gif": ".gif"}
+
+// FooterLink is a link at the bottom of every page, such as the
+// organisers' site or a code of conduct
+type FooterLink struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// Branding is how the site presents the event: its name, tagline, logo,
+// colours and footer links. Empty fields keep the built-in look
+type Branding struct {
+	Name         string       `json:"name"`
+	Tagline      string       `json:"tagline"`
+	Logo         string       `json:"logo"`          // storage key of the uploaded logo
+	PrimaryColor string       `json:"primary_color"` // buttons, as #rrggbb
+	AccentColor  string       `json:"accent_color"`  // links and highlights, as #rrggbb
+	FooterLinks  []FooterLink `json:"footer_links"`
+}
+
+// LogoURL returns where the logo is served from, empty without one. The
+// key changes with every upload, so the logo can be cached for long
+func (b Branding) LogoURL() string {
+	if b.Logo == "" {
+		return ""
+	}
+	return LogoPath + b.Logo
+}
+
+// CSS overrides the colour variables the stylesheet's brand colours are
+// made of, empty when the built-in colours apply. Colours are checked
+// when saved, so the result is safe to put in a style element
+func (b Branding) CSS() string {
+	var vars []string
+	if c, ok := rgbChannels(b.PrimaryColor); ok {
+		vars = append(vars, "--brand-primary: "+c)
+		// Text on buttons stays readable on light and dark colours
+		if luminance(b.PrimaryColor) > 0.5 {
+			vars = append(vars, "--brand-contrast: 0 0 0")
+		} else {
+			vars = append(vars, "--brand-contrast: 255 255 255")
+		}
+	}
+	if c, ok := rgbChannels(b.AccentColor); ok {
+		vars = append(vars, "--brand-accent: "+c)
+	}
+	if len(vars) == 0 {
+		return ""
+	}
+	return ":root { " + strings.Join(vars, "; ") + " }"
+}
+
+// rgbChannels writes a #rrggbb colour as the space separated channels
+// Tailwind's <alpha-value> colours take
+func rgbChannels(hex string) (string, bool) {
+	if !brandColorPattern.MatchString(hex) {
+		return "", false
+	}
+	n, _ := strconv.ParseUint(hex[1:], 16, 32)
+	return fmt.Sprintf("%d %d %d", n>>16, n>>8&0xff, n&0xff), true
+}
+
+// luminance is the relative luminance of a #rrggbb colour, from 0 for
+// black to 1 for white
+func luminance(hex string) float64 {
+	n, _ := strconv.ParseUint(hex[1:], 16, 32)
+	return (0.2126*float64(n>>16) + 0.7152*float64(n>>8&0xff) + 0.0722*float64(n&0xff)) / 255
+}
+
+// ParseFooterLinks reads footer links written one per line as
+// "Label | https://example.com"
+func ParseFooterLinks(s string) []FooterLink {
+	var links []FooterLink
+	for _, line := range strings.Split(s, "\n") {
+		label, link, ok := strings.Cut(line, "|")
+		if !ok && strings.TrimSpace(line) == "" {
+			continue
+		}
+		links = append(links, FooterLink{Label: strings.TrimSpace(label), URL: strings.TrimSpace(link)})
+	}
+	return links
+}
+
+// checkBranding trims branding and checks it can be saved
+func checkBranding(b Branding) (Branding, error) {
+	b.Name = strings.TrimSpace(b.Name)
+	b.Tagline = strings.TrimSpace(b.Tagline)
+	b.PrimaryColor = strings.ToLower(strings.TrimSpace(b.PrimaryColor))
+	b.AccentColor = strings.ToLower(strings.TrimSpace(b.AccentColor))
+
+	switch {
+	case len(b.Name) > 64:
+		return b, fmt.Errorf("%w: the event name is longer than 64 characters", ErrInvalidBranding)
+	case len(b.Tagline) > 255:
+		return b, fmt.Errorf("%w: the tagline is longer than 255 characters", ErrInvalidBranding)
+	case b.PrimaryColor != "" && !brandColorPattern.MatchString(b.PrimaryColor):
+		return b, fmt.Errorf("%w: colours look like #1e40af", ErrInvalidBranding)
+	case b.AccentColor != "" && !brandColorPattern.MatchString(b.AccentColor):
+		return b, fmt.Errorf("%w: colours look like #1e40af", ErrInvalidBranding)
+	case len(b.FooterLinks) > MaxFooterLinks:
+		return b, fmt.Errorf("%w: the footer holds up to %d links", ErrInvalidBranding, MaxFooterLinks)
+	}
+	for _, l := range b.FooterLinks {
+		if l.Label == "" || len(l.Label) > 64 {
+			return b, fmt.Errorf("%w: every footer link needs a label of up to 64 characters", ErrInvalidBranding)
+		}
+		u, err := url.Parse(l.URL)
+		local := err == nil && strings.HasPrefix(l.URL, "/") && !strings.HasPrefix(l.URL, "//")
+		remote := err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "mailto") && (u.Host != "" || u.Scheme == "mailto")
+		if !local && !remote {
+			return b, fmt.Errorf("%w: footer link %q must go to a page here, such as /p/faq, or an http(s) or mailto address", ErrInvalidBranding, l.Label)
+		}
+	}
+	return b, nil
+}
+
+// GetBranding returns how the site presents the event, with the default
+// name when none is set
+func (us *UserService) GetBranding(ctx context.Context) Branding {
+	values, err := us.settings(ctx)
+	if err != nil {
+		return Branding{Name: DefaultBrandName}
+	}
+
+	b := Branding{
+		Name:         values[SettingBrandName],
+		Tagline:      values[SettingBrandTagline],
+		Logo:         values[SettingBrandLogo],
+		PrimaryColor: values[SettingBrandPrimary],
+		AccentColor:  values[SettingBrandAccent],
+	}
+	if b.Name == "" {
+		b.Name = DefaultBrandName
+	}
+	if value := values[SettingBrandFooterLinks]; value != "" {
+		if err := json.Unmarshal([]byte(value), &b.FooterLinks); err != nil {
+			log.Printf("Invalid value %q for setting %s", value, SettingBrandFooterLinks)
+		}
+	}
+	return b
+}
+
+// SetBranding saves the event's name, tagline, colours and footer links;
+// the logo is set on its own with SetLogo
+func (us *UserService) SetBranding(ctx context.Context, b Branding) error {
+	b, err := checkBranding(b)
+	if err != nil {
+		return err
+	}
+
+	links := ""
+	if len(b.FooterLinks) > 0 {
+		data, err := json.Marshal(b.FooterLinks)
+		if err != nil {
+			return err
+		}
+		links = string(data)
+	}
+
+	for key, value := range map[string]string{
+		SettingBrandName:        b.Name,
+		SettingBrandTagline:     b.Tagline,
+		SettingBrandPrimary:     b.PrimaryColor,
+		SettingBrandAccent:      b.AccentColor,
+		SettingBrandFooterLinks: links,
+	} {
+		if err := us.SetSetting(ctx, key, value); err != nil {
+			return err
+		}
+	}
+	log.Printf("Branding set to %q", b.Name)
+	return nil
+}
+
+// SetLogo stores an uploaded image as the event's logo in place of any it
+// had. Logos are stored as uploaded, at their own size
+func (us *UserService) SetLogo(ctx context.Context, filename string, size int64, r io.ReadSeeker) error {
+	if size > MaxLogoUploadSize {
+		return ErrLogoTooLarge
+	}
+	contentType, err := us.Uploads.ValidateUpload("images", filename, size, r)
+	if err != nil {
+		var rejected *UploadRejectedError
+		if errors.As(err, &rejected) {
+			return ErrInvalidLogo
+		}
+		return err
+	}
+
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil || logoExtensions[format] == "" {
+		return ErrInvalidLogo
+	}
+	if cfg.Width*cfg.Height > maxAvatarPixels {
+		return ErrLogoTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := NewMediaKey(LogoPrefix, "logo"+logoExtensions[format])
+	if err := us.Storage.Put(context.Background(), key, r, size, contentType); err != nil {
+		return fmt.Errorf("failed to store logo: %v", err)
+	}
+
+	old := us.GetBranding(ctx).Logo
+	if err := us.SetSetting(ctx, SettingBrandLogo, key); err != nil {
+		us.deleteLogo(key)
+		return err
+	}
+	us.deleteLogo(old)
+	log.Printf("Logo set to %s", key)
+	return nil
+}
+
+// RemoveLogo goes back to showing no logo
+func (us *UserService) RemoveLogo(ctx context.Context) error {
+	old := us.GetBranding(ctx).Logo
+	if err := us.DeleteSetting(ctx, SettingBrandLogo); err != nil {
+		return err
+	}
+	us.deleteLogo(old)
+	return nil
+}
+
+// deleteLogo removes a stored logo; failures are only logged
+func (us *UserService) deleteLogo(key string) {
+	if key == "" {
+		return
+	}
+	if err := us.Storage.Delete(context.Background(), key); err != nil {
+		log.Printf("Warning: Error deleting logo %s: %v", key, err)
+	}
+}
+
+// OpenLogo opens the logo stored under key if it is the current one, or
+// returns ErrLogoNotFound
+func (us *UserService) OpenLogo(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	if key == "" || key != us.GetBranding(ctx).Logo {
+		return nil, ObjectInfo{}, ErrLogoNotFound
+	}
+
+	obj, info, err := us.Storage.Open(ctx, key)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, ObjectInfo{}, ErrLogoNotFound
+	}
+	return obj, info, err
+}
+
+type brandingKey struct{}
+
+// WithBranding returns a context carrying the branding, for the layouts
+func WithBranding(ctx context.Context, b Branding) context.Context {
+	return context.WithValue(ctx, brandingKey{}, b)
+}
+
+// BrandingFrom returns the branding of a context, or the built-in look
+func BrandingFrom(ctx context.Context) Branding {
+	if b, ok := ctx.Value(brandingKey{}).(Branding); ok {
+		return b
+	}
+	return Branding{Name: DefaultBrandName}
+}
@@ -1,93 +1,225 @@
 package services
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/redis/go-redis/v9"
 )
 
 // EventType represents different types of events that can be broadcast
 type EventType string
 
 const (
-	EventQuestionLocked   EventType = "question_locked"
-	EventQuestionUnlocked EventType = "question_unlocked"
-	EventQuestionSolved   EventType = "question_solved"
+	EventQuestionLocked    EventType = "question_locked"
+	EventQuestionUnlocked  EventType = "question_unlocked"
+	EventQuestionSolved    EventType = "question_solved"
 	EventLeaderboardUpdate EventType = "leaderboard_update"
+
+	// Team-scoped events, only delivered to the team they concern
+	EventAttemptsUpdate EventType = "attempts_update"
+	EventQuotaUpdate    EventType = "quota_update"
+	EventQuotaReset     EventType = "quota_reset"
+
+	// Inbox notifications, global or team-scoped depending on the event
+	EventNotification EventType = "notification"
+
+	// Chat events, global for the shoutbox or team-scoped for team channels
+	EventChatMessage EventType = "chat_message"
+	EventChatDelete  EventType = "chat_delete"
+
+	// Countdown events, only sent on the pre-hunt countdown stream
+	EventCountdownTick EventType = "countdown_tick"
+	EventHuntStarted   EventType = "hunt_started"
+
+	// EventHuntEnded is sent once when the hunt's end time passes, after
+	// the final standings are saved
+	EventHuntEnded EventType = "hunt_ended"
+
+	// EventAlert is a new cheating alert, only sent on the admin channel
+	EventAlert EventType = "alert"
+
+	// EventClarification is a team asking for a clarification, only sent
+	// on the admin channel
+	EventClarification EventType = "clarification_requested"
+
+	// EventPhotoSubmitted is a team sending a photo answer to review, only
+	// sent on the admin channel
+	EventPhotoSubmitted EventType = "photo_submitted"
+
+	// EventAdminLockout is the admin login locking an address out after
+	// failed attempts, only sent on the admin channel
+	EventAdminLockout EventType = "admin_lockout"
+
+	// EventHealth is a dependency starting or stopping to fail its health
+	// check, only sent on the admin channel
+	EventHealth EventType = "health_changed"
+
+	// EventAchievement tells a team it earned a badge
+	EventAchievement EventType = "achievement_unlocked"
+
+	// EventReconnect is the last event on a connection before the server
+	// shuts down; clients should reconnect after a short random delay
+	EventReconnect EventType = "reconnect"
 )
 
+// AdminChannel is the TeamID admin clients subscribe with, and that
+// events only admins receive are sent to
+const AdminChannel = -1
+
+// ReconnectJitter spreads out clients reconnecting after a shutdown so
+// they don't all arrive at once
+const ReconnectJitter = 5 * time.Second
+
 // Event represents a broadcast event
+// TeamID restricts delivery to a single team's clients; 0 means global
+// HuntID restricts delivery to the clients of a single hunt and admins;
+// 0 means every hunt
 type Event struct {
 	Type      EventType              `json:"type"`
 	Data      map[string]interface{} `json:"data"`
+	TeamID    int                    `json:"team_id,omitempty"`
+	HuntID    int                    `json:"hunt_id,omitempty"`
 	Timestamp time.Time              `json:"timestamp"`
 }
 
 // Client represents an SSE client connection
+// TeamID is 0 for anonymous clients, which only receive global events
+// HuntID is the hunt the client plays in or watches
+// Disconnect is closed when the broadcaster drops the client under the
+// disconnect slow-client policy; handlers should return when it fires
 type Client struct {
 	ID         string
+	TeamID     int
+	HuntID     int
 	Channel    chan Event
 	Disconnect chan bool
+
+	disconnectOnce sync.Once
 }
 
-// Broadcaster manages SSE connections and Redis pub/sub
+// kick signals the client's handler to close the connection
+func (c *Client) kick() {
+	c.disconnectOnce.Do(func() {
+		close(c.Disconnect)
+	})
+}
+
+// wants reports whether the client is subscribed to the event's channel
+// and hunt. Admins hear every hunt
+func (c *Client) wants(event Event) bool {
+	if event.HuntID != 0 && event.HuntID != c.HuntID && c.TeamID != AdminChannel {
+		return false
+	}
+	return event.TeamID == 0 || event.TeamID == c.TeamID
+}
+
+// Broadcaster manages SSE connections and cross-instance fan-out
 type Broadcaster struct {
 	clients      map[string]*Client
 	clientsMutex sync.RWMutex
-	
-	redisClient  *redis.Client
-	ctx          context.Context
-	
+
+	// bus carries events to other instances; nil in standalone mode
+	bus MessageBus
+
+	// pusher reaches players whose tab is closed; nil when disabled
+	pusher Pusher
+
+	// listeners act on events published on this instance
+	listeners []Listener
+
 	// Channels for internal communication
-	register     chan *Client
-	unregister   chan *Client
-	broadcast    chan Event
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan Event
+
+	// opts controls how events are handed to slow clients
+	opts BroadcasterOptions
+
+	// closed is set by Shutdown, under clientsMutex
+	closed bool
+
+	metrics broadcasterMetrics
+}
+
+// broadcasterMetrics counts events through each stage of the fan-out
+type broadcasterMetrics struct {
+	published        atomic.Int64 // queued by Broadcast/BroadcastToTeam
+	publishDropped   atomic.Int64 // dropped because the broadcast channel was full
+	received         atomic.Int64 // arrived from other instances via the bus
+	busPublishErrors atomic.Int64 // failed to publish to the bus
+	delivered        atomic.Int64 // written into a client's channel
+	clientDropped    atomic.Int64 // skipped because a client's channel stayed full
+	clientKicked     atomic.Int64 // disconnected by the disconnect policy
+}
+
+// ClientStats describes a single connected client's queue
+type ClientStats struct {
+	ID            string `json:"id"`
+	TeamID        int    `json:"team_id"`
+	QueueDepth    int    `json:"queue_depth"`
+	QueueCapacity int    `json:"queue_capacity"`
+}
+
+// BroadcasterStats is a snapshot of the broadcaster's counters
+type BroadcasterStats struct {
+	ConnectedClients  int           `json:"connected_clients"`
+	EventsPublished   int64         `json:"events_published"`
+	EventsDropped     int64         `json:"events_dropped"`
+	EventsReceived    int64         `json:"events_received"`
+	BusPublishErrors  int64         `json:"bus_publish_errors"`
+	EventsDelivered   int64         `json:"events_delivered"`
+	ClientDrops       int64         `json:"client_drops"`
+	ClientsKicked     int64         `json:"clients_kicked"`
+	SlowClientPolicy  string        `json:"slow_client_policy"`
+	BroadcastQueue    int           `json:"broadcast_queue"`
+	BroadcastQueueCap int           `json:"broadcast_queue_capacity"`
+	BusEnabled        bool          `json:"bus_enabled"`
+	Clients           []ClientStats `json:"clients"`
+}
+
+// Pusher delivers events outside of open connections, e.g. Web Push
+// It is only handed events published on this instance, so each event is
+// pushed once no matter how many instances share the bus
+type Pusher interface {
+	Push(event Event)
+}
+
+// Listener acts on events as the game publishes them, e.g. awarding
+// achievements on solves. Like a Pusher, it is only handed events
+// published on this instance
+type Listener interface {
+	Handle(event Event)
 }
 
 // NewBroadcaster creates a new broadcaster instance
-func NewBroadcaster(redisAddr string, redisPassword string, redisDB int) *Broadcaster {
-	ctx := context.Background()
-	
-	var redisClient *redis.Client
-	if redisAddr != "" {
-		// Initialize Redis client
-		redisClient = redis.NewClient(&redis.Options{
-			Addr:     redisAddr,
-			Password: redisPassword,
-			DB:       redisDB,
-		})
-		
-		// Test connection
-		if err := redisClient.Ping(ctx).Err(); err != nil {
-			log.Printf("Warning: Redis connection failed: %v. Running in standalone mode.", err)
-			redisClient = nil
-		} else {
-			log.Println("Successfully connected to Redis for pub/sub")
-		}
-	}
-	
+// bus may be nil, in which case events only reach this instance's clients
+func NewBroadcaster(bus MessageBus, opts BroadcasterOptions) *Broadcaster {
 	b := &Broadcaster{
-		clients:      make(map[string]*Client),
-		redisClient:  redisClient,
-		ctx:          ctx,
-		register:     make(chan *Client, 100),
-		unregister:   make(chan *Client, 100),
-		broadcast:    make(chan Event, 1000),
+		clients:    make(map[string]*Client),
+		bus:        bus,
+		opts:       opts.withDefaults(),
+		register:   make(chan *Client, 100),
+		unregister: make(chan *Client, 100),
+		broadcast:  make(chan Event, 1000),
 	}
-	
+
 	// Start the broadcast loop
 	go b.run()
-	
-	// Start Redis subscriber if available
-	if b.redisClient != nil {
-		go b.subscribeToRedis()
+
+	// Deliver events from other instances to local clients
+	// (don't re-publish them to the bus)
+	if b.bus != nil {
+		if err := b.bus.Subscribe(b.receiveFromBus); err != nil {
+			log.Printf("Warning: Failed to subscribe to message bus: %v. Running in standalone mode.", err)
+			b.bus.Close()
+			b.bus = nil
+		}
 	}
-	
+
 	return b
 }
 
@@ -98,9 +230,13 @@ func (b *Broadcaster) run() {
 		case client := <-b.register:
 			b.clientsMutex.Lock()
 			b.clients[client.ID] = client
+			if b.closed {
+				// Connected while the server was shutting down
+				client.Channel <- reconnectEvent()
+			}
 			b.clientsMutex.Unlock()
 			log.Printf("Client registered: %s. Total clients: %d", client.ID, len(b.clients))
-			
+
 		case client := <-b.unregister:
 			b.clientsMutex.Lock()
 			if _, ok := b.clients[client.ID]; ok {
@@ -109,75 +245,62 @@ func (b *Broadcaster) run() {
 				log.Printf("Client unregistered: %s. Total clients: %d", client.ID, len(b.clients))
 			}
 			b.clientsMutex.Unlock()
-			
+
 		case event := <-b.broadcast:
-			// Publish to Redis for multi-instance support
-			if b.redisClient != nil {
-				go b.publishToRedis(event)
+			// Publish to the bus for multi-instance support
+			if b.bus != nil {
+				go b.publishToBus(event)
 			}
-			
+
 			// Broadcast to all connected clients
 			b.broadcastToClients(event)
 		}
 	}
 }
 
-// subscribeToRedis listens for events from Redis pub/sub
-func (b *Broadcaster) subscribeToRedis() {
-	pubsub := b.redisClient.Subscribe(b.ctx, "hunt_events")
-	defer pubsub.Close()
-	
-	ch := pubsub.Channel()
-	
-	for msg := range ch {
-		var event Event
-		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
-			log.Printf("Error unmarshaling Redis message: %v", err)
-			continue
-		}
-		
-		// Broadcast to local clients (don't re-publish to Redis)
-		b.broadcastToClients(event)
+// publishToBus hands an event to the message bus
+func (b *Broadcaster) publishToBus(event Event) {
+	if err := b.bus.Publish(event); err != nil {
+		b.metrics.busPublishErrors.Add(1)
+		log.Printf("Error publishing event to message bus: %v", err)
 	}
 }
 
-// publishToRedis publishes an event to Redis
-func (b *Broadcaster) publishToRedis(event Event) {
-	data, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("Error marshaling event for Redis: %v", err)
-		return
-	}
-	
-	if err := b.redisClient.Publish(b.ctx, "hunt_events", data).Err(); err != nil {
-		log.Printf("Error publishing to Redis: %v", err)
-	}
+// receiveFromBus delivers an event published by another instance
+func (b *Broadcaster) receiveFromBus(event Event) {
+	b.metrics.received.Add(1)
+	b.broadcastToClients(event)
 }
 
-// broadcastToClients sends an event to all connected SSE clients
+// broadcastToClients sends an event to all connected SSE clients subscribed to it
 func (b *Broadcaster) broadcastToClients(event Event) {
 	b.clientsMutex.RLock()
 	defer b.clientsMutex.RUnlock()
-	
-	for _, client := range b.clients {
-		select {
-		case client.Channel <- event:
-			// Successfully sent
-		case <-time.After(100 * time.Millisecond):
-			// Timeout - client might be slow or disconnected
-			log.Printf("Timeout sending to client %s", client.ID)
+
+	switch b.opts.SlowClientPolicy {
+	case PolicyWorkerPool:
+		b.sendWithWorkers(event)
+	default:
+		for _, client := range b.clients {
+			if client.wants(event) {
+				b.sendNonBlocking(client, event)
+			}
 		}
 	}
 }
 
-// RegisterClient adds a new SSE client
-func (b *Broadcaster) RegisterClient(clientID string) *Client {
+// RegisterClient adds a new SSE client subscribed to global events and
+// those of huntID and, when teamID is non-zero, to that team's private
+// channel
+func (b *Broadcaster) RegisterClient(clientID string, teamID, huntID int) *Client {
 	client := &Client{
 		ID:         clientID,
+		TeamID:     teamID,
+		HuntID:     huntID,
 		Channel:    make(chan Event, 100),
 		Disconnect: make(chan bool),
 	}
-	
+
 	b.register <- client
 	return client
 }
@@ -189,20 +312,114 @@ func (b *Broadcaster) UnregisterClient(client *Client) {
 
 // Broadcast sends an event to all clients
 func (b *Broadcaster) Broadcast(eventType EventType, data map[string]interface{}) {
-	event := Event{
+	b.publish(Event{
 		Type:      eventType,
 		Data:      data,
 		Timestamp: time.Now(),
-	}
-	
+	})
+}
+
+// BroadcastToTeam sends an event only to the clients of a single team
+func (b *Broadcaster) BroadcastToTeam(teamID int, eventType EventType, data map[string]interface{}) {
+	b.publish(Event{
+		Type:      eventType,
+		Data:      data,
+		TeamID:    teamID,
+		Timestamp: time.Now(),
+	})
+}
+
+// BroadcastToHunt sends an event only to the clients of a single hunt,
+// and to admins
+func (b *Broadcaster) BroadcastToHunt(huntID int, eventType EventType, data map[string]interface{}) {
+	b.publish(Event{
+		Type:      eventType,
+		Data:      data,
+		HuntID:    huntID,
+		Timestamp: time.Now(),
+	})
+}
+
+// BroadcastToAdmins sends an event only to the clients of admins
+func (b *Broadcaster) BroadcastToAdmins(eventType EventType, data map[string]interface{}) {
+	b.BroadcastToTeam(AdminChannel, eventType, data)
+}
+
+// publish queues an event for the broadcast loop
+func (b *Broadcaster) publish(event Event) {
 	select {
 	case b.broadcast <- event:
 		// Successfully queued
+		b.metrics.published.Add(1)
 	case <-time.After(100 * time.Millisecond):
-		log.Printf("Warning: Broadcast channel full, dropping event: %s", eventType)
+		b.metrics.publishDropped.Add(1)
+		log.Printf("Warning: Broadcast channel full, dropping event: %s", event.Type)
+	}
+
+	if b.pusher != nil {
+		go b.pusher.Push(event)
+	}
+	for _, l := range b.listeners {
+		go l.Handle(event)
 	}
 }
 
+func reconnectEvent() Event {
+	return Event{
+		Type: EventReconnect,
+		Data: map[string]interface{}{
+			"message":  "Server restarting",
+			"retry_ms": ReconnectJitter.Milliseconds(),
+		},
+		Timestamp: time.Now(),
+	}
+}
+
+// Shutdown sends every client a reconnect event, after which their
+// handlers close the connection, so shutting down doesn't wait on streams
+// that never end. Clients that connect afterwards are sent one straight
+// away. Only this instance's clients are affected
+func (b *Broadcaster) Shutdown() {
+	b.clientsMutex.Lock()
+	defer b.clientsMutex.Unlock()
+
+	b.closed = true
+	for _, client := range b.clients {
+		// Nothing else sends while the lock is held, so once a full queue
+		// has given up its oldest event there is room
+		if len(client.Channel) == cap(client.Channel) {
+			select {
+			case <-client.Channel:
+				b.metrics.clientDropped.Add(1)
+			default:
+			}
+		}
+		client.Channel <- reconnectEvent()
+	}
+	log.Printf("Asked %d clients to reconnect", len(b.clients))
+}
+
+// Close stops fan-out to other instances; call once nothing else will
+// be broadcast
+func (b *Broadcaster) Close() {
+	if b.bus != nil {
+		if err := b.bus.Close(); err != nil {
+			log.Printf("Error closing message bus: %v", err)
+		}
+	}
+}
+
+// SetPusher enables out-of-band delivery of events; call before serving
+func (b *Broadcaster) SetPusher(p Pusher) {
+	b.pusher = p
+}
+
+// AddListener hands every event published on this instance to l; call
+// before serving
+func (b *Broadcaster) AddListener(l Listener) {
+	b.listeners = append(b.listeners, l)
+}
+
 // GetClientCount returns the number of connected clients
 func (b *Broadcaster) GetClientCount() int {
 	b.clientsMutex.RLock()
@@ -210,6 +427,42 @@ func (b *Broadcaster) GetClientCount() int {
 	return len(b.clients)
 }
 
+// Stats returns a snapshot of the broadcaster's counters and client queues
+func (b *Broadcaster) Stats() BroadcasterStats {
+	b.clientsMutex.RLock()
+	clients := make([]ClientStats, 0, len(b.clients))
+	for _, client := range b.clients {
+		clients = append(clients, ClientStats{
+			ID:            client.ID,
+			TeamID:        client.TeamID,
+			QueueDepth:    len(client.Channel),
+			QueueCapacity: cap(client.Channel),
+		})
+	}
+	b.clientsMutex.RUnlock()
+
+	// Most backed-up clients first
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].QueueDepth > clients[j].QueueDepth
+	})
+
+	return BroadcasterStats{
+		ConnectedClients:  len(clients),
+		EventsPublished:   b.metrics.published.Load(),
+		EventsDropped:     b.metrics.publishDropped.Load(),
+		EventsReceived:    b.metrics.received.Load(),
+		BusPublishErrors:  b.metrics.busPublishErrors.Load(),
+		EventsDelivered:   b.metrics.delivered.Load(),
+		ClientDrops:       b.metrics.clientDropped.Load(),
+		ClientsKicked:     b.metrics.clientKicked.Load(),
+		SlowClientPolicy:  string(b.opts.SlowClientPolicy),
+		BroadcastQueue:    len(b.broadcast),
+		BroadcastQueueCap: cap(b.broadcast),
+		BusEnabled:        b.bus != nil,
+		Clients:           clients,
+	}
+}
+
 // FormatSSE formats an event as SSE message
 func FormatSSE(event Event) string {
 	data, _ := json.Marshal(event)
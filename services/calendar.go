@@ -0,0 +1,108 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// calendarRefresh is how often calendar apps are asked to fetch the feed
+// again, so a moved start or end reaches them
+const calendarRefresh = "PT1H"
+
+// icsTime is the UTC date-time form of iCalendar
+const icsTime = "20060102T150405Z"
+
+// HuntCalendar writes the hunt's schedule as an iCalendar (RFC 5545) feed
+// teams can subscribe to. It has an event from the start to the end of the
+// hunt, or one at whichever of the two is set; host keeps the event IDs
+// apart from other sites' and link is where the hunt is played
+func HuntCalendar(hunt Hunt, window HuntWindow, host, link string, now time.Time) string {
+	var b strings.Builder
+	line := func(name, value string) {
+		writeICSLine(&b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Holmes//Hunt Schedule//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", escapeICS(hunt.Name))
+	line("REFRESH-INTERVAL;VALUE=DURATION", calendarRefresh)
+	line("X-PUBLISHED-TTL", calendarRefresh)
+
+	event := func(uid, summary, description string, start, end time.Time) {
+		line("BEGIN", "VEVENT")
+		line("UID", fmt.Sprintf("hunt-%d-%s@%s", hunt.ID, uid, host))
+		line("DTSTAMP", now.UTC().Format(icsTime))
+		line("DTSTART", start.UTC().Format(icsTime))
+		if !end.IsZero() {
+			line("DTEND", end.UTC().Format(icsTime))
+		}
+		line("SUMMARY", escapeICS(summary))
+		if description != "" {
+			line("DESCRIPTION", escapeICS(description))
+		}
+		if link != "" {
+			line("URL", link)
+		}
+		line("END", "VEVENT")
+	}
+
+	description := ""
+	if window.TeamDuration > 0 {
+		description = fmt.Sprintf("Each team has %s from when it starts", clockLength(window.TeamDuration))
+		if !window.End.IsZero() {
+			description += ", until the hunt closes"
+		}
+		description += "."
+	}
+
+	switch {
+	case !window.Start.IsZero() && !window.End.IsZero():
+		event("window", hunt.Name, description, window.Start, window.End)
+	case !window.Start.IsZero():
+		event("start", hunt.Name+" starts", description, window.Start, time.Time{})
+	case !window.End.IsZero():
+		event("end", hunt.Name+" closes", "Answers are no longer accepted after this.", window.End, time.Time{})
+	}
+
+	line("END", "VCALENDAR")
+	return b.String()
+}
+
+// clockLength writes the length of a team's clock in hours when it is
+// whole hours, e.g. "3 hours", and in minutes otherwise
+func clockLength(d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return "1 hour"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d minutes", int(d.Minutes()))
+}
+
+// escapeICS escapes text for an iCalendar property value
+func escapeICS(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeICSLine ends a content line with CRLF, folding it into lines of at
+// most 75 octets without splitting a UTF-8 character
+func writeICSLine(b *strings.Builder, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // the space starting a continuation line counts
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// ChatGlobal is the channel of the shoutbox every team of a hunt can read
+const ChatGlobal = 0
+
+// ChatMessageMaxLength caps the length of a single chat message
+const ChatMessageMaxLength = 500
+
+// ChatMessage is a message in a hunt's shoutbox or a team's channel
+// Channel is ChatGlobal or the ID of the team the channel belongs to
+type ChatMessage = repository.ChatMessage
+
+// PostChatMessage stores a message in the hunt of the team posting it and
+// returns it with its ID, hunt and author set
+func (us *UserService) PostChatMessage(ctx context.Context, teamID int, channel int, body string) (ChatMessage, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	m := ChatMessage{
+		TeamID:    teamID,
+		Channel:   channel,
+		Body:      body,
+		CreatedAt: time.Now(),
+	}
+
+	var err error
+	m.TeamName, err = us.Repo.GetTeamName(ctx, teamID)
+	if err != nil {
+		log.Printf("Error getting team %d for chat message: %v", teamID, err)
+		return ChatMessage{}, err
+	}
+
+	m.HuntID, err = us.Repo.GetTeamHuntID(ctx, teamID)
+	if err != nil {
+		log.Printf("Error getting hunt of team %d for chat message: %v", teamID, err)
+		return ChatMessage{}, err
+	}
+
+	m.ID, err = us.Repo.CreateChatMessage(ctx, m)
+	if err != nil {
+		log.Printf("Error posting chat message for team %d: %v", teamID, err)
+		return ChatMessage{}, err
+	}
+
+	return m, nil
+}
+
+// GetChatMessages returns the latest messages of a hunt's channel, oldest
+// first
+func (us *UserService) GetChatMessages(ctx context.Context, huntID, channel, limit int) ([]ChatMessage, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	messages, err := us.Repo.ListChannelMessages(ctx, huntID, channel, limit)
+	if err != nil {
+		log.Printf("Error getting chat messages: %v", err)
+		return nil, err
+	}
+
+	// Selected newest first to apply the limit, shown oldest first
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// GetRecentChatMessages returns the latest messages across all channels
+// of a hunt, newest first
+func (us *UserService) GetRecentChatMessages(ctx context.Context, huntID, limit int) ([]ChatMessage, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	messages, err := us.Repo.ListRecentChatMessages(ctx, huntID, limit)
+	if err != nil {
+		log.Printf("Error getting chat messages: %v", err)
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// DeleteChatMessage removes a message and returns it so the deletion can be broadcast
+func (us *UserService) DeleteChatMessage(ctx context.Context, id int) (ChatMessage, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	m, err := us.Repo.GetChatMessage(ctx, id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error getting chat message %d: %v", id, err)
+		}
+		return ChatMessage{}, err
+	}
+
+	if err := us.Repo.DeleteChatMessage(ctx, id); err != nil {
+		log.Printf("Error deleting chat message %d: %v", id, err)
+		return ChatMessage{}, err
+	}
+
+	return m, nil
+}
+
+// MuteTeam stops a team from posting chat messages
+func (us *UserService) MuteTeam(ctx context.Context, teamID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.MuteTeam(ctx, teamID, time.Now()); err != nil {
+		log.Printf("Error muting team %d: %v", teamID, err)
+		return err
+	}
+
+	return nil
+}
+
+// UnmuteTeam lets a muted team post chat messages again
+func (us *UserService) UnmuteTeam(ctx context.Context, teamID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.UnmuteTeam(ctx, teamID); err != nil {
+		log.Printf("Error unmuting team %d: %v", teamID, err)
+		return err
+	}
+
+	return nil
+}
+
+// IsTeamMuted reports whether a team is muted in chat
+func (us *UserService) IsTeamMuted(ctx context.Context, teamID int) (bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	muted, err := us.Repo.IsTeamMuted(ctx, teamID)
+	if err != nil {
+		log.Printf("Error checking chat mute for team %d: %v", teamID, err)
+		return false, err
+	}
+
+	return muted, nil
+}
+
+// GetMutedTeams returns the IDs of all muted teams
+func (us *UserService) GetMutedTeams(ctx context.Context) (map[int]bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	teams, err := us.Repo.ListMutedTeams(ctx)
+	if err != nil {
+		log.Printf("Error getting muted teams: %v", err)
+		return nil, err
+	}
+
+	muted := make(map[int]bool)
+	for _, teamID := range teams {
+		muted[teamID] = true
+	}
+
+	return muted, nil
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+	"github.com/skip2/go-qrcode"
+)
+
+// How scanning a checkpoint's code counts for a team
+const (
+	// CheckpointUnlock keeps the question closed until the team scans it
+	CheckpointUnlock = "unlock"
+	// CheckpointSolve solves the question when the team scans it, in place
+	// of typing an answer
+	CheckpointSolve = "solve"
+)
+
+const (
+	// CheckpointPath is where the codes lead, followed by the token
+	CheckpointPath = "/checkpoint/"
+	// CheckpointQRSize is the width and height of a code image in pixels
+	CheckpointQRSize = 512
+	// checkpointSigBytes is how much of the HMAC a token carries
+	checkpointSigBytes = 12
+)
+
+// Checkpoint is a question opened or solved by scanning a QR code
+type Checkpoint = repository.Checkpoint
+
+// CheckpointScan is when a team scanned a checkpoint's code
+type CheckpointScan = repository.CheckpointScan
+
+var (
+	ErrInvalidCheckpoint   = errors.New("invalid checkpoint")
+	ErrCheckpointNotFound  = errors.New("this code isn't a checkpoint of your hunt")
+	ErrCheckpointOtherTeam = errors.New("this code belongs to another team")
+)
+
+func newSigningSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CheckpointToken returns what a checkpoint's code carries: the question,
+// the team it is for or 0 for every team, and a signature of both, as
+// "12-3-<signature>"
+func CheckpointToken(cp Checkpoint, teamID int) string {
+	return strconv.Itoa(cp.QuestionID) + "-" + strconv.Itoa(teamID) + "-" + checkpointSignature(cp.Secret, cp.QuestionID, teamID)
+}
+
+func checkpointSignature(secret string, questionID, teamID int) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d-%d", questionID, teamID)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:checkpointSigBytes])
+}
+
+// parseCheckpointToken splits a token into its question, team and
+// signature
+func parseCheckpointToken(token string) (questionID, teamID int, sig string, ok bool) {
+	parts := strings.SplitN(token, "-", 3)
+	if len(parts) != 3 {
+		return 0, 0, "", false
+	}
+	questionID, err := strconv.Atoi(parts[0])
+	if err != nil || questionID <= 0 {
+		return 0, 0, "", false
+	}
+	teamID, err = strconv.Atoi(parts[1])
+	if err != nil || teamID < 0 {
+		return 0, 0, "", false
+	}
+	return questionID, teamID, parts[2], true
+}
+
+// CheckpointQR draws a QR code of link as a PNG
+func CheckpointQR(link string) ([]byte, error) {
+	return qrcode.Encode(link, qrcode.Medium, CheckpointQRSize)
+}
+
+// SetCheckpoint makes a question a checkpoint opened or solved by scanning
+// its code, with a code for each team when perTeam is set; an empty mode
+// makes it an ordinary question again. Changing a checkpoint keeps its
+// codes working
+func (us *UserService) SetCheckpoint(ctx context.Context, questionID int, mode string, perTeam bool) error {
+	if mode == "" {
+		return us.RemoveCheckpoint(ctx, questionID)
+	}
+	if mode != CheckpointUnlock && mode != CheckpointSolve {
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidCheckpoint, mode)
+	}
+	secret, err := newSigningSecret()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.SetCheckpoint(ctx, questionID, mode, perTeam, secret, time.Now()); err != nil {
+		log.Printf("Error setting checkpoint of question %d: %v", questionID, err)
+		return err
+	}
+	log.Printf("Question %d is a checkpoint to %s (per team: %t)", questionID, mode, perTeam)
+	return nil
+}
+
+// RotateCheckpoint signs a checkpoint's codes with a new secret, so codes
+// printed before, such as ones that leaked, stop working
+func (us *UserService) RotateCheckpoint(ctx context.Context, questionID int) error {
+	secret, err := newSigningSecret()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ok, err := us.Repo.SetCheckpointSecret(ctx, questionID, secret, time.Now())
+	if err != nil {
+		log.Printf("Error rotating checkpoint of question %d: %v", questionID, err)
+		return err
+	}
+	if !ok {
+		return ErrCheckpointNotFound
+	}
+	log.Printf("New codes for the checkpoint of question %d", questionID)
+	return nil
+}
+
+// RemoveCheckpoint makes a checkpoint an ordinary question again,
+// forgetting who scanned it
+func (us *UserService) RemoveCheckpoint(ctx context.Context, questionID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeleteCheckpoint(ctx, questionID); err != nil {
+		log.Printf("Error removing checkpoint of question %d: %v", questionID, err)
+		return err
+	}
+	return nil
+}
+
+// GetCheckpoint returns the checkpoint of a question, nil for an ordinary
+// question
+func (us *UserService) GetCheckpoint(ctx context.Context, questionID int) (*Checkpoint, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	cp, err := us.Repo.GetCheckpoint(ctx, questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Error fetching checkpoint of question %d: %v", questionID, err)
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// GetCheckpoints returns the checkpoints of a hunt with how many teams
+// scanned each
+func (us *UserService) GetCheckpoints(ctx context.Context, huntID int) ([]Checkpoint, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	list, err := us.Repo.ListCheckpoints(ctx, huntID)
+	if err != nil {
+		log.Printf("Error listing checkpoints of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetCheckpointScans returns the teams that scanned a checkpoint's code
+func (us *UserService) GetCheckpointScans(ctx context.Context, questionID int) ([]CheckpointScan, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	list, err := us.Repo.ListCheckpointScans(ctx, questionID)
+	if err != nil {
+		log.Printf("Error listing scans of checkpoint %d: %v", questionID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// CheckpointScanned reports whether a team scanned a checkpoint's code
+func (us *UserService) CheckpointScanned(ctx context.Context, teamID, questionID int) (bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	scanned, err := us.Repo.IsCheckpointScanned(ctx, teamID, questionID)
+	if err != nil {
+		log.Printf("Error checking scan of checkpoint %d by team %d: %v", questionID, teamID, err)
+		return false, err
+	}
+	return scanned, nil
+}
+
+// CheckCheckpoint returns the checkpoint a scanned token is for, if it is
+// signed and may be scanned by the team: it is a checkpoint of the team's
+// hunt and, when the codes are per team, the team's own code
+func (us *UserService) CheckCheckpoint(ctx context.Context, teamID int, token string) (Checkpoint, error) {
+	questionID, tokenTeam, sig, ok := parseCheckpointToken(token)
+	if !ok {
+		return Checkpoint{}, ErrCheckpointNotFound
+	}
+	cp, err := us.GetCheckpoint(ctx, questionID)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if cp == nil || !hmac.Equal([]byte(sig), []byte(checkpointSignature(cp.Secret, questionID, tokenTeam))) {
+		return Checkpoint{}, ErrCheckpointNotFound
+	}
+
+	huntID, err := us.TeamHuntID(ctx, teamID)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if huntID != cp.HuntID {
+		return Checkpoint{}, ErrCheckpointNotFound
+	}
+	// A team's code is only ever its own, and per-team checkpoints take no
+	// shared code
+	if (tokenTeam != 0 && tokenTeam != teamID) || (cp.PerTeam && tokenTeam == 0) {
+		return Checkpoint{}, ErrCheckpointOtherTeam
+	}
+	return *cp, nil
+}
+
+// ScanCheckpoint records that a team scanned a checkpoint's code and
+// returns the checkpoint; scanning again changes nothing
+func (us *UserService) ScanCheckpoint(ctx context.Context, teamID int, token string) (Checkpoint, error) {
+	cp, err := us.CheckCheckpoint(ctx, teamID, token)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	added, err := us.Repo.RecordCheckpointScan(ctx, teamID, cp.QuestionID, time.Now())
+	if err != nil {
+		log.Printf("Error recording scan of checkpoint %d by team %d: %v", cp.QuestionID, teamID, err)
+		return Checkpoint{}, err
+	}
+	if added {
+		log.Printf("Team %d scanned the checkpoint of question %d", teamID, cp.QuestionID)
+	}
+	return cp, nil
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// ChunkSize is the largest chunk accepted per request; small enough to
+// pass the body limits of common reverse proxies
+const ChunkSize = 4 << 20
+
+// PartialUploadDir holds the data of uploads still being received. It is
+// local to the instance, so a load balancer must keep an admin's requests
+// on one instance for the length of an upload
+var PartialUploadDir = filepath.Join(LocalUploadDir, ".partial")
+
+var (
+	// ErrUploadNotFound is returned for an unknown or expired upload ID
+	ErrUploadNotFound = errors.New("upload not found")
+
+	// ErrUploadOffsetMismatch is returned when a chunk doesn't start where
+	// the previous one ended; the client should ask for the offset and resume
+	ErrUploadOffsetMismatch = errors.New("chunk offset does not match received bytes")
+
+	// ErrChunkTooLarge is returned for a chunk over ChunkSize or past the
+	// declared size
+	ErrChunkTooLarge = errors.New("chunk too large")
+)
+
+// ChunkedUpload is a resumable upload in progress
+type ChunkedUpload = repository.ChunkedUpload
+
+// chunkLocks serialises chunks of the same upload within this instance
+var chunkLocks sync.Map
+
+func partialPath(id string) string {
+	return filepath.Join(PartialUploadDir, id+".part")
+}
+
+// CreateChunkedUpload starts a resumable upload of size bytes into a
+// question's media slot
+func (us *UserService) CreateChunkedUpload(ctx context.Context, questionID int, kind, filename string, size int64) (ChunkedUpload, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if _, ok := mediaPrefixes[kind]; !ok {
+		return ChunkedUpload{}, ErrUnknownMediaKind
+	}
+	if size <= 0 {
+		return ChunkedUpload{}, &UploadRejectedError{filename, "file is empty"}
+	}
+	if err := us.Uploads.CheckSize(kind, filename, size); err != nil {
+		return ChunkedUpload{}, err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ChunkedUpload{}, err
+	}
+	u := ChunkedUpload{
+		ID:         hex.EncodeToString(b),
+		QuestionID: questionID,
+		Kind:       kind,
+		Filename:   filepath.Base(filename),
+		Size:       size,
+		CreatedAt:  time.Now(),
+	}
+
+	if err := os.MkdirAll(PartialUploadDir, 0755); err != nil {
+		return ChunkedUpload{}, err
+	}
+	f, err := os.Create(partialPath(u.ID))
+	if err != nil {
+		return ChunkedUpload{}, err
+	}
+	f.Close()
+
+	if err := us.Repo.CreateChunkedUpload(ctx, u); err != nil {
+		log.Printf("Error creating chunked upload: %v", err)
+		os.Remove(partialPath(u.ID))
+		return ChunkedUpload{}, err
+	}
+
+	return u, nil
+}
+
+// GetChunkedUpload returns an upload in progress, or ErrUploadNotFound
+func (us *UserService) GetChunkedUpload(ctx context.Context, id string) (ChunkedUpload, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	u, err := us.Repo.GetChunkedUpload(ctx, id)
+	if err == sql.ErrNoRows {
+		return u, ErrUploadNotFound
+	}
+	if err != nil {
+		log.Printf("Error getting chunked upload %s: %v", id, err)
+	}
+	return u, err
+}
+
+// AppendChunk writes the chunk starting at offset to an upload. When the
+// last byte arrives the file is validated, stored and attached to the
+// question, and its media key is returned; until then the key is empty
+func (us *UserService) AppendChunk(ctx context.Context, id string, offset int64, r io.Reader) (ChunkedUpload, string, error) {
+	lock, _ := chunkLocks.LoadOrStore(id, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	u, err := us.GetChunkedUpload(ctx, id)
+	if err != nil {
+		return u, "", err
+	}
+	if offset != u.Received {
+		return u, "", ErrUploadOffsetMismatch
+	}
+
+	f, err := os.OpenFile(partialPath(id), os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return u, "", ErrUploadNotFound
+	}
+	if err != nil {
+		return u, "", err
+	}
+	defer f.Close()
+
+	// Drop anything written past the last recorded chunk, e.g. by a
+	// request that failed halfway
+	if err := f.Truncate(u.Received); err != nil {
+		return u, "", err
+	}
+	if _, err := f.Seek(u.Received, io.SeekStart); err != nil {
+		return u, "", err
+	}
+
+	limit := min(int64(ChunkSize), u.Size-u.Received)
+	n, err := io.Copy(f, io.LimitReader(r, limit+1))
+	if err != nil {
+		return u, "", err
+	}
+	if n > limit {
+		f.Truncate(u.Received)
+		return u, "", ErrChunkTooLarge
+	}
+	if err := f.Close(); err != nil {
+		return u, "", err
+	}
+
+	// Receiving the chunk can outlast the query timeout on a slow link,
+	// so only the update is bounded by it
+	dbCtx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	u.Received += n
+	if err := us.Repo.SetChunkedUploadReceived(dbCtx, id, u.Received); err != nil {
+		log.Printf("Error updating chunked upload %s: %v", id, err)
+		return u, "", err
+	}
+
+	if u.Received < u.Size {
+		return u, "", nil
+	}
+
+	key, err := us.finishChunkedUpload(ctx, u)
+	return u, key, err
+}
+
+// finishChunkedUpload moves a complete upload into storage and attaches
+// it to its question. The partial file is removed whatever the outcome
+func (us *UserService) finishChunkedUpload(ctx context.Context, u ChunkedUpload) (string, error) {
+	defer us.discardChunkedUpload(context.WithoutCancel(ctx), u.ID)
+
+	f, err := os.Open(partialPath(u.ID))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	contentType, err := us.Uploads.ValidateUpload(u.Kind, u.Filename, u.Size, f)
+	if err != nil {
+		return "", err
+	}
+
+	key := NewMediaKey(mediaPrefixes[u.Kind], u.Filename)
+	if err := us.Storage.Put(ctx, key, f, u.Size, contentType); err != nil {
+		return "", fmt.Errorf("failed to store uploaded file: %v", err)
+	}
+
+	if err := us.attachMedia(ctx, u.QuestionID, u.Kind, key, u.Filename); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// discardChunkedUpload removes an upload's row and partial file
+func (us *UserService) discardChunkedUpload(ctx context.Context, id string) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeleteChunkedUpload(ctx, id); err != nil {
+		log.Printf("Error deleting chunked upload %s: %v", id, err)
+	}
+	if err := os.Remove(partialPath(id)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error deleting partial upload %s: %v", id, err)
+	}
+	chunkLocks.Delete(id)
+}
+
+// CleanupStaleUploads discards uploads started more than
+// OrphanGracePeriod ago that never completed
+func (us *UserService) CleanupStaleUploads(ctx context.Context) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ids, err := us.Repo.ListChunkedUploadsBefore(ctx, time.Now().Add(-OrphanGracePeriod))
+	if err != nil {
+		log.Printf("Error listing stale uploads: %v", err)
+		return 0, err
+	}
+
+	for _, id := range ids {
+		us.discardChunkedUpload(ctx, id)
+	}
+	return len(ids), nil
+}
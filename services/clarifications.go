@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// ClarificationMaxLength caps the length of a request and of its answer
+const ClarificationMaxLength = 1000
+
+// Clarification is something a team asked about a question, with the
+// admins' answer once there is one
+type Clarification = repository.Clarification
+
+var (
+	ErrClarificationNotFound = errors.New("clarification not found")
+	ErrInvalidClarification  = errors.New("write something, at most 1000 characters")
+)
+
+// checkClarificationText trims a request or answer and checks its length
+func checkClarificationText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || utf8.RuneCountInString(text) > ClarificationMaxLength {
+		return "", ErrInvalidClarification
+	}
+	return text, nil
+}
+
+// AskClarification stores a team's request about a question for the
+// admins to answer
+func (us *UserService) AskClarification(ctx context.Context, teamID, questionID int, body string) (Clarification, error) {
+	body, err := checkClarificationText(body)
+	if err != nil {
+		return Clarification{}, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	id, err := us.Repo.CreateClarification(ctx, teamID, questionID, body, time.Now())
+	if err != nil {
+		log.Printf("Error saving clarification of team %d on question %d: %v", teamID, questionID, err)
+		return Clarification{}, err
+	}
+	c, err := us.Repo.GetClarification(ctx, id)
+	if err != nil {
+		log.Printf("Error fetching clarification %d: %v", id, err)
+		return Clarification{}, err
+	}
+	return c, nil
+}
+
+// GetQuestionClarifications returns a team's own requests about a
+// question and every published answer on it, oldest first
+func (us *UserService) GetQuestionClarifications(ctx context.Context, teamID, questionID int) ([]Clarification, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	list, err := us.Repo.ListQuestionClarifications(ctx, teamID, questionID)
+	if err != nil {
+		log.Printf("Error listing clarifications on question %d for team %d: %v", questionID, teamID, err)
+		return nil, err
+	}
+	if list == nil {
+		list = make([]Clarification, 0)
+	}
+	return list, nil
+}
+
+// GetClarifications returns the clarifications of a hunt, unanswered
+// first, leaving out the answered ones unless answered is set
+func (us *UserService) GetClarifications(ctx context.Context, huntID int, answered bool) ([]Clarification, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	list, err := us.Repo.ListClarifications(ctx, huntID, answered)
+	if err != nil {
+		log.Printf("Error listing clarifications of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+	if list == nil {
+		list = make([]Clarification, 0)
+	}
+	return list, nil
+}
+
+// AnswerClarification answers a request, privately to the team that
+// asked or publicly to every team, and returns it answered. Answering
+// again replaces the answer
+func (us *UserService) AnswerClarification(ctx context.Context, id int, answer string, public bool) (Clarification, error) {
+	answer, err := checkClarificationText(answer)
+	if err != nil {
+		return Clarification{}, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ok, err := us.Repo.AnswerClarification(ctx, id, answer, public, time.Now())
+	if err != nil {
+		log.Printf("Error answering clarification %d: %v", id, err)
+		return Clarification{}, err
+	}
+	if !ok {
+		return Clarification{}, ErrClarificationNotFound
+	}
+
+	c, err := us.Repo.GetClarification(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Clarification{}, ErrClarificationNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching clarification %d: %v", id, err)
+		return Clarification{}, err
+	}
+	return c, nil
+}
@@ -0,0 +1,44 @@
+package services
+
+import "time"
+
+const (
+	// DefaultCooldown is the seconds a team waits after its first wrong
+	// answer to a new question
+	DefaultCooldown = 30
+	// MaxCooldown caps the wait, however many wrong answers came before
+	MaxCooldown = 10 * time.Minute
+)
+
+// CooldownFor returns how long a team waits after its nth wrong answer to
+// a question: the question's cooldown, doubled for each wrong answer after
+// the first. It is zero for questions without a cooldown
+func CooldownFor(q Question, wrongAttempts int) time.Duration {
+	if q.Cooldown <= 0 || wrongAttempts <= 0 {
+		return 0
+	}
+	wait := time.Duration(q.Cooldown) * time.Second
+	for i := 1; i < wrongAttempts && wait < MaxCooldown; i++ {
+		wait *= 2
+	}
+	if wait > MaxCooldown {
+		wait = MaxCooldown
+	}
+	return wait
+}
+
+// CooldownLeft returns how much longer a team waits before answering a
+// question again, zero once it may answer
+func CooldownLeft(q Question, a QuestionAttempt, now time.Time) time.Duration {
+	left := a.LastAttemptAt.Add(CooldownFor(q, a.WrongAttempts)).Sub(now)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// CooldownSeconds rounds a wait up to whole seconds, so a countdown never
+// reaches zero before the server accepts an answer
+func CooldownSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/namishh/holmes/database"
+)
+
+// MaxCreditParts is the most parts a question can be split into when
+// crediting the parts a team completed
+const MaxCreditParts = 100
+
+var (
+	// ErrInvalidCredit is returned for credit that isn't a share of the
+	// question: nothing, or more than all of it
+	ErrInvalidCredit = fmt.Errorf("credit must be between 1 and %d parts of the question, and at most all of them", MaxCreditParts)
+	ErrSolveNotFound = errors.New("team hasn't solved this question")
+)
+
+// CheckCredit checks that share of of parts is a credit that can be
+// awarded; a percentage is share of 100
+func CheckCredit(share, of int) error {
+	if of < 1 || of > MaxCreditParts || share < 1 || share > of {
+		return ErrInvalidCredit
+	}
+	return nil
+}
+
+// CreditPoints is share of of parts of points, rounded to the nearest
+// whole point with halves rounded up. Any credit is worth at least a
+// point, so a partial solve never scores nothing
+func CreditPoints(points, share, of int) int {
+	if points <= 0 {
+		return 0
+	}
+	credit := (2*points*share + of) / (2 * of)
+	return max(credit, 1)
+}
+
+// CreditPercent is the share of the question's points a solve earned, as
+// a whole percentage
+func CreditPercent(points, questionPoints int) int {
+	if questionPoints <= 0 {
+		return 100
+	}
+	return (200*points + questionPoints) / (2 * questionPoints)
+}
+
+// RegradeSolve makes a team's solve worth points, moving the team's score
+// by the difference, and returns what it was worth before. A solve waiting
+// for review leaves the score alone and pays its new worth once approved
+func (us *UserService) RegradeSolve(ctx context.Context, teamID, questionID, points int) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting regrade of question %d for team %d: %v", questionID, teamID, err)
+		return 0, err
+	}
+	defer tx.Rollback()
+	q := us.Repo.WithTx(tx)
+
+	old, err := q.GetSolvePoints(ctx, teamID, questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrSolveNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching solve of question %d by team %d: %v", questionID, teamID, err)
+		return 0, err
+	}
+	if old == points {
+		return old, nil
+	}
+
+	if err := q.SetSolvePoints(ctx, teamID, questionID, points); err != nil {
+		log.Printf("Error regrading solve of question %d by team %d: %v", questionID, teamID, err)
+		return 0, err
+	}
+	// A solve waiting for review hasn't paid its points yet
+	pending, err := q.AdjustPendingReviewPoints(ctx, teamID, questionID, points-old)
+	if err != nil {
+		log.Printf("Error updating review of question %d by team %d: %v", questionID, teamID, err)
+		return 0, err
+	}
+	if !pending {
+		if err := q.AddTeamPoints(ctx, teamID, points-old); err != nil {
+			log.Printf("Error moving points of team %d: %v", teamID, err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing regrade of question %d for team %d: %v", questionID, teamID, err)
+		return 0, err
+	}
+	log.Printf("Solve of question %d by team %d regraded from %d to %d points", questionID, teamID, old, points)
+	return old, nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// discordMaxContent is the longest message Discord accepts
+const discordMaxContent = 2000
+
+// settingDiscordTemplate prefixes the setting holding an event's Discord
+// message template, when the organisers changed it
+const settingDiscordTemplate = "discord_template."
+
+var (
+	ErrInvalidDiscordTemplate = errors.New("invalid Discord message template")
+	ErrEmptyDiscordMessage    = errors.New("template renders an empty message")
+)
+
+// DiscordTemplates are the messages posted to Discord for each event,
+// executed with the event's data
+var DiscordTemplates = map[string]string{
+	WebhookQuestionSolved: `✅ **{{.team_name}}** solved **{{.question_title}}** for {{.points}} points`,
+	WebhookFirstBlood:     `🩸 First blood! **{{.team_name}}** is the first to solve **{{.question_title}}**`,
+	WebhookTeamRegistered: `👋 **{{.team_name}}** joined the hunt`,
+	WebhookHuntEnded:      "🏁 The hunt is over, thanks for playing!{{range .standings}}\n{{.Place}}. **{{.TeamName}}**, {{.Points}} points{{end}}",
+	WebhookAnnouncement:   "📣 **{{.title}}**{{if .message}}\n{{.message}}{{end}}{{if .link}}\n{{.link}}{{end}}",
+}
+
+// DiscordTemplate is the message template of an event, and whether the
+// organisers changed it from the default
+type DiscordTemplate struct {
+	Event      string
+	Default    string
+	Text       string
+	Customised bool
+}
+
+// discordSample is the data templates are tried against before saving
+var discordSample = map[string]interface{}{
+	"question_id":    1,
+	"question_title": "The Speckled Band",
+	"team_id":        1,
+	"team_name":      "scotland_yard",
+	"points":         100,
+	"title":          "Hints are live",
+	"message":        "Every question now has a hint.",
+	"link":           "/hunt",
+	"standings":      []HuntResult{{Place: 1, TeamName: "scotland_yard", Points: 100}},
+}
+
+// GetDiscordTemplates returns the message template of every event
+func (us *UserService) GetDiscordTemplates(ctx context.Context) ([]DiscordTemplate, error) {
+	var templates []DiscordTemplate
+	for _, event := range WebhookEvents {
+		text, customised, err := us.GetSetting(ctx, settingDiscordTemplate+event)
+		if err != nil {
+			return nil, err
+		}
+		if !customised {
+			text = DiscordTemplates[event]
+		}
+		templates = append(templates, DiscordTemplate{
+			Event:      event,
+			Default:    DiscordTemplates[event],
+			Text:       text,
+			Customised: customised,
+		})
+	}
+	return templates, nil
+}
+
+// SetDiscordTemplate changes the message posted for an event, checking it
+// renders first. An empty text restores the default
+func (us *UserService) SetDiscordTemplate(ctx context.Context, event, text string) error {
+	if _, ok := DiscordTemplates[event]; !ok {
+		return fmt.Errorf("%w: unknown event %q", ErrInvalidDiscordTemplate, event)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" || text == DiscordTemplates[event] {
+		return us.DeleteSetting(ctx, settingDiscordTemplate+event)
+	}
+	if _, err := renderDiscordContent(text, discordSample); err != nil {
+		return fmt.Errorf("%w for %s: %s", ErrInvalidDiscordTemplate, event, err)
+	}
+	return us.SetSetting(ctx, settingDiscordTemplate+event, text)
+}
+
+// discordMessage renders the body posted to a Discord webhook for an event
+func (us *UserService) discordMessage(ctx context.Context, event string, data map[string]interface{}) ([]byte, error) {
+	text, ok, err := us.GetSetting(ctx, settingDiscordTemplate+event)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		text = DiscordTemplates[event]
+	}
+	content, err := renderDiscordContent(text, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Team names and announcements are posted as they are, so mentions in
+	// them must not ping anyone
+	return json.Marshal(map[string]interface{}{
+		"content":          content,
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	})
+}
+
+// renderDiscordContent executes a message template, cut to the length
+// Discord accepts
+func renderDiscordContent(text string, data map[string]interface{}) (string, error) {
+	tmpl, err := template.New("discord").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	content := strings.TrimSpace(buf.String())
+	if content == "" {
+		return "", ErrEmptyDiscordMessage
+	}
+	if utf8.RuneCountInString(content) > discordMaxContent {
+		runes := []rune(content)
+		content = string(runes[:discordMaxContent-1]) + "…"
+	}
+	return content, nil
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Why two teams look like the same people
+const (
+	DuplicateSameIP          = "same_ip"
+	DuplicateSameFingerprint = "same_fingerprint"
+	DuplicateSimilarEmail    = "similar_email"
+)
+
+// FingerprintHeader carries a fingerprint of the browser a team registers
+// from. The registration form sends it as the fingerprint field instead
+const FingerprintHeader = "X-Client-Fingerprint"
+
+// Registration is how a team signed up
+type Registration = repository.Registration
+
+// DuplicatePair is two teams of a hunt that look like the same people;
+// Other registered after Team
+type DuplicatePair struct {
+	Team    Registration `json:"team"`
+	Other   Registration `json:"other"`
+	Reasons []string     `json:"reasons"`
+}
+
+var (
+	// ErrMergeSelf is returned when merging a team into itself
+	ErrMergeSelf = errors.New("a team cannot be merged into itself")
+	// ErrMergeHunts is returned when merging teams of different hunts
+	ErrMergeHunts = errors.New("only teams of the same hunt can be merged")
+)
+
+// Fingerprint reduces the browser fingerprint a team registers with to
+// what is stored, empty when there is none
+func Fingerprint(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalEmail lowercases an address and drops what mail providers
+// ignore: a +tag, and the dots of a Gmail address
+func canonicalEmail(email string) (local, domain string) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email, ""
+	}
+	local, domain = email[:at], email[at+1:]
+	if i := strings.Index(local, "+"); i >= 0 {
+		local = local[:i]
+	}
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local, domain
+}
+
+// similarEmails reports whether two addresses likely belong to one person:
+// the same once canonical, or on one domain with names one edit apart
+func similarEmails(a, b string) bool {
+	la, da := canonicalEmail(a)
+	lb, db := canonicalEmail(b)
+	if da != db {
+		return false
+	}
+	if la == lb {
+		return true
+	}
+	// Short names one edit apart are too often different people
+	if len(la) < 6 || len(lb) < 6 {
+		return false
+	}
+	return editDistance(la, lb) <= 1
+}
+
+// editDistance counts the insertions, deletions and substitutions that
+// turn a into b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// duplicateReasons returns why two registrations look like one team
+func duplicateReasons(a, b Registration) []string {
+	var reasons []string
+	if a.IP != "" && a.IP == b.IP {
+		reasons = append(reasons, DuplicateSameIP)
+	}
+	if a.Fingerprint != "" && a.Fingerprint == b.Fingerprint {
+		reasons = append(reasons, DuplicateSameFingerprint)
+	}
+	if similarEmails(a.Email, b.Email) {
+		reasons = append(reasons, DuplicateSimilarEmail)
+	}
+	return reasons
+}
+
+// FindDuplicates pairs up the teams of a hunt that registered from the same
+// address or browser, or with near-identical emails, newest pairs first
+func (us *UserService) FindDuplicates(ctx context.Context, huntID int) ([]DuplicatePair, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	regs, err := us.Repo.ListRegistrations(ctx, huntID)
+	if err != nil {
+		log.Printf("Error listing registrations of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+
+	pairs := make([]DuplicatePair, 0)
+	for i := range regs {
+		for j := i + 1; j < len(regs); j++ {
+			if reasons := duplicateReasons(regs[i], regs[j]); len(reasons) > 0 {
+				pairs = append(pairs, DuplicatePair{Team: regs[i], Other: regs[j], Reasons: reasons})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Other.TeamID > pairs[j].Other.TeamID
+	})
+	return pairs, nil
+}
+
+// setSuspended suspends a team from at, or lifts its suspension when at is
+// zero
+func (us *UserService) setSuspended(ctx context.Context, teamID int, at time.Time) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ok, err := us.Repo.SetTeamSuspended(ctx, teamID, sql.NullTime{Time: at, Valid: !at.IsZero()})
+	if err != nil {
+		log.Printf("Error setting suspension of team %d: %v", teamID, err)
+		return err
+	}
+	if !ok {
+		return ErrTeamNotFound
+	}
+	return nil
+}
+
+// SuspendTeam stops a team from logging in and playing
+func (us *UserService) SuspendTeam(ctx context.Context, teamID int) error {
+	return us.setSuspended(ctx, teamID, time.Now())
+}
+
+// UnsuspendTeam lets a suspended team back in
+func (us *UserService) UnsuspendTeam(ctx context.Context, teamID int) error {
+	return us.setSuspended(ctx, teamID, time.Time{})
+}
+
+// IsTeamSuspended reports whether a team is suspended; the admin, who has
+// no team, never is
+func (us *UserService) IsTeamSuspended(ctx context.Context, teamID int) (bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	at, err := us.Repo.GetTeamSuspended(ctx, teamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("Error fetching suspension of team %d: %v", teamID, err)
+		return false, err
+	}
+	return at.Valid, nil
+}
+
+// MergeTeam folds a duplicate team into the one it copies: its submission
+// and login history move over, and the duplicate is deleted along with its
+// solves and points
+func (us *UserService) MergeTeam(ctx context.Context, from, into int) error {
+	if from == into {
+		return ErrMergeSelf
+	}
+	fromHunt, err := us.TeamHuntID(ctx, from)
+	if err != nil {
+		return err
+	}
+	intoHunt, err := us.TeamHuntID(ctx, into)
+	if err != nil {
+		return err
+	}
+	if fromHunt != intoHunt {
+		return ErrMergeHunts
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting merge of team %d into %d: %v", from, into, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	repo := us.Repo.WithTx(tx)
+	if err := repo.MoveTeamHistory(ctx, from, into); err != nil {
+		log.Printf("Error merging team %d into %d: %v", from, into, err)
+		return err
+	}
+	if _, err := repo.DeleteTeam(ctx, from); err != nil {
+		log.Printf("Error merging team %d into %d: %v", from, into, err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing merge of team %d into %d: %v", from, into, err)
+		return err
+	}
+
+	log.Printf("Merged team %d into %d", from, into)
+	return nil
+}
@@ -0,0 +1,739 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Email templates
+const (
+	EmailVerification  = "verification"
+	EmailPasswordReset = "password_reset"
+	EmailAnnouncement  = "announcement"
+	EmailHuntReminder  = "hunt_reminder"
+	EmailTest          = "test"
+)
+
+const (
+	// EmailMaxAttempts is how many times an email is tried before giving up
+	EmailMaxAttempts = 6
+
+	// emailRetryBase is the delay before the first retry, doubled after each one
+	emailRetryBase = time.Minute
+
+	// emailBatch is how many due emails one delivery run sends
+	emailBatch = 50
+
+	// VerificationTokenTTL is how long an email verification link works
+	VerificationTokenTTL = 72 * time.Hour
+
+	// PasswordResetTokenTTL is how long a password reset link works
+	PasswordResetTokenTTL = time.Hour
+
+	// MinPasswordLength is the shortest password a team may set
+	MinPasswordLength = 8
+)
+
+// SettingHuntReminderSent holds the hunt start the reminder went out for
+const SettingHuntReminderSent = "hunt_reminder_sent"
+
+// What an emailed token is good for
+const (
+	emailTokenVerify = "verify"
+	emailTokenReset  = "reset"
+)
+
+var (
+	ErrMailDisabled      = errors.New("email is not set up on this server")
+	ErrInvalidEmailToken = errors.New("this link is invalid or has expired")
+	ErrPasswordTooShort  = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+
+	ErrUnknownEmailTemplate = errors.New("unknown email template")
+	ErrInvalidEmailTemplate = errors.New("invalid email template")
+)
+
+// Email is a message in the outbox
+type Email = repository.Email
+
+// emailTemplate is the built-in copy of one kind of email, in
+// text/template syntax, and the values its data holds
+type emailTemplate struct {
+	Subject   string
+	Body      string
+	Variables []EmailVariable
+}
+
+// EmailVariable is a value a template can fill in, written {{.Name}}
+type EmailVariable struct {
+	Name        string
+	Description string
+	Example     string // what previews and test emails fill in
+}
+
+var (
+	teamVariable    = EmailVariable{"Team", "the team's name", "scotland_yard"}
+	expiresVariable = EmailVariable{"Expires", "how long the link works", "an hour"}
+)
+
+// EmailTemplateNames lists every template, in the order the panel shows them
+var EmailTemplateNames = []string{EmailVerification, EmailPasswordReset, EmailAnnouncement, EmailHuntReminder, EmailTest}
+
+var emailTemplates = map[string]emailTemplate{
+	EmailVerification: {
+		Subject: "Confirm your email for {{.Team}}",
+		Body: `Hi {{.Team}},
+
+Confirm that this is your team's email address by opening this link:
+
+{{.Link}}
+
+The link works for {{.Expires}}. If you didn't register for the hunt, you
+can ignore this email.
+`,
+		Variables: []EmailVariable{
+			teamVariable,
+			{"Link", "the link that confirms the address", "https://hunt.example.com/verify-email?token=..."},
+			expiresVariable,
+		},
+	},
+	EmailPasswordReset: {
+		Subject: "Reset the password of {{.Team}}",
+		Body: `Hi {{.Team}},
+
+Someone asked to reset your team's password. Choose a new one here:
+
+{{.Link}}
+
+The link works for {{.Expires}}. If it wasn't you, ignore this email and
+your password stays as it is.
+`,
+		Variables: []EmailVariable{
+			teamVariable,
+			{"Link", "the link to choose a new password", "https://hunt.example.com/reset-password?token=..."},
+			expiresVariable,
+		},
+	},
+	EmailAnnouncement: {
+		Subject: "{{.Title}}",
+		Body: `Hi {{.Team}},
+
+{{.Message}}
+{{if .Link}}
+{{.Link}}
+{{end}}`,
+		Variables: []EmailVariable{
+			teamVariable,
+			{"Title", "the announcement's title", "Hints are live"},
+			{"Message", "its message, which may be empty", "Every question now has a hint."},
+			{"Link", "its link, which may be empty", "https://hunt.example.com/hunt"},
+		},
+	},
+	EmailHuntReminder: {
+		Subject: "The hunt starts {{.Starts}}",
+		Body: `Hi {{.Team}},
+
+The hunt starts {{.Starts}}, at {{.Start}}. Sign in before then:
+
+{{.Link}}
+
+Good luck!
+`,
+		Variables: []EmailVariable{
+			teamVariable,
+			{"Starts", "how soon the hunt starts", "in an hour"},
+			{"Start", "when it starts", "Oct 18, 18:00 UTC"},
+			{"Link", "the login page", "https://hunt.example.com/login"},
+		},
+	},
+	EmailTest: {
+		Subject: "Test email from the hunt",
+		Body: `This is a test email. If you are reading it, email works.
+`,
+	},
+}
+
+// EmailTemplate is the copy an email is sent with: the built-in copy, or
+// the organisers' edits of it
+type EmailTemplate struct {
+	Name           string
+	Subject        string
+	Body           string
+	DefaultSubject string
+	DefaultBody    string
+	Variables      []EmailVariable
+	Customised     bool
+}
+
+// parseEmail parses a template's subject and body. Data without a value
+// the template uses is an error, so misspelt variables show up when the
+// copy is saved rather than in teams' inboxes
+func parseEmail(name, subject, body string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(`{{define "subject"}}` + subject + `{{end}}`)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.New("body").Parse(body)
+}
+
+// executeEmail fills in a parsed template; the subject is kept to one line
+func executeEmail(tmpl *template.Template, data map[string]interface{}) (string, string, error) {
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return "", "", err
+	}
+	return strings.Join(strings.Fields(subject.String()), " "), body.String(), nil
+}
+
+// PreviewEmail renders copy for a template with example values, checking
+// it works before it is saved
+func PreviewEmail(name, subject, body string) (string, string, error) {
+	def, ok := emailTemplates[name]
+	if !ok {
+		return "", "", ErrUnknownEmailTemplate
+	}
+	tmpl, err := parseEmail(name, subject, body)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidEmailTemplate, err)
+	}
+
+	data := make(map[string]interface{}, len(def.Variables))
+	for _, v := range def.Variables {
+		data[v.Name] = v.Example
+	}
+	renderedSubject, renderedBody, err := executeEmail(tmpl, data)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidEmailTemplate, err)
+	}
+	if renderedSubject == "" {
+		return "", "", fmt.Errorf("%w: the subject is empty", ErrInvalidEmailTemplate)
+	}
+	return renderedSubject, renderedBody, nil
+}
+
+// GetEmailTemplates returns the copy of every template
+func (us *UserService) GetEmailTemplates(ctx context.Context) ([]EmailTemplate, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	edited, err := us.Repo.ListEmailTemplates(ctx)
+	if err != nil {
+		log.Printf("Error getting email templates: %v", err)
+		return nil, err
+	}
+	byName := make(map[string]repository.EmailTemplate, len(edited))
+	for _, t := range edited {
+		byName[t.Name] = t
+	}
+
+	templates := make([]EmailTemplate, 0, len(EmailTemplateNames))
+	for _, name := range EmailTemplateNames {
+		t, ok := byName[name]
+		templates = append(templates, newEmailTemplate(name, t, ok))
+	}
+	return templates, nil
+}
+
+// GetEmailTemplate returns the copy of one template
+func (us *UserService) GetEmailTemplate(ctx context.Context, name string) (EmailTemplate, error) {
+	if _, ok := emailTemplates[name]; !ok {
+		return EmailTemplate{}, ErrUnknownEmailTemplate
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	t, err := us.Repo.GetEmailTemplate(ctx, name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting email template %s: %v", name, err)
+		return EmailTemplate{}, err
+	}
+	return newEmailTemplate(name, t, err == nil), nil
+}
+
+// newEmailTemplate combines a template's built-in copy with its edits
+func newEmailTemplate(name string, edited repository.EmailTemplate, customised bool) EmailTemplate {
+	def := emailTemplates[name]
+	t := EmailTemplate{
+		Name:           name,
+		Subject:        def.Subject,
+		Body:           def.Body,
+		DefaultSubject: def.Subject,
+		DefaultBody:    def.Body,
+		Variables:      def.Variables,
+		Customised:     customised,
+	}
+	if customised {
+		t.Subject, t.Body = edited.Subject, edited.Body
+	}
+	return t
+}
+
+// SetEmailTemplate changes a template's copy, checking it renders first.
+// Copy matching the built-in copy is stored as no edit at all
+func (us *UserService) SetEmailTemplate(ctx context.Context, name, subject, body string) error {
+	def, ok := emailTemplates[name]
+	if !ok {
+		return ErrUnknownEmailTemplate
+	}
+	subject = strings.TrimSpace(subject)
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	if subject == def.Subject && strings.TrimSpace(body) == strings.TrimSpace(def.Body) {
+		return us.ResetEmailTemplate(ctx, name)
+	}
+	if _, _, err := PreviewEmail(name, subject, body); err != nil {
+		return err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.SetEmailTemplate(ctx, name, subject, body, time.Now()); err != nil {
+		log.Printf("Error saving email template %s: %v", name, err)
+		return err
+	}
+	log.Printf("Email template %s changed", name)
+	return nil
+}
+
+// ResetEmailTemplate goes back to a template's built-in copy
+func (us *UserService) ResetEmailTemplate(ctx context.Context, name string) error {
+	if _, ok := emailTemplates[name]; !ok {
+		return ErrUnknownEmailTemplate
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeleteEmailTemplate(ctx, name); err != nil {
+		log.Printf("Error resetting email template %s: %v", name, err)
+		return err
+	}
+	return nil
+}
+
+// loadEmail parses the copy a template is sent with. Edits that stopped
+// parsing fall back to the built-in copy, so the email still goes out
+func (us *UserService) loadEmail(ctx context.Context, name string) (*template.Template, error) {
+	t, err := us.GetEmailTemplate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := parseEmail(name, t.Subject, t.Body)
+	if err != nil && t.Customised {
+		log.Printf("Warning: Email template %s doesn't parse, sending the built-in copy: %v", name, err)
+		tmpl, err = parseEmail(name, t.DefaultSubject, t.DefaultBody)
+	}
+	return tmpl, err
+}
+
+// MailEnabled reports whether the server can send email
+func (us *UserService) MailEnabled() bool {
+	return us.Mailer != nil
+}
+
+// QueueEmail renders a template and queues it for one recipient. The
+// message is rendered once here so retries send the exact same email
+func (us *UserService) QueueEmail(ctx context.Context, to, name string, data map[string]interface{}) error {
+	if us.Mailer == nil {
+		return ErrMailDisabled
+	}
+	tmpl, err := us.loadEmail(ctx, name)
+	if err != nil {
+		return err
+	}
+	return us.queueEmail(ctx, tmpl, to, name, data)
+}
+
+// queueEmail renders an already loaded template for one recipient, so
+// emails to every team load it once
+func (us *UserService) queueEmail(ctx context.Context, tmpl *template.Template, to, name string, data map[string]interface{}) error {
+	subject, body, err := executeEmail(tmpl, data)
+	if err != nil {
+		log.Printf("Error rendering %s email: %v", name, err)
+		return err
+	}
+	return us.queueRenderedEmail(ctx, to, name, subject, body)
+}
+
+// queueRenderedEmail queues a message for one recipient as it is
+func (us *UserService) queueRenderedEmail(ctx context.Context, to, name, subject, body string) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.CreateEmail(ctx, to, name, subject, body, time.Now()); err != nil {
+		log.Printf("Error queueing %s email to %s: %v", name, to, err)
+		return err
+	}
+	return nil
+}
+
+// GetRecentEmails returns the latest emails in the outbox, newest first
+func (us *UserService) GetRecentEmails(ctx context.Context, limit int) ([]Email, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	emails, err := us.Repo.ListRecentEmails(ctx, limit)
+	if err != nil {
+		log.Printf("Error getting emails: %v", err)
+		return nil, err
+	}
+	if emails == nil {
+		emails = []Email{}
+	}
+	return emails, nil
+}
+
+// DeliverDueEmails sends every email that is due, retrying failures with
+// exponential backoff until EmailMaxAttempts is reached
+func (us *UserService) DeliverDueEmails(ctx context.Context) {
+	if us.Mailer == nil {
+		return
+	}
+
+	due, err := func() ([]Email, error) {
+		ctx, cancel := database.WithQueryTimeout(ctx)
+		defer cancel()
+		return us.Repo.ListDueEmails(ctx, EmailMaxAttempts, time.Now(), emailBatch)
+	}()
+	if err != nil {
+		log.Printf("Error getting due emails: %v", err)
+		return
+	}
+
+	for _, e := range due {
+		var sentAt *time.Time
+		lastError := ""
+		if err := us.Mailer.Send(e.Recipient, e.Subject, e.Body); err != nil {
+			lastError = err.Error()
+			log.Printf("Email %d to %s failed (attempt %d/%d): %v", e.ID, e.Recipient, e.Attempts+1, EmailMaxAttempts, err)
+		} else {
+			now := time.Now()
+			sentAt = &now
+		}
+
+		next := time.Now().Add(emailRetryBase << e.Attempts)
+		func() {
+			ctx, cancel := database.WithQueryTimeout(ctx)
+			defer cancel()
+			if err := us.Repo.RecordEmailAttempt(ctx, e.ID, lastError, sentAt, next); err != nil {
+				log.Printf("Error recording attempt for email %d: %v", e.ID, err)
+			}
+		}()
+	}
+}
+
+// QueueAnnouncementEmails emails an announcement to every team, returning
+// how many emails were queued
+func (us *UserService) QueueAnnouncementEmails(ctx context.Context, title, message, link string) (int, error) {
+	if us.Mailer == nil {
+		return 0, ErrMailDisabled
+	}
+	if link != "" {
+		if u, err := url.Parse(link); err == nil && !u.IsAbs() {
+			link = us.Mailer.Link(link)
+		}
+	}
+
+	tmpl, err := us.loadEmail(ctx, EmailAnnouncement)
+	if err != nil {
+		return 0, err
+	}
+	teams, err := us.teamContacts(ctx, 0)
+	if err != nil {
+		return 0, err
+	}
+	for i, t := range teams {
+		err := us.queueEmail(ctx, tmpl, t.Email, EmailAnnouncement, map[string]interface{}{
+			"Team":    t.Name,
+			"Title":   title,
+			"Message": message,
+			"Link":    link,
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(teams), nil
+}
+
+// SendHuntReminders emails the teams of each hunt once its start is less
+// than lead away, once per start time. It returns how many emails were
+// queued
+func (us *UserService) SendHuntReminders(ctx context.Context, lead time.Duration) (int, error) {
+	if us.Mailer == nil || lead <= 0 {
+		return 0, nil
+	}
+	return us.forEachHunt(ctx, func(huntID int) (int, error) {
+		return us.sendHuntReminders(ctx, huntID, lead)
+	})
+}
+
+func (us *UserService) sendHuntReminders(ctx context.Context, huntID int, lead time.Duration) (int, error) {
+	start := us.GetHuntWindow(ctx, huntID).Start
+	now := time.Now()
+	if start.IsZero() || !now.Before(start) || now.Add(lead).Before(start) {
+		return 0, nil
+	}
+	key := start.UTC().Format(time.RFC3339)
+	setting := huntSettingKey(SettingHuntReminderSent, huntID)
+	if sent, _, err := us.GetSetting(ctx, setting); err != nil || sent == key {
+		return 0, err
+	}
+	// Marked first, so a failure part way never emails teams twice
+	if err := us.SetSetting(ctx, setting, key); err != nil {
+		return 0, err
+	}
+
+	tmpl, err := us.loadEmail(ctx, EmailHuntReminder)
+	if err != nil {
+		return 0, err
+	}
+	teams, err := us.teamContacts(ctx, huntID)
+	if err != nil {
+		return 0, err
+	}
+	for i, t := range teams {
+		err := us.queueEmail(ctx, tmpl, t.Email, EmailHuntReminder, map[string]interface{}{
+			"Team":   t.Name,
+			"Starts": startsIn(start.Sub(now)),
+			"Start":  start.UTC().Format("Jan 2, 15:04 MST"),
+			"Link":   us.Mailer.Link("/login"),
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	log.Printf("Reminded %d teams that hunt %d starts at %s", len(teams), huntID, key)
+	return len(teams), nil
+}
+
+// startsIn describes how soon something starts, e.g. "in 3 hours"
+func startsIn(d time.Duration) string {
+	minutes := int(d.Round(time.Minute).Minutes())
+	switch {
+	case minutes < 2:
+		return "in a minute"
+	case minutes < 60:
+		return fmt.Sprintf("in %d minutes", minutes)
+	case minutes < 120:
+		return "in an hour"
+	}
+	return fmt.Sprintf("in %d hours", (minutes+30)/60)
+}
+
+// SendTestEmail queues a test email, to check the SMTP settings
+func (us *UserService) SendTestEmail(ctx context.Context, to string) error {
+	return us.QueueEmail(ctx, to, EmailTest, nil)
+}
+
+// SendEmailPreview emails copy for a template, filled in with example
+// values, so organisers can see it in an inbox before saving it
+func (us *UserService) SendEmailPreview(ctx context.Context, to, name, subject, body string) error {
+	if us.Mailer == nil {
+		return ErrMailDisabled
+	}
+	subject, body, err := PreviewEmail(name, subject, body)
+	if err != nil {
+		return err
+	}
+	return us.queueRenderedEmail(ctx, to, name, "[Test] "+subject, body)
+}
+
+// teamContacts returns where to email every team of a hunt, or every team
+// when huntID is 0
+func (us *UserService) teamContacts(ctx context.Context, huntID int) ([]repository.TeamContact, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	teams, err := us.Repo.ListTeamContacts(ctx, huntID)
+	if err != nil {
+		log.Printf("Error listing team emails: %v", err)
+		return nil, err
+	}
+	return teams, nil
+}
+
+// newEmailToken makes a one-time token for a team and purpose, replacing
+// any earlier one, and returns it in plain text for the emailed link
+func (us *UserService) newEmailToken(ctx context.Context, teamID int, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Error generating email token: %v", err)
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	if err := us.Repo.ExpireEmailTokens(ctx, teamID, purpose, now); err != nil {
+		log.Printf("Error expiring %s tokens of team %d: %v", purpose, teamID, err)
+		return "", err
+	}
+	if err := us.Repo.CreateEmailToken(ctx, teamID, purpose, hashEmailToken(token), now.Add(ttl), now); err != nil {
+		log.Printf("Error saving %s token of team %d: %v", purpose, teamID, err)
+		return "", err
+	}
+	return token, nil
+}
+
+// useEmailToken spends a token, returning the team it was made for
+func (us *UserService) useEmailToken(ctx context.Context, purpose, token string) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	teamID, err := us.Repo.UseEmailToken(ctx, purpose, hashEmailToken(token), time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidEmailToken
+	}
+	if err != nil {
+		log.Printf("Error using %s token: %v", purpose, err)
+		return 0, err
+	}
+	return teamID, nil
+}
+
+func hashEmailToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SendVerificationEmail emails a team a link that confirms its address
+func (us *UserService) SendVerificationEmail(ctx context.Context, teamID int) error {
+	if us.Mailer == nil {
+		return ErrMailDisabled
+	}
+
+	team, err := func() (repository.TeamContact, error) {
+		ctx, cancel := database.WithQueryTimeout(ctx)
+		defer cancel()
+		return us.Repo.GetTeamContact(ctx, teamID)
+	}()
+	if err != nil {
+		log.Printf("Error fetching team %d: %v", teamID, err)
+		return err
+	}
+
+	token, err := us.newEmailToken(ctx, teamID, emailTokenVerify, VerificationTokenTTL)
+	if err != nil {
+		return err
+	}
+	return us.QueueEmail(ctx, team.Email, EmailVerification, map[string]interface{}{
+		"Team":    team.Name,
+		"Link":    us.Mailer.Link("/verify-email?token=" + token),
+		"Expires": "3 days",
+	})
+}
+
+// VerifyEmail confirms the address of the team a verification link was
+// sent to
+func (us *UserService) VerifyEmail(ctx context.Context, token string) error {
+	teamID, err := us.useEmailToken(ctx, emailTokenVerify, token)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.SetTeamEmailVerified(ctx, teamID, time.Now()); err != nil {
+		log.Printf("Error verifying email of team %d: %v", teamID, err)
+		return err
+	}
+	log.Printf("Team %d verified its email", teamID)
+	return nil
+}
+
+// IsEmailVerified reports whether a team confirmed its address
+func (us *UserService) IsEmailVerified(ctx context.Context, teamID int) (bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	verified, err := us.Repo.IsTeamEmailVerified(ctx, teamID)
+	if err != nil {
+		log.Printf("Error checking email of team %d: %v", teamID, err)
+		return false, err
+	}
+	return verified, nil
+}
+
+// RequestPasswordReset emails a reset link to the team signing in with
+// email. An unknown address gets no email and no error, so the form
+// doesn't tell who has registered
+func (us *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	if us.Mailer == nil {
+		return ErrMailDisabled
+	}
+
+	team, err := func() (repository.Team, error) {
+		ctx, cancel := database.WithQueryTimeout(ctx)
+		defer cancel()
+		return us.Repo.GetTeamByEmail(ctx, email)
+	}()
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error fetching team by email: %v", err)
+		return err
+	}
+
+	token, err := us.newEmailToken(ctx, team.ID, emailTokenReset, PasswordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+	return us.QueueEmail(ctx, team.Email, EmailPasswordReset, map[string]interface{}{
+		"Team":    team.Name,
+		"Link":    us.Mailer.Link("/reset-password?token=" + token),
+		"Expires": "an hour",
+	})
+}
+
+// ResetPassword sets a new password for the team a reset link was sent
+// to. The link also confirms the team's address, since it was read there
+func (us *UserService) ResetPassword(ctx context.Context, token, password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	teamID, err := us.useEmailToken(ctx, emailTokenReset, token)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.SetTeamPassword(ctx, teamID, string(hash)); err != nil {
+		log.Printf("Error resetting password of team %d: %v", teamID, err)
+		return err
+	}
+	if err := us.Repo.SetTeamEmailVerified(ctx, teamID, time.Now()); err != nil {
+		log.Printf("Error verifying email of team %d: %v", teamID, err)
+	}
+	log.Printf("Team %d reset its password", teamID)
+	return nil
+}
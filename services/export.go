@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// TeamExportFormat is the version of the team data export layout, bumped
+// when it changes shape
+const TeamExportFormat = 1
+
+// teamExportNotes say what a team data export leaves out, and why
+var teamExportNotes = []string{
+	"Sessions live in a signed cookie in the team's browser, not on the server, so there are none to export.",
+	"Password hashes, one-time code hashes and push subscription keys are withheld.",
+	"The server's log output mentions the team by ID and name. It is kept by whoever runs the server and is not part of this export.",
+	"Uploaded files are listed by storage key under files; their contents are not included.",
+}
+
+// TeamExport is everything stored about a team, for answering data
+// requests. Records holds the team's rows by table, each as column to
+// value
+type TeamExport struct {
+	Format        int                                `json:"format"`
+	SchemaVersion int                                `json:"schema_version"`
+	ExportedAt    time.Time                          `json:"exported_at"`
+	TeamID        int                                `json:"team_id"`
+	Records       map[string][]repository.TeamRecord `json:"records"`
+	Files         []string                           `json:"files"`
+	Notes         []string                           `json:"notes"`
+}
+
+// ExportTeamData gathers everything stored about a team: its profile,
+// solves, submissions, timers, hint purchases, messages, logins and the
+// mail and texts sent to it. Admins' own notes about the team, such as
+// cheating alerts, are only included when internal is set
+func (us *UserService) ExportTeamData(ctx context.Context, teamID int, internal bool) (TeamExport, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	records, err := us.Repo.ExportTeam(ctx, teamID, internal)
+	if err != nil {
+		log.Printf("Error exporting team %d: %v", teamID, err)
+		return TeamExport{}, err
+	}
+	if len(records["teams"]) == 0 {
+		return TeamExport{}, ErrTeamNotFound
+	}
+	files, err := us.Repo.ListTeamFiles(ctx, teamID)
+	if err != nil {
+		log.Printf("Error listing files of team %d: %v", teamID, err)
+		return TeamExport{}, err
+	}
+	version, err := us.Repo.GetSchemaVersion(ctx)
+	if err != nil {
+		log.Printf("Error fetching schema version: %v", err)
+		return TeamExport{}, err
+	}
+
+	log.Printf("Exported the data of team %d", teamID)
+	return TeamExport{
+		Format:        TeamExportFormat,
+		SchemaVersion: version,
+		ExportedAt:    time.Now().UTC(),
+		TeamID:        teamID,
+		Records:       records,
+		Files:         orEmpty(files),
+		Notes:         teamExportNotes,
+	}, nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// SlowClientPolicy decides what happens when a client's queue is full
+type SlowClientPolicy string
+
+const (
+	// PolicyDropOldest discards the oldest queued event to make room
+	PolicyDropOldest SlowClientPolicy = "drop-oldest"
+
+	// PolicyDisconnect drops the client; it reconnects and resyncs
+	PolicyDisconnect SlowClientPolicy = "disconnect"
+
+	// PolicyWorkerPool waits up to SendTimeout per client, spreading the
+	// sends over a bounded number of workers so one stuck client only
+	// holds up a single worker
+	PolicyWorkerPool SlowClientPolicy = "worker-pool"
+)
+
+// BroadcasterOptions tunes fan-out to connected clients
+type BroadcasterOptions struct {
+	SlowClientPolicy SlowClientPolicy
+
+	// SendTimeout is how long the worker-pool policy waits on a full queue
+	SendTimeout time.Duration
+
+	// Workers is the worker-pool policy's concurrency
+	Workers int
+}
+
+// withDefaults fills in unset or unknown options
+func (o BroadcasterOptions) withDefaults() BroadcasterOptions {
+	switch o.SlowClientPolicy {
+	case PolicyDropOldest, PolicyDisconnect, PolicyWorkerPool:
+	case "":
+		o.SlowClientPolicy = PolicyDropOldest
+	default:
+		log.Printf("Warning: Unknown slow client policy %q, using %s", o.SlowClientPolicy, PolicyDropOldest)
+		o.SlowClientPolicy = PolicyDropOldest
+	}
+	if o.SendTimeout <= 0 {
+		o.SendTimeout = 100 * time.Millisecond
+	}
+	if o.Workers <= 0 {
+		o.Workers = 16
+	}
+	return o
+}
+
+// sendNonBlocking queues an event without waiting, applying the slow-client
+// policy when the client's queue is full
+func (b *Broadcaster) sendNonBlocking(client *Client, event Event) {
+	select {
+	case client.Channel <- event:
+		b.metrics.delivered.Add(1)
+		return
+	default:
+	}
+
+	if b.opts.SlowClientPolicy == PolicyDisconnect {
+		b.metrics.clientKicked.Add(1)
+		log.Printf("Disconnecting slow client %s (queue %d/%d)", client.ID, len(client.Channel), cap(client.Channel))
+		client.kick()
+		return
+	}
+
+	// Drop the oldest queued event and retry once; if another sender
+	// refilled the slot in between, give up on this event instead
+	select {
+	case <-client.Channel:
+		b.metrics.clientDropped.Add(1)
+	default:
+	}
+	select {
+	case client.Channel <- event:
+		b.metrics.delivered.Add(1)
+	default:
+		b.metrics.clientDropped.Add(1)
+	}
+}
+
+// sendWithWorkers delivers an event to every subscribed client using a
+// bounded pool of workers, each waiting at most SendTimeout per client
+// Callers must hold clientsMutex so channels aren't closed mid-send
+func (b *Broadcaster) sendWithWorkers(event Event) {
+	jobs := make(chan *Client)
+	var wg sync.WaitGroup
+
+	for i := 0; i < b.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for client := range jobs {
+				timer := time.NewTimer(b.opts.SendTimeout)
+				select {
+				case client.Channel <- event:
+					b.metrics.delivered.Add(1)
+				case <-timer.C:
+					// Timeout - client might be slow or disconnected
+					b.metrics.clientDropped.Add(1)
+					log.Printf("Timeout sending to client %s (queue %d/%d)", client.ID, len(client.Channel), cap(client.Channel))
+				}
+				timer.Stop()
+			}
+		}()
+	}
+
+	for _, client := range b.clients {
+		if client.wants(event) {
+			jobs <- client
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
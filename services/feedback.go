@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// FeedbackCommentMaxLength caps the comment left with a rating
+const FeedbackCommentMaxLength = 1000
+
+// QuestionFeedback is how a team rated a question's difficulty and fun,
+// from 1 to 5, with an optional comment for its author
+type QuestionFeedback = repository.QuestionFeedback
+
+// FeedbackReport is a question's average ratings with the comments left on
+// it, newest first
+type FeedbackReport struct {
+	repository.FeedbackSummary
+	Comments []QuestionFeedback `json:"comments"`
+}
+
+var (
+	ErrInvalidRating      = errors.New("ratings go from 1 to 5")
+	ErrFeedbackTooLong    = errors.New("comment is too long")
+	ErrFeedbackNotAllowed = errors.New("rate a question once you've solved it or the hunt is over")
+)
+
+// CanRateQuestion reports whether a team may rate a question: it solved
+// it, or its hunt is over
+func (us *UserService) CanRateQuestion(ctx context.Context, teamID, questionID int) (bool, error) {
+	if us.TeamWindow(ctx, teamID).Ended(time.Now()) {
+		return true, nil
+	}
+	return us.IsQuestionSolvedByTeam(ctx, teamID, questionID)
+}
+
+// SubmitFeedback saves a team's rating of a question, replacing the one it
+// gave before
+func (us *UserService) SubmitFeedback(ctx context.Context, teamID, questionID, difficulty, fun int, comment string) (QuestionFeedback, error) {
+	comment = strings.TrimSpace(comment)
+	if difficulty < 1 || difficulty > 5 || fun < 1 || fun > 5 {
+		return QuestionFeedback{}, ErrInvalidRating
+	}
+	if utf8.RuneCountInString(comment) > FeedbackCommentMaxLength {
+		return QuestionFeedback{}, ErrFeedbackTooLong
+	}
+
+	ok, err := us.CanRateQuestion(ctx, teamID, questionID)
+	if err != nil {
+		return QuestionFeedback{}, err
+	}
+	if !ok {
+		return QuestionFeedback{}, ErrFeedbackNotAllowed
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	f := QuestionFeedback{
+		TeamID:     teamID,
+		QuestionID: questionID,
+		Difficulty: difficulty,
+		Fun:        fun,
+		Comment:    comment,
+		UpdatedAt:  time.Now(),
+	}
+	if err := us.Repo.SaveFeedback(ctx, f); err != nil {
+		log.Printf("Error saving feedback of team %d on question %d: %v", teamID, questionID, err)
+		return QuestionFeedback{}, err
+	}
+	return f, nil
+}
+
+// GetTeamFeedback returns a team's rating of a question, nil if it hasn't
+// rated it
+func (us *UserService) GetTeamFeedback(ctx context.Context, teamID, questionID int) (*QuestionFeedback, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	f, err := us.Repo.GetFeedback(ctx, teamID, questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Error fetching feedback of team %d on question %d: %v", teamID, questionID, err)
+		return nil, err
+	}
+	return &f, nil
+}
+
+// GetFeedbackReport returns the average ratings and comments of every
+// question of a hunt, for the puzzle authors
+func (us *UserService) GetFeedbackReport(ctx context.Context, huntID int) ([]FeedbackReport, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	summaries, err := us.Repo.ListFeedbackSummaries(ctx, huntID)
+	if err != nil {
+		log.Printf("Error summarising feedback of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+	comments, err := us.Repo.ListFeedbackComments(ctx, huntID)
+	if err != nil {
+		log.Printf("Error listing feedback comments of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+
+	byQuestion := make(map[int][]QuestionFeedback)
+	for _, c := range comments {
+		byQuestion[c.QuestionID] = append(byQuestion[c.QuestionID], c)
+	}
+
+	report := make([]FeedbackReport, 0, len(summaries))
+	for _, s := range summaries {
+		r := FeedbackReport{FeedbackSummary: s, Comments: byQuestion[s.QuestionID]}
+		if r.Comments == nil {
+			r.Comments = make([]QuestionFeedback, 0)
+		}
+		report = append(report, r)
+	}
+	return report, nil
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/namishh/holmes/database"
+)
+
+// CreateAttachments records stored files against a question; names[i] is
+// the download name of keys[i]
+func (us *UserService) CreateAttachments(ctx context.Context, questionID int, keys, names []string) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	for i, key := range keys {
+		if err := us.Repo.AddFile(ctx, questionID, key, names[i]); err != nil {
+			log.Printf("Error inserting file: %v", err)
+			return err
+		}
+	}
+	us.invalidateQuestion(ctx, questionID)
+	return nil
+}
+
+// GetAttachmentName returns the download name of the file stored under key
+func (us *UserService) GetAttachmentName(ctx context.Context, key string) (string, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	name, err := us.Repo.GetFileName(ctx, key)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error getting name of file %s: %v", key, err)
+	}
+	return name, err
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TeamFlagPlaceholder marks where a team's token goes in the answer of a
+// question whose flag differs per team, e.g. "holmes{221b-{team_token}}".
+// The same placeholder in the question text, revealed answer, solution and
+// text attachments is filled in with the team's token
+const TeamFlagPlaceholder = "{team_token}"
+
+// TeamFlag is the token a team's flag for a question is made from
+type TeamFlag = repository.TeamFlagWithName
+
+// FlagTemplate returns the answer when it is a per-team flag, empty when
+// every team has the same answer
+func FlagTemplate(answer string) string {
+	if strings.Contains(answer, TeamFlagPlaceholder) {
+		return answer
+	}
+	return ""
+}
+
+// ExpandTeamFlag fills in a team's token wherever the placeholder appears
+func ExpandTeamFlag(s, token string) string {
+	return strings.ReplaceAll(s, TeamFlagPlaceholder, token)
+}
+
+func newFlagToken() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// TeamFlagToken returns a team's token for a question with a per-team
+// flag, making one the first time it is asked for. It is empty for
+// questions every team answers the same and for the admin, who has no team
+func (us *UserService) TeamFlagToken(ctx context.Context, teamID int, q Question) (string, error) {
+	if q.FlagTemplate == "" {
+		return "", nil
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	token, err := us.Repo.GetTeamFlag(ctx, teamID, q.ID)
+	if err == nil {
+		return token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error fetching flag of team %d for question %d: %v", teamID, q.ID, err)
+		return "", err
+	}
+	if _, err := us.Repo.GetTeamHuntID(ctx, teamID); errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	} else if err != nil {
+		log.Printf("Error fetching team %d: %v", teamID, err)
+		return "", err
+	}
+
+	token, err = newFlagToken()
+	if err != nil {
+		return "", err
+	}
+	// Two requests may race to make the token; whichever lands first wins
+	err = us.Repo.CreateTeamFlag(ctx, repository.TeamFlag{TeamID: teamID, QuestionID: q.ID, Token: token, CreatedAt: time.Now()})
+	if err == nil {
+		token, err = us.Repo.GetTeamFlag(ctx, teamID, q.ID)
+	}
+	if err != nil {
+		log.Printf("Error creating flag of team %d for question %d: %v", teamID, q.ID, err)
+		return "", err
+	}
+	return token, nil
+}
+
+// PersonalizeQuestion fills a team's token into the text, revealed answer
+// and solution of a question
+func PersonalizeQuestion(q Question, token string) Question {
+	if token == "" {
+		return q
+	}
+	q.Question = ExpandTeamFlag(q.Question, token)
+	q.RevealAnswer = ExpandTeamFlag(q.RevealAnswer, token)
+	q.Solution = ExpandTeamFlag(q.Solution, token)
+	return q
+}
+
+// MaxPersonalizedFileSize caps the attachments a team's token is filled
+// into; larger ones are sent as stored
+const MaxPersonalizedFileSize = 1 << 20
+
+// PersonalizesFile reports whether a team's token is filled into an
+// attachment of this type and size, which only text is
+func PersonalizesFile(contentType string, size int64) bool {
+	if size > MaxPersonalizedFileSize {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+// CheckAnswer reports whether answer is right for the team: its own flag
+// for a question with a per-team flag, the shared answer otherwise
+func (us *UserService) CheckAnswer(ctx context.Context, teamID int, q Question, answer string) (bool, error) {
+	if q.FlagTemplate == "" {
+		return bcrypt.CompareHashAndPassword([]byte(q.Answer), []byte(answer)) == nil, nil
+	}
+	token, err := us.TeamFlagToken(ctx, teamID, q)
+	if err != nil || token == "" {
+		return false, err
+	}
+	flag := ExpandTeamFlag(q.FlagTemplate, token)
+	return subtle.ConstantTimeCompare([]byte(flag), []byte(answer)) == 1, nil
+}
+
+// GetTeamFlags returns the token of every team that has opened a question
+// with a per-team flag
+func (us *UserService) GetTeamFlags(ctx context.Context, questionID int) ([]TeamFlag, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	flags, err := us.Repo.ListQuestionTeamFlags(ctx, questionID)
+	if err != nil {
+		log.Printf("Error listing team flags of question %d: %v", questionID, err)
+		return nil, err
+	}
+	if flags == nil {
+		flags = make([]TeamFlag, 0)
+	}
+	return flags, nil
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+const (
+	// MinGeofenceRadius is the smallest place a question can ask for, as
+	// phones rarely know where they are to better than that
+	MinGeofenceRadius = 10
+	// MaxGeofenceRadius is the largest, in meters
+	MaxGeofenceRadius = 50000
+	// DefaultGeofenceRadius is the radius of places saved without one
+	DefaultGeofenceRadius = 50
+	// LocationProofTTL is how long a proof of being at a question's place
+	// counts for answering it
+	LocationProofTTL = 5 * time.Minute
+	// earthRadius is the mean radius of the Earth in meters
+	earthRadius = 6371000
+)
+
+// Geofence is the place a team must be at to answer a question
+type Geofence = repository.Geofence
+
+// LocationProof is what a team gets for being at a question's place, to
+// send with its answer before it expires
+type LocationProof struct {
+	Proof     string    `json:"location"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+var (
+	ErrInvalidGeofence = errors.New("invalid question location")
+	ErrInvalidLocation = errors.New("invalid location")
+	// ErrLocationImprecise is returned for a fix too vague to tell whether
+	// the team is inside
+	ErrLocationImprecise = errors.New("your location isn't precise enough, try again outdoors")
+	ErrOutsideGeofence   = errors.New("you aren't at this question's location")
+	// ErrLocationRequired is returned for answers sent without a valid,
+	// unexpired proof of being at the question's place
+	ErrLocationRequired = errors.New("share your location at this question's place to answer it")
+)
+
+// distanceMeters is the great-circle distance between two points
+func distanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func validCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 && !math.IsNaN(lat) && !math.IsNaN(lng)
+}
+
+// locationSignature signs that a team was at a question's place, until
+// the proof expires
+func locationSignature(secret string, teamID, questionID int, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d-%d-%d", teamID, questionID, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CheckGeofence checks a question's place can be saved
+func CheckGeofence(lat, lng float64, radius int) error {
+	if !validCoordinates(lat, lng) {
+		return fmt.Errorf("%w: latitude is between -90 and 90 and longitude between -180 and 180", ErrInvalidGeofence)
+	}
+	if radius < MinGeofenceRadius || radius > MaxGeofenceRadius {
+		return fmt.Errorf("%w: the radius is between %d and %d meters", ErrInvalidGeofence, MinGeofenceRadius, MaxGeofenceRadius)
+	}
+	return nil
+}
+
+// SetGeofence makes a question answerable only within radius meters of a
+// point. Moving it voids the proofs teams got for the old place
+func (us *UserService) SetGeofence(ctx context.Context, questionID int, lat, lng float64, radius int) error {
+	if err := CheckGeofence(lat, lng, radius); err != nil {
+		return err
+	}
+	secret, err := newSigningSecret()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	g := Geofence{QuestionID: questionID, Latitude: lat, Longitude: lng, RadiusMeters: radius, Secret: secret, UpdatedAt: time.Now()}
+	if err := us.Repo.SetGeofence(ctx, g); err != nil {
+		log.Printf("Error setting location of question %d: %v", questionID, err)
+		return err
+	}
+	log.Printf("Question %d is answered within %dm of %.6f, %.6f", questionID, radius, lat, lng)
+	return nil
+}
+
+// RemoveGeofence lets a question be answered from anywhere again
+func (us *UserService) RemoveGeofence(ctx context.Context, questionID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeleteGeofence(ctx, questionID); err != nil {
+		log.Printf("Error removing location of question %d: %v", questionID, err)
+		return err
+	}
+	return nil
+}
+
+// GetGeofence returns where a question is answered from, nil for one
+// answered anywhere
+func (us *UserService) GetGeofence(ctx context.Context, questionID int) (*Geofence, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	g, err := us.Repo.GetGeofence(ctx, questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Error fetching location of question %d: %v", questionID, err)
+		return nil, err
+	}
+	return &g, nil
+}
+
+// ProveLocation checks a location the team's device reported, with its
+// accuracy in meters, against the place of a question. Inside it, the team
+// gets a signed proof to send with its answer
+func (us *UserService) ProveLocation(teamID int, g Geofence, lat, lng, accuracy float64) (LocationProof, error) {
+	if !validCoordinates(lat, lng) || accuracy < 0 || math.IsNaN(accuracy) {
+		return LocationProof{}, ErrInvalidLocation
+	}
+	// A fix vaguer than the place itself can't tell whether the team is
+	// inside
+	if accuracy > float64(g.RadiusMeters) {
+		return LocationProof{}, ErrLocationImprecise
+	}
+	if distanceMeters(lat, lng, g.Latitude, g.Longitude) > float64(g.RadiusMeters) {
+		log.Printf("Team %d is outside the location of question %d", teamID, g.QuestionID)
+		return LocationProof{}, ErrOutsideGeofence
+	}
+
+	expires := time.Now().Add(LocationProofTTL).Truncate(time.Second)
+	sig := locationSignature(g.Secret, teamID, g.QuestionID, expires.Unix())
+	return LocationProof{Proof: strconv.FormatInt(expires.Unix(), 10) + "." + sig, ExpiresAt: expires}, nil
+}
+
+// CheckLocationProof returns ErrLocationRequired unless proof shows the
+// team was at the question's place and hasn't expired
+func (us *UserService) CheckLocationProof(teamID int, g Geofence, proof string) error {
+	expiry, sig, ok := strings.Cut(proof, ".")
+	if !ok {
+		return ErrLocationRequired
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrLocationRequired
+	}
+	if !hmac.Equal([]byte(sig), []byte(locationSignature(g.Secret, teamID, g.QuestionID, expires))) {
+		return ErrLocationRequired
+	}
+	return nil
+}
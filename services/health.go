@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/namishh/holmes/database"
+)
+
+// ErrNoBackend is reported by a readiness check whose backend isn't in use
+var ErrNoBackend = errors.New("not configured")
+
+// Pinger is implemented by backends that can check they are reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ping checks v when it is a Pinger; backends that can't be unreachable,
+// such as in-memory ones, are always fine
+func ping(ctx context.Context, v interface{}) error {
+	if p, ok := v.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest migration applied to the database
+func (us *UserService) SchemaVersion(ctx context.Context) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	return us.Repo.GetSchemaVersion(ctx)
+}
+
+// PingStorage checks that uploaded media can be reached
+func (us *UserService) PingStorage(ctx context.Context) error {
+	return ping(ctx, us.Storage)
+}
+
+// PingCache checks that the question cache can be reached
+func (us *UserService) PingCache(ctx context.Context) error {
+	if us.Cache == nil {
+		return ErrNoBackend
+	}
+	return ping(ctx, us.Cache)
+}
+
+// PingBus checks that events can reach other instances
+func (b *Broadcaster) PingBus(ctx context.Context) error {
+	if b.bus == nil {
+		return ErrNoBackend
+	}
+	return ping(ctx, b.bus)
+}
+
+// Health statuses reported by the health monitor
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+)
+
+const (
+	// HealthCheckInterval is how often the health monitor runs its checks
+	HealthCheckInterval = time.Minute
+
+	// healthCheckTimeout bounds each check, so a hung dependency counts
+	// as failing rather than stalling the monitor
+	healthCheckTimeout = 5 * time.Second
+)
+
+// HealthCheck is one dependency the health monitor pings
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HealthMonitor runs health checks in the background and reports when
+// the set of failing ones changes, so admins hear once about an outage
+// and once about the recovery
+type HealthMonitor struct {
+	checks  []HealthCheck
+	failing map[string]string
+}
+
+// NewHealthMonitor creates a monitor that starts out assuming everything
+// is healthy
+func NewHealthMonitor(checks ...HealthCheck) *HealthMonitor {
+	return &HealthMonitor{checks: checks, failing: make(map[string]string)}
+}
+
+// Check runs every check, returning the failing ones with their errors
+// and whether which checks fail changed since the last run. Backends that
+// aren't configured don't count as failing
+func (m *HealthMonitor) Check(ctx context.Context) (map[string]string, bool) {
+	failing := make(map[string]string)
+	for _, hc := range m.checks {
+		ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		err := hc.Check(ctx)
+		cancel()
+		if err != nil && !errors.Is(err, ErrNoBackend) {
+			failing[hc.Name] = err.Error()
+		}
+	}
+
+	changed := len(failing) != len(m.failing)
+	for name := range failing {
+		if _, ok := m.failing[name]; !ok {
+			changed = true
+		}
+	}
+	m.failing = failing
+	return failing, changed
+}
+
+// HealthEvent is the data of the event telling admins the health changed
+func HealthEvent(failing map[string]string) map[string]interface{} {
+	status := HealthOK
+	var lines []string
+	for name, err := range failing {
+		status = HealthDegraded
+		lines = append(lines, name+": "+err)
+	}
+	sort.Strings(lines)
+	return map[string]interface{}{
+		"status":  status,
+		"failing": lines,
+	}
+}
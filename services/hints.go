@@ -1,132 +1,115 @@
 package services
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"log"
 
 	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
 )
 
-type Hint struct {
-	ID               int    `json:"id"`
-	Hint             string `json:"hint"`
-	Worth            int    `json:"worth"`
-	ParentQuestionID int    `json:"parent_question_id"`
-}
+type Hint = repository.Hint
+
+// CreateHint stores a hint and returns its ID
+func (us *UserService) CreateHint(ctx context.Context, h Hint) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
-func (us *UserService) CreateHint(h Hint) error {
-	// Create a hint and get its ID
-	stmt := database.ConvertPlaceholders(`INSERT INTO hints (hint, worth, parent_question_id) VALUES (?, ?, ?) RETURNING id`)
-	err := us.UserStore.DB.QueryRow(stmt, h.Hint, h.Worth, h.ParentQuestionID).Scan(&h.ID)
+	id, err := us.Repo.CreateHint(ctx, h)
 	if err != nil {
 		log.Printf("Error inserting hint: %v", err)
-		return err
+		return 0, err
 	}
-	log.Printf("Created hint with ID: %d", h.ID)
+	log.Printf("Created hint with ID: %d", id)
+	us.invalidateQuestion(ctx, h.ParentQuestionID)
 
-	return nil
+	return id, nil
 }
 
-// Get all hints of all questions and sort them by question ID
-func (us *UserService) GetHints() ([]Hint, error) {
-	// SQL query to select all hints, ordered by parent_question_id
-	query := `SELECT id, hint, worth, parent_question_id FROM hints ORDER BY parent_question_id, id`
+// Get all hints of a hunt's questions and sort them by question ID
+func (us *UserService) GetHints(ctx context.Context, huntID int) ([]Hint, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
-	// Execute the query
-	rows, err := us.UserStore.DB.Query(query)
+	hints, err := us.Repo.ListHints(ctx, huntID)
 	if err != nil {
 		log.Printf("Error querying hints: %v", err)
 		return nil, err
 	}
-	defer rows.Close()
-
-	// Slice to store the hints
-	var hints []Hint
-
-	// Iterate through the rows
-	for rows.Next() {
-		var h Hint
-		err := rows.Scan(&h.ID, &h.Hint, &h.Worth, &h.ParentQuestionID)
-		if err != nil {
-			log.Printf("Error scanning hint row: %v", err)
-			return nil, err
-		}
-		hints = append(hints, h)
-	}
-
-	// Check for errors from iterating over rows
-	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating hint rows: %v", err)
-		return nil, err
-	}
 
 	return hints, nil
 }
 
-func (us *UserService) GetHintsByQuestionID(questionID int) ([]Hint, error) {
-	// SQL query to select hints for a specific question ID, ordered by hint ID
-	query := database.ConvertPlaceholders(`SELECT id, hint, worth, parent_question_id FROM hints WHERE parent_question_id = ? ORDER BY id`)
+func (us *UserService) GetHintsByQuestionID(ctx context.Context, questionID int) ([]Hint, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
-	// Execute the query with the questionID parameter
-	rows, err := us.UserStore.DB.Query(query, questionID)
+	content, err := us.questionContent(ctx, questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// A missing question has no hints
+		return nil, nil
+	}
 	if err != nil {
-		log.Printf("Error querying hints for question ID %d: %v", questionID, err)
 		return nil, err
 	}
-	defer rows.Close()
-
-	// Slice to store the hints
-	var hints []Hint
-
-	// Iterate through the rows
-	for rows.Next() {
-		var h Hint
-		err := rows.Scan(&h.ID, &h.Hint, &h.Worth, &h.ParentQuestionID)
-		if err != nil {
-			log.Printf("Error scanning hint row for question ID %d: %v", questionID, err)
-			return nil, err
-		}
-		hints = append(hints, h)
+
+	return content.Hints, nil
+}
+
+func (us *UserService) DeleteHint(ctx context.Context, hintID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	h, err := us.Repo.GetHint(ctx, hintID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error querying hint with ID %d: %v", hintID, err)
+		return err
 	}
 
-	// Check for errors from iterating over rows
-	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating hint rows for question ID %d: %v", questionID, err)
-		return nil, err
+	if err := us.Repo.DeleteHint(ctx, hintID); err != nil {
+		log.Printf("Error deleting hint with ID %d: %v", hintID, err)
+		return err
 	}
+	us.invalidateQuestion(ctx, h.ParentQuestionID)
 
-	return hints, nil
+	return nil
 }
 
-func (us *UserService) DeleteHint(hintID int) error {
-	// SQL query to delete the hint
-	query := database.ConvertPlaceholders("DELETE FROM hints WHERE id = ?")
+// UpdateHint changes a hint's text, worth and question
+func (us *UserService) UpdateHint(ctx context.Context, h Hint) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
-	// Execute the delete statement
-	_, err := us.UserStore.DB.Exec(query, hintID)
-	if err != nil {
-		log.Printf("Error deleting hint with ID %d: %v", hintID, err)
+	// The hint may be moving to another question, so both are invalidated
+	old, err := us.Repo.GetHint(ctx, h.ID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error querying hint with ID %d: %v", h.ID, err)
+		return err
+	}
+
+	if err := us.Repo.UpdateHint(ctx, h); err != nil {
+		log.Printf("Error updating hint with ID %d: %v", h.ID, err)
 		return err
 	}
+	us.invalidateQuestion(ctx, old.ParentQuestionID)
+	us.invalidateQuestion(ctx, h.ParentQuestionID)
 
 	return nil
 }
 
-func (us *UserService) UnlockHintForTeam(teamID int, hintID int, worth int) error {
-	query := database.ConvertPlaceholders(`
-    INSERT OR IGNORE INTO team_hint_unlocked (team_id, hint_id)
-    VALUES (?, ?)
-    `)
-	_, err := us.UserStore.DB.Exec(query, teamID, hintID)
-	if err != nil {
+func (us *UserService) UnlockHintForTeam(ctx context.Context, teamID int, hintID int, worth int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.UnlockHint(ctx, teamID, hintID); err != nil {
 		log.Printf("Error unlocking hint %d for team %d: %v", hintID, teamID, err)
 		return err
 	}
 
 	// Deduct the hint's worth from the team's points
-	query = database.ConvertPlaceholders(`UPDATE teams SET points = points - ? WHERE id = ?`)
-
-	_, err = us.UserStore.DB.Exec(query, worth, teamID)
-	if err != nil {
+	if err := us.Repo.AddTeamPoints(ctx, teamID, -worth); err != nil {
 		log.Printf("Error deducting team %d: %v", teamID, err)
 		return err
 	}
@@ -134,13 +117,11 @@ func (us *UserService) UnlockHintForTeam(teamID int, hintID int, worth int) erro
 	return nil
 }
 
-func (us *UserService) HasTeamUnlockedHint(teamID int, hintID int) (bool, error) {
-	query := database.ConvertPlaceholders(`
-    SELECT EXISTS(SELECT 1 FROM team_hint_unlocked
-                  WHERE team_id = ? AND hint_id = ?)
-    `)
-	var exists bool
-	err := us.UserStore.DB.QueryRow(query, teamID, hintID).Scan(&exists)
+func (us *UserService) HasTeamUnlockedHint(ctx context.Context, teamID int, hintID int) (bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	exists, err := us.Repo.HasUnlockedHint(ctx, teamID, hintID)
 	if err != nil {
 		log.Printf("Error checking if team %d has unlocked hint %d: %v", teamID, hintID, err)
 		return false, err
@@ -148,18 +129,28 @@ func (us *UserService) HasTeamUnlockedHint(teamID int, hintID int) (bool, error)
 	return exists, nil
 }
 
-func (us *UserService) GetHintById(id int) (string, int, error) {
-	var hint string
-	var worth int
-	query := database.ConvertPlaceholders(`SELECT hint, worth FROM hints WHERE id = ?`)
+// GetHintHuntID returns the hunt a hint's question belongs to
+func (us *UserService) GetHintHuntID(ctx context.Context, id int) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	huntID, err := us.Repo.GetHintHuntID(ctx, id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error querying hunt of hint %d: %v", id, err)
+	}
+	return huntID, err
+}
 
-	err := us.UserStore.DB.QueryRow(query, id).Scan(&hint, &worth)
+func (us *UserService) GetHintById(ctx context.Context, id int) (string, int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
+	h, err := us.Repo.GetHint(ctx, id)
 	if err != nil {
-		log.Printf("Error querying question with ID %d: %v", id, err)
-		return hint, worth, err
+		log.Printf("Error querying hint with ID %d: %v", id, err)
+		return h.Hint, h.Worth, err
 	}
 
-	log.Printf("Successfully retrieved question with ID: %d", id)
-	return hint, worth, nil
+	log.Printf("Successfully retrieved hint with ID: %d", id)
+	return h.Hint, h.Worth, nil
 }
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// HuntWindow is when the hunt runs; a zero Start or End leaves that side
+// open
+type HuntWindow struct {
+	Start time.Time
+	End   time.Time
+
+	// TeamDuration gives every team its own clock of this length, started
+	// at its first visit or at a slot assigned from the admin panel; zero
+	// runs every team on the window above
+	TeamDuration time.Duration
+}
+
+// Started reports whether the hunt has begun at t
+func (w HuntWindow) Started(t time.Time) bool {
+	return w.Start.IsZero() || !t.Before(w.Start)
+}
+
+// Ended reports whether the hunt is over at t
+func (w HuntWindow) Ended(t time.Time) bool {
+	return !w.End.IsZero() && !t.Before(w.End)
+}
+
+func (w HuntWindow) String() string {
+	start, end := "now", "no end"
+	if !w.Start.IsZero() {
+		start = w.Start.Format(time.RFC3339)
+	}
+	if !w.End.IsZero() {
+		end = w.End.Format(time.RFC3339)
+	}
+	if w.TeamDuration > 0 {
+		return start + " until " + end + ", " + w.TeamDuration.String() + " per team"
+	}
+	return start + " until " + end
+}
+
+var (
+	ErrInvalidHuntWindow   = errors.New("the hunt must end after it starts")
+	ErrInvalidTeamDuration = errors.New("a team's run can't be negative")
+)
+
+// huntWindowCacheTTL is how long hunt windows are held in memory; other
+// instances pick up a change within it
+const huntWindowCacheTTL = 2 * time.Second
+
+// huntWindowCache holds the window of every hunt so checking whether a
+// team may play doesn't cost a query per request
+type huntWindowCache struct {
+	mu       sync.Mutex
+	windows  map[int]repository.HuntWindow
+	loadedAt time.Time
+}
+
+// huntWindows returns the window of every hunt, from memory when recently
+// read
+func (us *UserService) huntWindows(ctx context.Context) (map[int]repository.HuntWindow, error) {
+	c := &us.huntWindowCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.windows != nil && time.Since(c.loadedAt) < huntWindowCacheTTL {
+		return c.windows, nil
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := us.Repo.ListHuntWindows(ctx)
+	if err != nil {
+		log.Printf("Error loading hunt windows: %v", err)
+		return nil, err
+	}
+	windows := make(map[int]repository.HuntWindow, len(rows))
+	for _, w := range rows {
+		windows[w.HuntID] = w
+	}
+	c.windows = windows
+	c.loadedAt = time.Now()
+	return windows, nil
+}
+
+// forgetHuntWindows drops the cached hunt windows after a change
+func (us *UserService) forgetHuntWindows() {
+	us.huntWindowCache.mu.Lock()
+	us.huntWindowCache.windows = nil
+	us.huntWindowCache.mu.Unlock()
+}
+
+// GetHuntWindow returns when a hunt runs: the configured window, or the
+// one set for the hunt from the admin panel. Every hunt has its own, so
+// hunts running side by side can start and end apart
+func (us *UserService) GetHuntWindow(ctx context.Context, huntID int) HuntWindow {
+	windows, err := us.huntWindows(ctx)
+	if err != nil {
+		return us.Hunt
+	}
+	w, ok := windows[huntID]
+	if !ok || !w.Set {
+		return us.Hunt
+	}
+	return HuntWindow{Start: w.Start.Time, End: w.End.Time, TeamDuration: w.TeamDuration}
+}
+
+// SetHuntWindow replaces the configured window of a hunt until it is reset
+func (us *UserService) SetHuntWindow(ctx context.Context, huntID int, w HuntWindow) error {
+	if !w.Start.IsZero() && !w.End.IsZero() && !w.End.After(w.Start) {
+		return ErrInvalidHuntWindow
+	}
+	if w.TeamDuration < 0 {
+		return ErrInvalidTeamDuration
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	err := us.Repo.SetHuntWindow(ctx, repository.HuntWindow{
+		HuntID:       huntID,
+		Start:        sql.NullTime{Time: w.Start.UTC(), Valid: !w.Start.IsZero()},
+		End:          sql.NullTime{Time: w.End.UTC(), Valid: !w.End.IsZero()},
+		TeamDuration: w.TeamDuration,
+	})
+	if err != nil {
+		log.Printf("Error setting window of hunt %d: %v", huntID, err)
+		return err
+	}
+	us.forgetHuntWindows()
+	log.Printf("Window of hunt %d set to %s", huntID, w)
+	return nil
+}
+
+// ResetHuntWindow puts a hunt back on the configured window
+func (us *UserService) ResetHuntWindow(ctx context.Context, huntID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.ResetHuntWindow(ctx, huntID); err != nil {
+		log.Printf("Error resetting window of hunt %d: %v", huntID, err)
+		return err
+	}
+	us.forgetHuntWindows()
+	log.Printf("Window of hunt %d reset to %s", huntID, us.Hunt)
+	return nil
+}
+
+// teamHuntWindow returns the window of the hunt a team plays in; anyone
+// who isn't a team gets the first hunt's
+func (us *UserService) teamHuntWindow(ctx context.Context, teamID int) HuntWindow {
+	huntID, err := us.TeamHuntID(ctx, teamID)
+	if err != nil {
+		huntID = DefaultHuntID
+	}
+	return us.GetHuntWindow(ctx, huntID)
+}
+
+// TeamWindow returns when a team plays, within its own hunt's window. When
+// teams run on their own clocks it starts the team's clock if the hunt is
+// open and it hasn't started yet, and the team then has TeamDuration from
+// its start, never past the end of the hunt. Otherwise, and for anyone who
+// isn't a team, it is the hunt window
+func (us *UserService) TeamWindow(ctx context.Context, teamID int) HuntWindow {
+	window := us.teamHuntWindow(ctx, teamID)
+	if window.TeamDuration <= 0 {
+		return window
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	start, err := us.Repo.GetTeamStart(ctx, teamID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error fetching start of team %d: %v", teamID, err)
+		}
+		return window
+	}
+	now := time.Now()
+	if !start.Valid {
+		if !window.Started(now) || window.Ended(now) {
+			return window
+		}
+		if _, err := us.Repo.StartTeamClock(ctx, teamID, now); err != nil {
+			log.Printf("Error starting clock of team %d: %v", teamID, err)
+			return window
+		}
+		// Another request may have started it first
+		if start, err = us.Repo.GetTeamStart(ctx, teamID); err != nil || !start.Valid {
+			log.Printf("Error fetching start of team %d: %v", teamID, err)
+			return window
+		}
+		log.Printf("Clock of team %d started at %s", teamID, start.Time.Format(time.RFC3339))
+	}
+
+	team := HuntWindow{Start: start.Time, End: start.Time.Add(window.TeamDuration), TeamDuration: window.TeamDuration}
+	if !window.End.IsZero() && window.End.Before(team.End) {
+		team.End = window.End
+	}
+	return team
+}
+
+// SolutionsRevealed reports whether a team may see the answers and
+// solutions: the reveal flag is on and the team's hunt is over
+func (us *UserService) SolutionsRevealed(ctx context.Context, teamID int) bool {
+	if !us.FlagEnabled(ctx, FlagRevealSolutions) {
+		return false
+	}
+	return us.TeamWindow(ctx, teamID).Ended(time.Now())
+}
+
+// SetTeamStart assigns when a team's clock starts; a zero time clears it so
+// it starts at the team's next visit
+func (us *UserService) SetTeamStart(ctx context.Context, teamID int, at time.Time) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ok, err := us.Repo.SetTeamStart(ctx, teamID, sql.NullTime{Time: at, Valid: !at.IsZero()})
+	if err != nil {
+		log.Printf("Error setting start of team %d: %v", teamID, err)
+		return err
+	}
+	if !ok {
+		return ErrTeamNotFound
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Hunt is one of the hunts running on the server. Teams register into a
+// hunt and only see its questions and leaderboard
+type Hunt = repository.Hunt
+
+// DefaultHuntID is the hunt teams and questions join when none is given
+const DefaultHuntID = repository.DefaultHuntID
+
+var (
+	ErrHuntNotFound    = errors.New("hunt not found")
+	ErrInvalidHuntSlug = errors.New("hunt slug must be 1 to 100 lowercase letters, digits and dashes")
+	ErrHuntExists      = errors.New("a hunt with that slug already exists")
+	ErrHuntNotEmpty    = errors.New("hunt still has teams or questions")
+)
+
+var huntSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,99}$`)
+
+// GetHunts returns every hunt, oldest first
+func (us *UserService) GetHunts(ctx context.Context) ([]Hunt, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	hunts, err := us.Repo.ListHunts(ctx)
+	if err != nil {
+		log.Printf("Error listing hunts: %v", err)
+		return nil, err
+	}
+	if hunts == nil {
+		hunts = make([]Hunt, 0)
+	}
+	return hunts, nil
+}
+
+// GetHunt returns a hunt, or ErrHuntNotFound
+func (us *UserService) GetHunt(ctx context.Context, id int) (Hunt, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	h, err := us.Repo.GetHunt(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Hunt{}, ErrHuntNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching hunt %d: %v", id, err)
+	}
+	return h, err
+}
+
+// GetHuntBySlug returns the hunt with a slug, or ErrHuntNotFound
+func (us *UserService) GetHuntBySlug(ctx context.Context, slug string) (Hunt, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	h, err := us.Repo.GetHuntBySlug(ctx, slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Hunt{}, ErrHuntNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching hunt %s: %v", slug, err)
+	}
+	return h, err
+}
+
+// CreateHunt adds a hunt and returns it
+func (us *UserService) CreateHunt(ctx context.Context, slug, name string) (Hunt, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	name = strings.TrimSpace(name)
+	if !huntSlugPattern.MatchString(slug) {
+		return Hunt{}, ErrInvalidHuntSlug
+	}
+	if name == "" {
+		name = slug
+	}
+	if _, err := us.GetHuntBySlug(ctx, slug); err == nil {
+		return Hunt{}, ErrHuntExists
+	} else if !errors.Is(err, ErrHuntNotFound) {
+		return Hunt{}, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	id, err := us.Repo.CreateHunt(ctx, slug, name)
+	if err != nil {
+		log.Printf("Error creating hunt %s: %v", slug, err)
+		return Hunt{}, err
+	}
+	log.Printf("Created hunt %s with ID: %d", slug, id)
+	return us.GetHunt(ctx, id)
+}
+
+// CloneHunt starts a new hunt with copies of another's questions, answers
+// included, hints and media. The copies share the stored media objects,
+// and no team progress comes along
+func (us *UserService) CloneHunt(ctx context.Context, fromID int, slug, name string) (Hunt, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	name = strings.TrimSpace(name)
+	if !huntSlugPattern.MatchString(slug) {
+		return Hunt{}, ErrInvalidHuntSlug
+	}
+	if name == "" {
+		name = slug
+	}
+	if _, err := us.GetHuntBySlug(ctx, slug); err == nil {
+		return Hunt{}, ErrHuntExists
+	} else if !errors.Is(err, ErrHuntNotFound) {
+		return Hunt{}, err
+	}
+
+	archive, err := us.loadHuntArchive(ctx, fromID)
+	if err != nil {
+		return Hunt{}, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting clone of hunt %d: %v", fromID, err)
+		return Hunt{}, err
+	}
+	defer tx.Rollback()
+	repo := us.Repo.WithTx(tx)
+
+	id, err := repo.CreateHunt(ctx, slug, name)
+	if err != nil {
+		log.Printf("Error creating hunt %s: %v", slug, err)
+		return Hunt{}, err
+	}
+	var summary ImportSummary
+	if err := importHuntRows(ctx, repo, id, archive, false, &summary); err != nil {
+		log.Printf("Error cloning hunt %d: %v", fromID, err)
+		return Hunt{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing clone of hunt %d: %v", fromID, err)
+		return Hunt{}, err
+	}
+
+	log.Printf("Cloned hunt %d into %s: %d questions, %d hints, %d media", fromID, slug, summary.Questions, summary.Hints, summary.Media)
+	return us.GetHunt(ctx, id)
+}
+
+// DeleteHunt removes a hunt with no teams or questions left. The first
+// hunt always stays
+func (us *UserService) DeleteHunt(ctx context.Context, id int) error {
+	if id == DefaultHuntID {
+		return ErrHuntNotEmpty
+	}
+	if _, err := us.GetHunt(ctx, id); err != nil {
+		return err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	deleted, err := us.Repo.DeleteHunt(ctx, id)
+	if err != nil {
+		log.Printf("Error deleting hunt %d: %v", id, err)
+		return err
+	}
+	if !deleted {
+		return ErrHuntNotEmpty
+	}
+	log.Printf("Deleted hunt %d", id)
+	return nil
+}
+
+// TeamHuntID returns the hunt a team plays in
+func (us *UserService) TeamHuntID(ctx context.Context, teamID int) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	huntID, err := us.Repo.GetTeamHuntID(ctx, teamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrTeamNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching hunt of team %d: %v", teamID, err)
+	}
+	return huntID, err
+}
+
+// forEachHunt runs send for every hunt, adding up how many messages it
+// queued, and stops at the first error
+func (us *UserService) forEachHunt(ctx context.Context, send func(huntID int) (int, error)) (int, error) {
+	hunts, err := us.GetHunts(ctx)
+	if err != nil {
+		return 0, err
+	}
+	queued := 0
+	for _, hunt := range hunts {
+		n, err := send(hunt.ID)
+		queued += n
+		if err != nil {
+			return queued, err
+		}
+	}
+	return queued, nil
+}
+
+// huntSettingKey scopes a setting to a hunt. The first hunt keeps the
+// plain key, which it had before there were several
+func huntSettingKey(key string, huntID int) string {
+	if huntID == DefaultHuntID {
+		return key
+	}
+	return key + ":" + strconv.Itoa(huntID)
+}
@@ -1,20 +1,35 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
 	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
 )
 
-type QuestionLock struct {
-	QuestionID     int       `json:"question_id"`
-	LockedByTeamID int       `json:"locked_by_team_id"`
-	LockedByName   string    `json:"locked_by_name"`
-	LockedAt       time.Time `json:"locked_at"`
+type QuestionLock = repository.QuestionLock
+
+// DefaultLockTTL is how long a question stays locked without a submission
+// before it is released for other teams
+const DefaultLockTTL = 10 * time.Second
+
+// lockTTL returns the configured lock TTL
+func (us *UserService) lockTTL() time.Duration {
+	if us.LockTTL <= 0 {
+		return DefaultLockTTL
+	}
+	return us.LockTTL
+}
+
+// lockCutoff returns the time before which a lock has expired. Expired
+// locks are ignored by every read and taken over by LockQuestion, so they
+// only need deleting to keep the table small
+func (us *UserService) lockCutoff() time.Time {
+	return time.Now().Add(-us.lockTTL())
 }
 
 type QuestionTimer struct {
@@ -27,37 +42,30 @@ type QuestionTimer struct {
 
 // LockQuestion locks a question for a specific team using atomic operation
 // Returns error if question is already locked by another team
-func (us *UserService) LockQuestion(questionID int, teamID int) error {
-	// First try to lock atomically - only succeeds if not already locked
-	query := database.ConvertPlaceholders(`INSERT INTO question_locks (question_id, locked_by_team_id, locked_at) 
-			  SELECT ?, ?, ?
-			  WHERE NOT EXISTS (
-				  SELECT 1 FROM question_locks WHERE question_id = ?
-			  )`)
-	
-	result, err := us.UserStore.DB.Exec(query, questionID, teamID, time.Now(), questionID)
+func (us *UserService) LockQuestion(ctx context.Context, questionID int, teamID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	// Only succeeds if the question isn't already locked
+	now := time.Now()
+	locked, err := us.Repo.CreateLock(ctx, questionID, teamID, now, now.Add(-us.lockTTL()))
 	if err != nil {
 		log.Printf("Error locking question %d for team %d: %v", questionID, teamID, err)
 		return err
 	}
-	
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-	
-	if rowsAffected == 0 {
+
+	if !locked {
 		// Question was already locked by someone else
 		return fmt.Errorf("question %d is already locked by another team", questionID)
 	}
-	
+
 	log.Printf("Successfully locked question %d for team %d", questionID, teamID)
 	return nil
 }
 
 // TryLockQuestion attempts to lock a question, returns true if successful
-func (us *UserService) TryLockQuestion(questionID int, teamID int) (bool, error) {
-	err := us.LockQuestion(questionID, teamID)
+func (us *UserService) TryLockQuestion(ctx context.Context, questionID int, teamID int) (bool, error) {
+	err := us.LockQuestion(ctx, questionID, teamID)
 	if err != nil {
 		if err.Error() == fmt.Sprintf("question %d is already locked by another team", questionID) {
 			return false, nil
@@ -68,194 +76,120 @@ func (us *UserService) TryLockQuestion(questionID int, teamID int) (bool, error)
 }
 
 // UnlockQuestion unlocks a question (when submission happens)
-func (us *UserService) UnlockQuestion(questionID int) error {
-	query := database.ConvertPlaceholders(`DELETE FROM question_locks WHERE question_id = ?`)
-	
-	_, err := us.UserStore.DB.Exec(query, questionID)
-	if err != nil {
+func (us *UserService) UnlockQuestion(ctx context.Context, questionID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if _, err := us.Repo.DeleteLock(ctx, questionID); err != nil {
 		log.Printf("Error unlocking question %d: %v", questionID, err)
 		return err
 	}
-	
+
 	log.Printf("Successfully unlocked question %d", questionID)
 	return nil
 }
 
 // IsQuestionLocked checks if a question is locked
-// Automatically unlocks questions that have been locked for more than 10 seconds
-func (us *UserService) IsQuestionLocked(questionID int) (bool, *QuestionLock, error) {
-	// First, clean up stale locks (older than 10 seconds)
-	var cleanupQuery string
-	if os.Getenv("DATABASE_URL") != "" {
-		// PostgreSQL syntax
-		cleanupQuery = `DELETE FROM question_locks 
-					 WHERE question_id = $1
-					 AND locked_at < NOW() - INTERVAL '10 seconds'`
-	} else {
-		// SQLite syntax
-		cleanupQuery = `DELETE FROM question_locks 
-					 WHERE question_id = ? 
-					 AND locked_at < datetime('now', '-10 seconds')`
-	}
-	_, err := us.UserStore.DB.Exec(cleanupQuery, questionID)
-	if err != nil {
-		log.Printf("Error cleaning up stale lock for question %d: %v", questionID, err)
-	}
-	
-	query := database.ConvertPlaceholders(`SELECT ql.question_id, ql.locked_by_team_id, t.name, ql.locked_at 
-			  FROM question_locks ql
-			  JOIN teams t ON ql.locked_by_team_id = t.id
-			  WHERE ql.question_id = ?`)
-	
-	var lock QuestionLock
-	err = us.UserStore.DB.QueryRow(query, questionID).Scan(
-		&lock.QuestionID, 
-		&lock.LockedByTeamID, 
-		&lock.LockedByName,
-		&lock.LockedAt,
-	)
-	
+// Locks older than the lock TTL don't count
+func (us *UserService) IsQuestionLocked(ctx context.Context, questionID int) (bool, *QuestionLock, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	lock, err := us.Repo.GetLock(ctx, questionID, us.lockCutoff())
 	if err == sql.ErrNoRows {
 		return false, nil, nil
 	}
-	
+
 	if err != nil {
 		log.Printf("Error checking if question %d is locked: %v", questionID, err)
 		return false, nil, err
 	}
-	
+
 	return true, &lock, nil
 }
 
-// GetAllLockedQuestions returns all currently locked questions
-// Automatically cleans up stale locks (older than 10 seconds)
-func (us *UserService) GetAllLockedQuestions() ([]QuestionLock, error) {
-	// First, clean up all stale locks
-	var cleanupQuery string
-	if os.Getenv("DATABASE_URL") != "" {
-		// PostgreSQL syntax
-		cleanupQuery = `DELETE FROM question_locks WHERE locked_at < NOW() - INTERVAL '10 seconds'`
-	} else {
-		// SQLite syntax
-		cleanupQuery = `DELETE FROM question_locks WHERE locked_at < datetime('now', '-10 seconds')`
-	}
-	result, err := us.UserStore.DB.Exec(cleanupQuery)
-	if err != nil {
-		log.Printf("Error cleaning up stale locks: %v", err)
-	} else {
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected > 0 {
-			log.Printf("Cleaned up %d stale question locks", rowsAffected)
-		}
-	}
-	
-	query := `SELECT ql.question_id, ql.locked_by_team_id, t.name, ql.locked_at 
-			  FROM question_locks ql
-			  JOIN teams t ON ql.locked_by_team_id = t.id`
-	
-	rows, err := us.UserStore.DB.Query(query)
+// GetAllLockedQuestions returns all currently locked questions of a hunt
+// Locks older than the lock TTL are left out
+func (us *UserService) GetAllLockedQuestions(ctx context.Context, huntID int) ([]QuestionLock, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	locks, err := us.Repo.ListLocks(ctx, huntID, us.lockCutoff())
 	if err != nil {
 		log.Printf("Error getting all locked questions: %v", err)
 		return nil, err
 	}
-	defer rows.Close()
-	
-	var locks []QuestionLock
-	for rows.Next() {
-		var lock QuestionLock
-		err := rows.Scan(&lock.QuestionID, &lock.LockedByTeamID, &lock.LockedByName, &lock.LockedAt)
-		if err != nil {
-			log.Printf("Error scanning locked question: %v", err)
-			return nil, err
-		}
-		locks = append(locks, lock)
-	}
-	
+
 	return locks, nil
 }
 
 // StartQuestionTimer starts the timer when a user opens a question
-func (us *UserService) StartQuestionTimer(teamID int, questionID int) error {
-	// Check if timer already exists
-	var exists int
-	checkQuery := database.ConvertPlaceholders(`SELECT COUNT(*) FROM question_timers WHERE team_id = ? AND question_id = ?`)
-	err := us.UserStore.DB.QueryRow(checkQuery, teamID, questionID).Scan(&exists)
+func (us *UserService) StartQuestionTimer(ctx context.Context, teamID int, questionID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	exists, err := us.Repo.TimerExists(ctx, teamID, questionID)
 	if err != nil {
 		log.Printf("Error checking timer existence: %v", err)
 		return err
 	}
-	
+
 	// Only start timer if it doesn't exist yet
-	if exists == 0 {
-		query := database.ConvertPlaceholders(`INSERT INTO question_timers (team_id, question_id, started_at) 
-				  VALUES (?, ?, ?)`)
-		
-		_, err := us.UserStore.DB.Exec(query, teamID, questionID, time.Now())
-		if err != nil {
+	if !exists {
+		if err := us.Repo.CreateTimer(ctx, teamID, questionID, time.Now()); err != nil {
 			log.Printf("Error starting timer for team %d, question %d: %v", teamID, questionID, err)
 			return err
 		}
-		
+
 		log.Printf("Successfully started timer for team %d, question %d", teamID, questionID)
 	}
-	
+
 	return nil
 }
 
 // StopQuestionTimer stops the timer and records the solve time
-func (us *UserService) StopQuestionTimer(teamID int, questionID int) error {
-	// Get the start time
-	var startedAt time.Time
-	getQuery := database.ConvertPlaceholders(`SELECT started_at FROM question_timers WHERE team_id = ? AND question_id = ?`)
-	err := us.UserStore.DB.QueryRow(getQuery, teamID, questionID).Scan(&startedAt)
+func (us *UserService) StopQuestionTimer(ctx context.Context, teamID int, questionID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	startedAt, err := us.Repo.GetTimerStart(ctx, teamID, questionID)
 	if err != nil {
 		log.Printf("Error getting start time for team %d, question %d: %v", teamID, questionID, err)
 		return err
 	}
-	
-	// Calculate time taken
+
 	completedAt := time.Now()
 	timeTaken := int(completedAt.Sub(startedAt).Seconds())
-	
-	// Update the timer record
-	updateQuery := database.ConvertPlaceholders(`UPDATE question_timers 
-					SET completed_at = ?, time_taken_seconds = ? 
-					WHERE team_id = ? AND question_id = ?`)
-	
-	_, err = us.UserStore.DB.Exec(updateQuery, completedAt, timeTaken, teamID, questionID)
-	if err != nil {
+
+	if err := us.Repo.CompleteTimer(ctx, teamID, questionID, completedAt, timeTaken); err != nil {
 		log.Printf("Error stopping timer for team %d, question %d: %v", teamID, questionID, err)
 		return err
 	}
-	
+
 	log.Printf("Successfully stopped timer for team %d, question %d (Time: %d seconds)", teamID, questionID, timeTaken)
 	return nil
 }
 
 // GetTotalSolveTime gets the total time taken by a team to solve all questions
-func (us *UserService) GetTotalSolveTime(teamID int) (int, error) {
-	query := database.ConvertPlaceholders(`SELECT COALESCE(SUM(time_taken_seconds), 0) 
-			  FROM question_timers 
-			  WHERE team_id = ? AND completed_at IS NOT NULL`)
-	
-	var totalTime int
-	err := us.UserStore.DB.QueryRow(query, teamID).Scan(&totalTime)
+func (us *UserService) GetTotalSolveTime(ctx context.Context, teamID int) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	totalTime, err := us.Repo.SumSolveTime(ctx, teamID)
 	if err != nil {
 		log.Printf("Error getting total solve time for team %d: %v", teamID, err)
 		return 0, err
 	}
-	
+
 	return totalTime, nil
 }
 
 // GetQuestionSolveTime gets the time taken to solve a specific question
-func (us *UserService) GetQuestionSolveTime(teamID int, questionID int) (int, error) {
-	query := database.ConvertPlaceholders(`SELECT COALESCE(time_taken_seconds, 0) 
-			  FROM question_timers 
-			  WHERE team_id = ? AND question_id = ? AND completed_at IS NOT NULL`)
-	
-	var timeTaken int
-	err := us.UserStore.DB.QueryRow(query, teamID, questionID).Scan(&timeTaken)
+func (us *UserService) GetQuestionSolveTime(ctx context.Context, teamID int, questionID int) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	timeTaken, err := us.Repo.GetSolveTime(ctx, teamID, questionID)
 	if err == sql.ErrNoRows {
 		return 0, nil
 	}
@@ -263,15 +197,16 @@ func (us *UserService) GetQuestionSolveTime(teamID int, questionID int) (int, er
 		log.Printf("Error getting solve time for team %d, question %d: %v", teamID, questionID, err)
 		return 0, err
 	}
-	
+
 	return timeTaken, nil
 }
 
 // IsQuestionSolvedByAnyone checks if a question has been solved by any team
-func (us *UserService) IsQuestionSolvedByAnyone(questionID int) (bool, error) {
-	query := database.ConvertPlaceholders(`SELECT COUNT(*) FROM team_completed_questions WHERE question_id = ?`)
-	var count int
-	err := us.UserStore.DB.QueryRow(query, questionID).Scan(&count)
+func (us *UserService) IsQuestionSolvedByAnyone(ctx context.Context, questionID int) (bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	count, err := us.Repo.CountQuestionSolves(ctx, questionID)
 	if err != nil {
 		log.Printf("Error checking if question %d is solved by anyone: %v", questionID, err)
 		return false, err
@@ -279,28 +214,21 @@ func (us *UserService) IsQuestionSolvedByAnyone(questionID int) (bool, error) {
 	return count > 0, nil
 }
 
-// CleanupStaleLocks removes all locks older than 10 seconds
-// This should be called periodically to prevent abandoned locks
-func (us *UserService) CleanupStaleLocks() error {
-	var query string
-	if os.Getenv("DATABASE_URL") != "" {
-		// PostgreSQL syntax
-		query = `DELETE FROM question_locks WHERE locked_at < NOW() - INTERVAL '10 seconds'`
-	} else {
-		// SQLite syntax
-		query = `DELETE FROM question_locks WHERE locked_at < datetime('now', '-10 seconds')`
-	}
-	
-	result, err := us.UserStore.DB.Exec(query)
+// CleanupStaleLocks removes all locks older than the lock TTL
+// It is called periodically from main so reads never have to delete
+func (us *UserService) CleanupStaleLocks(ctx context.Context) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rowsAffected, err := us.Repo.DeleteLocksBefore(ctx, us.lockCutoff())
 	if err != nil {
 		log.Printf("Error cleaning up stale locks: %v", err)
 		return err
 	}
-	
-	rowsAffected, _ := result.RowsAffected()
+
 	if rowsAffected > 0 {
-		log.Printf("Cleaned up %d stale question locks (timeout: 10 seconds)", rowsAffected)
+		log.Printf("Cleaned up %d stale question locks (timeout: %v)", rowsAffected, us.lockTTL())
 	}
-	
+
 	return nil
 }
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP connection security
+const (
+	MailTLSStartTLS = "starttls" // upgrade a plain connection, the default
+	MailTLS         = "tls"      // implicit TLS, usually port 465
+	MailTLSNone     = "none"     // only for a relay on a trusted network
+)
+
+// mailTimeout bounds a whole SMTP conversation
+const mailTimeout = 30 * time.Second
+
+// MailConfig is the SMTP server emails go out through
+type MailConfig struct {
+	Host     string
+	Port     int // default 587, or 465 with implicit TLS
+	Username string
+	Password string
+	From     string // e.g., "Holmes <hunt@example.com>"
+	TLS      string // starttls (default), tls or none
+
+	// BaseURL is where the site is reached, for links in emails
+	BaseURL string
+}
+
+// Mailer sends plain text emails over SMTP
+type Mailer struct {
+	cfg  MailConfig
+	from *mail.Address
+}
+
+// NewMailer returns nil when no SMTP host is configured, which turns
+// email off
+func NewMailer(cfg MailConfig) *Mailer {
+	if cfg.Host == "" {
+		return nil
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		log.Printf("Email disabled, invalid sender address %q: %v", cfg.From, err)
+		return nil
+	}
+	if cfg.TLS == "" {
+		cfg.TLS = MailTLSStartTLS
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		if cfg.TLS == MailTLS {
+			cfg.Port = 465
+		}
+	}
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+
+	return &Mailer{cfg: cfg, from: from}
+}
+
+// Link turns a site path into an absolute URL for an email
+func (m *Mailer) Link(path string) string {
+	return m.cfg.BaseURL + path
+}
+
+// Send delivers one message
+func (m *Mailer) Send(to, subject, body string) error {
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %s", to, err)
+	}
+	msg, err := m.message(rcpt, subject, body)
+	if err != nil {
+		return err
+	}
+
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(rcpt.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial connects to the SMTP server, securing the connection as configured
+func (m *Mailer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+	dialer := &net.Dialer{Timeout: mailTimeout}
+
+	var conn net.Conn
+	var err error
+	if m.cfg.TLS == MailTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if m.cfg.TLS == MailTLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// message renders the headers and quoted-printable body of an email
+func (m *Mailer) message(to *mail.Address, subject, body string) ([]byte, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", m.from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+m.cfg.Host+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
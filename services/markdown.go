@@ -0,0 +1,138 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// The small subset of markdown teams write their writeups in: headings,
+// paragraphs, lists, quotes, fenced code, emphasis, inline code, links and
+// images. Text is escaped before any markup is added, so raw HTML in the
+// source shows as text
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	orderedItemPattern = regexp.MustCompile(`^\d+[.)]\s+(.*)$`)
+	linkPattern        = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^)\s]+)\)`)
+	boldPattern        = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	italicPattern      = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+)
+
+// markdownBlock is the block being built up from consecutive lines
+type markdownBlock struct {
+	kind  string // "p", "ul", "ol" or "blockquote"
+	lines []string
+}
+
+// RenderMarkdown turns markdown into HTML that is safe to show as is
+func RenderMarkdown(src string) string {
+	var b strings.Builder
+	var block markdownBlock
+
+	flush := func() {
+		switch block.kind {
+		case "p", "blockquote":
+			text := renderInline(strings.Join(block.lines, "\n"))
+			text = strings.ReplaceAll(text, "\n", "<br>")
+			if block.kind == "blockquote" {
+				fmt.Fprintf(&b, "<blockquote><p>%s</p></blockquote>", text)
+			} else {
+				fmt.Fprintf(&b, "<p>%s</p>", text)
+			}
+		case "ul", "ol":
+			fmt.Fprintf(&b, "<%s>", block.kind)
+			for _, item := range block.lines {
+				fmt.Fprintf(&b, "<li>%s</li>", renderInline(item))
+			}
+			fmt.Fprintf(&b, "</%s>", block.kind)
+		}
+		block = markdownBlock{}
+	}
+	add := func(kind, line string) {
+		if block.kind != kind {
+			flush()
+			block.kind = kind
+		}
+		block.lines = append(block.lines, line)
+	}
+
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(line, "```"):
+			flush()
+			b.WriteString("<pre><code>")
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				b.WriteString(html.EscapeString(lines[i]))
+				b.WriteByte('\n')
+			}
+			b.WriteString("</code></pre>")
+		case line == "":
+			flush()
+		case headingPattern.MatchString(line):
+			flush()
+			m := headingPattern.FindStringSubmatch(line)
+			fmt.Fprintf(&b, "<h%d>%s</h%d>", len(m[1]), renderInline(m[2]), len(m[1]))
+		case strings.HasPrefix(line, ">"):
+			add("blockquote", strings.TrimSpace(strings.TrimPrefix(line, ">")))
+		case strings.HasPrefix(line, "- "), strings.HasPrefix(line, "* "), strings.HasPrefix(line, "+ "):
+			add("ul", strings.TrimSpace(line[2:]))
+		case orderedItemPattern.MatchString(line):
+			add("ol", orderedItemPattern.FindStringSubmatch(line)[1])
+		default:
+			add("p", line)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// renderInline renders the markup within a line. Code spans are taken out
+// first so nothing inside them is treated as markup
+func renderInline(text string) string {
+	parts := strings.Split(text, "`")
+	var b strings.Builder
+	for i, part := range parts {
+		// An unclosed backtick is just a backtick
+		if i%2 == 1 && i < len(parts)-1 {
+			fmt.Fprintf(&b, "<code>%s</code>", html.EscapeString(part))
+			continue
+		}
+		if i%2 == 1 {
+			b.WriteByte('`')
+		}
+		b.WriteString(renderEmphasis(html.EscapeString(part)))
+	}
+	return b.String()
+}
+
+// renderEmphasis adds links, images, bold and italics to escaped text
+func renderEmphasis(text string) string {
+	text = linkPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := linkPattern.FindStringSubmatch(s)
+		image, label, url := m[1] == "!", m[2], m[3]
+		if !safeMarkdownURL(url) {
+			return label
+		}
+		if image {
+			return fmt.Sprintf(`<img src="%s" alt="%s" loading="lazy">`, url, label)
+		}
+		return fmt.Sprintf(`<a href="%s" rel="nofollow noopener" target="_blank">%s</a>`, url, label)
+	})
+	text = boldPattern.ReplaceAllString(text, "<strong>$1</strong>")
+	return italicPattern.ReplaceAllString(text, "<em>$1</em>")
+}
+
+// safeMarkdownURL reports whether a link target is a web address or a
+// path on this site, ruling out javascript: and data: URLs
+func safeMarkdownURL(url string) bool {
+	for _, prefix := range []string{"https://", "http://", "mailto:", "/", "#"} {
+		if strings.HasPrefix(strings.ToLower(url), prefix) {
+			return true
+		}
+	}
+	return false
+}
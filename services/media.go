@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namishh/holmes/database"
+)
+
+// PresignExpiry is how long a presigned upload URL stays valid
+const PresignExpiry = 15 * time.Minute
+
+// MediaProxyPath is where the app serves stored media to teams allowed
+// to see it; buckets are never exposed directly
+const MediaProxyPath = "/media/"
+
+var (
+	// ErrPresignUnsupported is returned when the storage backend can't
+	// accept direct uploads, e.g. local disk
+	ErrPresignUnsupported = errors.New("storage backend does not support direct uploads")
+
+	// ErrUnknownMediaKind is returned for a kind other than images, videos, audios or files
+	ErrUnknownMediaKind = errors.New("unknown media kind")
+
+	// ErrInvalidMediaKey is returned when a key wasn't issued for the given kind
+	ErrInvalidMediaKey = errors.New("invalid media key")
+
+	// ErrMediaNotUploaded is returned when confirming a key with no object behind it
+	ErrMediaNotUploaded = errors.New("media has not been uploaded")
+)
+
+// mediaPrefixes maps each media table to the prefix of its storage keys
+var mediaPrefixes = map[string]string{
+	"images": "IMG",
+	"videos": "VID",
+	"audios": "AUD",
+	"files":  "FILE",
+}
+
+// NewMediaKey names a new upload, keeping the extension of the original filename
+func NewMediaKey(prefix, filename string) string {
+	return fmt.Sprintf("%s-%s%s", prefix, uuid.New().String(), filepath.Ext(filename))
+}
+
+// PresignMediaUpload issues a key for a new upload of the given kind and
+// a URL the client can PUT the file to directly
+func (us *UserService) PresignMediaUpload(kind, filename string) (key string, url string, err error) {
+	prefix, ok := mediaPrefixes[kind]
+	if !ok {
+		return "", "", ErrUnknownMediaKind
+	}
+	presigner, ok := us.Storage.(PresignedStorage)
+	if !ok {
+		return "", "", ErrPresignUnsupported
+	}
+
+	key = NewMediaKey(prefix, filename)
+	url, err = presigner.PresignPut(context.Background(), key, PresignExpiry)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to presign upload: %v", err)
+	}
+	return key, url, nil
+}
+
+// ConfirmMediaUpload records a direct upload against a question once
+// the object is in storage. filename is the name files are downloaded
+// under; the key is used when it is empty
+func (us *UserService) ConfirmMediaUpload(ctx context.Context, questionID int, kind, key, filename string) error {
+	prefix, ok := mediaPrefixes[kind]
+	if !ok {
+		return ErrUnknownMediaKind
+	}
+	if filepath.Base(key) != key || !strings.HasPrefix(key, prefix+"-") {
+		return ErrInvalidMediaKey
+	}
+
+	obj, info, err := us.Storage.Open(ctx, key)
+	if errors.Is(err, ErrObjectNotFound) {
+		return ErrMediaNotUploaded
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check uploaded media: %v", err)
+	}
+
+	// Direct uploads skip the server, so they are validated after the fact
+	// and removed if rejected
+	_, err = us.Uploads.ValidateUpload(kind, key, info.Size, obj)
+	obj.Close()
+	if err != nil {
+		if delErr := us.Storage.Delete(ctx, key); delErr != nil {
+			log.Printf("Error deleting rejected upload %s: %v", key, delErr)
+		}
+		return err
+	}
+
+	name := filepath.Base(filename)
+	if strings.TrimSpace(filename) == "" {
+		name = key
+	}
+	return us.attachMedia(ctx, questionID, kind, key, name)
+}
+
+// attachMedia records stored media against a question, resizing images
+// first; name is only kept for files
+func (us *UserService) attachMedia(ctx context.Context, questionID int, kind, key, name string) error {
+	switch kind {
+	case "files":
+		return us.CreateAttachments(ctx, questionID, []string{key}, []string{name})
+	case "images":
+		if err := us.GenerateImageVariants(key); err != nil {
+			log.Printf("Warning: Error resizing %s: %v", key, err)
+		}
+		return us.CreateMedia(ctx, questionID, []string{key}, nil, nil)
+	case "videos":
+		return us.CreateMedia(ctx, questionID, nil, []string{key}, nil)
+	default:
+		return us.CreateMedia(ctx, questionID, nil, nil, []string{key})
+	}
+}
+
+// MediaURL returns the address media stored under key is served from
+func (us *UserService) MediaURL(key string) string {
+	return MediaProxyPath + key
+}
+
+// GetMediaQuestionIDs returns the questions the media stored under key
+// belongs to; a cloned hunt shares its media with the original. Returns
+// sql.ErrNoRows when no question references the key
+func (us *UserService) GetMediaQuestionIDs(ctx context.Context, key string) ([]int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	var table string
+	for t, prefix := range mediaPrefixes {
+		if strings.HasPrefix(key, prefix+"-") {
+			table = t
+		}
+	}
+	if table == "" {
+		return nil, sql.ErrNoRows
+	}
+
+	ids, err := us.Repo.ListMediaQuestionIDs(ctx, table, key)
+	if err != nil {
+		log.Printf("Error getting question of media %s: %v", key, err)
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return ids, nil
+}
+
+// OpenMedia opens the media stored under key for streaming
+func (us *UserService) OpenMedia(key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	return us.Storage.Open(context.Background(), key)
+}
+
+// OrphanGracePeriod is how old an object with no media row must be before
+// CleanupOrphanedMedia removes it, so uploads still being attached to a
+// question are left alone
+const OrphanGracePeriod = 24 * time.Hour
+
+// getQuestionMediaKeys returns the keys of every media row of a question
+func (us *UserService) getQuestionMediaKeys(ctx context.Context, questionID int) ([]string, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	var keys []string
+	for table := range mediaPrefixes {
+		media, err := us.Repo.ListMedia(ctx, table, questionID)
+		if err != nil {
+			log.Printf("Error getting %s of question %d: %v", table, questionID, err)
+			return nil, err
+		}
+		for _, m := range media {
+			keys = append(keys, m.Path)
+		}
+	}
+	return keys, nil
+}
+
+// deleteMediaObjects removes stored media along with its resized copies,
+// keeping objects another question still uses, as cloned hunts do
+// Failures are only logged; CleanupOrphanedMedia picks up what's left
+func (us *UserService) deleteMediaObjects(keys []string) {
+	ctx := context.Background()
+	for _, key := range keys {
+		if _, err := us.GetMediaQuestionIDs(ctx, key); !errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		objects := []string{key}
+		if strings.HasPrefix(key, mediaPrefixes["images"]+"-") {
+			for _, w := range imageVariantWidths {
+				objects = append(objects, ImageVariantKey(key, w))
+			}
+		}
+		for _, obj := range objects {
+			if err := us.Storage.Delete(ctx, obj); err != nil {
+				log.Printf("Warning: Error deleting media object %s: %v", obj, err)
+			}
+		}
+	}
+}
+
+// CleanupOrphanedMedia deletes stored media that no media row, writeup,
+// photo submission or team avatar references and that is older than OrphanGracePeriod. Objects without a
+// media key prefix are never touched. Returns how many objects were deleted
+func (us *UserService) CleanupOrphanedMedia(ctx context.Context) (int, error) {
+	// Only the queries are bounded; listing a large bucket may take longer
+	dbCtx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	known := make(map[string]bool)
+	for table := range mediaPrefixes {
+		paths, err := us.Repo.ListMediaPaths(dbCtx, table)
+		if err != nil {
+			log.Printf("Error listing %s: %v", table, err)
+			return 0, err
+		}
+		for _, key := range paths {
+			known[key] = true
+		}
+	}
+
+	paths, err := us.Repo.ListWriteupPaths(dbCtx)
+	if err != nil {
+		log.Printf("Error listing writeup files: %v", err)
+		return 0, err
+	}
+	for _, key := range paths {
+		known[key] = true
+	}
+
+	photos, err := us.Repo.ListPhotoPaths(dbCtx)
+	if err != nil {
+		log.Printf("Error listing photo submissions: %v", err)
+		return 0, err
+	}
+	for _, key := range photos {
+		known[key] = true
+	}
+
+	avatars, err := us.Repo.ListAvatars(dbCtx)
+	if err != nil {
+		log.Printf("Error listing avatars: %v", err)
+		return 0, err
+	}
+	for _, key := range avatars {
+		known[key] = true
+	}
+
+	objects, err := us.Storage.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list stored media: %v", err)
+	}
+
+	cutoff := time.Now().Add(-OrphanGracePeriod)
+	deleted := 0
+	for _, obj := range objects {
+		if !isMediaKey(obj.Key) || known[OriginalMediaKey(obj.Key)] || obj.ModTime.After(cutoff) {
+			continue
+		}
+		if err := us.Storage.Delete(ctx, obj.Key); err != nil {
+			log.Printf("Warning: Error deleting orphaned media %s: %v", obj.Key, err)
+			continue
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// isMediaKey reports whether key looks like one issued by NewMediaKey,
+// for question media, writeup files or avatars
+func isMediaKey(key string) bool {
+	for _, prefix := range mediaPrefixes {
+		if strings.HasPrefix(key, prefix+"-") {
+			return true
+		}
+	}
+	return strings.HasPrefix(key, WriteupFilePrefix+"-") || strings.HasPrefix(key, AvatarPrefix+"-") || strings.HasPrefix(key, PhotoFilePrefix+"-")
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"log"
+	"os"
+)
+
+// MessageBus carries events between server instances so that clients
+// connected to any instance see events raised on every other one
+type MessageBus interface {
+	// Publish sends an event raised on this instance to the other instances
+	Publish(event Event) error
+
+	// Subscribe starts delivering events published by other instances to
+	// handler. Events this instance published itself are not delivered
+	Subscribe(handler func(Event)) error
+
+	// Close releases the underlying connection
+	Close() error
+}
+
+// MessageBusConfig selects and configures the message bus
+type MessageBusConfig struct {
+	// Broker is "redis", "nats" or "none"; empty picks Redis if an
+	// address is configured and runs standalone otherwise
+	Broker string
+
+	// InstanceID identifies this server on the bus and must be stable
+	// across restarts. Redis requires it, since it names the consumer
+	// group; NATS defaults it to the hostname
+	InstanceID string
+
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+
+	NATSURL string
+}
+
+// busEnvelope wraps an event with the instance that published it
+type busEnvelope struct {
+	Origin string `json:"origin"`
+	Event  Event  `json:"event"`
+}
+
+// NewMessageBus connects to the configured broker
+// Returns nil when no broker is configured or the connection fails,
+// in which case the Broadcaster runs in standalone mode
+func NewMessageBus(cfg MessageBusConfig) MessageBus {
+	broker := cfg.Broker
+	if broker == "" && cfg.RedisAddr != "" {
+		broker = "redis"
+	}
+
+	if cfg.InstanceID == "" && broker == "nats" {
+		cfg.InstanceID, _ = os.Hostname()
+		if cfg.InstanceID == "" {
+			cfg.InstanceID = "holmes"
+		}
+	}
+
+	switch broker {
+	case "redis":
+		bus, err := NewRedisStreamBus(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, cfg.InstanceID)
+		if err != nil {
+			log.Printf("Warning: Redis connection failed: %v. Running in standalone mode.", err)
+			return nil
+		}
+		log.Println("Successfully connected to Redis for event streams")
+		return bus
+	case "nats":
+		bus, err := NewNATSBus(cfg.NATSURL, cfg.InstanceID)
+		if err != nil {
+			log.Printf("Warning: NATS connection failed: %v. Running in standalone mode.", err)
+			return nil
+		}
+		log.Println("Successfully connected to NATS for event fan-out")
+		return bus
+	case "", "none":
+		return nil
+	default:
+		log.Printf("Warning: Unknown message broker %q. Running in standalone mode.", broker)
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsSubject is the subject every instance publishes events on
+const natsSubject = "holmes.hunt_events"
+
+// NATSBus is a MessageBus backed by core NATS publish/subscribe
+// Delivery is at-most-once: instances that are down miss events
+type NATSBus struct {
+	conn       *nats.Conn
+	sub        *nats.Subscription
+	instanceID string
+}
+
+// NewNATSBus connects to the NATS server at url (nats.DefaultURL if empty)
+func NewNATSBus(url string, instanceID string) (*NATSBus, error) {
+	if url == "" {
+		url = nats.DefaultURL
+	}
+
+	conn, err := nats.Connect(url,
+		nats.Name("holmes-"+instanceID),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("NATS disconnected: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Printf("NATS reconnected to %s", nc.ConnectedUrl())
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NATSBus{
+		conn:       conn,
+		instanceID: instanceID,
+	}, nil
+}
+
+// Publish sends an event on the shared subject
+func (nb *NATSBus) Publish(event Event) error {
+	data, err := json.Marshal(busEnvelope{Origin: nb.instanceID, Event: event})
+	if err != nil {
+		return err
+	}
+	return nb.conn.Publish(natsSubject, data)
+}
+
+// Subscribe delivers events from other instances to handler
+func (nb *NATSBus) Subscribe(handler func(Event)) error {
+	sub, err := nb.conn.Subscribe(natsSubject, func(msg *nats.Msg) {
+		var envelope busEnvelope
+		if err := json.Unmarshal(msg.Data, &envelope); err != nil {
+			log.Printf("Error unmarshaling NATS message: %v", err)
+			return
+		}
+
+		// Events this instance published were already delivered locally
+		if envelope.Origin == nb.instanceID {
+			return
+		}
+
+		handler(envelope.Event)
+	})
+	if err != nil {
+		return err
+	}
+
+	nb.sub = sub
+	return nil
+}
+
+// Close drains the subscription and closes the connection
+func (nb *NATSBus) Close() error {
+	return nb.conn.Drain()
+}
+
+// Ping reports whether the connection to NATS is up
+func (nb *NATSBus) Ping(ctx context.Context) error {
+	if status := nb.conn.Status(); status != nats.CONNECTED {
+		return fmt.Errorf("NATS connection is %s", status)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Notification types shown in the team inbox
+const (
+	NotificationAnnouncement   = "announcement"
+	NotificationHintReleased   = "hint_released"
+	NotificationQuestionUnlock = "question_unlocked"
+	NotificationWriteup        = "writeup_reviewed"
+	NotificationClarification  = "clarification"
+	NotificationPhoto          = "photo_reviewed"
+	NotificationCredit         = "partial_credit"
+)
+
+// Notification is an entry in a team's inbox
+// TeamID 0 means the notification was sent to every team
+type Notification = repository.Notification
+
+// CreateNotification stores a notification and returns it with its ID set
+func (us *UserService) CreateNotification(ctx context.Context, n Notification) (Notification, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	n.CreatedAt = time.Now()
+	id, err := us.Repo.CreateNotification(ctx, n)
+	if err != nil {
+		log.Printf("Error creating notification for team %d: %v", n.TeamID, err)
+		return Notification{}, err
+	}
+
+	n.ID = id
+	return n, nil
+}
+
+// GetNotificationsForTeam returns the team's own and global notifications, newest first
+func (us *UserService) GetNotificationsForTeam(ctx context.Context, teamID int, limit int) ([]Notification, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	notifications, err := us.Repo.ListTeamNotifications(ctx, teamID, limit)
+	if err != nil {
+		log.Printf("Error getting notifications for team %d: %v", teamID, err)
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// GetUnreadNotificationCount counts notifications the team hasn't read yet
+func (us *UserService) GetUnreadNotificationCount(ctx context.Context, teamID int) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	count, err := us.Repo.CountUnreadNotifications(ctx, teamID)
+	if err != nil {
+		log.Printf("Error counting unread notifications for team %d: %v", teamID, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MarkNotificationsRead marks every notification visible to the team as read
+func (us *UserService) MarkNotificationsRead(ctx context.Context, teamID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.MarkNotificationsRead(ctx, teamID); err != nil {
+		log.Printf("Error marking notifications read for team %d: %v", teamID, err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Page is markdown the admins wrote, such as the rules or the FAQ, served
+// at /p/<slug> once published
+type Page = repository.Page
+
+// RenderedPage is a page with its markdown turned into HTML that is safe
+// to show as is
+type RenderedPage struct {
+	Page Page
+	HTML string
+}
+
+// pageCacheTTL is how long a rendered page is served from memory; other
+// instances pick up an edit within it
+const pageCacheTTL = 30 * time.Second
+
+// maxPageBody bounds the markdown of one page
+const maxPageBody = 64 * 1024
+
+var pageSlugPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,62}[a-z0-9])?$`)
+
+var (
+	ErrPageNotFound = errors.New("page not found")
+	ErrInvalidPage  = errors.New("invalid page")
+)
+
+// pageCache holds rendered published pages by slug, so a page linked from
+// everywhere during the event doesn't cost a query and a render each time
+type pageCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedPage
+}
+
+type cachedPage struct {
+	page    RenderedPage
+	expires time.Time
+}
+
+// forgetPages drops the cached pages after an edit
+func (us *UserService) forgetPages() {
+	us.pageCache.mu.Lock()
+	us.pageCache.entries = nil
+	us.pageCache.mu.Unlock()
+}
+
+// checkPage trims a page and checks it can be saved
+func checkPage(p Page) (Page, error) {
+	p.Slug = strings.ToLower(strings.TrimSpace(p.Slug))
+	p.Title = strings.TrimSpace(p.Title)
+	switch {
+	case !pageSlugPattern.MatchString(p.Slug):
+		return p, fmt.Errorf("%w: the slug may only hold lowercase letters, digits and dashes, up to 64 of them", ErrInvalidPage)
+	case p.Title == "":
+		return p, fmt.Errorf("%w: a page needs a title", ErrInvalidPage)
+	case len(p.Title) > 255:
+		return p, fmt.Errorf("%w: the title is too long", ErrInvalidPage)
+	case len(p.Body) > maxPageBody:
+		return p, fmt.Errorf("%w: the page is longer than %d KB", ErrInvalidPage, maxPageBody/1024)
+	}
+	return p, nil
+}
+
+// GetPages returns every page, published or not, by slug
+func (us *UserService) GetPages(ctx context.Context) ([]Page, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	pages, err := us.Repo.ListPages(ctx)
+	if err != nil {
+		log.Printf("Error getting pages: %v", err)
+		return nil, err
+	}
+	return pages, nil
+}
+
+// GetPage returns a page to edit
+func (us *UserService) GetPage(ctx context.Context, id int) (Page, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	p, err := us.Repo.GetPage(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Page{}, ErrPageNotFound
+	}
+	if err != nil {
+		log.Printf("Error getting page %d: %v", id, err)
+		return Page{}, err
+	}
+	return p, nil
+}
+
+// RenderPage returns the page at a slug with its markdown rendered.
+// Published pages are served from memory; drafts are only found with
+// drafts set, for admins checking a page before publishing it
+func (us *UserService) RenderPage(ctx context.Context, slug string, drafts bool) (RenderedPage, error) {
+	c := &us.pageCache
+	c.mu.Lock()
+	cached, ok := c.entries[slug]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.page, nil
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	p, err := us.Repo.GetPageBySlug(ctx, slug)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !p.Published && !drafts) {
+		return RenderedPage{}, ErrPageNotFound
+	}
+	if err != nil {
+		log.Printf("Error getting page %q: %v", slug, err)
+		return RenderedPage{}, err
+	}
+
+	page := RenderedPage{Page: p, HTML: RenderMarkdown(p.Body)}
+	if p.Published {
+		c.mu.Lock()
+		if c.entries == nil {
+			c.entries = make(map[string]cachedPage)
+		}
+		c.entries[slug] = cachedPage{page: page, expires: time.Now().Add(pageCacheTTL)}
+		c.mu.Unlock()
+	}
+	return page, nil
+}
+
+// SavePage creates a page, or saves it when it has an ID, and returns it
+func (us *UserService) SavePage(ctx context.Context, p Page) (Page, error) {
+	p, err := checkPage(p)
+	if err != nil {
+		return p, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	existing, err := us.Repo.GetPageBySlug(ctx, p.Slug)
+	if err == nil && existing.ID != p.ID {
+		return p, fmt.Errorf("%w: another page is at /p/%s", ErrInvalidPage, p.Slug)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error checking page slug %q: %v", p.Slug, err)
+		return p, err
+	}
+
+	p.UpdatedAt = time.Now()
+	if p.ID == 0 {
+		p.CreatedAt = p.UpdatedAt
+		p.ID, err = us.Repo.CreatePage(ctx, p)
+		if err != nil {
+			log.Printf("Error creating page %q: %v", p.Slug, err)
+			return p, err
+		}
+	} else {
+		ok, err := us.Repo.UpdatePage(ctx, p)
+		if err != nil {
+			log.Printf("Error saving page %d: %v", p.ID, err)
+			return p, err
+		}
+		if !ok {
+			return p, ErrPageNotFound
+		}
+	}
+
+	us.forgetPages()
+	return p, nil
+}
+
+// DeletePage deletes a page
+func (us *UserService) DeletePage(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeletePage(ctx, id); err != nil {
+		log.Printf("Error deleting page %d: %v", id, err)
+		return err
+	}
+
+	us.forgetPages()
+	return nil
+}
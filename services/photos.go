@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Answer types. A text question is answered by typing its answer, a photo
+// question by sending a photo or file that an admin grades
+const (
+	AnswerText  = "text"
+	AnswerPhoto = "photo"
+)
+
+// Photo submission statuses. A photo waits for an admin, who approves it
+// with points or rejects it with a note
+const (
+	PhotoPending  = "pending"
+	PhotoApproved = "approved"
+	PhotoRejected = "rejected"
+)
+
+const (
+	// PhotoFilePrefix starts the storage key of photos teams send
+	PhotoFilePrefix = "PHO"
+	// PhotoNoteMaxLength caps the note an admin leaves with a grade
+	PhotoNoteMaxLength = 500
+)
+
+// PhotoSubmission is a photo a team sent as the answer to a question
+type PhotoSubmission = repository.PhotoSubmission
+
+var (
+	ErrInvalidAnswerType = errors.New("answer type must be text or photo")
+	ErrPhotoNotFound     = errors.New("photo not found")
+	ErrPhotoPending      = errors.New("your last photo for this question is still waiting to be reviewed")
+	ErrPhotoGraded       = errors.New("photo was already graded")
+	ErrInvalidPhotoGrade = errors.New("status must be approved or rejected")
+	ErrPhotoNoteTooLong  = fmt.Errorf("note is longer than %d characters", PhotoNoteMaxLength)
+	// ErrInvalidPhotoPoints is returned for an approval worth nothing or
+	// more than the question
+	ErrInvalidPhotoPoints = errors.New("points must be between 1 and the question's points")
+	// ErrInvalidPhotoStatus is returned when listing photos with a status
+	// that doesn't exist
+	ErrInvalidPhotoStatus = errors.New("status must be pending, approved or rejected")
+)
+
+// ValidAnswerType reports whether questions can be answered with t
+func ValidAnswerType(t string) bool {
+	return t == AnswerText || t == AnswerPhoto
+}
+
+func validPhotoStatus(status string) bool {
+	return status == PhotoPending || status == PhotoApproved || status == PhotoRejected
+}
+
+// HasPendingPhoto reports whether a team's photo for a question is still
+// waiting for review, in which case it can't send another
+func (us *UserService) HasPendingPhoto(ctx context.Context, teamID, questionID int) (bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	n, err := us.Repo.CountPendingPhotos(ctx, teamID, questionID)
+	if err != nil {
+		log.Printf("Error counting pending photos of team %d for question %d: %v", teamID, questionID, err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// SubmitPhoto queues the photo stored under key, uploaded as name, for
+// review as a team's answer to a question
+func (us *UserService) SubmitPhoto(ctx context.Context, teamID, questionID int, key, name, ip string) (PhotoSubmission, error) {
+	pending, err := us.HasPendingPhoto(ctx, teamID, questionID)
+	if err != nil {
+		return PhotoSubmission{}, err
+	}
+	if pending {
+		return PhotoSubmission{}, ErrPhotoPending
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	id, err := us.Repo.CreatePhotoSubmission(ctx, PhotoSubmission{TeamID: teamID, QuestionID: questionID, Path: key, Name: name, IP: ip, Status: PhotoPending, CreatedAt: time.Now()})
+	if err != nil {
+		log.Printf("Error saving photo of team %d for question %d: %v", teamID, questionID, err)
+		return PhotoSubmission{}, err
+	}
+	log.Printf("Team %d sent a photo for question %d", teamID, questionID)
+	return us.GetPhotoSubmission(ctx, id)
+}
+
+// GetPhotoSubmission returns a photo submission, or ErrPhotoNotFound
+func (us *UserService) GetPhotoSubmission(ctx context.Context, id int) (PhotoSubmission, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	p, err := us.Repo.GetPhotoSubmission(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PhotoSubmission{}, ErrPhotoNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching photo submission %d: %v", id, err)
+		return PhotoSubmission{}, err
+	}
+	return p, nil
+}
+
+// GetPhotoSubmissions returns the photos sent for a hunt's questions with
+// a status, or all of them when status is empty, oldest first
+func (us *UserService) GetPhotoSubmissions(ctx context.Context, huntID int, status string) ([]PhotoSubmission, error) {
+	if status != "" && !validPhotoStatus(status) {
+		return nil, ErrInvalidPhotoStatus
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	photos, err := us.Repo.ListPhotoSubmissions(ctx, huntID, status)
+	if err != nil {
+		log.Printf("Error listing photo submissions of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+	if photos == nil {
+		photos = make([]PhotoSubmission, 0)
+	}
+	return photos, nil
+}
+
+// GetTeamPhotoSubmissions returns the photos a team sent for a question,
+// newest first
+func (us *UserService) GetTeamPhotoSubmissions(ctx context.Context, teamID, questionID int) ([]PhotoSubmission, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	photos, err := us.Repo.ListTeamPhotoSubmissions(ctx, teamID, questionID)
+	if err != nil {
+		log.Printf("Error listing photos of team %d for question %d: %v", teamID, questionID, err)
+		return nil, err
+	}
+	if photos == nil {
+		photos = make([]PhotoSubmission, 0)
+	}
+	return photos, nil
+}
+
+// GradePhoto approves a pending photo with points, between one and the
+// question's worth, or rejects it. A photo is only ever graded once; the
+// caller awards the points of an approved one
+func (us *UserService) GradePhoto(ctx context.Context, id int, status string, points int, note string) (PhotoSubmission, error) {
+	if status != PhotoApproved && status != PhotoRejected {
+		return PhotoSubmission{}, ErrInvalidPhotoGrade
+	}
+	if utf8.RuneCountInString(note) > PhotoNoteMaxLength {
+		return PhotoSubmission{}, ErrPhotoNoteTooLong
+	}
+	p, err := us.GetPhotoSubmission(ctx, id)
+	if err != nil {
+		return PhotoSubmission{}, err
+	}
+	if status == PhotoRejected {
+		points = 0
+	} else if points < 1 || points > p.QuestionPoints {
+		return PhotoSubmission{}, ErrInvalidPhotoPoints
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	graded, err := us.Repo.GradePhotoSubmission(ctx, id, status, points, note, time.Now())
+	if err != nil {
+		log.Printf("Error grading photo submission %d: %v", id, err)
+		return PhotoSubmission{}, err
+	}
+	if !graded {
+		return PhotoSubmission{}, ErrPhotoGraded
+	}
+	log.Printf("Photo submission %d is now %s with %d points", id, status, points)
+	return us.GetPhotoSubmission(ctx, id)
+}
+
+// GetPhotoFile returns the submission of the photo stored under key, or
+// ErrPhotoNotFound
+func (us *UserService) GetPhotoFile(ctx context.Context, key string) (PhotoSubmission, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	p, err := us.Repo.GetPhotoSubmissionByPath(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PhotoSubmission{}, ErrPhotoNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching photo %s: %v", key, err)
+		return PhotoSubmission{}, err
+	}
+	return p, nil
+}
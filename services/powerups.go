@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+type TeamPowerUp = repository.TeamPowerUp
+
+// Power-up kinds
+const (
+	PowerUpExtraAttempt  = "extra_attempt"
+	PowerUpLockExtension = "lock_extension"
+	PowerUpPenaltyShield = "penalty_shield"
+)
+
+// LockExtension is how much longer a lock extension holds a question for
+// the team
+const LockExtension = 10 * time.Minute
+
+var (
+	ErrUnknownPowerUp     = errors.New("unknown power-up")
+	ErrPowerUpUnavailable = errors.New("this power-up is not for sale")
+	ErrPowerUpLimit       = errors.New("your team can't buy any more of this power-up")
+	ErrCantAffordPowerUp  = errors.New("not enough points to buy this power-up")
+	ErrNoPowerUp          = errors.New("your team has none of this power-up left")
+	ErrNoLockToExtend     = errors.New("your team isn't holding this question")
+	ErrInvalidPowerUp     = errors.New("prices and limits can't be negative")
+)
+
+// PowerUp is an item of the store. Teams pay Price points for one, and
+// may buy MaxPerTeam of it at most, without a limit when it is zero
+type PowerUp struct {
+	Kind        string `json:"kind"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+	Price       int    `json:"price"`
+	MaxPerTeam  int    `json:"max_per_team"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// powerUps lists every power-up as sold until an admin configures it; the
+// store is closed until then
+var powerUps = []PowerUp{
+	{Kind: PowerUpExtraAttempt, Name: "Extra Attempt", Description: "One more wrong answer allowed on a question", Icon: "🎯", Price: 100},
+	{Kind: PowerUpLockExtension, Name: "Lock Extension", Description: "Hold a question you have open for 10 more minutes", Icon: "🔒", Price: 150},
+	{Kind: PowerUpPenaltyShield, Name: "Penalty Shield", Description: "Your next penalty on a question is waived", Icon: "🛡️", Price: 75},
+}
+
+// LookupPowerUp returns the name, description and icon of a power-up
+func LookupPowerUp(kind string) (PowerUp, bool) {
+	for _, p := range powerUps {
+		if p.Kind == kind {
+			return p, true
+		}
+	}
+	return PowerUp{}, false
+}
+
+// GetPowerUps returns every power-up with what an admin set for it
+func (us *UserService) GetPowerUps(ctx context.Context) ([]PowerUp, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	configs, err := us.Repo.ListPowerUpConfigs(ctx)
+	if err != nil {
+		log.Printf("Error listing power-ups: %v", err)
+		return nil, err
+	}
+	items := make([]PowerUp, len(powerUps))
+	copy(items, powerUps)
+	for _, c := range configs {
+		for i := range items {
+			if items[i].Kind == c.Kind {
+				items[i].Price = c.Price
+				items[i].MaxPerTeam = c.MaxPerTeam
+				items[i].Enabled = c.Enabled
+			}
+		}
+	}
+	return items, nil
+}
+
+// getPowerUp returns a power-up with what an admin set for it
+func (us *UserService) getPowerUp(ctx context.Context, kind string) (PowerUp, error) {
+	items, err := us.GetPowerUps(ctx)
+	if err != nil {
+		return PowerUp{}, err
+	}
+	for _, p := range items {
+		if p.Kind == kind {
+			return p, nil
+		}
+	}
+	return PowerUp{}, ErrUnknownPowerUp
+}
+
+// SetPowerUp sets the price, limit and availability of a power-up
+func (us *UserService) SetPowerUp(ctx context.Context, p PowerUp) error {
+	if _, err := us.getPowerUp(ctx, p.Kind); err != nil {
+		return err
+	}
+	if p.Price < 0 || p.MaxPerTeam < 0 {
+		return ErrInvalidPowerUp
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	err := us.Repo.SavePowerUpConfig(ctx, repository.PowerUpConfig{Kind: p.Kind, Price: p.Price, MaxPerTeam: p.MaxPerTeam, Enabled: p.Enabled})
+	if err != nil {
+		log.Printf("Error saving power-up %s: %v", p.Kind, err)
+		return err
+	}
+	log.Printf("Power-up %s set to %d points, %d per team, enabled %t", p.Kind, p.Price, p.MaxPerTeam, p.Enabled)
+	return nil
+}
+
+// StoreItem is a power-up as a team sees it in the store: how many it
+// bought and how many of those are left to use
+type StoreItem struct {
+	PowerUp
+	Bought int `json:"bought"`
+	Owned  int `json:"owned"`
+}
+
+// GetStore returns the power-ups on sale and those a team still has, with
+// every power-up the team bought, newest first
+func (us *UserService) GetStore(ctx context.Context, teamID int) ([]StoreItem, []TeamPowerUp, error) {
+	items, err := us.GetPowerUps(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	bought, err := us.Repo.ListTeamPowerUps(ctx, teamID)
+	if err != nil {
+		log.Printf("Error listing power-ups of team %d: %v", teamID, err)
+		return nil, nil, err
+	}
+	store := make([]StoreItem, 0, len(items))
+	for _, p := range items {
+		item := StoreItem{PowerUp: p}
+		for _, b := range bought {
+			if b.Kind == p.Kind {
+				item.Bought++
+				if b.UsedAt == nil {
+					item.Owned++
+				}
+			}
+		}
+		if p.Enabled || item.Owned > 0 {
+			store = append(store, item)
+		}
+	}
+	if bought == nil {
+		bought = make([]TeamPowerUp, 0)
+	}
+	return store, bought, nil
+}
+
+// BuyPowerUp sells a team a power-up for its price in points
+func (us *UserService) BuyPowerUp(ctx context.Context, teamID int, kind string) (PowerUp, error) {
+	p, err := us.getPowerUp(ctx, kind)
+	if err != nil {
+		return p, err
+	}
+	if !p.Enabled {
+		return p, ErrPowerUpUnavailable
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting purchase of %s by team %d: %v", kind, teamID, err)
+		return p, err
+	}
+	defer tx.Rollback()
+	q := us.Repo.WithTx(tx)
+
+	if p.MaxPerTeam > 0 {
+		n, err := q.CountTeamPowerUps(ctx, teamID, kind)
+		if err != nil {
+			log.Printf("Error counting power-ups of team %d: %v", teamID, err)
+			return p, err
+		}
+		if n >= p.MaxPerTeam {
+			return p, ErrPowerUpLimit
+		}
+	}
+
+	paid, err := q.SpendTeamPoints(ctx, teamID, p.Price)
+	if err != nil {
+		log.Printf("Error charging team %d for %s: %v", teamID, kind, err)
+		return p, err
+	}
+	if !paid {
+		return p, ErrCantAffordPowerUp
+	}
+	if err := q.CreateTeamPowerUp(ctx, teamID, kind, p.Price, time.Now()); err != nil {
+		log.Printf("Error recording %s bought by team %d: %v", kind, teamID, err)
+		return p, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing purchase of %s by team %d: %v", kind, teamID, err)
+		return p, err
+	}
+	log.Printf("Team %d bought %s for %d points", teamID, kind, p.Price)
+	return p, nil
+}
+
+// UsePowerUp spends one of a team's power-ups on a question it hasn't
+// solved. A lock extension needs the team to hold the question
+func (us *UserService) UsePowerUp(ctx context.Context, teamID int, kind string, questionID int) error {
+	if _, err := us.getPowerUp(ctx, kind); err != nil {
+		return err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting use of %s by team %d: %v", kind, teamID, err)
+		return err
+	}
+	defer tx.Rollback()
+	q := us.Repo.WithTx(tx)
+
+	solved, err := q.IsCompleted(ctx, teamID, questionID)
+	if err != nil {
+		log.Printf("Error checking solve of question %d by team %d: %v", questionID, teamID, err)
+		return err
+	}
+	if solved {
+		return ErrAlreadySolved
+	}
+
+	now := time.Now()
+	used, err := q.UseTeamPowerUp(ctx, teamID, kind, questionID, now)
+	if err != nil {
+		log.Printf("Error using %s of team %d: %v", kind, teamID, err)
+		return err
+	}
+	if !used {
+		return ErrNoPowerUp
+	}
+
+	switch kind {
+	case PowerUpExtraAttempt:
+		err = q.AddExtraAttempt(ctx, teamID, questionID, now)
+	case PowerUpPenaltyShield:
+		err = q.AddShield(ctx, teamID, questionID, now)
+	case PowerUpLockExtension:
+		err = us.extendLock(ctx, q, teamID, questionID)
+	}
+	if err != nil {
+		if !errors.Is(err, ErrNoLockToExtend) {
+			log.Printf("Error applying %s to question %d for team %d: %v", kind, questionID, teamID, err)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing use of %s by team %d: %v", kind, teamID, err)
+		return err
+	}
+	log.Printf("Team %d used %s on question %d", teamID, kind, questionID)
+	return nil
+}
+
+// extendLock holds the question the team has locked for LockExtension
+// longer
+func (us *UserService) extendLock(ctx context.Context, q *repository.Queries, teamID, questionID int) error {
+	cutoff := us.lockCutoff()
+	lock, err := q.GetLock(ctx, questionID, cutoff)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoLockToExtend
+	}
+	if err != nil {
+		return err
+	}
+	if lock.LockedByTeamID != teamID {
+		return ErrNoLockToExtend
+	}
+	extended, err := q.ExtendLock(ctx, questionID, teamID, lock.LockedAt.Add(LockExtension), cutoff)
+	if err != nil {
+		return err
+	}
+	if !extended {
+		return ErrNoLockToExtend
+	}
+	return nil
+}
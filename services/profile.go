@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Parts of a team's profile
+type (
+	TeamSolve       = repository.TeamSolve
+	UnlockedHint    = repository.UnlockedHint
+	QuestionPenalty = repository.QuestionPenalty
+)
+
+// TeamProfile is a team's standing in its hunt with its solves in order,
+// the streak bonuses they earned, the hints it bought and the penalties it
+// took
+type TeamProfile struct {
+	Name      string            `json:"name"`
+	Avatar    string            `json:"avatar,omitempty"`
+	HuntID    int               `json:"hunt_id"`
+	Rank      int               `json:"rank"`
+	Points    int               `json:"points"`
+	Penalty   int               `json:"penalty"`
+	NetScore  int               `json:"net_score"`
+	HintCost  int               `json:"hint_cost"`
+	Streak    int               `json:"streak"`
+	Bonus     int               `json:"bonus"`
+	Solves    []TeamSolve       `json:"solves"`
+	Hints     []UnlockedHint    `json:"hints"`
+	Penalties []QuestionPenalty `json:"penalties"`
+
+	Achievements []EarnedAchievement `json:"achievements"`
+}
+
+// GetTeamProfile returns a team's profile as viewer sees it. Teams left off
+// the leaderboard are only found by themselves
+func (us *UserService) GetTeamProfile(ctx context.Context, name, viewer string) (TeamProfile, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	team, err := us.Repo.GetTeamByName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TeamProfile{}, ErrTeamNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching team %s: %v", name, err)
+		return TeamProfile{}, err
+	}
+
+	board, err := us.leaderboard(ctx, team.HuntID, viewer)
+	if err != nil {
+		return TeamProfile{}, err
+	}
+	profile := TeamProfile{Name: team.Name, Avatar: AvatarURL(team.Avatar), HuntID: team.HuntID}
+	for i, entry := range board {
+		if entry.Username == team.Name {
+			profile.Rank = i + 1
+			profile.Points = entry.Points
+			profile.Penalty = entry.TotalPenalty
+			profile.NetScore = entry.NetScore
+		}
+	}
+	if profile.Rank == 0 {
+		return TeamProfile{}, ErrTeamNotFound
+	}
+
+	if profile.Solves, err = us.Repo.ListTeamSolves(ctx, team.ID); err != nil {
+		log.Printf("Error listing solves of team %d: %v", team.ID, err)
+		return TeamProfile{}, err
+	}
+	if profile.Hints, err = us.Repo.ListTeamHints(ctx, team.ID); err != nil {
+		log.Printf("Error listing hints of team %d: %v", team.ID, err)
+		return TeamProfile{}, err
+	}
+	if profile.Penalties, err = us.Repo.ListTeamPenalties(ctx, team.ID); err != nil {
+		log.Printf("Error listing penalties of team %d: %v", team.ID, err)
+		return TeamProfile{}, err
+	}
+	if profile.Achievements, err = us.GetTeamAchievements(ctx, team.ID); err != nil {
+		return TeamProfile{}, err
+	}
+	if profile.Streak, err = us.Repo.GetTeamStreak(ctx, team.ID); err != nil {
+		log.Printf("Error fetching streak of team %d: %v", team.ID, err)
+		return TeamProfile{}, err
+	}
+	for _, h := range profile.Hints {
+		profile.HintCost += h.Worth
+	}
+	for _, s := range profile.Solves {
+		profile.Bonus += s.Bonus
+	}
+	if profile.Solves == nil {
+		profile.Solves = make([]TeamSolve, 0)
+	}
+	if profile.Hints == nil {
+		profile.Hints = make([]UnlockedHint, 0)
+	}
+	if profile.Penalties == nil {
+		profile.Penalties = make([]QuestionPenalty, 0)
+	}
+	return profile, nil
+}
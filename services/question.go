@@ -2,25 +2,20 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"mime/multipart"
-	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
-	"github.com/google/uuid"
-	"github.com/minio/minio-go/v7"
 	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
-type Question struct {
-	ID       int    `json:"id"`
-	Question string `json:"question"`
-	Answer   string `json:"answer"`
-	Title    string `json:"title"`
-	Points   int    `json:"points"`
-}
+type Question = repository.Question
 
 type Image struct {
 	ID               int    `json:"id"`
@@ -40,30 +35,43 @@ type Audio struct {
 	ParentQuestionID int    `json:"parent_question_id"`
 }
 
+// MakeArray stores the files uploaded under label, one of images, videos,
+// audios or files, and returns their keys. Every file is validated before any
+// is stored, so a rejected file leaves nothing behind
 func (us *UserService) MakeArray(label string, form *multipart.Form, short string) (list []string, err error) {
-	// Check if MinIO is configured
-	if us.MinioClient == nil {
-		return list, fmt.Errorf("file upload is not available - MinIO is not configured")
-	}
-	
-	bucketName := os.Getenv("BUCKET_NAME")
 	files := form.File[label]
-	for _, file := range files {
+	contentTypes := make([]string, len(files))
+	for i, file := range files {
+		src, err := file.Open()
+		if err != nil {
+			return list, err
+		}
+		contentTypes[i], err = us.Uploads.ValidateUpload(label, file.Filename, file.Size, src)
+		src.Close()
+		if err != nil {
+			return list, err
+		}
+	}
+
+	for i, file := range files {
 		src, err := file.Open()
 		if err != nil {
 			return list, err
 		}
 		defer src.Close()
 
-		u := uuid.New().String()
-		filename := fmt.Sprintf("%s-%s%s", short, u, filepath.Ext(file.Filename))
+		filename := NewMediaKey(short, file.Filename)
 
-		_, err = us.MinioClient.PutObject(context.Background(), bucketName, filename, src, file.Size, minio.PutObjectOptions{ContentType: file.Header.Get("Content-Type")})
+		err = us.Storage.Put(context.Background(), filename, src, file.Size, contentTypes[i])
 		if err != nil {
-			return list, fmt.Errorf("failed to upload file to MinIO: %v", err)
+			return list, fmt.Errorf("failed to store uploaded file: %v", err)
 		}
 
-		fmt.Println(bucketName, filename)
+		if label == "images" {
+			if err := us.GenerateImageVariants(filename); err != nil {
+				log.Printf("Warning: Error resizing %s: %v", filename, err)
+			}
+		}
 
 		// Store only the filename, not the presigned URL
 		// URLs will be generated dynamically when needed
@@ -72,310 +80,267 @@ func (us *UserService) MakeArray(label string, form *multipart.Form, short strin
 	return list, nil
 }
 
-func (us *UserService) CreateMedia(ID int, images []string, videos []string, audios []string) error {
-
-	// Create images
-	for _, img := range images {
-		stmt := database.ConvertPlaceholders(`INSERT INTO images (path, parent_question_id) VALUES (?, ?)`)
-		_, err := us.UserStore.DB.Exec(stmt, img, ID)
-		if err != nil {
-			log.Printf("Error inserting image: %v", err)
-			return err
-		}
-	}
-
-	// Create audios
-	for _, audio := range audios {
-		stmt := database.ConvertPlaceholders(`INSERT INTO audios (path, parent_question_id) VALUES (?, ?)`)
-		_, err := us.UserStore.DB.Exec(stmt, audio, ID)
-		if err != nil {
-			log.Printf("Error inserting audio: %v", err)
-			return err
-		}
-	}
-
-	// Create videos
-	for _, video := range videos {
-		stmt := database.ConvertPlaceholders(`INSERT INTO videos (path, parent_question_id) VALUES (?, ?)`)
-		_, err := us.UserStore.DB.Exec(stmt, video, ID)
-		if err != nil {
-			log.Printf("Error inserting video: %v", err)
-			return err
+func (us *UserService) CreateMedia(ctx context.Context, ID int, images []string, videos []string, audios []string) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	for _, media := range []struct {
+		table string
+		keys  []string
+	}{{"images", images}, {"audios", audios}, {"videos", videos}} {
+		for _, key := range media.keys {
+			if err := us.Repo.AddMedia(ctx, media.table, ID, key); err != nil {
+				log.Printf("Error inserting %s: %v", strings.TrimSuffix(media.table, "s"), err)
+				return err
+			}
 		}
 	}
 
+	us.invalidateQuestion(ctx, ID)
 	return nil
 }
 
-func (us *UserService) CreateQuestion(q Question, images []string, videos []string, audios []string) error {
-	// Create a question and get its ID
-	stmt := database.ConvertPlaceholders(`INSERT INTO questions (question, answer, title, points) VALUES (?, ?, ?, ?) RETURNING id`)
+// CreateQuestion stores a question with its media and returns its ID
+func (us *UserService) CreateQuestion(ctx context.Context, q Question, images []string, videos []string, audios []string) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
 	ans, err := bcrypt.GenerateFromPassword([]byte(q.Answer), bcrypt.DefaultCost)
 	if err != nil {
 		log.Printf("Error hashing answer: %v", err)
-		return err
+		return 0, err
+	}
+	// The hash can't be shown after the hunt, so the answer as typed is
+	// kept for the reveal unless another one was given
+	if q.RevealAnswer == "" {
+		q.RevealAnswer = q.Answer
+	}
+	q.FlagTemplate = FlagTemplate(q.Answer)
+	q.Answer = string(ans)
+	if q.HuntID == 0 {
+		q.HuntID = DefaultHuntID
 	}
-	err = us.UserStore.DB.QueryRow(stmt, q.Question, string(ans), q.Title, q.Points).Scan(&q.ID)
+	if q.AnswerType == "" {
+		q.AnswerType = AnswerText
+	}
+	q.Category = NormalizeCategory(q.Category)
+	q.ID, err = us.Repo.CreateQuestion(ctx, q)
 	if err != nil {
 		log.Printf("Error inserting question: %v", err)
-		return err
+		return 0, err
 	}
 	log.Printf("Created question with ID: %d", q.ID)
 
-	us.CreateMedia(q.ID, images, videos, audios)
-
-	return nil
-}
-
-// Function to retrieve all questions
-func (us *UserService) GetAllQuestions() ([]Question, error) {
-
-	query := `SELECT id, title, points FROM questions ORDER BY points ASC`
-	questions := make([]Question, 0)
-
-	stmt, err := us.UserStore.DB.Prepare(query)
-	if err != nil {
-		return questions, err
+	if err := us.CreateMedia(ctx, q.ID, images, videos, audios); err != nil {
+		return q.ID, err
 	}
 
-	defer stmt.Close()
-
-	rows, err := stmt.Query()
-	if err != nil {
-		return questions, err
-	}
+	return q.ID, nil
+}
 
-	for rows.Next() {
-		var u Question
-		err := rows.Scan(&u.ID, &u.Title, &u.Points)
-		if err != nil {
-			return questions, err
-		}
+// Function to retrieve all questions of a hunt
+func (us *UserService) GetAllQuestions(ctx context.Context, huntID int) ([]Question, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
-		questions = append(questions, u)
+	questions, err := us.Repo.ListQuestions(ctx, huntID)
+	if questions == nil {
+		questions = make([]Question, 0)
 	}
-
-	return questions, nil
+	return questions, err
 }
 
-func (us *UserService) DeleteQuestion(id int) error {
+func (us *UserService) DeleteQuestion(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
 	log.Printf("Attempting to delete question with ID: %d", id)
-	
-	// First, delete all related records to avoid foreign key constraints
-	// Order matters: delete child records before parent
-	
-	// 1. Delete team_completed_questions
-	query := database.ConvertPlaceholders(`DELETE FROM team_completed_questions WHERE question_id = ?`)
-	_, err := us.UserStore.DB.Exec(query, id)
-	if err != nil {
-		log.Printf("Error deleting completed questions for question %d: %v", id, err)
-		return fmt.Errorf("failed to delete completed questions: %v", err)
-	}
-	
-	// 2. Delete question_locks
-	query = database.ConvertPlaceholders(`DELETE FROM question_locks WHERE question_id = ?`)
-	_, err = us.UserStore.DB.Exec(query, id)
-	if err != nil {
-		log.Printf("Error deleting locks for question %d: %v", id, err)
-		return fmt.Errorf("failed to delete question locks: %v", err)
-	}
-	
-	// 3. Delete question_timers
-	query = database.ConvertPlaceholders(`DELETE FROM question_timers WHERE question_id = ?`)
-	_, err = us.UserStore.DB.Exec(query, id)
-	if err != nil {
-		log.Printf("Error deleting timers for question %d: %v", id, err)
-		return fmt.Errorf("failed to delete question timers: %v", err)
-	}
-	
-	// 4. Delete question_attempts
-	query = database.ConvertPlaceholders(`DELETE FROM question_attempts WHERE question_id = ?`)
-	_, err = us.UserStore.DB.Exec(query, id)
+
+	// The stored objects are removed once the rows are gone
+	mediaKeys, err := us.getQuestionMediaKeys(ctx, id)
 	if err != nil {
-		log.Printf("Error deleting attempts for question %d: %v", id, err)
-		return fmt.Errorf("failed to delete question attempts: %v", err)
+		return fmt.Errorf("failed to list media: %v", err)
 	}
-	
-	// 5. Delete hints and hint unlocks
-	query = database.ConvertPlaceholders(`DELETE FROM team_hint_unlocked WHERE hint_id IN (SELECT id FROM hints WHERE parent_question_id = ?)`)
-	_, err = us.UserStore.DB.Exec(query, id)
+
+	// The question and everything referencing it go in one transaction,
+	// so a failure part way leaves the question whole
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Error deleting hint unlocks for question %d: %v", id, err)
-		return fmt.Errorf("failed to delete hint unlocks: %v", err)
-	}
-	
-	// 6. Delete media files (images, videos, audios)
-	mediaTables := []string{"images", "audios", "videos", "hints"}
-	for _, table := range mediaTables {
-		query = database.ConvertPlaceholders(fmt.Sprintf(`DELETE FROM %s WHERE parent_question_id = ?`, table))
-		_, err = us.UserStore.DB.Exec(query, id)
-		if err != nil {
-			log.Printf("Error deleting %s for question %d: %v", table, id, err)
-			return fmt.Errorf("failed to delete %s: %v", table, err)
-		}
+		log.Printf("Error starting deletion of question %d: %v", id, err)
+		return err
 	}
-	
-	// 7. Finally, delete the question itself
-	query = database.ConvertPlaceholders(`DELETE FROM questions WHERE id = ?`)
-	result, err := us.UserStore.DB.Exec(query, id)
+	defer tx.Rollback()
+
+	found, err := us.Repo.WithTx(tx).DeleteQuestion(ctx, id)
 	if err != nil {
 		log.Printf("Error deleting question %d: %v", id, err)
-		return fmt.Errorf("failed to delete question: %v", err)
+		return err
 	}
-	
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	if !found {
 		log.Printf("Question %d not found", id)
 		return fmt.Errorf("question not found")
 	}
-	
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing deletion of question %d: %v", id, err)
+		return err
+	}
+
+	us.invalidateQuestion(ctx, id)
+	us.deleteMediaObjects(mediaKeys)
+
 	log.Printf("Successfully deleted question %d and all related records", id)
 	return nil
 }
 
-func (us *UserService) DeleteMedia(id int, table string) error {
-	query := database.ConvertPlaceholders(fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, table))
-	stmt, err := us.UserStore.DB.Prepare(query)
+// DeleteMedia removes a media row and the object stored for it
+func (us *UserService) DeleteMedia(ctx context.Context, id int, table string) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	m, err := us.Repo.GetMedia(ctx, table, id)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
 		return err
 	}
 
-	defer stmt.Close()
-
-	stmt.Exec(id)
+	if err := us.Repo.DeleteMedia(ctx, table, id); err != nil {
+		return err
+	}
 
+	us.invalidateQuestion(ctx, m.QuestionID)
+	us.deleteMediaObjects([]string{m.Path})
 	return nil
 }
 
 // get id by path
-func (us *UserService) GetIdByPath(path string, table string) (int, error) {
-	query := database.ConvertPlaceholders(fmt.Sprintf(`SELECT id FROM %s WHERE path = ?`, table))
-	var id int
-	err := us.UserStore.DB.QueryRow(query, path).Scan(&id)
+func (us *UserService) GetIdByPath(ctx context.Context, path string, table string) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	m, err := us.Repo.GetMediaByPath(ctx, table, path)
 	if err != nil {
 		return 0, err
 	}
 
-	return id, nil
+	return m.ID, nil
 }
 
-func (us *UserService) GetQuestionById(id int) (Question, error) {
-	var q Question
-
-	query := database.ConvertPlaceholders(`SELECT id, question, answer, title, points FROM questions WHERE id = ?`)
-
-	err := us.UserStore.DB.QueryRow(query, id).Scan(&q.ID, &q.Question, &q.Answer, &q.Title, &q.Points)
+func (us *UserService) GetQuestionById(ctx context.Context, id int) (Question, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
+	content, err := us.questionContent(ctx, id)
 	if err != nil {
-		log.Printf("Error querying question with ID %d: %v", id, err)
 		return Question{}, err
 	}
 
-	log.Printf("Successfully retrieved question with ID: %d", id)
-	return q, nil
+	return content.Question, nil
 }
 
-func (us *UserService) GetMedia(query string, args ...interface{}) ([]string, error) {
-	media := make([]string, 0)
-	stmt, err := us.UserStore.DB.Prepare(query)
-	if err != nil {
-		return media, err
-	}
+// MaxCaptionLength bounds a media caption, which doubles as an image's alt text
+const MaxCaptionLength = 300
 
-	defer stmt.Close()
+// UpdateMediaDetails sets the position and caption of one of a question's
+// media rows
+func (us *UserService) UpdateMediaDetails(ctx context.Context, table string, questionID, id, position int, caption string) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
-	rows, err := stmt.Query(args...)
-	if err != nil {
-		return media, err
+	if _, ok := mediaPrefixes[table]; !ok {
+		return ErrUnknownMediaKind
 	}
-
-	bucketName := os.Getenv("BUCKET_NAME")
-	endpoint := os.Getenv("BUCKET_ENDPOINT")
-	useSSL := os.Getenv("BUCKET_USE_SSL") == "true"
-	
-	protocol := "http"
-	if useSSL {
-		protocol = "https"
+	caption = strings.TrimSpace(caption)
+	if utf8.RuneCountInString(caption) > MaxCaptionLength {
+		return fmt.Errorf("caption is longer than %d characters", MaxCaptionLength)
 	}
 
-	for rows.Next() {
-		var filename string
-		err := rows.Scan(&filename)
-		if err != nil {
-			return media, err
-		}
-
-		// Generate direct public URL if MinIO is configured
-		if us.MinioClient != nil && endpoint != "" && bucketName != "" {
-			// Use direct URL since bucket is public
-			directURL := fmt.Sprintf("%s://%s/%s/%s", protocol, endpoint, bucketName, filename)
-			media = append(media, directURL)
-		} else {
-			// If MinIO not configured, just return the filename
-			media = append(media, filename)
-		}
+	if err := us.Repo.UpdateMedia(ctx, table, questionID, id, position, caption); err != nil {
+		log.Printf("Error updating %s %d: %v", table, id, err)
+		return err
 	}
-
-	return media, nil
+	us.invalidateQuestion(ctx, questionID)
+	return nil
 }
 
-func (us *UserService) UpdateQuestion(id int, title string, question string, points int, answer string) error {
-	query := database.ConvertPlaceholders(`UPDATE questions
-              SET title = ?, question = ?, points = ?, answer = ?
-              WHERE id = ?`)
+func (us *UserService) UpdateQuestion(ctx context.Context, id int, title string, question string, points int, answer string, revealAnswer string, solution string, flagTemplate string, cooldown int, answerType string, category string) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
-	// Execute the update statement
-	_, err := us.UserStore.DB.Exec(query, title, question, points, answer, id)
+	err := us.Repo.UpdateQuestion(ctx, Question{ID: id, Title: title, Question: question, Points: points, Answer: answer, RevealAnswer: revealAnswer, Solution: solution, FlagTemplate: flagTemplate, Cooldown: cooldown, AnswerType: answerType, Category: category})
 	if err != nil {
 		log.Printf("Error updating question with ID %d: %v", id, err)
 		return err
 	}
+	us.invalidateQuestion(ctx, id)
 
 	log.Printf("Update operation completed for question with ID: %d", id)
 	return nil
 }
 
 // make a function that takes questions id and returns all the media associated with it
-func (us *UserService) GetMediaByQuestionId(id int) (map[string][]string, error) {
-	m := make(map[string][]string)
+func (us *UserService) GetMediaByQuestionId(ctx context.Context, id int) (map[string][]string, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
-	stmt := database.ConvertPlaceholders(`SELECT path FROM images WHERE parent_question_id = ?`)
-	images, err := us.GetMedia(stmt, id)
+	content, err := us.questionContent(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	m["images"] = images
+	return content.Media, nil
+}
 
-	stmt = database.ConvertPlaceholders(`SELECT path FROM videos WHERE parent_question_id = ?`)
-	videos, err := us.GetMedia(stmt, id)
-	if err != nil {
-		return nil, err
+// GetMediaForQuestions returns the media of several questions, keyed by
+// question ID, with one query per media table however many questions
+// there are. Every question gets a map, even one without media
+func (us *UserService) GetMediaForQuestions(ctx context.Context, ids []int) (map[int]map[string][]string, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	// images, videos and audios hold URLs, with their captions in
+	// cimages, cvideos and caudios and their row IDs in limages, lvideos
+	// and laudios. files, filenames, cfiles and lfiles are parallel: a
+	// download URL, the name to show, its caption and its row ID
+	out := make(map[int]map[string][]string, len(ids))
+	for _, id := range ids {
+		m := make(map[string][]string)
+		for _, table := range repository.MediaTables {
+			m[table] = make([]string, 0)
+			m["c"+table] = make([]string, 0)
+			m["l"+table] = make([]string, 0)
+		}
+		m["filenames"] = make([]string, 0)
+		out[id] = m
 	}
 
-	m["videos"] = videos
-
-	stmt = database.ConvertPlaceholders(`SELECT path FROM audios WHERE parent_question_id = ?`)
-	audios, err := us.GetMedia(stmt, id)
-	if err != nil {
-		return nil, err
+	for _, table := range repository.MediaTables {
+		media, err := us.Repo.ListMediaForQuestions(ctx, table, ids)
+		if err != nil {
+			log.Printf("Error getting %s of questions %v: %v", table, ids, err)
+			return nil, err
+		}
+		for _, r := range media {
+			m := out[r.QuestionID]
+			m[table] = append(m[table], us.MediaURL(r.Path))
+			m["c"+table] = append(m["c"+table], r.Caption)
+			m["l"+table] = append(m["l"+table], strconv.Itoa(r.ID))
+			if table == "files" {
+				m["filenames"] = append(m["filenames"], r.Name)
+			}
+		}
 	}
 
-	m["audios"] = audios
-
-	return m, nil
+	return out, nil
 }
 
-func (us *UserService) AddPointsToTeam(teamID int, points int) error {
-	query := database.ConvertPlaceholders(`
-    UPDATE teams
-    SET points = points + ?
-    WHERE id = ?
-    `)
+func (us *UserService) AddPointsToTeam(ctx context.Context, teamID int, points int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
-	// Execute the update
-	_, err := us.UserStore.DB.Exec(query, points, teamID)
-	if err != nil {
+	if err := us.Repo.AddTeamPoints(ctx, teamID, points); err != nil {
 		log.Printf("Error adding points to team %d: %v", teamID, err)
 		return err
 	}
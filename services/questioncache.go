@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/namishh/holmes/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultQuestionCacheTTL bounds how long a cached question can outlive
+// an edit the cache didn't hear about, such as one made on another
+// instance using the in-memory cache
+const DefaultQuestionCacheTTL = 5 * time.Minute
+
+// QuestionContent is what teams see of a question. It only changes when an
+// admin edits the question, its media or its hints, so it is cached
+type QuestionContent struct {
+	Question Question            `json:"question"`
+	Media    map[string][]string `json:"media"`
+	Hints    []Hint              `json:"hints"`
+}
+
+// QuestionCache holds QuestionContent keyed by question ID. Content handed
+// out by Get is shared and must not be modified
+type QuestionCache interface {
+	Get(ctx context.Context, id int) (QuestionContent, bool)
+	Set(ctx context.Context, id int, content QuestionContent)
+	Delete(ctx context.Context, id int)
+}
+
+// QuestionCacheConfig selects and configures the question cache
+type QuestionCacheConfig struct {
+	// Backend is "memory", "redis" or "none"; empty picks redis when
+	// RedisAddr is set and memory otherwise
+	Backend string
+
+	// TTL is how long an entry is served, default DefaultQuestionCacheTTL
+	TTL time.Duration
+
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+}
+
+// NewQuestionCache returns the configured cache, or nil when caching is off.
+// Several instances should share Redis so an edit reaches all of them
+func NewQuestionCache(cfg QuestionCacheConfig) QuestionCache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultQuestionCacheTTL
+	}
+
+	backend := cfg.Backend
+	if backend == "" {
+		backend = "memory"
+		if cfg.RedisAddr != "" {
+			backend = "redis"
+		}
+	}
+
+	switch backend {
+	case "memory":
+		log.Printf("Caching question content in memory for %s", cfg.TTL)
+		return NewMemoryQuestionCache(cfg.TTL)
+	case "redis":
+		cache, err := NewRedisQuestionCache(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, cfg.TTL)
+		if err != nil {
+			log.Printf("Warning: Redis connection failed: %v. Caching question content in memory.", err)
+			return NewMemoryQuestionCache(cfg.TTL)
+		}
+		log.Printf("Caching question content in Redis for %s", cfg.TTL)
+		return cache
+	case "none":
+		return nil
+	default:
+		log.Printf("Warning: Unknown question cache %q. Question content will not be cached.", backend)
+		return nil
+	}
+}
+
+type cachedQuestion struct {
+	content QuestionContent
+	expires time.Time
+}
+
+// MemoryQuestionCache keeps question content in this process
+type MemoryQuestionCache struct {
+	mu      sync.RWMutex
+	entries map[int]cachedQuestion
+	ttl     time.Duration
+}
+
+// NewMemoryQuestionCache creates an empty in-memory cache
+func NewMemoryQuestionCache(ttl time.Duration) *MemoryQuestionCache {
+	return &MemoryQuestionCache{entries: make(map[int]cachedQuestion), ttl: ttl}
+}
+
+// Get returns a question's content unless it is missing or expired
+func (mc *MemoryQuestionCache) Get(ctx context.Context, id int) (QuestionContent, bool) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+
+	e, ok := mc.entries[id]
+	if !ok || time.Now().After(e.expires) {
+		return QuestionContent{}, false
+	}
+	return e.content, true
+}
+
+// Set stores a question's content. There are only as many entries as
+// questions, so expired ones are simply overwritten
+func (mc *MemoryQuestionCache) Set(ctx context.Context, id int, content QuestionContent) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.entries[id] = cachedQuestion{content: content, expires: time.Now().Add(mc.ttl)}
+}
+
+// Delete drops a question's content
+func (mc *MemoryQuestionCache) Delete(ctx context.Context, id int) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	delete(mc.entries, id)
+}
+
+// RedisQuestionCache keeps question content in Redis as JSON, shared by
+// every instance
+type RedisQuestionCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisQuestionCache connects to Redis and verifies the connection
+func NewRedisQuestionCache(addr, password string, db int, ttl time.Duration) (*RedisQuestionCache, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisQuestionCache{client: client, ttl: ttl}, nil
+}
+
+// questionCacheKey is versioned so entries cached before questions had a
+// hunt and a solution are never read back
+func questionCacheKey(id int) string {
+	return "holmes:question:v5:" + strconv.Itoa(id)
+}
+
+// Get returns a question's content. Redis errors count as a miss so the
+// database is used instead
+func (rc *RedisQuestionCache) Get(ctx context.Context, id int) (QuestionContent, bool) {
+	var content QuestionContent
+	data, err := rc.client.Get(ctx, questionCacheKey(id)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Error reading question %d from cache: %v", id, err)
+		}
+		return content, false
+	}
+	if err := json.Unmarshal(data, &content); err != nil {
+		log.Printf("Error decoding cached question %d: %v", id, err)
+		return content, false
+	}
+	return content, true
+}
+
+// Set stores a question's content
+func (rc *RedisQuestionCache) Set(ctx context.Context, id int, content QuestionContent) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		log.Printf("Error encoding question %d for cache: %v", id, err)
+		return
+	}
+	if err := rc.client.Set(ctx, questionCacheKey(id), data, rc.ttl).Err(); err != nil {
+		log.Printf("Error caching question %d: %v", id, err)
+	}
+}
+
+// Ping checks the connection to Redis
+func (rc *RedisQuestionCache) Ping(ctx context.Context) error {
+	return rc.client.Ping(ctx).Err()
+}
+
+// Delete drops a question's content
+func (rc *RedisQuestionCache) Delete(ctx context.Context, id int) {
+	if err := rc.client.Del(ctx, questionCacheKey(id)).Err(); err != nil {
+		log.Printf("Error removing question %d from cache: %v", id, err)
+	}
+}
+
+// questionContent returns a question's content, reading through the cache.
+// An edit that lands between the read and the Set is only picked up when
+// the entry expires
+func (us *UserService) questionContent(ctx context.Context, id int) (QuestionContent, error) {
+	if us.Cache != nil {
+		if content, ok := us.Cache.Get(ctx, id); ok {
+			return content, nil
+		}
+	}
+
+	var content QuestionContent
+	var err error
+	content.Question, err = us.Repo.GetQuestion(ctx, id)
+	if err != nil {
+		log.Printf("Error querying question with ID %d: %v", id, err)
+		return content, err
+	}
+
+	media, err := us.GetMediaForQuestions(ctx, []int{id})
+	if err != nil {
+		return content, err
+	}
+	// Row IDs are only needed by the edit form, which reads them directly
+	content.Media = media[id]
+	for _, table := range repository.MediaTables {
+		delete(content.Media, "l"+table)
+	}
+
+	content.Hints, err = us.Repo.ListQuestionHints(ctx, id)
+	if err != nil {
+		log.Printf("Error querying hints for question ID %d: %v", id, err)
+		return content, err
+	}
+
+	if us.Cache != nil {
+		us.Cache.Set(ctx, id, content)
+	}
+	return content, nil
+}
+
+// invalidateQuestion drops a question's cached content after an edit
+func (us *UserService) invalidateQuestion(ctx context.Context, id int) {
+	if us.Cache != nil {
+		us.Cache.Delete(ctx, id)
+	}
+}
@@ -1,121 +1,151 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"time"
 
 	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
 )
 
 const (
-	QuotaLimit       = 10                // 10 questions per slot
-	SlotDuration     = 10 * time.Hour    // 10 hours per slot
+	DefaultQuotaLimit   = 10             // 10 questions per slot
+	DefaultSlotDuration = 10 * time.Hour // 10 hours per slot
 )
 
-type QuotaSlot struct {
-	TeamID              int       `json:"team_id"`
-	CurrentSlotStart    time.Time `json:"current_slot_start"`
-	QuestionsSolvedInSlot int     `json:"questions_solved_in_slot"`
-}
+// QuotaLimit and SlotDuration are the quota in force; main sets them from
+// the config
+var (
+	QuotaLimit   = DefaultQuotaLimit
+	SlotDuration = DefaultSlotDuration
+)
+
+type QuotaSlot = repository.QuotaSlot
 
 // GetQuotaSlot retrieves the current quota slot for a team
-func (us *UserService) GetQuotaSlot(teamID int) (*QuotaSlot, error) {
-	query := database.ConvertPlaceholders(`SELECT team_id, current_slot_start, questions_solved_in_slot 
-			  FROM team_quota_slots 
-			  WHERE team_id = ?`)
-	
-	var slot QuotaSlot
-	err := us.UserStore.DB.QueryRow(query, teamID).Scan(
-		&slot.TeamID,
-		&slot.CurrentSlotStart,
-		&slot.QuestionsSolvedInSlot,
-	)
-	
+func (us *UserService) GetQuotaSlot(ctx context.Context, teamID int) (*QuotaSlot, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	slot, err := us.Repo.GetQuotaSlot(ctx, teamID)
 	if err == sql.ErrNoRows {
 		// No slot exists, create a new one
-		return us.CreateQuotaSlot(teamID)
+		return us.CreateQuotaSlot(ctx, teamID)
 	}
-	
+
 	if err != nil {
 		log.Printf("Error getting quota slot for team %d: %v", teamID, err)
 		return nil, err
 	}
-	
-	// Check if the current slot has expired (10 hours passed)
+
+	// Check if the current slot has expired
 	if time.Since(slot.CurrentSlotStart) >= SlotDuration {
 		// Reset the slot
-		return us.ResetQuotaSlot(teamID)
+		return us.ResetQuotaSlot(ctx, teamID)
 	}
-	
+
 	return &slot, nil
 }
 
 // CreateQuotaSlot creates a new quota slot for a team
-func (us *UserService) CreateQuotaSlot(teamID int) (*QuotaSlot, error) {
-	now := time.Now()
-	query := database.ConvertPlaceholders(`INSERT INTO team_quota_slots (team_id, current_slot_start, questions_solved_in_slot)
-			  VALUES (?, ?, 0)`)
-	
-	_, err := us.UserStore.DB.Exec(query, teamID, now)
-	if err != nil {
+func (us *UserService) CreateQuotaSlot(ctx context.Context, teamID int) (*QuotaSlot, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	now := us.slotStart(ctx, teamID, time.Now())
+	if err := us.Repo.CreateQuotaSlot(ctx, teamID, now); err != nil {
 		log.Printf("Error creating quota slot for team %d: %v", teamID, err)
 		return nil, err
 	}
-	
+
 	return &QuotaSlot{
-		TeamID:              teamID,
-		CurrentSlotStart:    now,
+		TeamID:                teamID,
+		CurrentSlotStart:      now,
 		QuestionsSolvedInSlot: 0,
 	}, nil
 }
 
 // ResetQuotaSlot resets the quota slot for a team (starts a new 10-hour window)
-func (us *UserService) ResetQuotaSlot(teamID int) (*QuotaSlot, error) {
-	now := time.Now()
-	query := database.ConvertPlaceholders(`UPDATE team_quota_slots 
-			  SET current_slot_start = ?, questions_solved_in_slot = 0 
-			  WHERE team_id = ?`)
-	
-	_, err := us.UserStore.DB.Exec(query, now, teamID)
-	if err != nil {
+func (us *UserService) ResetQuotaSlot(ctx context.Context, teamID int) (*QuotaSlot, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	now := us.slotStart(ctx, teamID, time.Now())
+	if err := us.Repo.ResetQuotaSlot(ctx, teamID, now); err != nil {
 		log.Printf("Error resetting quota slot for team %d: %v", teamID, err)
 		return nil, err
 	}
-	
+
 	log.Printf("Reset quota slot for team %d at %v", teamID, now)
 	return &QuotaSlot{
-		TeamID:              teamID,
-		CurrentSlotStart:    now,
+		TeamID:                teamID,
+		CurrentSlotStart:      now,
 		QuestionsSolvedInSlot: 0,
 	}, nil
 }
 
-// IncrementQuotaCount increments the questions solved count in the current slot
-func (us *UserService) IncrementQuotaCount(teamID int) error {
-	query := database.ConvertPlaceholders(`UPDATE team_quota_slots 
-			  SET questions_solved_in_slot = questions_solved_in_slot + 1 
-			  WHERE team_id = ?`)
-	
-	_, err := us.UserStore.DB.Exec(query, teamID)
+// slotStart returns when the quota window holding now began. Teams on
+// their own clocks count windows from their own start, anyone else from now
+func (us *UserService) slotStart(ctx context.Context, teamID int, now time.Time) time.Time {
+	if us.teamHuntWindow(ctx, teamID).TeamDuration <= 0 {
+		return now
+	}
+	start, err := us.Repo.GetTeamStart(ctx, teamID)
+	if err != nil || !start.Valid || start.Time.After(now) {
+		return now
+	}
+	return start.Time.Add(now.Sub(start.Time).Truncate(SlotDuration))
+}
+
+// ResetExhaustedQuotaSlots starts a new window for every team that used up
+// its quota in a window that has now expired, returning the teams it reset
+// Other expired slots are still reset lazily by GetQuotaSlot
+func (us *UserService) ResetExhaustedQuotaSlots(ctx context.Context) ([]int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	teams, err := us.Repo.ListExhaustedQuotaTeams(ctx, QuotaLimit, time.Now().Add(-SlotDuration))
 	if err != nil {
+		log.Printf("Error finding exhausted quota slots: %v", err)
+		return nil, err
+	}
+
+	var reset []int
+	for _, teamID := range teams {
+		if _, err := us.ResetQuotaSlot(ctx, teamID); err != nil {
+			continue
+		}
+		reset = append(reset, teamID)
+	}
+
+	return reset, nil
+}
+
+// IncrementQuotaCount increments the questions solved count in the current slot
+func (us *UserService) IncrementQuotaCount(ctx context.Context, teamID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.IncrementQuota(ctx, teamID); err != nil {
 		log.Printf("Error incrementing quota count for team %d: %v", teamID, err)
 		return err
 	}
-	
+
 	log.Printf("Incremented quota count for team %d", teamID)
 	return nil
 }
 
 // CanSolveQuestion checks if a team can solve another question based on quota
-func (us *UserService) CanSolveQuestion(teamID int) (bool, *QuotaSlot, error) {
-	slot, err := us.GetQuotaSlot(teamID)
+func (us *UserService) CanSolveQuestion(ctx context.Context, teamID int) (bool, *QuotaSlot, error) {
+	slot, err := us.GetQuotaSlot(ctx, teamID)
 	if err != nil {
 		return false, nil, err
 	}
 	
 	// Check if quota is exhausted
-	if slot.QuestionsSolvedInSlot >= QuotaLimit {
+	if slot.QuestionsSolvedInSlot >= QuotaLimit && us.FlagEnabled(ctx, FlagQuotas) {
 		return false, slot, nil
 	}
 	
@@ -123,8 +153,8 @@ func (us *UserService) CanSolveQuestion(teamID int) (bool, *QuotaSlot, error) {
 }
 
 // GetTimeUntilQuotaReset returns the duration until the quota resets
-func (us *UserService) GetTimeUntilQuotaReset(teamID int) (time.Duration, error) {
-	slot, err := us.GetQuotaSlot(teamID)
+func (us *UserService) GetTimeUntilQuotaReset(ctx context.Context, teamID int) (time.Duration, error) {
+	slot, err := us.GetQuotaSlot(ctx, teamID)
 	if err != nil {
 		return 0, err
 	}
@@ -140,16 +170,16 @@ func (us *UserService) GetTimeUntilQuotaReset(teamID int) (time.Duration, error)
 }
 
 // GetActualCompletedQuestionsCount returns the actual number of questions completed by the team
-// This is different from QuestionsSolvedInSlot which is quota-based and resets every 10 hours
-func (us *UserService) GetActualCompletedQuestionsCount(teamID int) (int, error) {
-	query := database.ConvertPlaceholders(`SELECT COUNT(*) FROM team_completed_questions WHERE team_id = ?`)
-	
-	var count int
-	err := us.UserStore.DB.QueryRow(query, teamID).Scan(&count)
+// This is different from QuestionsSolvedInSlot which is quota-based and resets every SlotDuration
+func (us *UserService) GetActualCompletedQuestionsCount(ctx context.Context, teamID int) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	count, err := us.Repo.CountTeamCompletions(ctx, teamID)
 	if err != nil {
 		log.Printf("Error getting completed questions count for team %d: %v", teamID, err)
 		return 0, err
 	}
-	
+
 	return count, nil
 }
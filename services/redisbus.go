@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// eventStream is the Redis stream every instance appends events to
+	eventStream = "hunt_events"
+
+	// eventStreamMaxLen caps the stream so it doesn't grow forever;
+	// trimming is approximate for performance
+	eventStreamMaxLen = 10000
+)
+
+// RedisStreamBus is a MessageBus backed by a Redis Stream
+// Each instance reads through its own consumer group so every instance sees
+// every event, and the group's position survives restarts
+type RedisStreamBus struct {
+	client     *redis.Client
+	ctx        context.Context
+	cancel     context.CancelFunc
+	instanceID string
+}
+
+// ErrNoInstanceID is returned when the Redis bus has no instance ID to name
+// its consumer group after
+var ErrNoInstanceID = errors.New("the Redis event bus needs an instance ID that stays the same across restarts")
+
+// NewRedisStreamBus connects to Redis and verifies the connection;
+// instanceID names the consumer group, so an instance that restarts under
+// the same ID carries on from the last event it acknowledged
+func NewRedisStreamBus(addr string, password string, db int, instanceID string) (*RedisStreamBus, error) {
+	if instanceID == "" {
+		return nil, ErrNoInstanceID
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := client.Ping(ctx).Err(); err != nil {
+		cancel()
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisStreamBus{
+		client:     client,
+		ctx:        ctx,
+		cancel:     cancel,
+		instanceID: instanceID,
+	}, nil
+}
+
+// Publish appends an event to the Redis stream
+func (rb *RedisStreamBus) Publish(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return rb.client.XAdd(rb.ctx, &redis.XAddArgs{
+		Stream: eventStream,
+		MaxLen: eventStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"origin": rb.instanceID,
+			"event":  string(data),
+		},
+	}).Err()
+}
+
+// Subscribe creates this instance's consumer group and starts consuming
+func (rb *RedisStreamBus) Subscribe(handler func(Event)) error {
+	// "$" means a brand new group starts from events published from now on;
+	// an existing group keeps its last acknowledged position
+	err := rb.client.XGroupCreateMkStream(rb.ctx, eventStream, rb.consumerGroup(), "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	go rb.consume(handler)
+	return nil
+}
+
+// Close stops consuming and closes the Redis connection
+func (rb *RedisStreamBus) Close() error {
+	rb.cancel()
+	return rb.client.Close()
+}
+
+// Ping checks the connection to Redis
+func (rb *RedisStreamBus) Ping(ctx context.Context) error {
+	return rb.client.Ping(ctx).Err()
+}
+
+// consumerGroup is this instance's consumer group on the event stream
+func (rb *RedisStreamBus) consumerGroup() string {
+	return "holmes:" + rb.instanceID
+}
+
+// consume reads events from the Redis stream through this instance's
+// consumer group. Entries are acknowledged only after they have been handed
+// to the handler, so anything read but not acknowledged before a crash is
+// redelivered on the next start (at-least-once delivery)
+func (rb *RedisStreamBus) consume(handler func(Event)) {
+	group := rb.consumerGroup()
+
+	// Start with "0" to drain entries delivered to us before a restart but
+	// never acknowledged, then switch to ">" for new entries
+	lastID := "0"
+
+	for {
+		streams, err := rb.client.XReadGroup(rb.ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: rb.instanceID,
+			Streams:  []string{eventStream, lastID},
+			Count:    100,
+			Block:    5 * time.Second,
+		}).Result()
+
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if rb.ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error reading Redis event stream: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		received := 0
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				received++
+				rb.deliver(msg, handler)
+				if err := rb.client.XAck(rb.ctx, eventStream, group, msg.ID).Err(); err != nil {
+					log.Printf("Error acknowledging stream entry %s: %v", msg.ID, err)
+				}
+			}
+		}
+
+		// Pending backlog drained, move on to new entries
+		if lastID == "0" && received == 0 {
+			lastID = ">"
+		}
+	}
+}
+
+// deliver decodes a stream entry and hands it to the handler
+func (rb *RedisStreamBus) deliver(msg redis.XMessage, handler func(Event)) {
+	// Events this instance published were already delivered locally
+	if origin, _ := msg.Values["origin"].(string); origin == rb.instanceID {
+		return
+	}
+
+	payload, _ := msg.Values["event"].(string)
+	var event Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		log.Printf("Error unmarshaling Redis stream entry %s: %v", msg.ID, err)
+		return
+	}
+
+	handler(event)
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// testRedisDB keeps the test stream away from a development server's data
+const testRedisDB = 15
+
+// newTestRedisBus connects to the Redis server in HOLMES_TEST_REDIS_ADDR,
+// skipping the test when none is configured
+func newTestRedisBus(t *testing.T, instanceID string) *RedisStreamBus {
+	t.Helper()
+
+	addr := os.Getenv("HOLMES_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("HOLMES_TEST_REDIS_ADDR not set")
+	}
+
+	rb, err := NewRedisStreamBus(addr, "", testRedisDB, instanceID)
+	if err != nil {
+		t.Fatalf("NewRedisStreamBus: %v", err)
+	}
+	return rb
+}
+
+func TestRedisStreamBusRequiresInstanceID(t *testing.T) {
+	if _, err := NewRedisStreamBus("localhost:6379", "", testRedisDB, ""); err != ErrNoInstanceID {
+		t.Fatalf("got %v, want ErrNoInstanceID", err)
+	}
+}
+
+// An instance that restarts under the same ID must receive the events
+// published while it was down
+func TestRedisStreamBusRestartKeepsEvents(t *testing.T) {
+	first := newTestRedisBus(t, "restart")
+	if err := first.client.FlushDB(first.ctx).Err(); err != nil {
+		t.Fatalf("FlushDB: %v", err)
+	}
+	if err := first.Subscribe(func(Event) {}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	first.Close()
+
+	publisher := newTestRedisBus(t, "publisher")
+	defer publisher.Close()
+	if err := publisher.Publish(Event{Type: EventQuestionSolved, HuntID: 1, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	restarted := newTestRedisBus(t, "restart")
+	defer restarted.Close()
+
+	got := make(chan Event, 1)
+	if err := restarted.Subscribe(func(e Event) { got <- e }); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	select {
+	case e := <-got:
+		if e.Type != EventQuestionSolved || e.HuntID != 1 {
+			t.Fatalf("got %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event published while the instance was down was not delivered")
+	}
+}
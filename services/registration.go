@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/namishh/holmes/database"
+)
+
+// Settings that limit registration to some email domains, with single
+// addresses let in as exceptions; each holds one entry per line
+const (
+	SettingEmailDomains    = "email_domains"
+	SettingEmailExceptions = "email_exceptions"
+)
+
+var (
+	ErrInvalidEmailDomain    = errors.New("domains look like college.edu")
+	ErrInvalidEmailException = errors.New("exceptions are full email addresses")
+)
+
+// EmailPolicy is who may register: anyone when Domains is empty, otherwise
+// addresses at one of the domains or their subdomains, and the exceptions
+type EmailPolicy struct {
+	Domains    []string `json:"domains"`
+	Exceptions []string `json:"exceptions"`
+}
+
+// ParseEmailList splits a list of domains or addresses typed by an admin,
+// one per line or separated by commas or spaces
+func ParseEmailList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+}
+
+// normalizeDomains lowercases domains and drops a leading @ and repeats
+func normalizeDomains(domains []string) ([]string, error) {
+	seen := make(map[string]bool)
+	out := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "@")
+		if d == "" || seen[d] {
+			continue
+		}
+		if strings.ContainsAny(d, "@ /") || !strings.Contains(d, ".") || strings.HasPrefix(d, ".") || strings.HasSuffix(d, ".") {
+			return nil, ErrInvalidEmailDomain
+		}
+		seen[d] = true
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// normalizeExceptions lowercases addresses and drops repeats
+func normalizeExceptions(emails []string) ([]string, error) {
+	seen := make(map[string]bool)
+	out := make([]string, 0, len(emails))
+	for _, e := range emails {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" || seen[e] {
+			continue
+		}
+		if at := strings.LastIndex(e, "@"); at < 1 || at == len(e)-1 {
+			return nil, ErrInvalidEmailException
+		}
+		seen[e] = true
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// Allows reports whether an address may register
+func (p EmailPolicy) Allows(email string) bool {
+	if len(p.Domains) == 0 {
+		return true
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	for _, e := range p.Exceptions {
+		if e == email {
+			return true
+		}
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, d := range p.Domains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetEmailPolicy returns who may register
+func (us *UserService) GetEmailPolicy(ctx context.Context) EmailPolicy {
+	policy := EmailPolicy{Domains: []string{}, Exceptions: []string{}}
+	if value, ok, err := us.GetSetting(ctx, SettingEmailDomains); err == nil && ok && value != "" {
+		policy.Domains = strings.Split(value, "\n")
+	}
+	if value, ok, err := us.GetSetting(ctx, SettingEmailExceptions); err == nil && ok && value != "" {
+		policy.Exceptions = strings.Split(value, "\n")
+	}
+	return policy
+}
+
+// SetEmailPolicy stores who may register; no domains lets anyone in
+func (us *UserService) SetEmailPolicy(ctx context.Context, p EmailPolicy) (EmailPolicy, error) {
+	domains, err := normalizeDomains(p.Domains)
+	if err != nil {
+		return EmailPolicy{}, err
+	}
+	exceptions, err := normalizeExceptions(p.Exceptions)
+	if err != nil {
+		return EmailPolicy{}, err
+	}
+
+	if err := us.SetSetting(ctx, SettingEmailDomains, strings.Join(domains, "\n")); err != nil {
+		return EmailPolicy{}, err
+	}
+	if err := us.SetSetting(ctx, SettingEmailExceptions, strings.Join(exceptions, "\n")); err != nil {
+		return EmailPolicy{}, err
+	}
+	log.Printf("Registration limited to domains %v with %d exceptions", domains, len(exceptions))
+	return EmailPolicy{Domains: domains, Exceptions: exceptions}, nil
+}
+
+// Settings that cap how many teams may register in each hunt, and what
+// teams are told once it is full or registration is closed
+const (
+	SettingTeamCap         = "team_cap"
+	SettingWaitlistMessage = "waitlist_message"
+)
+
+var ErrInvalidTeamCap = errors.New("the team cap can't be negative")
+
+// RegistrationLimit caps the teams of each hunt, with no cap when Cap is
+// zero. Message is shown to teams turned away
+type RegistrationLimit struct {
+	Cap     int    `json:"cap"`
+	Message string `json:"message"`
+}
+
+// GetRegistrationLimit returns how many teams may register in each hunt
+func (us *UserService) GetRegistrationLimit(ctx context.Context) RegistrationLimit {
+	var limit RegistrationLimit
+	if value, ok, err := us.GetSetting(ctx, SettingTeamCap); err == nil && ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			log.Printf("Invalid value %q for setting %s", value, SettingTeamCap)
+		} else {
+			limit.Cap = n
+		}
+	}
+	if value, ok, err := us.GetSetting(ctx, SettingWaitlistMessage); err == nil && ok {
+		limit.Message = value
+	}
+	return limit
+}
+
+// SetRegistrationLimit sets how many teams may register in each hunt
+func (us *UserService) SetRegistrationLimit(ctx context.Context, l RegistrationLimit) error {
+	if l.Cap < 0 {
+		return ErrInvalidTeamCap
+	}
+	if err := us.SetSetting(ctx, SettingTeamCap, strconv.Itoa(l.Cap)); err != nil {
+		return err
+	}
+	if err := us.SetSetting(ctx, SettingWaitlistMessage, strings.TrimSpace(l.Message)); err != nil {
+		return err
+	}
+	log.Printf("Registration capped at %d teams per hunt", l.Cap)
+	return nil
+}
+
+// RegistrationFull reports whether a hunt has as many teams as the cap
+// allows
+func (us *UserService) RegistrationFull(ctx context.Context, huntID int) (bool, error) {
+	limit := us.GetRegistrationLimit(ctx)
+	if limit.Cap == 0 {
+		return false, nil
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	teams, err := us.Repo.CountTeams(ctx, huntID)
+	if err != nil {
+		log.Printf("Error counting teams of hunt %d: %v", huntID, err)
+		return false, err
+	}
+	return teams >= limit.Cap, nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+)
+
+// ResetHunt wipes every team's solves, attempts, unlocks, locks, quota,
+// notifications and chat and sets their points back to zero, so the same
+// questions can be played again. With deleteTeams the teams go as well,
+// and the count of deleted teams is returned
+func (us *UserService) ResetHunt(ctx context.Context, deleteTeams bool) (int64, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting hunt reset: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	repo := us.Repo.WithTx(tx)
+	if err := repo.ResetProgress(ctx, time.Now()); err != nil {
+		log.Printf("Error resetting hunt: %v", err)
+		return 0, err
+	}
+
+	var deleted int64
+	if deleteTeams {
+		deleted, err = repo.DeleteAllTeams(ctx)
+		if err != nil {
+			log.Printf("Error deleting teams: %v", err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing hunt reset: %v", err)
+		return 0, err
+	}
+
+	return deleted, nil
+}
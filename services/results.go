@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+type HuntResult = repository.HuntResult
+
+// SaveFinalResults saves a hunt's leaderboard as its final standings for
+// it ending at end. It reports false when they were already saved, by
+// this server or another one
+func (us *UserService) SaveFinalResults(ctx context.Context, huntID int, end time.Time) (bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	// Stored in UTC so the same end matches whatever zone it was set in
+	end = end.UTC()
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting final results snapshot: %v", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	teams, err := us.saveHuntResults(ctx, us.Repo.WithTx(tx), huntID, end)
+	if err != nil || teams < 0 {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing final results: %v", err)
+		return false, err
+	}
+
+	log.Printf("Saved final standings of %d teams in hunt %d, which ended %s", teams, huntID, end.Format(time.RFC3339))
+	return true, nil
+}
+
+// saveHuntResults saves one hunt's leaderboard, returning how many teams it
+// saved, or -1 when its standings were already saved
+func (us *UserService) saveHuntResults(ctx context.Context, repo *repository.Queries, huntID int, end time.Time) (int, error) {
+	saved, err := repo.CountResults(ctx, huntID, end)
+	if err != nil {
+		log.Printf("Error checking final results of hunt %d: %v", huntID, err)
+		return 0, err
+	}
+	if saved > 0 {
+		return -1, nil
+	}
+
+	board, err := repo.Leaderboard(ctx, huntID)
+	if err != nil {
+		log.Printf("Error fetching leaderboard of hunt %d for final results: %v", huntID, err)
+		return 0, err
+	}
+	place := 0
+	for _, e := range board {
+		// Teams under review or suspended get no place
+		if e.Hidden {
+			continue
+		}
+		place++
+		err := repo.SaveResult(ctx, HuntResult{
+			HuntID:           huntID,
+			Place:            place,
+			TeamName:         e.Username,
+			Points:           e.Points,
+			QuestionsSolved:  e.QuestionsSolved,
+			TotalTimeSeconds: e.TotalTimeSeconds,
+			TotalPenalty:     e.TotalPenalty,
+			NetScore:         e.Points - e.TotalPenalty,
+			HuntEnd:          end,
+		})
+		if err != nil {
+			log.Printf("Error saving final result for team %s: %v", e.Username, err)
+			return 0, err
+		}
+	}
+	return place, nil
+}
+
+// GetFinalResults returns the standings of a hunt saved when it last
+// ended, best first, or nothing if it hasn't ended yet
+func (us *UserService) GetFinalResults(ctx context.Context, huntID int) ([]HuntResult, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	results, err := us.Repo.LatestResults(ctx, huntID)
+	if err != nil {
+		log.Printf("Error fetching final results: %v", err)
+		return nil, err
+	}
+	return results, nil
+}
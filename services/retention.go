@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/namishh/holmes/database"
+)
+
+// Settings holding the retention policy
+const (
+	SettingRetentionDays  = "retention_days"
+	SettingRetentionTeams = "retention_teams"
+	SettingRetentionLogs  = "retention_logs"
+)
+
+// What the retention purge does with teams. Anonymized teams keep their
+// name, solves and standings but lose what identifies their players;
+// deleted teams go with everything referencing them
+const (
+	RetentionKeep      = "keep"
+	RetentionAnonymize = "anonymize"
+	RetentionDelete    = "delete"
+)
+
+// MaxRetentionDays caps how long after the hunt data can be kept for
+const MaxRetentionDays = 3650
+
+var ErrInvalidRetention = fmt.Errorf("days are between 0 and %d, and teams are kept, anonymized or deleted", MaxRetentionDays)
+
+// RetentionPolicy says what is purged once Days have passed since the hunt
+// ended. Teams says what happens to the teams that played it, and Logs
+// purges the answers they sent, the addresses they signed in from and the
+// mail and texts sent to them. Zero days turns purging off
+type RetentionPolicy struct {
+	Days  int    `json:"days"`
+	Teams string `json:"teams"`
+	Logs  bool   `json:"logs"`
+}
+
+// Enabled reports whether anything is ever purged
+func (p RetentionPolicy) Enabled() bool {
+	return p.Days > 0 && (p.Teams != RetentionKeep || p.Logs)
+}
+
+// RetentionReport is what a purge of one hunt removed, or with DryRun what
+// it would remove. Due is false, and nothing is counted, until the
+// policy's days have passed since the hunt ended
+type RetentionReport struct {
+	HuntID      int             `json:"hunt_id"`
+	DryRun      bool            `json:"dry_run"`
+	Policy      RetentionPolicy `json:"policy"`
+	HuntEnd     *time.Time      `json:"hunt_end,omitempty"`
+	DueAt       *time.Time      `json:"due_at,omitempty"`
+	Due         bool            `json:"due"`
+	Teams       int             `json:"teams"`
+	Submissions int64           `json:"submissions"`
+	Logins      int64           `json:"logins"`
+	Messages    int64           `json:"messages"`
+	Tokens      int64           `json:"tokens"`
+	RanAt       time.Time       `json:"ran_at"`
+}
+
+func validRetentionTeams(teams string) bool {
+	return teams == RetentionKeep || teams == RetentionAnonymize || teams == RetentionDelete
+}
+
+// GetRetentionPolicy returns what is purged after the hunt, and when
+func (us *UserService) GetRetentionPolicy(ctx context.Context) RetentionPolicy {
+	policy := RetentionPolicy{Teams: RetentionKeep}
+	if value, ok, err := us.GetSetting(ctx, SettingRetentionDays); err == nil && ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > MaxRetentionDays {
+			log.Printf("Invalid value %q for setting %s", value, SettingRetentionDays)
+		} else {
+			policy.Days = n
+		}
+	}
+	if value, ok, err := us.GetSetting(ctx, SettingRetentionTeams); err == nil && ok {
+		if !validRetentionTeams(value) {
+			log.Printf("Invalid value %q for setting %s", value, SettingRetentionTeams)
+		} else {
+			policy.Teams = value
+		}
+	}
+	if value, ok, err := us.GetSetting(ctx, SettingRetentionLogs); err == nil && ok {
+		policy.Logs = value == "true"
+	}
+	return policy
+}
+
+// SetRetentionPolicy sets what is purged after the hunt, and when
+func (us *UserService) SetRetentionPolicy(ctx context.Context, p RetentionPolicy) error {
+	if p.Teams == "" {
+		p.Teams = RetentionKeep
+	}
+	if p.Days < 0 || p.Days > MaxRetentionDays || !validRetentionTeams(p.Teams) {
+		return ErrInvalidRetention
+	}
+	if err := us.SetSetting(ctx, SettingRetentionDays, strconv.Itoa(p.Days)); err != nil {
+		return err
+	}
+	if err := us.SetSetting(ctx, SettingRetentionTeams, p.Teams); err != nil {
+		return err
+	}
+	if err := us.SetSetting(ctx, SettingRetentionLogs, strconv.FormatBool(p.Logs)); err != nil {
+		return err
+	}
+	log.Printf("Retention policy set: %s teams and purge logs %t, %d days after the hunt", p.Teams, p.Logs, p.Days)
+	return nil
+}
+
+// PurgeRetained applies the retention policy to a hunt once its days have
+// passed since the hunt ended. It acts on the hunt's teams registered
+// before the end and their logs written before it, and always clears
+// emailed links that were used or have expired. Everything goes in one
+// transaction; a dry run rolls it back, so its report counts exactly what
+// a purge would remove. Files that were only referenced by purged rows
+// are left to CleanupOrphanedMedia
+func (us *UserService) PurgeRetained(ctx context.Context, huntID int, dryRun bool) (RetentionReport, error) {
+	now := time.Now().UTC()
+	report := RetentionReport{HuntID: huntID, DryRun: dryRun, Policy: us.GetRetentionPolicy(ctx), RanAt: now}
+	window := us.GetHuntWindow(ctx, huntID)
+	if window.End.IsZero() {
+		return report, nil
+	}
+	end := window.End.UTC()
+	due := end.AddDate(0, 0, report.Policy.Days)
+	report.HuntEnd, report.DueAt = &end, &due
+	if !report.Policy.Enabled() || now.Before(due) {
+		return report, nil
+	}
+	report.Due = true
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting retention purge: %v", err)
+		return report, err
+	}
+	defer tx.Rollback()
+	repo := us.Repo.WithTx(tx)
+
+	// Logs go before teams, which take their own sign-ins and email links
+	// with them, so the report counts them
+	if report.Policy.Logs {
+		if report.Submissions, err = repo.DeleteSubmissionsBefore(ctx, huntID, end); err != nil {
+			log.Printf("Error purging submissions: %v", err)
+			return report, err
+		}
+		if report.Logins, err = repo.DeleteLoginsBefore(ctx, huntID, end); err != nil {
+			log.Printf("Error purging logins: %v", err)
+			return report, err
+		}
+		if report.Messages, err = repo.DeleteSentMessagesBefore(ctx, huntID, end); err != nil {
+			log.Printf("Error purging sent messages: %v", err)
+			return report, err
+		}
+	}
+	if report.Tokens, err = repo.DeleteStaleEmailTokens(ctx, now); err != nil {
+		log.Printf("Error purging email tokens: %v", err)
+		return report, err
+	}
+
+	if report.Policy.Teams != RetentionKeep {
+		teams, err := repo.ListTeamsToPurge(ctx, huntID, end, report.Policy.Teams == RetentionDelete)
+		if err != nil {
+			log.Printf("Error listing teams to purge: %v", err)
+			return report, err
+		}
+		for _, id := range teams {
+			if report.Policy.Teams == RetentionDelete {
+				if err = repo.DeleteTeamContacts(ctx, id); err == nil {
+					_, err = repo.DeleteTeam(ctx, id)
+				}
+			} else {
+				err = repo.AnonymizeTeam(ctx, id, now)
+			}
+			if err != nil {
+				log.Printf("Error purging team %d: %v", id, err)
+				return report, err
+			}
+		}
+		report.Teams = len(teams)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing retention purge: %v", err)
+		return report, err
+	}
+	if report.Teams > 0 || report.Submissions > 0 || report.Logins > 0 || report.Messages > 0 || report.Tokens > 0 {
+		log.Printf("Retention purge of hunt %d: %d teams %s, %d submissions, %d logins, %d messages and %d email links deleted",
+			huntID, report.Teams, retentionVerb(report.Policy.Teams), report.Submissions, report.Logins, report.Messages, report.Tokens)
+	}
+	return report, nil
+}
+
+// PurgeAllRetained applies the retention policy to every hunt in turn
+func (us *UserService) PurgeAllRetained(ctx context.Context) error {
+	hunts, err := us.GetHunts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, hunt := range hunts {
+		if _, err := us.PurgeRetained(ctx, hunt.ID, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retentionVerb says what happened to purged teams, for logs
+func retentionVerb(teams string) string {
+	if teams == RetentionDelete {
+		return "deleted"
+	}
+	return "anonymized"
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Statuses of a solve review
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// SolveReview is a solve by a flagged team waiting for an admin
+type SolveReview = repository.SolveReview
+
+// ApprovedSolve is a waiting solve an admin let stand, with what it takes
+// to announce it. Hidden is set while its team is still under review, so
+// only the team hears of it
+type ApprovedSolve struct {
+	Solve
+	TeamName      string
+	QuestionTitle string
+	Hidden        bool
+}
+
+var (
+	// ErrReviewNotFound is returned when a review is missing or already
+	// settled
+	ErrReviewNotFound = errors.New("no pending review with that ID")
+	// ErrInvalidReviewStatus is returned for a status a review can't have
+	ErrInvalidReviewStatus = errors.New("status must be pending, approved or rejected")
+)
+
+// FlagTeam puts a team under review. It keeps playing, but is left off the
+// public leaderboard and its solves wait in the review queue, earning
+// nothing until they are approved
+func (us *UserService) FlagTeam(ctx context.Context, teamID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ok, err := us.Repo.SetTeamFlagged(ctx, teamID, sql.NullTime{Time: time.Now(), Valid: true})
+	if err != nil {
+		log.Printf("Error flagging team %d: %v", teamID, err)
+		return err
+	}
+	if !ok {
+		return ErrTeamNotFound
+	}
+	log.Printf("Flagged team %d for review", teamID)
+	return nil
+}
+
+// ClearTeam ends a team's review: its waiting solves stand, paying their
+// points, and it is back on the leaderboard. It returns the solves to
+// announce
+func (us *UserService) ClearTeam(ctx context.Context, teamID int) ([]ApprovedSolve, error) {
+	return us.endReview(ctx, teamID, ReviewApproved)
+}
+
+// BanTeam ends a team's review by suspending it and taking back its
+// waiting solves
+func (us *UserService) BanTeam(ctx context.Context, teamID int) error {
+	_, err := us.endReview(ctx, teamID, ReviewRejected)
+	return err
+}
+
+// endReview settles every waiting solve of a team and clears its flag in
+// one transaction, suspending the team when its solves are rejected
+func (us *UserService) endReview(ctx context.Context, teamID int, status string) ([]ApprovedSolve, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting review of team %d: %v", teamID, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+	repo := us.Repo.WithTx(tx)
+
+	now := time.Now()
+	ok, err := repo.SetTeamFlagged(ctx, teamID, sql.NullTime{})
+	if err != nil {
+		log.Printf("Error clearing flag of team %d: %v", teamID, err)
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTeamNotFound
+	}
+	if status == ReviewRejected {
+		if _, err := repo.SetTeamSuspended(ctx, teamID, sql.NullTime{Time: now, Valid: true}); err != nil {
+			log.Printf("Error suspending team %d: %v", teamID, err)
+			return nil, err
+		}
+	}
+
+	reviews, err := repo.ListTeamSolveReviews(ctx, teamID, ReviewPending)
+	if err != nil {
+		log.Printf("Error listing reviews of team %d: %v", teamID, err)
+		return nil, err
+	}
+	var approved []ApprovedSolve
+	for _, r := range reviews {
+		solve, err := closeReview(ctx, repo, r, status, now)
+		if err != nil {
+			return nil, err
+		}
+		if solve != nil {
+			approved = append(approved, *solve)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing review of team %d: %v", teamID, err)
+		return nil, err
+	}
+	log.Printf("Ended review of team %d: %d solves %s", teamID, len(reviews), status)
+	return approved, nil
+}
+
+// closeReview settles a waiting solve. An approved one pays its points and
+// is returned to be announced, taking first blood if no other team solved
+// the question before it; a rejected one is taken back
+func closeReview(ctx context.Context, repo *repository.Queries, r SolveReview, status string, at time.Time) (*ApprovedSolve, error) {
+	ok, err := repo.CloseSolveReview(ctx, r.ID, status, at)
+	if err != nil {
+		log.Printf("Error settling review %d: %v", r.ID, err)
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrReviewNotFound
+	}
+
+	if status == ReviewRejected {
+		if _, err := repo.DeleteCompletion(ctx, r.TeamID, r.QuestionID); err != nil {
+			log.Printf("Error taking back solve of question %d by team %d: %v", r.QuestionID, r.TeamID, err)
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if err := repo.AddSolvePoints(ctx, r.TeamID, r.Points, r.CreatedAt); err != nil {
+		log.Printf("Error adding points to team %d: %v", r.TeamID, err)
+		return nil, err
+	}
+	first, err := repo.GetFirstSolver(ctx, r.QuestionID)
+	if err != nil {
+		log.Printf("Error fetching first solver of question %d: %v", r.QuestionID, err)
+		return nil, err
+	}
+	flagged, err := repo.GetTeamFlagged(ctx, r.TeamID)
+	if err != nil {
+		log.Printf("Error checking review of team %d: %v", r.TeamID, err)
+		return nil, err
+	}
+
+	return &ApprovedSolve{
+		Solve: Solve{
+			TeamID:     r.TeamID,
+			QuestionID: r.QuestionID,
+			Points:     r.Points,
+			FirstBlood: first == r.TeamID,
+			SolvedAt:   r.CreatedAt,
+		},
+		TeamName:      r.TeamName,
+		QuestionTitle: r.QuestionTitle,
+		Hidden:        flagged.Valid,
+	}, nil
+}
+
+// GetSolveReviews returns the reviews of a hunt with a status, or all of
+// them when status is empty
+func (us *UserService) GetSolveReviews(ctx context.Context, huntID int, status string) ([]SolveReview, error) {
+	switch status {
+	case "", ReviewPending, ReviewApproved, ReviewRejected:
+	default:
+		return nil, ErrInvalidReviewStatus
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	reviews, err := us.Repo.ListSolveReviews(ctx, huntID, status)
+	if err != nil {
+		log.Printf("Error listing solve reviews of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+	if reviews == nil {
+		reviews = make([]SolveReview, 0)
+	}
+	return reviews, nil
+}
+
+// SettleSolveReview lets a waiting solve stand, paying its points and
+// returning it to be announced, or takes it back when status is
+// ReviewRejected
+func (us *UserService) SettleSolveReview(ctx context.Context, id int, status string) (*ApprovedSolve, error) {
+	if status != ReviewApproved && status != ReviewRejected {
+		return nil, ErrInvalidReviewStatus
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	r, err := us.Repo.GetSolveReview(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching review %d: %v", id, err)
+		return nil, err
+	}
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting review %d: %v", id, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	solve, err := closeReview(ctx, us.Repo.WithTx(tx), r, status, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing review %d: %v", id, err)
+		return nil, err
+	}
+	return solve, nil
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// RulesPageSlug is the page holding the rules teams accept, at /p/rules
+const RulesPageSlug = "rules"
+
+// RulesAcceptance is when a team accepted the rules and which version
+type RulesAcceptance = repository.RulesAcceptance
+
+// ErrNoRules is returned for accepting rules that aren't published
+var ErrNoRules = errors.New("the rules aren't published")
+
+// Rules returns the published rules, or ErrPageNotFound
+func (us *UserService) Rules(ctx context.Context) (RenderedPage, error) {
+	return us.RenderPage(ctx, RulesPageSlug, false)
+}
+
+// RulesPending reports whether a team must still accept the rules before
+// it may play: the flag is on, the rules are published and it hasn't
+// accepted them. Anyone who isn't a team, such as the admin, never must
+func (us *UserService) RulesPending(ctx context.Context, teamID int) (bool, error) {
+	if !us.FlagEnabled(ctx, FlagRulesAcceptance) {
+		return false, nil
+	}
+	if _, err := us.Rules(ctx); errors.Is(err, ErrPageNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	n, err := us.Repo.CountRulesPending(ctx, teamID)
+	if err != nil {
+		log.Printf("Error checking rules acceptance of team %d: %v", teamID, err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// AcceptRules records that a team accepted the rules as they are now,
+// from the address ip
+func (us *UserService) AcceptRules(ctx context.Context, teamID int, ip string) error {
+	rules, err := us.Rules(ctx)
+	if errors.Is(err, ErrPageNotFound) {
+		return ErrNoRules
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.AcceptRules(ctx, teamID, rules.Page.UpdatedAt, ip, time.Now()); err != nil {
+		log.Printf("Error recording rules acceptance of team %d: %v", teamID, err)
+		return err
+	}
+	return nil
+}
+
+// GetRulesAcceptance returns when a team accepted the rules, or nil when
+// it hasn't
+func (us *UserService) GetRulesAcceptance(ctx context.Context, teamID int) (*RulesAcceptance, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	a, err := us.Repo.GetRulesAcceptance(ctx, teamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Error getting rules acceptance of team %d: %v", teamID, err)
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetRulesAcceptances returns every team of a hunt with when it accepted
+// the rules, the ones that haven't last
+func (us *UserService) GetRulesAcceptances(ctx context.Context, huntID int) ([]RulesAcceptance, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	list, err := us.Repo.ListRulesAcceptances(ctx, huntID)
+	if err != nil {
+		log.Printf("Error getting rules acceptances of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// gcsEndpoint is Cloud Storage's S3-compatible XML API, reached with
+// HMAC keys created for a service account
+const gcsEndpoint = "storage.googleapis.com"
+
+// S3Storage stores objects in an S3-compatible bucket: AWS S3, MinIO, or
+// Cloud Storage through its interoperability endpoint
+type S3Storage struct {
+	client  *minio.Client
+	bucket  string
+	baseURL string
+}
+
+func newS3Client(cfg StorageConfig) (*minio.Client, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("no bucket name configured")
+	}
+	return minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+}
+
+// bucketURL is the path-style URL objects are served from unless a
+// public URL is configured
+func bucketURL(cfg StorageConfig) string {
+	if cfg.PublicURL != "" {
+		return strings.TrimSuffix(cfg.PublicURL, "/") + "/"
+	}
+	protocol := "http"
+	if cfg.UseSSL {
+		protocol = "https"
+	}
+	return fmt.Sprintf("%s://%s/%s/", protocol, cfg.Endpoint, cfg.Bucket)
+}
+
+// NewS3Storage connects to an S3 or MinIO bucket, creating it if it
+// doesn't exist yet. The bucket is left private; media is served through
+// the authenticated proxy
+func NewS3Storage(cfg StorageConfig) (*S3Storage, error) {
+	client, err := newS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if bucket exists: %v", err)
+	}
+
+	if !exists {
+		err = client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create bucket '%s': %v", cfg.Bucket, err)
+		}
+		log.Printf("Successfully created bucket: %s", cfg.Bucket)
+	}
+
+	return &S3Storage{client: client, bucket: cfg.Bucket, baseURL: bucketURL(cfg)}, nil
+}
+
+// NewGCSStorage connects to a Cloud Storage bucket using HMAC keys
+// The bucket must already exist
+func NewGCSStorage(cfg StorageConfig) (*S3Storage, error) {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = gcsEndpoint
+	}
+	cfg.UseSSL = true
+
+	client, err := newS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(context.Background(), cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if bucket exists: %v", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket '%s' does not exist", cfg.Bucket)
+	}
+
+	return &S3Storage{client: client, bucket: cfg.Bucket, baseURL: bucketURL(cfg)}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Storage) Open(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	// GetObject is lazy; Stat is the first call that reaches the bucket
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ObjectInfo{}, ErrObjectNotFound
+		}
+		return nil, ObjectInfo{}, err
+	}
+
+	return obj, ObjectInfo{
+		Size:        stat.Size,
+		ContentType: stat.ContentType,
+		ModTime:     stat.LastModified,
+	}, nil
+}
+
+func (s *S3Storage) URL(key string) string {
+	return s.baseURL + key
+}
+
+func (s *S3Storage) PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedPutObject(ctx, s.bucket, key, expiry)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *S3Storage) List(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, ObjectInfo{Key: obj.Key, Size: obj.Size, ModTime: obj.LastModified})
+	}
+	return objects, nil
+}
+
+// Ping checks that the bucket is reachable
+func (s *S3Storage) Ping(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrInfected is returned by a Scanner when the content is flagged
+var ErrInfected = errors.New("file flagged by malware scan")
+
+// scanTimeout bounds a single scan, including connecting to the scanner
+const scanTimeout = 60 * time.Second
+
+// Scanner checks uploads for malware before they are stored
+type Scanner interface {
+	// Scan reads r to the end and returns an error wrapping ErrInfected
+	// if the content is flagged, or another error if it couldn't be scanned
+	Scan(ctx context.Context, r io.Reader) error
+}
+
+// ScannerConfig selects the malware scanner; both empty disables scanning
+type ScannerConfig struct {
+	// ClamAVAddr is clamd's "host:port", or a unix socket path
+	ClamAVAddr string
+
+	// ICAPURL is an ICAP RESPMOD service, e.g. "icap://localhost:1344/avscan"
+	ICAPURL string
+}
+
+// NewScanner returns the configured scanner, or nil when scanning is off
+func NewScanner(cfg ScannerConfig) Scanner {
+	switch {
+	case cfg.ClamAVAddr != "":
+		log.Printf("Scanning uploads with ClamAV at %s", cfg.ClamAVAddr)
+		return &ClamAVScanner{Addr: cfg.ClamAVAddr}
+	case cfg.ICAPURL != "":
+		u, err := url.Parse(cfg.ICAPURL)
+		if err != nil || u.Scheme != "icap" || u.Host == "" {
+			log.Printf("Warning: Invalid ICAP URL %q - uploads will not be scanned", cfg.ICAPURL)
+			return nil
+		}
+		log.Printf("Scanning uploads with ICAP service %s", cfg.ICAPURL)
+		return &ICAPScanner{URL: u}
+	}
+	return nil
+}
+
+// dialScanner connects to a scanner and applies the context's deadline
+func dialScanner(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// ClamAVScanner streams content to clamd with the INSTREAM command
+type ClamAVScanner struct {
+	Addr string
+}
+
+func (s *ClamAVScanner) Scan(ctx context.Context, r io.Reader) error {
+	network := "tcp"
+	if strings.HasPrefix(s.Addr, "/") {
+		network = "unix"
+	}
+	conn, err := dialScanner(ctx, network, s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to reach clamd: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return err
+	}
+
+	// Each chunk is prefixed with its length; a zero length ends the stream
+	buf := make([]byte, 32*1024)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, werr := conn.Write(append(size, buf[:n]...)); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read clamd reply: %v", err)
+	}
+	reply = strings.TrimSpace(strings.TrimSuffix(reply, "\x00"))
+
+	switch {
+	case strings.HasSuffix(reply, "OK"):
+		return nil
+	case strings.HasSuffix(reply, "FOUND"):
+		signature := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return fmt.Errorf("%w: %s", ErrInfected, signature)
+	default:
+		return fmt.Errorf("clamd: %s", reply)
+	}
+}
+
+// ICAPScanner submits content to an ICAP antivirus service as a RESPMOD
+// request. A 204 reply means the content is clean; a 200 means the
+// service replaced it, i.e. blocked it
+type ICAPScanner struct {
+	URL *url.URL
+}
+
+func (s *ICAPScanner) Scan(ctx context.Context, r io.Reader) error {
+	host := s.URL.Host
+	if s.URL.Port() == "" {
+		host = net.JoinHostPort(host, "1344")
+	}
+	conn, err := dialScanner(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("failed to reach ICAP service: %v", err)
+	}
+	defer conn.Close()
+
+	httpHeader := "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n\r\n"
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "RESPMOD %s ICAP/1.0\r\n", s.URL.String())
+	fmt.Fprintf(w, "Host: %s\r\n", s.URL.Host)
+	fmt.Fprintf(w, "Allow: 204\r\n")
+	fmt.Fprintf(w, "Encapsulated: res-hdr=0, res-body=%d\r\n\r\n", len(httpHeader))
+	w.WriteString(httpHeader)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(w, "%x\r\n", n)
+			w.Write(buf[:n])
+			w.WriteString("\r\n")
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	w.WriteString("0\r\n\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	tp := textproto.NewReader(bufio.NewReader(conn))
+	status, err := tp.ReadLine()
+	if err != nil {
+		return fmt.Errorf("failed to read ICAP reply: %v", err)
+	}
+	header, _ := tp.ReadMIMEHeader()
+
+	fields := strings.Fields(status)
+	if len(fields) < 2 {
+		return fmt.Errorf("malformed ICAP reply %q", status)
+	}
+
+	switch fields[1] {
+	case "204":
+		return nil
+	case "200":
+		threat := header.Get("X-Virus-ID")
+		if threat == "" {
+			threat = header.Get("X-Infection-Found")
+		}
+		if threat == "" {
+			threat = "blocked by ICAP service"
+		}
+		return fmt.Errorf("%w: %s", ErrInfected, threat)
+	default:
+		return fmt.Errorf("ICAP service: %s", status)
+	}
+}
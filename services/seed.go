@@ -0,0 +1,291 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// ErrDatabaseNotEmpty is returned by SeedDemo when the database already
+// has teams or questions, so a real hunt is never mixed with demo data
+var ErrDatabaseNotEmpty = errors.New("database already has teams or questions")
+
+// DemoPassword is the password of every demo team
+const DemoPassword = "demo-password"
+
+// SeedSummary counts what SeedDemo created
+type SeedSummary struct {
+	Teams         int
+	Questions     int
+	Hints         int
+	Solves        int
+	WrongAttempts int
+}
+
+type demoQuestion struct {
+	title    string
+	question string
+	answer   string
+	points   int
+	image    string // text drawn on a generated image, none if empty
+	file     string // contents of a text attachment, none if empty
+	hints    []Hint
+}
+
+var demoTeams = []string{"baker-street", "scotland-yard", "irregulars", "diogenes-club", "reichenbach", "the-woman"}
+
+var demoQuestions = []demoQuestion{
+	{
+		title:    "The Warm-Up",
+		question: "What is the name of the detective who lives at 221B Baker Street?",
+		answer:   "sherlock",
+		points:   100,
+	},
+	{
+		title:    "A Study in Scarlet",
+		question: "Read the word hidden in the image.",
+		answer:   "rache",
+		points:   150,
+		image:    "R A C H E",
+		hints:    []Hint{{Hint: "It's German for revenge.", Worth: 20}},
+	},
+	{
+		title:    "The Dancing Men",
+		question: "Decode the attached message. Each letter was shifted by three.",
+		answer:   "elsie",
+		points:   200,
+		file:     "HOVLH\n",
+		hints:    []Hint{{Hint: "Shift every letter back by three.", Worth: 30}},
+	},
+	{
+		title:    "The Sign of Four",
+		question: "How many signed the agreement in the image?",
+		answer:   "four",
+		points:   250,
+		image:    "THE SIGN OF ?",
+	},
+	{
+		title:    "Silver Blaze",
+		question: "What did the dog do in the night-time?",
+		answer:   "nothing",
+		points:   300,
+		hints: []Hint{
+			{Hint: "That was the curious incident.", Worth: 40},
+			{Hint: "It's the opposite of barking.", Worth: 80},
+		},
+	},
+	{
+		title:    "The Red-Headed League",
+		question: "The attached list names the league's members. Which word do their initials spell?",
+		answer:   "bank",
+		points:   350,
+		file:     "Beatrice Wilson\nArthur Ross\nNathaniel Spaulding\nKeith Duncan\n",
+		hints:    []Hint{{Hint: "Read the first letters top to bottom.", Worth: 50}},
+	},
+	{
+		title:    "The Final Problem",
+		question: "Name the falls shown in the image.",
+		answer:   "reichenbach",
+		points:   400,
+		image:    "MEIRINGEN 1891",
+		hints:    []Hint{{Hint: "Switzerland.", Worth: 60}},
+	},
+	{
+		title:    "The Empty House",
+		question: "Who returns in this story?",
+		answer:   "holmes",
+		points:   450,
+	},
+}
+
+// SeedDemo fills an empty database with a demo hunt: teams sharing
+// DemoPassword, questions with images, attachments and hints, and some
+// solves and penalised wrong answers. It uses a fixed random seed, so
+// every run produces the same hunt
+func (us *UserService) SeedDemo(ctx context.Context) (SeedSummary, error) {
+	var summary SeedSummary
+
+	teamCount, err := us.Repo.CountTeams(ctx, DefaultHuntID)
+	if err != nil {
+		return summary, err
+	}
+	questionCount, err := us.Repo.CountQuestions(ctx, DefaultHuntID)
+	if err != nil {
+		return summary, err
+	}
+	if teamCount+questionCount > 0 {
+		return summary, ErrDatabaseNotEmpty
+	}
+
+	teamIDs := make([]int, 0, len(demoTeams))
+	for _, name := range demoTeams {
+		err := us.CreateUser(ctx, User{Email: name + "@example.com", Username: name, Password: DemoPassword})
+		if err != nil {
+			return summary, fmt.Errorf("failed to create team %s: %v", name, err)
+		}
+		team, err := us.CheckUsername(ctx, name)
+		if err != nil {
+			return summary, err
+		}
+		teamIDs = append(teamIDs, team.ID)
+		summary.Teams++
+	}
+
+	questions := make([]Question, 0, len(demoQuestions))
+	for _, dq := range demoQuestions {
+		var images []string
+		if dq.image != "" {
+			key, err := us.storeDemoImage(ctx, dq.image)
+			if err != nil {
+				return summary, err
+			}
+			images = append(images, key)
+		}
+
+		q := Question{Title: dq.title, Question: dq.question, Answer: dq.answer, Points: dq.points, Cooldown: DefaultCooldown}
+		q.ID, err = us.CreateQuestion(ctx, q, images, nil, nil)
+		if err != nil {
+			return summary, fmt.Errorf("failed to create question %q: %v", dq.title, err)
+		}
+		questions = append(questions, q)
+		summary.Questions++
+
+		if dq.file != "" {
+			key := NewMediaKey(mediaPrefixes["files"], "message.txt")
+			if err := us.Storage.Put(ctx, key, strings.NewReader(dq.file), int64(len(dq.file)), "text/plain"); err != nil {
+				return summary, fmt.Errorf("failed to store demo attachment: %v", err)
+			}
+			if err := us.CreateAttachments(ctx, q.ID, []string{key}, []string{"message.txt"}); err != nil {
+				return summary, err
+			}
+		}
+
+		for _, h := range dq.hints {
+			h.ParentQuestionID = q.ID
+			if _, err := us.CreateHint(ctx, h); err != nil {
+				return summary, fmt.Errorf("failed to create hint: %v", err)
+			}
+			summary.Hints++
+		}
+	}
+
+	// Earlier teams get further, so the leaderboard has a spread; each
+	// solve is timed from a backdated start so solve times aren't zero
+	rng := rand.New(rand.NewSource(1))
+	for i, teamID := range teamIDs {
+		solved := len(questions) - i - 1
+		for j, q := range questions {
+			if j >= solved {
+				// Some wrong guesses at the first unsolved question
+				if j == solved {
+					for n := rng.Intn(3); n > 0; n-- {
+						if err := us.seedWrongAttempt(ctx, teamID, q); err != nil {
+							return summary, err
+						}
+						summary.WrongAttempts++
+					}
+				}
+				break
+			}
+
+			started := time.Now().Add(-time.Duration(5+rng.Intn(55)) * time.Minute)
+			if err := us.seedTimer(ctx, teamID, q.ID, started); err != nil {
+				return summary, err
+			}
+			if rng.Intn(4) == 0 {
+				if err := us.seedWrongAttempt(ctx, teamID, q); err != nil {
+					return summary, err
+				}
+				summary.WrongAttempts++
+			}
+			if _, err := us.RecordSolve(ctx, teamID, q.ID, q.Points); err != nil {
+				return summary, fmt.Errorf("failed to record demo solve: %v", err)
+			}
+			summary.Solves++
+		}
+	}
+
+	log.Printf("Seeded demo hunt: %d teams, %d questions, %d hints, %d solves, %d wrong attempts",
+		summary.Teams, summary.Questions, summary.Hints, summary.Solves, summary.WrongAttempts)
+	return summary, nil
+}
+
+// seedWrongAttempt records a wrong answer and its penalty, as submitting one would
+func (us *UserService) seedWrongAttempt(ctx context.Context, teamID int, q Question) error {
+	penalty, _, err := us.RecordWrongAttempt(ctx, teamID, q.ID, q.Points)
+	if err != nil {
+		return err
+	}
+	if penalty > 0 {
+		return us.DeductPenaltyPoints(ctx, teamID, penalty)
+	}
+	return nil
+}
+
+// seedTimer starts a question timer at a given time in the past
+func (us *UserService) seedTimer(ctx context.Context, teamID, questionID int, started time.Time) error {
+	if err := us.StartQuestionTimer(ctx, teamID, questionID); err != nil {
+		return err
+	}
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	return us.Repo.SetTimerStart(ctx, teamID, questionID, started)
+}
+
+// storeDemoImage draws text on a plain card and stores it as a PNG,
+// along with its resized copies
+func (us *UserService) storeDemoImage(ctx context.Context, text string) (string, error) {
+	const width, height = 1200, 675
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		shade := uint8(40 + 60*y/height)
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{shade / 2, shade / 2, shade, 255})
+		}
+	}
+
+	// basicfont is small, so the text is drawn once and scaled up
+	face := basicfont.Face7x13
+	label := image.NewRGBA(image.Rect(0, 0, font.MeasureString(face, text).Ceil(), 13))
+	d := font.Drawer{Dst: label, Src: image.White, Face: face, Dot: fixed.P(0, 10)}
+	d.DrawString(text)
+
+	scale := min(width*3/4/max(label.Bounds().Dx(), 1), 12)
+	left := (width - label.Bounds().Dx()*scale) / 2
+	top := (height - label.Bounds().Dy()*scale) / 2
+	for y := 0; y < label.Bounds().Dy()*scale; y++ {
+		for x := 0; x < label.Bounds().Dx()*scale; x++ {
+			if _, _, _, a := label.At(x/scale, y/scale).RGBA(); a > 0 {
+				img.Set(left+x, top+y, color.White)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+
+	key := NewMediaKey(mediaPrefixes["images"], "demo.png")
+	if err := us.Storage.Put(ctx, key, &buf, int64(buf.Len()), "image/png"); err != nil {
+		return "", fmt.Errorf("failed to store demo image: %v", err)
+	}
+	if err := us.GenerateImageVariants(key); err != nil {
+		log.Printf("Warning: Error resizing demo image %s: %v", key, err)
+	}
+	return key, nil
+}
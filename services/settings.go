@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/namishh/holmes/database"
+)
+
+// Feature flags switch parts of the game on and off while the hunt runs,
+// from the admin panel and without a redeploy
+const (
+	FlagExclusiveSolve    = "exclusive_solve"
+	FlagQuotas            = "quotas"
+	FlagPenalties         = "penalties"
+	FlagPublicLeaderboard = "public_leaderboard"
+	FlagRegistrationOpen  = "registration_open"
+	FlagRevealSolutions   = "reveal_solutions"
+	FlagAchievements      = "achievements"
+	FlagRulesAcceptance   = "rules_acceptance"
+)
+
+// FeatureFlag is a flag and whether it is on
+type FeatureFlag struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// featureFlags lists every flag with its default, which applies until an
+// admin changes it
+var featureFlags = []FeatureFlag{
+	{
+		Key:         FlagExclusiveSolve,
+		Name:        "Exclusive solves",
+		Description: "A question closes once any team solves it, and a team opening it locks it for the others",
+		Default:     true,
+	},
+	{
+		Key:         FlagQuotas,
+		Name:        "Solve quotas",
+		Description: "Teams may only solve a limited number of questions per quota slot",
+		Default:     true,
+	},
+	{
+		Key:         FlagPenalties,
+		Name:        "Wrong answer penalties",
+		Description: "Wrong answers after the first cost a share of the question's points",
+		Default:     true,
+	},
+	{
+		Key:         FlagPublicLeaderboard,
+		Name:        "Public leaderboard",
+		Description: "Anyone can see the leaderboard at /leaderboard without signing in",
+		Default:     false,
+	},
+	{
+		Key:         FlagRegistrationOpen,
+		Name:        "Registration open",
+		Description: "New teams can register",
+		Default:     true,
+	},
+	{
+		Key:         FlagRevealSolutions,
+		Name:        "Reveal solutions",
+		Description: "Once a team's hunt is over, its question pages show every answer and solution",
+		Default:     false,
+	},
+	{
+		Key:         FlagAchievements,
+		Name:        "Achievements",
+		Description: "Teams earn badges for feats like first blood, shown on profiles and the leaderboard",
+		Default:     true,
+	},
+	{
+		Key:         FlagRulesAcceptance,
+		Name:        "Rules acceptance",
+		Description: "Teams must accept the rules at /rules before they can open the hunt; write them as a page at /p/rules",
+		Default:     false,
+	},
+}
+
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// settingsCacheTTL is how long settings are held in memory; other
+// instances pick up a change within it
+const settingsCacheTTL = 2 * time.Second
+
+// settingsCache holds the settings table so checking a flag on every
+// request doesn't cost a query
+type settingsCache struct {
+	mu       sync.Mutex
+	values   map[string]string
+	loadedAt time.Time
+}
+
+// settings returns every stored setting, from memory when recently read
+func (us *UserService) settings(ctx context.Context) (map[string]string, error) {
+	c := &us.settingsCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.values != nil && time.Since(c.loadedAt) < settingsCacheTTL {
+		return c.values, nil
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	values, err := us.Repo.ListSettings(ctx)
+	if err != nil {
+		log.Printf("Error loading settings: %v", err)
+		return nil, err
+	}
+	c.values = values
+	c.loadedAt = time.Now()
+	return values, nil
+}
+
+// forgetSettings drops the cached settings after a change
+func (us *UserService) forgetSettings() {
+	us.settingsCache.mu.Lock()
+	us.settingsCache.values = nil
+	us.settingsCache.mu.Unlock()
+}
+
+// GetSetting returns a stored setting, and false when it isn't set
+func (us *UserService) GetSetting(ctx context.Context, key string) (string, bool, error) {
+	values, err := us.settings(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	value, ok := values[key]
+	return value, ok, nil
+}
+
+// SetSetting stores a setting
+func (us *UserService) SetSetting(ctx context.Context, key, value string) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.SetSetting(ctx, key, value, time.Now()); err != nil {
+		log.Printf("Error saving setting %s: %v", key, err)
+		return err
+	}
+	us.forgetSettings()
+	return nil
+}
+
+// DeleteSetting removes a setting, so its default applies again
+func (us *UserService) DeleteSetting(ctx context.Context, key string) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeleteSetting(ctx, key); err != nil {
+		log.Printf("Error deleting setting %s: %v", key, err)
+		return err
+	}
+	us.forgetSettings()
+	return nil
+}
+
+// findFlag returns the flag with the given key
+func findFlag(key string) (FeatureFlag, bool) {
+	for _, flag := range featureFlags {
+		if flag.Key == key {
+			return flag, true
+		}
+	}
+	return FeatureFlag{}, false
+}
+
+// FlagEnabled reports whether a feature flag is on. When the settings
+// can't be read the flag's default applies, so a database hiccup doesn't
+// change the rules mid-hunt
+func (us *UserService) FlagEnabled(ctx context.Context, key string) bool {
+	flag, ok := findFlag(key)
+	if !ok {
+		log.Printf("Unknown feature flag %s", key)
+		return false
+	}
+
+	value, ok, err := us.GetSetting(ctx, key)
+	if err != nil || !ok {
+		return flag.Default
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value %q for feature flag %s", value, key)
+		return flag.Default
+	}
+	return enabled
+}
+
+// GetFeatureFlags returns every feature flag and whether it is on
+func (us *UserService) GetFeatureFlags(ctx context.Context) ([]FeatureFlag, error) {
+	values, err := us.settings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make([]FeatureFlag, len(featureFlags))
+	for i, flag := range featureFlags {
+		flag.Enabled = flag.Default
+		if enabled, err := strconv.ParseBool(values[flag.Key]); err == nil {
+			flag.Enabled = enabled
+		}
+		flags[i] = flag
+	}
+	return flags, nil
+}
+
+// SetFeatureFlag turns a feature flag on or off
+func (us *UserService) SetFeatureFlag(ctx context.Context, key string, enabled bool) error {
+	if _, ok := findFlag(key); !ok {
+		return ErrUnknownFlag
+	}
+	if err := us.SetSetting(ctx, key, strconv.FormatBool(enabled)); err != nil {
+		return err
+	}
+	log.Printf("Feature flag %s set to %t", key, enabled)
+	return nil
+}
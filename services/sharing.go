@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/namishh/holmes/database"
+)
+
+const (
+	// SharedAnswerWindow is how close together the same wrong answer from
+	// two teams has to be to look shared
+	SharedAnswerWindow = 10 * time.Minute
+	// sharedAnswerMinLength skips short answers, which teams easily guess
+	// alike
+	sharedAnswerMinLength = 4
+	// sharedAnswerMaxTeams is how many teams may give a wrong answer before
+	// it counts as a common mistake rather than a shared one
+	sharedAnswerMaxTeams = 3
+)
+
+// flagToken returns the token an answer would carry if it were a flag
+// made from template, or empty when it can't be one
+func flagToken(template, answer string) string {
+	parts := strings.SplitN(template, TeamFlagPlaceholder, 2)
+	if len(parts) < 2 || !strings.HasPrefix(answer, parts[0]) {
+		return ""
+	}
+	rest := answer[len(parts[0]):]
+	end := len(rest)
+	if next := strings.SplitN(parts[1], TeamFlagPlaceholder, 2)[0]; next != "" {
+		if end = strings.Index(rest, next); end < 0 {
+			return ""
+		}
+	}
+	token := rest[:end]
+	if token == "" || ExpandTeamFlag(template, token) != answer {
+		return ""
+	}
+	return token
+}
+
+// InspectWrongAnswer looks for signs that a wrong answer was shared: the
+// flag made for another team, or an unusual answer another team gave
+// minutes earlier according to the submission log. What it finds is
+// raised as alerts, and the new ones returned. Log the submission first
+func (us *UserService) InspectWrongAnswer(ctx context.Context, teamID int, q Question, answer string) []Alert {
+	var alerts []Alert
+	if q.FlagTemplate != "" {
+		if token := flagToken(q.FlagTemplate, answer); token != "" {
+			alerts = append(alerts, us.checkFlagOwner(ctx, teamID, q, token)...)
+		}
+	}
+	alerts = append(alerts, us.checkSameAnswer(ctx, teamID, q, answer)...)
+	return us.raiseAlerts(ctx, alerts)
+}
+
+// checkSameAnswer returns an alert for each team that gave the same
+// unusual wrong answer within the window
+func (us *UserService) checkSameAnswer(ctx context.Context, teamID int, q Question, answer string) []Alert {
+	if utf8.RuneCountInString(normalizeAnswer(answer)) < sharedAnswerMinLength {
+		return nil
+	}
+	teams, err := us.wrongAnswerTeams(ctx, q.ID, answer)
+	if err != nil {
+		log.Printf("Error looking up answers to question %d: %v", q.ID, err)
+		return nil
+	}
+	if len(teams) > sharedAnswerMaxTeams {
+		return nil
+	}
+
+	var alerts []Alert
+	for _, other := range teams {
+		if other == teamID {
+			continue
+		}
+		alerts = append(alerts, Alert{
+			HuntID:      q.HuntID,
+			Kind:        AlertSameWrongAnswer,
+			TeamID:      teamID,
+			OtherTeamID: other,
+			QuestionID:  q.ID,
+			Detail:      fmt.Sprintf("Gave the same wrong answer within %d minutes: %q", int(SharedAnswerWindow.Minutes()), answer),
+		})
+	}
+	return alerts
+}
+
+// wrongAnswerTeams returns the teams that gave the same wrong answer to a
+// question within the window
+func (us *UserService) wrongAnswerTeams(ctx context.Context, questionID int, answer string) ([]int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	return us.Repo.ListWrongAnswerTeams(ctx, questionID, AnswerHash(answer), time.Now().Add(-SharedAnswerWindow))
+}
+
+// checkFlagOwner returns an alert when token belongs to another team
+func (us *UserService) checkFlagOwner(ctx context.Context, teamID int, q Question, token string) []Alert {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	owner, err := us.Repo.FindTeamFlag(ctx, q.ID, token)
+	if errors.Is(err, sql.ErrNoRows) || owner == teamID {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error looking up flag owner for question %d: %v", q.ID, err)
+		return nil
+	}
+	return []Alert{{
+		HuntID:      q.HuntID,
+		Kind:        AlertFlagShared,
+		TeamID:      teamID,
+		OtherTeamID: owner,
+		QuestionID:  q.ID,
+		Detail:      fmt.Sprintf("Submitted the flag made for another team: %q", ExpandTeamFlag(q.FlagTemplate, token)),
+	}}
+}
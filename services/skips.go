@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/namishh/holmes/database"
+)
+
+// SettingSkipTokens is how many questions each team may skip
+const SettingSkipTokens = "skip_tokens"
+
+var (
+	ErrInvalidSkipTokens = errors.New("the number of skip tokens can't be negative")
+	ErrNoSkipTokens      = errors.New("your team has no skip tokens left")
+	ErrAlreadySkipped    = errors.New("question already skipped")
+)
+
+// GetSkipTokens returns how many questions each team may skip, none until
+// an admin sets it
+func (us *UserService) GetSkipTokens(ctx context.Context) int {
+	value, ok, err := us.GetSetting(ctx, SettingSkipTokens)
+	if err != nil || !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Invalid value %q for setting %s", value, SettingSkipTokens)
+		return 0
+	}
+	return n
+}
+
+// SetSkipTokens sets how many questions each team may skip
+func (us *UserService) SetSkipTokens(ctx context.Context, n int) error {
+	if n < 0 {
+		return ErrInvalidSkipTokens
+	}
+	if err := us.SetSetting(ctx, SettingSkipTokens, strconv.Itoa(n)); err != nil {
+		return err
+	}
+	log.Printf("Teams may skip %d questions", n)
+	return nil
+}
+
+// SkipTokensLeft returns how many more questions a team may skip
+func (us *UserService) SkipTokensLeft(ctx context.Context, teamID int) (int, error) {
+	tokens := us.GetSkipTokens(ctx)
+	if tokens == 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	used, err := us.Repo.CountTeamSkips(ctx, teamID)
+	if err != nil {
+		log.Printf("Error counting skips of team %d: %v", teamID, err)
+		return 0, err
+	}
+	return max(tokens-used, 0), nil
+}
+
+// IsQuestionSkippedByTeam reports whether a team bypassed a question
+func (us *UserService) IsQuestionSkippedByTeam(ctx context.Context, teamID, questionID int) (bool, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	skipped, err := us.Repo.IsSkipped(ctx, teamID, questionID)
+	if err != nil {
+		log.Printf("Error checking if question %d is skipped by team %d: %v", questionID, teamID, err)
+		return false, err
+	}
+	return skipped, nil
+}
+
+// SkipQuestion spends one of a team's skip tokens on a question it hasn't
+// solved. The question counts as done for the team but earns no points,
+// and the team's lock on it is released. It returns the tokens left
+func (us *UserService) SkipQuestion(ctx context.Context, teamID, questionID int) (int, error) {
+	tokens := us.GetSkipTokens(ctx)
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting skip of question %d by team %d: %v", questionID, teamID, err)
+		return 0, err
+	}
+	defer tx.Rollback()
+	q := us.Repo.WithTx(tx)
+
+	solved, err := q.IsCompleted(ctx, teamID, questionID)
+	if err != nil {
+		log.Printf("Error checking solve of question %d by team %d: %v", questionID, teamID, err)
+		return 0, err
+	}
+	if solved {
+		return 0, ErrAlreadySolved
+	}
+
+	skipped, err := q.IsSkipped(ctx, teamID, questionID)
+	if err != nil {
+		log.Printf("Error checking skip of question %d by team %d: %v", questionID, teamID, err)
+		return 0, err
+	}
+	if skipped {
+		return 0, ErrAlreadySkipped
+	}
+
+	used, err := q.CountTeamSkips(ctx, teamID)
+	if err != nil {
+		log.Printf("Error counting skips of team %d: %v", teamID, err)
+		return 0, err
+	}
+	if used >= tokens {
+		return 0, ErrNoSkipTokens
+	}
+
+	skipped, err = q.SkipQuestion(ctx, teamID, questionID)
+	if err != nil {
+		log.Printf("Error skipping question %d for team %d: %v", questionID, teamID, err)
+		return 0, err
+	}
+	if !skipped {
+		return 0, ErrAlreadySkipped
+	}
+	if err := q.DeleteTeamLock(ctx, questionID, teamID); err != nil {
+		log.Printf("Error releasing question %d of team %d: %v", questionID, teamID, err)
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing skip of question %d by team %d: %v", questionID, teamID, err)
+		return 0, err
+	}
+	log.Printf("Team %d skipped question %d, %d skip tokens left", teamID, questionID, tokens-used-1)
+	return tokens - used - 1, nil
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Slack alert types, which organisers choose between with SLACK_ALERTS
+const (
+	SlackSuspicious     = "suspicious"     // cheating alerts
+	SlackHealth         = "health"         // a dependency failing or recovering
+	SlackClarifications = "clarifications" // teams asking about a question
+	SlackLockouts       = "lockouts"       // the admin login locked after failed attempts
+)
+
+// SlackAlertTypes lists every alert type
+var SlackAlertTypes = []string{SlackSuspicious, SlackHealth, SlackClarifications, SlackLockouts}
+
+// ParseSlackAlerts reads a comma separated list of alert types, where
+// "all" or nothing at all means every type. Unknown types are dropped
+func ParseSlackAlerts(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return SlackAlertTypes
+	}
+	var alerts []string
+	for _, part := range strings.Split(s, ",") {
+		switch part = strings.TrimSpace(part); part {
+		case "all":
+			return SlackAlertTypes
+		case SlackSuspicious, SlackHealth, SlackClarifications, SlackLockouts:
+			alerts = append(alerts, part)
+		}
+	}
+	return alerts
+}
+
+const (
+	// slackPostMessageURL is the Web API method bot tokens post with
+	slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+	// slackQueueSize is how many alerts wait to be sent before new ones
+	// are dropped
+	slackQueueSize = 100
+
+	// slackMaxAttempts is how many times an alert is tried before giving up
+	slackMaxAttempts = 4
+
+	// slackRetryBase is the delay before the first retry, doubled after each one
+	slackRetryBase = 5 * time.Second
+)
+
+// SlackConfig is where organiser alerts are posted: an incoming webhook,
+// or a bot token and the channel it posts to
+type SlackConfig struct {
+	WebhookURL string
+	BotToken   string
+	Channel    string   // e.g., "#hunt-ops"; only used with BotToken
+	Alerts     []string // alert types to send
+	BaseURL    string   // where the admin panel is reached, for links
+}
+
+// SlackNotifier posts admin events to a Slack channel. It is a Listener,
+// so alerts are only sent by the instance that raised them
+type SlackNotifier struct {
+	cfg    SlackConfig
+	alerts map[string]bool
+	client *http.Client
+	queue  chan string
+}
+
+// NewSlackNotifier returns nil when neither a webhook nor a bot token is
+// configured, or no alert type is chosen
+func NewSlackNotifier(cfg SlackConfig) *SlackNotifier {
+	if cfg.WebhookURL == "" && cfg.BotToken == "" {
+		return nil
+	}
+	if len(cfg.Alerts) == 0 {
+		log.Println("Slack alerts disabled, no alert types chosen")
+		return nil
+	}
+
+	alerts := make(map[string]bool)
+	for _, a := range cfg.Alerts {
+		alerts[a] = true
+	}
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+
+	return &SlackNotifier{
+		cfg:    cfg,
+		alerts: alerts,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan string, slackQueueSize),
+	}
+}
+
+// Handle queues an alert for the admin events the organisers chose
+func (s *SlackNotifier) Handle(event Event) {
+	if event.TeamID != AdminChannel {
+		return
+	}
+	alert, text := slackMessage(event, s.cfg.BaseURL)
+	if text == "" || !s.alerts[alert] {
+		return
+	}
+
+	select {
+	case s.queue <- text:
+	default:
+		log.Printf("Warning: Slack alert queue full, dropping %s alert", alert)
+	}
+}
+
+// Run sends queued alerts one at a time until ctx is done, waiting out
+// Slack's rate limits and retrying failures with backoff
+func (s *SlackNotifier) Run(ctx context.Context) {
+	for {
+		select {
+		case text := <-s.queue:
+			s.deliver(ctx, text)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver posts one alert, trying up to slackMaxAttempts times
+func (s *SlackNotifier) deliver(ctx context.Context, text string) {
+	for attempt := 1; ; attempt++ {
+		wait, err := s.Send(text)
+		if err == nil {
+			return
+		}
+		if attempt >= slackMaxAttempts {
+			log.Printf("Giving up on Slack alert after %d attempts: %v", attempt, err)
+			return
+		}
+		if wait == 0 {
+			wait = slackRetryBase << (attempt - 1)
+		}
+		log.Printf("Slack alert failed (attempt %d/%d), retrying in %s: %v", attempt, slackMaxAttempts, wait, err)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Send posts a message, returning how long Slack asked to wait before
+// the next one when it rate limited the request
+func (s *SlackNotifier) Send(text string) (time.Duration, error) {
+	target := s.cfg.WebhookURL
+	body := map[string]interface{}{"text": text}
+	if s.cfg.BotToken != "" {
+		target = slackPostMessageURL
+		body["channel"] = s.cfg.Channel
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", "Holmes-Alerts/1.0")
+	if s.cfg.BotToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.BotToken)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return retryAfter(resp.Header, nil), fmt.Errorf("rate limited: %s", resp.Status)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	// The Web API answers 200 even when it didn't post, saying why in the body
+	if s.cfg.BotToken != "" {
+		var result struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return 0, fmt.Errorf("invalid response from Slack: %s", err)
+		}
+		if !result.OK {
+			return 0, fmt.Errorf("slack: %s", result.Error)
+		}
+	}
+	return 0, nil
+}
+
+// slackMessage renders the alert for an admin event and says which alert
+// type it is; events that aren't alerts render nothing
+func slackMessage(event Event, baseURL string) (string, string) {
+	data := event.Data
+	switch event.Type {
+	case EventAlert:
+		text := fmt.Sprintf(":rotating_light: *Suspicious activity* (%s): %s",
+			slackField(data, "kind"), slackTeam(data, "team_name", "team_id"))
+		if data["other_team_id"] != nil && slackField(data, "other_team_id") != "0" {
+			text += " and " + slackTeam(data, "other_team_name", "other_team_id")
+		}
+		if title := slackField(data, "question_title"); title != "" {
+			text += " on *" + slackEscape(title) + "*"
+		}
+		if detail := slackField(data, "detail"); detail != "" {
+			text += "\n" + slackEscape(detail)
+		}
+		return SlackSuspicious, text + slackLink(baseURL, "/su/alerts", "Review alerts")
+
+	case EventClarification:
+		text := fmt.Sprintf(":question: *Clarification requested* by %s", slackTeam(data, "team_name", "team_id"))
+		if title := slackField(data, "question_title"); title != "" {
+			text += " on *" + slackEscape(title) + "*"
+		}
+		if body := slackField(data, "body"); body != "" {
+			text += "\n>" + strings.ReplaceAll(slackEscape(body), "\n", "\n>")
+		}
+		return SlackClarifications, text + slackLink(baseURL, "/su/clarifications", "Answer it")
+
+	case EventAdminLockout:
+		return SlackLockouts, fmt.Sprintf(":lock: *Admin login locked* for %s after %s failed attempts, until %s",
+			slackEscape(slackField(data, "ip")), slackField(data, "attempts"), slackField(data, "until"))
+
+	case EventHealth:
+		if slackField(data, "status") == HealthOK {
+			return SlackHealth, ":white_check_mark: *Health recovered*, every check passes again"
+		}
+		failing, _ := data["failing"].([]string)
+		var lines []string
+		for _, f := range failing {
+			lines = append(lines, "• "+slackEscape(f))
+		}
+		return SlackHealth, ":warning: *Health degraded*\n" + strings.Join(lines, "\n")
+	}
+	return "", ""
+}
+
+// slackField returns a value of an event's data as text
+func slackField(data map[string]interface{}, key string) string {
+	v, ok := data[key]
+	if !ok || v == nil {
+		return ""
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.Format("15:04 MST")
+	}
+	return fmt.Sprint(v)
+}
+
+// slackTeam names a team, falling back to its ID
+func slackTeam(data map[string]interface{}, nameKey, idKey string) string {
+	if name := slackField(data, nameKey); name != "" {
+		return "*" + slackEscape(name) + "*"
+	}
+	return "team #" + slackField(data, idKey)
+}
+
+// slackLink links to a page of the admin panel when the site's address
+// is known
+func slackLink(baseURL, path, label string) string {
+	if baseURL == "" {
+		return ""
+	}
+	return "\n<" + baseURL + path + "|" + label + ">"
+}
+
+// slackEscape escapes the characters Slack reads as markup, so text from
+// teams can't mention anyone or fake links
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
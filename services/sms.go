@@ -0,0 +1,396 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Kinds of text message, as recorded in the outbox
+const (
+	SMSPhoneCode    = "phone_code"
+	SMSHuntOpen     = "hunt_open"
+	SMSFinalWarning = "final_warning"
+	SMSAnnouncement = "announcement"
+	SMSTest         = "test"
+)
+
+const (
+	// SMSMaxAttempts is how many times a text message is tried before
+	// giving up
+	SMSMaxAttempts = 4
+
+	// smsRetryBase is the delay before the first retry, doubled after each
+	// one; texts are about things happening now, so retries come quickly
+	smsRetryBase = 30 * time.Second
+
+	// smsBatch is how many due messages one delivery run sends
+	smsBatch = 50
+
+	// smsMaxLength keeps a message to about three SMS segments
+	smsMaxLength = 480
+
+	// PhoneCodeTTL is how long a code confirming a number works
+	PhoneCodeTTL = 10 * time.Minute
+
+	// phoneCodeMaxAttempts is how many wrong codes use one up
+	phoneCodeMaxAttempts = 5
+
+	// smsOpenGrace is how long after the hunt starts teams are still told
+	// it opened, so a server started late doesn't text about old news
+	smsOpenGrace = 15 * time.Minute
+)
+
+// Settings holding the hunt start and end the texts went out for
+const (
+	SettingSMSOpenSent         = "sms_hunt_open_sent"
+	SettingSMSFinalWarningSent = "sms_final_warning_sent"
+)
+
+var (
+	ErrSMSDisabled      = errors.New("text messages are not set up on this server")
+	ErrInvalidPhone     = errors.New("enter the number in international form, e.g. +44 7700 900123")
+	ErrInvalidPhoneCode = errors.New("this code is wrong or has expired")
+	ErrNoTeamPhone      = errors.New("the team has no phone number")
+)
+
+// TeamPhone is the number a team gets text messages on
+type TeamPhone = repository.TeamPhone
+
+// SMS is a text message in the outbox
+type SMS = repository.SMS
+
+// SMSEnabled reports whether the server can send text messages
+func (us *UserService) SMSEnabled() bool {
+	return us.SMS != nil
+}
+
+// NormalizePhone reads a number in international form, allowing the
+// spaces, dashes, dots and brackets people write numbers with, and
+// returns it in E.164 form
+func NormalizePhone(s string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(s) {
+		switch {
+		case r == '+' && i == 0, r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+	phone := b.String()
+	if !strings.HasPrefix(phone, "+") || len(phone) < 9 || len(phone) > 16 || phone[1] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return phone, nil
+}
+
+// QueueSMS queues a text message for one number
+func (us *UserService) QueueSMS(ctx context.Context, to, kind, body string) error {
+	if us.SMS == nil {
+		return ErrSMSDisabled
+	}
+	if utf8.RuneCountInString(body) > smsMaxLength {
+		body = string([]rune(body)[:smsMaxLength-1]) + "…"
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.CreateSMS(ctx, to, kind, body, time.Now()); err != nil {
+		log.Printf("Error queueing %s text to %s: %v", kind, to, err)
+		return err
+	}
+	return nil
+}
+
+// GetRecentSMS returns the latest text messages in the outbox, newest first
+func (us *UserService) GetRecentSMS(ctx context.Context, limit int) ([]SMS, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	messages, err := us.Repo.ListRecentSMS(ctx, limit)
+	if err != nil {
+		log.Printf("Error getting text messages: %v", err)
+		return nil, err
+	}
+	if messages == nil {
+		messages = []SMS{}
+	}
+	return messages, nil
+}
+
+// DeliverDueSMS sends every text message that is due, retrying failures
+// with exponential backoff until SMSMaxAttempts is reached
+func (us *UserService) DeliverDueSMS(ctx context.Context) {
+	if us.SMS == nil {
+		return
+	}
+
+	due, err := func() ([]SMS, error) {
+		ctx, cancel := database.WithQueryTimeout(ctx)
+		defer cancel()
+		return us.Repo.ListDueSMS(ctx, SMSMaxAttempts, time.Now(), smsBatch)
+	}()
+	if err != nil {
+		log.Printf("Error getting due text messages: %v", err)
+		return
+	}
+
+	for _, m := range due {
+		var sentAt *time.Time
+		lastError := ""
+		if err := us.SMS.Send(ctx, m.Recipient, m.Body); err != nil {
+			lastError = err.Error()
+			log.Printf("Text %d to %s failed (attempt %d/%d): %v", m.ID, m.Recipient, m.Attempts+1, SMSMaxAttempts, err)
+		} else {
+			now := time.Now()
+			sentAt = &now
+		}
+
+		next := time.Now().Add(smsRetryBase << m.Attempts)
+		func() {
+			ctx, cancel := database.WithQueryTimeout(ctx)
+			defer cancel()
+			if err := us.Repo.RecordSMSAttempt(ctx, m.ID, lastError, sentAt, next); err != nil {
+				log.Printf("Error recording attempt for text %d: %v", m.ID, err)
+			}
+		}()
+	}
+}
+
+// queueTeamSMS texts every team of a hunt with a confirmed number, or
+// every team when huntID is 0, returning how many messages were queued
+func (us *UserService) queueTeamSMS(ctx context.Context, huntID int, kind, body string) (int, error) {
+	phones, err := func() ([]TeamPhone, error) {
+		ctx, cancel := database.WithQueryTimeout(ctx)
+		defer cancel()
+		return us.Repo.ListVerifiedPhones(ctx, huntID)
+	}()
+	if err != nil {
+		log.Printf("Error listing team phone numbers: %v", err)
+		return 0, err
+	}
+
+	for i, p := range phones {
+		if err := us.QueueSMS(ctx, p.Phone, kind, body); err != nil {
+			return i, err
+		}
+	}
+	return len(phones), nil
+}
+
+// QueueAnnouncementSMS texts an announcement to every team that opted in,
+// returning how many messages were queued
+func (us *UserService) QueueAnnouncementSMS(ctx context.Context, title, message, link string) (int, error) {
+	if us.SMS == nil {
+		return 0, ErrSMSDisabled
+	}
+	body := title
+	if message != "" {
+		body += "\n" + message
+	}
+	if strings.HasPrefix(link, "/") {
+		link = us.SMS.Link(link)
+	}
+	if link != "" {
+		body += "\n" + link
+	}
+	return us.queueTeamSMS(ctx, 0, SMSAnnouncement, body)
+}
+
+// SendHuntOpenSMS texts the teams that opted in once their hunt starts,
+// once per start time. It returns how many messages were queued
+func (us *UserService) SendHuntOpenSMS(ctx context.Context) (int, error) {
+	if us.SMS == nil {
+		return 0, nil
+	}
+	return us.forEachHunt(ctx, func(huntID int) (int, error) {
+		return us.sendHuntOpenSMS(ctx, huntID)
+	})
+}
+
+func (us *UserService) sendHuntOpenSMS(ctx context.Context, huntID int) (int, error) {
+	window := us.GetHuntWindow(ctx, huntID)
+	now := time.Now()
+	if window.Start.IsZero() || now.Before(window.Start) || now.After(window.Start.Add(smsOpenGrace)) || window.Ended(now) {
+		return 0, nil
+	}
+	key := window.Start.UTC().Format(time.RFC3339)
+	setting := huntSettingKey(SettingSMSOpenSent, huntID)
+	if sent, _, err := us.GetSetting(ctx, setting); err != nil || sent == key {
+		return 0, err
+	}
+	// Marked first, so a failure part way never texts teams twice
+	if err := us.SetSetting(ctx, setting, key); err != nil {
+		return 0, err
+	}
+
+	body := "The hunt is open. Good luck!"
+	if link := us.SMS.Link("/hunt"); link != "" {
+		body += "\n" + link
+	}
+	n, err := us.queueTeamSMS(ctx, huntID, SMSHuntOpen, body)
+	if err == nil {
+		log.Printf("Texted %d teams that hunt %d opened at %s", n, huntID, key)
+	}
+	return n, err
+}
+
+// SendFinalWarningSMS texts the teams that opted in once their hunt's end
+// is less than lead away, once per end time. It returns how many
+// messages were queued
+func (us *UserService) SendFinalWarningSMS(ctx context.Context, lead time.Duration) (int, error) {
+	if us.SMS == nil || lead <= 0 {
+		return 0, nil
+	}
+	return us.forEachHunt(ctx, func(huntID int) (int, error) {
+		return us.sendFinalWarningSMS(ctx, huntID, lead)
+	})
+}
+
+func (us *UserService) sendFinalWarningSMS(ctx context.Context, huntID int, lead time.Duration) (int, error) {
+	window := us.GetHuntWindow(ctx, huntID)
+	now := time.Now()
+	if window.End.IsZero() || !window.Started(now) || !now.Before(window.End) || now.Add(lead).Before(window.End) {
+		return 0, nil
+	}
+	key := window.End.UTC().Format(time.RFC3339)
+	setting := huntSettingKey(SettingSMSFinalWarningSent, huntID)
+	if sent, _, err := us.GetSetting(ctx, setting); err != nil || sent == key {
+		return 0, err
+	}
+	if err := us.SetSetting(ctx, setting, key); err != nil {
+		return 0, err
+	}
+
+	body := fmt.Sprintf("The hunt ends %s, at %s. Get your last answers in!",
+		startsIn(window.End.Sub(now)), window.End.UTC().Format("15:04 MST"))
+	n, err := us.queueTeamSMS(ctx, huntID, SMSFinalWarning, body)
+	if err == nil {
+		log.Printf("Texted %d teams that hunt %d ends at %s", n, huntID, key)
+	}
+	return n, err
+}
+
+// SendTestSMS queues a test text message, to check the provider settings
+func (us *UserService) SendTestSMS(ctx context.Context, to string) error {
+	phone, err := NormalizePhone(to)
+	if err != nil {
+		return err
+	}
+	return us.QueueSMS(ctx, phone, SMSTest, "This is a test message from the hunt. If you are reading it, text messages work.")
+}
+
+// GetTeamPhone returns a team's number, or ErrNoTeamPhone
+func (us *UserService) GetTeamPhone(ctx context.Context, teamID int) (TeamPhone, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	phone, err := us.Repo.GetTeamPhone(ctx, teamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TeamPhone{}, ErrNoTeamPhone
+	}
+	if err != nil {
+		log.Printf("Error getting phone number of team %d: %v", teamID, err)
+		return TeamPhone{}, err
+	}
+	return phone, nil
+}
+
+// RequestPhoneCode sets a team's number, unconfirmed, and texts it the
+// code that confirms it. Until then the number gets nothing else
+func (us *UserService) RequestPhoneCode(ctx context.Context, teamID int, phone string) error {
+	if us.SMS == nil {
+		return ErrSMSDisabled
+	}
+	phone, err := NormalizePhone(phone)
+	if err != nil {
+		return err
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		log.Printf("Error generating phone code: %v", err)
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	err = func() error {
+		ctx, cancel := database.WithQueryTimeout(ctx)
+		defer cancel()
+		now := time.Now()
+		return us.Repo.SetTeamPhone(ctx, teamID, phone, hashPhoneCode(teamID, code), now.Add(PhoneCodeTTL), now)
+	}()
+	if err != nil {
+		log.Printf("Error setting phone number of team %d: %v", teamID, err)
+		return err
+	}
+
+	return us.QueueSMS(ctx, phone, SMSPhoneCode,
+		fmt.Sprintf("Your hunt confirmation code is %s. It works for %d minutes.", code, int(PhoneCodeTTL.Minutes())))
+}
+
+// ConfirmTeamPhone confirms a team's number with the code texted to it.
+// A code is used up after phoneCodeMaxAttempts wrong guesses
+func (us *UserService) ConfirmTeamPhone(ctx context.Context, teamID int, code string) error {
+	phone, err := us.GetTeamPhone(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	if phone.VerifiedAt != nil {
+		return nil
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if phone.CodeHash == "" || phone.CodeExpiresAt == nil || time.Now().After(*phone.CodeExpiresAt) ||
+		phone.CodeAttempts >= phoneCodeMaxAttempts {
+		return ErrInvalidPhoneCode
+	}
+	if subtle.ConstantTimeCompare([]byte(hashPhoneCode(teamID, strings.TrimSpace(code))), []byte(phone.CodeHash)) != 1 {
+		if err := us.Repo.CountPhoneCodeAttempt(ctx, teamID); err != nil {
+			log.Printf("Error counting phone code attempt of team %d: %v", teamID, err)
+			return err
+		}
+		return ErrInvalidPhoneCode
+	}
+
+	if err := us.Repo.VerifyTeamPhone(ctx, teamID, time.Now()); err != nil {
+		log.Printf("Error confirming phone number of team %d: %v", teamID, err)
+		return err
+	}
+	log.Printf("Team %d confirmed its phone number", teamID)
+	return nil
+}
+
+// RemoveTeamPhone stops texting a team
+func (us *UserService) RemoveTeamPhone(ctx context.Context, teamID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeleteTeamPhone(ctx, teamID); err != nil {
+		log.Printf("Error removing phone number of team %d: %v", teamID, err)
+		return err
+	}
+	return nil
+}
+
+// hashPhoneCode hashes a confirmation code with the team it was made for,
+// as codes are short enough to repeat across teams
+func hashPhoneCode(teamID int, code string) string {
+	return hashEmailToken(fmt.Sprintf("%d:%s", teamID, code))
+}
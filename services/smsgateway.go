@@ -0,0 +1,183 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SMS providers
+const (
+	SMSTwilio  = "twilio"  // Twilio's Messages API
+	SMSWebhook = "webhook" // a JSON POST to a gateway of your own
+)
+
+// smsTimeout bounds one request to the provider
+const smsTimeout = 15 * time.Second
+
+// twilioAPIURL is where Twilio's REST API is reached
+const twilioAPIURL = "https://api.twilio.com"
+
+// SMSProvider sends one text message to a number in E.164 form, e.g.
+// "+447700900123". Implement it to send through a gateway without a
+// built-in provider
+type SMSProvider interface {
+	Send(ctx context.Context, to, body string) error
+}
+
+// SMSConfig selects and configures the SMS provider
+type SMSConfig struct {
+	// Provider is "twilio" or "webhook"; empty turns text messages off
+	Provider string
+
+	// Twilio's account and the number or messaging service ("MG...")
+	// messages are sent from
+	AccountSID string
+	AuthToken  string
+	From       string
+
+	// The webhook messages are POSTed to as {"to": ..., "body": ...},
+	// with Token as a bearer token when set
+	WebhookURL string
+	Token      string
+
+	// Gateway is a provider of your own, used instead of Provider
+	Gateway SMSProvider
+
+	// BaseURL is where the site is reached, for links in messages
+	BaseURL string
+}
+
+// SMSSender sends text messages through the configured provider
+type SMSSender struct {
+	provider SMSProvider
+	baseURL  string
+}
+
+// NewSMSSender returns nil when no provider is configured, which turns
+// text messages off
+func NewSMSSender(cfg SMSConfig) (*SMSSender, error) {
+	provider := cfg.Gateway
+	if provider == nil {
+		client := &http.Client{Timeout: smsTimeout}
+		switch cfg.Provider {
+		case "":
+			return nil, nil
+		case SMSTwilio:
+			if cfg.AccountSID == "" || cfg.AuthToken == "" || cfg.From == "" {
+				return nil, fmt.Errorf("twilio needs an account SID, auth token and sender")
+			}
+			provider = &twilioSMS{apiURL: twilioAPIURL, sid: cfg.AccountSID, token: cfg.AuthToken, from: cfg.From, client: client}
+		case SMSWebhook:
+			if cfg.WebhookURL == "" {
+				return nil, fmt.Errorf("the webhook provider needs a URL")
+			}
+			provider = &webhookSMS{url: cfg.WebhookURL, token: cfg.Token, client: client}
+		default:
+			return nil, fmt.Errorf("unknown SMS provider %q", cfg.Provider)
+		}
+	}
+	return &SMSSender{provider: provider, baseURL: strings.TrimSuffix(cfg.BaseURL, "/")}, nil
+}
+
+// Send delivers one message
+func (s *SMSSender) Send(ctx context.Context, to, body string) error {
+	ctx, cancel := context.WithTimeout(ctx, smsTimeout)
+	defer cancel()
+	return s.provider.Send(ctx, to, body)
+}
+
+// Link turns a site path into an absolute URL for a message, or nothing
+// when the site's address isn't known
+func (s *SMSSender) Link(path string) string {
+	if s.baseURL == "" {
+		return ""
+	}
+	return s.baseURL + path
+}
+
+// twilioSMS sends through Twilio's Messages API
+type twilioSMS struct {
+	apiURL string
+	sid    string
+	token  string
+	from   string
+	client *http.Client
+}
+
+func (t *twilioSMS) Send(ctx context.Context, to, body string) error {
+	form := url.Values{"To": {to}, "Body": {body}}
+	if strings.HasPrefix(t.from, "MG") {
+		form.Set("MessagingServiceSid", t.from)
+	} else {
+		form.Set("From", t.from)
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", t.apiURL, url.PathEscape(t.sid))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.sid, t.token)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var twErr struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(respBody, &twErr) == nil && twErr.Message != "" {
+			return fmt.Errorf("twilio error %d: %s", twErr.Code, twErr.Message)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// webhookSMS POSTs each message to a gateway of the organisers' own
+type webhookSMS struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (w *webhookSMS) Send(ctx context.Context, to, body string) error {
+	payload, err := json.Marshal(map[string]string{"to": to, "body": body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Holmes-SMS/1.0")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/namishh/holmes/database"
+)
+
+// ErrAlreadySolved is returned by RecordSolve when the team's solve was
+// already recorded, e.g. by a teammate submitting at the same moment
+var ErrAlreadySolved = errors.New("question already solved")
+
+// Solve is a recorded correct answer. Pending solves are by teams flagged
+// for review and count for nothing until an admin approves them
+type Solve struct {
+	TeamID     int
+	QuestionID int
+	Points     int
+	Pending    bool
+	FirstBlood bool
+	Streak     int // correct answers in a row, this one included
+	Bonus      int // streak bonus paid on top of Points
+	TimeTaken  int // seconds since the team opened the question, 0 if untimed
+	SolvedAt   time.Time
+}
+
+// RecordSolve records a correct answer in one transaction: the solve
+// worth points, which partial credit makes less than the question's, the
+// points with any streak bonus, the team's last answer time, the
+// question timer, the quota count and the release of the question lock.
+// Either all of it is stored or none of it is. A flagged team's solve is
+// queued for review instead of paying points, extending the streak or
+// taking first blood
+func (us *UserService) RecordSolve(ctx context.Context, teamID, questionID, points int) (Solve, error) {
+	bonus := us.GetStreakBonus(ctx)
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	solve := Solve{TeamID: teamID, QuestionID: questionID, Points: points, SolvedAt: time.Now()}
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting solve of question %d by team %d: %v", questionID, teamID, err)
+		return solve, err
+	}
+	defer tx.Rollback()
+	q := us.Repo.WithTx(tx)
+
+	flagged, err := q.GetTeamFlagged(ctx, teamID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error checking review of team %d: %v", teamID, err)
+		return solve, err
+	}
+	solve.Pending = flagged.Valid
+
+	solvedBefore, err := q.CountQuestionSolves(ctx, questionID)
+	if err != nil {
+		log.Printf("Error checking previous solves of question %d: %v", questionID, err)
+		return solve, err
+	}
+
+	inserted, err := q.MarkCompleted(ctx, teamID, questionID, points)
+	if err != nil {
+		log.Printf("Error marking question %d as completed for team %d: %v", questionID, teamID, err)
+		return solve, err
+	}
+	if !inserted {
+		return solve, ErrAlreadySolved
+	}
+
+	if solve.Pending {
+		err := q.CreateSolveReview(ctx, SolveReview{TeamID: teamID, QuestionID: questionID, Points: points, Status: ReviewPending, CreatedAt: solve.SolvedAt})
+		if err != nil {
+			log.Printf("Error queueing solve of question %d by team %d for review: %v", questionID, teamID, err)
+			return solve, err
+		}
+	} else {
+		solve.FirstBlood = solvedBefore == 0
+
+		if solve.Streak, err = q.IncrementStreak(ctx, teamID); err != nil {
+			log.Printf("Error extending streak of team %d: %v", teamID, err)
+			return solve, err
+		}
+		if solve.Bonus = bonus.For(solve.Streak); solve.Bonus > 0 {
+			if err := q.SetSolveBonus(ctx, teamID, questionID, solve.Bonus); err != nil {
+				log.Printf("Error recording streak bonus of team %d: %v", teamID, err)
+				return solve, err
+			}
+		}
+
+		if err := q.AddSolvePoints(ctx, teamID, points+solve.Bonus, solve.SolvedAt); err != nil {
+			log.Printf("Error adding points to team %d: %v", teamID, err)
+			return solve, err
+		}
+	}
+
+	// The timer is missing if the question was never opened through the
+	// game flow, e.g. an answer posted straight to the API
+	startedAt, err := q.GetTimerStart(ctx, teamID, questionID)
+	switch {
+	case err == nil:
+		solve.TimeTaken = int(solve.SolvedAt.Sub(startedAt).Seconds())
+		if err := q.CompleteTimer(ctx, teamID, questionID, solve.SolvedAt, solve.TimeTaken); err != nil {
+			log.Printf("Error stopping timer for team %d, question %d: %v", teamID, questionID, err)
+			return solve, err
+		}
+	case err != sql.ErrNoRows:
+		log.Printf("Error getting start time for team %d, question %d: %v", teamID, questionID, err)
+		return solve, err
+	}
+
+	if err := q.IncrementQuota(ctx, teamID); err != nil {
+		log.Printf("Error incrementing quota count for team %d: %v", teamID, err)
+		return solve, err
+	}
+
+	if _, err := q.DeleteLock(ctx, questionID); err != nil {
+		log.Printf("Error unlocking question %d: %v", questionID, err)
+		return solve, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing solve of question %d by team %d: %v", questionID, teamID, err)
+		return solve, err
+	}
+
+	if solve.Pending {
+		log.Printf("Team %d solved question %d for %d points, waiting for review (%d seconds)", teamID, questionID, points, solve.TimeTaken)
+		return solve, nil
+	}
+	log.Printf("Team %d solved question %d for %d points and a %d streak bonus (%d seconds)", teamID, questionID, points, solve.Bonus, solve.TimeTaken)
+	return solve, nil
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Spectator is a read-only account for faculty and sponsors watching a
+// hunt. It sees question titles and the leaderboard but is never a team,
+// so it can't lock, answer or use up a quota
+type Spectator = repository.Spectator
+
+// SpectatorQuestion is a question's title, points and solve count
+type SpectatorQuestion = repository.SpectatorQuestion
+
+var (
+	ErrSpectatorNotFound = errors.New("spectator not found")
+	ErrSpectatorExists   = errors.New("an account with that email already exists")
+	ErrInvalidSpectator  = errors.New("a spectator needs a name, a valid email and a password of at least 8 characters")
+)
+
+// CreateSpectator adds a spectator to a hunt. Its email can't be one a
+// team signs in with
+func (us *UserService) CreateSpectator(ctx context.Context, name, email, password string, huntID int) (Spectator, error) {
+	name, email = strings.TrimSpace(name), strings.TrimSpace(email)
+	if _, err := mail.ParseAddress(email); name == "" || err != nil || len(password) < 8 {
+		return Spectator{}, ErrInvalidSpectator
+	}
+	if huntID == 0 {
+		huntID = DefaultHuntID
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if _, err := us.Repo.GetTeamByEmail(ctx, email); err == nil {
+		return Spectator{}, ErrSpectatorExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error checking email of spectator %s: %v", email, err)
+		return Spectator{}, err
+	}
+	if _, err := us.Repo.GetSpectatorByEmail(ctx, email); err == nil {
+		return Spectator{}, ErrSpectatorExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error checking email of spectator %s: %v", email, err)
+		return Spectator{}, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return Spectator{}, err
+	}
+	if err := us.Repo.CreateSpectator(ctx, name, email, string(hash), huntID, time.Now()); err != nil {
+		log.Printf("Error creating spectator %s: %v", email, err)
+		return Spectator{}, err
+	}
+
+	s, err := us.Repo.GetSpectatorByEmail(ctx, email)
+	if err != nil {
+		log.Printf("Error fetching spectator %s: %v", email, err)
+		return Spectator{}, err
+	}
+	log.Printf("Added spectator %s to hunt %d", email, huntID)
+	return s, nil
+}
+
+// GetSpectatorByEmail returns the spectator signing in with an email, or
+// ErrSpectatorNotFound
+func (us *UserService) GetSpectatorByEmail(ctx context.Context, email string) (Spectator, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	s, err := us.Repo.GetSpectatorByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Spectator{}, ErrSpectatorNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching spectator %s: %v", email, err)
+	}
+	return s, err
+}
+
+// GetSpectator returns a spectator, or ErrSpectatorNotFound
+func (us *UserService) GetSpectator(ctx context.Context, id int) (Spectator, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	s, err := us.Repo.GetSpectator(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Spectator{}, ErrSpectatorNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching spectator %d: %v", id, err)
+	}
+	return s, err
+}
+
+// GetSpectators lists the spectators of a hunt, newest first
+func (us *UserService) GetSpectators(ctx context.Context, huntID int) ([]Spectator, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	spectators, err := us.Repo.ListSpectators(ctx, huntID)
+	if err != nil {
+		log.Printf("Error listing spectators of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+	if spectators == nil {
+		spectators = make([]Spectator, 0)
+	}
+	return spectators, nil
+}
+
+// DeleteSpectator removes a spectator; its next request signs it out
+func (us *UserService) DeleteSpectator(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ok, err := us.Repo.DeleteSpectator(ctx, id)
+	if err != nil {
+		log.Printf("Error deleting spectator %d: %v", id, err)
+		return err
+	}
+	if !ok {
+		return ErrSpectatorNotFound
+	}
+	log.Printf("Removed spectator %d", id)
+	return nil
+}
+
+// GetSpectatorQuestions returns the titles, points and solve counts of a
+// hunt's questions, without their bodies or answers
+func (us *UserService) GetSpectatorQuestions(ctx context.Context, huntID int) ([]SpectatorQuestion, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	questions, err := us.Repo.ListSpectatorQuestions(ctx, huntID)
+	if err != nil {
+		log.Printf("Error listing questions of hunt %d for spectators: %v", huntID, err)
+		return nil, err
+	}
+	if questions == nil {
+		questions = make([]SpectatorQuestion, 0)
+	}
+	return questions, nil
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// QuestionSolveStats is how many teams solved a question
+type QuestionSolveStats = repository.QuestionSolveCount
+
+// FirstBlood is the first team to solve a question
+type FirstBlood = repository.FirstSolve
+
+// HuntStats is a public summary of the hunt's progress
+type HuntStats struct {
+	TeamCount   int                  `json:"team_count"`
+	TotalSolves int                  `json:"total_solves"`
+	Questions   []QuestionSolveStats `json:"questions"`
+	FirstBloods []FirstBlood         `json:"first_bloods"`
+}
+
+// GetHuntStats computes a hunt's team count, per-question solve counts and first bloods
+func (us *UserService) GetHuntStats(ctx context.Context, huntID int) (HuntStats, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	stats := HuntStats{
+		Questions:   []QuestionSolveStats{},
+		FirstBloods: []FirstBlood{},
+	}
+
+	var err error
+	stats.TeamCount, err = us.Repo.CountTeams(ctx, huntID)
+	if err != nil {
+		log.Printf("Error counting teams: %v", err)
+		return stats, err
+	}
+
+	questions, err := us.Repo.CountSolvesPerQuestion(ctx, huntID)
+	if err != nil {
+		log.Printf("Error getting solve counts: %v", err)
+		return stats, err
+	}
+	for _, q := range questions {
+		stats.TotalSolves += q.Solves
+		stats.Questions = append(stats.Questions, q)
+	}
+
+	// Ties on completed_at come back ordered by team ID; the first one
+	// is kept so every question has exactly one first blood
+	firstSolves, err := us.Repo.ListFirstSolves(ctx, huntID)
+	if err != nil {
+		log.Printf("Error getting first bloods: %v", err)
+		return stats, err
+	}
+
+	seen := make(map[int]bool)
+	for _, fb := range firstSolves {
+		if seen[fb.QuestionID] {
+			continue
+		}
+		seen[fb.QuestionID] = true
+		stats.FirstBloods = append(stats.FirstBloods, fb)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+)
+
+// ErrObjectNotFound is returned when opening a key with nothing stored under it
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage holds uploaded media. Objects are addressed by key, which is
+// the filename recorded in the images, videos and audios tables
+type Storage interface {
+	// Put stores size bytes read from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Delete removes the object stored under key; deleting a missing
+	// object is not an error
+	Delete(ctx context.Context, key string) error
+
+	// Open returns a seekable reader over the object stored under key,
+	// or ErrObjectNotFound
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error)
+
+	// URL returns the backend's own address for the object; buckets are
+	// private, so clients are given the media proxy URL instead
+	URL(key string) string
+
+	// Exists reports whether an object is stored under key
+	Exists(ctx context.Context, key string) (bool, error)
+
+	// List returns every stored object; ContentType is not filled in
+	List(ctx context.Context) ([]ObjectInfo, error)
+}
+
+// StorageConfig selects and configures the storage backend
+type StorageConfig struct {
+	// Backend is "s3", "minio", "gcs" or "local"; empty picks MinIO if an
+	// endpoint is configured and local disk otherwise
+	Backend string
+
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+
+	// PublicURL overrides the base of object URLs, e.g. a CDN in front of
+	// the bucket; defaults to the endpoint's path-style bucket URL
+	PublicURL string
+
+	// LocalDir and LocalURL configure the local backend, defaulting to
+	// LocalUploadDir served through the media proxy
+	LocalDir string
+	LocalURL string
+}
+
+// NewStorage connects to the configured backend
+// Falls back to local disk when the backend can't be reached so that
+// uploads keep working in development
+func NewStorage(cfg StorageConfig) Storage {
+	backend := cfg.Backend
+	if backend == "" && cfg.Endpoint != "" {
+		backend = "minio"
+	}
+
+	switch backend {
+	case "s3", "minio":
+		store, err := NewS3Storage(cfg)
+		if err != nil {
+			log.Printf("Warning: Failed to initialize %s storage: %v - storing uploads in %s", backend, err, LocalUploadDir)
+			break
+		}
+		log.Printf("Successfully connected to bucket '%s' at %s (SSL: %v)", cfg.Bucket, cfg.Endpoint, cfg.UseSSL)
+		return store
+	case "gcs":
+		store, err := NewGCSStorage(cfg)
+		if err != nil {
+			log.Printf("Warning: Failed to initialize GCS storage: %v - storing uploads in %s", err, LocalUploadDir)
+			break
+		}
+		log.Printf("Successfully connected to GCS bucket '%s'", cfg.Bucket)
+		return store
+	case "", "local":
+		log.Printf("Object storage not configured - storing uploads in %s", LocalUploadDir)
+	default:
+		log.Printf("Warning: Unknown storage backend %q - storing uploads in %s", backend, LocalUploadDir)
+	}
+
+	return NewLocalStorage(cfg.LocalDir, cfg.LocalURL)
+}
+
+// PresignedStorage is implemented by backends that let clients upload
+// straight to the store, bypassing the app server
+type PresignedStorage interface {
+	Storage
+
+	// PresignPut returns a URL that accepts a single PUT of the object
+	// stored under key until expiry elapses
+	PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
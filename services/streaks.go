@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/namishh/holmes/database"
+)
+
+// Settings that reward teams for correct answers in a row
+const (
+	SettingStreakLength = "streak_length"
+	SettingStreakBonus  = "streak_bonus"
+)
+
+// DefaultStreakLength is how many answers in a row must be right before
+// bonuses are paid, until an admin sets it
+const DefaultStreakLength = 3
+
+var ErrInvalidStreakBonus = errors.New("the streak length must be at least 1 and the bonus can't be negative")
+
+// StreakBonus pays Points on top of every solve once a team has answered
+// Length questions in a row without a wrong answer. No bonus is paid when
+// Points is zero
+type StreakBonus struct {
+	Length int `json:"length"`
+	Points int `json:"points"`
+}
+
+// For returns the bonus a solve that makes a streak of n earns
+func (b StreakBonus) For(n int) int {
+	if b.Points <= 0 || n < b.Length {
+		return 0
+	}
+	return b.Points
+}
+
+// GetStreakBonus returns what teams earn for correct answers in a row
+func (us *UserService) GetStreakBonus(ctx context.Context) StreakBonus {
+	bonus := StreakBonus{Length: DefaultStreakLength}
+	if value, ok, err := us.GetSetting(ctx, SettingStreakLength); err == nil && ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			log.Printf("Invalid value %q for setting %s", value, SettingStreakLength)
+		} else {
+			bonus.Length = n
+		}
+	}
+	if value, ok, err := us.GetSetting(ctx, SettingStreakBonus); err == nil && ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			log.Printf("Invalid value %q for setting %s", value, SettingStreakBonus)
+		} else {
+			bonus.Points = n
+		}
+	}
+	return bonus
+}
+
+// SetStreakBonus sets what teams earn for correct answers in a row
+func (us *UserService) SetStreakBonus(ctx context.Context, b StreakBonus) error {
+	if b.Length < 1 || b.Points < 0 {
+		return ErrInvalidStreakBonus
+	}
+	if err := us.SetSetting(ctx, SettingStreakLength, strconv.Itoa(b.Length)); err != nil {
+		return err
+	}
+	if err := us.SetSetting(ctx, SettingStreakBonus, strconv.Itoa(b.Points)); err != nil {
+		return err
+	}
+	log.Printf("Streak bonus set to %d points from %d answers in a row", b.Points, b.Length)
+	return nil
+}
+
+// GetTeamStreak returns how many answers in a row a team got right
+func (us *UserService) GetTeamStreak(ctx context.Context, teamID int) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	streak, err := us.Repo.GetTeamStreak(ctx, teamID)
+	if err != nil {
+		log.Printf("Error fetching streak of team %d: %v", teamID, err)
+		return 0, err
+	}
+	return streak, nil
+}
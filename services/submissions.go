@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Submission is one answer a team submitted
+type Submission = repository.Submission
+
+const (
+	// DefaultSubmissionLimit is how many submissions are listed when no
+	// limit is asked for
+	DefaultSubmissionLimit = 200
+	// MaxSubmissionLimit caps how many submissions are listed at once
+	MaxSubmissionLimit = 1000
+	// MaxLoggedAnswerLength caps the text kept of a wrong answer
+	MaxLoggedAnswerLength = 200
+)
+
+// normalizeAnswer lowercases an answer and collapses its whitespace, so
+// answers differing only in those compare equal
+func normalizeAnswer(answer string) string {
+	return strings.Join(strings.Fields(strings.ToLower(answer)), " ")
+}
+
+// AnswerHash is the hash an answer is logged under: the SHA-256 of its
+// normalized form, in hex
+func AnswerHash(answer string) string {
+	sum := sha256.Sum256([]byte(normalizeAnswer(answer)))
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordSubmission logs an answer a team submitted, whether it was right,
+// the penalty it cost and the address it came from. The text of a right
+// answer is left out, since it is the flag
+func (us *UserService) RecordSubmission(ctx context.Context, teamID, questionID int, answer, ip string, correct bool, penalty int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	sub := Submission{
+		TeamID:     teamID,
+		QuestionID: questionID,
+		AnswerHash: AnswerHash(answer),
+		Correct:    correct,
+		Penalty:    penalty,
+		IP:         ip,
+		CreatedAt:  time.Now(),
+	}
+	if !correct {
+		sub.Answer = strings.TrimSpace(answer)
+		if runes := []rune(sub.Answer); len(runes) > MaxLoggedAnswerLength {
+			sub.Answer = string(runes[:MaxLoggedAnswerLength])
+		}
+	}
+	err := us.Repo.CreateSubmission(ctx, sub)
+	if err != nil {
+		log.Printf("Error logging submission of team %d for question %d: %v", teamID, questionID, err)
+	}
+	return err
+}
+
+// GetSubmissions returns the latest submissions in a hunt, newest first,
+// only those of one team or question when teamID or questionID is set
+func (us *UserService) GetSubmissions(ctx context.Context, huntID, teamID, questionID, limit int) ([]Submission, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if limit <= 0 {
+		limit = DefaultSubmissionLimit
+	}
+	limit = min(limit, MaxSubmissionLimit)
+
+	submissions, err := us.Repo.ListSubmissions(ctx, huntID, teamID, questionID, limit)
+	if err != nil {
+		log.Printf("Error listing submissions of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+	if submissions == nil {
+		submissions = make([]Submission, 0)
+	}
+	return submissions, nil
+}
+
+// GetTeamSubmissions returns a team's answers to a question, newest first
+func (us *UserService) GetTeamSubmissions(ctx context.Context, teamID, questionID int) ([]Submission, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	submissions, err := us.Repo.ListTeamSubmissions(ctx, teamID, questionID)
+	if err != nil {
+		log.Printf("Error listing submissions of team %d for question %d: %v", teamID, questionID, err)
+		return nil, err
+	}
+	if submissions == nil {
+		submissions = make([]Submission, 0)
+	}
+	return submissions, nil
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// TelegramChat is a Telegram chat linked to a team
+type TelegramChat = repository.TelegramChat
+
+const (
+	// telegramLinkPurpose is the token purpose of the codes that link a chat
+	telegramLinkPurpose = "telegram"
+
+	// TelegramLinkTTL is how long a link code works
+	TelegramLinkTTL = 15 * time.Minute
+
+	// telegramAPI is where the Bot API is reached unless a self-hosted
+	// Bot API server is configured
+	telegramAPI = "https://api.telegram.org"
+
+	// telegramPollTimeout is how long a getUpdates call waits for updates
+	telegramPollTimeout = 30 * time.Second
+
+	// telegramSendInterval spaces out messages to stay under Telegram's
+	// limit of about 30 a second
+	telegramSendInterval = 40 * time.Millisecond
+
+	// telegramMaxAttempts is how many times a message is tried before giving up
+	telegramMaxAttempts = 3
+
+	// telegramQueueSize is how many notifications wait to be sent before
+	// new ones are dropped
+	telegramQueueSize = 100
+)
+
+var (
+	ErrInvalidTelegramCode = errors.New("this link code is invalid or has expired")
+	ErrTelegramNotLinked   = errors.New("this chat isn't linked to a team")
+
+	// ErrTelegramConflict is getUpdates failing because another instance
+	// is polling for the same bot
+	ErrTelegramConflict = errors.New("another instance is polling for updates")
+)
+
+// NewTelegramLinkCode makes a one-time code that links the chat it is sent
+// from to the team, replacing the team's earlier codes
+func (us *UserService) NewTelegramLinkCode(ctx context.Context, teamID int) (string, error) {
+	return us.newEmailToken(ctx, teamID, telegramLinkPurpose, TelegramLinkTTL)
+}
+
+// LinkTelegramChat spends a link code, linking the chat to the code's team
+func (us *UserService) LinkTelegramChat(ctx context.Context, code string, chatID int64, username string) (TelegramChat, error) {
+	teamID, err := us.useEmailToken(ctx, telegramLinkPurpose, code)
+	if errors.Is(err, ErrInvalidEmailToken) {
+		return TelegramChat{}, ErrInvalidTelegramCode
+	}
+	if err != nil {
+		return TelegramChat{}, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.LinkTelegramChat(ctx, teamID, chatID, username, time.Now()); err != nil {
+		log.Printf("Error linking Telegram chat %d to team %d: %v", chatID, teamID, err)
+		return TelegramChat{}, err
+	}
+	return us.GetTelegramChat(ctx, chatID)
+}
+
+// GetTelegramChat returns a linked chat with its team
+func (us *UserService) GetTelegramChat(ctx context.Context, chatID int64) (TelegramChat, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	chat, err := us.Repo.GetTelegramChat(ctx, chatID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TelegramChat{}, ErrTelegramNotLinked
+	}
+	if err != nil {
+		log.Printf("Error fetching Telegram chat %d: %v", chatID, err)
+		return TelegramChat{}, err
+	}
+	return chat, nil
+}
+
+// GetTelegramChats returns the chats linked to a team, or to any team when
+// teamID is 0
+func (us *UserService) GetTelegramChats(ctx context.Context, teamID int) ([]TelegramChat, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	chats, err := us.Repo.ListTelegramChats(ctx, teamID)
+	if err != nil {
+		log.Printf("Error listing Telegram chats of team %d: %v", teamID, err)
+		return nil, err
+	}
+	if chats == nil {
+		chats = make([]TelegramChat, 0)
+	}
+	return chats, nil
+}
+
+// UnlinkTelegramChat unlinks a chat from its team
+func (us *UserService) UnlinkTelegramChat(ctx context.Context, chatID int64) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.UnlinkTelegramChat(ctx, chatID); err != nil {
+		log.Printf("Error unlinking Telegram chat %d: %v", chatID, err)
+		return err
+	}
+	return nil
+}
+
+// UnlinkTeamTelegram unlinks every chat of a team
+func (us *UserService) UnlinkTeamTelegram(ctx context.Context, teamID int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.UnlinkTeamTelegramChats(ctx, teamID); err != nil {
+		log.Printf("Error unlinking Telegram chats of team %d: %v", teamID, err)
+		return err
+	}
+	return nil
+}
+
+// TelegramStore is the storage TelegramBot needs
+type TelegramStore interface {
+	GetTelegramChats(ctx context.Context, teamID int) ([]TelegramChat, error)
+	UnlinkTelegramChat(ctx context.Context, chatID int64) error
+}
+
+// TelegramConfig is the bot teams link their chats to
+type TelegramConfig struct {
+	Token   string
+	APIURL  string // a self-hosted Bot API server; default api.telegram.org
+	Answers bool   // whether teams may answer questions from the chat
+	BaseURL string // where the site is reached, for links in messages
+}
+
+// TelegramUpdate is an update from getUpdates; only messages are asked for
+type TelegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *TelegramMessage `json:"message"`
+}
+
+// TelegramMessage is a message sent to the bot
+type TelegramMessage struct {
+	Chat struct {
+		ID   int64  `json:"id"`
+		Type string `json:"type"`
+	} `json:"chat"`
+	From *struct {
+		Username string `json:"username"`
+	} `json:"from"`
+	Text string `json:"text"`
+}
+
+// telegramNotice is a notification waiting to be sent to a team's chats,
+// or to every linked chat when TeamID is 0
+type telegramNotice struct {
+	TeamID int
+	Text   string
+}
+
+// TelegramBot talks to the Telegram Bot API. It is a Listener that sends
+// announcements and quota resets to linked chats; the commands chats send
+// are read with Updates
+type TelegramBot struct {
+	cfg      TelegramConfig
+	username string
+	store    TelegramStore
+	client   *http.Client
+	queue    chan telegramNotice
+}
+
+// NewTelegramBot returns nil without a token. It looks the bot up once,
+// to check the token and learn the username chats are linked through
+func NewTelegramBot(ctx context.Context, cfg TelegramConfig, store TelegramStore) (*TelegramBot, error) {
+	if cfg.Token == "" {
+		return nil, nil
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = telegramAPI
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+
+	b := &TelegramBot{
+		cfg:    cfg,
+		store:  store,
+		client: &http.Client{Timeout: telegramPollTimeout + 10*time.Second},
+		queue:  make(chan telegramNotice, telegramQueueSize),
+	}
+
+	var me struct {
+		Username string `json:"username"`
+	}
+	if _, err := b.call(ctx, "getMe", map[string]interface{}{}, &me); err != nil {
+		return nil, fmt.Errorf("checking the bot token: %w", err)
+	}
+	b.username = me.Username
+	return b, nil
+}
+
+// Username is the bot's @username, without the @
+func (b *TelegramBot) Username() string {
+	return b.username
+}
+
+// Answers reports whether teams may answer questions from the chat
+func (b *TelegramBot) Answers() bool {
+	return b.cfg.Answers
+}
+
+// LinkURL is the t.me link that opens the bot with a link code
+func (b *TelegramBot) LinkURL(code string) string {
+	return "https://t.me/" + b.username + "?start=" + code
+}
+
+// Handle queues announcements and quota resets for the chats they concern
+func (b *TelegramBot) Handle(event Event) {
+	var notice telegramNotice
+	switch event.Type {
+	case EventNotification:
+		n, ok := event.Data["notification"].(Notification)
+		if !ok || n.Type != NotificationAnnouncement {
+			return
+		}
+		text := "📣 " + n.Title
+		if n.Message != "" {
+			text += "\n\n" + n.Message
+		}
+		if n.Link != "" {
+			text += "\n\n" + b.link(n.Link)
+		}
+		notice = telegramNotice{TeamID: event.TeamID, Text: text}
+
+	case EventQuotaReset:
+		notice = telegramNotice{TeamID: event.TeamID, Text: "⏱ Your quota has reset. You can solve questions again."}
+
+	default:
+		return
+	}
+
+	select {
+	case b.queue <- notice:
+	default:
+		log.Printf("Warning: Telegram queue full, dropping %s for team %d", event.Type, event.TeamID)
+	}
+}
+
+// link turns a site path into an absolute URL when the site's address is known
+func (b *TelegramBot) link(path string) string {
+	if strings.HasPrefix(path, "/") && b.cfg.BaseURL != "" {
+		return b.cfg.BaseURL + path
+	}
+	return path
+}
+
+// Run sends queued notifications until ctx is done
+func (b *TelegramBot) Run(ctx context.Context) {
+	for {
+		select {
+		case notice := <-b.queue:
+			chats, err := b.store.GetTelegramChats(ctx, notice.TeamID)
+			if err != nil {
+				continue
+			}
+			for _, chat := range chats {
+				b.Send(ctx, chat.ChatID, notice.Text)
+				time.Sleep(telegramSendInterval)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Send sends a plain text message to a chat, waiting out rate limits.
+// A chat that blocked the bot or was deleted is unlinked
+func (b *TelegramBot) Send(ctx context.Context, chatID int64, text string) error {
+	var err error
+	for attempt := 1; attempt <= telegramMaxAttempts; attempt++ {
+		var wait time.Duration
+		wait, err = b.call(ctx, "sendMessage", map[string]interface{}{
+			"chat_id":                  chatID,
+			"text":                     text,
+			"disable_web_page_preview": true,
+		}, nil)
+		var apiErr *telegramError
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden {
+			log.Printf("Telegram chat %d blocked the bot, unlinking it", chatID)
+			b.store.UnlinkTelegramChat(ctx, chatID)
+			return err
+		}
+		if err == nil || wait == 0 {
+			break
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		log.Printf("Error sending Telegram message to chat %d: %v", chatID, err)
+	}
+	return err
+}
+
+// Updates long polls for messages sent to the bot after offset
+func (b *TelegramBot) Updates(ctx context.Context, offset int64) ([]TelegramUpdate, error) {
+	var updates []TelegramUpdate
+	_, err := b.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(telegramPollTimeout / time.Second),
+		"allowed_updates": []string{"message"},
+	}, &updates)
+
+	var apiErr *telegramError
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict {
+		return nil, ErrTelegramConflict
+	}
+	return updates, err
+}
+
+// telegramError is the Bot API refusing a call
+type telegramError struct {
+	Code        int
+	Description string
+}
+
+func (e *telegramError) Error() string {
+	return fmt.Sprintf("telegram: %d %s", e.Code, e.Description)
+}
+
+// call invokes a Bot API method, decoding its result into result. When
+// Telegram rate limited the call, it also returns how long to wait
+func (b *TelegramBot) call(ctx context.Context, method string, params map[string]interface{}, result interface{}) (time.Duration, error) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.cfg.APIURL+"/bot"+b.cfg.Token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// The token is part of the URL, so keep it out of the logs
+		return 0, fmt.Errorf("telegram %s: %s", method, strings.ReplaceAll(err.Error(), b.cfg.Token, "<token>"))
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		ErrorCode   int             `json:"error_code"`
+		Description string          `json:"description"`
+		Parameters  struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	if err := json.Unmarshal(respBody, &reply); err != nil {
+		return 0, fmt.Errorf("telegram %s: unexpected response %s", method, resp.Status)
+	}
+	if !reply.OK {
+		wait := time.Duration(reply.Parameters.RetryAfter) * time.Second
+		if reply.ErrorCode == http.StatusTooManyRequests && wait == 0 {
+			wait = time.Second
+		}
+		return wait, &telegramError{Code: reply.ErrorCode, Description: reply.Description}
+	}
+	if result != nil {
+		return 0, json.Unmarshal(reply.Result, result)
+	}
+	return 0, nil
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Image widths generated next to every uploaded JPEG or PNG. The hunt
+// list uses ThumbnailWidth; the question page offers the rest as srcset
+const (
+	ThumbnailWidth = 320
+	MediumWidth    = 960
+)
+
+var imageVariantWidths = []int{ThumbnailWidth, MediumWidth}
+
+// maxVariantPixels bounds the images that get resized so a crafted
+// upload can't make the server allocate gigabytes decoding it
+const maxVariantPixels = 50_000_000
+
+// variantKeyPattern matches keys like "IMG-<uuid>_w320.jpg"
+var variantKeyPattern = regexp.MustCompile(`^(.+)_w(\d+)(\.[^.]+)$`)
+
+// ImageVariantKey returns the key the width-wide copy of an image is stored under
+func ImageVariantKey(key string, width int) string {
+	ext := filepath.Ext(key)
+	return fmt.Sprintf("%s_w%d%s", strings.TrimSuffix(key, ext), width, ext)
+}
+
+// ImageVariantURL returns the proxy URL of a resized copy, given the URL
+// of the original. The proxy falls back to the original when no copy
+// exists, e.g. for formats that aren't resized
+func ImageVariantURL(url string, width int) string {
+	return ImageVariantKey(url, width)
+}
+
+// ImageSrcset lists the resized copies of an image for a srcset attribute
+func ImageSrcset(url string) string {
+	parts := make([]string, 0, len(imageVariantWidths))
+	for _, w := range imageVariantWidths {
+		parts = append(parts, fmt.Sprintf("%s %dw", ImageVariantURL(url, w), w))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// OriginalMediaKey maps a resized copy's key back to the original's;
+// other keys are returned unchanged
+func OriginalMediaKey(key string) string {
+	m := variantKeyPattern.FindStringSubmatch(key)
+	if m == nil {
+		return key
+	}
+	width, _ := strconv.Atoi(m[2])
+	for _, w := range imageVariantWidths {
+		if w == width {
+			return m[1] + m[3]
+		}
+	}
+	return key
+}
+
+// GenerateImageVariants stores the resized copies of the image under key
+// Formats other than JPEG and PNG are skipped, as are images already
+// narrower than a variant
+func (us *UserService) GenerateImageVariants(key string) error {
+	ctx := context.Background()
+	obj, _, err := us.Storage.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	cfg, format, err := image.DecodeConfig(obj)
+	if err != nil || (format != "jpeg" && format != "png") {
+		return nil
+	}
+	if cfg.Width*cfg.Height > maxVariantPixels {
+		log.Printf("Warning: Not resizing %s, %dx%d is too large", key, cfg.Width, cfg.Height)
+		return nil
+	}
+
+	if _, err := obj.Seek(0, 0); err != nil {
+		return err
+	}
+	src, _, err := image.Decode(obj)
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	bounds := src.Bounds()
+	for _, width := range imageVariantWidths {
+		if bounds.Dx() <= width {
+			continue
+		}
+
+		height := bounds.Dy() * width / bounds.Dx()
+		dst := image.NewRGBA(image.Rect(0, 0, width, max(height, 1)))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+		var buf bytes.Buffer
+		contentType := "image/jpeg"
+		if format == "png" {
+			contentType = "image/png"
+			err = png.Encode(&buf, dst)
+		} else {
+			err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 82})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode %dw variant: %v", width, err)
+		}
+
+		variant := ImageVariantKey(key, width)
+		if err := us.Storage.Put(ctx, variant, &buf, int64(buf.Len()), contentType); err != nil {
+			return fmt.Errorf("failed to store %dw variant: %v", width, err)
+		}
+	}
+
+	return nil
+}
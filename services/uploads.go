@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Default per-file size limits, used when UploadPolicy leaves a slot at zero
+const (
+	DefaultMaxImageSize int64 = 10 << 20
+	DefaultMaxAudioSize int64 = 50 << 20
+	DefaultMaxVideoSize int64 = 500 << 20
+	DefaultMaxFileSize  int64 = 100 << 20
+)
+
+// UploadPolicy limits what can be uploaded into each media slot
+type UploadPolicy struct {
+	// Max file size in bytes per slot; zero uses the default
+	MaxImageSize int64
+	MaxAudioSize int64
+	MaxVideoSize int64
+	MaxFileSize  int64
+
+	// Scanner, when set, must pass a file before it is stored
+	Scanner Scanner
+}
+
+// UploadRejectedError explains why a file was refused
+type UploadRejectedError struct {
+	Filename string
+	Reason   string
+}
+
+func (e *UploadRejectedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Filename, e.Reason)
+}
+
+// maxSize returns the size limit of a slot
+func (p UploadPolicy) maxSize(slot string) int64 {
+	switch slot {
+	case "images":
+		if p.MaxImageSize > 0 {
+			return p.MaxImageSize
+		}
+		return DefaultMaxImageSize
+	case "audios":
+		if p.MaxAudioSize > 0 {
+			return p.MaxAudioSize
+		}
+		return DefaultMaxAudioSize
+	case "files":
+		if p.MaxFileSize > 0 {
+			return p.MaxFileSize
+		}
+		return DefaultMaxFileSize
+	default:
+		if p.MaxVideoSize > 0 {
+			return p.MaxVideoSize
+		}
+		return DefaultMaxVideoSize
+	}
+}
+
+// MaxUploadSize returns the size limit of an upload slot
+func (us *UserService) MaxUploadSize(slot string) int64 {
+	return us.Uploads.maxSize(slot)
+}
+
+// CheckSize rejects files over the slot's size limit, so oversized uploads
+// can be refused before any data is sent
+func (p UploadPolicy) CheckSize(slot, filename string, size int64) error {
+	if limit := p.maxSize(slot); size > limit {
+		return &UploadRejectedError{filename, fmt.Sprintf("larger than the %d MB limit", limit>>20)}
+	}
+	return nil
+}
+
+// slotMIMEPrefix is the top-level type files in a slot must have;
+// attachments may be anything, as they are only ever downloaded
+var slotMIMEPrefix = map[string]string{
+	"images": "image/",
+	"videos": "video/",
+	"audios": "audio/",
+	"files":  "",
+}
+
+// avContainers are sniffed by container whatever they hold, so they are
+// accepted for both audio and video (e.g. M4A sniffs as video/mp4)
+var avContainers = map[string]bool{
+	"application/ogg": true,
+	"video/mp4":       true,
+	"video/webm":      true,
+}
+
+// sniffContentType works out what a file really is from its first bytes,
+// falling back to the extension for audio and video formats the sniffer
+// doesn't know (e.g. MP3 without ID3 tags, MKV). Every image format served
+// is sniffable, so images never rely on the extension; SVG sniffs as XML
+// and is never accepted as an image, as it can carry scripts
+func sniffContentType(filename string, r io.Reader) string {
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(r, head)
+	sniffed := http.DetectContentType(head[:n])
+
+	if sniffed == "application/octet-stream" {
+		byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
+		if strings.HasPrefix(byExt, "audio/") || strings.HasPrefix(byExt, "video/") {
+			return byExt
+		}
+	}
+	return sniffed
+}
+
+// ValidateUpload checks a file against the slot's type and size limits and
+// runs the malware scan. It returns the content type to store the file
+// with; r is rewound before returning
+func (p UploadPolicy) ValidateUpload(slot, filename string, size int64, r io.ReadSeeker) (string, error) {
+	prefix, ok := slotMIMEPrefix[slot]
+	if !ok {
+		return "", ErrUnknownMediaKind
+	}
+
+	if err := p.CheckSize(slot, filename, size); err != nil {
+		return "", err
+	}
+
+	contentType := sniffContentType(filename, r)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !strings.HasPrefix(mediaType, prefix) && !(avContainers[mediaType] && slot != "images") {
+		return "", &UploadRejectedError{filename, fmt.Sprintf("%s is not allowed here", mediaType)}
+	}
+
+	if p.Scanner != nil {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), scanTimeout)
+		defer cancel()
+		if err := p.Scanner.Scan(ctx, r); err != nil {
+			if errors.Is(err, ErrInfected) {
+				log.Printf("Warning: Rejected upload %s: %v", filename, err)
+				return "", &UploadRejectedError{filename, err.Error()}
+			}
+			// Fail closed: an unscanned file is not stored
+			log.Printf("Error scanning upload %s: %v", filename, err)
+			return "", &UploadRejectedError{filename, "could not be scanned, try again later"}
+		}
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return contentType, nil
+}
@@ -1,11 +1,13 @@
 package services
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
+	"time"
 
-	"github.com/minio/minio-go/v7"
 	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -15,174 +17,182 @@ type User struct {
 	Password  string `json:"password"`
 	Username  string `json:"username"`
 	Points    int    `json:"points"`
+	HuntID    int    `json:"hunt_id"`
 	CreatedAt string `json:"created_at"`
+
+	// StartedAt is when the team's own clock started, nil until it has
+	StartedAt *time.Time `json:"started_at,omitempty"`
+
+	// SuspendedAt is when an admin suspended the team, nil unless one has
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+
+	// FlaggedAt is when an admin flagged the team for review, nil unless
+	// one has
+	FlaggedAt *time.Time `json:"flagged_at,omitempty"`
+
+	// Avatar is the address of the team's avatar, empty without one
+	Avatar string `json:"avatar,omitempty"`
+
+	// RegistrationIP and Fingerprint are where a new team registers from,
+	// only read when creating it
+	RegistrationIP string `json:"-"`
+	Fingerprint    string `json:"-"`
 }
 
+// ErrTeamNotFound is returned when an operation targets a team that doesn't exist
+var ErrTeamNotFound = errors.New("team not found")
+
 type UserService struct {
-	User        User
-	UserStore   database.DatabaseStore
-	MinioClient *minio.Client
+	User      User
+	UserStore database.DatabaseStore
+	Repo      *repository.Queries
+	Storage   Storage
+	Uploads   UploadPolicy
+	Backups   BackupConfig
+	Cache     QuestionCache
+
+	// LockTTL is how long a question lock lasts, default DefaultLockTTL
+	LockTTL time.Duration
+
+	// Hunt is when the hunt runs, open-ended by default
+	Hunt HuntWindow
+
+	// Mailer sends queued emails; nil turns email off
+	Mailer *Mailer
+
+	// SMS sends queued text messages; nil turns them off
+	SMS *SMSSender
+
+	settingsCache   settingsCache
+	pageCache       pageCache
+	huntWindowCache huntWindowCache
 }
 
-func NewUserService(user User, userStore database.DatabaseStore, mini *minio.Client) *UserService {
+// NewUserService falls back to local disk storage when storage is nil
+func NewUserService(user User, userStore database.DatabaseStore, storage Storage) *UserService {
+	if storage == nil {
+		storage = NewLocalStorage("", "")
+	}
 	return &UserService{
-		User:        user,
-		UserStore:   userStore,
-		MinioClient: mini,
+		User:      user,
+		UserStore: userStore,
+		Repo:      repository.New(userStore.DB),
+		Storage:   storage,
 	}
 }
 
-func (us *UserService) CreateUser(u User) error {
+func (us *UserService) CreateUser(ctx context.Context, u User) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 
-	stmt := `INSERT INTO teams (email, password, name, points) VALUES ($1, $2, $3, 0)`
-
-	_, err = us.UserStore.DB.Exec(stmt, u.Email, string(hashedPassword), u.Username)
-	return err
+	if u.HuntID == 0 {
+		u.HuntID = DefaultHuntID
+	}
+	return us.Repo.CreateTeam(ctx, u.Email, string(hashedPassword), u.Username, u.HuntID, u.RegistrationIP, u.Fingerprint)
 }
 
-func (us *UserService) CheckUsername(usr string) (User, error) {
-	query := `SELECT id, email, password, name, points FROM teams
-		WHERE name = $1`
-
-	us.User.Username = usr
-	err := us.UserStore.DB.QueryRow(query, us.User.Username).Scan(
-		&us.User.ID,
-		&us.User.Email,
-		&us.User.Password,
-		&us.User.Username,
-		&us.User.Points,
-	)
+func (us *UserService) CheckUsername(ctx context.Context, usr string) (User, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	t, err := us.Repo.GetTeamByName(ctx, usr)
 	if err != nil {
 		return User{}, err
 	}
 
+	us.User = userFromTeam(t)
 	return us.User, nil
 }
 
-func (us *UserService) CheckEmail(email string) (User, error) {
-	query := `SELECT id, email, password, name FROM teams
-		WHERE email = $1`
-
-	us.User.Email = email
-	err := us.UserStore.DB.QueryRow(query, us.User.Email).Scan(
-		&us.User.ID,
-		&us.User.Email,
-		&us.User.Password,
-		&us.User.Username,
-	)
+func (us *UserService) CheckEmail(ctx context.Context, email string) (User, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	t, err := us.Repo.GetTeamByEmail(ctx, email)
 	if err != nil {
 		return User{}, err
 	}
 
+	us.User = userFromTeam(t)
 	return us.User, nil
 }
 
-func (us *UserService) GetAllUsers() ([]User, error) {
-	query := `SELECT id, email, name, points FROM teams`
-	users := make([]User, 0)
-	stmt, err := us.UserStore.DB.Prepare(query)
-	if err != nil {
-		return users, err
+func userFromTeam(t repository.Team) User {
+	u := User{ID: t.ID, Email: t.Email, Password: t.Password, Username: t.Name, Points: t.Points, HuntID: t.HuntID, Avatar: AvatarURL(t.Avatar)}
+	if t.StartedAt.Valid {
+		u.StartedAt = &t.StartedAt.Time
+	}
+	if t.SuspendedAt.Valid {
+		u.SuspendedAt = &t.SuspendedAt.Time
 	}
+	if t.FlaggedAt.Valid {
+		u.FlaggedAt = &t.FlaggedAt.Time
+	}
+	return u
+}
 
-	defer stmt.Close()
+func (us *UserService) GetAllUsers(ctx context.Context, huntID int) ([]User, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
 
-	rows, err := stmt.Query()
+	users := make([]User, 0)
+	teams, err := us.Repo.ListTeams(ctx, huntID)
 	if err != nil {
 		return users, err
 	}
 
-	for rows.Next() {
-		var u User
-		err := rows.Scan(&u.ID, &u.Email, &u.Username, &u.Points)
-		if err != nil {
-			return users, err
-		}
-
-		users = append(users, u)
+	for _, t := range teams {
+		users = append(users, userFromTeam(t))
 	}
 
 	return users, nil
 }
 
-func (us *UserService) DeleteTeam(id int) error {
+func (us *UserService) DeleteTeam(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
 	log.Printf("Attempting to delete team with ID: %d", id)
-	
-	// Delete all related records first to avoid foreign key constraints
-	
-	// 1. Delete team_completed_questions
-	query := database.ConvertPlaceholders(`DELETE FROM team_completed_questions WHERE team_id = ?`)
-	_, err := us.UserStore.DB.Exec(query, id)
-	if err != nil {
-		log.Printf("Error deleting completed questions for team %d: %v", id, err)
-		return fmt.Errorf("failed to delete completed questions: %v", err)
-	}
-	
-	// 2. Delete question_locks
-	query = database.ConvertPlaceholders(`DELETE FROM question_locks WHERE locked_by_team_id = ?`)
-	_, err = us.UserStore.DB.Exec(query, id)
-	if err != nil {
-		log.Printf("Error deleting locks for team %d: %v", id, err)
-		return fmt.Errorf("failed to delete question locks: %v", err)
-	}
-	
-	// 3. Delete question_timers
-	query = database.ConvertPlaceholders(`DELETE FROM question_timers WHERE team_id = ?`)
-	_, err = us.UserStore.DB.Exec(query, id)
-	if err != nil {
-		log.Printf("Error deleting timers for team %d: %v", id, err)
-		return fmt.Errorf("failed to delete question timers: %v", err)
-	}
-	
-	// 4. Delete question_attempts
-	query = database.ConvertPlaceholders(`DELETE FROM question_attempts WHERE team_id = ?`)
-	_, err = us.UserStore.DB.Exec(query, id)
-	if err != nil {
-		log.Printf("Error deleting attempts for team %d: %v", id, err)
-		return fmt.Errorf("failed to delete question attempts: %v", err)
-	}
-	
-	// 5. Delete team_hint_unlocked
-	query = database.ConvertPlaceholders(`DELETE FROM team_hint_unlocked WHERE team_id = ?`)
-	_, err = us.UserStore.DB.Exec(query, id)
-	if err != nil {
-		log.Printf("Error deleting hint unlocks for team %d: %v", id, err)
-		return fmt.Errorf("failed to delete hint unlocks: %v", err)
-	}
-	
-	// 6. Delete team_quota_slots
-	query = database.ConvertPlaceholders(`DELETE FROM team_quota_slots WHERE team_id = ?`)
-	_, err = us.UserStore.DB.Exec(query, id)
+
+	// The team and everything referencing it go in one transaction, so a
+	// failure part way leaves the team whole
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Error deleting quota slots for team %d: %v", id, err)
-		return fmt.Errorf("failed to delete quota slots: %v", err)
+		log.Printf("Error starting deletion of team %d: %v", id, err)
+		return err
 	}
-	
-	// 7. Finally, delete the team itself
-	query = database.ConvertPlaceholders(`DELETE FROM teams WHERE id = ?`)
-	result, err := us.UserStore.DB.Exec(query, id)
+	defer tx.Rollback()
+
+	found, err := us.Repo.WithTx(tx).DeleteTeam(ctx, id)
 	if err != nil {
 		log.Printf("Error deleting team %d: %v", id, err)
-		return fmt.Errorf("failed to delete team: %v", err)
+		return err
 	}
-	
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	if !found {
 		log.Printf("Team %d not found", id)
-		return fmt.Errorf("team not found")
+		return ErrTeamNotFound
 	}
-	
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing deletion of team %d: %v", id, err)
+		return err
+	}
+
 	log.Printf("Successfully deleted team %d and all related records", id)
 	return nil
 }
 
 // PingDB checks if the database connection is alive
-func (us *UserService) PingDB() error {
-	return us.UserStore.DB.Ping()
+func (us *UserService) PingDB(ctx context.Context) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	return us.UserStore.DB.PingContext(ctx)
 }
 
 // GetDBStats returns database connection pool statistics
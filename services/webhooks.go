@@ -0,0 +1,387 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Webhook event names
+const (
+	WebhookQuestionSolved = "question.solved"
+	WebhookFirstBlood     = "question.first_blood"
+	WebhookTeamRegistered = "team.registered"
+	WebhookHuntEnded      = "hunt.ended"
+	WebhookAnnouncement   = "announcement.published"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{
+	WebhookQuestionSolved,
+	WebhookFirstBlood,
+	WebhookTeamRegistered,
+	WebhookHuntEnded,
+	WebhookAnnouncement,
+}
+
+// How a webhook's payloads are rendered
+const (
+	WebhookFormatJSON    = "json"    // the signed event JSON
+	WebhookFormatDiscord = "discord" // a chat message for a Discord channel webhook
+)
+
+const (
+	// WebhookMaxAttempts is how many times a delivery is tried before giving up
+	WebhookMaxAttempts = 8
+
+	// webhookRetryBase is the delay before the first retry, doubled after each one
+	webhookRetryBase = 30 * time.Second
+)
+
+// Webhook is an external URL that receives game events
+// Events is empty when the webhook receives every event
+type Webhook repository.Webhook
+
+// Wants reports whether the webhook is subscribed to an event
+func (w Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event queued for one webhook
+type WebhookDelivery = repository.WebhookDelivery
+
+// CreateWebhook registers a webhook
+func (us *UserService) CreateWebhook(ctx context.Context, w Webhook) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	w.CreatedAt = time.Now()
+	if w.Format == "" {
+		w.Format = WebhookFormatJSON
+	}
+	if err := us.Repo.CreateWebhook(ctx, repository.Webhook(w)); err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetWebhooks returns every registered webhook
+func (us *UserService) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := us.Repo.ListWebhooks(ctx)
+	if err != nil {
+		log.Printf("Error getting webhooks: %v", err)
+		return nil, err
+	}
+
+	var webhooks []Webhook
+	for _, w := range rows {
+		webhooks = append(webhooks, Webhook(w))
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a webhook along with its delivery history
+func (us *UserService) DeleteWebhook(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeleteWebhook(ctx, id); err != nil {
+		log.Printf("Error deleting webhook %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// QueueWebhookEvent queues an event for every webhook subscribed to it
+// The payload is rendered once here so retries send the exact same body;
+// Discord webhooks get the event's message template rendered instead
+func (us *UserService) QueueWebhookEvent(ctx context.Context, event string, data map[string]interface{}) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	webhooks, err := us.GetWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":     event,
+		"timestamp": now.UTC(),
+		"data":      data,
+	})
+	if err != nil {
+		log.Printf("Error encoding webhook payload for %s: %v", event, err)
+		return err
+	}
+
+	for _, w := range webhooks {
+		if !w.Wants(event) {
+			continue
+		}
+		body := payload
+		if w.Format == WebhookFormatDiscord {
+			body, err = us.discordMessage(ctx, event, data)
+			if errors.Is(err, ErrEmptyDiscordMessage) {
+				continue
+			}
+			if err != nil {
+				log.Printf("Error rendering %s for Discord webhook %d: %v", event, w.ID, err)
+				continue
+			}
+		}
+		if err := us.Repo.CreateWebhookDelivery(ctx, w.ID, event, string(body), now); err != nil {
+			log.Printf("Error queueing %s for webhook %d: %v", event, w.ID, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetDueWebhookDeliveries returns undelivered deliveries whose next attempt is due
+func (us *UserService) GetDueWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	deliveries, err := us.Repo.ListDueWebhookDeliveries(ctx, WebhookMaxAttempts, time.Now(), limit)
+	if err != nil {
+		log.Printf("Error getting webhook deliveries: %v", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// GetRecentWebhookDeliveries returns the latest deliveries, newest first
+func (us *UserService) GetRecentWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	deliveries, err := us.Repo.ListRecentWebhookDeliveries(ctx, limit)
+	if err != nil {
+		log.Printf("Error getting webhook deliveries: %v", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt stores the outcome of a delivery attempt and, for a
+// failed one, when to try again
+func (us *UserService) RecordWebhookAttempt(ctx context.Context, id int, statusCode int, attemptErr error, nextAttempt time.Time) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	lastError := ""
+	if attemptErr != nil {
+		lastError = attemptErr.Error()
+	}
+
+	err := us.Repo.RecordWebhookAttempt(ctx, id, statusCode, lastError, attemptErr == nil, nextAttempt)
+	if err != nil {
+		log.Printf("Error recording attempt for webhook delivery %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// DeferWebhookDelivery holds a delivery back until nextAttempt without
+// counting it as a failed attempt
+func (us *UserService) DeferWebhookDelivery(ctx context.Context, id int, statusCode int, reason string, nextAttempt time.Time) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeferWebhookDelivery(ctx, id, statusCode, reason, nextAttempt); err != nil {
+		log.Printf("Error deferring webhook delivery %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// WebhookStore is the storage WebhookDispatcher needs
+type WebhookStore interface {
+	GetDueWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, id int, statusCode int, attemptErr error, nextAttempt time.Time) error
+	DeferWebhookDelivery(ctx context.Context, id int, statusCode int, reason string, nextAttempt time.Time) error
+}
+
+// WebhookDispatcher posts queued deliveries, retrying failures with
+// exponential backoff until WebhookMaxAttempts is reached. A receiver that
+// rate limits (Discord does, per webhook) is waited out instead: nothing
+// more is posted to its URL until it said to try again
+type WebhookDispatcher struct {
+	store  WebhookStore
+	client *http.Client
+}
+
+// NewWebhookDispatcher creates a dispatcher; call Run to start delivering
+func NewWebhookDispatcher(store WebhookStore) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		store:  store,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run delivers due deliveries every interval until ctx is done
+func (d *WebhookDispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.DeliverDue()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// DeliverDue attempts every delivery that is currently due
+func (d *WebhookDispatcher) DeliverDue() {
+	deliveries, err := d.store.GetDueWebhookDeliveries(context.Background(), 100)
+	if err != nil {
+		return
+	}
+
+	// Until when each rate limited URL must not be posted to again
+	held := make(map[string]time.Time)
+	for _, delivery := range deliveries {
+		if until, ok := held[delivery.URL]; ok && time.Now().Before(until) {
+			d.store.DeferWebhookDelivery(context.Background(), delivery.ID, 0, "waiting out a rate limit", until)
+			continue
+		}
+
+		status, wait, err := d.post(delivery)
+		if wait > 0 {
+			held[delivery.URL] = time.Now().Add(wait)
+		}
+		if status == http.StatusTooManyRequests {
+			log.Printf("Webhook delivery %d to %s rate limited, retrying in %s", delivery.ID, delivery.URL, wait)
+			d.store.DeferWebhookDelivery(context.Background(), delivery.ID, status, err.Error(), held[delivery.URL])
+			continue
+		}
+
+		next := time.Now().Add(webhookRetryBase << delivery.Attempts)
+		if err != nil {
+			log.Printf("Webhook delivery %d to %s failed (attempt %d/%d): %v",
+				delivery.ID, delivery.URL, delivery.Attempts+1, WebhookMaxAttempts, err)
+		}
+		d.store.RecordWebhookAttempt(context.Background(), delivery.ID, status, err, next)
+	}
+}
+
+// post sends one delivery, treating any non-2xx response as a failure. It
+// also returns how long the receiver asked to be left alone, if it did
+func (d *WebhookDispatcher) post(delivery WebhookDelivery) (int, time.Duration, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Holmes-Webhooks/1.0")
+	req.Header.Set("X-Holmes-Event", delivery.Event)
+	req.Header.Set("X-Holmes-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Holmes-Timestamp", timestamp)
+	req.Header.Set("X-Holmes-Signature", "sha256="+SignWebhookPayload(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return resp.StatusCode, retryAfter(resp.Header, body), fmt.Errorf("rate limited: %s", resp.Status)
+	}
+
+	// Discord says when a webhook's bucket is spent before it starts
+	// refusing, so the next message can wait instead of being rejected
+	var wait time.Duration
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		wait = headerSeconds(resp.Header.Get("X-RateLimit-Reset-After"))
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, wait, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, wait, nil
+}
+
+// maxRetryAfter caps how long a rate limit can hold deliveries back
+const maxRetryAfter = 10 * time.Minute
+
+// retryAfter reads how long a 429 response asked to wait: Discord's
+// retry_after in the body, else the Retry-After header, else a minute
+func retryAfter(header http.Header, body []byte) time.Duration {
+	var limited struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	var wait time.Duration
+	if json.Unmarshal(body, &limited) == nil && limited.RetryAfter > 0 {
+		wait = time.Duration(limited.RetryAfter * float64(time.Second))
+	} else {
+		wait = headerSeconds(header.Get("Retry-After"))
+	}
+
+	if wait <= 0 {
+		wait = time.Minute
+	}
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	return wait
+}
+
+// headerSeconds parses a header counting seconds, possibly fractional
+func headerSeconds(value string) time.Duration {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// SignWebhookPayload computes the hex HMAC-SHA256 receivers should compare
+// X-Holmes-Signature against. The timestamp is signed along with the body
+// so a captured request can't be replayed later with a new timestamp
+func SignWebhookPayload(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
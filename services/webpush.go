@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	webpush "github.com/SherClockHolmes/webpush-go"
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// PushSubscription is a browser's Web Push endpoint for a team
+type PushSubscription = repository.PushSubscription
+
+// SavePushSubscription stores a subscription, moving the endpoint to teamID
+// if another team had registered it from the same browser before
+func (us *UserService) SavePushSubscription(ctx context.Context, s PushSubscription) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.DeletePushSubscription(ctx, s.Endpoint); err != nil {
+		return err
+	}
+
+	s.CreatedAt = time.Now()
+	if err := us.Repo.CreatePushSubscription(ctx, s); err != nil {
+		log.Printf("Error saving push subscription for team %d: %v", s.TeamID, err)
+		return err
+	}
+
+	return nil
+}
+
+// DeletePushSubscription removes a subscription by its endpoint
+func (us *UserService) DeletePushSubscription(ctx context.Context, endpoint string) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if err := us.Repo.DeletePushSubscription(ctx, endpoint); err != nil {
+		log.Printf("Error deleting push subscription: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetPushSubscriptions returns a team's subscriptions, or every subscription when teamID is 0
+func (us *UserService) GetPushSubscriptions(ctx context.Context, teamID int) ([]PushSubscription, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	var subs []PushSubscription
+	var err error
+	if teamID != 0 {
+		subs, err = us.Repo.ListTeamPushSubscriptions(ctx, teamID)
+	} else {
+		subs, err = us.Repo.ListPushSubscriptions(ctx)
+	}
+	if err != nil {
+		log.Printf("Error getting push subscriptions: %v", err)
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+// PushSubscriptionStore is the storage WebPushSender needs
+type PushSubscriptionStore interface {
+	GetPushSubscriptions(ctx context.Context, teamID int) ([]PushSubscription, error)
+	DeletePushSubscription(ctx context.Context, endpoint string) error
+}
+
+// WebPushConfig holds the VAPID key pair used to sign push messages
+// Generate a pair once with webpush.GenerateVAPIDKeys and keep it stable,
+// since existing subscriptions are bound to the public key
+type WebPushConfig struct {
+	PublicKey  string
+	PrivateKey string
+	Subject    string // contact for push services, e.g. mailto:admin@example.com
+	TTL        int    // seconds a push service keeps an undelivered message
+}
+
+// PushPayload is the JSON the service worker turns into a notification
+type PushPayload struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Link  string `json:"link"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+// WebPushSender delivers Broadcaster events to subscribed browsers
+type WebPushSender struct {
+	cfg   WebPushConfig
+	store PushSubscriptionStore
+}
+
+// NewWebPushSender returns nil when no VAPID keys are configured
+func NewWebPushSender(cfg WebPushConfig, store PushSubscriptionStore) *WebPushSender {
+	if cfg.PublicKey == "" || cfg.PrivateKey == "" {
+		return nil
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 3600
+	}
+
+	return &WebPushSender{cfg: cfg, store: store}
+}
+
+// PublicKey is the application server key browsers subscribe with
+func (w *WebPushSender) PublicKey() string {
+	return w.cfg.PublicKey
+}
+
+// Push sends an event to the subscriptions of the team it concerns, or to
+// every subscription for global events. Events without a push form are ignored
+func (w *WebPushSender) Push(event Event) {
+	payload, ok := pushPayloadFor(event)
+	if !ok {
+		return
+	}
+
+	subs, err := w.store.GetPushSubscriptions(context.Background(), event.TeamID)
+	if err != nil {
+		return
+	}
+
+	message, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding push payload: %v", err)
+		return
+	}
+
+	for _, s := range subs {
+		w.send(s, message, payload.Tag)
+	}
+}
+
+// send delivers one message and forgets subscriptions the push service
+// reports as gone
+func (w *WebPushSender) send(s PushSubscription, message []byte, topic string) {
+	resp, err := webpush.SendNotification(message, &webpush.Subscription{
+		Endpoint: s.Endpoint,
+		Keys: webpush.Keys{
+			P256dh: s.P256dh,
+			Auth:   s.Auth,
+		},
+	}, &webpush.Options{
+		Subscriber:      w.cfg.Subject,
+		VAPIDPublicKey:  w.cfg.PublicKey,
+		VAPIDPrivateKey: w.cfg.PrivateKey,
+		TTL:             w.cfg.TTL,
+		Topic:           topic,
+	})
+	if err != nil {
+		log.Printf("Error sending push to team %d: %v", s.TeamID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		w.store.DeletePushSubscription(context.Background(), s.Endpoint)
+	case resp.StatusCode >= 400:
+		log.Printf("Push service rejected message for team %d: %s", s.TeamID, resp.Status)
+	}
+}
+
+// pushPayloadFor maps the events worth interrupting a player for to a payload
+func pushPayloadFor(event Event) (PushPayload, bool) {
+	switch event.Type {
+	case EventNotification:
+		n, ok := event.Data["notification"].(Notification)
+		if !ok {
+			return PushPayload{}, false
+		}
+		link := n.Link
+		if link == "" {
+			link = "/hunt/notifications"
+		}
+		return PushPayload{Title: n.Title, Body: n.Message, Link: link}, true
+
+	case EventQuotaReset:
+		return PushPayload{
+			Title: "Your quota has reset",
+			Body:  "You can solve questions again.",
+			Link:  "/hunt",
+			Tag:   "quota-reset",
+		}, true
+	}
+
+	return PushPayload{}, false
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SettingCategoryWeights holds the multiplier of each question category,
+// as a JSON object of category to weight
+const SettingCategoryWeights = "category_weights"
+
+const (
+	// MaxCategoryLength caps the name of a question's category
+	MaxCategoryLength = 50
+	// MaxCategoryWeight is the most a category can multiply points by
+	MaxCategoryWeight = 10
+)
+
+var (
+	ErrCategoryTooLong       = fmt.Errorf("category is longer than %d characters", MaxCategoryLength)
+	ErrInvalidCategoryWeight = fmt.Errorf("weights are more than 0 and at most %d", MaxCategoryWeight)
+	ErrEmptyCategory         = errors.New("weights need a category")
+	// ErrInvalidWeightLine is returned for a line of weights that doesn't
+	// read "category = weight"
+	ErrInvalidWeightLine = errors.New("weights are written as category = weight, such as crypto = 1.5")
+)
+
+// CategoryWeights multiplies the points of the questions in a category
+// when they are solved. Categories without a weight count once
+type CategoryWeights map[string]float64
+
+// CategoryWeight is one category's multiplier, for listing them in order
+type CategoryWeight struct {
+	Category string  `json:"category"`
+	Weight   float64 `json:"weight"`
+}
+
+// NormalizeCategory trims and lowercases a category, so "Crypto " and
+// "crypto" are one
+func NormalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+// CheckCategory normalizes a question's category and checks it can be saved
+func CheckCategory(category string) (string, error) {
+	category = NormalizeCategory(category)
+	if utf8.RuneCountInString(category) > MaxCategoryLength {
+		return "", ErrCategoryTooLong
+	}
+	return category, nil
+}
+
+// For returns the weight of a category, 1 for one without a weight
+func (w CategoryWeights) For(category string) float64 {
+	if weight, ok := w[NormalizeCategory(category)]; ok {
+		return weight
+	}
+	return 1
+}
+
+// List returns the weights sorted by category
+func (w CategoryWeights) List() []CategoryWeight {
+	list := make([]CategoryWeight, 0, len(w))
+	for category, weight := range w {
+		list = append(list, CategoryWeight{Category: category, Weight: weight})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Category < list[j].Category })
+	return list
+}
+
+// String writes the weights one per line as "category = weight", the way
+// ParseCategoryWeights reads them
+func (w CategoryWeights) String() string {
+	lines := make([]string, 0, len(w))
+	for _, cw := range w.List() {
+		lines = append(lines, cw.Category+" = "+FormatWeight(cw.Weight))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseCategoryWeights reads weights written one per line as
+// "category = weight", such as "crypto = 1.5". Blank lines are skipped
+func ParseCategoryWeights(text string) (CategoryWeights, error) {
+	weights := make(CategoryWeights)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		category, value, ok := strings.Cut(line, "=")
+		if !ok || NormalizeCategory(category) == "" {
+			return nil, ErrInvalidWeightLine
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, ErrInvalidWeightLine
+		}
+		weights[NormalizeCategory(category)] = weight
+	}
+	return weights, nil
+}
+
+// Categories returns the categories questions are in, sorted and without
+// repeats
+func Categories(questions []Question) []string {
+	seen := make(map[string]bool)
+	categories := make([]string, 0)
+	for _, q := range questions {
+		if q.Category != "" && !seen[q.Category] {
+			seen[q.Category] = true
+			categories = append(categories, q.Category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// WeightedPoints is points multiplied by weight, rounded to the nearest
+// whole point
+func WeightedPoints(points int, weight float64) int {
+	return int(math.Round(float64(points) * weight))
+}
+
+// FormatWeight shows a weight the way admins type it, such as 1.5
+func FormatWeight(weight float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", weight), "0"), ".")
+}
+
+// GetCategoryWeights returns the weight of each question category
+func (us *UserService) GetCategoryWeights(ctx context.Context) CategoryWeights {
+	weights := make(CategoryWeights)
+	value, ok, err := us.GetSetting(ctx, SettingCategoryWeights)
+	if err != nil || !ok || value == "" {
+		return weights
+	}
+	if err := json.Unmarshal([]byte(value), &weights); err != nil {
+		log.Printf("Invalid value %q for setting %s", value, SettingCategoryWeights)
+		return make(CategoryWeights)
+	}
+	return weights
+}
+
+// SetCategoryWeights replaces the weight of every question category.
+// Weights apply to solves from now on; points already earned stay
+func (us *UserService) SetCategoryWeights(ctx context.Context, w CategoryWeights) error {
+	weights := make(CategoryWeights, len(w))
+	for category, weight := range w {
+		category, err := CheckCategory(category)
+		if err != nil {
+			return err
+		}
+		if category == "" {
+			return ErrEmptyCategory
+		}
+		if math.IsNaN(weight) || weight <= 0 || weight > MaxCategoryWeight {
+			return ErrInvalidCategoryWeight
+		}
+		weights[category] = weight
+	}
+
+	data, err := json.Marshal(weights)
+	if err != nil {
+		return err
+	}
+	if err := us.SetSetting(ctx, SettingCategoryWeights, string(data)); err != nil {
+		return err
+	}
+	log.Printf("Category weights set to %s", data)
+	return nil
+}
+
+// QuestionWorth is what solving a question earns now, its points
+// multiplied by the weight of its category
+func (us *UserService) QuestionWorth(ctx context.Context, q Question) int {
+	return WeightedPoints(q.Points, us.GetCategoryWeights(ctx).For(q.Category))
+}
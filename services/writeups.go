@@ -0,0 +1,368 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/namishh/holmes/database"
+	"github.com/namishh/holmes/repository"
+)
+
+// Writeup is a team's account of how it solved a question, in markdown
+type Writeup = repository.Writeup
+
+// WriteupFile is a file attached to a writeup
+type WriteupFile = repository.WriteupFile
+
+// Writeup statuses. A writeup waits for an admin, and only approved ones
+// are shown in the gallery
+const (
+	WriteupPending  = "pending"
+	WriteupApproved = "approved"
+	WriteupRejected = "rejected"
+)
+
+const (
+	// WriteupMaxLength caps the length of a writeup's body
+	WriteupMaxLength = 20000
+	// WriteupMaxFiles caps the files attached to one writeup
+	WriteupMaxFiles = 5
+	// WriteupFilePrefix starts the storage key of writeup attachments
+	WriteupFilePrefix = "WRT"
+)
+
+var (
+	ErrWriteupNotFound      = errors.New("writeup not found")
+	ErrWriteupsClosed       = errors.New("writeups open once your hunt is over")
+	ErrWriteupNotSolved     = errors.New("only questions you solved can be written up")
+	ErrWriteupEmpty         = errors.New("writeup cannot be empty")
+	ErrWriteupTooLong       = fmt.Errorf("writeup is longer than %d characters", WriteupMaxLength)
+	ErrTooManyWriteupFiles  = fmt.Errorf("a writeup can have at most %d files", WriteupMaxFiles)
+	ErrInvalidWriteupStatus = errors.New("status must be pending, approved or rejected")
+)
+
+// CheckWriteup reports whether a team may write up a question and attach
+// newFiles more files: the team's hunt is over, the question is in its
+// hunt and the team solved it
+func (us *UserService) CheckWriteup(ctx context.Context, teamID, questionID, newFiles int) error {
+	if !us.TeamWindow(ctx, teamID).Ended(time.Now()) {
+		return ErrWriteupsClosed
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	question, err := us.Repo.GetQuestion(ctx, questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWriteupNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching question %d for writeup: %v", questionID, err)
+		return err
+	}
+	huntID, err := us.Repo.GetTeamHuntID(ctx, teamID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && huntID != question.HuntID) {
+		return ErrWriteupNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching hunt of team %d: %v", teamID, err)
+		return err
+	}
+
+	solved, err := us.Repo.IsCompleted(ctx, teamID, questionID)
+	if err != nil {
+		log.Printf("Error checking if question %d is solved by team %d: %v", questionID, teamID, err)
+		return err
+	}
+	if !solved {
+		return ErrWriteupNotSolved
+	}
+
+	if newFiles > 0 {
+		w, err := us.Repo.GetTeamWriteup(ctx, teamID, questionID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error fetching writeup of team %d for question %d: %v", teamID, questionID, err)
+			return err
+		}
+		existing := 0
+		if err == nil {
+			files, err := us.Repo.ListWriteupFiles(ctx, w.ID)
+			if err != nil {
+				log.Printf("Error listing files of writeup %d: %v", w.ID, err)
+				return err
+			}
+			existing = len(files)
+		}
+		if existing+newFiles > WriteupMaxFiles {
+			return ErrTooManyWriteupFiles
+		}
+	}
+	return nil
+}
+
+// SubmitWriteup saves a team's writeup of a question with the stored files
+// keys, named names, attached. Editing a writeup sends it back for review
+func (us *UserService) SubmitWriteup(ctx context.Context, teamID, questionID int, body string, keys, names []string) (Writeup, error) {
+	if body == "" {
+		return Writeup{}, ErrWriteupEmpty
+	}
+	if utf8.RuneCountInString(body) > WriteupMaxLength {
+		return Writeup{}, ErrWriteupTooLong
+	}
+	if err := us.CheckWriteup(ctx, teamID, questionID, len(keys)); err != nil {
+		return Writeup{}, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting writeup transaction: %v", err)
+		return Writeup{}, err
+	}
+	defer tx.Rollback()
+	repo := us.Repo.WithTx(tx)
+
+	now := time.Now()
+	w, err := repo.GetTeamWriteup(ctx, teamID, questionID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		w.ID, err = repo.CreateWriteup(ctx, Writeup{TeamID: teamID, QuestionID: questionID, Body: body, Status: WriteupPending, CreatedAt: now, UpdatedAt: now})
+	case err == nil:
+		err = repo.UpdateWriteup(ctx, w.ID, body, WriteupPending, now)
+	}
+	if err != nil {
+		log.Printf("Error saving writeup of team %d for question %d: %v", teamID, questionID, err)
+		return Writeup{}, err
+	}
+	for i, key := range keys {
+		if err := repo.AddWriteupFile(ctx, w.ID, key, names[i]); err != nil {
+			log.Printf("Error attaching file to writeup %d: %v", w.ID, err)
+			return Writeup{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing writeup: %v", err)
+		return Writeup{}, err
+	}
+	return us.GetWriteup(ctx, w.ID)
+}
+
+// RemoveWriteupFile removes a file from a team's writeup of a question,
+// which goes back for review
+func (us *UserService) RemoveWriteupFile(ctx context.Context, teamID, questionID, fileID int) error {
+	if err := us.CheckWriteup(ctx, teamID, questionID, 0); err != nil {
+		return err
+	}
+	w, err := us.GetTeamWriteup(ctx, teamID, questionID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	var path string
+	for _, f := range w.Files {
+		if f.ID == fileID {
+			path = f.Path
+		}
+	}
+	if path == "" {
+		return ErrWriteupNotFound
+	}
+	if _, err := us.Repo.DeleteWriteupFile(ctx, w.ID, fileID); err != nil {
+		log.Printf("Error removing file %d from writeup %d: %v", fileID, w.ID, err)
+		return err
+	}
+	if err := us.Repo.UpdateWriteup(ctx, w.ID, w.Body, WriteupPending, time.Now()); err != nil {
+		log.Printf("Error updating writeup %d: %v", w.ID, err)
+		return err
+	}
+	if err := us.Storage.Delete(context.Background(), path); err != nil {
+		log.Printf("Warning: Error deleting writeup file %s: %v", path, err)
+	}
+	return nil
+}
+
+// GetWriteup returns a writeup with its files, or ErrWriteupNotFound
+func (us *UserService) GetWriteup(ctx context.Context, id int) (Writeup, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	w, err := us.Repo.GetWriteup(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Writeup{}, ErrWriteupNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching writeup %d: %v", id, err)
+		return Writeup{}, err
+	}
+	return us.withWriteupFiles(ctx, w)
+}
+
+// GetTeamWriteup returns a team's writeup of a question with its files,
+// or ErrWriteupNotFound when it hasn't written one
+func (us *UserService) GetTeamWriteup(ctx context.Context, teamID, questionID int) (Writeup, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	w, err := us.Repo.GetTeamWriteup(ctx, teamID, questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Writeup{}, ErrWriteupNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching writeup of team %d for question %d: %v", teamID, questionID, err)
+		return Writeup{}, err
+	}
+	return us.withWriteupFiles(ctx, w)
+}
+
+func (us *UserService) withWriteupFiles(ctx context.Context, w Writeup) (Writeup, error) {
+	files, err := us.Repo.ListWriteupFiles(ctx, w.ID)
+	if err != nil {
+		log.Printf("Error listing files of writeup %d: %v", w.ID, err)
+		return Writeup{}, err
+	}
+	w.Files = files
+	if w.Files == nil {
+		w.Files = make([]WriteupFile, 0)
+	}
+	return w, nil
+}
+
+// GetWriteups returns the writeups of a hunt with a status, or all of them
+// when status is empty, with their files
+func (us *UserService) GetWriteups(ctx context.Context, huntID int, status string) ([]Writeup, error) {
+	if status != "" && !validWriteupStatus(status) {
+		return nil, ErrInvalidWriteupStatus
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	writeups, err := us.Repo.ListWriteups(ctx, huntID, status)
+	if err != nil {
+		log.Printf("Error listing writeups of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+	files, err := us.Repo.ListHuntWriteupFiles(ctx, huntID)
+	if err != nil {
+		log.Printf("Error listing writeup files of hunt %d: %v", huntID, err)
+		return nil, err
+	}
+
+	byWriteup := make(map[int][]WriteupFile)
+	for _, f := range files {
+		byWriteup[f.WriteupID] = append(byWriteup[f.WriteupID], f)
+	}
+	for i := range writeups {
+		writeups[i].Files = byWriteup[writeups[i].ID]
+		if writeups[i].Files == nil {
+			writeups[i].Files = make([]WriteupFile, 0)
+		}
+	}
+	if writeups == nil {
+		writeups = make([]Writeup, 0)
+	}
+	return writeups, nil
+}
+
+// GalleryOpen reports whether a hunt's approved writeups may be shown to
+// everyone, which waits for the whole hunt to end so no team sees them
+// early
+func (us *UserService) GalleryOpen(ctx context.Context, huntID int) bool {
+	return us.GetHuntWindow(ctx, huntID).Ended(time.Now())
+}
+
+func validWriteupStatus(status string) bool {
+	return status == WriteupPending || status == WriteupApproved || status == WriteupRejected
+}
+
+// ModerateWriteup sets the status of a writeup
+func (us *UserService) ModerateWriteup(ctx context.Context, id int, status string) error {
+	if !validWriteupStatus(status) {
+		return ErrInvalidWriteupStatus
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	found, err := us.Repo.SetWriteupStatus(ctx, id, status)
+	if err != nil {
+		log.Printf("Error setting status of writeup %d: %v", id, err)
+		return err
+	}
+	if !found {
+		return ErrWriteupNotFound
+	}
+	log.Printf("Writeup %d is now %s", id, status)
+	return nil
+}
+
+// DeleteWriteup deletes a writeup and its stored files
+func (us *UserService) DeleteWriteup(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	files, err := us.Repo.ListWriteupFiles(ctx, id)
+	if err != nil {
+		log.Printf("Error listing files of writeup %d: %v", id, err)
+		return err
+	}
+
+	tx, err := us.UserStore.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting transaction to delete writeup %d: %v", id, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	found, err := us.Repo.WithTx(tx).DeleteWriteup(ctx, id)
+	if err != nil {
+		log.Printf("Error deleting writeup %d: %v", id, err)
+		return err
+	}
+	if !found {
+		return ErrWriteupNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing deletion of writeup %d: %v", id, err)
+		return err
+	}
+
+	for _, f := range files {
+		if err := us.Storage.Delete(context.Background(), f.Path); err != nil {
+			log.Printf("Warning: Error deleting writeup file %s: %v", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// GetWriteupFile returns the writeup file stored under key with the
+// writeup it belongs to, or ErrWriteupNotFound
+func (us *UserService) GetWriteupFile(ctx context.Context, key string) (WriteupFile, Writeup, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx)
+	defer cancel()
+
+	f, err := us.Repo.GetWriteupFileByPath(ctx, key)
+	if err == nil {
+		var w Writeup
+		w, err = us.Repo.GetWriteup(ctx, f.WriteupID)
+		if err == nil {
+			return f, w, nil
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return WriteupFile{}, Writeup{}, ErrWriteupNotFound
+	}
+	log.Printf("Error fetching writeup file %s: %v", key, err)
+	return WriteupFile{}, Writeup{}, err
+}
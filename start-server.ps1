@@ -6,6 +6,7 @@ Write-Host "Starting Holmes Server..." -ForegroundColor Green
 # Set required environment variables
 $env:ENVIRONMENT = "DEV"
 $env:REDIS_ADDR = "localhost:6379"
+$env:INSTANCE_ID = "dev"
 
 # MinIO configuration (set BUCKET_USE_SSL to false for local development)
 $env:BUCKET_USE_SSL = "false"
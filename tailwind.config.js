@@ -19,6 +19,12 @@ module.exports = {
           800: '#5b21b6',
           900: '#4c1d95',
         },
+        // Set by admins on the branding page; the defaults are in app.css
+        brand: {
+          DEFAULT: 'rgb(var(--brand-primary) / <alpha-value>)',
+          contrast: 'rgb(var(--brand-contrast) / <alpha-value>)',
+          accent: 'rgb(var(--brand-accent) / <alpha-value>)',
+        },
       },
       animation: {
         'gradient': 'gradientShift 15s ease infinite',